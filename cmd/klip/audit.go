@@ -0,0 +1,176 @@
+// klip - Audit log queries and rotation
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditEventType string
+	auditStatus    string
+	auditProfile   string
+	auditSince     string
+	auditUntil     string
+	auditLimit     int
+)
+
+func auditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Search or rotate the audit log and test its sinks",
+		Long: `The audit log records connections, transfers, scans, profile changes and
+key deployments as JSON lines in ~/.local/state/klip/audit.log. It is
+rotated into compressed archives by size or age and old archives are
+deleted, as configured by settings.audit. Events are also shipped to the
+syslog, journald, TCP and UDP sinks of settings.audit.sinks.`,
+	}
+
+	queryCmd := &cobra.Command{
+		Use:   "query",
+		Short: "Search the audit log and its archives",
+		Long: `Prints the audit events matching all given filters, oldest first, from the
+audit log and its archives. --since and --until take an age such as 36h,
+7d or 2w, a date (2025-01-31) or an RFC 3339 time.
+
+Event types: connection, transfer, scan, sync_conflict, profile_change,
+ssh_key_deployment, health_check.`,
+		Example: `  klip audit query --event-type transfer --since 7d --status failed
+  klip --output json audit query --profile web --limit 20`,
+		Args: cobra.NoArgs,
+		Run:  runAuditQuery,
+	}
+	queryCmd.Flags().StringVar(&auditEventType, "event-type", "", "Only events of this type")
+	queryCmd.Flags().StringVar(&auditStatus, "status", "", "Only events with this status (e.g., success, failed)")
+	queryCmd.Flags().StringVar(&auditProfile, "profile", "", "Only events of this profile")
+	queryCmd.Flags().StringVar(&auditSince, "since", "", "Only events after this time or age (e.g., 7d)")
+	queryCmd.Flags().StringVar(&auditUntil, "until", "", "Only events before this time or age")
+	queryCmd.Flags().IntVar(&auditLimit, "limit", 0, "Show only the most recent events (0 for all)")
+
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the audit log now and delete expired archives",
+		Args:  cobra.NoArgs,
+		Run:   runAuditRotate,
+	}
+
+	testCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a test event to every audit sink",
+		Long: `Sends a sink_test event to every sink of settings.audit.sinks and reports
+which could not be reached. Events sent over UDP or to local sockets are
+not acknowledged, so check that they arrived at the collector.`,
+		Args: cobra.NoArgs,
+		Run:  runAuditTest,
+	}
+
+	cmd.AddCommand(queryCmd, rotateCmd, testCmd)
+	return cmd
+}
+
+func runAuditQuery(cmd *cobra.Command, args []string) {
+	now := time.Now()
+	query := logger.AuditQuery{
+		EventType: auditEventType,
+		Status:    auditStatus,
+		Profile:   auditProfile,
+		Limit:     auditLimit,
+	}
+	var err error
+	if auditSince != "" {
+		if query.Since, err = logger.ParseSince(auditSince, now); err != nil {
+			ui.PrintError("Invalid --since: %v", err)
+			os.Exit(1)
+		}
+	}
+	if auditUntil != "" {
+		if query.Until, err = logger.ParseSince(auditUntil, now); err != nil {
+			ui.PrintError("Invalid --until: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	events, err := logger.QueryAuditLog(query)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	err = ui.Render(events, func() {
+		if len(events) == 0 {
+			ui.PrintInfo("No matching audit events")
+			return
+		}
+
+		pager := ui.StartPager(noPager)
+		defer pager.Close()
+
+		rows := make([][]string, 0, len(events))
+		for _, event := range events {
+			rows = append(rows, []string{
+				event.Timestamp.Local().Format(time.DateTime),
+				event.EventType,
+				event.Profile,
+				event.Operation,
+				event.Status,
+				auditDetails(event),
+			})
+		}
+		ui.PrintTable([]string{"Time", "Event", "Profile", "Operation", "Status", "Details"}, rows)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+// auditDetails summarizes an event's paths, host and error for the table
+func auditDetails(event logger.AuditEvent) string {
+	var details []string
+	switch {
+	case event.Source != "" && event.Destination != "":
+		details = append(details, event.Source+" -> "+event.Destination)
+	case event.Source != "":
+		details = append(details, event.Source)
+	case event.Host != "":
+		details = append(details, event.Host)
+	}
+	if event.Error != "" {
+		details = append(details, event.Error)
+	}
+	return strings.Join(details, ": ")
+}
+
+func runAuditRotate(cmd *cobra.Command, args []string) {
+	if err := logger.RotateAuditLog(); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Audit log rotated")
+}
+
+func runAuditTest(cmd *cobra.Command, args []string) {
+	if len(logger.Sinks) == 0 {
+		ui.PrintInfo("No audit sinks configured (settings.audit.sinks)")
+		return
+	}
+
+	failed := false
+	for i, err := range logger.TestSinks() {
+		if err != nil {
+			ui.PrintError("%v", err)
+			failed = true
+			continue
+		}
+		ui.PrintSuccess("Sent test event to %s", logger.Sinks[i])
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,144 @@
+// klip - Cache file inspection
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cache"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func cacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect or clear klip's cache file",
+		Long: `klip keeps backend hostname resolutions, detected remote capabilities and
+profile usage statistics in one cache file in its state directory
+(~/.local/state/klip/cache.json). Entries that expire or no longer apply
+are ignored and dropped automatically; see DOCUMENTATION.md for the rules.`,
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the contents of the cache file",
+		Args:  cobra.NoArgs,
+		Run:   runCacheShow,
+	}
+
+	clearCmd := &cobra.Command{
+		Use:   "clear [section]...",
+		Short: "Clear the cache file or some of its sections",
+		Long: `Removes the cache file, or with arguments only empties the given sections:
+resolutions, capabilities or usage. The next connection resolves the host
+and probes its capabilities again.`,
+		Example: `  klip cache clear
+  klip cache clear resolutions capabilities`,
+		ValidArgs: cache.Sections,
+		Run:       runCacheClear,
+	}
+
+	cmd.AddCommand(showCmd, clearCmd)
+	return cmd
+}
+
+// openCache opens the cache file or exits
+func openCache() *cache.Store {
+	store, err := cache.OpenStore()
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	return store
+}
+
+func runCacheShow(cmd *cobra.Command, args []string) {
+	store := openCache()
+	state, err := store.Load()
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	err = ui.Render(state, func() {
+		ui.PrintKeyValue("File", store.Path())
+
+		ui.PrintSubHeader("Resolutions")
+		rows := [][]string{}
+		for _, key := range sortedKeys(state.Resolutions) {
+			entry := state.Resolutions[key]
+			rows = append(rows, []string{key, entry.Address, entryAge(entry.ResolvedAt, store.ResolutionExpired(entry))})
+		}
+		printCacheTable([]string{"Backend/Host", "Address", "Age"}, rows)
+
+		ui.PrintSubHeader("Capabilities")
+		rows = [][]string{}
+		for _, profile := range sortedKeys(state.Capabilities) {
+			entry := state.Capabilities[profile]
+			caps := entry.Capabilities
+			rows = append(rows, []string{profile, entry.Host, caps.OS,
+				yesNo(caps.HasRsync), yesNo(caps.HasSFTP), yesNo(caps.HasSCP), entryAge(caps.DetectedAt, store.CapabilitiesStale(entry))})
+		}
+		printCacheTable([]string{"Profile", "Host", "OS", "rsync", "SFTP", "scp", "Age"}, rows)
+
+		ui.PrintSubHeader("Usage")
+		rows = [][]string{}
+		for _, profile := range sortedKeys(state.Usage) {
+			entry := state.Usage[profile]
+			rows = append(rows, []string{profile, strconv.Itoa(entry.Connections),
+				strconv.Itoa(entry.Pushes), strconv.Itoa(entry.Pulls), entry.LastUsed.Format("2006-01-02 15:04")})
+		}
+		printCacheTable([]string{"Profile", "Connections", "Pushes", "Pulls", "Last Used"}, rows)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) {
+	store := openCache()
+	if err := store.Clear(args...); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 0 {
+		ui.PrintSuccess("Removed %s", store.Path())
+		return
+	}
+	ui.PrintSuccess("Cleared %d cache sections", len(args))
+}
+
+// printCacheTable prints a section of the cache file, or that it is empty
+func printCacheTable(headers []string, rows [][]string) {
+	if len(rows) == 0 {
+		ui.PrintInfo("No entries")
+		return
+	}
+	ui.PrintTable(headers, rows)
+}
+
+// sortedKeys returns the keys of a cache section in order
+func sortedKeys[V any](section map[string]V) []string {
+	keys := make([]string, 0, len(section))
+	for key := range section {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// entryAge formats how long ago an entry was recorded, to the second, and
+// whether it is no longer trusted
+func entryAge(t time.Time, stale bool) string {
+	age := time.Since(t).Truncate(time.Second).String()
+	if stale {
+		return age + " " + ui.Dim(ui.T("(stale)"))
+	}
+	return age
+}
@@ -0,0 +1,169 @@
+// klip - Viewing and comparing small remote files
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+)
+
+// diffTroubleExitCode is the exit code of 'klip diff-file' when the files
+// could not be compared, as opposed to differing; diff(1) uses 2 too
+const diffTroubleExitCode = 2
+
+var maxReadSize string
+
+func catCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cat <profile> <path>...",
+		Short: "Print small remote files",
+		Long: `Fetches remote files over SFTP and writes them to stdout, without
+transferring them to disk. Files larger than --max-size are refused.`,
+		Args: cobra.MinimumNArgs(2),
+		Run:  runCat,
+	}
+	addRemoteFileFlags(cmd)
+	return cmd
+}
+
+func diffFileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff-file <profile> <local-file> <remote-path>",
+		Short: "Show a unified diff between a local and a remote file",
+		Long: `Fetches a small remote file over SFTP and shows a unified diff from the
+local file to it, e.g. to inspect configuration drift. Like diff, exits 0
+if the files are identical, 1 if they differ and 2 if they could not be
+compared.`,
+		Args: cobra.ExactArgs(3),
+		Run:  runDiffFile,
+	}
+	addRemoteFileFlags(cmd)
+	return cmd
+}
+
+// addRemoteFileFlags adds the flags shared by cat, diff-file and edit
+func addRemoteFileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cmd.Flags().StringVar(&maxReadSize, "max-size", "1M", "Refuse remote files larger than this")
+}
+
+func runCat(cmd *cobra.Command, args []string) {
+	files := readRemoteFiles(args[0], args[1:], 1)
+	for _, data := range files {
+		os.Stdout.Write(data)
+	}
+}
+
+func runDiffFile(cmd *cobra.Command, args []string) {
+	localPath, remotePath := args[1], args[2]
+
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(diffTroubleExitCode)
+	}
+	remote := readRemoteFiles(args[0], []string{remotePath}, diffTroubleExitCode)[0]
+
+	remoteName := args[0] + ":" + remotePath
+	if transfer.IsBinary(local) || transfer.IsBinary(remote) {
+		if bytes.Equal(local, remote) {
+			ui.PrintSuccess("Files are identical")
+			return
+		}
+		fmt.Printf("Binary files %s and %s differ\n", localPath, remoteName)
+		os.Exit(1)
+	}
+
+	diff, err := transfer.UnifiedDiff(localPath, remoteName, local, remote)
+	if err != nil {
+		ui.PrintError("Failed to compare files: %v", err)
+		os.Exit(diffTroubleExitCode)
+	}
+	if diff == "" {
+		ui.PrintSuccess("Files are identical")
+		return
+	}
+
+	cli.PrintDiff(diff, noPager)
+	os.Exit(1)
+}
+
+// readRemoteFiles connects with the profile and reads the remote files,
+// exiting with failCode on the first that cannot be read
+func readRemoteFiles(profile string, paths []string, failCode int) [][]byte {
+	limit := readLimit(failCode)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, sftpClient := connectSFTP(ctx, profile, config.OpRead, failCode)
+	defer client.Close()
+	defer sftpClient.Close()
+
+	files := make([][]byte, len(paths))
+	for i, name := range paths {
+		var err error
+		if files[i], err = transfer.ReadRemoteFile(sftpClient, name, limit); err != nil {
+			ui.PrintError("%v", err)
+			sftpClient.Close()
+			client.Close()
+			os.Exit(failCode)
+		}
+	}
+	return files
+}
+
+// readLimit returns the --max-size limit, exiting with failCode if it is
+// invalid
+func readLimit(failCode int) int64 {
+	limit, err := config.ParseSize(maxReadSize)
+	if err != nil {
+		ui.PrintError("Invalid --max-size: %v", err)
+		os.Exit(failCode)
+	}
+	return limit
+}
+
+// connectSFTP connects with the profile for operation and opens an SFTP
+// session, exiting with failCode if either fails
+func connectSFTP(ctx context.Context, profile, operation string, failCode int) (*ssh.Client, *sftp.Client) {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profile,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   operation,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(failCode)
+	}
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(failCode)
+	}
+
+	sftpClient, err := sftp.NewClient(client.GetClient())
+	if err != nil {
+		ui.PrintError("Failed to create SFTP client: %v", err)
+		client.Close()
+		os.Exit(failCode)
+	}
+	return client, sftpClient
+}
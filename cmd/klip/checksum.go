@@ -0,0 +1,159 @@
+// klip - Remote file integrity manifests
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/integrity"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var manifestFile string
+
+func checksumCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "checksum",
+		Short: "Record and verify hashes of remote files",
+		Long: `Records a manifest of SHA-256 hashes for every file below a remote
+directory, and later verifies the directory against it to detect drift.`,
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create <profile> <remote-dir>",
+		Short: "Store a manifest of remote file hashes",
+		Args:  cobra.ExactArgs(2),
+		Run:   runChecksumCreate,
+	}
+	createCmd.Flags().StringVarP(&manifestFile, "manifest", "m", "", "Write the manifest to this file instead of the default location")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify <profile> <remote-dir>",
+		Short: "Compare remote files against their stored manifest",
+		Args:  cobra.ExactArgs(2),
+		Run:   runChecksumVerify,
+	}
+	verifyCmd.Flags().StringVarP(&manifestFile, "manifest", "m", "", "Read the manifest from this file instead of the default location")
+
+	for _, sub := range []*cobra.Command{createCmd, verifyCmd} {
+		sub.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+		sub.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+		sub.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+		cmd.AddCommand(sub)
+	}
+
+	return cmd
+}
+
+func runChecksumCreate(cmd *cobra.Command, args []string) {
+	var manifest *integrity.Manifest
+	helper := hashRemoteDir(args[0], args[1], func(ctx context.Context, helper *cli.ConnectionHelper, client *ssh.Client) (err error) {
+		manifest, err = integrity.Create(ctx, client, helper.Profile.Name, helper.Profile.RemoteHost, args[1])
+		return err
+	})
+
+	path := manifestPath(helper.Profile.Name, args[1])
+	if err := manifest.Save(path); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("Recorded %d files in %s", len(manifest.Files), path)
+}
+
+func runChecksumVerify(cmd *cobra.Command, args []string) {
+	path := manifestPath(args[0], args[1])
+	stored, err := integrity.Load(path)
+	if err != nil {
+		ui.PrintError("%v", err)
+		ui.PrintInfo("Run 'klip checksum create %s %s' first", args[0], args[1])
+		os.Exit(1)
+	}
+
+	// Verify consumes the stored file list
+	recorded := len(stored.Files)
+	var drift *integrity.Drift
+	hashRemoteDir(args[0], args[1], func(ctx context.Context, helper *cli.ConnectionHelper, client *ssh.Client) (err error) {
+		drift, err = stored.Verify(ctx, client)
+		return err
+	})
+
+	if drift.Empty() {
+		ui.PrintSuccess("%d files match the manifest from %s", recorded, stored.CreatedAt.Format("2006-01-02 15:04:05"))
+		return
+	}
+
+	for _, name := range drift.Modified {
+		fmt.Printf("%s %s\n", ui.Warning("M"), name)
+	}
+	for _, name := range drift.Added {
+		fmt.Printf("%s %s\n", ui.Success("A"), name)
+	}
+	for _, name := range drift.Removed {
+		fmt.Printf("%s %s\n", ui.Error("D"), name)
+	}
+
+	ui.PrintError("Drift detected: %d modified, %d added, %d removed",
+		len(drift.Modified), len(drift.Added), len(drift.Removed))
+	os.Exit(1)
+}
+
+// hashRemoteDir connects with the profile and runs hash, which hashes the
+// files below dir
+func hashRemoteDir(profile, dir string, hash func(ctx context.Context, helper *cli.ConnectionHelper, client *ssh.Client) error) *cli.ConnectionHelper {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profile,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpChecksum,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(1)
+	}
+
+	// Hashing large trees can take a while; only Ctrl-C cancels it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	err = ui.NewStepRunner(1).Run("Hashing "+dir, func() error {
+		return hash(ctx, helper, client)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		client.Close()
+		os.Exit(1)
+	}
+
+	return helper
+}
+
+// manifestPath returns --manifest or the default manifest location
+func manifestPath(profile, dir string) string {
+	if manifestFile != "" {
+		return manifestFile
+	}
+
+	path, err := integrity.ManifestPath(profile, dir)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	return path
+}
@@ -0,0 +1,379 @@
+// klip - Diagnostics
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/doctor"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/orpheus497/klip/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// doctorTimeout bounds the checks that talk to backends and the network
+const doctorTimeout = 2 * time.Minute
+
+var (
+	doctorReport    string
+	doctorNoConnect bool
+)
+
+// doctorCategories titles the categories of checks in the order shown
+var doctorCategories = []struct{ name, title string }{
+	{"config", "Configuration"},
+	{"keys", "SSH Keys"},
+	{"tools", "Local Tools"},
+	{"backend", "Backends"},
+	{"dns", "Name Resolution"},
+	{"path", "Network Path"},
+	{"known_hosts", "Known Hosts"},
+	{"remote", "Remote Host"},
+}
+
+func doctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor [profile]",
+		Short: "Diagnose problems with the configuration, keys, backends and network",
+		Long: `Checks what klip depends on and says how to fix what is broken: the
+configuration, the permissions of SSH keys, local rsync, each backend's CLI
+and connection, and, for a profile (default: the current one), name
+resolution, the SSH server and path MTU to the host, known_hosts entries
+against the key the host presents, and after logging in the host's rsync
+and SFTP subsystem.
+
+Exits with status 1 if any check fails. --report saves the checks as JSON,
+e.g. to attach to a bug report.`,
+		Example: `  klip doctor
+  klip doctor web --report klip-doctor.json
+  klip doctor web --no-connect --output json`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  runDoctor,
+	}
+
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cmd.Flags().StringVar(&doctorReport, "report", "", "Also write the report as JSON to this file")
+	cmd.Flags().BoolVar(&doctorNoConnect, "no-connect", false, "Do not log in to check the remote host's rsync and SFTP")
+
+	return cmd
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	info := version.GetInfo()
+	report := &doctor.Report{Version: info.Version, Platform: info.Platform, Time: time.Now()}
+
+	cfg, err := config.Load()
+	report.Add(doctor.Config(cfg, configLocation(), err)...)
+	if err == nil {
+		profile := doctorProfile(cfg, args, report)
+		if profile != nil {
+			report.Profile = profile.Name
+		}
+
+		profiles := []*config.Profile{profile}
+		if profile == nil {
+			profiles = sortedProfiles(cfg)
+		}
+		report.Add(doctor.Keys(profiles, func(p *config.Profile) string {
+			_, keyDir, _ := cli.TrustDomain(cfg, p)
+			return keyDir
+		}, cfg.Settings.DefaultKeys)...)
+
+		method, strict := cfg.Settings.TransferMethod, false
+		if profile != nil {
+			if profile.TransferOptions.Method != "" {
+				method = profile.TransferOptions.Method
+			}
+			strict = profile.TransferOptions.StrictMethod
+		}
+		report.Add(doctor.Tools(exec.LookPath, method, strict)...)
+
+		registry := newRegistry()
+		report.Add(doctor.Backends(ctx, registry.List(), profile)...)
+		if profile != nil {
+			diagnoseHost(ctx, cfg, profile, registry, report)
+		}
+	}
+
+	if doctorReport != "" {
+		if err := report.WriteFile(doctorReport); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+	}
+
+	err = ui.Render(report, func() { printDoctorReport(report) })
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if report.Count(doctor.Fail) > 0 {
+		os.Exit(1)
+	}
+}
+
+// configLocation names where the configuration is loaded from
+func configLocation() string {
+	if config.StoreURL != "" {
+		return config.StoreURL
+	}
+	path, err := config.ConfigPath()
+	if err != nil {
+		return "config.yaml"
+	}
+	return path
+}
+
+// doctorProfile returns the profile to diagnose, with the overrides of the
+// network location and --backend applied: the one named, or the current
+// profile. It returns nil if there is none, adding a failed check if the
+// named profile does not exist.
+func doctorProfile(cfg *config.Config, args []string, report *doctor.Report) *config.Profile {
+	name := cfg.CurrentProfile
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if name == "" {
+		return nil
+	}
+
+	profile, _, err := cfg.ResolveProfile(name)
+	if err != nil {
+		report.Add(doctor.Check{
+			Category: "config", Name: name, Status: doctor.Fail,
+			Message: err.Error(),
+			Remedy:  "List the profiles with 'klip profile list'",
+		})
+		return nil
+	}
+
+	profile, _ = cli.ApplyLocation(cfg, profile)
+	if backendName != "" {
+		profile = profile.Clone()
+		profile.Backend = config.BackendType(backendName)
+	}
+	return profile
+}
+
+// sortedProfiles returns the profiles of cfg by name
+func sortedProfiles(cfg *config.Config) []*config.Profile {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := make([]*config.Profile, 0, len(names))
+	for _, name := range names {
+		if profile := cfg.Profiles[name]; profile != nil {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// diagnoseHost checks the way to the profile's host: backend selection,
+// name resolution, the path to the first hop, known_hosts, and what the
+// host offers once logged in
+func diagnoseHost(ctx context.Context, cfg *config.Config, profile *config.Profile, registry *backend.Registry, report *doctor.Report) {
+	detector := backend.NewDetector(registry).Restrict(profile.BackendPermitted)
+	b, err := detector.SelectBackend(ctx, string(profile.Backend))
+	if err != nil {
+		report.Add(doctor.Check{
+			Category: "backend", Name: profile.Name, Status: doctor.Fail,
+			Message: err.Error(),
+			Remedy:  "Connect one of the backends the profile may use, or set its backend to lan",
+		})
+		return
+	}
+	report.Add(doctor.Check{
+		Category: "backend", Name: profile.Name, Status: doctor.OK,
+		Message: "connects through " + b.Name(),
+	})
+
+	knownHosts, _, err := cli.TrustDomain(cfg, profile)
+	if err == nil && knownHosts == "" {
+		knownHosts, err = ssh.GetKnownHostsPath("")
+	}
+	if err != nil {
+		report.Add(doctor.Check{Category: "known_hosts", Name: profile.Name, Status: doctor.Fail, Message: err.Error()})
+		return
+	}
+	hostCAs, _ := ssh.ParseHostCAKeys(cfg.Settings.HostCAKeys)
+	fileCheck, callback := doctor.KnownHostsFile(knownHosts)
+	report.Add(fileCheck)
+
+	// Behind jump hosts only the first hop is reached from here; the last
+	// one resolves and dials the host itself
+	var name, addr string
+	var port int
+	if chain := profile.JumpChain(); len(chain) > 0 {
+		report.Add(doctor.DNS(ctx, []string{chain[0].Host}, net.DefaultResolver.LookupHost, b)...)
+		addrs, err := cli.ResolveJumpChain(ctx, b, profile)
+		if err != nil {
+			report.Add(doctor.Check{Category: "path", Name: "jump host " + chain[0].Host, Status: doctor.Fail, Message: err.Error()})
+			return
+		}
+		name, addr, port = "jump host "+chain[0].Host, addrs[0], chain[0].SSHPort()
+		if callback != nil {
+			report.Add(doctor.HostKeys(callback, knownHosts, profile.HostNames(), profile.SSHPort, nil, hostCAs)...)
+		}
+	} else {
+		report.Add(doctor.DNS(ctx, profile.HostNames(), net.DefaultResolver.LookupHost, b)...)
+		name, addr, port = profile.RemoteHost, profile.RemoteHost, profile.SSHPort
+		if b.Name() == "lan" {
+			if ip, err := b.GetPeerIP(ctx, profile.RemoteHost); err == nil {
+				route := backend.NewDetector(registry).CheckLANRoute(ctx, profile.RemoteHost, ip)
+				report.Add(doctor.Route(route, profile.RequireEncryptedPath))
+			}
+		} else {
+			if addr, err = b.GetPeerIP(ctx, profile.RemoteHost); err != nil {
+				return
+			}
+		}
+	}
+
+	pathChecks := doctor.Path(ctx, name, addr, port, b.Name(), doctor.SystemPing, ssh.CheckBanner)
+	report.Add(pathChecks...)
+	if pathChecks[0].Status == doctor.Fail {
+		return
+	}
+
+	// A pin applies to the host itself, not to the jump host reached here;
+	// behind jump hosts logging in checks it
+	pinned := profile.HostKeyFingerprint != "" && len(profile.JumpChain()) == 0
+	if callback != nil || pinned {
+		key, err := ssh.ScanHostKey(ctx, addr, port)
+		switch {
+		case err != nil:
+			report.Add(doctor.Check{Category: "known_hosts", Name: addr, Status: doctor.Skip, Message: fmt.Sprintf("the host key could not be read: %v", err)})
+		case pinned:
+			report.Add(doctor.Pinned(profile.Name, addr, profile.HostKeyFingerprint, key))
+		default:
+			report.Add(doctor.HostKeys(callback, knownHosts, []string{addr}, port, key, hostCAs)...)
+		}
+	}
+
+	if !doctorNoConnect {
+		checkRemote(ctx, cfg, profile, report)
+	}
+}
+
+// checkRemote logs in to the profile's host and checks its transfer tools,
+// if the profile's access rules permit connecting
+func checkRemote(ctx context.Context, cfg *config.Config, profile *config.Profile, report *doctor.Report) {
+	login := doctor.Check{Category: "remote", Name: "login"}
+
+	if profile.AccessFor(cfg.Settings.Roles, config.OpConnect) == config.AccessDenied {
+		login.Status, login.Message = doctor.Skip, "connecting is disabled by the profile's access rules"
+		report.Add(login)
+		return
+	}
+
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profile.Name,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		NoMux:       true,
+		Operation:   config.OpConnect,
+	})
+	if errors.Is(err, cli.ErrAccessCancelled) {
+		login.Status, login.Message = doctor.Skip, "connecting was not confirmed"
+		report.Add(login)
+		return
+	}
+	if err != nil {
+		login.Status, login.Message = doctor.Fail, err.Error()
+		report.Add(login)
+		return
+	}
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		login.Status, login.Message = doctor.Fail, err.Error()
+		login.Remedy = fmt.Sprintf("Run 'klip %s --verbose' to see where connecting fails", profile.Name)
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			login.Remedy = fmt.Sprintf("Add the public key to ~/.ssh/authorized_keys of %s on the host, e.g. with ssh-copy-id, or correct remote_user", profile.RemoteUser)
+		}
+		report.Add(login)
+		return
+	}
+	defer client.Close()
+
+	login.Status, login.Message = doctor.OK, fmt.Sprintf("logged in as %s", profile.RemoteUser)
+	report.Add(login)
+
+	caps, err := ssh.DetectCapabilities(ctx, client)
+	if err != nil {
+		report.Add(doctor.Check{Category: "remote", Name: "tools", Status: doctor.Skip, Message: err.Error()})
+		return
+	}
+	report.Add(doctor.Remote(caps)...)
+}
+
+// printDoctorReport prints the checks by category with their remedies
+func printDoctorReport(report *doctor.Report) {
+	ui.PrintHeader("klip Doctor")
+	if report.Profile != "" {
+		ui.PrintKeyValue("Profile", report.Profile)
+	}
+
+	for _, category := range doctorCategories {
+		var printed bool
+		for _, c := range report.Checks {
+			if c.Category != category.name {
+				continue
+			}
+			if !printed {
+				ui.PrintSubHeader(category.title)
+				printed = true
+			}
+
+			symbol := ui.Success("✓")
+			switch c.Status {
+			case doctor.Warn:
+				symbol = ui.Warning("!")
+			case doctor.Fail:
+				symbol = ui.Error("✗")
+			case doctor.Skip:
+				symbol = ui.Dim("-")
+			}
+			fmt.Printf("%s %s: %s\n", symbol, ui.Bold(c.Name), c.Message)
+			if c.Remedy != "" {
+				fmt.Printf("    %s %s\n", ui.Dim("→"), c.Remedy)
+			}
+		}
+	}
+
+	fmt.Println()
+	summary := fmt.Sprintf(ui.T("%d ok, %d warnings, %d failed, %d skipped"),
+		report.Count(doctor.OK), report.Count(doctor.Warn), report.Count(doctor.Fail), report.Count(doctor.Skip))
+	switch {
+	case report.Count(doctor.Fail) > 0:
+		ui.PrintError("%s", summary)
+	case report.Count(doctor.Warn) > 0:
+		ui.PrintWarning("%s", summary)
+	default:
+		ui.PrintSuccess("%s", summary)
+	}
+	if doctorReport != "" {
+		ui.PrintInfo("Report written to %s", doctorReport)
+	}
+}
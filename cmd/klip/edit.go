@@ -0,0 +1,167 @@
+// klip - Editing remote files
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// defaultEditor is used when neither $VISUAL nor $EDITOR is set
+const defaultEditor = "vi"
+
+var noBackup bool
+
+func editCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit <profile> <remote-file>",
+		Short: "Edit a remote file in your local editor",
+		Long: `Downloads a remote file to a temporary directory and opens it in $VISUAL
+or $EDITOR (vi if neither is set). When the editor exits, the changes are
+shown as a diff and, once confirmed, the original is backed up as
+<file>.klip-bak.<timestamp> and the edited file is uploaded atomically.`,
+		Args: cobra.ExactArgs(2),
+		Run:  runEdit,
+	}
+	addRemoteFileFlags(cmd)
+	cmd.Flags().BoolVar(&noBackup, "no-backup", false, "Don't keep a backup of the original file")
+	return cmd
+}
+
+func runEdit(cmd *cobra.Command, args []string) {
+	limit := readLimit(1)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, sftpClient := connectSFTP(ctx, args[0], config.OpEdit, 1)
+	defer client.Close()
+	defer sftpClient.Close()
+	if cli.KeepAlive > 0 {
+		go client.KeepAlive(ctx, cli.KeepAlive, cli.KeepAliveMax)
+	}
+
+	exit := func(format string, a ...interface{}) {
+		ui.PrintError(format, a...)
+		sftpClient.Close()
+		client.Close()
+		os.Exit(1)
+	}
+
+	name, err := transfer.ExpandRemoteHome(sftpClient, args[1])
+	if err != nil {
+		exit("%v", err)
+	}
+	info, err := sftpClient.Stat(name)
+	if err != nil {
+		exit("Failed to stat %s: %v", name, err)
+	}
+	original, err := transfer.ReadRemoteFile(sftpClient, name, limit)
+	if err != nil {
+		exit("%v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "klip-edit-")
+	if err != nil {
+		exit("Failed to create temporary directory: %v", err)
+	}
+	// Edits that were not uploaded are kept; os.Exit skips the cleanup
+	keep := false
+	defer func() {
+		if !keep {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	// Keep the remote file name so editors pick the right syntax
+	localPath := filepath.Join(dir, path.Base(name))
+	if err := os.WriteFile(localPath, original, 0600); err != nil {
+		exit("Failed to write %s: %v", localPath, err)
+	}
+
+	if err := runEditor(localPath); err != nil {
+		os.RemoveAll(dir)
+		exit("Editor failed, %s was not changed: %v", name, err)
+	}
+	edited, err := os.ReadFile(localPath)
+	if err != nil {
+		exit("Failed to read %s: %v", localPath, err)
+	}
+	if bytes.Equal(original, edited) {
+		ui.PrintInfo("No changes")
+		return
+	}
+
+	remoteName := args[0] + ":" + name
+	if transfer.IsBinary(original) || transfer.IsBinary(edited) {
+		fmt.Printf("Binary file %s changed\n", remoteName)
+	} else if diff, err := transfer.UnifiedDiff(remoteName, "edited/"+path.Base(name), original, edited); err == nil {
+		cli.PrintDiff(diff, noPager)
+	}
+
+	confirmed, err := ui.ConfirmDestructive(ui.Destructive, "Upload changes to %s?", remoteName)
+	if err != nil || !confirmed {
+		if err != nil {
+			ui.PrintError("%v", err)
+		}
+		keep = true
+		ui.PrintInfo("Not uploaded; your changes are in %s", localPath)
+		return
+	}
+
+	// Don't silently overwrite changes made on the host while editing
+	if current, err := sftpClient.Stat(name); err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		ui.PrintWarning("%s changed on the remote host while you were editing", remoteName)
+		confirmed, err := ui.ConfirmDestructive(ui.Irreversible, "Overwrite it anyway?")
+		if err != nil || !confirmed {
+			keep = true
+			ui.PrintInfo("Not uploaded; your changes are in %s", localPath)
+			return
+		}
+	}
+
+	if !noBackup {
+		backupPath := name + ".klip-bak." + time.Now().Format("20060102-150405")
+		if err := transfer.WriteRemoteFile(sftpClient, backupPath, original, info.Mode()); err != nil {
+			exit("Failed to back up %s, not uploaded (your changes are in %s): %v", name, localPath, err)
+		}
+		ui.PrintInfo("Original saved as %s", backupPath)
+	}
+
+	if err := transfer.WriteRemoteFile(sftpClient, name, edited, info.Mode()); err != nil {
+		exit("Failed to upload %s (your changes are in %s): %v", name, localPath, err)
+	}
+	ui.PrintSuccess("Updated %s", remoteName)
+}
+
+// runEditor opens a file in $VISUAL, $EDITOR or vi and waits for it to exit
+func runEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{defaultEditor}
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
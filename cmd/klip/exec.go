@@ -0,0 +1,153 @@
+// klip - Remote command execution
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/history"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// execFailedExitCode is the exit code of 'klip exec' when the command could
+// not be run, as opposed to running and exiting non-zero; ssh uses 255 too
+const execFailedExitCode = 255
+
+var (
+	execTTY     bool
+	execNoStdin bool
+)
+
+func execCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec [flags] -- <command>",
+		Short: "Run a command on the remote host",
+		Long: `Runs a command on the remote host non-interactively and streams its
+output live as it is produced. Local stdin is piped to the command, and
+klip exec exits with the command's exit status, or 255 if it could not be
+run, so it can be used in scripts and pipelines like ssh.
+
+With --tty the command runs on a pseudo-terminal, for commands that need
+one, like top, sudo with a password prompt or a full-screen editor.
+
+With --profiles the command runs on several hosts at once, --parallel at a
+time. Profiles are given as names or patterns like 'web*'. Output lines
+are prefixed with the profile name, stdin is not piped, and a summary of
+the hosts it failed on is printed at the end.
+
+Commands are recorded in the profile's klip history (see 'klip history').
+A single argument of !N re-runs entry N, !-N the Nth most recent entry and
+!! the most recent one; quote it so the local shell does not expand it.`,
+		Example: `  klip exec -p web -- systemctl status nginx
+  klip exec -p db -- 'pg_dump app' > app.sql
+  klip exec -p web -- 'cat > /tmp/motd' < motd
+  klip exec -p web --tty -- htop
+  klip exec --profiles 'web*,db1' -- uptime
+  klip exec -p web -- '!3'`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  runExec,
+	}
+
+	cmd.Flags().StringVarP(&profileName, "profile", "p", "", "Connection profile to use")
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cmd.Flags().BoolVar(&execTTY, "tty", false, "Run the command on a pseudo-terminal")
+	cmd.Flags().BoolVarP(&execNoStdin, "no-stdin", "n", false, "Don't pipe stdin to the command (like ssh -n)")
+	cmd.Flags().StringSliceVar(&execProfiles, "profiles", nil, "Run on these profiles in parallel (names or patterns like 'web*')")
+	cmd.Flags().IntVar(&execParallel, "parallel", 10, "Maximum number of hosts to run on at once with --profiles")
+	cmd.MarkFlagsMutuallyExclusive("tty", "no-stdin")
+	cmd.MarkFlagsMutuallyExclusive("profile", "profiles")
+	cmd.MarkFlagsMutuallyExclusive("tty", "profiles")
+
+	return cmd
+}
+
+func runExec(cmd *cobra.Command, args []string) {
+	command := strings.Join(args, " ")
+	if len(execProfiles) > 0 {
+		os.Exit(runExecFanout(execProfiles, command))
+	}
+
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profileName,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpExec,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(execFailedExitCode)
+	}
+
+	hist, err := history.Load(helper.Profile.Name)
+	if err != nil {
+		ui.PrintWarning("Command history unavailable: %v", err)
+	}
+	if hist != nil && len(args) == 1 {
+		expanded, ok, err := hist.Expand(args[0])
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(execFailedExitCode)
+		}
+		if ok {
+			command = expanded
+			ui.PrintInfo("Running: %s", command)
+		}
+	}
+	if hist != nil {
+		if err := hist.Add(command); err != nil {
+			ui.PrintWarning("Failed to record command history: %v", err)
+		}
+	}
+
+	// Cancel the remote command on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(execFailedExitCode)
+	}
+	defer client.Close()
+
+	var stdin io.Reader = os.Stdin
+	if execNoStdin {
+		stdin = nil
+	}
+	if status := execRemote(ctx, client, command, stdin, os.Stdout, os.Stderr); status != 0 {
+		client.Close()
+		os.Exit(status)
+	}
+}
+
+// execRemote runs command on client, on a pseudo-terminal with --tty and
+// otherwise with stdin piped to it, and returns the exit status for klip
+// exec: the command's own, or execFailedExitCode if it could not be run
+func execRemote(ctx context.Context, client *ssh.Client, command string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var err error
+	if execTTY {
+		err = client.RunCommandTerminal(ctx, command)
+	} else {
+		err = client.RunCommandPipe(ctx, command, stdin, stdout, stderr)
+	}
+	if err == nil {
+		return 0
+	}
+	if status, ok := ssh.ExitStatus(err); ok {
+		return status
+	}
+	ui.PrintError("Remote command failed: %v", err)
+	return execFailedExitCode
+}
@@ -0,0 +1,50 @@
+// klip - Tests of remote command execution
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecRemote(t *testing.T) {
+	server := clitest.NewEnv(t).StartExecSSHServer(func(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		name, arg, _ := strings.Cut(command, " ")
+		switch name {
+		case "cat":
+			io.Copy(stdout, stdin)
+			return 0
+		case "exit":
+			status, _ := strconv.Atoi(arg)
+			return status
+		}
+		fmt.Fprintf(stderr, "sh: %s: not found\n", name)
+		return 127
+	})
+	client, err := connectTestServer(t, server)
+	require.NoError(t, err)
+
+	// stdin is piped to the command
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, execRemote(context.Background(), client, "cat", strings.NewReader("motd\n"), &stdout, &stderr))
+	assert.Equal(t, "motd\n", stdout.String())
+
+	// klip exec exits with the command's status, like ssh
+	assert.Equal(t, 3, execRemote(context.Background(), client, "exit 3", nil, &stdout, &stderr))
+	assert.Equal(t, 127, execRemote(context.Background(), client, "rsnyc", nil, &stdout, &stderr))
+	assert.Equal(t, "sh: rsnyc: not found\n", stderr.String())
+
+	// A command that could not be run exits with 255
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, execFailedExitCode, execRemote(ctx, client, "cat", nil, &stdout, &stderr))
+}
@@ -0,0 +1,193 @@
+// klip - Running a command on several profiles
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/history"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+var (
+	execProfiles []string
+	execParallel int
+)
+
+// fanoutResult is the outcome of the command on one profile
+type fanoutResult struct {
+	profile string
+	elapsed time.Duration
+
+	// status is the command's exit status; err is set instead if the
+	// command could not be run
+	status int
+	err    error
+}
+
+// prefixedOutput writes lines from several hosts to stdout and stderr,
+// each prefixed with its profile name, without interleaving lines
+type prefixedOutput struct {
+	mu     sync.Mutex
+	width  int
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (o *prefixedOutput) line(profile, line string, isStderr bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	w := o.stdout
+	if isStderr {
+		w = o.stderr
+	}
+	fmt.Fprintf(w, "%s %s\n", ui.Dim(fmt.Sprintf("%-*s |", o.width, profile)), line)
+}
+
+// runExecFanout runs command on every profile matching patterns, at most
+// execParallel at a time, and returns the exit code for klip exec: 0 if it
+// succeeded everywhere, execFailedExitCode if it could not be run on some
+// host, and 1 if it only exited non-zero
+func runExecFanout(patterns []string, command string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		return execFailedExitCode
+	}
+	profiles, err := cfg.MatchProfiles(patterns)
+	if err != nil {
+		ui.PrintError("%v", err)
+		return execFailedExitCode
+	}
+
+	out := &prefixedOutput{stdout: os.Stdout, stderr: os.Stderr}
+	for _, profile := range profiles {
+		out.width = max(out.width, len(profile))
+	}
+
+	// Cancel the remote commands on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	parallel := execParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	slots := make(chan struct{}, parallel)
+	results := make([]fanoutResult, len(profiles))
+	var wg sync.WaitGroup
+	for i, profile := range profiles {
+		// Access rules are applied before any host is contacted, so their
+		// confirmations are asked one at a time
+		if err := authorizeExec(cfg, profile); err != nil {
+			results[i] = fanoutResult{profile: profile, err: err}
+			out.line(profile, ui.Error(err.Error()), true)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, profile string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			started := time.Now()
+			results[i] = execOnProfile(ctx, profile, command, out)
+			results[i].elapsed = time.Since(started)
+			if results[i].err != nil {
+				out.line(profile, ui.Error(results[i].err.Error()), true)
+			}
+		}(i, profile)
+	}
+	wg.Wait()
+
+	return summarizeFanout(results)
+}
+
+// authorizeExec applies the access rules of a profile to klip exec
+func authorizeExec(cfg *config.Config, name string) error {
+	profile, _, err := cfg.ResolveProfile(name)
+	if err != nil {
+		return err
+	}
+	return cli.Authorize(cfg, profile, config.OpExec)
+}
+
+// execOnProfile connects to one profile and runs command, streaming its
+// output through out
+func execOnProfile(ctx context.Context, profile, command string, out *prefixedOutput) fanoutResult {
+	result := fanoutResult{profile: profile}
+
+	// Access rules were applied by authorizeExec
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profile,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+	})
+	if err != nil {
+		result.err = fmt.Errorf("failed to initialize connection: %w", err)
+		return result
+	}
+
+	if hist, err := history.Load(profile); err == nil {
+		hist.Add(command)
+	}
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		result.err = fmt.Errorf("connection failed: %w", err)
+		return result
+	}
+	defer client.Close()
+
+	err = client.RunCommandLines(ctx, command, func(line string, isStderr bool) {
+		out.line(profile, line, isStderr)
+	})
+	if status, ok := ssh.ExitStatus(err); ok {
+		result.status = status
+	} else {
+		result.err = err
+	}
+	return result
+}
+
+// summarizeFanout prints the profiles the command failed on and returns
+// the exit code for klip exec
+func summarizeFanout(results []fanoutResult) int {
+	var rows [][]string
+	code := 0
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			rows = append(rows, []string{result.profile, "not run", result.err.Error()})
+			code = execFailedExitCode
+		case result.status != 0:
+			rows = append(rows, []string{result.profile, "exit " + strconv.Itoa(result.status), "after " + result.elapsed.Round(time.Millisecond).String()})
+			if code == 0 {
+				code = 1
+			}
+		}
+	}
+
+	fmt.Println()
+	if len(rows) == 0 {
+		ui.PrintSuccess("Succeeded on all %d profiles", len(results))
+		return 0
+	}
+	ui.PrintError("Failed on %d of %d profiles", len(rows), len(results))
+	ui.PrintTable([]string{"Profile", "Result", "Details"}, rows)
+	return code
+}
@@ -0,0 +1,269 @@
+// klip - Port forwarding
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// Delays between attempts to re-establish a dropped connection
+var (
+	reconnectDelay    = 2 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+var (
+	localForwards  []string
+	remoteForwards []string
+)
+
+func forwardCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "forward <profile> [-L spec]... [-R spec]...",
+		Short: "Forward ports between this machine and the remote host",
+		Long: `Opens port forwards over the selected backend and holds them open until
+Ctrl-C. Forwards use ssh syntax, [bind_address:]port:host:hostport:
+
+  -L  listens locally and connects to host:hostport as seen from the remote host
+  -R  listens on the remote host and connects to host:hostport as seen from here,
+      exposing a local service to the remote host
+
+Without -L or -R, the profile's forwards: and remote_forwards: are opened.
+
+The connection is checked with keepalives, and if it drops klip reconnects
+and re-establishes every tunnel.`,
+		Example: `  klip forward web -L 8080:localhost:80
+  klip forward web --remote 9000:localhost:3000
+  klip forward db -L 5432:db.internal:5432 -L 6379:localhost:6379`,
+		Args: cobra.ExactArgs(1),
+		Run:  runForward,
+	}
+
+	cmd.Flags().StringArrayVarP(&localForwards, "local", "L", nil, "Local forward [bind_address:]port:host:hostport (repeatable)")
+	cmd.Flags().StringArrayVarP(&remoteForwards, "remote", "R", nil, "Remote forward [bind_address:]port:host:hostport (repeatable)")
+	cli.AddKeepAliveFlags(cmd)
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+
+	return cmd
+}
+
+func runForward(cmd *cobra.Command, args []string) {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: args[0],
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpForward,
+		// Remote forwards cannot be routed through a mux
+		NoMux: true,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(1)
+	}
+
+	forwards, err := parseForwards(helper.Profile)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	// Bind every local port before connecting so conflicts fail fast
+	listeners := make(map[*config.Forward]net.Listener)
+	for _, f := range forwards {
+		if f.Remote {
+			continue
+		}
+		ln, err := net.Listen("tcp", f.ListenAddr())
+		if err != nil {
+			ui.PrintError("Failed to listen on %s: %v", f.ListenAddr(), err)
+			os.Exit(1)
+		}
+		listeners[f] = ln
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("Connected to %s@%s via %s", helper.Profile.RemoteUser, helper.ResolvedHost, helper.Backend.Name())
+
+	rows := make([][]string, 0, len(forwards))
+	for _, f := range forwards {
+		listen, target := "local", "remote"
+		if f.Remote {
+			listen, target = target, listen
+		}
+		rows = append(rows, []string{listen + " " + f.ListenAddr(), target + " " + f.TargetAddr()})
+	}
+	ui.PrintTable([]string{"Listen", "Connect To"}, rows)
+	ui.PrintInfo("Forwarding %d port(s), press Ctrl-C to stop", len(forwards))
+
+	for {
+		err := serveForwards(ctx, client, forwards, listeners)
+		client.Close()
+		if ctx.Err() != nil {
+			break
+		}
+
+		ui.PrintWarning("Connection to %s lost: %v", helper.Profile.RemoteHost, err)
+		client = reconnect(ctx, func(ctx context.Context) (*ssh.Client, error) {
+			return helper.CreateSSHClient(ctx, timeout)
+		})
+		if client == nil {
+			break
+		}
+		ui.PrintSuccess("Reconnected via %s, tunnels re-established", helper.Backend.Name())
+
+		// The previous session closed the local listeners
+		listeners = nil
+	}
+
+	ui.PrintInfo("Tunnels closed")
+}
+
+// parseForwards returns the forwards given on the command line, or the
+// profile's forwards if there are none
+func parseForwards(profile *config.Profile) ([]*config.Forward, error) {
+	local, remote := localForwards, remoteForwards
+	if len(local) == 0 && len(remote) == 0 {
+		local, remote = profile.Forwards, profile.RemoteForwards
+	}
+	if len(local) == 0 && len(remote) == 0 {
+		return nil, fmt.Errorf("no forwards given; use -L/-R or add forwards:/remote_forwards: to profile '%s'", profile.Name)
+	}
+
+	var forwards []*config.Forward
+	for _, spec := range local {
+		f, err := config.ParseForward(spec)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+	for _, spec := range remote {
+		f, err := config.ParseRemoteForward(spec)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+
+	return forwards, nil
+}
+
+// serveForwards runs every forward over client until ctx is cancelled
+// (returning nil) or the connection is lost (returning why)
+// Local forwards use the listener in listeners if there is one and listen
+// anew otherwise.
+func serveForwards(ctx context.Context, client *ssh.Client, forwards []*config.Forward, listeners map[*config.Forward]net.Listener) error {
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 2)
+	go func() {
+		client.GetClient().Wait()
+		lost <- fmt.Errorf("connection closed")
+	}()
+	if interval, maxMissed := cli.KeepAlive, cli.KeepAliveMax; interval > 0 {
+		go func() {
+			if err := client.KeepAlive(sessionCtx, interval, maxMissed); err != nil {
+				lost <- err
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range forwards {
+		notify := func(ev ssh.ForwardEvent) {
+			switch {
+			case ev.Err != nil:
+				ui.PrintWarning("%s: %v", f.ListenAddr(), ev.Err)
+			case !verbose:
+			case ev.Open:
+				ui.PrintInfo("%s: connection from %s opened", f.ListenAddr(), ev.From)
+			default:
+				ui.PrintInfo("%s: connection from %s closed", f.ListenAddr(), ev.From)
+			}
+		}
+
+		ln := listeners[f]
+		if !f.Remote && ln == nil {
+			var err error
+			if ln, err = net.Listen("tcp", f.ListenAddr()); err != nil {
+				ui.PrintWarning("Failed to listen on %s: %v", f.ListenAddr(), err)
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var err error
+			if f.Remote {
+				err = client.ForwardRemote(sessionCtx, f.ListenAddr(), f.TargetAddr(), notify)
+			} else {
+				err = client.ForwardLocal(sessionCtx, ln, f.TargetAddr(), notify)
+			}
+			if err != nil && sessionCtx.Err() == nil {
+				ui.PrintWarning("%s: %v", f, err)
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-lost:
+	}
+
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// reconnect retries dial with increasing delays until it succeeds or ctx is
+// cancelled, in which case it returns nil
+func reconnect(ctx context.Context, dial func(context.Context) (*ssh.Client, error)) *ssh.Client {
+	delay := reconnectDelay
+	for {
+		ui.PrintInfo("Reconnecting in %s…", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		client, err := dial(ctx)
+		if err == nil {
+			return client
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		ui.PrintWarning("Reconnect failed: %v", err)
+
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
@@ -0,0 +1,125 @@
+// klip - Tests of port forwarding
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectTestServer returns a client connected to a new test SSH server
+func connectTestServer(t *testing.T, server *clitest.SSHServer) (*ssh.Client, error) {
+	client, err := ssh.NewClient(&ssh.Config{
+		Host:           server.Host,
+		Port:           server.Port,
+		User:           "test",
+		KeyPath:        server.KeyPath,
+		NonInteractive: true,
+	})
+	require.NoError(t, err)
+	if err := client.Connect(context.Background()); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, nil
+}
+
+func TestServeForwards(t *testing.T) {
+	server := clitest.NewEnv(t).StartSSHServer()
+
+	keepAlive, keepAliveMax := cli.KeepAlive, cli.KeepAliveMax
+	cli.KeepAlive, cli.KeepAliveMax = 10*time.Millisecond, 3
+	t.Cleanup(func() { cli.KeepAlive, cli.KeepAliveMax = keepAlive, keepAliveMax })
+
+	// serve runs a local forward over client on a new listener
+	serve := func(t *testing.T, ctx context.Context, client *ssh.Client) (net.Listener, chan error) {
+		f, err := config.ParseForward("8080:localhost:80")
+		require.NoError(t, err)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		done := make(chan error, 1)
+		go func() {
+			done <- serveForwards(ctx, client, []*config.Forward{f}, map[*config.Forward]net.Listener{f: ln})
+		}()
+		return ln, done
+	}
+
+	// Answered keepalives keep the session up until it is cancelled, which
+	// closes the listeners
+	t.Run("cancelled", func(t *testing.T) {
+		client, err := connectTestServer(t, server)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		ln, done := serve(t, ctx, client)
+
+		time.Sleep(10 * cli.KeepAlive)
+		select {
+		case err := <-done:
+			t.Fatalf("session ended before it was cancelled: %v", err)
+		default:
+		}
+
+		cancel()
+		require.NoError(t, <-done)
+		_, err = ln.Accept()
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+
+	t.Run("connection lost", func(t *testing.T) {
+		client, err := connectTestServer(t, server)
+		require.NoError(t, err)
+		_, done := serve(t, context.Background(), client)
+
+		client.GetClient().Close()
+		select {
+		case err := <-done:
+			assert.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("session did not end when the connection was lost")
+		}
+	})
+}
+
+func TestReconnect(t *testing.T) {
+	delay, maxDelay := reconnectDelay, maxReconnectDelay
+	reconnectDelay, maxReconnectDelay = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() { reconnectDelay, maxReconnectDelay = delay, maxDelay })
+
+	server := clitest.NewEnv(t).StartSSHServer()
+
+	t.Run("retries until connected", func(t *testing.T) {
+		attempts := 0
+		client := reconnect(context.Background(), func(ctx context.Context) (*ssh.Client, error) {
+			if attempts++; attempts < 4 {
+				return nil, errors.New("host unreachable")
+			}
+			return connectTestServer(t, server)
+		})
+		require.NotNil(t, client)
+		assert.True(t, client.IsConnected())
+		assert.Equal(t, 4, attempts)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		attempts := 0
+		client := reconnect(ctx, func(ctx context.Context) (*ssh.Client, error) {
+			if attempts++; attempts == 2 {
+				cancel()
+			}
+			return nil, errors.New("host unreachable")
+		})
+		assert.Nil(t, client)
+		assert.Equal(t, 2, attempts)
+	})
+}
@@ -0,0 +1,74 @@
+// klip - Command history
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/history"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var clearHistory bool
+
+func historyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history <profile>",
+		Short: "Show commands run with klip exec on a profile",
+		Long: `Lists the commands run with 'klip exec' on a profile, numbered so they can
+be re-run with 'klip exec -p <profile> -- !N'. This is klip's own history,
+separate from the remote shell's history.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runHistory,
+	}
+
+	cmd.Flags().BoolVar(&clearHistory, "clear", false, "Delete the profile's history")
+
+	return cmd
+}
+
+func runHistory(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+
+	profile, err := cfg.GetProfile(args[0])
+	if err != nil {
+		ui.PrintError("Profile not found: %s", args[0])
+		os.Exit(1)
+	}
+
+	hist, err := history.Load(profile.Name)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	if clearHistory {
+		if err := hist.Clear(); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Cleared history of %s", profile.Name)
+		return
+	}
+
+	if len(hist.Entries) == 0 {
+		ui.PrintInfo("No commands recorded for %s", profile.Name)
+		return
+	}
+
+	pager := ui.StartPager(noPager)
+	defer pager.Close()
+
+	rows := make([][]string, 0, len(hist.Entries))
+	for i, entry := range hist.Entries {
+		rows = append(rows, []string{strconv.Itoa(i + 1), entry.Time.Format("2006-01-02 15:04"), entry.Command})
+	}
+	ui.PrintTable([]string{"#", "Time", "Command"}, rows)
+}
@@ -0,0 +1,528 @@
+// klip - Host key management
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	hostkeyMove    bool
+	hostkeyDomain  string
+	hostkeyFile    string
+	hostkeyReplace bool
+	hostkeyPort    int
+	hostkeyAdd     bool
+)
+
+func hostkeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hostkey",
+		Short: "Manage trusted host keys",
+	}
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate <trust-domain>",
+		Short: "Copy host keys of a trust domain's profiles into its known_hosts",
+		Long: `Copies the entries for the hosts of every profile in a trust domain from
+klip's shared known_hosts into the domain's own known_hosts file, so hosts
+trusted before the profile joined the domain are not asked about again.
+Hosts are matched by remote_host, jump hosts and the addresses they
+currently resolve to. With --move the entries are removed from the shared
+file, so other profiles no longer trust those keys.`,
+		Example: `  klip hostkey migrate work
+  klip hostkey migrate work --move`,
+		Args: cobra.ExactArgs(1),
+		Run:  runHostkeyMigrate,
+	}
+	migrateCmd.Flags().BoolVar(&hostkeyMove, "move", false, "Remove the entries from the shared known_hosts")
+	migrateCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+
+	exportCmd := &cobra.Command{
+		Use:   "export [host]...",
+		Short: "Write trusted host keys as a known_hosts bundle",
+		Long: `Writes the entries of klip's known_hosts, or a trust domain's with --domain,
+to stdout or a file, limited to the given hosts if any. The bundle can be
+reviewed, distributed to a team and loaded with 'klip hostkey import'.`,
+		Example: `  klip hostkey export > known_hosts.bundle
+  klip hostkey export --domain work --file work_known_hosts
+  klip hostkey export web.internal 10.0.0.5`,
+		Run: runHostkeyExport,
+	}
+	exportCmd.Flags().StringVar(&hostkeyDomain, "domain", "", "Export the known_hosts of this trust domain")
+	exportCmd.Flags().StringVarP(&hostkeyFile, "file", "f", "", "Write the bundle to this file instead of stdout")
+
+	importCmd := &cobra.Command{
+		Use:   "import <file|->",
+		Short: "Trust the host keys in a known_hosts bundle",
+		Long: `Adds the entries of a known_hosts bundle (e.g., exported with 'klip hostkey
+export' or generated by infrastructure tooling) to klip's known_hosts, or a
+trust domain's with --domain. Entries already present are skipped, and a
+bundle with an invalid line is rejected as a whole. --replace makes the
+bundle the complete list of trusted keys.
+
+Together with settings.strict_host_keys, hosts are then only trusted when
+their keys come from a bundle, never on first use.`,
+		Example: `  klip hostkey import known_hosts.bundle
+  klip hostkey import --domain work --replace work_known_hosts
+  generate-known-hosts | klip hostkey import -`,
+		Args: cobra.ExactArgs(1),
+		Run:  runHostkeyImport,
+	}
+	importCmd.Flags().StringVar(&hostkeyDomain, "domain", "", "Import into the known_hosts of this trust domain")
+	importCmd.Flags().BoolVar(&hostkeyReplace, "replace", false, "Replace every existing entry with the bundle's")
+
+	listCmd := &cobra.Command{
+		Use:   "list [host]...",
+		Short: "List trusted host keys with their fingerprints",
+		Long: `Lists the entries of klip's known_hosts, or a trust domain's with --domain,
+with the line they are on, the hosts they are for, the key type and its
+SHA256 fingerprint, limited to the given hosts if any. A host matches its
+entries on every port; hashed entries are only listed without hosts.`,
+		Example: `  klip hostkey list
+  klip hostkey list web.internal 10.0.0.5
+  klip hostkey list --domain work --output json`,
+		Run: runHostkeyList,
+	}
+	listCmd.Flags().StringVar(&hostkeyDomain, "domain", "", "List the known_hosts of this trust domain")
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <host>...",
+		Short: "Remove the trusted host keys of hosts",
+		Long: `Removes every entry for the given hosts from klip's known_hosts, or a trust
+domain's with --domain, whatever port it is for, e.g. after a host was
+reinstalled and its key changed. The next connection asks to trust the
+new key, or fails with settings.strict_host_keys.`,
+		Example: `  klip hostkey remove web.internal
+  klip hostkey remove --domain work 10.0.0.5 10.0.0.6 --yes`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  runHostkeyRemove,
+	}
+	removeCmd.Flags().StringVar(&hostkeyDomain, "domain", "", "Remove from the known_hosts of this trust domain")
+
+	scanCmd := &cobra.Command{
+		Use:   "scan <host|profile>",
+		Short: "Read a host's keys without logging in",
+		Long: `Reads the host keys an SSH server offers, one per key type like
+ssh-keyscan, and shows their fingerprints and whether known_hosts trusts
+them. For a profile, the host is reached through its backend, and its
+trust domain's known_hosts is checked; behind jump hosts only the key the
+host presents first is read. With --add, keys known_hosts has nothing for
+are trusted after confirmation, so the first connection doesn't ask.`,
+		Example: `  klip hostkey scan 10.0.0.5
+  klip hostkey scan web.internal --port 2222
+  klip hostkey scan myserver --add`,
+		Args: cobra.ExactArgs(1),
+		Run:  runHostkeyScan,
+	}
+	scanCmd.Flags().IntVarP(&hostkeyPort, "port", "p", 22, "SSH port of the host, ignored for profiles")
+	scanCmd.Flags().BoolVar(&hostkeyAdd, "add", false, "Trust the keys known_hosts has nothing for")
+	scanCmd.Flags().StringVar(&hostkeyDomain, "domain", "", "Check and add to the known_hosts of this trust domain")
+	scanCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	scanCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	scanCmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+
+	cmd.AddCommand(migrateCmd, exportCmd, importCmd, listCmd, removeCmd, scanCmd)
+	return cmd
+}
+
+// domainKnownHosts returns the known_hosts file selected by --domain
+func domainKnownHosts() string {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	knownHostsPath, err := cli.KnownHostsPath(cfg, hostkeyDomain)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	return knownHostsPath
+}
+
+func runHostkeyExport(cmd *cobra.Command, args []string) {
+	knownHostsPath := domainKnownHosts()
+
+	entries, err := ssh.ExportKnownHosts(knownHostsPath, args)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if len(entries) == 0 {
+		ui.PrintError("No host keys to export from %s", knownHostsPath)
+		os.Exit(1)
+	}
+
+	bundle := fmt.Sprintf("# klip host keys exported from %s on %s\n%s\n",
+		knownHostsPath, time.Now().Format("2006-01-02"), strings.Join(entries, "\n"))
+
+	if hostkeyFile == "" {
+		fmt.Print(bundle)
+		return
+	}
+	if err := os.WriteFile(hostkeyFile, []byte(bundle), 0644); err != nil {
+		ui.PrintError("Failed to write %s: %v", hostkeyFile, err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Exported %d entries to %s", len(entries), hostkeyFile)
+}
+
+func runHostkeyImport(cmd *cobra.Command, args []string) {
+	knownHostsPath := domainKnownHosts()
+
+	var bundle []byte
+	var err error
+	if args[0] == "-" {
+		bundle, err = io.ReadAll(os.Stdin)
+	} else {
+		bundle, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		ui.PrintError("Failed to read bundle: %v", err)
+		os.Exit(1)
+	}
+
+	if hostkeyReplace {
+		ok, err := ui.ConfirmDestructive(ui.Destructive, "Replace every host key trusted in %s with the bundle's?", knownHostsPath)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if !ok {
+			ui.PrintInfo("Cancelled")
+			return
+		}
+	}
+
+	added, err := ssh.ImportKnownHosts(knownHostsPath, bundle, hostkeyReplace)
+	if err != nil {
+		ui.PrintError("Failed to import %s: %v", args[0], err)
+		os.Exit(1)
+	}
+	switch {
+	case hostkeyReplace:
+		ui.PrintSuccess("%s now holds the bundle's %d entries", knownHostsPath, added)
+	case added == 0:
+		ui.PrintInfo("All entries are already in %s", knownHostsPath)
+	default:
+		ui.PrintSuccess("Imported %d new entries into %s", added, knownHostsPath)
+	}
+}
+
+func runHostkeyList(cmd *cobra.Command, args []string) {
+	knownHostsPath := domainKnownHosts()
+
+	entries, err := ssh.ListKnownHosts(knownHostsPath, args)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if entries == nil {
+		entries = []ssh.KnownHost{}
+	}
+
+	err = ui.Render(entries, func() {
+		if len(entries) == 0 {
+			ui.PrintInfo("No host keys in %s", knownHostsPath)
+			return
+		}
+
+		ui.PrintHeader(fmt.Sprintf(ui.T("Known Hosts in %s"), knownHostsPath))
+
+		headers := []string{"Line", "Hosts", "Type", "Fingerprint"}
+		var rows [][]string
+		for _, entry := range entries {
+			hosts := strings.Join(entry.Hosts, ",")
+			if strings.HasPrefix(hosts, "|") {
+				hosts = ui.T("(hashed)")
+			}
+			keyType := entry.Type
+			if entry.Marker != "" {
+				keyType = ui.Warning("@"+entry.Marker) + " " + keyType
+			}
+			rows = append(rows, []string{fmt.Sprint(entry.Line), hosts, keyType, entry.Fingerprint})
+		}
+		ui.PrintTable(headers, rows)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+func runHostkeyRemove(cmd *cobra.Command, args []string) {
+	knownHostsPath := domainKnownHosts()
+
+	entries, err := ssh.ListKnownHosts(knownHostsPath, args)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if len(entries) == 0 {
+		ui.PrintInfo("No entries for %s in %s", strings.Join(args, ", "), knownHostsPath)
+		return
+	}
+
+	ok, err := ui.ConfirmDestructive(ui.Destructive, "Remove %d entries for %s from %s?", len(entries), strings.Join(args, ", "), knownHostsPath)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if !ok {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+
+	removed := 0
+	for _, host := range args {
+		n, err := ssh.RemoveKnownHost(knownHostsPath, host)
+		removed += n
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+	}
+	ui.PrintSuccess("Removed %d entries from %s", removed, knownHostsPath)
+}
+
+// scannedKey is a host key read by 'klip hostkey scan'
+type scannedKey struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+
+	// Status is "trusted" if known_hosts has the key, "changed" if it has
+	// a different key of the same type, or "new"
+	Status string `json:"status"`
+
+	key gossh.PublicKey
+}
+
+func runHostkeyScan(cmd *cobra.Command, args []string) {
+	target := args[0]
+	host, port := target, hostkeyPort
+
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var keys []gossh.PublicKey
+	knownHostsPath := ""
+	if _, isProfile := cfg.Profiles[target]; isProfile {
+		helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+			ProfileName: target,
+			BackendName: backendName,
+			Timeout:     timeout,
+			Verbose:     verbose,
+			NoMux:       true,
+		})
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if len(helper.Profile.JumpChain()) > 0 {
+			key, err := helper.ScanHostKey(ctx, timeout)
+			if err != nil {
+				ui.PrintError("Failed to read the host key of %s: %v", helper.Profile.RemoteHost, err)
+				os.Exit(1)
+			}
+			keys = []gossh.PublicKey{key}
+		} else if keys, err = helper.ScanHostKeys(ctx); err != nil {
+			ui.PrintError("Failed to read the host keys of %s: %v", helper.Profile.RemoteHost, err)
+			os.Exit(1)
+		}
+		host, port = helper.ResolvedHost, helper.Profile.SSHPort
+		knownHostsPath = helper.KnownHostsPath
+	}
+	if hostkeyDomain != "" {
+		if knownHostsPath, err = cli.KnownHostsPath(cfg, hostkeyDomain); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+	}
+
+	if keys == nil {
+		if keys, err = ssh.ScanHostKeys(ctx, host, port); err != nil {
+			ui.PrintError("Failed to read the host keys of %s: %v", host, err)
+			os.Exit(1)
+		}
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	knownTypes, err := ssh.KnownHostKeyTypes(knownHostsPath, host, port)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	result := make([]scannedKey, 0, len(keys))
+	var added []gossh.PublicKey
+	for _, key := range keys {
+		entry := scannedKey{Type: key.Type(), Fingerprint: gossh.FingerprintSHA256(key), Status: "new", key: key}
+		if ssh.VerifyHostKey(knownHostsPath, address, key) == nil {
+			entry.Status = "trusted"
+		} else {
+			for _, known := range knownTypes {
+				if known == key.Type() {
+					entry.Status = "changed"
+				}
+			}
+		}
+		if entry.Status == "new" {
+			added = append(added, key)
+		}
+		result = append(result, entry)
+	}
+
+	err = ui.Render(result, func() {
+		ui.PrintHeader(fmt.Sprintf(ui.T("Host Keys of %s"), address))
+
+		headers := []string{"Type", "Fingerprint", "Status"}
+		var rows [][]string
+		for _, entry := range result {
+			status := ui.T(entry.Status)
+			switch entry.Status {
+			case "trusted":
+				status = ui.Success(status)
+			case "changed":
+				status = ui.Error(status)
+			}
+			rows = append(rows, []string{entry.Type, entry.Fingerprint, status})
+		}
+		ui.PrintTable(headers, rows)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	for _, entry := range result {
+		if entry.Status == "changed" {
+			ui.PrintWarning("known_hosts records a different %s key for %s; if the host was reinstalled, run 'klip hostkey remove %s' before trusting the new one", entry.Type, address, host)
+			break
+		}
+	}
+	if !hostkeyAdd {
+		return
+	}
+	if len(added) == 0 {
+		ui.PrintInfo("No new keys to trust")
+		return
+	}
+
+	ok, err := ui.ConfirmDestructive(ui.Destructive, "Trust %d new keys for %s? Compare the fingerprints with the ones the host's administrator gives you first", len(added), address)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if !ok {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+	for _, key := range added {
+		if err := ssh.AddKnownHost(knownHostsPath, address, key); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+	}
+	ui.PrintSuccess("Trusted %d keys for %s", len(added), address)
+}
+
+func runHostkeyMigrate(cmd *cobra.Command, args []string) {
+	domain := args[0]
+
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	if _, ok := cfg.Settings.TrustDomains[domain]; !ok {
+		ui.PrintError("Trust domain '%s' is not defined in settings.trust_domains", domain)
+		os.Exit(1)
+	}
+	profiles := cfg.ProfilesInTrustDomain(domain)
+	if len(profiles) == 0 {
+		ui.PrintWarning("No profiles use trust domain '%s'", domain)
+		return
+	}
+
+	knownHostsPath, _, err := cli.TrustDomain(cfg, cfg.Profiles[profiles[0]])
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	sharedPath, err := ssh.GetKnownHostsPath("")
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	var hosts []string
+	for _, name := range profiles {
+		hosts = append(hosts, profileHosts(cfg.Profiles[name], name)...)
+	}
+
+	migrated, err := ssh.MigrateKnownHosts(sharedPath, knownHostsPath, hosts, hostkeyMove)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if migrated == 0 {
+		ui.PrintInfo("No new entries for the hosts of %d profiles in %s", len(profiles), sharedPath)
+		return
+	}
+	if hostkeyMove {
+		ui.PrintSuccess("Moved %d entries to %s", migrated, knownHostsPath)
+	} else {
+		ui.PrintSuccess("Copied %d entries to %s", migrated, knownHostsPath)
+	}
+}
+
+// profileHosts returns the host names and addresses a profile's host keys
+// may be recorded under: its hostnames and jump hosts, and the addresses
+// they currently resolve to
+func profileHosts(profile *config.Profile, name string) []string {
+	hosts := profile.HostNames()
+	for _, hop := range profile.JumpChain() {
+		hosts = append(hosts, hop.Host)
+	}
+
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: name,
+		Verbose:     verbose,
+		NoMux:       true,
+	})
+	if err != nil {
+		return hosts
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if resolved, err := helper.GetResolvedHost(ctx); err == nil {
+		hosts = append(hosts, resolved)
+	}
+	if len(profile.JumpChain()) > 0 {
+		if jumps, err := cli.ResolveJumpChain(ctx, helper.Backend, helper.Profile); err == nil {
+			hosts = append(hosts, jumps...)
+		}
+	}
+	return hosts
+}
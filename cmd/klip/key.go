@@ -0,0 +1,530 @@
+// klip - SSH key management
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	keyType    string
+	keyPath    string
+	keyKeepOld bool
+	keySole    bool
+)
+
+func keyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "key",
+		Short: "Manage the SSH keys profiles log in with",
+	}
+
+	rotateCmd := &cobra.Command{
+		Use:   "rotate <profile>",
+		Short: "Replace a profile's SSH key with a newly generated one",
+		Long: `Generates a new key, adds it to the remote authorized_keys next to the
+current one, checks that it logs in, removes the old key from
+authorized_keys and points the profile's ssh_key_path at the new key.
+
+With --sole every other key is removed from authorized_keys as well, once
+the new key has logged in. If logging in with the new key fails it is
+removed again and the profile is left unchanged. The old private key is
+kept locally, since other profiles may still use it. Jump hosts that share
+the profile's key must be given a key of their own first, as the new key is
+only deployed to the remote host.`,
+		Example: `  klip key rotate web
+  klip key rotate web --type rsa --key ~/.ssh/web_rsa
+  klip key rotate web --keep-old
+  klip key rotate web --sole`,
+		Args: cobra.ExactArgs(1),
+		Run:  runKeyRotate,
+	}
+	rotateCmd.Flags().StringVar(&keyType, "type", string(ssh.DefaultKeyType), "Key type: ed25519 or rsa")
+	rotateCmd.Flags().StringVar(&keyPath, "key", "", "Path for the new private key (default: klip_<profile>_<type>_<date> next to the old key)")
+	rotateCmd.Flags().BoolVar(&keyKeepOld, "keep-old", false, "Leave the old key in authorized_keys")
+	rotateCmd.Flags().BoolVar(&keySole, "sole", false, "Leave the new key as the only key in authorized_keys")
+	rotateCmd.MarkFlagsMutuallyExclusive("keep-old", "sole")
+
+	deployCmd := &cobra.Command{
+		Use:   "deploy <profile> [public-key]",
+		Short: "Add a public key to the remote authorized_keys",
+		Long: `Adds a public key to the remote user's authorized_keys over SFTP, creating
+~/.ssh and the file with the right permissions if needed. The key defaults
+to the public half of the profile's ssh_key_path, so a profile that logs in
+with a password can be given its key before switching over.
+
+A key that is already authorized is reported as already deployed and is
+not added again. With --sole every other key is removed from
+authorized_keys, after asking, and the previous file is kept as
+~/.ssh/authorized_keys.klip-bak.<time> on the remote host.`,
+		Example: `  klip key deploy web
+  klip key deploy web ~/.ssh/id_ed25519.pub
+  klip key deploy web --sole`,
+		Args: cobra.RangeArgs(1, 2),
+		Run:  runKeyDeploy,
+	}
+	deployCmd.Flags().BoolVar(&keySole, "sole", false, "Leave the key as the only key in authorized_keys")
+
+	listRemoteCmd := &cobra.Command{
+		Use:   "list-remote <profile>",
+		Short: "List the keys in the remote authorized_keys",
+		Long: `Lists the keys in the remote user's authorized_keys with their
+fingerprints and comments, marking the key the profile logs in with and
+keys that appear more than once.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runKeyListRemote,
+	}
+
+	revokeRemoteCmd := &cobra.Command{
+		Use:   "revoke-remote <profile> <fingerprint>",
+		Short: "Remove a key from the remote authorized_keys",
+		Long: `Removes every entry for the key with the given SHA256 fingerprint (as shown
+by 'klip key list-remote', the "SHA256:" prefix is optional) from the remote
+user's authorized_keys. The previous file is kept as
+~/.ssh/authorized_keys.klip-bak.<time> on the remote host.
+
+Revoking the key the profile logs in with asks for confirmation first.`,
+		Example: `  klip key revoke-remote web SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s`,
+		Args:    cobra.ExactArgs(2),
+		Run:     runKeyRevokeRemote,
+	}
+
+	for _, c := range []*cobra.Command{rotateCmd, deployCmd, listRemoteCmd, revokeRemoteCmd} {
+		c.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+		c.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+		c.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+		cmd.AddCommand(c)
+	}
+	return cmd
+}
+
+func runKeyRotate(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	kind := ssh.KeyType(keyType)
+	if kind != ssh.KeyTypeED25519 && kind != ssh.KeyTypeRSA {
+		ui.PrintError("Invalid --type: %s (must be ed25519 or rsa)", keyType)
+		os.Exit(1)
+	}
+
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: name,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpKey,
+		NoMux:       true,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		os.Exit(1)
+	}
+	profile := helper.Profile
+	if profile.UsePassword || profile.PKCS11Provider != "" {
+		ui.PrintError("Profile '%s' does not log in with a key file", name)
+		os.Exit(1)
+	}
+	for i, hop := range profile.JumpChain() {
+		if hop.Key == "" {
+			ui.PrintError("Jump host %d (%s) uses the profile's key; give it a key of its own before rotating", i+1, hop.Host)
+			os.Exit(1)
+		}
+	}
+
+	var oldKey []byte
+	if profile.SSHKeyPath != "" {
+		if oldKey, err = ssh.ReadAuthorizedKey(profile.SSHKeyPath); err != nil {
+			ui.PrintError("Failed to read the current key: %v", err)
+			os.Exit(1)
+		}
+	} else if !keyKeepOld && !keySole {
+		ui.PrintWarning("Profile has no ssh_key_path, so the key it logs in with now is not removed from authorized_keys")
+	}
+
+	newPath, err := rotatedKeyPath(profile, helper.KeyDir, kind)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	total := 4
+	if keySole || (oldKey != nil && !keyKeepOld) {
+		total++
+	}
+	steps := ui.NewStepRunner(total)
+	ctx := context.Background()
+
+	var publicKey []byte
+	err = steps.Run(fmt.Sprintf("Generating %s key %s", kind, newPath), func() error {
+		privateKey, pub, err := ssh.GenerateKeyPair(kind, 0)
+		if err != nil {
+			return err
+		}
+		// Name the key in authorized_keys so it can be told apart later
+		publicKey = append(bytes.TrimRight(pub, "\n"), fmt.Sprintf(" klip:%s %s\n", name, time.Now().Format("2006-01-02"))...)
+		return ssh.SaveKeyPair(newPath, newPath+".pub", privateKey, publicKey)
+	})
+	if err != nil {
+		ui.PrintError("Failed to generate key: %v", err)
+		os.Exit(1)
+	}
+
+	var oldClient *ssh.Client
+	err = steps.RunInteractive("Connecting with the current key", func() error {
+		oldClient, err = helper.CreateSSHClient(ctx, timeout)
+		return err
+	})
+	if err != nil {
+		discardKey(newPath)
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer oldClient.Close()
+
+	if err := steps.Run("Adding the new key to authorized_keys", func() error {
+		return ssh.AuthorizeKey(oldClient, publicKey, ssh.AuthorizeAppend)
+	}); err != nil {
+		discardKey(newPath)
+		ui.PrintError("Failed to deploy key: %v", err)
+		os.Exit(1)
+	}
+
+	// Log in again offering only the new key
+	rotated := profile.Clone()
+	rotated.SSHKeyPath = newPath
+	helper.Profile = rotated
+	var newClient *ssh.Client
+	err = steps.Run("Verifying login with the new key", func() error {
+		newClient, err = helper.CreateSSHClient(ctx, timeout)
+		return err
+	})
+	if err != nil {
+		if _, revokeErr := ssh.RevokeKey(oldClient, publicKey); revokeErr != nil {
+			ui.PrintWarning("Failed to remove the new key from authorized_keys: %v", revokeErr)
+		}
+		discardKey(newPath)
+		ui.PrintError("Login with the new key failed, profile left unchanged: %v", err)
+		os.Exit(1)
+	}
+	defer newClient.Close()
+
+	switch {
+	case keySole:
+		err = steps.Run("Removing every other key from authorized_keys", func() error {
+			return ssh.AuthorizeKey(newClient, publicKey, ssh.AuthorizeSole)
+		})
+		if err != nil && !errors.Is(err, ssh.ErrKeyAlreadyAuthorized) {
+			ui.PrintWarning("Failed to remove the other keys from authorized_keys, remove them by hand: %v", err)
+		}
+	case oldKey != nil && !keyKeepOld:
+		var removed int
+		err = steps.Run("Removing the old key from authorized_keys", func() error {
+			removed, err = ssh.RevokeKey(newClient, oldKey)
+			return err
+		})
+		if err != nil {
+			ui.PrintWarning("Failed to remove the old key from authorized_keys, remove it by hand: %v", err)
+		} else if removed == 0 {
+			ui.PrintWarning("The old key was not in authorized_keys")
+		}
+	}
+
+	cfg := helper.Config
+	oldPath := cfg.Profiles[name].SSHKeyPath
+	if err := steps.Run("Updating profile", func() error {
+		cfg.Profiles[name].SSHKeyPath = newPath
+		return cfg.Save()
+	}); err != nil {
+		ui.PrintError("Failed to save configuration, set ssh_key_path to %s by hand: %v", newPath, err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("Profile '%s' now logs in with %s", name, newPath)
+	if oldPath != "" {
+		if others := profilesUsingKey(cfg, oldPath); len(others) > 0 {
+			ui.PrintWarning("The old key is still used by: %s", strings.Join(others, ", "))
+		}
+	}
+}
+
+// rotatedKeyPath returns where the new key for profile is written: --key,
+// or a name with the profile, type and date next to its current key, in the
+// trust domain's key directory, or in ~/.ssh
+func rotatedKeyPath(profile *config.Profile, keyDir string, kind ssh.KeyType) (string, error) {
+	path := keyPath
+	if path == "" {
+		dir := keyDir
+		if profile.SSHKeyPath != "" {
+			dir = filepath.Dir(profile.SSHKeyPath)
+		}
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to find home directory: %w", err)
+			}
+			dir = filepath.Join(home, ".ssh")
+		}
+		path = filepath.Join(dir, fmt.Sprintf("klip_%s_%s_%s", profile.Name, kind, time.Now().Format("20060102")))
+	}
+
+	if ssh.KeyExists(path) || ssh.KeyExists(path+".pub") {
+		return "", fmt.Errorf("%s already exists (choose another path with --key)", path)
+	}
+	return path, nil
+}
+
+// discardKey removes a generated key pair that was not put to use
+func discardKey(path string) {
+	os.Remove(path)
+	os.Remove(path + ".pub")
+}
+
+// profilesUsingKey returns the profiles with ssh_key_path set to path
+func profilesUsingKey(cfg *config.Config, path string) []string {
+	var names []string
+	for _, name := range cfg.ListProfiles() {
+		if cfg.Profiles[name].SSHKeyPath == path {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func runKeyDeploy(cmd *cobra.Command, args []string) {
+	name := args[0]
+	helper, client := connectKeyProfile(name, config.OpKey)
+	defer client.Close()
+
+	var publicKey []byte
+	var err error
+	switch {
+	case len(args) > 1:
+		publicKey, err = os.ReadFile(args[1])
+	case helper.Profile.SSHKeyPath != "":
+		publicKey, err = ssh.ReadAuthorizedKey(helper.Profile.SSHKeyPath)
+	default:
+		err = fmt.Errorf("profile '%s' has no ssh_key_path; give the public key file to deploy", name)
+	}
+	if err != nil {
+		ui.PrintError("Failed to read the public key: %v", err)
+		os.Exit(1)
+	}
+	key, _, _, _, err := gossh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		ui.PrintError("Invalid public key: %v", err)
+		os.Exit(1)
+	}
+	fingerprint := gossh.FingerprintSHA256(key)
+
+	if keySole {
+		ok, err := ui.ConfirmDestructive(ui.Destructive, "Remove every key but %s from authorized_keys of profile '%s'?", fingerprint, name)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if !ok {
+			ui.PrintInfo("Cancelled")
+			return
+		}
+	}
+
+	mode := ssh.AuthorizeAppend
+	if keySole {
+		mode = ssh.AuthorizeSole
+	}
+	err = ssh.AuthorizeKey(client, publicKey, mode)
+
+	status := "success"
+	switch {
+	case errors.Is(err, ssh.ErrKeyAlreadyAuthorized):
+		status = "already_deployed"
+	case err != nil:
+		status = "failed"
+	}
+	if auditLogger, auditErr := logger.NewAuditLogger(true); auditErr == nil {
+		backendUsed := ""
+		if helper.Backend != nil {
+			backendUsed = helper.Backend.Name()
+		}
+		_ = auditLogger.LogSSHKeyDeployment(name, helper.Profile.RemoteUser, helper.Profile.RemoteHost, backendUsed, status, err)
+		auditLogger.Close()
+	}
+
+	switch {
+	case errors.Is(err, ssh.ErrKeyAlreadyAuthorized):
+		ui.PrintInfo("%s is already deployed to profile '%s'", fingerprint, name)
+	case err != nil:
+		ui.PrintError("Failed to deploy key: %v", err)
+		os.Exit(1)
+	case keySole:
+		ui.PrintSuccess("%s is now the only key in authorized_keys of profile '%s'", fingerprint, name)
+	default:
+		ui.PrintSuccess("Deployed %s to profile '%s'", fingerprint, name)
+	}
+}
+
+// connectKeyProfile connects to the named profile's host for reading or,
+// as operation config.OpKey, editing its authorized_keys
+func connectKeyProfile(name, operation string) (*cli.ConnectionHelper, *ssh.Client) {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: name,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   operation,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		os.Exit(1)
+	}
+
+	client, err := helper.CreateSSHClient(context.Background(), timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	return helper, client
+}
+
+// loginKeyFingerprint returns the fingerprint of the key client logged in
+// with, which may be a default key or a hardware key rather than profile's
+// key file, falling back to the latter if no key signed
+func loginKeyFingerprint(client *ssh.Client, profile *config.Profile) string {
+	if fingerprint := client.ConnectionInfo().AuthKeyFingerprint(); fingerprint != "" {
+		return fingerprint
+	}
+	return profileKeyFingerprint(profile)
+}
+
+// profileKeyFingerprint returns the fingerprint of the key profile logs in
+// with, or "" if it has no key file
+func profileKeyFingerprint(profile *config.Profile) string {
+	if profile.SSHKeyPath == "" {
+		return ""
+	}
+	fingerprint, err := ssh.GetPublicKeyFingerprint(profile.SSHKeyPath)
+	if err != nil {
+		return ""
+	}
+	return fingerprint
+}
+
+func runKeyListRemote(cmd *cobra.Command, args []string) {
+	helper, client := connectKeyProfile(args[0], config.OpRead)
+	defer client.Close()
+
+	keys, err := ssh.ListAuthorizedKeys(client)
+	if err != nil {
+		ui.PrintError("Failed to read authorized_keys: %v", err)
+		os.Exit(1)
+	}
+
+	type remoteKey struct {
+		ssh.AuthorizedKey
+		Current bool `json:"current"`
+	}
+	current := loginKeyFingerprint(client, helper.Profile)
+	entries := make([]remoteKey, 0, len(keys))
+	duplicates := 0
+	for _, key := range keys {
+		entries = append(entries, remoteKey{AuthorizedKey: key, Current: key.Fingerprint == current})
+		if key.Duplicate {
+			duplicates++
+		}
+	}
+
+	err = ui.Render(entries, func() {
+		if len(entries) == 0 {
+			ui.PrintInfo("No keys in authorized_keys")
+			return
+		}
+
+		ui.PrintHeader(fmt.Sprintf(ui.T("Authorized Keys on %s@%s"), helper.Profile.RemoteUser, helper.Profile.RemoteHost))
+
+		headers := []string{"Line", "", "Type", "Fingerprint", "Comment"}
+		var rows [][]string
+		for _, entry := range entries {
+			marker := " "
+			if entry.Current {
+				marker = ui.Highlight("●")
+			}
+			comment := entry.Comment
+			if entry.Duplicate {
+				comment = ui.Warning(ui.T("duplicate")) + " " + comment
+			}
+			rows = append(rows, []string{
+				fmt.Sprint(entry.Line),
+				marker,
+				entry.Type,
+				entry.Fingerprint,
+				comment,
+			})
+		}
+		ui.PrintTable(headers, rows)
+
+		if duplicates > 0 {
+			ui.PrintWarning("%d duplicate entries; 'klip key revoke-remote' removes every entry for a key", duplicates)
+		}
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+func runKeyRevokeRemote(cmd *cobra.Command, args []string) {
+	fingerprint := ssh.NormalizeFingerprint(args[1])
+
+	helper, client := connectKeyProfile(args[0], config.OpKey)
+	defer client.Close()
+
+	keys, err := ssh.ListAuthorizedKeys(client)
+	if err != nil {
+		ui.PrintError("Failed to read authorized_keys: %v", err)
+		os.Exit(1)
+	}
+	found := false
+	for _, key := range keys {
+		found = found || key.Fingerprint == fingerprint
+	}
+	if !found {
+		ui.PrintError("No key with fingerprint %s in authorized_keys", fingerprint)
+		os.Exit(1)
+	}
+
+	if fingerprint == loginKeyFingerprint(client, helper.Profile) {
+		ok, err := ui.ConfirmDestructive(ui.Destructive, "%s is the key profile '%s' logs in with; revoke it anyway?", fingerprint, helper.Profile.Name)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if !ok {
+			ui.PrintInfo("Cancelled")
+			return
+		}
+	}
+
+	removed, backup, err := ssh.RevokeFingerprint(client, fingerprint)
+	if err != nil {
+		ui.PrintError("Failed to update authorized_keys: %v", err)
+		os.Exit(1)
+	}
+
+	ui.PrintSuccess("Removed %d entries for %s", removed, fingerprint)
+	ui.PrintInfo("Previous authorized_keys saved as ~/%s", backup)
+}
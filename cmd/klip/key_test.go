@@ -0,0 +1,35 @@
+// klip - Tests of SSH key management
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"testing"
+
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginKeyFingerprint(t *testing.T) {
+	server := clitest.NewEnv(t).StartSSHServer()
+	want, err := ssh.GetPublicKeyFingerprint(server.KeyPath)
+	require.NoError(t, err)
+
+	// The key the connection signed with counts, whatever the profile's
+	// key file, e.g. a default key when it has none
+	client, err := connectTestServer(t, server)
+	require.NoError(t, err)
+	profile := config.NewProfile("web", "test", server.Host)
+	assert.Equal(t, want, loginKeyFingerprint(client, profile))
+	profile.SSHKeyPath = "/nonexistent/id_ed25519"
+	assert.Equal(t, want, loginKeyFingerprint(client, profile))
+
+	// Without a connection only the profile's key file is known
+	unconnected, err := ssh.NewClient(&ssh.Config{Host: server.Host, Port: server.Port, User: "test"})
+	require.NoError(t, err)
+	assert.Empty(t, loginKeyFingerprint(unconnected, profile))
+	profile.SSHKeyPath = server.KeyPath
+	assert.Equal(t, want, loginKeyFingerprint(unconnected, profile))
+}
@@ -6,9 +6,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/cli"
 	"github.com/orpheus497/klip/internal/config"
 	"github.com/orpheus497/klip/internal/ssh"
 	"github.com/orpheus497/klip/internal/ui"
@@ -22,9 +26,25 @@ var (
 	verbose         bool
 	timeout         int
 	showVersionFlag bool
+	noPager         bool
+	copyTarget      string
+	planOnly        bool
+	explainProfile  string
 )
 
+// newRegistry returns the VPN backends; tests replace it with fixtures
+var newRegistry = backend.NewRegistry
+
 func main() {
+	cli.InitUI()
+
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the klip command with all its subcommands
+func newRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "klip [profile]",
 		Short: "Connect to remote machines via SSH over VPN networks",
@@ -36,21 +56,55 @@ Created by orpheus497.`,
 	}
 
 	rootCmd.Flags().StringVarP(&profileName, "profile", "p", "", "Connection profile to use")
-	rootCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird)")
+	rootCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
 	rootCmd.Flags().BoolVar(&showVersionFlag, "version", false, "Show version information")
+	rootCmd.Flags().BoolVar(&planOnly, "plan", false, "Show what connecting would do without connecting")
+	cli.AddWaitFlags(rootCmd)
+	cli.AddKeepAliveFlags(rootCmd)
+	cli.AddReconnectFlag(rootCmd)
+	rootCmd.PersistentFlags().BoolVar(&noPager, "no-pager", false, "Do not pipe long output into a pager")
+	cli.AddConfirmFlags(rootCmd)
+	cli.AddPassphraseFlags(rootCmd)
+	cli.AddOutputFlags(rootCmd)
+	cli.AddTraceFlags(rootCmd)
+	cli.AddConfigStoreFlags(rootCmd)
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		ui.SetConfirmPolicy(cli.ConfirmPolicy())
+		if err := cli.ApplyOutputFormat(); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+	}
 
 	// Subcommands
+	rootCmd.AddCommand(connectCmd())
 	rootCmd.AddCommand(profileCmd())
 	rootCmd.AddCommand(statusCmd())
 	rootCmd.AddCommand(versionCmd())
 	rootCmd.AddCommand(healthCmd())
 	rootCmd.AddCommand(initCmd())
-
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	rootCmd.AddCommand(execCmd())
+	rootCmd.AddCommand(rebootCmd())
+	rootCmd.AddCommand(checksumCmd())
+	rootCmd.AddCommand(catCmd())
+	rootCmd.AddCommand(diffFileCmd())
+	rootCmd.AddCommand(editCmd())
+	rootCmd.AddCommand(syncCmd())
+	rootCmd.AddCommand(forwardCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(muxCmd())
+	rootCmd.AddCommand(hostkeyCmd())
+	rootCmd.AddCommand(keyCmd())
+	rootCmd.AddCommand(cacheCmd())
+	rootCmd.AddCommand(teamCmd())
+	rootCmd.AddCommand(auditCmd())
+	rootCmd.AddCommand(doctorCmd())
+
+	cli.RegisterCompletions(rootCmd)
+
+	return rootCmd
 }
 
 func runConnect(cmd *cobra.Command, args []string) {
@@ -60,6 +114,15 @@ func runConnect(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if len(args) > 0 {
+		profileName = args[0]
+	}
+
+	if planOnly {
+		runPlan()
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -72,27 +135,31 @@ func runConnect(cmd *cobra.Command, args []string) {
 	var profile *config.Profile
 	var selectedProfileName string
 
-	if len(args) > 0 {
-		profileName = args[0]
-	}
-
 	if profileName != "" {
-		profile, err = cfg.GetProfile(profileName)
-		if err != nil {
-			ui.PrintError("Profile not found: %s", profileName)
-			os.Exit(1)
-		}
 		selectedProfileName = profileName
 	} else {
 		// Interactive selection
 		selector := ui.NewProfileSelector(cfg)
-		profile, selectedProfileName, err = selector.SelectProfile()
+		_, selectedProfileName, err = selector.SelectProfile()
 		if err != nil {
 			ui.PrintError("Failed to select profile: %v", err)
 			os.Exit(1)
 		}
 	}
 
+	// Apply global settings and defaults
+	profile, _, err = cfg.ResolveProfile(selectedProfileName)
+	if err != nil {
+		ui.PrintError("Profile not found: %s", selectedProfileName)
+		os.Exit(1)
+	}
+
+	// Apply the overrides for the network location
+	profile, locationSteps := cli.ApplyLocation(cfg, profile)
+	if verbose {
+		cli.PrintLocationSteps(locationSteps)
+	}
+
 	// Override backend if specified
 	if backendName != "" {
 		profile = profile.Clone()
@@ -105,16 +172,44 @@ func runConnect(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if err := cli.Authorize(cfg, profile, config.OpConnect); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	knownHostsPath, keyDir, err := cli.TrustDomain(cfg, profile)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	// Reuse a connection held open by klip mux
+	if !cli.Wait {
+		if client, info := cli.DialMux(profile.Name, backendName); client != nil {
+			ui.PrintSuccess("Connected to %s@%s through klip mux", profile.RemoteUser, info.ResolvedHost)
+			interactiveSession(profile, info.ResolvedHost, client, func(ctx context.Context) (*ssh.Client, error) {
+				client, _, err := ssh.DialMux(ctx, ssh.MuxSocketPath(profile.Name))
+				return client, err
+			})
+			return
+		}
+	}
+
 	ui.PrintInfo("Connecting to: %s (%s)", selectedProfileName, profile.Backend)
 
 	// Select backend
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	registry := backend.NewRegistry()
-	detector := backend.NewDetector(registry)
+	registry := newRegistry()
+	detector := backend.NewDetector(registry).Restrict(profile.BackendPermitted)
+	steps := ui.NewStepRunner(3)
 
-	selectedBackend, err := detector.SelectBackend(ctx, string(profile.Backend))
+	var selectedBackend backend.Backend
+	err = steps.Run("Detecting backend", func() error {
+		selectedBackend, err = detector.SelectBackend(ctx, string(profile.Backend))
+		return err
+	})
 	if err != nil {
 		ui.PrintError("Failed to select backend: %v", err)
 		os.Exit(1)
@@ -124,61 +219,311 @@ func runConnect(cmd *cobra.Command, args []string) {
 		ui.PrintInfo("Using backend: %s", selectedBackend.Name())
 	}
 
-	// Resolve host
-	resolvedHost := profile.RemoteHost
+	// Resolve host; behind jump hosts only the first hop is resolved
+	// through the backend, and the last one reaches the remote host by name
+	firstHost, firstPort := profile.FirstHop()
+	resolvedHost := firstHost
+	hosts := []string{profile.RemoteHost}
 
-	if selectedBackend.Name() != "lan" {
-		if verbose {
-			ui.PrintInfo("Resolving host via %s...", selectedBackend.Name())
+	// resolve returns the address to dial a host at directly
+	resolve := func(ctx context.Context, host string) (string, error) {
+		if selectedBackend.Name() == "lan" {
+			return host, nil
 		}
+		return detector.ResolveHost(ctx, selectedBackend, host)
+	}
 
-		ip, err := detector.ResolveHost(ctx, selectedBackend, profile.RemoteHost)
+	if cli.Wait {
+		// Poll until the host answers; this replaces the resolution step
+		err = steps.Run("Waiting for host", func() error {
+			resolvedHost, err = cli.WaitForHost(context.Background(), selectedBackend, firstHost, firstPort, cli.WaitFor)
+			return err
+		})
 		if err != nil {
-			ui.PrintWarning("Failed to resolve via %s, using hostname: %v", selectedBackend.Name(), err)
-		} else {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+
+		// The connect timeout starts once the host is up
+		var connectCancel context.CancelFunc
+		ctx, connectCancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+		defer connectCancel()
+	} else {
+		err = steps.Run("Resolving host", func() error {
+			// Alternate hostnames are tried in order, or raced on the LAN
+			hosts = cli.HostOrder(ctx, selectedBackend, profile)
+			if len(profile.JumpChain()) == 0 {
+				firstHost, resolvedHost = hosts[0], hosts[0]
+			}
+
+			ip, err := resolve(ctx, firstHost)
+			if err != nil {
+				return err
+			}
 			resolvedHost = ip
-			if verbose {
-				ui.PrintInfo("Resolved to: %s", resolvedHost)
+			return nil
+		})
+		if err != nil && !profile.BackendPermitted("lan") {
+			// Dialing the hostname would reach it over the LAN the profile denies
+			ui.PrintError("Failed to resolve via %s: %v", selectedBackend.Name(), err)
+			if hint := cli.LivenessHint(selectedBackend, profile); hint != "" {
+				ui.PrintInfo("%s", hint)
+			}
+			os.Exit(1)
+		}
+		if err != nil {
+			ui.PrintWarning("Failed to resolve via %s, using hostname: %v", selectedBackend.Name(), err)
+			if hint := cli.LivenessHint(selectedBackend, profile); hint != "" {
+				ui.PrintInfo("%s", hint)
 			}
 		}
 	}
 
-	// Create SSH client
-	sshConfig := &ssh.Config{
-		Host:        resolvedHost,
-		Port:        profile.SSHPort,
-		User:        profile.RemoteUser,
-		KeyPath:     profile.SSHKeyPath,
-		UsePassword: profile.UsePassword,
-		Timeout:     time.Duration(timeout) * time.Second,
+	if verbose && resolvedHost != firstHost {
+		ui.PrintInfo("Resolved to: %s", resolvedHost)
 	}
 
-	client, err := ssh.NewClient(sshConfig)
-	if err != nil {
-		ui.PrintError("Failed to create SSH client: %v", err)
-		os.Exit(1)
+	var jumpAddrs []string
+	if len(profile.JumpChain()) > 0 {
+		jumpAddrs, err = cli.ResolveJumpChain(ctx, selectedBackend, profile)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		// The first hop may already have been resolved, or waited for, above
+		jumpAddrs[0] = resolvedHost
+		if verbose {
+			ui.PrintInfo("Jumping through: %s", profile.JumpSpec())
+		}
 	}
 
-	if verbose {
-		ui.PrintInfo("Connecting via SSH...")
+	// Create an SSH client for each hostname tried
+	var sshConfig *ssh.Config
+	dialHost := func(ctx context.Context, host string) (*ssh.Client, error) {
+		if len(jumpAddrs) > 0 {
+			resolvedHost = host
+		} else if host != hosts[0] {
+			ip, err := resolve(ctx, host)
+			if err != nil && !profile.BackendPermitted("lan") {
+				return nil, fmt.Errorf("failed to resolve %s via %s: %w", host, selectedBackend.Name(), err)
+			}
+			if err != nil {
+				ui.PrintWarning("Failed to resolve %s via %s, using hostname: %v", host, selectedBackend.Name(), err)
+				ip = host
+			}
+			resolvedHost = ip
+		}
+		address, err := cli.CheckEncryptedPath(ctx, selectedBackend, profile, host)
+		if err != nil {
+			return nil, err
+		}
+		if address != "" {
+			resolvedHost = address
+		}
+
+		sshConfig = &ssh.Config{
+			Host:               resolvedHost,
+			HostName:           host,
+			Port:               profile.SSHPort,
+			User:               profile.RemoteUser,
+			KeyPath:            profile.SSHKeyPath,
+			UsePassword:        profile.UsePassword,
+			Timeout:            time.Duration(timeout) * time.Second,
+			PassphraseEnv:      cli.PassphraseEnv,
+			KnownHostsPath:     knownHostsPath,
+			KeyDir:             keyDir,
+			DefaultKeys:        cfg.Settings.DefaultKeys,
+			PKCS11Provider:     profile.PKCS11Provider,
+			PINPrompt:          cli.TokenPIN(),
+			NonInteractive:     cli.NonInteractive,
+			StrictHostKeys:     cfg.Settings.StrictHostKeys,
+			HostCAKeys:         cfg.Settings.HostCAKeys,
+			HostKeyFingerprint: profile.HostKeyFingerprint,
+			AllowedCIDRs:       profile.AllowedCIDRs,
+			HostKeyMaxAge:      cfg.Settings.HostKeyMaxAge(),
+			HostKeyMaxIdle:     cfg.Settings.HostKeyMaxIdle(),
+		}
+		if len(jumpAddrs) > 0 {
+			sshConfig.Jump = cli.JumpSSHConfig(profile, jumpAddrs, sshConfig.Timeout)
+		}
+
+		client, err := ssh.NewClient(sshConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SSH client: %w", err)
+		}
+		err = client.Connect(ctx)
+		cli.AuditConnection(profile, selectedBackend.Name(), resolvedHost, client, err)
+		return client, err
 	}
 
-	// Connect
-	if err := client.Connect(ctx); err != nil {
+	// Connect; this may prompt for a password or host key confirmation.
+	// Each hostname gets the whole timeout.
+	var client *ssh.Client
+	err = steps.RunInteractive("Connecting via SSH", func() error {
+		client, _, err = cli.ConnectHosts(context.Background(), hosts, time.Duration(timeout)*time.Second, dialHost)
+		return err
+	})
+	if err != nil {
 		ui.PrintError("Connection failed: %v", err)
+		if hint := cli.LivenessHint(selectedBackend, profile); hint != "" {
+			ui.PrintInfo("%s", hint)
+		}
 		os.Exit(1)
 	}
-	defer client.Close()
 
 	ui.PrintSuccess("Connected to %s@%s", profile.RemoteUser, resolvedHost)
+	if verbose {
+		ui.PrintInfo("Authenticated with %s", client.ConnectionInfo().AuthMethod)
+	}
+	cli.PrintHostKeyWarnings(client.ConnectionInfo())
+
+	interactiveSession(profile, resolvedHost, client, func(ctx context.Context) (*ssh.Client, error) {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+
+		client, err := ssh.NewClient(sshConfig)
+		if err != nil {
+			return nil, err
+		}
+		err = client.Connect(ctx)
+		cli.AuditConnection(profile, selectedBackend.Name(), resolvedHost, client, err)
+		return client, err
+	})
+}
+
+// interactiveSession runs an interactive shell over client, starting a new
+// one over a connection from dial if the connection drops and --reconnect
+// is set
+func interactiveSession(profile *config.Profile, host string, client *ssh.Client, dial func(context.Context) (*ssh.Client, error)) {
+	var err error
+	for {
+		var lost bool
+		lost, err = runShell(client)
+		client.Close()
+		if !lost || !cli.Reconnect {
+			break
+		}
 
-	// Start interactive shell
-	if err := client.InteractiveShell(); err != nil {
+		ui.PrintWarning("Connection to %s lost: %v", profile.RemoteHost, err)
+		client = reconnect(context.Background(), dial)
+		ui.PrintSuccess("Reconnected to %s@%s", profile.RemoteUser, host)
+	}
+	if err != nil {
 		ui.PrintError("Shell error: %v", err)
 		os.Exit(1)
 	}
 }
 
+// runShell runs an interactive shell over client, checking the connection
+// with keepalives, and reports whether it ended because the connection was
+// lost. A failed keepalive closes the connection and is returned as the error.
+func runShell(client *ssh.Client) (bool, error) {
+	if cli.KeepAlive <= 0 {
+		err := client.InteractiveShell()
+		return err != nil && ssh.IsConnectionLost(err), err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	keepAliveErr := make(chan error, 1)
+	go func() {
+		keepAliveErr <- client.KeepAlive(ctx, cli.KeepAlive, cli.KeepAliveMax)
+	}()
+
+	err := client.InteractiveShell()
+	cancel()
+	if kaErr := <-keepAliveErr; kaErr != nil {
+		return true, kaErr
+	}
+	return err != nil && ssh.IsConnectionLost(err), err
+}
+
+func connectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "connect [profile]",
+		Short: "Connect to a remote machine (same as 'klip [profile]')",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   runConnect,
+	}
+
+	cmd.Flags().StringVarP(&profileName, "profile", "p", "", "Connection profile to use")
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cmd.Flags().BoolVar(&planOnly, "plan", false, "Show what connecting would do without connecting")
+	cli.AddWaitFlags(cmd)
+	cli.AddKeepAliveFlags(cmd)
+	cli.AddReconnectFlag(cmd)
+
+	return cmd
+}
+
+// runPlan prints what connecting would do: backend, resolved address,
+// authentication methods and host key status
+func runPlan() {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profileName,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		NoMux:       true,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	plan := helper.PlanConnection(ctx)
+
+	ui.PrintHeader("Connection Plan")
+	ui.PrintKeyValue("Profile", plan.Profile)
+	ui.PrintKeyValue("Backend", plan.Backend)
+	if plan.ResolvedHost != plan.Host {
+		ui.PrintKeyValue("Host", fmt.Sprintf("%s → %s", plan.Host, plan.ResolvedHost))
+	} else {
+		ui.PrintKeyValue("Host", plan.Host)
+	}
+	ui.PrintKeyValue("Port", fmt.Sprintf("%d", plan.Port))
+	ui.PrintKeyValue("User", plan.User)
+	for i, jump := range plan.JumpHosts {
+		if i < len(plan.ResolvedJumps) && !strings.HasSuffix(jump, "@"+plan.ResolvedJumps[i]) {
+			jump = fmt.Sprintf("%s → %s", jump, plan.ResolvedJumps[i])
+		}
+		ui.PrintKeyValue(fmt.Sprintf("Jump Host %d", i+1), jump)
+	}
+
+	ui.PrintSubHeader("Authentication (in order)")
+	step := 0
+	for _, auth := range plan.Auth {
+		if auth.Problem != "" {
+			fmt.Printf("  %s %s %s: %s\n", ui.Warning("-"), auth.Method, auth.Detail, ui.Dim(fmt.Sprintf(ui.T("skipped (%s)"), auth.Problem)))
+			continue
+		}
+		step++
+		fmt.Printf("  %d. %s %s\n", step, auth.Method, ui.Dim(auth.Detail))
+	}
+
+	ui.PrintSubHeader("Host Key")
+	if plan.PinnedFingerprint != "" {
+		ui.PrintSuccess("Pinned to %s", plan.PinnedFingerprint)
+	} else if len(plan.KnownHostKeys) > 0 {
+		ui.PrintSuccess("Known (%s)", strings.Join(plan.KnownHostKeys, ", "))
+	} else if plan.HostCAKeys > 0 {
+		ui.PrintInfo("Not in known_hosts; trusted if it presents a certificate signed by a host CA in settings.host_ca_keys")
+	} else {
+		ui.PrintWarning("Unknown host; you will be asked to verify its fingerprint")
+	}
+
+	ui.PrintEmptyLine()
+	if plan.Problem != nil {
+		ui.PrintWarning("Connection would likely fail: %v", plan.Problem)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Ready to connect")
+}
+
 func profileCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "profile",
@@ -227,6 +572,18 @@ func profileCmd() *cobra.Command {
 		Run:   runProfileEdit,
 	})
 
+	showCmd := &cobra.Command{
+		Use:   "show <profile>",
+		Short: "Show a profile",
+		Long:  "Shows a profile's settings. With --copy, also copies the equivalent ssh command or the SSH key fingerprint to the clipboard.",
+		Args:  cobra.ExactArgs(1),
+		Run:   runProfileShow,
+	}
+	showCmd.Flags().StringVar(&copyTarget, "copy", "", "Copy to clipboard: ssh (ssh command) or fingerprint (SSH key)")
+	cmd.AddCommand(showCmd)
+	cmd.AddCommand(pinKeyCmd())
+	cmd.AddCommand(exportSSHConfigCmd())
+
 	return cmd
 }
 
@@ -237,33 +594,62 @@ func runProfileList(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	profiles := cfg.ListProfiles()
-	if len(profiles) == 0 {
-		ui.PrintInfo("No profiles configured")
-		return
+	type profileEntry struct {
+		Name        string `json:"name"`
+		Current     bool   `json:"current"`
+		User        string `json:"user"`
+		Host        string `json:"host"`
+		Port        int    `json:"port"`
+		Backend     string `json:"backend"`
+		Description string `json:"description,omitempty"`
 	}
-
-	ui.PrintHeader("Connection Profiles")
-
-	for _, name := range profiles {
+	entries := []profileEntry{}
+	for _, name := range cfg.ListProfiles() {
 		profile, err := cfg.GetProfile(name)
 		if err != nil {
 			continue
 		}
+		entries = append(entries, profileEntry{
+			Name:        name,
+			Current:     name == cfg.CurrentProfile,
+			User:        profile.RemoteUser,
+			Host:        profile.RemoteHost,
+			Port:        profile.SSHPort,
+			Backend:     string(profile.Backend),
+			Description: profile.Description,
+		})
+	}
 
-		marker := " "
-		if name == cfg.CurrentProfile {
-			marker = ui.Success("●")
+	err = ui.Render(entries, func() {
+		if len(entries) == 0 {
+			ui.PrintInfo("No profiles configured")
+			return
 		}
 
-		fmt.Printf("%s %s\n", marker, ui.Bold(name))
-		fmt.Printf("  User: %s\n", profile.RemoteUser)
-		fmt.Printf("  Host: %s\n", profile.RemoteHost)
-		fmt.Printf("  Backend: %s\n", profile.Backend)
-		if profile.Description != "" {
-			fmt.Printf("  Description: %s\n", ui.Dim(profile.Description))
+		pager := ui.StartPager(noPager)
+		defer pager.Close()
+
+		ui.PrintHeader("Connection Profiles")
+
+		for _, entry := range entries {
+			marker := " "
+			if entry.Current {
+				marker = ui.Highlight("●")
+			}
+
+			fmt.Printf("%s %s\n", marker, ui.Bold(entry.Name))
+			fmt.Printf("  %s: %s\n", ui.T("User"), entry.User)
+			fmt.Printf("  %s: %s\n", ui.T("Host"), entry.Host)
+			fmt.Printf("  %s: %s\n", ui.T("Backend"), entry.Backend)
+			if entry.Description != "" {
+				fmt.Printf("  %s: %s\n", ui.T("Description"), ui.Dim(entry.Description))
+			}
+			ui.PrintEmptyLine()
 		}
-		ui.PrintEmptyLine()
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
 	}
 }
 
@@ -302,7 +688,12 @@ func runProfileRemove(cmd *cobra.Command, args []string) {
 
 	name := args[0]
 
-	if !ui.ConfirmDefaultNo(fmt.Sprintf("Remove profile '%s'?", name)) {
+	confirmed, err := ui.ConfirmDestructive(ui.Destructive, "Remove profile '%s'?", name)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if !confirmed {
 		ui.PrintInfo("Cancelled")
 		return
 	}
@@ -343,42 +734,201 @@ func runProfileSetCurrent(cmd *cobra.Command, args []string) {
 }
 
 func statusCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show backend status",
 		Run:   runStatus,
 	}
+
+	cmd.Flags().StringVar(&explainProfile, "explain", "", "Explain which backend a profile would use and why")
+
+	return cmd
 }
 
 func runStatus(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	registry := backend.NewRegistry()
+	if explainProfile != "" {
+		runStatusExplain(ctx, explainProfile)
+		return
+	}
+
+	registry := newRegistry()
 	detector := backend.NewDetector(registry)
 
 	allStatus := detector.DetectAll(ctx)
 
-	ui.PrintHeader("VPN Backend Status")
+	names := make([]string, 0, len(allStatus))
+	for name := range allStatus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type backendStatus struct {
+		Backend   string `json:"backend"`
+		Connected bool   `json:"connected"`
+		LocalIP   string `json:"local_ip,omitempty"`
+		Message   string `json:"message,omitempty"`
+	}
+	statuses := make([]backendStatus, 0, len(names))
+	for _, name := range names {
+		status := allStatus[name]
+		statuses = append(statuses, backendStatus{
+			Backend:   name,
+			Connected: status.Connected,
+			LocalIP:   status.LocalIP,
+			Message:   status.Message,
+		})
+	}
+
+	err := ui.Render(statuses, func() {
+		pager := ui.StartPager(noPager)
+		defer pager.Close()
 
-	headers := []string{"Backend", "Status", "IP Address", "Message"}
-	var rows [][]string
+		ui.PrintHeader("VPN Backend Status")
 
-	for name, status := range allStatus {
-		statusStr := ui.Error("✗ Disconnected")
-		if status.Connected {
-			statusStr = ui.Success("✓ Connected")
+		headers := []string{"Backend", "Status", "IP Address", "Message"}
+		var rows [][]string
+
+		for _, status := range statuses {
+			statusStr := ui.Error(ui.T("✗ Disconnected"))
+			if status.Connected {
+				statusStr = ui.Success(ui.T("✓ Connected"))
+			}
+
+			rows = append(rows, []string{
+				status.Backend,
+				statusStr,
+				status.LocalIP,
+				status.Message,
+			})
 		}
 
-		rows = append(rows, []string{
-			name,
-			statusStr,
-			status.LocalIP,
-			status.Message,
-		})
+		ui.PrintTable(headers, rows)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+// runStatusExplain shows how backend selection plays out for a profile
+func runStatusExplain(ctx context.Context, name string) {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
 	}
 
-	ui.PrintTable(headers, rows)
+	profile, _, err := cfg.ResolveProfile(name)
+	if err != nil {
+		ui.PrintError("Profile not found: %v", err)
+		os.Exit(1)
+	}
+	profile, locationSteps := cli.ApplyLocation(cfg, profile)
+
+	detector := backend.NewDetector(newRegistry()).Restrict(profile.BackendPermitted)
+	explanation := detector.Explain(ctx, string(profile.Backend), profile.RemoteHost)
+
+	type candidate struct {
+		Backend   string `json:"backend"`
+		Priority  int    `json:"priority"`
+		Denied    bool   `json:"denied"`
+		Installed bool   `json:"installed"`
+		Connected bool   `json:"connected"`
+		Resolved  string `json:"resolved,omitempty"`
+		Error     string `json:"error,omitempty"`
+	}
+	result := struct {
+		Profile    string      `json:"profile"`
+		Host       string      `json:"host"`
+		Preference string      `json:"preference"`
+		Candidates []candidate `json:"candidates"`
+		Steps      []string    `json:"steps"`
+		Selected   string      `json:"selected"`
+	}{
+		Profile:    profile.Name,
+		Host:       profile.RemoteHost,
+		Preference: explanation.Preference,
+		Candidates: []candidate{},
+		Steps:      append(locationSteps, explanation.Steps...),
+		Selected:   explanation.Selected,
+	}
+	for _, c := range explanation.Candidates {
+		entry := candidate{
+			Backend:   c.Name,
+			Priority:  c.Priority,
+			Denied:    c.Denied,
+			Installed: c.Available,
+			Connected: c.Connected,
+			Resolved:  c.Resolved,
+		}
+		if c.ResolveErr != nil {
+			entry.Error = c.ResolveErr.Error()
+		}
+		result.Candidates = append(result.Candidates, entry)
+	}
+
+	err = ui.Render(result, func() {
+		pager := ui.StartPager(noPager)
+		defer pager.Close()
+
+		ui.PrintHeader(fmt.Sprintf(ui.T("Backend Selection for %s"), profile.Name))
+		ui.PrintKeyValue("Preference", explanation.Preference)
+		ui.PrintKeyValue("Host", profile.RemoteHost)
+		fmt.Println()
+
+		headers := []string{"Backend", "Priority", "Installed", "Connected", "Resolves To"}
+		var rows [][]string
+		for _, c := range explanation.Candidates {
+			if c.Denied {
+				rows = append(rows, []string{c.Name, strconv.Itoa(c.Priority), "-", "-", ui.Warning(ui.T("denied by profile"))})
+				continue
+			}
+
+			resolved := "-"
+			switch {
+			case c.ResolveErr != nil:
+				resolved = ui.Error(c.ResolveErr.Error())
+			case c.Resolved != "":
+				resolved = c.Resolved
+			}
+
+			rows = append(rows, []string{
+				c.Name,
+				strconv.Itoa(c.Priority),
+				yesNo(c.Available),
+				yesNo(c.Connected),
+				resolved,
+			})
+		}
+		ui.PrintTable(headers, rows)
+
+		ui.PrintSubHeader("Decision")
+		for i, step := range result.Steps {
+			fmt.Printf("  %d. %s\n", i+1, step)
+		}
+		fmt.Println()
+
+		if explanation.Selected == "" {
+			ui.PrintError("No backend can be selected")
+			return
+		}
+		ui.PrintSuccess("Selected: %s", explanation.Selected)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+// yesNo renders a boolean table cell
+func yesNo(b bool) string {
+	if b {
+		return ui.Success(ui.T("yes"))
+	}
+	return ui.Dim(ui.T("no"))
 }
 
 func versionCmd() *cobra.Command {
@@ -409,27 +959,51 @@ func runHealth(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	registry := backend.NewRegistry()
+	registry := newRegistry()
 	detector := backend.NewDetector(registry)
 
-	ui.PrintHeader("Health Check")
-	ui.PrintEmptyLine()
-
 	results := detector.HealthCheck(ctx)
 
+	type healthEntry struct {
+		Backend   string  `json:"backend"`
+		Available bool    `json:"available"`
+		Connected bool    `json:"connected"`
+		Message   string  `json:"message,omitempty"`
+		Seconds   float64 `json:"seconds"`
+	}
+	entries := make([]healthEntry, 0, len(results))
 	for _, result := range results {
-		status := ui.Error("✗")
-		if result.Available && result.Connected {
-			status = ui.Success("✓")
-		} else if result.Available {
-			status = ui.Warning("○")
-		}
+		entries = append(entries, healthEntry{
+			Backend:   result.Backend,
+			Available: result.Available,
+			Connected: result.Connected,
+			Message:   result.Message,
+			Seconds:   result.Duration.Seconds(),
+		})
+	}
+
+	err := ui.Render(entries, func() {
+		ui.PrintHeader("Health Check")
+		ui.PrintEmptyLine()
 
-		fmt.Printf("%s %s: %s (%.2fs)\n",
-			status,
-			ui.Bold(result.Backend),
-			result.Message,
-			result.Duration.Seconds())
+		for _, result := range results {
+			status := ui.Error("✗")
+			if result.Available && result.Connected {
+				status = ui.Success("✓")
+			} else if result.Available {
+				status = ui.Warning("○")
+			}
+
+			fmt.Printf("%s %s: %s (%.2fs)\n",
+				status,
+				ui.Bold(result.Backend),
+				result.Message,
+				result.Duration.Seconds())
+		}
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
 	}
 }
 
@@ -448,7 +1022,12 @@ func runInit(cmd *cobra.Command, args []string) {
 	if migrationStatus.ModernConfigExists {
 		ui.PrintInfo("Configuration already exists")
 
-		if !ui.Confirm("Re-initialize configuration?") {
+		ok, err := ui.ConfirmDestructive(ui.Destructive, "Re-initialize configuration?")
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		if !ok {
 			return
 		}
 	}
@@ -456,17 +1035,31 @@ func runInit(cmd *cobra.Command, args []string) {
 	cfg := config.NewConfig()
 
 	// Attempt migration if legacy config exists
+	migrate := false
 	if migrationStatus.CanMigrate {
 		ui.PrintInfo("Found legacy LINK configuration")
+		migrate = ui.Confirm("Migrate existing profiles?")
+	}
+
+	total := 1
+	if migrate {
+		total++
+	}
+	steps := ui.NewStepRunner(total)
 
-		if ui.Confirm("Migrate existing profiles?") {
+	if migrate {
+		err := steps.Run("Migrating legacy profiles", func() error {
 			migrated, err := config.MigrateLegacyConfig()
 			if err != nil {
-				ui.PrintWarning("Migration failed: %v", err)
-			} else {
-				cfg = migrated
-				ui.PrintSuccess("Migrated %d profile(s)", len(cfg.Profiles))
+				return err
 			}
+			cfg = migrated
+			return nil
+		})
+		if err != nil {
+			ui.PrintWarning("Migration failed: %v", err)
+		} else {
+			ui.PrintSuccess("Migrated %d profile(s)", len(cfg.Profiles))
 		}
 	}
 
@@ -484,7 +1077,7 @@ func runInit(cmd *cobra.Command, args []string) {
 	}
 
 	// Save configuration
-	if err := cfg.Save(); err != nil {
+	if err := steps.Run("Saving configuration", cfg.Save); err != nil {
 		ui.PrintError("Failed to save configuration: %v", err)
 		os.Exit(1)
 	}
@@ -510,82 +1103,100 @@ func runProfileValidate(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	ui.PrintHeader(fmt.Sprintf("Validating Profile: %s", profileName))
+	ui.PrintHeader(fmt.Sprintf(ui.T("Validating Profile: %s"), profileName))
 	ui.PrintEmptyLine()
 
+	total := 6
+	if profile.SSHKeyPath != "" {
+		total++
+	}
+	steps := ui.NewStepRunner(total)
+
 	// Validate profile configuration
-	ui.PrintInfo("Checking profile configuration...")
-	if err := profile.Validate(); err != nil {
+	if err := steps.Run("Checking profile configuration", profile.Validate); err != nil {
 		ui.PrintError("Profile validation failed: %v", err)
 		os.Exit(1)
 	}
-	ui.PrintSuccess("Profile configuration is valid")
 
 	// Validate port
-	ui.PrintInfo("Validating SSH port...")
-	if err := config.ValidatePort(profile.SSHPort); err != nil {
+	err = steps.Run("Validating SSH port", func() error {
+		return config.ValidatePort(profile.SSHPort)
+	})
+	if err != nil {
 		ui.PrintError("Invalid port: %v", err)
 		os.Exit(1)
 	}
-	ui.PrintSuccess("Port %d is valid", profile.SSHPort)
 
 	// Validate hostname
-	ui.PrintInfo("Validating hostname...")
-	if err := config.ValidateHostname(profile.RemoteHost); err != nil {
+	err = steps.Run("Validating hostname", func() error {
+		return config.ValidateHostname(profile.RemoteHost)
+	})
+	if err != nil {
 		ui.PrintError("Invalid hostname: %v", err)
 		os.Exit(1)
 	}
-	ui.PrintSuccess("Hostname %s is valid", profile.RemoteHost)
 
 	// Validate username
-	ui.PrintInfo("Validating username...")
-	if err := config.ValidateUsername(profile.RemoteUser); err != nil {
+	err = steps.Run("Validating username", func() error {
+		return config.ValidateUsername(profile.RemoteUser)
+	})
+	if err != nil {
 		ui.PrintError("Invalid username: %v", err)
 		os.Exit(1)
 	}
-	ui.PrintSuccess("Username %s is valid", profile.RemoteUser)
 
 	// Validate SSH key if specified
 	if profile.SSHKeyPath != "" {
-		ui.PrintInfo("Validating SSH key...")
-		if err := config.ValidateSSHKeyPath(profile.SSHKeyPath); err != nil {
+		err = steps.Run("Validating SSH key", func() error {
+			return config.ValidateSSHKeyPath(profile.SSHKeyPath)
+		})
+		if err != nil {
 			ui.PrintError("Invalid SSH key: %v", err)
 			os.Exit(1)
 		}
-		ui.PrintSuccess("SSH key is valid")
 	}
 
 	// Check backend availability
-	ui.PrintInfo("Checking backend availability...")
 	ctx := context.Background()
-	registry := backend.NewRegistry()
-	detector := backend.NewDetector(registry)
-	selectedBackend, err := detector.SelectBackend(ctx, string(profile.Backend))
+	registry := newRegistry()
+	detector := backend.NewDetector(registry).Restrict(profile.BackendPermitted)
+
+	var selectedBackend backend.Backend
+	var available, connected bool
+	err = steps.Run("Checking backend availability", func() error {
+		selectedBackend, err = detector.SelectBackend(ctx, string(profile.Backend))
+		if err != nil {
+			return err
+		}
+		available = selectedBackend.IsAvailable(ctx)
+		connected = available && selectedBackend.IsConnected(ctx)
+		return nil
+	})
 	if err != nil {
 		ui.PrintError("Backend detection failed: %v", err)
 		os.Exit(1)
 	}
 
-	if !selectedBackend.IsAvailable(ctx) {
+	switch {
+	case !available:
 		ui.PrintWarning("Backend %s is not available", selectedBackend.Name())
-	} else {
-		ui.PrintSuccess("Backend %s is available", selectedBackend.Name())
-
-		// Check if backend is connected
-		if selectedBackend.IsConnected(ctx) {
-			ui.PrintSuccess("Backend %s is connected", selectedBackend.Name())
+	case !connected:
+		ui.PrintWarning("Backend %s is not connected", selectedBackend.Name())
+	}
 
-			// Try to resolve hostname
-			ui.PrintInfo("Resolving hostname via %s...", selectedBackend.Name())
-			resolvedHost, err := selectedBackend.GetPeerIP(ctx, profile.RemoteHost)
-			if err != nil {
-				ui.PrintWarning("Failed to resolve hostname: %v", err)
-			} else {
-				ui.PrintSuccess("Hostname resolved to: %s", resolvedHost)
-			}
-		} else {
-			ui.PrintWarning("Backend %s is not connected", selectedBackend.Name())
+	// Try to resolve hostname
+	var resolvedHost string
+	err = steps.Run("Resolving hostname", func() error {
+		if !connected {
+			return fmt.Errorf("backend %s is not connected", selectedBackend.Name())
 		}
+		resolvedHost, err = selectedBackend.GetPeerIP(ctx, profile.RemoteHost)
+		return err
+	})
+	if err != nil {
+		ui.PrintWarning("Failed to resolve hostname: %v", err)
+	} else {
+		ui.PrintSuccess("Hostname resolved to: %s", resolvedHost)
 	}
 
 	ui.PrintEmptyLine()
@@ -634,3 +1245,72 @@ func runProfileEdit(cmd *cobra.Command, args []string) {
 
 	ui.PrintSuccess("Profile %s updated successfully", profileName)
 }
+
+func runProfileShow(cmd *cobra.Command, args []string) {
+	profileName := args[0]
+
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+
+	profile, values, err := cfg.ResolveProfile(profileName)
+	if err != nil {
+		ui.PrintError("Profile not found: %s", profileName)
+		os.Exit(1)
+	}
+
+	// Resolve the clipboard text first so invalid --copy values fail early
+	var clip string
+	switch copyTarget {
+	case "":
+	case "ssh":
+		clip = profile.SSHCommand()
+	case "fingerprint":
+		if profile.SSHKeyPath == "" {
+			ui.PrintError("Profile %s has no SSH key configured", profileName)
+			os.Exit(1)
+		}
+		clip, err = ssh.GetPublicKeyFingerprint(profile.SSHKeyPath)
+		if err != nil {
+			ui.PrintError("Failed to read SSH key fingerprint: %v", err)
+			os.Exit(1)
+		}
+	default:
+		ui.PrintError("Invalid --copy value: %s (must be ssh or fingerprint)", copyTarget)
+		os.Exit(1)
+	}
+
+	ui.PrintHeader(fmt.Sprintf(ui.T("Profile: %s"), profileName))
+	if profile.Description != "" {
+		fmt.Println(ui.Dim(profile.Description))
+	}
+	ui.PrintEmptyLine()
+
+	// Effective values after settings and defaults, with their source
+	rows := make([][]string, 0, len(values))
+	for _, v := range values {
+		source := string(v.Source)
+		if v.Source != config.SourceProfile {
+			source = ui.Dim(source)
+		}
+		rows = append(rows, []string{v.Key, v.Value, source})
+	}
+	ui.PrintTable([]string{"Setting", "Value", "Source"}, rows)
+
+	ui.PrintEmptyLine()
+	ui.PrintKeyValue("SSH command", profile.SSHCommand())
+
+	if clip == "" {
+		return
+	}
+
+	ui.PrintEmptyLine()
+	fmt.Println(clip)
+	if err := ui.CopyToClipboard(clip); err != nil {
+		ui.PrintWarning("%v", err)
+		return
+	}
+	ui.PrintSuccess("Copied to clipboard")
+}
@@ -0,0 +1,210 @@
+// klip - Golden-file tests of command output
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// newTestEnv isolates a test and loads the fixture configuration
+func newTestEnv(t *testing.T) *clitest.Env {
+	env := clitest.NewEnv(t)
+	config, err := os.ReadFile("testdata/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.WriteConfig(string(config))
+
+	// The backends seen by status and connection planning
+	registry := newRegistry
+	newRegistry = clitest.Registry(
+		&clitest.Backend{
+			Status:    backend.Status{Backend: "lan", Connected: true, LocalIP: "192.168.1.20", Message: "Network interfaces active"},
+			Installed: true,
+			Prio:      10,
+		},
+		&clitest.Backend{
+			Status:    backend.Status{Backend: "tailscale", Connected: true, LocalIP: "100.64.0.1", Message: "Connected to tailnet"},
+			Installed: true,
+			Peers:     map[string]string{"web.example.com": "100.64.0.2"},
+			Prio:      100,
+		},
+		&clitest.Backend{
+			Status:    backend.Status{Backend: "netbird", Message: "Daemon not running"},
+			Installed: true,
+		},
+	)
+	t.Cleanup(func() {
+		newRegistry = registry
+		ui.SetOutputFormat(ui.OutputText)
+	})
+	return env
+}
+
+// golden runs klip with args and compares its stdout with a golden file
+func golden(t *testing.T, env *clitest.Env, name string, args ...string) {
+	t.Helper()
+	result := env.Run(newRootCmd(), args...)
+	if result.Err != nil {
+		t.Fatalf("klip %v: %v\n%s", args, result.Err, result.Stderr)
+	}
+	clitest.Golden(t, name, result.Stdout)
+}
+
+func TestProfileListOutput(t *testing.T) {
+	env := newTestEnv(t)
+	golden(t, env, "profile-list", "profile", "list")
+	golden(t, env, "profile-list-json", "profile", "list", "--output", "json")
+}
+
+func TestStatusOutput(t *testing.T) {
+	env := newTestEnv(t)
+	golden(t, env, "status", "status")
+	golden(t, env, "status-json", "status", "--output", "json")
+}
+
+func TestTeamListOutput(t *testing.T) {
+	env := newTestEnv(t)
+	golden(t, env, "team-list", "team", "list")
+	golden(t, env, "team-list-json", "--output", "json", "team", "list")
+}
+
+func TestAuditQueryOutput(t *testing.T) {
+	env := newTestEnv(t)
+	log, err := os.ReadFile("testdata/audit.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(env.StatePath(""), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(env.StatePath("audit.log"), log, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	golden(t, env, "audit-query-failed", "audit", "query", "--event-type", "transfer", "--status", "failed", "--since", "2025-03-01")
+	golden(t, env, "audit-query-json", "audit", "query", "--profile", "web", "--limit", "2", "--output", "json")
+}
+
+func TestExportSSHConfigAccess(t *testing.T) {
+	env := clitest.NewEnv(t)
+	env.WriteConfig(`profiles:
+  open:
+    name: open
+    remote_user: deploy
+    remote_host: open.internal
+  guarded:
+    name: guarded
+    remote_user: deploy
+    remote_host: guarded.internal
+    access:
+      - deny: [reboot]
+        confirm: [exec]
+  readonly:
+    name: readonly
+    remote_user: deploy
+    remote_host: readonly.internal
+    access:
+      - read_only: true
+  locked:
+    name: locked
+    remote_user: deploy
+    remote_host: locked.internal
+    access:
+      - deny: [connect]
+settings:
+  default_backend: lan
+`)
+
+	result := env.Run(newRootCmd(), "profile", "export-ssh-config", "--stdout")
+	if result.Err != nil {
+		t.Fatalf("export-ssh-config: %v\n%s", result.Err, result.Stderr)
+	}
+	for _, want := range []string{"Host open\n", "# klip access rules restrict exec, reboot; ssh does not apply them\nHost guarded\n", "Profile 'locked': not exported", "Profile 'readonly': not exported"} {
+		if !strings.Contains(result.Stdout, want) {
+			t.Errorf("output lacks %q:\n%s", want, result.Stdout)
+		}
+	}
+	for _, denied := range []string{"Host locked", "Host readonly"} {
+		if strings.Contains(result.Stdout, denied) {
+			t.Errorf("profile denying connect was exported:\n%s", result.Stdout)
+		}
+	}
+}
+
+func TestListenMetrics(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	cfg := config.NewConfig()
+	cfg.Settings.Metrics.Listen = taken.Addr().String()
+
+	// Another mux holds the shared address: no metrics, but no error
+	listener, err := listenMetrics(cfg, &config.Profile{Name: "web"})
+	if err != nil || listener != nil {
+		t.Fatalf("shared address taken: got %v, %v", listener, err)
+	}
+
+	// The profile's own address is used instead of the shared one
+	listener, err = listenMetrics(cfg, &config.Profile{Name: "web", MetricsListen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	// An address of the profile's own must be free
+	if _, err := listenMetrics(cfg, &config.Profile{Name: "web", MetricsListen: taken.Addr().String()}); err == nil {
+		t.Fatal("taken profile address was not reported")
+	}
+}
+
+func TestExportSSHConfigMerge(t *testing.T) {
+	env := clitest.NewEnv(t)
+	profiles := `profiles:
+  web:
+    name: web
+    remote_user: deploy
+    remote_host: %s
+  db:
+    name: db
+    remote_user: deploy
+    remote_host: db.internal
+settings:
+  default_backend: lan
+`
+	env.WriteConfig(strings.Replace(profiles, "%s", "web.internal", 1))
+	path := env.WriteFile("ssh_config", "Host mine\n    User me\n")
+	if result := env.Run(newRootCmd(), "profile", "export-ssh-config", "--file", path); result.Err != nil {
+		t.Fatalf("export-ssh-config: %v\n%s", result.Err, result.Stderr)
+	}
+
+	// Exporting one profile replaces only its entry
+	env.WriteConfig(strings.Replace(profiles, "%s", "web.example.com", 1))
+	if result := env.Run(newRootCmd(), "profile", "export-ssh-config", "--file", path, "web"); result.Err != nil {
+		t.Fatalf("export-ssh-config web: %v\n%s", result.Err, result.Stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, want := range []string{"Host mine\n", "Host db\n    HostName db.internal\n", "Host web\n    HostName web.example.com\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("ssh_config lacks %q:\n%s", want, content)
+		}
+	}
+	if strings.Count(content, "Host web\n") != 1 || strings.Contains(content, "web.internal") {
+		t.Errorf("old entry for web was kept:\n%s", content)
+	}
+}
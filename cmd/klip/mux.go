@@ -0,0 +1,304 @@
+// klip - Connection multiplexing
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// muxBackgroundEnv marks the process started by 'klip mux start -f'
+const muxBackgroundEnv = "KLIP_MUX_BACKGROUND"
+
+var (
+	muxBackground    bool
+	muxMetricsListen string
+)
+
+func muxCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mux",
+		Short: "Hold connections open for reuse by later klip commands",
+		Long: `A mux holds an SSH connection to a profile's host open and shares it over
+a unix socket in the XDG runtime directory, like an OpenSSH control master.
+While it runs, klip, klip exec, klip checksum, klip reboot, klipc and klipr
+reuse the connection instead of selecting a backend, resolving the host and
+authenticating again. klip forward always connects directly.
+
+With --metrics-listen, the profile's metrics_listen or
+settings.metrics.listen, the mux serves Prometheus metrics of its
+connections, relayed bytes and backend health on
+http://<address>/metrics.`,
+	}
+
+	startCmd := &cobra.Command{
+		Use:   "start <profile>",
+		Short: "Connect and share the connection until stopped",
+		Example: `  klip mux start web -f
+  klipc -p web site.tar.gz /srv/
+  klip mux stop web`,
+		Args: cobra.ExactArgs(1),
+		Run:  runMuxStart,
+	}
+	startCmd.Flags().BoolVarP(&muxBackground, "background", "f", false, "Go to the background once connected")
+	startCmd.Flags().StringVar(&muxMetricsListen, "metrics-listen", "", "Serve Prometheus metrics on this host:port (default: the profile's metrics_listen, or settings.metrics.listen)")
+	startCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	startCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	startCmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cli.AddKeepAliveFlags(startCmd)
+
+	cmd.AddCommand(startCmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "stop <profile>",
+		Short: "Stop the mux for a profile",
+		Args:  cobra.ExactArgs(1),
+		Run:   runMuxStop,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List running muxes",
+		Args:  cobra.NoArgs,
+		Run:   runMuxStatus,
+	})
+
+	return cmd
+}
+
+func runMuxStart(cmd *cobra.Command, args []string) {
+	background := os.Getenv(muxBackgroundEnv) != ""
+	if muxBackground && !background {
+		os.Exit(startMuxBackground(args[0]))
+	}
+
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: args[0],
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpMux,
+		NoMux:       true,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(1)
+	}
+
+	// Claim the socket before connecting so a running mux fails fast
+	socketPath := ssh.MuxSocketPath(helper.Profile.Name)
+	listener, err := ssh.ListenMux(socketPath)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	metricsListener, err := listenMetrics(helper.Config, helper.Profile)
+	if err != nil {
+		listener.Close()
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		listener.Close()
+		if metricsListener != nil {
+			metricsListener.Close()
+		}
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	mux, err := ssh.NewMux(client, ssh.MuxInfo{
+		Profile:       helper.Profile.Name,
+		Backend:       helper.Backend.Name(),
+		ResolvedHost:  helper.ResolvedHost,
+		ResolvedJumps: helper.ResolvedJumps,
+		Started:       time.Now(),
+		PID:           os.Getpid(),
+	})
+	if err != nil {
+		listener.Close()
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	if metricsListener != nil {
+		registry := cli.MuxMetrics(mux.Info(), mux.Stats(), helper.Profile)
+		go func() {
+			if err := registry.Serve(ctx, metricsListener); err != nil {
+				ui.PrintWarning("%v", err)
+			}
+		}()
+		ui.PrintInfo("Serving metrics on http://%s/metrics", metricsListener.Addr())
+	}
+
+	if cli.KeepAlive > 0 {
+		go client.KeepAlive(ctx, cli.KeepAlive, cli.KeepAliveMax)
+	}
+
+	ui.PrintSuccess("Sharing connection to %s@%s via %s on %s", helper.Profile.RemoteUser, helper.ResolvedHost, helper.Backend.Name(), socketPath)
+	if background {
+		detachOutput()
+	} else {
+		ui.PrintInfo("Press Ctrl-C to stop")
+	}
+
+	if err := mux.Serve(ctx, listener); err != nil {
+		ui.PrintError("Mux stopped: %v", err)
+		os.Exit(1)
+	}
+	ui.PrintInfo("Mux stopped")
+}
+
+// listenMetrics listens on the address of --metrics-listen, or else the
+// profile's metrics_listen or settings.metrics.listen, returning nil if
+// none is set. The address of the settings is shared by every mux, so when
+// another mux holds it this one serves no metrics, with a warning. The
+// metrics have no authentication, so listening beyond the loopback
+// interface is warned about.
+func listenMetrics(cfg *config.Config, profile *config.Profile) (net.Listener, error) {
+	address := muxMetricsListen
+	if address == "" {
+		address = profile.MetricsListen
+	}
+	shared := address == ""
+	if shared {
+		address = cfg.Settings.Metrics.Listen
+	}
+	if address == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil && shared {
+		ui.PrintWarning("Not serving metrics: %v (set metrics_listen on the profile, or use --metrics-listen, for an address of its own)", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve metrics: %w", err)
+	}
+
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		ui.PrintWarning("Metrics on %s can be scraped from other hosts, without authentication", addr)
+	}
+	return listener, nil
+}
+
+// startMuxBackground runs 'klip mux start' again as a detached process and
+// relays its output, including any password prompts, until the mux is up.
+// Returns the exit code.
+func startMuxBackground(profile string) int {
+	self, err := os.Executable()
+	if err != nil {
+		ui.PrintError("Failed to start mux: %v", err)
+		return 1
+	}
+
+	output, outputWriter, err := os.Pipe()
+	if err != nil {
+		ui.PrintError("Failed to start mux: %v", err)
+		return 1
+	}
+
+	child := exec.Command(self, os.Args[1:]...)
+	child.Env = append(os.Environ(), muxBackgroundEnv+"=1")
+	child.Stdin = os.Stdin
+	child.Stdout = outputWriter
+	child.Stderr = outputWriter
+	child.SysProcAttr = detachedProcAttr()
+	if err := child.Start(); err != nil {
+		ui.PrintError("Failed to start mux: %v", err)
+		return 1
+	}
+	outputWriter.Close()
+
+	// The mux closes its output once it is serving, or exits on failure
+	io.Copy(os.Stdout, output)
+	output.Close()
+
+	if client, _ := cli.DialMux(profile, ""); client != nil {
+		client.Close()
+		child.Process.Release()
+		return 0
+	}
+	if err := child.Wait(); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// detachOutput closes the output pipe to the 'klip mux start -f' process
+// waiting for the mux to come up, which lets it exit. Output goes to the
+// null device from then on; it is reopened twice so that it takes over
+// the standard output and error descriptors.
+func detachOutput() {
+	os.Stdout.Close()
+	os.Stderr.Close()
+	if stdout, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stdout = stdout
+	}
+	if stderr, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		os.Stderr = stderr
+	}
+}
+
+func runMuxStop(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := ssh.StopMux(ctx, ssh.MuxSocketPath(args[0])); err != nil {
+		ui.PrintError("No mux running for %s: %v", args[0], err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Stopped mux for %s", args[0])
+}
+
+func runMuxStatus(cmd *cobra.Command, args []string) {
+	sockets, _ := filepath.Glob(filepath.Join(filepath.Dir(ssh.MuxSocketPath("")), "mux-*.sock"))
+
+	var rows [][]string
+	for _, socketPath := range sockets {
+		profile := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(socketPath), "mux-"), ".sock")
+		client, info := cli.DialMux(profile, "")
+		if client == nil {
+			rows = append(rows, []string{profile, "-", "-", "-", "not responding"})
+			continue
+		}
+		client.Close()
+
+		rows = append(rows, []string{
+			info.Profile,
+			info.Backend,
+			info.ResolvedHost,
+			strconv.Itoa(info.PID),
+			"up " + time.Since(info.Started).Round(time.Second).String(),
+		})
+	}
+
+	if len(rows) == 0 {
+		ui.PrintInfo("No muxes running")
+		return
+	}
+	ui.PrintTable([]string{"Profile", "Backend", "Host", "PID", "Status"}, rows)
+}
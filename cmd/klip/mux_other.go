@@ -0,0 +1,13 @@
+//go:build !unix
+
+// klip - Connection multiplexing where Unix sockets are unavailable
+// Copyright (c) 2025 orpheus497
+package main
+
+import "syscall"
+
+// detachedProcAttr returns nil; background processes already outlive the
+// console that started them
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+// klip - Connection multiplexing on Unix
+// Copyright (c) 2025 orpheus497
+package main
+
+import "syscall"
+
+// detachedProcAttr starts the background mux in its own session, so it
+// outlives the terminal and does not receive its signals
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
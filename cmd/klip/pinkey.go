@@ -0,0 +1,117 @@
+// klip - Host key pinning
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func pinKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pin-key <profile>",
+		Short: "Pin the host key fingerprint of a profile",
+		Long: `Reads the key the profile's host presents, through its backend and jump
+hosts, and stores its SHA256 fingerprint as the profile's
+host_key_fingerprint. Connections with the profile then accept only that
+key, whatever known_hosts contains. Compare the fingerprint shown with the
+one the host's administrator gives you before confirming; for a host
+certificate, the key it certifies is pinned.`,
+		Example: `  klip profile pin-key myserver
+  klip profile pin-key myserver --yes`,
+		Args: cobra.ExactArgs(1),
+		Run:  runProfilePinKey,
+	}
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	return cmd
+}
+
+func runProfilePinKey(cmd *cobra.Command, args []string) {
+	name := args[0]
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: name,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		NoMux:       true,
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	key, err := helper.ScanHostKey(ctx, timeout)
+	if err != nil {
+		ui.PrintError("Failed to read the host key of %s: %v", helper.Profile.RemoteHost, err)
+		os.Exit(1)
+	}
+	if cert, ok := key.(*gossh.Certificate); ok {
+		key = cert.Key
+	}
+	fingerprint := gossh.FingerprintSHA256(key)
+
+	ui.PrintKeyValue("Host", helper.Host)
+	ui.PrintKeyValue("Address", helper.ResolvedHost)
+	ui.PrintKeyValue("Key", key.Type())
+	ui.PrintKeyValue("Fingerprint", fingerprint)
+
+	// A different key in known_hosts means either the pin or the entry is
+	// wrong; the pin takes precedence once stored
+	address := net.JoinHostPort(helper.ResolvedHost, strconv.Itoa(helper.Profile.SSHPort))
+	if types, _ := ssh.KnownHostKeyTypes(helper.KnownHostsPath, helper.ResolvedHost, helper.Profile.SSHPort); len(types) > 0 {
+		if err := ssh.VerifyHostKey(helper.KnownHostsPath, address, key); err != nil {
+			ui.PrintWarning("known_hosts records a different key for %s; make sure this fingerprint is the host's before pinning it", address)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	profile, err := cfg.GetProfile(name)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	if pinned, err := config.NormalizeFingerprint(profile.HostKeyFingerprint); err == nil && pinned == fingerprint {
+		ui.PrintInfo("Profile '%s' already pins this key", name)
+		return
+	}
+	prompt := "Pin this key for profile '%s'?"
+	if profile.HostKeyFingerprint != "" {
+		ui.PrintWarning("Profile '%s' pins a different key: %s", name, profile.HostKeyFingerprint)
+		prompt = "Replace the pinned key of profile '%s'?"
+	}
+	confirmed, err := ui.ConfirmDestructive(ui.Destructive, prompt, name)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if !confirmed {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+
+	profile.HostKeyFingerprint = fingerprint
+	if err := cfg.Save(); err != nil {
+		ui.PrintError("Failed to save configuration: %v", err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Pinned %s for profile '%s'", fingerprint, name)
+}
@@ -0,0 +1,114 @@
+// klip - Reboot and reconnect
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// rebootCommand reboots the remote host, via passwordless sudo when not
+// root. The reboot is detached and delayed so the command returns cleanly.
+const rebootCommand = `if [ "$(id -u)" -ne 0 ]; then sudo -n true || exit 1; s="sudo -n"; fi; ` +
+	`nohup $s sh -c 'sleep 1; reboot' >/dev/null 2>&1 &`
+
+var noAttach bool
+
+func rebootCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reboot <profile>",
+		Short: "Reboot a remote machine and reconnect once it is back",
+		Long: `Reboots the remote host, waits for it to go down and come back up
+(through the backend and its SSH server), then opens an interactive session.
+
+Non-root users need passwordless sudo for reboot on the remote host.`,
+		Args: cobra.ExactArgs(1),
+		Run:  runReboot,
+	}
+
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cmd.Flags().DurationVar(&cli.WaitFor, "for", cli.DefaultWaitFor, "How long to wait for the host to go down and come back")
+	cmd.Flags().BoolVar(&noAttach, "no-attach", false, "Do not open a session once the host is back")
+
+	return cmd
+}
+
+func runReboot(cmd *cobra.Command, args []string) {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: args[0],
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpReboot,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(1)
+	}
+
+	profile := helper.Profile
+	ok, err := ui.ConfirmDestructive(ui.Destructive, "Reboot %s (%s@%s)?", profile.Name, profile.RemoteUser, profile.RemoteHost)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if !ok {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+
+	client, err := helper.CreateSSHClient(context.Background(), timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	_, err = client.RunCommand(ctx, rebootCommand)
+	cancel()
+	client.Close()
+	if err != nil {
+		ui.PrintError("Failed to issue reboot (is passwordless sudo configured?): %v", err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Reboot issued on %s", profile.RemoteHost)
+
+	if err := cli.WaitForHostDown(context.Background(), helper.Backend, profile.RemoteHost, profile.SSHPort, cli.WaitFor); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	ui.PrintInfo("Host %s is down", profile.RemoteHost)
+
+	if err := helper.WaitForHost(context.Background(), cli.WaitFor); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Host %s is up", profile.RemoteHost)
+
+	if noAttach {
+		return
+	}
+
+	client, err = helper.CreateSSHClient(context.Background(), timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	ui.PrintSuccess("Connected to %s@%s", profile.RemoteUser, helper.ResolvedHost)
+
+	if err := client.InteractiveShell(); err != nil {
+		ui.PrintError("Shell error: %v", err)
+		os.Exit(1)
+	}
+}
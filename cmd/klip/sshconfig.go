@@ -0,0 +1,329 @@
+// klip - Export profiles to ~/.ssh/config
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// sshConfigInclude is where --include writes the entries, relative to ~/.ssh
+const sshConfigInclude = "config.d/klip"
+
+// sshConfigIncludeHeader starts the file --include writes
+const sshConfigIncludeHeader = "# Written by klip profile export-ssh-config; changes are overwritten\n\n"
+
+var (
+	sshConfigFile    string
+	sshConfigUseInc  bool
+	sshConfigResolve bool
+	sshConfigStdout  bool
+)
+
+func exportSSHConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export-ssh-config [profile|pattern]...",
+		Short: "Write Host entries for profiles to ~/.ssh/config",
+		Long: `Writes an ssh_config Host entry for each profile (all profiles unless
+names or patterns are given) into a block of ~/.ssh/config that klip
+manages, so plain ssh, scp and rsync reach the same hosts as klip with
+'ssh <profile>'. Running it again replaces the block; the rest of the file
+is left alone. With names or patterns only the entries of those profiles
+are replaced, and the other entries of the block are kept.
+
+ssh does not apply klip's access rules: profiles whose rules deny connect
+for your roles are not exported, and entries of profiles restricting other
+operations carry a comment naming them.
+
+Entries use the profile's user, port, key, jump hosts and klip's
+known_hosts. With --resolve, hosts reached over a VPN backend are written
+with the address the backend currently resolves them to, which stays the
+same as long as the peer keeps its VPN address; LAN hosts keep their name.
+
+With --include the entries go to ~/.ssh/config.d/klip instead, and the
+managed block in ~/.ssh/config only includes that file.`,
+		Example: `  klip profile export-ssh-config
+  klip profile export-ssh-config 'web*' --resolve
+  klip profile export-ssh-config --include
+  klip profile export-ssh-config --stdout`,
+		Run: runExportSSHConfig,
+	}
+	cmd.Flags().StringVar(&sshConfigFile, "file", "", "ssh_config file to update (default: ~/.ssh/config)")
+	cmd.Flags().BoolVar(&sshConfigUseInc, "include", false, "Write the entries to ~/.ssh/config.d/klip and include it")
+	cmd.Flags().BoolVar(&sshConfigResolve, "resolve", false, "Use the addresses VPN backends resolve hosts to")
+	cmd.Flags().BoolVar(&sshConfigStdout, "stdout", false, "Print the entries instead of writing them")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	return cmd
+}
+
+func runExportSSHConfig(cmd *cobra.Command, args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	names := cfg.ListProfiles()
+	if len(args) > 0 {
+		if names, err = cfg.MatchProfiles(args); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+	}
+
+	var entries []string
+	byAlias := make(map[string]string)
+	for _, name := range names {
+		host, err := sshConfigHost(cfg, name)
+		if errors.Is(err, errSSHConfigDenied) {
+			ui.PrintWarning("Profile '%s': not exported: %v", name, err)
+			// An entry exported before the rules changed is removed
+			byAlias[name] = ""
+			continue
+		}
+		if err != nil {
+			ui.PrintError("Profile '%s': %v", name, err)
+			os.Exit(1)
+		}
+		entries = append(entries, host.String())
+		byAlias[name] = host.String()
+	}
+	block := strings.Join(entries, "\n")
+
+	if sshConfigStdout {
+		fmt.Print(block)
+		return
+	}
+
+	sshDir, err := sshConfigDir()
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	path := sshConfigFile
+	if path == "" {
+		path = filepath.Join(sshDir, "config")
+	}
+
+	includePath := filepath.Join(sshDir, sshConfigInclude)
+	if len(args) > 0 {
+		// Only the named profiles' entries change
+		block = config.MergeSSHConfigBlock(exportedSSHConfig(path, includePath), names, byAlias)
+	}
+
+	if sshConfigUseInc {
+		if err := writeSSHConfig(includePath, sshConfigIncludeHeader+block); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		// Include must come before any Host entry to apply to every host
+		if err := updateSSHConfig(path, "Include "+includePath+"\n", true); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Wrote %d profile(s) to %s, included from %s", len(entries), includePath, path)
+		return
+	}
+
+	if err := updateSSHConfig(path, block, false); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Wrote %d profile(s) to %s", len(entries), path)
+}
+
+// errSSHConfigDenied is returned for profiles whose access rules deny
+// connecting, which are not exported
+var errSSHConfigDenied = errors.New("connecting is disabled by the profile's access rules")
+
+// sshConfigAccess checks a profile's access rules for settings.roles
+// before it is exported. ssh does not apply them, so a profile denying
+// connect is not exported, and the operations restricted otherwise are
+// returned to be noted on the entry.
+func sshConfigAccess(cfg *config.Config, profile *config.Profile) ([]string, error) {
+	if profile.AccessFor(cfg.Settings.Roles, config.OpConnect) == config.AccessDenied {
+		return nil, errSSHConfigDenied
+	}
+	var restricted []string
+	for _, op := range config.Operations {
+		if profile.AccessFor(cfg.Settings.Roles, op) != config.AccessAllowed {
+			restricted = append(restricted, op)
+		}
+	}
+	return restricted, nil
+}
+
+// sshConfigHost returns the ssh_config entry for a profile, with klip's
+// known_hosts and the trust domain's keys, and with --resolve the
+// addresses VPN backends resolve the host and jump hosts to
+func sshConfigHost(cfg *config.Config, name string) (config.SSHConfigHost, error) {
+	profile, err := cfg.GetProfile(name)
+	if err != nil {
+		return config.SSHConfigHost{}, err
+	}
+	restricted, err := sshConfigAccess(cfg, profile)
+	if err != nil {
+		return config.SSHConfigHost{}, err
+	}
+	host := profile.SSHConfigHost()
+	if len(restricted) > 0 {
+		host.Notes = append(host.Notes, fmt.Sprintf("klip access rules restrict %s; ssh does not apply them", strings.Join(restricted, ", ")))
+	}
+
+	knownHosts, keyDir, err := cli.TrustDomain(cfg, profile)
+	if err != nil {
+		return host, err
+	}
+	if knownHosts == "" {
+		if knownHosts, err = ssh.GetKnownHostsPath(""); err != nil {
+			return host, err
+		}
+	}
+	host.UserKnownHostsFile = knownHosts
+	if profile.HostKeyFingerprint != "" {
+		// ssh trusts only the pinned key, as klip does
+		pinned, err := ssh.PinnedKnownHostsPath(name)
+		if err != nil {
+			return host, err
+		}
+		if err := ssh.WritePinnedKnownHosts(knownHosts, profile.HostKeyFingerprint, pinned); err != nil {
+			return host, err
+		}
+		host.UserKnownHostsFile, host.GlobalKnownHostsFile = pinned, os.DevNull
+	}
+	if (keyDir != "" || len(cfg.Settings.DefaultKeys) > 0) && len(host.IdentityFiles) == 0 && !profile.UsePassword && profile.PKCS11Provider == "" {
+		host.IdentityFiles = ssh.DefaultKeyPaths(keyDir, cfg.Settings.DefaultKeys)
+	}
+
+	if sshConfigResolve {
+		resolveSSHConfigHost(&host, name)
+	}
+	return host, nil
+}
+
+// resolveSSHConfigHost replaces the host and jump host names in host with
+// the addresses the profile's backend resolves them to, unless the backend
+// is the LAN, whose addresses come from DHCP and DNS and may change
+func resolveSSHConfigHost(host *config.SSHConfigHost, name string) {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: name,
+		Verbose:     verbose,
+		NoMux:       true,
+	})
+	if err != nil {
+		ui.PrintWarning("Profile '%s': not resolved: %v", name, err)
+		return
+	}
+	if helper.Backend.Name() == string(config.BackendLAN) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chain := helper.Profile.JumpChain()
+	if len(chain) == 0 {
+		resolved, err := helper.GetResolvedHost(ctx)
+		if err != nil {
+			ui.PrintWarning("Profile '%s': not resolved: %v", name, err)
+			return
+		}
+		host.HostName = resolved
+		return
+	}
+
+	// With jump hosts the remote host is resolved by the last hop
+	addrs, err := cli.ResolveJumpChain(ctx, helper.Backend, helper.Profile)
+	if err != nil {
+		ui.PrintWarning("Profile '%s': jump hosts not resolved: %v", name, err)
+		return
+	}
+	specs := make([]string, len(chain))
+	for i, hop := range chain {
+		hop.Host = addrs[i]
+		specs[i] = hop.Spec(helper.Profile)
+	}
+	host.ProxyJump = strings.Join(specs, ",")
+}
+
+// exportedSSHConfig returns the entries written by an earlier export: those
+// of the file --include writes at includePath with --include, unless there
+// is none yet, or else those of the managed block of the ssh_config file
+// at path
+func exportedSSHConfig(path, includePath string) string {
+	if sshConfigUseInc {
+		if content, err := os.ReadFile(includePath); err == nil {
+			return strings.TrimPrefix(string(content), sshConfigIncludeHeader)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return config.SSHConfigBlock(string(content))
+}
+
+// sshConfigDir returns ~/.ssh
+func sshConfigDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh"), nil
+}
+
+// updateSSHConfig replaces the klip managed block of the ssh_config file at
+// path with block, creating the file if needed
+func updateSSHConfig(path, block string, atTop bool) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return writeSSHConfig(path, config.ReplaceSSHConfigBlock(string(content), block, atTop))
+}
+
+// writeSSHConfig writes an ssh_config file through a temporary file and a
+// rename, so ssh never reads it half-written, keeping the file's mode; a
+// symlinked file is replaced at its target
+func writeSSHConfig(path, content string) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".klip-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
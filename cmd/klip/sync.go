@@ -0,0 +1,304 @@
+// klip - Bidirectional directory synchronization
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/pkg/sftp"
+	"github.com/spf13/cobra"
+)
+
+// DefaultSyncInterval is how often klip sync --watch and --monitor compare
+// both sides
+const DefaultSyncInterval = 10 * time.Second
+
+var (
+	syncWatch    bool
+	syncMonitor  bool
+	syncInterval time.Duration
+	syncChecksum bool
+	syncDryRun   bool
+	syncExcludes []string
+	syncIncludes []string
+)
+
+func syncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync <profile> <local-dir> <remote-dir>",
+		Short: "Synchronize a local and a remote directory in both directions",
+		Long: `Compares a local and a remote directory with their state after the last
+sync and transfers only the differences, in both directions: files changed
+on one side are copied to the other, and files deleted on one side are
+deleted on the other. Files changed on both sides are conflicts, resolved
+interactively or with --prefer. With --watch, both sides are compared again
+every --interval until interrupted. --monitor compares them every --interval
+without changing either, reporting and auditing each time they start or
+stop differing.`,
+		Args: cobra.ExactArgs(3),
+		Run:  runSync,
+	}
+
+	cmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cmd.Flags().BoolVarP(&syncWatch, "watch", "w", false, "Keep synchronizing until interrupted")
+	cmd.Flags().BoolVar(&syncMonitor, "monitor", false, "Keep comparing both sides without changing them, reporting when they diverge")
+	cmd.Flags().DurationVar(&syncInterval, "interval", DefaultSyncInterval, "Time between comparisons with --watch or --monitor")
+	cmd.Flags().BoolVar(&syncChecksum, "checksum", false, "Compare SHA-256 of files whose modification time changed, ignoring touched files")
+	cmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Show what would be synchronized without changing either side")
+	cmd.Flags().StringArrayVar(&syncExcludes, "exclude", nil, "Skip files matching this pattern (rsync --exclude syntax, repeatable)")
+	cmd.Flags().StringArrayVar(&syncIncludes, "include", nil, "Only synchronize files matching this pattern (rsync --include syntax, repeatable)")
+	cli.AddConflictFlags(cmd)
+	cmd.MarkFlagsMutuallyExclusive("watch", "dry-run", "monitor")
+
+	return cmd
+}
+
+func runSync(cmd *cobra.Command, args []string) {
+	localDir, err := filepath.Abs(args[1])
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	remoteDir := args[2]
+	if syncInterval <= 0 {
+		ui.PrintError("--interval must be positive")
+		os.Exit(1)
+	}
+
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: args[0],
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpSync,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
+		os.Exit(1)
+	}
+
+	state, err := transfer.LoadSyncState(helper.Profile.Name, localDir, remoteDir)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client, err := helper.CreateSSHClient(ctx, timeout)
+	if err != nil {
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+	if (syncWatch || syncMonitor) && cli.KeepAlive > 0 {
+		go client.KeepAlive(ctx, cli.KeepAlive, cli.KeepAliveMax)
+	}
+
+	resolver, err := cli.ConflictResolver(helper.Profile, helper.Backend.Name(), conflictReader(client, localDir, remoteDir))
+	if err != nil {
+		ui.PrintError("%v", err)
+		client.Close()
+		os.Exit(1)
+	}
+
+	opts := helper.Profile.TransferOptions
+	limits := &transfer.TransferConfig{MaxFiles: opts.MaxFiles, MaxTotalSize: opts.MaxTotalSizeBytes()}
+	syncer, err := transfer.NewSyncer(&transfer.SyncConfig{
+		SSHClient:       client,
+		LocalDir:        localDir,
+		RemoteDir:       remoteDir,
+		ExcludePatterns: append(opts.Excludes(), syncExcludes...),
+		IncludePatterns: append(opts.IncludePatterns, syncIncludes...),
+		Checksum:        syncChecksum,
+		DryRun:          syncDryRun || syncMonitor,
+		Resolver:        resolver,
+		State:           state,
+		Chmod:           opts.Chmod,
+		Chown:           opts.Chown,
+		BandwidthLimit:  opts.BandwidthLimit,
+		ApprovePush: func(ctx context.Context, files []string) bool {
+			return helper.ScanUploadFiles(ctx, localDir, files) && cli.ConfirmFileLimits(limits, files)
+		},
+		ConfirmDeleteAll: confirmDeleteAll,
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		client.Close()
+		os.Exit(1)
+	}
+	auditLogger, _ := logger.NewAuditLogger(true)
+	if auditLogger != nil {
+		defer auditLogger.Close()
+	}
+
+	if syncMonitor {
+		monitorSync(ctx, syncer, client, helper, auditLogger, localDir, remoteDir)
+		return
+	}
+	if !ui.JSONOutput() {
+		syncer.SetProgressCallback(cli.PrintProgress)
+	}
+
+	if syncWatch {
+		ui.PrintInfo("Watching %s and %s:%s every %s, press Ctrl-C to stop", localDir, helper.Profile.Name, remoteDir, syncInterval)
+	}
+	for {
+		result, err := syncer.Sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		status := "success"
+		switch {
+		case syncDryRun:
+			status = "dry_run"
+		case err != nil:
+			status = "failed"
+		}
+		if auditLogger != nil && (err != nil || result.Changes() > 0) {
+			_ = auditLogger.LogTransfer(helper.Profile.Name, helper.Profile.RemoteUser, helper.Profile.RemoteHost,
+				helper.Backend.Name(), "sync", localDir, remoteDir, status, err)
+		}
+
+		if err != nil {
+			ui.PrintError("Sync failed: %v", err)
+			if !syncWatch || !client.IsConnected() {
+				client.Close()
+				os.Exit(1)
+			}
+		} else if !syncWatch || result.Changes() > 0 || len(result.Conflicts) > 0 {
+			printSyncResult(result)
+		}
+
+		if !syncWatch {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(syncInterval):
+		}
+	}
+}
+
+// monitorSync compares both sides every syncInterval without changing
+// either until interrupted. Each time the set of differing files changes,
+// it is printed and recorded in the audit log as a sync_divergence event,
+// which audit sinks forward as notifications.
+func monitorSync(ctx context.Context, syncer *transfer.Syncer, client *ssh.Client, helper *cli.ConnectionHelper, auditLogger *logger.AuditLogger, localDir, remoteDir string) {
+	profile := helper.Profile
+	ui.PrintInfo("Monitoring %s and %s:%s every %s, press Ctrl-C to stop", localDir, profile.Name, remoteDir, syncInterval)
+
+	last := ""
+	for first := true; ; first = false {
+		result, err := syncer.Sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			ui.PrintError("Comparison failed: %v", err)
+			if !client.IsConnected() {
+				client.Close()
+				os.Exit(1)
+			}
+		} else if diverged := result.Diverged(); first || strings.Join(diverged, "\n") != last {
+			last = strings.Join(diverged, "\n")
+			if auditLogger != nil {
+				_ = auditLogger.LogDivergence(profile.Name, profile.RemoteUser, profile.RemoteHost,
+					helper.Backend.Name(), localDir, remoteDir, len(diverged))
+			}
+			_ = ui.Render(result, func() {
+				if len(diverged) == 0 {
+					ui.PrintSuccess("In sync")
+					return
+				}
+				ui.PrintWarning("Diverged: %d files would be pushed, %d pulled, %d deleted locally and %d remotely, %d conflict",
+					len(result.Pushed), len(result.Pulled), len(result.DeletedLocal), len(result.DeletedRemote),
+					len(result.Conflicts)+len(result.Unresolved))
+				ui.PrintList(diverged)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(syncInterval):
+		}
+	}
+}
+
+// printSyncResult summarizes a sync pass
+func printSyncResult(result *transfer.SyncResult) {
+	_ = ui.Render(result, func() {
+		switch {
+		case syncDryRun:
+			ui.PrintSuccess("Dry run: would push %d, pull %d, delete %d local and %d remote files",
+				len(result.Pushed), len(result.Pulled), len(result.DeletedLocal), len(result.DeletedRemote))
+		case result.Changes() == 0:
+			ui.PrintSuccess("Already in sync")
+		default:
+			ui.PrintSuccess("Synchronized: pushed %d, pulled %d, deleted %d local and %d remote files",
+				len(result.Pushed), len(result.Pulled), len(result.DeletedLocal), len(result.DeletedRemote))
+		}
+		if len(result.Unresolved) > 0 {
+			ui.PrintWarning("%d conflicts left unresolved", len(result.Unresolved))
+			ui.PrintList(result.Unresolved)
+		}
+	})
+}
+
+// conflictReader reads both versions of a file in conflict for the
+// resolver's diff, refusing files over transfer.DefaultReadLimit
+func conflictReader(client *ssh.Client, localDir, remoteDir string) cli.ConflictReader {
+	return func(c transfer.Conflict) ([]byte, []byte, error) {
+		sftpClient, err := sftp.NewClient(client.GetClient())
+		if err != nil {
+			return nil, nil, err
+		}
+		defer sftpClient.Close()
+
+		remote, err := transfer.ReadRemoteFile(sftpClient, path.Join(remoteDir, c.Path), transfer.DefaultReadLimit)
+		if err != nil {
+			return nil, nil, err
+		}
+		local, err := os.ReadFile(filepath.Join(localDir, filepath.FromSlash(c.Path)))
+		if err != nil {
+			return nil, nil, err
+		}
+		return local, remote, nil
+	}
+}
+
+// confirmDeleteAll asks before a sync pass deletes every file on one side
+// because the other side is empty, honoring --yes/--force
+func confirmDeleteAll(side string, files int) bool {
+	other := "remote"
+	if side == "remote" {
+		other = "local"
+	}
+	ui.PrintWarning("The %s directory is empty, but %d files were synchronized before", side, files)
+	confirmed, err := ui.ConfirmDestructive(ui.Irreversible, "Delete all %d files on the %s side?", files, other)
+	if err != nil {
+		ui.PrintError("%v", err)
+		return false
+	}
+	return confirmed
+}
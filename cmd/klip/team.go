@@ -0,0 +1,318 @@
+// klip - Shared team profile bundles
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// teamTimeout bounds fetching a bundle and its signature
+const teamTimeout = 30 * time.Second
+
+var (
+	teamName string
+	teamKeys []string
+)
+
+func teamCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "team",
+		Short: "Share profiles through signed team bundles",
+		Long: `A team bundle is a YAML file of profiles published by a team, signed with
+minisign. klip verifies the signature against the team's trusted public
+keys and merges the profiles into the local configuration as
+<team>.<profile>, replacing them on every refresh.`,
+	}
+
+	pullCmd := &cobra.Command{
+		Use:   "pull <url>",
+		Short: "Fetch, verify and merge a team bundle",
+		Long: `Fetches the bundle at an http(s) URL or local path and its signature from
+<url>.minisig, verifies the signature against the --key public keys (or
+the keys already trusted for the team) and merges its profiles. The team
+is named by --name, or by the bundle's 'team' field.`,
+		Example: `  klip team pull https://infra.example.com/klip/ops.yaml --key RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3
+  klip team pull ./ops.yaml --name ops --key ops.pub`,
+		Args: cobra.ExactArgs(1),
+		Run:  runTeamPull,
+	}
+	pullCmd.Flags().StringVar(&teamName, "name", "", "Name of the team, prefixed to its profiles")
+	pullCmd.Flags().StringArrayVar(&teamKeys, "key", nil, "minisign public key or .pub file trusted to sign the bundle (repeatable)")
+
+	refreshCmd := &cobra.Command{
+		Use:   "refresh [team]...",
+		Short: "Pull the bundles of all or some teams again",
+		Run:   runTeamRefresh,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List teams and their bundles",
+		Args:  cobra.NoArgs,
+		Run:   runTeamList,
+	}
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <team>",
+		Short: "Forget a team and remove its profiles",
+		Args:  cobra.ExactArgs(1),
+		Run:   runTeamRemove,
+	}
+
+	cmd.AddCommand(pullCmd, refreshCmd, listCmd, removeCmd)
+	return cmd
+}
+
+// loadConfig loads the configuration or exits
+func loadConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		ui.PrintError("Failed to load configuration: %v", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// pullTeam fetches, verifies and merges a team's bundle. name is empty to
+// take the team's name from the bundle.
+func pullTeam(cfg *config.Config, name string, team config.Team) (string, *config.TeamMerge, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), teamTimeout)
+	defer cancel()
+
+	data, signature, err := config.FetchTeamBundle(ctx, team.URL)
+	if err != nil {
+		return name, nil, err
+	}
+	bundle, err := config.OpenTeamBundle(team, data, signature)
+	if err != nil {
+		return name, nil, err
+	}
+
+	if name == "" {
+		name = bundle.Team
+		if name == "" {
+			return name, nil, errors.New("the bundle names no team, use --name")
+		}
+
+		// A bundle only takes over a team already pulled under the name
+		// it suggests if one of that team's keys signed it
+		if existing, ok := cfg.Settings.Teams[name]; ok {
+			if _, err := config.OpenTeamBundle(existing, data, signature); err != nil {
+				return name, nil, fmt.Errorf("team '%s' already exists and none of its keys signed the bundle, use --name to pull it as another team: %w", name, err)
+			}
+			team.Keys = append(append([]string(nil), existing.Keys...), team.Keys...)
+		}
+	}
+
+	// A bundle older than the last one pulled is a rollback, however the
+	// team is pulled
+	if existing, ok := cfg.Settings.Teams[name]; ok && existing.Serial > team.Serial {
+		team.Serial = existing.Serial
+	}
+	merge, err := cfg.MergeTeam(name, team, bundle)
+	return name, merge, err
+}
+
+// printTeamMerge reports the profiles a bundle changed
+func printTeamMerge(name string, merge *config.TeamMerge) {
+	ui.PrintSuccess("Team '%s': %d added, %d updated, %d removed", name, len(merge.Added), len(merge.Updated), len(merge.Removed))
+	for _, local := range merge.Added {
+		ui.PrintInfo("  + %s", local)
+	}
+	for _, local := range merge.Removed {
+		ui.PrintInfo("  - %s", local)
+	}
+	for _, id := range merge.RevokedKeys {
+		ui.PrintWarning("Key %s was revoked by the team and is no longer trusted", id)
+	}
+}
+
+func runTeamPull(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	// Local bundles are refreshed from the same file wherever klip runs
+	bundleURL := args[0]
+	if !strings.Contains(bundleURL, "://") {
+		if abs, err := filepath.Abs(bundleURL); err == nil {
+			bundleURL = abs
+		}
+	}
+
+	team := config.Team{URL: bundleURL}
+	if existing, ok := cfg.Settings.Teams[teamName]; ok && teamName != "" {
+		team = existing
+		team.URL = bundleURL
+	}
+	for _, text := range teamKeys {
+		key, err := config.ParseMinisignKey(text)
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		team.Keys = append(team.Keys, key.String())
+	}
+	if len(team.Keys) == 0 {
+		ui.PrintError("No keys trusted to sign the bundle, use --key")
+		os.Exit(1)
+	}
+
+	name, merge, err := pullTeam(cfg, teamName, team)
+	if err != nil {
+		ui.PrintError("Failed to pull team bundle: %v", err)
+		os.Exit(1)
+	}
+	if err := cfg.Save(); err != nil {
+		ui.PrintError("Failed to save configuration: %v", err)
+		os.Exit(1)
+	}
+	if err := ui.Render(merge, func() { printTeamMerge(name, merge) }); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+func runTeamRefresh(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	names := args
+	if len(names) == 0 {
+		for name := range cfg.Settings.Teams {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		ui.PrintInfo("No teams configured, add one with 'klip team pull'")
+		return
+	}
+
+	merges := make(map[string]*config.TeamMerge)
+	failed := 0
+	for _, name := range names {
+		team, ok := cfg.Settings.Teams[name]
+		if !ok {
+			ui.PrintError("Team '%s' not found", name)
+			failed++
+			continue
+		}
+		_, merge, err := pullTeam(cfg, name, team)
+		if err != nil {
+			ui.PrintError("Failed to refresh team '%s': %v", name, err)
+			failed++
+			continue
+		}
+		merges[name] = merge
+	}
+
+	if len(merges) > 0 {
+		if err := cfg.Save(); err != nil {
+			ui.PrintError("Failed to save configuration: %v", err)
+			os.Exit(1)
+		}
+	}
+	err := ui.Render(merges, func() {
+		for _, name := range names {
+			if merge, ok := merges[name]; ok {
+				printTeamMerge(name, merge)
+			}
+		}
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// teamInfo is a team as listed by klip team list
+type teamInfo struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Serial   int64     `json:"serial"`
+	Pulled   time.Time `json:"pulled"`
+	Keys     []string  `json:"keys"`
+	Profiles []string  `json:"profiles"`
+}
+
+func runTeamList(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	// Lists are empty rather than null in JSON
+	teams := make([]teamInfo, 0, len(cfg.Settings.Teams))
+	for name, team := range cfg.Settings.Teams {
+		info := teamInfo{Name: name, URL: team.URL, Serial: team.Serial, Pulled: team.Pulled, Keys: []string{}, Profiles: cfg.TeamProfiles(name)}
+		if info.Profiles == nil {
+			info.Profiles = []string{}
+		}
+		for _, text := range team.Keys {
+			if key, err := config.ParseMinisignKey(text); err == nil {
+				info.Keys = append(info.Keys, key.IDString())
+			}
+		}
+		teams = append(teams, info)
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+
+	err := ui.Render(teams, func() {
+		if len(teams) == 0 {
+			ui.PrintInfo("No teams configured, add one with 'klip team pull'")
+			return
+		}
+		rows := make([][]string, 0, len(teams))
+		for _, team := range teams {
+			rows = append(rows, []string{
+				team.Name,
+				team.URL,
+				strconv.FormatInt(team.Serial, 10),
+				team.Pulled.Local().Format(time.DateTime),
+				strings.Join(team.Keys, ", "),
+				strconv.Itoa(len(team.Profiles)),
+			})
+		}
+		ui.PrintTable([]string{"Team", "URL", "Serial", "Pulled", "Keys", "Profiles"}, rows)
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+}
+
+func runTeamRemove(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+	name := args[0]
+
+	confirmed, err := ui.ConfirmDestructive(ui.Destructive, "Remove team '%s' and its %d profiles?", name, len(cfg.TeamProfiles(name)))
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if !confirmed {
+		ui.PrintInfo("Cancelled")
+		return
+	}
+
+	removed, err := cfg.RemoveTeam(name)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	if err := cfg.Save(); err != nil {
+		ui.PrintError("Failed to save configuration: %v", err)
+		os.Exit(1)
+	}
+	ui.PrintSuccess("Team '%s' removed with %d profiles", name, len(removed))
+}
@@ -0,0 +1,331 @@
+// klipc - Queued transfer jobs
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cache"
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// runJobs pushes the jobs listed by --jobs, or the unfinished jobs of the
+// profile's last queue with --resume-jobs, over one connection. The queue
+// is saved as jobs finish so an interrupted batch can be resumed.
+func runJobs(cmd *cobra.Command) {
+	if jobConcurrency < 1 {
+		ui.PrintError("--job-concurrency must be at least 1")
+		os.Exit(1)
+	}
+
+	var jobs []*transfer.Job
+	if jobsFile != "" {
+		var err error
+		if jobs, err = readJobs(jobsFile); err != nil {
+			ui.PrintError("Invalid --jobs: %v", err)
+			os.Exit(1)
+		}
+		for _, job := range jobs {
+			if _, err := os.Stat(job.Source); os.IsNotExist(err) {
+				ui.PrintError("Source path of job %d does not exist: %s", job.ID, job.Source)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Initialize audit logger (enabled by default for security tracking)
+	auditLogger, err := logger.NewAuditLogger(true)
+	if err != nil {
+		ui.PrintWarning("Failed to initialize audit logger: %v", err)
+		auditLogger, _ = logger.NewAuditLogger(false)
+	}
+	defer auditLogger.Close()
+
+	helper := newConnectionHelper(cmd)
+
+	queue := loadJobQueue(helper.Profile.Name, jobs)
+	pending := queue.Unfinished()
+	if len(pending) == 0 {
+		ui.PrintSuccess("All %d jobs are already done", len(queue.Jobs))
+		queue.Remove()
+		return
+	}
+
+	if dryRun {
+		ui.PrintWarning("DRY RUN - No files will be transferred")
+	}
+
+	// Scan the plaintext sources before anything leaves this machine
+	if !dryRun {
+		for _, job := range pending {
+			if !helper.ScanUpload(context.Background(), job.Source) {
+				os.Exit(1)
+			}
+		}
+	}
+
+	// Wait for the host to come up before the connect timeout starts
+	if cli.Wait {
+		if err := helper.WaitForHost(context.Background(), cli.WaitFor); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Host %s is up", helper.Profile.RemoteHost)
+	}
+
+	connectCtx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		connectCtx, cancel = context.WithTimeout(connectCtx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	client, err := helper.CreateSSHClient(connectCtx, timeout)
+	if err != nil {
+		_ = auditLogger.LogTransfer(
+			helper.Profile.Name,
+			helper.Profile.RemoteUser,
+			helper.Profile.RemoteHost,
+			helper.Backend.Name(),
+			"push",
+			jobsSource(),
+			"",
+			"failed",
+			err,
+		)
+		ui.PrintError("Connection failed: %v", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	// Inspect the remote environment (cached per profile)
+	if _, err := helper.DetectCapabilities(connectCtx, client); err != nil {
+		ui.PrintWarning("Could not detect remote environment: %v", err)
+	}
+	helper.ResolveMethod()
+
+	// New jobs are stored with absolute sources and resolved destinations,
+	// so resuming them does not depend on the working directory
+	for _, job := range jobs {
+		if job.Dest == "" {
+			job.Dest = destPath
+		}
+		if job.Dest == "" {
+			job.Dest = cli.DefaultRemoteDest(job.Source, helper.Capabilities)
+		}
+		job.Source = absSource(job.Source)
+	}
+
+	chunks := chunkCache(helper)
+	configs := make(map[int]*transfer.TransferConfig, len(pending))
+	for _, job := range pending {
+		cfg := pushConfig(helper, client, job.Source, job.Dest)
+		cfg.ChunkCache = chunks
+		cfg.ShowProgress = verbose
+		configs[job.ID] = cfg
+	}
+
+	// Confirm transfers that delete data before any job starts
+	for _, job := range pending {
+		if !cli.ConfirmTransfer(configs[job.ID]) {
+			os.Exit(1)
+		}
+		if !cli.ConfirmLimits(connectCtx, configs[job.ID]) {
+			os.Exit(1)
+		}
+	}
+
+	if err := queue.Save(); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if cli.KeepAlive > 0 {
+		go client.KeepAlive(ctx, cli.KeepAlive, cli.KeepAliveMax)
+	}
+
+	ui.PrintInfo("Running %d jobs to %s@%s, %d at a time", len(pending), helper.Profile.RemoteUser, helper.Profile.RemoteHost, jobConcurrency)
+
+	runErr := queue.Run(ctx, jobConcurrency, func(ctx context.Context, job *transfer.Job) error {
+		err := runJob(ctx, configs[job.ID])
+		if ctx.Err() != nil {
+			return err
+		}
+
+		status := "success"
+		switch {
+		case err != nil:
+			status = "failed"
+			ui.PrintError("Job %d failed: %s: %v", job.ID, job.Source, err)
+		case dryRun:
+			status = "dry_run"
+		default:
+			ui.PrintSuccess("Job %d done: %s", job.ID, job.Source)
+			helper.RecordUsage(cache.ActivityPush)
+		}
+		_ = auditLogger.LogTransfer(
+			helper.Profile.Name,
+			helper.Profile.RemoteUser,
+			helper.Profile.RemoteHost,
+			helper.Backend.Name(),
+			"push",
+			job.Source,
+			job.Dest,
+			status,
+			err,
+		)
+		return err
+	})
+	stop()
+
+	if err := ui.Render(queue, func() { printJobs(queue) }); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	resume := "klipc --resume-jobs"
+	if profileName != "" {
+		resume += " -p " + profileName
+	}
+	switch {
+	case errors.Is(runErr, context.Canceled):
+		ui.PrintWarning("Interrupted, run '%s' to finish the remaining jobs", resume)
+		os.Exit(1)
+	case runErr != nil:
+		ui.PrintError("%v", runErr)
+		if !dryRun {
+			ui.PrintInfo("Run '%s' to retry the failed jobs", resume)
+		}
+		os.Exit(1)
+	}
+	if err := queue.Remove(); err != nil {
+		ui.PrintWarning("%v", err)
+	}
+}
+
+// readJobs parses the jobs listed in path, or on stdin for "-"
+func readJobs(path string) ([]*transfer.Job, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return transfer.ParseJobs(r)
+}
+
+// loadJobQueue returns a new queue of jobs for the profile, or its saved
+// queue when jobs is nil (--resume-jobs). Dry runs are never saved.
+func loadJobQueue(profile string, jobs []*transfer.Job) *transfer.JobQueue {
+	if jobs == nil {
+		queue, err := transfer.LoadJobQueue(profile)
+		if errors.Is(err, transfer.ErrNoJobQueue) {
+			ui.PrintError("No interrupted jobs for profile '%s'", profile)
+			os.Exit(1)
+		}
+		if err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		return queue
+	}
+
+	if dryRun {
+		return &transfer.JobQueue{Profile: profile, Created: time.Now(), Jobs: jobs}
+	}
+
+	// A new batch replaces the saved queue, so ask before dropping jobs
+	// that --resume-jobs could still finish
+	if old, err := transfer.LoadJobQueue(profile); err == nil {
+		if unfinished := len(old.Unfinished()); unfinished > 0 {
+			ok, err := ui.ConfirmDestructive(ui.Destructive, "Discard %d unfinished jobs queued %s for profile '%s'? Run 'klipc --resume-jobs -p %s' to finish them instead", unfinished, old.Created.Format(time.DateTime), profile, profile)
+			if err != nil {
+				ui.PrintError("%v", err)
+				os.Exit(1)
+			}
+			if !ok {
+				ui.PrintInfo("Cancelled")
+				os.Exit(0)
+			}
+		}
+	}
+	queue, err := transfer.NewJobQueue(profile, jobs)
+	if err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+	return queue
+}
+
+// runJob runs the transfer of one job
+func runJob(ctx context.Context, cfg *transfer.TransferConfig) error {
+	if _, err := os.Stat(strings.TrimSuffix(cfg.SourcePath, "/")); err != nil {
+		return fmt.Errorf("source path does not exist: %s", cfg.SourcePath)
+	}
+
+	xfer, err := transfer.NewTransfer(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create transfer: %w", err)
+	}
+	if verbose || dryRun {
+		xfer.SetProgressCallback(cli.PrintProgress)
+	}
+	return xfer.Execute(ctx)
+}
+
+// absSource makes a source path absolute, keeping a trailing slash
+func absSource(source string) string {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return source
+	}
+	if strings.HasSuffix(source, "/") && !strings.HasSuffix(abs, "/") {
+		abs += "/"
+	}
+	return abs
+}
+
+// jobsSource describes the source of a batch in the audit log
+func jobsSource() string {
+	if jobsFile != "" {
+		return "jobs:" + jobsFile
+	}
+	return "jobs:resumed"
+}
+
+// printJobs prints the jobs summary table
+func printJobs(queue *transfer.JobQueue) {
+	counts := map[transfer.JobStatus]int{}
+	var rows [][]string
+	for _, job := range queue.Jobs {
+		counts[job.Status]++
+		elapsed := "-"
+		if job.Seconds > 0 {
+			elapsed = time.Duration(job.Seconds * float64(time.Second)).Round(time.Millisecond).String()
+		}
+		rows = append(rows, []string{strconv.Itoa(job.ID), job.Source, job.Dest, string(job.Status), elapsed, job.Error})
+	}
+
+	ui.PrintSubHeader("Jobs")
+	ui.PrintTable([]string{"#", "Source", "Destination", "Status", "Time", "Error"}, rows)
+	ui.PrintEmptyLine()
+	ui.PrintInfo("%d done, %d failed, %d pending", counts[transfer.JobDone], counts[transfer.JobFailed], counts[transfer.JobPending])
+}
@@ -6,10 +6,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/orpheus497/klip/internal/cache"
 	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
 	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
 	"github.com/orpheus497/klip/internal/transfer"
 	"github.com/orpheus497/klip/internal/ui"
 	"github.com/orpheus497/klip/internal/version"
@@ -25,9 +29,56 @@ var (
 	dryRun           bool
 	verbose          bool
 	timeout          int
+	copyContents     bool
+	copyInto         bool
+	encryptSpec      string
+	multipath        bool
+	sparse           bool
+	noResume         bool
+	verifyResume     bool
+	verifyChecksums  bool
+	concurrency      int
+	segments         int
+	dedup            bool
+	excludes         []string
+	includes         []string
+	noAtomic         bool
+	lowMemory        bool
+	watch            bool
+	watchDebounce    time.Duration
+	jobsFile         string
+	resumeJobs       bool
+	jobConcurrency   int
 )
 
+// cleanups remove temporary state, such as the staging directory of
+// encrypted uploads, before klipc exits; os.Exit skips deferred calls, so
+// exit runs them
+var cleanups []func()
+
+// exit runs the cleanups and exits with code
+func exit(code int) {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	os.Exit(code)
+}
+
 func main() {
+	// rsync re-invokes this binary as its remote shell for native transfers
+	if transfer.IsRsyncProxyInvocation() {
+		os.Exit(transfer.RunRsyncProxy())
+	}
+
+	cli.InitUI()
+
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the klipc command
+func newRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "klipc <source> [destination]",
 		Short: "Copy files to remote machines",
@@ -35,18 +86,61 @@ func main() {
 with support for multiple VPN backends.
 
 Created by orpheus497.`,
-		Args: cobra.MinimumNArgs(1),
-		Run:  runCopy,
+		Args: func(cmd *cobra.Command, args []string) error {
+			// Jobs name their own sources and destinations
+			if jobsFile != "" || resumeJobs {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		Run: runCopy,
 	}
 
 	rootCmd.Flags().StringVarP(&profileName, "profile", "p", "", "Connection profile to use")
-	rootCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird)")
+	rootCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
 	rootCmd.Flags().StringVarP(&destPath, "dest", "d", "", "Destination path on remote (defaults to same as source)")
-	rootCmd.Flags().StringVarP(&method, "method", "m", "rsync", "Transfer method (rsync, sftp)")
+	rootCmd.Flags().StringVarP(&method, "method", "m", "rsync", "Transfer method (rsync, sftp, delta, scp)")
 	rootCmd.Flags().IntVarP(&compressionLevel, "compress", "z", 6, "Compression level (0-9, 0=disabled)")
+	rootCmd.Flags().BoolVar(&copyContents, "contents", false, "Copy the contents of a source directory (like a trailing slash)")
+	rootCmd.Flags().BoolVar(&copyInto, "into", false, "Copy a source directory itself into the destination")
+	rootCmd.MarkFlagsMutuallyExclusive("contents", "into")
+	rootCmd.Flags().StringVar(&encryptSpec, "encrypt", "", "Encrypt files before upload (age:<recipients-file>, gpg[:<recipient>])")
+	rootCmd.Flags().BoolVar(&multipath, "multipath", false, "Stripe single-file transfers across all connected backends that reach the host")
+	rootCmd.Flags().IntVar(&segments, "segments", 0, "Split single files of 32 MiB or more into this many concurrent SFTP streams")
+	rootCmd.Flags().BoolVar(&dedup, "dedup", false, "Copy chunks of large files already pushed to the host there instead of sending them again")
+	rootCmd.Flags().BoolVar(&noAtomic, "no-atomic", false, "Write files in place instead of uploading to a temporary name and renaming")
+	rootCmd.Flags().BoolVar(&sparse, "sparse", false, "Leave runs of zeros as holes at the destination (VM images, preallocated files)")
+	rootCmd.Flags().BoolVar(&noResume, "no-resume", false, "Restart interrupted files from zero instead of continuing partial files")
+	rootCmd.Flags().BoolVar(&verifyResume, "verify-resume", false, "Compare checksums of partial files with the source before continuing them")
+	rootCmd.MarkFlagsMutuallyExclusive("no-resume", "verify-resume")
+	rootCmd.Flags().BoolVar(&verifyChecksums, "verify", false, "Compare SHA-256 checksums of every transferred file on both sides afterwards")
+	rootCmd.Flags().IntVarP(&concurrency, "concurrency", "j", transfer.DefaultConcurrency, "Files copied at once by SFTP directory transfers (1=one at a time)")
+	rootCmd.Flags().BoolVar(&lowMemory, "low-memory", false, "Copy files of SFTP directory transfers while walking the tree instead of listing them first")
+	rootCmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip files matching this pattern (rsync --exclude syntax, repeatable)")
+	rootCmd.Flags().StringArrayVar(&includes, "include", nil, "Only copy files matching this pattern (rsync --include syntax, repeatable)")
+	rootCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep pushing files changed in the source until interrupted")
+	rootCmd.Flags().DurationVar(&watchDebounce, "debounce", transfer.DefaultWatchDebounce, "Time the source must be quiet before changes are pushed with --watch")
+	rootCmd.Flags().StringVar(&jobsFile, "jobs", "", "Queue the transfers listed in this file, one 'source [destination]' per line (- for stdin)")
+	rootCmd.Flags().BoolVar(&resumeJobs, "resume-jobs", false, "Finish the interrupted or failed jobs of the last --jobs run")
+	rootCmd.Flags().IntVar(&jobConcurrency, "job-concurrency", transfer.DefaultJobConcurrency, "Jobs transferred at once with --jobs")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be transferred without actually doing it")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	rootCmd.MarkFlagsMutuallyExclusive("watch", "dry-run")
+	rootCmd.MarkFlagsMutuallyExclusive("watch", "encrypt")
+	rootCmd.MarkFlagsMutuallyExclusive("jobs", "resume-jobs")
+	rootCmd.MarkFlagsMutuallyExclusive("resume-jobs", "dry-run")
+	for _, flag := range []string{"watch", "encrypt", "multipath"} {
+		rootCmd.MarkFlagsMutuallyExclusive("jobs", flag)
+		rootCmd.MarkFlagsMutuallyExclusive("resume-jobs", flag)
+	}
+	cli.AddConfirmFlags(rootCmd)
+	cli.AddPassphraseFlags(rootCmd)
+	cli.AddOutputFlags(rootCmd)
+	cli.AddTraceFlags(rootCmd)
+	cli.AddConfigStoreFlags(rootCmd)
+	cli.AddWaitFlags(rootCmd)
+	cli.AddSudoFlags(rootCmd)
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -56,12 +150,23 @@ Created by orpheus497.`,
 		},
 	})
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	cli.RegisterCompletions(rootCmd)
+
+	return rootCmd
 }
 
 func runCopy(cmd *cobra.Command, args []string) {
+	ui.SetConfirmPolicy(cli.ConfirmPolicy())
+	if err := cli.ApplyOutputFormat(); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
+	if jobsFile != "" || resumeJobs {
+		runJobs(cmd)
+		return
+	}
+
 	sourcePath := args[0]
 
 	// Check if source exists
@@ -74,11 +179,27 @@ func runCopy(cmd *cobra.Command, args []string) {
 	if len(args) > 1 {
 		destPath = args[1]
 	}
-	if destPath == "" {
+	destDefaulted := destPath == ""
+	if destDefaulted {
 		// Default to same path as source (relative to home directory)
+		// Refined once the remote home directory is known
 		destPath = sourcePath
 	}
 
+	if watch && watchDebounce <= 0 {
+		ui.PrintError("--debounce must be positive")
+		os.Exit(1)
+	}
+
+	var encryption *transfer.Encryption
+	if encryptSpec != "" {
+		var err error
+		if encryption, err = transfer.ParseEncryption(encryptSpec); err != nil {
+			ui.PrintError("Invalid --encrypt: %v", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize audit logger (enabled by default for security tracking)
 	auditLogger, err := logger.NewAuditLogger(true)
 	if err != nil {
@@ -88,32 +209,28 @@ func runCopy(cmd *cobra.Command, args []string) {
 	}
 	defer auditLogger.Close()
 
-	// Create connection helper (centralizes connection setup)
-	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
-		ProfileName: profileName,
-		BackendName: backendName,
-		Timeout:     timeout,
-		Verbose:     verbose,
-	})
-	if err != nil {
-		ui.PrintError("Failed to initialize connection: %v", err)
-		ui.PrintInfo("Run 'klip init' to create initial configuration")
+	helper := newConnectionHelper(cmd)
+	if watch && helper.Profile.TransferOptions.DeleteAfterTransfer {
+		ui.PrintError("--watch cannot be used with delete_after_transfer")
 		os.Exit(1)
 	}
 
-	// Override transfer method if specified
-	if method != "" {
-		helper.Profile.TransferOptions.Method = method
+	if dryRun {
+		ui.PrintWarning("DRY RUN - No files will be transferred")
 	}
 
-	// Override compression if specified
-	if cmd.Flags().Changed("compress") {
-		helper.Profile.TransferOptions.CompressionLevel = compressionLevel
+	// Scan the plaintext source before anything leaves this machine
+	if !dryRun && !helper.ScanUpload(context.Background(), sourcePath) {
+		os.Exit(1)
 	}
 
-	ui.PrintInfo("Copying to: %s@%s:%s", helper.Profile.RemoteUser, helper.Profile.RemoteHost, destPath)
-	if dryRun {
-		ui.PrintWarning("DRY RUN - No files will be transferred")
+	// Wait for the host to come up before the connect timeout starts
+	if cli.Wait {
+		if err := helper.WaitForHost(context.Background(), cli.WaitFor); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Host %s is up", helper.Profile.RemoteHost)
 	}
 
 	// Create context with timeout
@@ -144,22 +261,58 @@ func runCopy(cmd *cobra.Command, args []string) {
 	}
 	defer client.Close()
 
+	// Inspect the remote environment (cached per profile)
+	if _, err := helper.DetectCapabilities(ctx, client); err != nil {
+		ui.PrintWarning("Could not detect remote environment: %v", err)
+	}
+
+	helper.ResolveMethod()
+
+	if destDefaulted {
+		destPath = cli.DefaultRemoteDest(sourcePath, helper.Capabilities)
+	}
+
+	// Upload ciphertext from a staging directory instead of the source
+	uploadPath := sourcePath
+	if encryption != nil {
+		stagingDir, err := os.MkdirTemp("", "klipc-encrypt-")
+		if err != nil {
+			ui.PrintError("Failed to create staging directory: %v", err)
+			os.Exit(1)
+		}
+		removeStaging := func() { os.RemoveAll(stagingDir) }
+		cleanups = append(cleanups, removeStaging)
+		defer removeStaging()
+
+		err = ui.NewStepRunner(1).Run("Encrypting with "+encryption.Scheme, func() error {
+			uploadPath, err = encryption.EncryptTree(ctx, sourcePath, stagingDir)
+			return err
+		})
+		if err != nil {
+			ui.PrintError("Encryption failed: %v", err)
+			exit(1)
+		}
+
+		// Keep trailing-slash (contents) semantics of the original source
+		if strings.HasSuffix(sourcePath, "/") {
+			uploadPath += "/"
+		}
+		if destDefaulted {
+			if info, err := os.Stat(sourcePath); err == nil && !info.IsDir() {
+				destPath += encryption.Suffix()
+			}
+		}
+	}
+
+	ui.PrintInfo("Copying to: %s@%s:%s", helper.Profile.RemoteUser, helper.Profile.RemoteHost, destPath)
+
 	// Configure transfer
-	transferConfig := &transfer.TransferConfig{
-		SSHClient:           client,
-		Profile:             helper.Profile,
-		ResolvedHost:        helper.ResolvedHost,
-		SourcePath:          sourcePath,
-		DestPath:            destPath,
-		Direction:           transfer.DirectionPush,
-		Method:              helper.Profile.TransferOptions.Method,
-		CompressionLevel:    helper.Profile.TransferOptions.CompressionLevel,
-		ExcludePatterns:     helper.Profile.TransferOptions.ExcludePatterns,
-		BandwidthLimit:      helper.Profile.TransferOptions.BandwidthLimit,
-		PreservePermissions: helper.Profile.TransferOptions.PreservePermissions,
-		DeleteAfterTransfer: helper.Profile.TransferOptions.DeleteAfterTransfer,
-		DryRun:              dryRun,
-		ShowProgress:        true,
+	transferConfig := pushConfig(helper, client, uploadPath, destPath)
+	transferConfig.ChunkCache = chunkCache(helper)
+
+	if multipath {
+		closeMultipath := helper.EnableMultipath(ctx, transferConfig, timeout)
+		defer closeMultipath()
 	}
 
 	// Create transfer
@@ -178,16 +331,22 @@ func runCopy(cmd *cobra.Command, args []string) {
 			err,
 		)
 		ui.PrintError("Failed to create transfer: %v", err)
-		os.Exit(1)
+		exit(1)
+	}
+
+	ui.PrintInfo("Files will land in: %s@%s:%s", helper.Profile.RemoteUser, helper.Profile.RemoteHost, transfer.Destination(transferConfig))
+
+	// Confirm transfers that delete data before anything is changed
+	if !cli.ConfirmTransfer(transferConfig) {
+		exit(1)
+	}
+	if !cli.ConfirmLimits(ctx, transferConfig) {
+		exit(1)
 	}
 
 	// Set progress callback
 	if verbose || dryRun {
-		xfer.SetProgressCallback(func(info transfer.ProgressInfo) {
-			if info.Message != "" {
-				fmt.Println(info.Message)
-			}
-		})
+		xfer.SetProgressCallback(cli.PrintProgress)
 	}
 
 	// Execute transfer
@@ -204,6 +363,9 @@ func runCopy(cmd *cobra.Command, args []string) {
 	if dryRun {
 		status = "dry_run"
 	}
+	if status == "success" {
+		helper.RecordUsage(cache.ActivityPush)
+	}
 
 	// Log transfer result
 	_ = auditLogger.LogTransfer(
@@ -218,14 +380,133 @@ func runCopy(cmd *cobra.Command, args []string) {
 		transferErr,
 	)
 
+	result := cli.NewTransferResult(
+		helper.Profile.Name,
+		helper.Profile.RemoteHost,
+		"push",
+		sourcePath,
+		destPath,
+		status,
+		elapsed,
+		transferErr,
+	)
+	result.Verified = transfer.VerifyResults(xfer)
+	if err := cli.PrintTransferResult(result); err != nil {
+		ui.PrintError("%v", err)
+		exit(1)
+	}
 	if transferErr != nil {
-		ui.PrintError("Transfer failed: %v", transferErr)
+		exit(1)
+	}
+
+	if watch {
+		runWatch(helper, client, transferConfig, auditLogger, sourcePath)
+	}
+}
+
+// newConnectionHelper creates the connection helper, applying the transfer
+// options given on the command line to the profile
+func newConnectionHelper(cmd *cobra.Command) *cli.ConnectionHelper {
+	helper, err := cli.NewConnectionHelper(cli.ConnectionConfig{
+		ProfileName: profileName,
+		BackendName: backendName,
+		Timeout:     timeout,
+		Verbose:     verbose,
+		Operation:   config.OpPush,
+	})
+	if err != nil {
+		ui.PrintError("Failed to initialize connection: %v", err)
+		ui.PrintInfo("Run 'klip init' to create initial configuration")
 		os.Exit(1)
 	}
 
-	if dryRun {
-		ui.PrintSuccess("Dry run completed in %.2fs", elapsed.Seconds())
-	} else {
-		ui.PrintSuccess("Transfer completed in %.2fs", elapsed.Seconds())
+	// Override transfer method if specified
+	if method != "" {
+		helper.Profile.TransferOptions.Method = method
+	}
+
+	// Override compression if specified
+	if cmd.Flags().Changed("compress") {
+		helper.Profile.TransferOptions.CompressionLevel = compressionLevel
+	}
+	if cmd.Flags().Changed("concurrency") {
+		helper.Profile.TransferOptions.Concurrency = concurrency
+	}
+	if cmd.Flags().Changed("segments") {
+		helper.Profile.TransferOptions.Segments = segments
+	}
+	return helper
+}
+
+// pushConfig configures a push of source to dest from the profile and
+// command line
+func pushConfig(helper *cli.ConnectionHelper, client *ssh.Client, source, dest string) *transfer.TransferConfig {
+	return &transfer.TransferConfig{
+		SSHClient:           client,
+		Profile:             helper.Profile,
+		ResolvedHost:        helper.ResolvedHost,
+		ResolvedJumps:       helper.ResolvedJumps,
+		KnownHostsPath:      helper.KnownHostsPath,
+		KeyDir:              helper.KeyDir,
+		HostCAKeys:          helper.Config.Settings.HostCAKeys,
+		DefaultKeys:         helper.Config.Settings.DefaultKeys,
+		SourcePath:          source,
+		DestPath:            dest,
+		DirectoryMode:       directoryMode(),
+		Direction:           transfer.DirectionPush,
+		Method:              helper.Profile.TransferOptions.Method,
+		CompressionLevel:    helper.Profile.TransferOptions.CompressionLevel,
+		ExcludePatterns:     append(helper.Profile.TransferOptions.Excludes(), excludes...),
+		IncludePatterns:     append(helper.Profile.TransferOptions.IncludePatterns, includes...),
+		RsyncPath:           helper.Profile.TransferOptions.RsyncPath,
+		ExtraRsyncArgs:      helper.Profile.TransferOptions.ExtraRsyncArgs,
+		BandwidthLimit:      helper.Profile.TransferOptions.BandwidthLimit,
+		PreservePermissions: helper.Profile.TransferOptions.PreservePermissions,
+		PreserveXattrs:      helper.Profile.TransferOptions.PreserveXattrs,
+		PreserveHardLinks:   helper.Profile.TransferOptions.PreserveHardLinks,
+		Sparse:              sparse || helper.Profile.TransferOptions.Sparse,
+		StagingDir:          helper.Profile.TransferOptions.StagingDir,
+		NoResume:            noResume || helper.Profile.TransferOptions.NoResume,
+		VerifyResume:        verifyResume || helper.Profile.TransferOptions.VerifyResume,
+		Verify:              verifyChecksums || helper.Profile.TransferOptions.Verify,
+		Chown:               helper.Profile.TransferOptions.Chown,
+		Chmod:               helper.Profile.TransferOptions.Chmod,
+		DeleteAfterTransfer: helper.Profile.TransferOptions.DeleteAfterTransfer,
+		NoAtomic:            noAtomic || helper.Profile.TransferOptions.NoAtomic,
+		Sudo:                cli.Sudo,
+		SudoPassword:        cli.SudoPassword(helper.Profile),
+		Concurrency:         helper.Profile.TransferOptions.Concurrency,
+		LowMemory:           lowMemory || helper.Profile.TransferOptions.LowMemory,
+		Segments:            helper.Profile.TransferOptions.Segments,
+		MaxFiles:            helper.Profile.TransferOptions.MaxFiles,
+		MaxTotalSize:        helper.Profile.TransferOptions.MaxTotalSizeBytes(),
+		DryRun:              dryRun,
+		ShowProgress:        true,
+	}
+}
+
+// chunkCache loads the profile's chunk cache for --dedup, or returns nil
+// when deduplication is off or the cache is unavailable
+func chunkCache(helper *cli.ConnectionHelper) *cache.ChunkCache {
+	if !dedup && !helper.Profile.TransferOptions.Dedup {
+		return nil
+	}
+	chunks, err := cache.LoadChunkCache(helper.Profile.Name, transfer.MultipathChunkSize)
+	if err != nil {
+		ui.PrintWarning("Chunk cache unavailable, sending files in full: %v", err)
+		return nil
+	}
+	return chunks
+}
+
+// directoryMode maps the --contents/--into flags to a transfer directory mode
+func directoryMode() transfer.DirectoryMode {
+	switch {
+	case copyContents:
+		return transfer.DirModeContents
+	case copyInto:
+		return transfer.DirModeInto
+	default:
+		return transfer.DirModeAuto
 	}
 }
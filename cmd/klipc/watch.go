@@ -0,0 +1,89 @@
+// klipc - Continuous push of changed files
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// runWatch pushes files changed in the source after the initial transfer
+// until interrupted, keeping the connection open in between
+func runWatch(helper *cli.ConnectionHelper, client *ssh.Client, transferConfig *transfer.TransferConfig, auditLogger *logger.AuditLogger, sourcePath string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if cli.KeepAlive > 0 {
+		go client.KeepAlive(ctx, cli.KeepAlive, cli.KeepAliveMax)
+	}
+
+	watcher, err := transfer.NewWatcher(transferConfig, watchDebounce)
+	if err != nil {
+		ui.PrintError("%v", err)
+		client.Close()
+		exit(1)
+	}
+	defer watcher.Close()
+
+	var callback transfer.ProgressCallback
+	if verbose {
+		callback = cli.PrintProgress
+	}
+
+	// Each batch gets the pre-upload scan and the size limits the initial
+	// transfer got, limited to the files it pushes
+	approve := func(ctx context.Context, files []string) bool {
+		return helper.ScanUploadFiles(ctx, sourcePath, files) && cli.ConfirmFileLimits(transferConfig, files)
+	}
+
+	ui.PrintInfo("Watching %s for changes, press Ctrl-C to stop", sourcePath)
+	err = watcher.Run(ctx, func(changed []string) {
+		startTime := time.Now()
+		pushErr := transfer.PushChanges(ctx, transferConfig, changed, approve, callback)
+		if ctx.Err() != nil {
+			return
+		}
+
+		status := "success"
+		if pushErr != nil {
+			status = "failed"
+		}
+		_ = auditLogger.LogTransfer(
+			helper.Profile.Name,
+			helper.Profile.RemoteUser,
+			helper.Profile.RemoteHost,
+			helper.Backend.Name(),
+			"push",
+			sourcePath,
+			transferConfig.DestPath,
+			status,
+			pushErr,
+		)
+
+		if pushErr != nil {
+			ui.PrintError("Push failed: %v", pushErr)
+			if !client.IsConnected() {
+				client.Close()
+				exit(1)
+			}
+			return
+		}
+		ui.PrintSuccess("Pushed %d changed files in %s", len(changed), time.Since(startTime).Round(time.Millisecond))
+		if verbose {
+			ui.PrintList(changed)
+		}
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		client.Close()
+		exit(1)
+	}
+}
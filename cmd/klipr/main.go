@@ -8,7 +8,9 @@ import (
 	"os"
 	"time"
 
+	"github.com/orpheus497/klip/internal/cache"
 	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/config"
 	"github.com/orpheus497/klip/internal/logger"
 	"github.com/orpheus497/klip/internal/transfer"
 	"github.com/orpheus497/klip/internal/ui"
@@ -25,9 +27,36 @@ var (
 	dryRun           bool
 	verbose          bool
 	timeout          int
+	copyContents     bool
+	copyInto         bool
+	decryptSpec      string
+	multipath        bool
+	sparse           bool
+	noResume         bool
+	verifyResume     bool
+	verifyChecksums  bool
+	concurrency      int
+	segments         int
+	excludes         []string
+	includes         []string
+	lowMemory        bool
 )
 
 func main() {
+	// rsync re-invokes this binary as its remote shell for native transfers
+	if transfer.IsRsyncProxyInvocation() {
+		os.Exit(transfer.RunRsyncProxy())
+	}
+
+	cli.InitUI()
+
+	if err := newRootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the klipr command
+func newRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "klipr <remote-source> [local-destination]",
 		Short: "Retrieve files from remote machines",
@@ -40,13 +69,34 @@ Created by orpheus497.`,
 	}
 
 	rootCmd.Flags().StringVarP(&profileName, "profile", "p", "", "Connection profile to use")
-	rootCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird)")
+	rootCmd.Flags().StringVarP(&backendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
 	rootCmd.Flags().StringVarP(&destPath, "dest", "d", "", "Local destination path (defaults to current directory)")
-	rootCmd.Flags().StringVarP(&method, "method", "m", "rsync", "Transfer method (rsync, sftp)")
+	rootCmd.Flags().StringVarP(&method, "method", "m", "rsync", "Transfer method (rsync, sftp, delta, scp)")
 	rootCmd.Flags().IntVarP(&compressionLevel, "compress", "z", 6, "Compression level (0-9, 0=disabled)")
+	rootCmd.Flags().BoolVar(&copyContents, "contents", false, "Copy the contents of a source directory (like a trailing slash)")
+	rootCmd.Flags().BoolVar(&copyInto, "into", false, "Copy a source directory itself into the destination")
+	rootCmd.MarkFlagsMutuallyExclusive("contents", "into")
+	rootCmd.Flags().StringVar(&decryptSpec, "decrypt", "", "Decrypt retrieved .age/.gpg files (age:<identity-file>, gpg)")
+	rootCmd.Flags().BoolVar(&multipath, "multipath", false, "Stripe single-file transfers across all connected backends that reach the host")
+	rootCmd.Flags().IntVar(&segments, "segments", 0, "Split single files of 32 MiB or more into this many concurrent SFTP streams")
+	rootCmd.Flags().BoolVar(&sparse, "sparse", false, "Leave runs of zeros as holes at the destination (VM images, preallocated files)")
+	rootCmd.Flags().BoolVar(&noResume, "no-resume", false, "Restart interrupted files from zero instead of continuing partial files")
+	rootCmd.Flags().BoolVar(&verifyResume, "verify-resume", false, "Compare checksums of partial files with the source before continuing them")
+	rootCmd.MarkFlagsMutuallyExclusive("no-resume", "verify-resume")
+	rootCmd.Flags().BoolVar(&verifyChecksums, "verify", false, "Compare SHA-256 checksums of every transferred file on both sides afterwards")
+	rootCmd.Flags().IntVarP(&concurrency, "concurrency", "j", transfer.DefaultConcurrency, "Files copied at once by SFTP directory transfers (1=one at a time)")
+	rootCmd.Flags().BoolVar(&lowMemory, "low-memory", false, "Copy files of SFTP directory transfers while walking the tree instead of listing them first")
+	rootCmd.Flags().StringArrayVar(&excludes, "exclude", nil, "Skip files matching this pattern (rsync --exclude syntax, repeatable)")
+	rootCmd.Flags().StringArrayVar(&includes, "include", nil, "Only copy files matching this pattern (rsync --include syntax, repeatable)")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be transferred without actually doing it")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Connection timeout in seconds")
+	cli.AddConfirmFlags(rootCmd)
+	cli.AddPassphraseFlags(rootCmd)
+	cli.AddOutputFlags(rootCmd)
+	cli.AddTraceFlags(rootCmd)
+	cli.AddConfigStoreFlags(rootCmd)
+	cli.AddWaitFlags(rootCmd)
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "version",
@@ -56,12 +106,18 @@ Created by orpheus497.`,
 		},
 	})
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	cli.RegisterCompletions(rootCmd)
+
+	return rootCmd
 }
 
 func runRetrieve(cmd *cobra.Command, args []string) {
+	ui.SetConfirmPolicy(cli.ConfirmPolicy())
+	if err := cli.ApplyOutputFormat(); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
+
 	remotePath := args[0]
 
 	// Determine local destination path
@@ -78,6 +134,15 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 		destPath = cwd
 	}
 
+	var decryption *transfer.Encryption
+	if decryptSpec != "" {
+		var err error
+		if decryption, err = transfer.ParseEncryption(decryptSpec); err != nil {
+			ui.PrintError("Invalid --decrypt: %v", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize audit logger (enabled by default for security tracking)
 	auditLogger, err := logger.NewAuditLogger(true)
 	if err != nil {
@@ -93,6 +158,7 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 		BackendName: backendName,
 		Timeout:     timeout,
 		Verbose:     verbose,
+		Operation:   config.OpPull,
 	})
 	if err != nil {
 		ui.PrintError("Failed to initialize connection: %v", err)
@@ -109,6 +175,12 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 	if cmd.Flags().Changed("compress") {
 		helper.Profile.TransferOptions.CompressionLevel = compressionLevel
 	}
+	if cmd.Flags().Changed("concurrency") {
+		helper.Profile.TransferOptions.Concurrency = concurrency
+	}
+	if cmd.Flags().Changed("segments") {
+		helper.Profile.TransferOptions.Segments = segments
+	}
 
 	ui.PrintInfo("Retrieving from: %s@%s:%s", helper.Profile.RemoteUser, helper.Profile.RemoteHost, remotePath)
 	ui.PrintInfo("Destination: %s", destPath)
@@ -116,6 +188,15 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 		ui.PrintWarning("DRY RUN - No files will be transferred")
 	}
 
+	// Wait for the host to come up before the connect timeout starts
+	if cli.Wait {
+		if err := helper.WaitForHost(context.Background(), cli.WaitFor); err != nil {
+			ui.PrintError("%v", err)
+			os.Exit(1)
+		}
+		ui.PrintSuccess("Host %s is up", helper.Profile.RemoteHost)
+	}
+
 	// Create context with timeout
 	ctx := context.Background()
 	if timeout > 0 {
@@ -144,24 +225,59 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 	}
 	defer client.Close()
 
+	// Inspect the remote environment (cached per profile)
+	if _, err := helper.DetectCapabilities(ctx, client); err != nil {
+		ui.PrintWarning("Could not detect remote environment: %v", err)
+	}
+
+	// Fall back to another method when the chosen one is unavailable
+	helper.ResolveMethod()
+
 	// Configure transfer
 	transferConfig := &transfer.TransferConfig{
 		SSHClient:           client,
 		Profile:             helper.Profile,
 		ResolvedHost:        helper.ResolvedHost,
+		ResolvedJumps:       helper.ResolvedJumps,
+		KnownHostsPath:      helper.KnownHostsPath,
+		KeyDir:              helper.KeyDir,
+		HostCAKeys:          helper.Config.Settings.HostCAKeys,
+		DefaultKeys:         helper.Config.Settings.DefaultKeys,
 		SourcePath:          remotePath,
 		DestPath:            destPath,
+		DirectoryMode:       directoryMode(),
 		Direction:           transfer.DirectionPull,
 		Method:              helper.Profile.TransferOptions.Method,
 		CompressionLevel:    helper.Profile.TransferOptions.CompressionLevel,
-		ExcludePatterns:     helper.Profile.TransferOptions.ExcludePatterns,
+		ExcludePatterns:     append(helper.Profile.TransferOptions.Excludes(), excludes...),
+		IncludePatterns:     append(helper.Profile.TransferOptions.IncludePatterns, includes...),
+		RsyncPath:           helper.Profile.TransferOptions.RsyncPath,
+		ExtraRsyncArgs:      helper.Profile.TransferOptions.ExtraRsyncArgs,
 		BandwidthLimit:      helper.Profile.TransferOptions.BandwidthLimit,
 		PreservePermissions: helper.Profile.TransferOptions.PreservePermissions,
+		PreserveXattrs:      helper.Profile.TransferOptions.PreserveXattrs,
+		PreserveHardLinks:   helper.Profile.TransferOptions.PreserveHardLinks,
+		Sparse:              sparse || helper.Profile.TransferOptions.Sparse,
+		StagingDir:          helper.Profile.TransferOptions.StagingDir,
+		NoResume:            noResume || helper.Profile.TransferOptions.NoResume,
+		VerifyResume:        verifyResume || helper.Profile.TransferOptions.VerifyResume,
+		Verify:              verifyChecksums || helper.Profile.TransferOptions.Verify,
+		Chmod:               helper.Profile.TransferOptions.Chmod,
 		DeleteAfterTransfer: helper.Profile.TransferOptions.DeleteAfterTransfer,
+		Concurrency:         helper.Profile.TransferOptions.Concurrency,
+		LowMemory:           lowMemory || helper.Profile.TransferOptions.LowMemory,
+		Segments:            helper.Profile.TransferOptions.Segments,
+		MaxFiles:            helper.Profile.TransferOptions.MaxFiles,
+		MaxTotalSize:        helper.Profile.TransferOptions.MaxTotalSizeBytes(),
 		DryRun:              dryRun,
 		ShowProgress:        true,
 	}
 
+	if multipath {
+		closeMultipath := helper.EnableMultipath(ctx, transferConfig, timeout)
+		defer closeMultipath()
+	}
+
 	// Create transfer
 	xfer, err := transfer.NewTransfer(transferConfig)
 	if err != nil {
@@ -181,13 +297,19 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	ui.PrintInfo("Files will land in: %s", transfer.Destination(transferConfig))
+
+	// Confirm transfers that delete data before anything is changed
+	if !cli.ConfirmTransfer(transferConfig) {
+		os.Exit(1)
+	}
+	if !cli.ConfirmLimits(ctx, transferConfig) {
+		os.Exit(1)
+	}
+
 	// Set progress callback
 	if verbose || dryRun {
-		xfer.SetProgressCallback(func(info transfer.ProgressInfo) {
-			if info.Message != "" {
-				fmt.Println(info.Message)
-			}
-		})
+		xfer.SetProgressCallback(cli.PrintProgress)
 	}
 
 	// Execute transfer
@@ -204,6 +326,9 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 	if dryRun {
 		status = "dry_run"
 	}
+	if status == "success" {
+		helper.RecordUsage(cache.ActivityPull)
+	}
 
 	// Log transfer result
 	_ = auditLogger.LogTransfer(
@@ -218,14 +343,50 @@ func runRetrieve(cmd *cobra.Command, args []string) {
 		transferErr,
 	)
 
+	result := cli.NewTransferResult(
+		helper.Profile.Name,
+		helper.Profile.RemoteHost,
+		"pull",
+		remotePath,
+		destPath,
+		status,
+		elapsed,
+		transferErr,
+	)
+	result.Verified = transfer.VerifyResults(xfer)
+
+	if transferErr == nil && !dryRun && decryption != nil {
+		// Only the files this pull wrote, never others already there
+		files, err := transfer.PulledFiles(context.Background(), transferConfig)
+		if err != nil {
+			ui.PrintError("Decryption failed: %v", err)
+			os.Exit(1)
+		}
+		count, err := decryption.DecryptFiles(context.Background(), files)
+		if err != nil {
+			ui.PrintError("Decryption failed: %v", err)
+			os.Exit(1)
+		}
+		result.Decrypted = count
+	}
+
+	if err := cli.PrintTransferResult(result); err != nil {
+		ui.PrintError("%v", err)
+		os.Exit(1)
+	}
 	if transferErr != nil {
-		ui.PrintError("Transfer failed: %v", transferErr)
 		os.Exit(1)
 	}
+}
 
-	if dryRun {
-		ui.PrintSuccess("Dry run completed in %.2fs", elapsed.Seconds())
-	} else {
-		ui.PrintSuccess("Transfer completed in %.2fs", elapsed.Seconds())
+// directoryMode maps the --contents/--into flags to a transfer directory mode
+func directoryMode() transfer.DirectoryMode {
+	switch {
+	case copyContents:
+		return transfer.DirModeContents
+	case copyInto:
+		return transfer.DirModeInto
+	default:
+		return transfer.DirModeAuto
 	}
 }
@@ -0,0 +1,69 @@
+// klipr - Tests of command output
+// Copyright (c) 2025 orpheus497
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/cli"
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEnv isolates a test with an SSH server and a profile "test"
+// connecting to it by key
+func newTestEnv(t *testing.T) *clitest.Env {
+	env := clitest.NewEnv(t)
+	server := env.StartSSHServer()
+	env.WriteConfig(fmt.Sprintf(`current_profile: test
+profiles:
+  test:
+    name: test
+    remote_user: deploy
+    remote_host: %s
+    ssh_port: %d
+    ssh_key_path: %s
+    backend: lan
+settings:
+  default_backend: lan
+  ssh_timeout: 10
+`, server.Host, server.Port, server.KeyPath))
+
+	t.Cleanup(func() {
+		cli.ResetFlags()
+		ui.SetOutputFormat(ui.OutputText)
+	})
+	return env
+}
+
+func TestDryRunJSONOutput(t *testing.T) {
+	env := newTestEnv(t)
+	source := env.WriteFile("remote/a.txt", "hello")
+	env.WriteFile("remote/b.txt", "world")
+	dest := filepath.Join(env.Dir, "dest")
+	require.NoError(t, os.MkdirAll(dest, 0700))
+
+	result := env.Run(newRootCmd(), "-p", "test", "--method", "sftp", "--dry-run", "--output", "json", filepath.Dir(source)+"/", dest)
+	require.NoError(t, result.Err, result.Stderr)
+
+	// stdout holds the JSON document and nothing else
+	decoder := json.NewDecoder(bytes.NewReader([]byte(result.Stdout)))
+	decoder.DisallowUnknownFields()
+	var got cli.TransferResult
+	require.NoError(t, decoder.Decode(&got), "stdout: %q", result.Stdout)
+	assert.False(t, decoder.More(), "stdout: %q", result.Stdout)
+	assert.Equal(t, "dry_run", got.Status)
+	assert.Equal(t, "pull", got.Direction)
+	clitest.Golden(t, "dry-run-json", result.Stdout)
+
+	// Status messages and progress go to stderr, and nothing is retrieved
+	assert.Contains(t, result.Stderr, "DRY RUN")
+	assert.NoFileExists(t, filepath.Join(dest, "a.txt"))
+}
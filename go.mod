@@ -3,18 +3,24 @@ module github.com/orpheus497/klip
 go 1.22
 
 require (
+	filippo.io/age v1.2.1 // File encryption
 	github.com/adrg/xdg v0.5.3 // XDG Base Directory Specification
 	github.com/fatih/color v1.18.0 // Terminal colors
+	github.com/fsnotify/fsnotify v1.8.0 // Filesystem notifications
+	github.com/mattn/go-runewidth v0.0.16 // Terminal display width
 	github.com/pkg/sftp v1.13.7 // SFTP file transfer
+	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // Conflict diffs
 	github.com/schollz/progressbar/v3 v3.17.1 // Progress bars
 	github.com/spf13/cobra v1.8.1 // CLI framework
 	github.com/stretchr/testify v1.10.0 // Testing framework
 	golang.org/x/crypto v0.29.0 // SSH client
+	golang.org/x/sys v0.27.0 // File locks on Windows
 	golang.org/x/term v0.26.0 // Terminal input
 	gopkg.in/yaml.v3 v3.0.1 // YAML parsing
 )
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/kr/fs v0.1.0 // indirect
@@ -22,9 +28,7 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.27.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 )
@@ -9,7 +9,7 @@ import (
 
 // Backend represents a VPN backend interface
 type Backend interface {
-	// Name returns the backend name (lan, tailscale, headscale, netbird)
+	// Name returns the backend name (lan, tailscale, headscale, netbird, zerotier, wireguard)
 	Name() string
 
 	// IsAvailable checks if the backend is installed and available
@@ -98,6 +98,8 @@ func NewRegistry() *Registry {
 	r.Register(&TailscaleBackend{})
 	r.Register(&HeadscaleBackend{})
 	r.Register(&NetBirdBackend{})
+	r.Register(&ZeroTierBackend{})
+	r.Register(&WireGuardBackend{})
 
 	return r
 }
@@ -3,13 +3,18 @@ package backend
 import (
 	"context"
 	"fmt"
+	"net"
 	"sort"
+	"strings"
 	"time"
 )
 
 // Detector handles backend auto-detection
 type Detector struct {
 	registry *Registry
+
+	// permit filters the backends considered (nil permits all)
+	permit func(name string) bool
 }
 
 // NewDetector creates a new backend detector
@@ -17,9 +22,33 @@ func NewDetector(registry *Registry) *Detector {
 	return &Detector{registry: registry}
 }
 
+// Restrict limits the detector to backends for which permit returns true
+// Detection fails closed: denied backends are never selected or used as a
+// fallback, even when no permitted backend is connected
+func (d *Detector) Restrict(permit func(name string) bool) *Detector {
+	d.permit = permit
+	return d
+}
+
+// permitted reports whether the detector may use the named backend
+func (d *Detector) permitted(name string) bool {
+	return d.permit == nil || d.permit(name)
+}
+
+// backends returns the registered backends the detector may use
+func (d *Detector) backends() []Backend {
+	var backends []Backend
+	for _, b := range d.registry.List() {
+		if d.permitted(b.Name()) {
+			backends = append(backends, b)
+		}
+	}
+	return backends
+}
+
 // DetectBest finds the best available and connected backend using parallel detection
 func (d *Detector) DetectBest(ctx context.Context) (Backend, error) {
-	backends := d.registry.List()
+	backends := d.backends()
 
 	// Sort backends by priority (highest first)
 	sort.Slice(backends, func(i, j int) bool {
@@ -96,7 +125,7 @@ func (d *Detector) DetectBest(ctx context.Context) (Backend, error) {
 // DetectAll returns status of all backends
 func (d *Detector) DetectAll(ctx context.Context) map[string]*Status {
 	results := make(map[string]*Status)
-	backends := d.registry.List()
+	backends := d.backends()
 
 	for _, backend := range backends {
 		if !backend.IsAvailable(ctx) {
@@ -146,7 +175,7 @@ func (d *Detector) DetectByName(ctx context.Context, name string) (*Status, erro
 }
 
 // SelectBackend chooses the appropriate backend based on preference
-// preference can be "auto", "lan", "tailscale", "headscale", or "netbird"
+// preference can be "auto", "lan", "tailscale", "headscale", "netbird", "zerotier", or "wireguard"
 func (d *Detector) SelectBackend(ctx context.Context, preference string) (Backend, error) {
 	if preference == "auto" || preference == "" {
 		return d.DetectBest(ctx)
@@ -157,6 +186,10 @@ func (d *Detector) SelectBackend(ctx context.Context, preference string) (Backen
 		return nil, err
 	}
 
+	if !d.permitted(preference) {
+		return nil, fmt.Errorf("backend '%s' is not permitted for this profile (allowed_backends/denied_backends)", preference)
+	}
+
 	if !backend.IsAvailable(ctx) {
 		return nil, fmt.Errorf("backend '%s' is not available (not installed)", preference)
 	}
@@ -173,7 +206,7 @@ func (d *Detector) ResolveHost(ctx context.Context, backend Backend, hostname st
 	ip, err := backend.GetPeerIP(ctx, hostname)
 	if err != nil {
 		// If resolution fails on VPN backend, try LAN as fallback
-		if backend.Name() != "lan" {
+		if backend.Name() != "lan" && d.permitted("lan") {
 			lanBackend := &LANBackend{}
 			if lanIP, lanErr := lanBackend.GetPeerIP(ctx, hostname); lanErr == nil {
 				return lanIP, nil
@@ -229,3 +262,207 @@ func (d *Detector) HealthCheck(ctx context.Context) []HealthCheckResult {
 
 	return results
 }
+
+// PeerLiveness is how one backend sees a peer
+type PeerLiveness struct {
+	Backend string
+	Online  bool
+	IP      string
+}
+
+// PeerLiveness looks up host in the peer lists of all backends
+// Backends that do not list the host are omitted
+func (d *Detector) PeerLiveness(ctx context.Context, host string) []PeerLiveness {
+	return peersOf(d.DetectAll(ctx), host)
+}
+
+// peersOf looks up host in the peer lists of statuses
+func peersOf(statuses map[string]*Status, host string) []PeerLiveness {
+	var results []PeerLiveness
+
+	for name, status := range statuses {
+		for _, peer := range status.Peers {
+			if peerMatches(peer, host) {
+				results = append(results, PeerLiveness{Backend: name, Online: peer.Online, IP: peer.IP})
+				break
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Backend < results[j].Backend
+	})
+
+	return results
+}
+
+// LivenessHint suggests another backend when the failed backend does not
+// see the host online but another one does. Returns "" if there is nothing
+// to suggest.
+func LivenessHint(failed, host string, liveness []PeerLiveness) string {
+	// LAN lists no peers, so it can only fail to reach the host
+	state := "not found"
+	if failed == "lan" {
+		state = "unreachable"
+	}
+	var online []string
+
+	for _, l := range liveness {
+		switch {
+		case l.Backend == failed:
+			if l.Online {
+				// The backend agrees the host is up; the problem is elsewhere
+				return ""
+			}
+			state = "offline"
+		case l.Online:
+			online = append(online, l.Backend)
+		}
+	}
+
+	if len(online) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("host %s %s on %s but online on %s - try --backend %s",
+		host, state, failed, strings.Join(online, ", "), online[0])
+}
+
+// peerMatches reports whether peer is host, by hostname, short hostname
+// or IP address
+func peerMatches(peer PeerInfo, host string) bool {
+	if peer.IP == host || strings.EqualFold(peer.Hostname, host) {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+
+	short, _, _ := strings.Cut(host, ".")
+	peerShort, _, _ := strings.Cut(peer.Hostname, ".")
+	return strings.EqualFold(peerShort, short)
+}
+
+// Candidate is one backend as considered by Explain
+type Candidate struct {
+	Name      string
+	Priority  int
+	Denied    bool
+	Available bool
+	Connected bool
+
+	// Resolved is the address the backend resolves the host to
+	Resolved   string
+	ResolveErr error
+}
+
+// Explanation describes how SelectBackend picks a backend for a host
+type Explanation struct {
+	Preference string
+
+	// Candidates are all backends, highest priority first
+	Candidates []Candidate
+
+	// Steps is the decision path in order
+	Steps []string
+
+	// Selected is the chosen backend, empty if none could be selected
+	Selected string
+}
+
+// Explain checks every backend the way SelectBackend does and records why
+// the selected backend was chosen for host
+func (d *Detector) Explain(ctx context.Context, preference, host string) *Explanation {
+	if preference == "" {
+		preference = "auto"
+	}
+	e := &Explanation{Preference: preference}
+
+	backends := d.registry.List()
+	sort.Slice(backends, func(i, j int) bool {
+		if backends[i].Priority() != backends[j].Priority() {
+			return backends[i].Priority() > backends[j].Priority()
+		}
+		return backends[i].Name() < backends[j].Name()
+	})
+
+	for _, b := range backends {
+		c := Candidate{Name: b.Name(), Priority: b.Priority()}
+		if c.Denied = !d.permitted(b.Name()); c.Denied {
+			e.Candidates = append(e.Candidates, c)
+			continue
+		}
+		c.Available = b.IsAvailable(ctx)
+		if c.Available {
+			c.Connected = b.IsConnected(ctx)
+		}
+		if c.Connected {
+			if b.Name() == "lan" {
+				c.Resolved = host
+			} else {
+				c.Resolved, c.ResolveErr = b.GetPeerIP(ctx, host)
+			}
+		}
+		e.Candidates = append(e.Candidates, c)
+	}
+
+	if preference != "auto" {
+		e.step("profile requests backend %s, auto-detection is skipped", preference)
+		for _, c := range e.Candidates {
+			if c.Name != preference {
+				continue
+			}
+			if c.Denied {
+				e.step("%s is excluded by the profile's allowed_backends/denied_backends, nothing can be selected", c.Name)
+				return e
+			}
+			if !c.Available {
+				e.step("%s is not installed, nothing can be selected", c.Name)
+				return e
+			}
+			if !c.Connected {
+				e.step("%s is not connected, but is used anyway because it was requested", c.Name)
+			}
+			e.Selected = c.Name
+			return e
+		}
+		e.step("%s is not a known backend", preference)
+		return e
+	}
+
+	e.step("auto mode: the highest-priority connected backend wins")
+	var fallback string
+	for _, c := range e.Candidates {
+		switch {
+		case c.Denied:
+			e.step("%s (priority %d): excluded by the profile, skipped", c.Name, c.Priority)
+		case !c.Available:
+			e.step("%s (priority %d): not installed, skipped", c.Name, c.Priority)
+		case !c.Connected:
+			e.step("%s (priority %d): installed but not connected, skipped", c.Name, c.Priority)
+			if fallback == "" {
+				fallback = c.Name
+			}
+		case e.Selected == "":
+			e.step("%s (priority %d): connected, selected", c.Name, c.Priority)
+			e.Selected = c.Name
+		default:
+			e.step("%s (priority %d): connected, but lower priority than %s", c.Name, c.Priority, e.Selected)
+		}
+	}
+
+	if e.Selected == "" && fallback != "" {
+		e.step("no backend is connected, falling back to the highest-priority installed backend %s", fallback)
+		e.Selected = fallback
+	}
+	if e.Selected == "" {
+		e.step("no permitted backends are installed")
+	}
+
+	return e
+}
+
+// step appends a formatted step to the decision path
+func (e *Explanation) step(format string, args ...interface{}) {
+	e.Steps = append(e.Steps, fmt.Sprintf(format, args...))
+}
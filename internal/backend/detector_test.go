@@ -2,6 +2,7 @@ package backend
 
 import (
 	"context"
+	"net"
 	"testing"
 	"time"
 
@@ -240,3 +241,132 @@ func TestDetectorDetectAll(t *testing.T) {
 	assert.True(t, statuses["backend1"].Connected)
 	assert.False(t, statuses["backend2"].Connected)
 }
+
+func TestDetectorPeerLiveness(t *testing.T) {
+	registry := &Registry{
+		backends: make(map[string]Backend),
+	}
+	registry.Register(&MockBackend{name: "tailscale", available: true, status: &Status{
+		Backend: "tailscale",
+		Peers:   []PeerInfo{{Hostname: "web", IP: "100.64.0.5", Online: false}},
+	}})
+	registry.Register(&MockBackend{name: "netbird", available: true, status: &Status{
+		Backend: "netbird",
+		Peers:   []PeerInfo{{Hostname: "web.netbird.cloud", IP: "100.80.0.5", Online: true}},
+	}})
+	registry.Register(&MockBackend{name: "lan", available: true})
+
+	detector := &Detector{registry: registry}
+	liveness := detector.PeerLiveness(context.Background(), "web")
+
+	require.Len(t, liveness, 2)
+	assert.Equal(t, PeerLiveness{Backend: "netbird", Online: true, IP: "100.80.0.5"}, liveness[0])
+	assert.Equal(t, PeerLiveness{Backend: "tailscale", Online: false, IP: "100.64.0.5"}, liveness[1])
+
+	assert.Equal(t, "host web offline on tailscale but online on netbird - try --backend netbird",
+		LivenessHint("tailscale", "web", liveness))
+	assert.Equal(t, "host web unreachable on lan but online on netbird - try --backend netbird",
+		LivenessHint("lan", "web", liveness))
+	assert.Empty(t, LivenessHint("netbird", "web", liveness))
+}
+
+func TestDetectorCheckLANRoute(t *testing.T) {
+	registry := &Registry{
+		backends: make(map[string]Backend),
+	}
+	registry.Register(&MockBackend{name: "tailscale", available: true, status: &Status{
+		Backend: "tailscale", Connected: true, LocalIP: "100.64.0.2",
+		Peers: []PeerInfo{{Hostname: "web", IP: "100.64.0.5", Online: true}},
+	}})
+	registry.Register(&MockBackend{name: "zerotier", available: true, status: &Status{
+		Backend: "zerotier", Connected: true, LocalIP: "10.147.17.2/24",
+	}})
+	registry.Register(&MockBackend{name: "netbird", available: true, status: &Status{
+		Backend: "netbird", Connected: false, LocalIP: "100.80.0.2/16",
+		Peers: []PeerInfo{{Hostname: "db", IP: "192.0.2.7"}},
+	}})
+	registry.Register(&MockBackend{name: "lan", available: true, connected: true})
+
+	detector := &Detector{registry: registry}
+	ctx := context.Background()
+
+	// The host is a Tailscale peer, but its LAN address is not on a VPN
+	route := detector.CheckLANRoute(ctx, "web", "192.0.2.5")
+	assert.False(t, route.Encrypted())
+	assert.Equal(t, []PeerLiveness{{Backend: "tailscale", Online: true, IP: "100.64.0.5"}}, route.Peers)
+
+	assert.Equal(t, "tailscale", detector.CheckLANRoute(ctx, "web", "100.101.0.9").VPN)
+	assert.Equal(t, "zerotier", detector.CheckLANRoute(ctx, "nas", "10.147.17.9").VPN)
+
+	// Disconnected backends carry nothing, even their own peers
+	assert.False(t, detector.CheckLANRoute(ctx, "db", "192.0.2.7").Encrypted())
+
+	// A route leaving through a VPN's interface is encrypted whatever the
+	// address, e.g. behind a subnet router
+	statuses := detector.DetectAll(ctx)
+	assert.Equal(t, "zerotier", vpnCarrying(statuses, net.ParseIP("192.168.50.4"), net.ParseIP("10.147.17.2")))
+	assert.Empty(t, vpnCarrying(statuses, net.ParseIP("192.168.50.4"), net.ParseIP("192.168.1.10")))
+	assert.Empty(t, vpnCarrying(statuses, nil, nil))
+}
+
+func TestDetectorExplain(t *testing.T) {
+	registry := &Registry{
+		backends: make(map[string]Backend),
+	}
+	registry.Register(&MockBackend{name: "tailscale", available: true, connected: false, priority: 40})
+	registry.Register(&MockBackend{name: "netbird", available: true, connected: true, priority: 30})
+	registry.Register(&MockBackend{name: "headscale", available: false, priority: 35})
+	registry.Register(&MockBackend{name: "lan", available: true, connected: true, priority: 10})
+
+	detector := &Detector{registry: registry}
+	ctx := context.Background()
+
+	e := detector.Explain(ctx, "auto", "web")
+	assert.Equal(t, "netbird", e.Selected)
+	require.Len(t, e.Candidates, 4)
+	assert.Equal(t, "tailscale", e.Candidates[0].Name)
+	assert.Equal(t, "web", e.Candidates[3].Resolved)
+	assert.Contains(t, e.Steps[1], "tailscale (priority 40): installed but not connected")
+	assert.Contains(t, e.Steps[3], "netbird (priority 30): connected, selected")
+
+	selected, err := detector.SelectBackend(ctx, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, e.Selected, selected.Name())
+
+	e = detector.Explain(ctx, "headscale", "web")
+	assert.Empty(t, e.Selected)
+	assert.Contains(t, e.Steps[len(e.Steps)-1], "not installed")
+}
+
+func TestDetectorRestrict(t *testing.T) {
+	registry := &Registry{
+		backends: make(map[string]Backend),
+	}
+	registry.Register(&MockBackend{name: "tailscale", available: true, connected: false, priority: 40})
+	registry.Register(&MockBackend{name: "lan", available: true, connected: true, priority: 10})
+
+	ctx := context.Background()
+	noLAN := func(name string) bool { return name != "lan" }
+
+	// Unrestricted, auto falls back to the connected LAN backend
+	selected, err := NewDetector(registry).SelectBackend(ctx, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, "lan", selected.Name())
+
+	// Denying LAN fails closed to the disconnected VPN
+	detector := NewDetector(registry).Restrict(noLAN)
+	selected, err = detector.SelectBackend(ctx, "auto")
+	require.NoError(t, err)
+	assert.Equal(t, "tailscale", selected.Name())
+
+	_, err = detector.SelectBackend(ctx, "lan")
+	assert.Error(t, err)
+
+	e := detector.Explain(ctx, "auto", "web")
+	assert.True(t, e.Candidates[1].Denied)
+	assert.Equal(t, "tailscale", e.Selected)
+
+	// Nothing permitted selects nothing
+	_, err = NewDetector(registry).Restrict(func(string) bool { return false }).SelectBackend(ctx, "auto")
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+// Package backend - LAN route checks
+// Copyright (c) 2025 orpheus497
+package backend
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+)
+
+// vpnRanges are the address ranges VPN backends assign peers from; their
+// interfaces carry single addresses, so the ranges are not visible locally
+var vpnRanges = map[string][]string{
+	"tailscale": {"100.64.0.0/10", "fd7a:115c:a1e0::/48"},
+	"headscale": {"100.64.0.0/10", "fd7a:115c:a1e0::/48"},
+	"netbird":   {"100.64.0.0/10"},
+}
+
+// LANRoute is how a connection over the LAN backend reaches a host
+type LANRoute struct {
+	Host    string
+	Address string
+
+	// VPN is the connected VPN backend the address is reached through,
+	// empty if the connection crosses the open network
+	VPN string
+
+	// Peers are the VPN backends that list the host as a peer
+	Peers []PeerLiveness
+}
+
+// Encrypted reports whether the route goes through a VPN, or never
+// leaves the machine
+func (r *LANRoute) Encrypted() bool {
+	if ip := net.ParseIP(r.Address); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	return r.VPN != ""
+}
+
+// CheckLANRoute works out whether a LAN connection to address, which host
+// resolves to, goes through one of the connected VPNs: the address is in
+// the VPN's network or is one of its peers, or the system routes it out
+// of the VPN's interface (subnet routers, exit nodes, WireGuard allowed
+// IPs)
+func (d *Detector) CheckLANRoute(ctx context.Context, host, address string) *LANRoute {
+	statuses := d.DetectAll(ctx)
+	return &LANRoute{
+		Host:    host,
+		Address: address,
+		VPN:     vpnCarrying(statuses, net.ParseIP(address), sourceIP(address)),
+		Peers:   peersOf(statuses, host),
+	}
+}
+
+// vpnCarrying returns the connected VPN backend that ip is reached
+// through, given the local address the system sends to it from (nil if
+// unknown), or "" if none is
+func vpnCarrying(statuses map[string]*Status, ip, source net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(statuses))
+	for name, status := range statuses {
+		if name != "lan" && status.Connected {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		status := statuses[name]
+		local := net.ParseIP(status.LocalIP)
+		if local == nil {
+			local, _, _ = net.ParseCIDR(status.LocalIP)
+		}
+		if source != nil && source.Equal(local) {
+			return name
+		}
+		for _, network := range vpnNetworks(name, status.LocalIP) {
+			if network.Contains(ip) {
+				return name
+			}
+		}
+		for _, peer := range status.Peers {
+			if ip.Equal(net.ParseIP(peer.IP)) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// vpnNetworks returns the networks of a VPN backend: its known address
+// ranges and the prefix of its local address, from the address itself
+// (e.g. "100.92.1.5/16") or the interface holding it
+func vpnNetworks(name, localIP string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range vpnRanges[name] {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	if strings.Contains(localIP, "/") {
+		if _, network, err := net.ParseCIDR(localIP); err == nil {
+			networks = append(networks, network)
+		}
+		return networks
+	}
+	local := net.ParseIP(localIP)
+	if local == nil {
+		return networks
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return networks
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(local) {
+			ones, bits := ipNet.Mask.Size()
+			if ones < bits {
+				networks = append(networks, &net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask})
+			}
+		}
+	}
+	return networks
+}
+
+// sourceIP returns the local address the system would send packets to
+// address from, which tells the interface its route leaves through; no
+// packet is sent
+func sourceIP(address string) net.IP {
+	if net.ParseIP(address) == nil {
+		return nil
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(address, "9"))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
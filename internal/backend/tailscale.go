@@ -138,6 +138,27 @@ func (b *TailscaleBackend) GetPeerIP(ctx context.Context, hostname string) (stri
 	return ip, nil
 }
 
+// Tailnet returns the name of the tailnet Tailscale is logged in to
+func (b *TailscaleBackend) Tailnet(ctx context.Context) (string, error) {
+	if !b.IsAvailable(ctx) {
+		return "", ErrNotAvailable
+	}
+
+	output, err := exec.CommandContext(ctx, "tailscale", "status", "--json").Output()
+	if err != nil {
+		return "", ErrCommandFailed
+	}
+
+	var status tailscaleStatus
+	if err := json.Unmarshal(output, &status); err != nil {
+		return "", fmt.Errorf("failed to parse Tailscale status: %w", err)
+	}
+	if status.BackendState != "Running" || status.CurrentTailnet == nil {
+		return "", ErrNotConnected
+	}
+	return status.CurrentTailnet.Name, nil
+}
+
 // Priority returns the priority for auto-detection (high priority)
 func (b *TailscaleBackend) Priority() int {
 	return 40
@@ -148,6 +169,14 @@ type tailscaleStatus struct {
 	BackendState string                       `json:"BackendState"`
 	Self         tailscaleSelf                `json:"Self"`
 	Peer         map[string]tailscalePeerInfo `json:"Peer"`
+
+	// CurrentTailnet is missing before Tailscale 1.38 and while logged out
+	CurrentTailnet *tailscaleTailnet `json:"CurrentTailnet"`
+}
+
+// tailscaleTailnet represents the tailnet the local node is part of
+type tailscaleTailnet struct {
+	Name string `json:"Name"`
 }
 
 // tailscaleSelf represents information about the local Tailscale node
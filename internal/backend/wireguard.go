@@ -0,0 +1,318 @@
+// Package backend - WireGuard backend implementation
+// Copyright (c) 2025 orpheus497
+package backend
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// wireGuardHandshakeTimeout is how old a peer's latest handshake may be
+// for the peer to count as online. WireGuard re-handshakes every two
+// minutes on active tunnels, so older handshakes mean the peer is idle
+// or gone.
+const wireGuardHandshakeTimeout = 3 * time.Minute
+
+// wireGuardConfigDir holds wg-quick configuration files, whose peer
+// comments name the peers
+var wireGuardConfigDir = "/etc/wireguard"
+
+// WireGuardBackend implements a plain WireGuard (wg/wg-quick) backend
+// WireGuard has no names for peers, so hostnames are resolved through peer
+// names in wg-quick configuration comments ("# Name = web") or the system
+// resolver, and must map to an address routed to one of the peers.
+type WireGuardBackend struct{}
+
+// wireGuardPeer is a peer from 'wg show all dump'
+type wireGuardPeer struct {
+	iface      string
+	publicKey  string
+	endpoint   string
+	allowedIPs []*net.IPNet
+	handshake  time.Time
+}
+
+// Name returns the backend name
+func (b *WireGuardBackend) Name() string {
+	return "wireguard"
+}
+
+// IsAvailable checks if the wg tool is installed
+func (b *WireGuardBackend) IsAvailable(ctx context.Context) bool {
+	_, err := exec.LookPath("wg")
+	return err == nil
+}
+
+// IsConnected checks if a WireGuard interface with peers is up
+func (b *WireGuardBackend) IsConnected(ctx context.Context) bool {
+	if !b.IsAvailable(ctx) {
+		return false
+	}
+
+	peers, err := b.getPeers(ctx)
+	return err == nil && len(peers) > 0
+}
+
+// GetStatus returns WireGuard status
+func (b *WireGuardBackend) GetStatus(ctx context.Context) (*Status, error) {
+	if !b.IsAvailable(ctx) {
+		return nil, ErrNotAvailable
+	}
+
+	status := &Status{
+		Backend:   b.Name(),
+		LastCheck: time.Now(),
+		Peers:     []PeerInfo{},
+	}
+
+	peers, err := b.getPeers(ctx)
+	if err != nil {
+		status.Message = "Failed to get status (wg show needs root)"
+		return status, ErrCommandFailed
+	}
+
+	if len(peers) == 0 {
+		status.Message = "No WireGuard interfaces with peers"
+		return status, nil
+	}
+
+	status.Connected = true
+	status.LocalIP = interfaceIP(peers[0].iface)
+
+	names := wireGuardPeerNames()
+	online := 0
+	for _, peer := range peers {
+		info := PeerInfo{
+			Hostname: names[peer.publicKey],
+			IP:       peer.address(),
+			Online:   peer.online(),
+			LastSeen: peer.handshake,
+		}
+		if info.Hostname == "" {
+			info.Hostname = peer.shortKey()
+		}
+		if info.Online {
+			online++
+		}
+		status.Peers = append(status.Peers, info)
+	}
+	status.Message = fmt.Sprintf("Connected (%d of %d peers with recent handshake)", online, len(peers))
+
+	return status, nil
+}
+
+// GetPeerIP resolves a hostname to the address of a WireGuard peer
+func (b *WireGuardBackend) GetPeerIP(ctx context.Context, hostname string) (string, error) {
+	peers, err := b.getPeers(ctx)
+	if err != nil || len(peers) == 0 {
+		return "", ErrNotConnected
+	}
+
+	names := wireGuardPeerNames()
+	short, _, _ := strings.Cut(hostname, ".")
+	for _, peer := range peers {
+		name := names[peer.publicKey]
+		if name != "" && (strings.EqualFold(name, hostname) || strings.EqualFold(name, short)) {
+			if ip := peer.address(); ip != "" {
+				return ip, nil
+			}
+		}
+	}
+
+	// Fall back to the system resolver, accepting only addresses routed
+	// through the tunnel
+	var candidates []string
+	if ip := net.ParseIP(hostname); ip != nil {
+		candidates = []string{hostname}
+	} else if addrs, err := net.DefaultResolver.LookupHost(ctx, hostname); err == nil {
+		candidates = addrs
+	}
+
+	for _, addr := range candidates {
+		ip := net.ParseIP(addr)
+		for _, peer := range peers {
+			if peer.routes(ip) {
+				return addr, nil
+			}
+		}
+	}
+
+	return "", ErrPeerNotFound
+}
+
+// Priority returns the priority for auto-detection (between the mesh VPNs and LAN)
+func (b *WireGuardBackend) Priority() int {
+	return 30
+}
+
+// getPeers lists the peers of all WireGuard interfaces
+func (b *WireGuardBackend) getPeers(ctx context.Context) ([]wireGuardPeer, error) {
+	cmd := exec.CommandContext(ctx, "wg", "show", "all", "dump")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: wg show: %v", ErrCommandFailed, err)
+	}
+
+	return parseWireGuardDump(string(output)), nil
+}
+
+// parseWireGuardDump parses the output of 'wg show all dump'. Interface
+// lines have 5 tab-separated fields and peer lines 9:
+// interface, public key, preshared key, endpoint, allowed ips,
+// latest handshake, rx bytes, tx bytes, persistent keepalive
+func parseWireGuardDump(output string) []wireGuardPeer {
+	var peers []wireGuardPeer
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 9 {
+			continue
+		}
+
+		peer := wireGuardPeer{
+			iface:     fields[0],
+			publicKey: fields[1],
+		}
+		if fields[3] != "(none)" {
+			peer.endpoint = fields[3]
+		}
+		for _, cidr := range strings.Split(fields[4], ",") {
+			if _, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr)); err == nil {
+				peer.allowedIPs = append(peer.allowedIPs, ipNet)
+			}
+		}
+		if secs, err := strconv.ParseInt(fields[5], 10, 64); err == nil && secs > 0 {
+			peer.handshake = time.Unix(secs, 0)
+		}
+
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
+
+// address returns the peer's tunnel address: the first single-host entry
+// in its allowed IPs
+func (p *wireGuardPeer) address() string {
+	for _, ipNet := range p.allowedIPs {
+		ones, bits := ipNet.Mask.Size()
+		if ones == bits {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
+}
+
+// routes reports whether ip is routed to the peer by its allowed IPs
+// Default routes (0.0.0.0/0, ::/0) are ignored, as they would match any host
+func (p *wireGuardPeer) routes(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range p.allowedIPs {
+		if ones, _ := ipNet.Mask.Size(); ones > 0 && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// online reports whether the peer completed a handshake recently
+func (p *wireGuardPeer) online() bool {
+	return !p.handshake.IsZero() && time.Since(p.handshake) < wireGuardHandshakeTimeout
+}
+
+// shortKey abbreviates the peer's public key for display
+func (p *wireGuardPeer) shortKey() string {
+	if len(p.publicKey) > 8 {
+		return p.publicKey[:8] + "…"
+	}
+	return p.publicKey
+}
+
+// wireGuardPeerNames maps peer public keys to names from "# Name = <name>"
+// comments in the [Peer] sections of wg-quick configuration files
+// Unreadable files are skipped.
+func wireGuardPeerNames() map[string]string {
+	names := make(map[string]string)
+
+	files, _ := filepath.Glob(filepath.Join(wireGuardConfigDir, "*.conf"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for key, name := range parseWireGuardPeerNames(string(data)) {
+			names[key] = name
+		}
+	}
+
+	return names
+}
+
+// parseWireGuardPeerNames extracts peer names from a wg-quick configuration
+func parseWireGuardPeerNames(config string) map[string]string {
+	names := make(map[string]string)
+	var name, key string
+	inPeer := false
+
+	flush := func() {
+		if inPeer && name != "" && key != "" {
+			names[key] = name
+		}
+		name, key = "", ""
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") {
+			flush()
+			inPeer = strings.EqualFold(line, "[Peer]")
+			continue
+		}
+
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			k, v, found := strings.Cut(comment, "=")
+			if found && strings.EqualFold(strings.TrimSpace(k), "Name") {
+				name = strings.TrimSpace(v)
+			}
+			continue
+		}
+
+		k, v, found := strings.Cut(line, "=")
+		if found && strings.EqualFold(strings.TrimSpace(k), "PublicKey") {
+			// Keys are base64 and may end in '=', so take everything after the first one
+			key = strings.TrimSpace(v)
+		}
+	}
+	flush()
+
+	return names
+}
+
+// interfaceIP returns the first address of a network interface
+func interfaceIP(name string) string {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return ""
+	}
+	addrs, err := iface.Addrs()
+	if err != nil || len(addrs) == 0 {
+		return ""
+	}
+	if ipNet, ok := addrs[0].(*net.IPNet); ok {
+		return ipNet.IP.String()
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWireGuardDump = "wg0\tcHJpdmF0ZQ==\tcHVibGlj\t51820\toff\n" +
+	"wg0\tQUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=\t(none)\t203.0.113.5:51820\t10.8.0.2/32,192.168.50.0/24\t1700000000\t1024\t2048\t25\n" +
+	"wg0\tWllYV1ZVVFNSUVBPTk1MS0pJSEdGRURDQkE=\t(none)\t(none)\t10.8.0.3/32\t0\t0\t0\toff\n"
+
+func TestParseWireGuardDump(t *testing.T) {
+	peers := parseWireGuardDump(testWireGuardDump)
+	require.Len(t, peers, 2)
+
+	assert.Equal(t, "wg0", peers[0].iface)
+	assert.Equal(t, "QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=", peers[0].publicKey)
+	assert.Equal(t, "203.0.113.5:51820", peers[0].endpoint)
+	assert.Len(t, peers[0].allowedIPs, 2)
+	assert.Equal(t, time.Unix(1700000000, 0), peers[0].handshake)
+	assert.Equal(t, "10.8.0.2", peers[0].address())
+
+	assert.Empty(t, peers[1].endpoint)
+	assert.True(t, peers[1].handshake.IsZero())
+	assert.False(t, peers[1].online())
+	assert.Equal(t, "WllYV1ZV…", peers[1].shortKey())
+}
+
+func TestWireGuardPeerRoutes(t *testing.T) {
+	peers := parseWireGuardDump(testWireGuardDump +
+		"wg1\tZGVmYXVsdA==\t(none)\t198.51.100.1:51820\t0.0.0.0/0,::/0\t0\t0\t0\toff\n")
+	require.Len(t, peers, 3)
+
+	tests := []struct {
+		ip     string
+		peer   int
+		routes bool
+	}{
+		{"10.8.0.2", 0, true},
+		{"192.168.50.17", 0, true},
+		{"10.8.0.3", 0, false},
+		{"10.8.0.3", 1, true},
+		{"8.8.8.8", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.routes, peers[tt.peer].routes(net.ParseIP(tt.ip)))
+		})
+	}
+
+	assert.Empty(t, peers[2].address())
+}
+
+func TestWireGuardPeerOnline(t *testing.T) {
+	peer := wireGuardPeer{handshake: time.Now().Add(-time.Minute)}
+	assert.True(t, peer.online())
+
+	peer.handshake = time.Now().Add(-time.Hour)
+	assert.False(t, peer.online())
+}
+
+func TestParseWireGuardPeerNames(t *testing.T) {
+	config := `[Interface]
+# Name = this-host
+PrivateKey = cHJpdmF0ZQ==
+Address = 10.8.0.1/24
+
+[Peer]
+# Name = web
+PublicKey = QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=
+AllowedIPs = 10.8.0.2/32
+
+[Peer]
+PublicKey = WllYV1ZVVFNSUVBPTk1MS0pJSEdGRURDQkE=
+AllowedIPs = 10.8.0.3/32
+
+[Peer]
+#name=db
+PublicKey=ZGI=
+`
+
+	names := parseWireGuardPeerNames(config)
+	assert.Equal(t, map[string]string{
+		"QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=": "web",
+		"ZGI=":                                 "db",
+	}, names)
+}
+
+func TestWireGuardPeerNamesFromConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	orig := wireGuardConfigDir
+	wireGuardConfigDir = dir
+	defer func() { wireGuardConfigDir = orig }()
+
+	conf := "[Peer]\n# Name = web\nPublicKey = d2Vi\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wg0.conf"), []byte(conf), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("[Peer]\n# Name = x\nPublicKey = eA==\n"), 0600))
+
+	assert.Equal(t, map[string]string{"d2Vi": "web"}, wireGuardPeerNames())
+}
@@ -0,0 +1,363 @@
+// Package backend - ZeroTier backend implementation
+// Copyright (c) 2025 orpheus497
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// zeroTierCentralTokenEnv names the environment variable holding a
+// ZeroTier Central API token, used to look up member names
+const zeroTierCentralTokenEnv = "ZEROTIER_CENTRAL_TOKEN"
+
+// zeroTierOnlineTimeout is how long ago a member may have been seen by
+// the controller to count as online
+const zeroTierOnlineTimeout = 5 * time.Minute
+
+// zeroTierCentralURL is the ZeroTier Central API endpoint
+var zeroTierCentralURL = "https://api.zerotier.com/api/v1"
+
+// ZeroTierBackend implements ZeroTier One backend
+// Member names live in the network controller rather than on the node, so
+// hostnames are resolved through the ZeroTier Central API when
+// ZEROTIER_CENTRAL_TOKEN is set, falling back to the system resolver
+// (e.g. ZeroNSD), accepting only addresses inside a joined network.
+type ZeroTierBackend struct{}
+
+// zeroTierNetwork is a network from 'zerotier-cli -j listnetworks'
+type zeroTierNetwork struct {
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	Status            string   `json:"status"`
+	PortDeviceName    string   `json:"portDeviceName"`
+	AssignedAddresses []string `json:"assignedAddresses"`
+}
+
+// zeroTierPeer is a peer from 'zerotier-cli -j listpeers'
+type zeroTierPeer struct {
+	Address string `json:"address"`
+	Role    string `json:"role"`
+	Latency int    `json:"latency"`
+	Paths   []struct {
+		Active bool   `json:"active"`
+		Addr   string `json:"address"`
+	} `json:"paths"`
+}
+
+// zeroTierMember is a network member from the ZeroTier Central API
+type zeroTierMember struct {
+	Name       string `json:"name"`
+	NodeID     string `json:"nodeId"`
+	LastOnline int64  `json:"lastOnline"`
+	Config     struct {
+		Authorized    bool     `json:"authorized"`
+		IPAssignments []string `json:"ipAssignments"`
+	} `json:"config"`
+}
+
+// Name returns the backend name
+func (b *ZeroTierBackend) Name() string {
+	return "zerotier"
+}
+
+// IsAvailable checks if ZeroTier One is installed
+func (b *ZeroTierBackend) IsAvailable(ctx context.Context) bool {
+	_, err := exec.LookPath("zerotier-cli")
+	return err == nil
+}
+
+// IsConnected checks if ZeroTier has joined at least one network
+func (b *ZeroTierBackend) IsConnected(ctx context.Context) bool {
+	if !b.IsAvailable(ctx) {
+		return false
+	}
+
+	networks, err := b.getNetworks(ctx)
+	return err == nil && len(networks) > 0
+}
+
+// GetStatus returns ZeroTier status
+func (b *ZeroTierBackend) GetStatus(ctx context.Context) (*Status, error) {
+	if !b.IsAvailable(ctx) {
+		return nil, ErrNotAvailable
+	}
+
+	status := &Status{
+		Backend:   b.Name(),
+		LastCheck: time.Now(),
+		Peers:     []PeerInfo{},
+	}
+
+	networks, err := b.getNetworks(ctx)
+	if err != nil {
+		status.Message = "Failed to get status (zerotier-cli needs root)"
+		return status, ErrCommandFailed
+	}
+
+	if len(networks) == 0 {
+		status.Message = "Not joined to any network"
+		return status, nil
+	}
+
+	status.Connected = true
+	status.LocalIP = networks[0].address()
+
+	names := make([]string, 0, len(networks))
+	for _, network := range networks {
+		names = append(names, network.displayName())
+	}
+	status.Message = fmt.Sprintf("Connected to %s", strings.Join(names, ", "))
+
+	if token := os.Getenv(zeroTierCentralTokenEnv); token != "" {
+		for _, network := range networks {
+			members, err := getZeroTierMembers(ctx, token, network.ID)
+			if err != nil {
+				continue
+			}
+			for _, member := range members {
+				status.Peers = append(status.Peers, member.peerInfo())
+			}
+		}
+		return status, nil
+	}
+
+	peers, err := b.getPeers(ctx)
+	if err == nil {
+		for _, peer := range peers {
+			status.Peers = append(status.Peers, PeerInfo{
+				Hostname: peer.Address,
+				Online:   peer.online(),
+			})
+		}
+	}
+
+	return status, nil
+}
+
+// GetPeerIP resolves a member name to its managed IP
+func (b *ZeroTierBackend) GetPeerIP(ctx context.Context, hostname string) (string, error) {
+	networks, err := b.getNetworks(ctx)
+	if err != nil || len(networks) == 0 {
+		return "", ErrNotConnected
+	}
+
+	return resolveZeroTierPeer(ctx, networks, hostname)
+}
+
+// resolveZeroTierPeer resolves hostname to a managed IP in one of networks
+func resolveZeroTierPeer(ctx context.Context, networks []zeroTierNetwork, hostname string) (string, error) {
+	var apiErr error
+	if token := os.Getenv(zeroTierCentralTokenEnv); token != "" {
+		short, _, _ := strings.Cut(hostname, ".")
+		for _, network := range networks {
+			members, err := getZeroTierMembers(ctx, token, network.ID)
+			if err != nil {
+				// An unreachable API must not hide names the system
+				// resolver knows
+				apiErr = err
+				continue
+			}
+			for _, member := range members {
+				if member.matches(hostname) || member.matches(short) {
+					if ip := member.address(); ip != "" {
+						return ip, nil
+					}
+				}
+			}
+		}
+	}
+
+	// Fall back to the system resolver, accepting only addresses inside a
+	// joined network
+	var candidates []string
+	if ip := net.ParseIP(hostname); ip != nil {
+		candidates = []string{hostname}
+	} else if addrs, err := net.DefaultResolver.LookupHost(ctx, hostname); err == nil {
+		candidates = addrs
+	}
+
+	for _, addr := range candidates {
+		ip := net.ParseIP(addr)
+		for _, network := range networks {
+			if network.contains(ip) {
+				return addr, nil
+			}
+		}
+	}
+
+	if apiErr != nil {
+		return "", fmt.Errorf("%w: %v", ErrPeerNotFound, apiErr)
+	}
+	return "", ErrPeerNotFound
+}
+
+// Priority returns the priority for auto-detection (between the mesh VPNs and WireGuard)
+func (b *ZeroTierBackend) Priority() int {
+	return 35
+}
+
+// getNetworks lists the joined networks that are up
+func (b *ZeroTierBackend) getNetworks(ctx context.Context) ([]zeroTierNetwork, error) {
+	cmd := exec.CommandContext(ctx, "zerotier-cli", "-j", "listnetworks")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: zerotier-cli listnetworks: %v", ErrCommandFailed, err)
+	}
+
+	return parseZeroTierNetworks(output)
+}
+
+// getPeers lists the nodes this node talks to directly
+func (b *ZeroTierBackend) getPeers(ctx context.Context) ([]zeroTierPeer, error) {
+	cmd := exec.CommandContext(ctx, "zerotier-cli", "-j", "listpeers")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: zerotier-cli listpeers: %v", ErrCommandFailed, err)
+	}
+
+	return parseZeroTierPeers(output)
+}
+
+// parseZeroTierNetworks parses 'zerotier-cli -j listnetworks', keeping only
+// networks with status OK and an assigned address
+func parseZeroTierNetworks(data []byte) ([]zeroTierNetwork, error) {
+	var all []zeroTierNetwork
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse ZeroTier networks: %w", err)
+	}
+
+	var networks []zeroTierNetwork
+	for _, network := range all {
+		if network.Status == "OK" && len(network.AssignedAddresses) > 0 {
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
+}
+
+// parseZeroTierPeers parses 'zerotier-cli -j listpeers', dropping the
+// root servers (planets and moons)
+func parseZeroTierPeers(data []byte) ([]zeroTierPeer, error) {
+	var all []zeroTierPeer
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse ZeroTier peers: %w", err)
+	}
+
+	var peers []zeroTierPeer
+	for _, peer := range all {
+		if peer.Role == "LEAF" {
+			peers = append(peers, peer)
+		}
+	}
+	return peers, nil
+}
+
+// getZeroTierMembers lists the members of a network from ZeroTier Central
+func getZeroTierMembers(ctx context.Context, token, networkID string) ([]zeroTierMember, error) {
+	url := fmt.Sprintf("%s/network/%s/member", zeroTierCentralURL, networkID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ZeroTier Central request: %w", err)
+	}
+	req.Header.Set("Authorization", "token "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ZeroTier Central: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list members of network %s: ZeroTier Central returned %s", networkID, resp.Status)
+	}
+
+	var members []zeroTierMember
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, fmt.Errorf("failed to parse ZeroTier members: %w", err)
+	}
+	return members, nil
+}
+
+// address returns the node's first address in the network
+func (n *zeroTierNetwork) address() string {
+	for _, cidr := range n.AssignedAddresses {
+		if ip, _, err := net.ParseCIDR(cidr); err == nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// contains reports whether ip is inside one of the network's subnets
+func (n *zeroTierNetwork) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range n.AssignedAddresses {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayName returns the network name, or its ID if it has none
+func (n *zeroTierNetwork) displayName() string {
+	if n.Name != "" {
+		return n.Name
+	}
+	return n.ID
+}
+
+// online reports whether the peer has an active direct or relayed path
+func (p *zeroTierPeer) online() bool {
+	for _, path := range p.Paths {
+		if path.Active {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether name is the member's name or node ID
+func (m *zeroTierMember) matches(name string) bool {
+	return name != "" && (strings.EqualFold(m.Name, name) || strings.EqualFold(m.NodeID, name))
+}
+
+// address returns the member's first managed IP
+func (m *zeroTierMember) address() string {
+	if !m.Config.Authorized || len(m.Config.IPAssignments) == 0 {
+		return ""
+	}
+	return m.Config.IPAssignments[0]
+}
+
+// lastSeen returns when the controller last heard from the member
+func (m *zeroTierMember) lastSeen() time.Time {
+	if m.LastOnline <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(m.LastOnline)
+}
+
+// peerInfo converts the member for status output
+func (m *zeroTierMember) peerInfo() PeerInfo {
+	info := PeerInfo{
+		Hostname: m.Name,
+		IP:       m.address(),
+		LastSeen: m.lastSeen(),
+	}
+	if info.Hostname == "" {
+		info.Hostname = m.NodeID
+	}
+	info.Online = !info.LastSeen.IsZero() && time.Since(info.LastSeen) < zeroTierOnlineTimeout
+	return info
+}
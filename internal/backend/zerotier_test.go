@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseZeroTierNetworks(t *testing.T) {
+	data := []byte(`[
+		{"id": "8056c2e21c000001", "name": "home", "status": "OK", "portDeviceName": "ztabc",
+		 "assignedAddresses": ["10.147.17.5/24", "fd80:56c2:e21c::1/88"]},
+		{"id": "8056c2e21c000002", "name": "", "status": "REQUESTING_CONFIGURATION", "assignedAddresses": []},
+		{"id": "8056c2e21c000003", "name": "", "status": "OK", "assignedAddresses": ["172.22.0.9/16"]}
+	]`)
+
+	networks, err := parseZeroTierNetworks(data)
+	require.NoError(t, err)
+	require.Len(t, networks, 2)
+
+	assert.Equal(t, "home", networks[0].displayName())
+	assert.Equal(t, "10.147.17.5", networks[0].address())
+	assert.True(t, networks[0].contains(net.ParseIP("10.147.17.200")))
+	assert.False(t, networks[0].contains(net.ParseIP("10.147.18.1")))
+	assert.Equal(t, "8056c2e21c000003", networks[1].displayName())
+
+	_, err = parseZeroTierNetworks([]byte("200 listnetworks <nwid> ..."))
+	assert.Error(t, err)
+}
+
+func TestParseZeroTierPeers(t *testing.T) {
+	data := []byte(`[
+		{"address": "62f865ae71", "role": "PLANET", "latency": 80, "paths": [{"active": true, "address": "50.7.252.138/9993"}]},
+		{"address": "a1b2c3d4e5", "role": "LEAF", "latency": 4, "paths": [{"active": true, "address": "192.168.1.20/9993"}]},
+		{"address": "f6e5d4c3b2", "role": "LEAF", "latency": -1, "paths": []}
+	]`)
+
+	peers, err := parseZeroTierPeers(data)
+	require.NoError(t, err)
+	require.Len(t, peers, 2)
+
+	assert.Equal(t, "a1b2c3d4e5", peers[0].Address)
+	assert.True(t, peers[0].online())
+	assert.False(t, peers[1].online())
+}
+
+func TestGetZeroTierMembers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/network/8056c2e21c000001/member", r.URL.Path)
+		w.Write([]byte(`[
+			{"name": "web", "nodeId": "a1b2c3d4e5", "lastOnline": ` + strconv.FormatInt(time.Now().UnixMilli(), 10) + `,
+			 "config": {"authorized": true, "ipAssignments": ["10.147.17.20"]}},
+			{"name": "", "nodeId": "f6e5d4c3b2", "lastOnline": 0,
+			 "config": {"authorized": false, "ipAssignments": ["10.147.17.21"]}}
+		]`))
+	}))
+	defer server.Close()
+
+	orig := zeroTierCentralURL
+	zeroTierCentralURL = server.URL
+	defer func() { zeroTierCentralURL = orig }()
+
+	_, err := getZeroTierMembers(context.Background(), "wrong", "8056c2e21c000001")
+	assert.ErrorContains(t, err, "401")
+
+	members, err := getZeroTierMembers(context.Background(), "secret", "8056c2e21c000001")
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+
+	assert.True(t, members[0].matches("WEB"))
+	assert.True(t, members[0].matches("a1b2c3d4e5"))
+	assert.False(t, members[0].matches(""))
+
+	info := members[0].peerInfo()
+	assert.Equal(t, "web", info.Hostname)
+	assert.Equal(t, "10.147.17.20", info.IP)
+	assert.True(t, info.Online)
+
+	info = members[1].peerInfo()
+	assert.Equal(t, "f6e5d4c3b2", info.Hostname)
+	assert.Empty(t, info.IP, "unauthorized members have no usable address")
+	assert.False(t, info.Online)
+}
+
+func TestResolveZeroTierPeer(t *testing.T) {
+	networks, err := parseZeroTierNetworks([]byte(`[
+		{"id": "8056c2e21c000001", "name": "home", "status": "OK", "assignedAddresses": ["10.147.17.5/24"]}
+	]`))
+	require.NoError(t, err)
+
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`[{"name": "web", "nodeId": "a1b2c3d4e5", "config": {"authorized": true, "ipAssignments": ["10.147.17.20"]}}]`))
+	}))
+	defer server.Close()
+
+	orig := zeroTierCentralURL
+	zeroTierCentralURL = server.URL
+	defer func() { zeroTierCentralURL = orig }()
+	t.Setenv(zeroTierCentralTokenEnv, "secret")
+
+	ip, err := resolveZeroTierPeer(context.Background(), networks, "web.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "10.147.17.20", ip)
+
+	// Without the API, names are left to the system resolver; addresses
+	// resolve to themselves if they are inside a joined network
+	failing = true
+	ip, err = resolveZeroTierPeer(context.Background(), networks, "10.147.17.30")
+	require.NoError(t, err)
+	assert.Equal(t, "10.147.17.30", ip)
+
+	_, err = resolveZeroTierPeer(context.Background(), networks, "10.147.18.30")
+	assert.ErrorIs(t, err, ErrPeerNotFound)
+	assert.ErrorContains(t, err, "500")
+}
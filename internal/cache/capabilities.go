@@ -0,0 +1,68 @@
+// Package cache provides on-disk caches of remote host information for klip
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"time"
+
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// DefaultCapabilityTTL is how long detected capabilities are trusted
+const DefaultCapabilityTTL = 24 * time.Hour
+
+// CapabilityEntry is a cached capability record for a single profile
+type CapabilityEntry struct {
+	// Host is the address the capabilities were detected on
+	// A profile pointing at a different host invalidates the entry
+	Host string `json:"host"`
+
+	// KlipVersion is the klip release that detected the capabilities
+	// Another release may probe for more, so it invalidates the entry
+	KlipVersion string `json:"klip_version"`
+
+	// Capabilities are the detected remote capabilities
+	Capabilities ssh.RemoteCapabilities `json:"capabilities"`
+}
+
+// Capabilities returns cached capabilities for a profile if they are still
+// valid for the given host
+func (s *Store) Capabilities(profile, host string) (*ssh.RemoteCapabilities, bool) {
+	state, err := s.Load()
+	if err != nil {
+		return nil, false
+	}
+
+	entry, exists := state.Capabilities[profile]
+	if !exists || entry.Host != host || s.CapabilitiesStale(entry) {
+		return nil, false
+	}
+
+	caps := entry.Capabilities
+	return &caps, true
+}
+
+// SetCapabilities stores capabilities for a profile
+func (s *Store) SetCapabilities(profile, host string, caps *ssh.RemoteCapabilities) error {
+	return s.update(func(state *State) {
+		state.Capabilities[profile] = CapabilityEntry{
+			Host:         host,
+			KlipVersion:  s.klipVersion,
+			Capabilities: *caps,
+		}
+	})
+}
+
+// InvalidateCapabilities removes the cached capabilities for a profile
+func (s *Store) InvalidateCapabilities(profile string) error {
+	return s.update(func(state *State) {
+		delete(state.Capabilities, profile)
+	})
+}
+
+// CapabilitiesStale reports whether entry has expired or was detected by
+// another klip release
+func (s *Store) CapabilitiesStale(entry CapabilityEntry) bool {
+	return entry.KlipVersion != s.klipVersion ||
+		s.now().Sub(entry.Capabilities.DetectedAt) > s.capabilityTTL
+}
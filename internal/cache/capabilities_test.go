@@ -0,0 +1,67 @@
+// Package cache tests
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *Store {
+	return newStore(filepath.Join(t.TempDir(), StateFileName))
+}
+
+func TestCapabilityCache(t *testing.T) {
+	t.Run("returns stored capabilities for matching host", func(t *testing.T) {
+		s := newTestStore(t)
+		caps := &ssh.RemoteCapabilities{OS: "Linux", HomeDir: "/home/user", HasRsync: true, DetectedAt: time.Now()}
+
+		require.NoError(t, s.SetCapabilities("work", "workbox", caps))
+
+		got, ok := s.Capabilities("work", "workbox")
+		require.True(t, ok)
+		assert.Equal(t, "Linux", got.OS)
+		assert.Equal(t, "/home/user", got.HomeDir)
+		assert.True(t, got.HasRsync)
+	})
+
+	t.Run("host change invalidates entry", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetCapabilities("work", "workbox", &ssh.RemoteCapabilities{DetectedAt: time.Now()}))
+
+		_, ok := s.Capabilities("work", "otherbox")
+		assert.False(t, ok)
+	})
+
+	t.Run("expired entry is ignored", func(t *testing.T) {
+		s := newTestStore(t)
+		old := &ssh.RemoteCapabilities{DetectedAt: time.Now().Add(-2 * DefaultCapabilityTTL)}
+		require.NoError(t, s.SetCapabilities("work", "workbox", old))
+
+		_, ok := s.Capabilities("work", "workbox")
+		assert.False(t, ok)
+	})
+
+	t.Run("another klip release invalidates entry", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetCapabilities("work", "workbox", &ssh.RemoteCapabilities{DetectedAt: time.Now()}))
+
+		s.klipVersion = "99.0.0"
+		_, ok := s.Capabilities("work", "workbox")
+		assert.False(t, ok)
+	})
+
+	t.Run("invalidate removes entry", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetCapabilities("work", "workbox", &ssh.RemoteCapabilities{DetectedAt: time.Now()}))
+		require.NoError(t, s.InvalidateCapabilities("work"))
+
+		_, ok := s.Capabilities("work", "workbox")
+		assert.False(t, ok)
+	})
+}
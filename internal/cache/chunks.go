@@ -0,0 +1,189 @@
+// Package cache - Content hashes of previously pushed chunks
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	// ChunksDirName is the directory under the cache directory holding one
+	// chunk cache per profile
+	ChunksDirName = "chunks"
+
+	// MaxChunkFiles is how many remote files are remembered per profile;
+	// the least recently pushed are forgotten first
+	MaxChunkFiles = 256
+)
+
+// ChunkFile records the chunk hashes of a file pushed to the remote host,
+// with the size and modification time it had afterwards so a file changed
+// since is not trusted
+type ChunkFile struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Chunks   []string  `json:"chunks"`
+	Recorded time.Time `json:"recorded"`
+}
+
+// ChunkLocation is where a chunk can be found on the remote host
+type ChunkLocation struct {
+	// Path is the remote file holding the chunk
+	Path string
+
+	// Offset is the chunk's offset in the file
+	Offset int64
+
+	// Size and ModTime are those of the file when it was recorded
+	Size    int64
+	ModTime time.Time
+}
+
+// chunkCacheFile is the on-disk form of a chunk cache
+type chunkCacheFile struct {
+	ChunkSize int64                 `json:"chunk_size"`
+	Files     map[string]*ChunkFile `json:"files"`
+}
+
+// ChunkCache remembers the content hashes of fixed-size chunks of files
+// pushed to one profile's host, so chunks already present there can be
+// copied server-side instead of sent again, even under another file name
+// Thread-safe implementation backed by a JSON file
+type ChunkCache struct {
+	path      string
+	chunkSize int64
+	files     map[string]*ChunkFile
+	index     map[string]ChunkLocation
+	mu        sync.Mutex
+}
+
+// ChunksPath returns the XDG-compliant path to a profile's chunk cache
+func ChunksPath(profile string) (string, error) {
+	dir := filepath.Join(xdg.CacheHome, "klip", ChunksDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create chunk cache directory: %w", err)
+	}
+	return filepath.Join(dir, profile+".json"), nil
+}
+
+// LoadChunkCache loads a profile's chunk cache for chunks of chunkSize
+// bytes. A missing or corrupt cache, or one recorded with another chunk
+// size, yields an empty cache.
+func LoadChunkCache(profile string, chunkSize int64) (*ChunkCache, error) {
+	path, err := ChunksPath(profile)
+	if err != nil {
+		return nil, err
+	}
+	return LoadChunkCacheFile(path, chunkSize)
+}
+
+// LoadChunkCacheFile loads the chunk cache stored at path
+func LoadChunkCacheFile(path string, chunkSize int64) (*ChunkCache, error) {
+	c := &ChunkCache{
+		path:      path,
+		chunkSize: chunkSize,
+		files:     make(map[string]*ChunkFile),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read chunk cache: %w", err)
+	}
+	if err == nil {
+		// The cache is disposable; start over rather than failing
+		var stored chunkCacheFile
+		if json.Unmarshal(data, &stored) == nil && stored.ChunkSize == chunkSize && stored.Files != nil {
+			c.files = stored.Files
+		}
+	}
+
+	c.reindex()
+	return c, nil
+}
+
+// Lookup returns a location of a chunk with the given hash, in the most
+// recently pushed file containing it
+func (c *ChunkCache) Lookup(hash string) (ChunkLocation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	loc, ok := c.index[hash]
+	return loc, ok
+}
+
+// Record remembers the chunk hashes of a file pushed to path, replacing
+// what was known about it, and writes the cache to disk
+func (c *ChunkCache) Record(path string, size int64, modTime time.Time, chunks []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files[path] = &ChunkFile{Size: size, ModTime: modTime, Chunks: chunks, Recorded: time.Now()}
+	for len(c.files) > MaxChunkFiles {
+		oldest := ""
+		for name, f := range c.files {
+			if oldest == "" || f.Recorded.Before(c.files[oldest].Recorded) {
+				oldest = name
+			}
+		}
+		delete(c.files, oldest)
+	}
+
+	c.reindex()
+	return c.save()
+}
+
+// Forget drops files whose chunks turned out not to match, and writes the
+// cache to disk
+func (c *ChunkCache) Forget(paths ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, path := range paths {
+		delete(c.files, path)
+	}
+
+	c.reindex()
+	return c.save()
+}
+
+// reindex rebuilds the hash index, newest files last so their locations
+// win; callers must hold c.mu (or own c exclusively)
+func (c *ChunkCache) reindex() {
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.files[names[i]].Recorded.Before(c.files[names[j]].Recorded)
+	})
+
+	c.index = make(map[string]ChunkLocation)
+	for _, name := range names {
+		f := c.files[name]
+		for i, hash := range f.Chunks {
+			c.index[hash] = ChunkLocation{Path: name, Offset: int64(i) * c.chunkSize, Size: f.Size, ModTime: f.ModTime}
+		}
+	}
+}
+
+// save writes the cache to disk; callers must hold c.mu
+func (c *ChunkCache) save() error {
+	data, err := json.Marshal(chunkCacheFile{ChunkSize: c.chunkSize, Files: c.files})
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk cache: %w", err)
+	}
+
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write chunk cache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package cache tests
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "work.json")
+	modTime := time.Unix(1700000000, 0)
+
+	c, err := LoadChunkCacheFile(path, 8)
+	require.NoError(t, err)
+	require.NoError(t, c.Record("/srv/a.tar", 16, modTime, []string{"h1", "h2"}))
+	require.NoError(t, c.Record("/srv/b.tar", 12, modTime, []string{"h2", "h3"}))
+
+	// The most recently pushed file wins, and the cache survives a reload
+	c, err = LoadChunkCacheFile(path, 8)
+	require.NoError(t, err)
+	loc, ok := c.Lookup("h2")
+	require.True(t, ok)
+	assert.Equal(t, "/srv/b.tar", loc.Path)
+	assert.Equal(t, int64(0), loc.Offset)
+	assert.Equal(t, int64(12), loc.Size)
+	assert.True(t, modTime.Equal(loc.ModTime))
+	loc, ok = c.Lookup("h1")
+	require.True(t, ok)
+	assert.Equal(t, int64(0), loc.Offset)
+	loc, ok = c.Lookup("h3")
+	require.True(t, ok)
+	assert.Equal(t, int64(8), loc.Offset)
+
+	require.NoError(t, c.Forget("/srv/b.tar"))
+	loc, ok = c.Lookup("h2")
+	require.True(t, ok)
+	assert.Equal(t, "/srv/a.tar", loc.Path)
+	assert.Equal(t, int64(8), loc.Offset)
+
+	// A different chunk size invalidates everything
+	c, err = LoadChunkCacheFile(path, 16)
+	require.NoError(t, err)
+	_, ok = c.Lookup("h1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,81 @@
+// Package cache - Backend hostname resolutions
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultResolutionTTL is how long a backend's resolution of a host is
+// trusted. VPN addresses rarely change, and a connection that fails on a
+// cached address drops it anyway.
+const DefaultResolutionTTL = time.Hour
+
+// ResolutionEntry is the address a backend resolved a host to
+type ResolutionEntry struct {
+	Address    string    `json:"address"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// resolutionKey is the key of a backend's resolution of host
+func resolutionKey(backend, host string) string {
+	return backend + "/" + host
+}
+
+// Resolution returns the address backend last resolved host to, if it is
+// still trusted
+func (s *Store) Resolution(backend, host string) (string, bool) {
+	state, err := s.Load()
+	if err != nil {
+		return "", false
+	}
+
+	entry, exists := state.Resolutions[resolutionKey(backend, host)]
+	if !exists || s.ResolutionExpired(entry) {
+		return "", false
+	}
+	return entry.Address, true
+}
+
+// SetResolution stores the address backend resolved host to
+func (s *Store) SetResolution(backend, host, address string) error {
+	return s.update(func(state *State) {
+		state.Resolutions[resolutionKey(backend, host)] = ResolutionEntry{
+			Address:    address,
+			ResolvedAt: s.now(),
+		}
+	})
+}
+
+// InvalidateResolution removes backend's cached resolution of host
+func (s *Store) InvalidateResolution(backend, host string) error {
+	return s.update(func(state *State) {
+		delete(state.Resolutions, resolutionKey(backend, host))
+	})
+}
+
+// ResolutionExpired reports whether entry is older than the resolution TTL
+func (s *Store) ResolutionExpired(entry ResolutionEntry) bool {
+	return s.now().Sub(entry.ResolvedAt) > s.resolutionTTL
+}
+
+// PeerBackends returns the VPN backends whose resolutions of host are in
+// the cache file, whether or not they are still trusted
+func (s *Store) PeerBackends(host string) []string {
+	state, err := s.Load()
+	if err != nil {
+		return nil
+	}
+
+	var backends []string
+	for key := range state.Resolutions {
+		backend, name, ok := strings.Cut(key, "/")
+		if ok && name == host && backend != "lan" {
+			backends = append(backends, backend)
+		}
+	}
+	sort.Strings(backends)
+	return backends
+}
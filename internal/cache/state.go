@@ -0,0 +1,277 @@
+// Package cache - Shared cache file of resolutions, capabilities and usage
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/filelock"
+	"github.com/orpheus497/klip/internal/version"
+)
+
+const (
+	// StateFileName is the name of the cache file in klip's state directory
+	StateFileName = "cache.json"
+
+	// StateVersion is the version of the cache file format; a file of
+	// another version is discarded rather than migrated
+	StateVersion = 1
+
+	// legacyCapabilitiesFileName is the capability cache used before the
+	// shared cache file, removed when the store is opened
+	legacyCapabilitiesFileName = "capabilities.json"
+)
+
+// Sections of the cache file, as named by klip cache clear
+const (
+	SectionResolutions  = "resolutions"
+	SectionCapabilities = "capabilities"
+	SectionUsage        = "usage"
+)
+
+// Sections lists the sections of the cache file in the order they are shown
+var Sections = []string{SectionResolutions, SectionCapabilities, SectionUsage}
+
+// State is the content of the cache file
+type State struct {
+	// Version is the format version, StateVersion when written
+	Version int `json:"version"`
+
+	// Resolutions maps "<backend>/<host>" to the address the backend
+	// resolved the host to
+	Resolutions map[string]ResolutionEntry `json:"resolutions"`
+
+	// Capabilities maps a profile name to its remote host's capabilities
+	Capabilities map[string]CapabilityEntry `json:"capabilities"`
+
+	// Usage maps a profile name to how often it was used
+	Usage map[string]UsageEntry `json:"usage"`
+}
+
+// newState returns an empty state of the current version
+func newState() *State {
+	return &State{
+		Version:      StateVersion,
+		Resolutions:  make(map[string]ResolutionEntry),
+		Capabilities: make(map[string]CapabilityEntry),
+		Usage:        make(map[string]UsageEntry),
+	}
+}
+
+// Store reads and updates the cache file. Every update rereads the file
+// and replaces it atomically while holding a lock on it, so concurrent
+// klip processes and goroutines never lose each other's updates.
+type Store struct {
+	path string
+	mu   sync.Mutex
+
+	// resolutionTTL and capabilityTTL are how long entries are trusted
+	resolutionTTL time.Duration
+	capabilityTTL time.Duration
+
+	// klipVersion is recorded with capabilities, whose probe changes
+	// between releases
+	klipVersion string
+
+	// now returns the current time
+	now func() time.Time
+}
+
+// StatePath returns the XDG-compliant path to the cache file
+func StatePath() (string, error) {
+	stateDir := filepath.Join(xdg.StateHome, "klip")
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return filepath.Join(stateDir, StateFileName), nil
+}
+
+// OpenStore opens the cache file in klip's state directory
+func OpenStore() (*Store, error) {
+	path, err := StatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	// The capabilities now live in the shared file
+	os.Remove(filepath.Join(xdg.CacheHome, "klip", legacyCapabilitiesFileName))
+
+	return newStore(path), nil
+}
+
+// newStore returns a store for the cache file at path
+func newStore(path string) *Store {
+	return &Store{
+		path:          path,
+		resolutionTTL: DefaultResolutionTTL,
+		capabilityTTL: DefaultCapabilityTTL,
+		klipVersion:   version.Version,
+		now:           time.Now,
+	}
+}
+
+// Path returns the path of the cache file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Load returns the content of the cache file, including expired entries
+// that have not been dropped yet
+func (s *Store) Load() (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Clear empties the given sections of the cache file, or removes the file
+// if no sections are given
+func (s *Store) Clear(sections ...string) error {
+	for _, section := range sections {
+		if !validSection(section) {
+			return fmt.Errorf("unknown cache section '%s'", section)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(sections) == 0 {
+		unlock, err := filelock.Lock(s.path)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove cache file: %w", err)
+		}
+		return nil
+	}
+
+	return s.updateLocked(func(state *State) {
+		for _, section := range sections {
+			switch section {
+			case SectionResolutions:
+				state.Resolutions = make(map[string]ResolutionEntry)
+			case SectionCapabilities:
+				state.Capabilities = make(map[string]CapabilityEntry)
+			case SectionUsage:
+				state.Usage = make(map[string]UsageEntry)
+			}
+		}
+	})
+}
+
+// validSection reports whether name is a section of the cache file
+func validSection(name string) bool {
+	for _, section := range Sections {
+		if section == name {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the cache file; callers must hold s.mu
+// A missing, corrupt or other-version file yields an empty state
+func (s *Store) load() (*State, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return newState(), nil
+		}
+		return nil, fmt.Errorf("failed to read cache file: %w", err)
+	}
+
+	state := newState()
+	if err := json.Unmarshal(data, state); err != nil || state.Version != StateVersion {
+		// The cache is disposable; start over rather than failing
+		return newState(), nil
+	}
+
+	// Sections missing from the file decode as nil maps
+	if state.Resolutions == nil {
+		state.Resolutions = make(map[string]ResolutionEntry)
+	}
+	if state.Capabilities == nil {
+		state.Capabilities = make(map[string]CapabilityEntry)
+	}
+	if state.Usage == nil {
+		state.Usage = make(map[string]UsageEntry)
+	}
+	return state, nil
+}
+
+// update applies change to the cache file, dropping expired entries
+func (s *Store) update(change func(state *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateLocked(change)
+}
+
+// updateLocked is update for callers holding s.mu. The file lock keeps
+// other processes from updating the file between the read and the write.
+func (s *Store) updateLocked(change func(state *State)) error {
+	unlock, err := filelock.Lock(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	change(state)
+	s.prune(state)
+	return s.save(state)
+}
+
+// prune drops the resolutions and capabilities that are no longer trusted
+func (s *Store) prune(state *State) {
+	for key, entry := range state.Resolutions {
+		if s.ResolutionExpired(entry) {
+			delete(state.Resolutions, key)
+		}
+	}
+	for profile, entry := range state.Capabilities {
+		if s.CapabilitiesStale(entry) {
+			delete(state.Capabilities, profile)
+		}
+	}
+}
+
+// save writes state to the cache file through a temporary file of its own,
+// so readers never see a partial file; callers must hold s.mu and the file
+// lock
+func (s *Store) save(state *State) error {
+	state.Version = StateVersion
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	return nil
+}
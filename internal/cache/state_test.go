@@ -0,0 +1,172 @@
+// Package cache tests
+// Copyright (c) 2025 orpheus497
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolutionCache(t *testing.T) {
+	t.Run("returns stored address for backend and host", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetResolution("tailscale", "workbox", "100.64.0.7"))
+
+		address, ok := s.Resolution("tailscale", "workbox")
+		require.True(t, ok)
+		assert.Equal(t, "100.64.0.7", address)
+
+		_, ok = s.Resolution("netbird", "workbox")
+		assert.False(t, ok, "another backend must resolve the host itself")
+	})
+
+	t.Run("expired entry is ignored and dropped", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetResolution("tailscale", "workbox", "100.64.0.7"))
+
+		s.now = func() time.Time { return time.Now().Add(2 * DefaultResolutionTTL) }
+		_, ok := s.Resolution("tailscale", "workbox")
+		assert.False(t, ok)
+
+		require.NoError(t, s.SetResolution("tailscale", "otherbox", "100.64.0.8"))
+		state, err := s.Load()
+		require.NoError(t, err)
+		assert.NotContains(t, state.Resolutions, "tailscale/workbox")
+		assert.Contains(t, state.Resolutions, "tailscale/otherbox")
+	})
+
+	t.Run("invalidate removes entry", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetResolution("tailscale", "workbox", "100.64.0.7"))
+		require.NoError(t, s.InvalidateResolution("tailscale", "workbox"))
+
+		_, ok := s.Resolution("tailscale", "workbox")
+		assert.False(t, ok)
+	})
+
+	t.Run("peer backends include expired entries", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetResolution("tailscale", "workbox", "100.64.0.7"))
+		require.NoError(t, s.SetResolution("netbird", "workbox", "100.92.0.7"))
+		require.NoError(t, s.SetResolution("netbird", "otherbox", "100.92.0.8"))
+
+		s.now = func() time.Time { return time.Now().Add(2 * DefaultResolutionTTL) }
+		assert.Equal(t, []string{"netbird", "tailscale"}, s.PeerBackends("workbox"))
+		assert.Empty(t, s.PeerBackends("thirdbox"))
+	})
+}
+
+func TestRecordUsage(t *testing.T) {
+	s := newTestStore(t)
+	require.NoError(t, s.RecordUsage("work", ActivityConnect))
+	require.NoError(t, s.RecordUsage("work", ActivityConnect))
+	require.NoError(t, s.RecordUsage("work", ActivityPush))
+	require.NoError(t, s.RecordUsage("work", ActivityPull))
+
+	state, err := s.Load()
+	require.NoError(t, err)
+	usage := state.Usage["work"]
+	assert.Equal(t, 2, usage.Connections)
+	assert.Equal(t, 1, usage.Pushes)
+	assert.Equal(t, 1, usage.Pulls)
+	assert.False(t, usage.LastUsed.IsZero())
+}
+
+func TestConcurrentStores(t *testing.T) {
+	// Separate stores on one file stand in for separate klip processes
+	path := newTestStore(t).Path()
+	const workers, rounds = 6, 10
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := newStore(path)
+			for j := 0; j < rounds; j++ {
+				assert.NoError(t, s.RecordUsage("work", ActivityConnect))
+			}
+		}()
+	}
+	wg.Wait()
+
+	state, err := newStore(path).Load()
+	require.NoError(t, err)
+	assert.Equal(t, workers*rounds, state.Usage["work"].Connections)
+
+	// No temporary file is left behind
+	matches, err := filepath.Glob(path + ".*.tmp")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestStoreFileFormat(t *testing.T) {
+	t.Run("sections share one versioned file", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetResolution("tailscale", "workbox", "100.64.0.7"))
+		require.NoError(t, s.SetCapabilities("work", "workbox", &ssh.RemoteCapabilities{DetectedAt: time.Now()}))
+		require.NoError(t, s.RecordUsage("work", ActivityConnect))
+
+		state, err := newStore(s.Path()).Load()
+		require.NoError(t, err)
+		assert.Equal(t, StateVersion, state.Version)
+		assert.Len(t, state.Resolutions, 1)
+		assert.Len(t, state.Capabilities, 1)
+		assert.Len(t, state.Usage, 1)
+	})
+
+	t.Run("other version is discarded", func(t *testing.T) {
+		s := newTestStore(t)
+		data := `{"version": 99, "usage": {"work": {"connections": 3}}}`
+		require.NoError(t, os.WriteFile(s.Path(), []byte(data), 0600))
+
+		state, err := s.Load()
+		require.NoError(t, err)
+		assert.Empty(t, state.Usage)
+	})
+
+	t.Run("corrupt file is discarded", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, os.WriteFile(s.Path(), []byte("{"), 0600))
+
+		require.NoError(t, s.RecordUsage("work", ActivityPush))
+		state, err := s.Load()
+		require.NoError(t, err)
+		assert.Equal(t, 1, state.Usage["work"].Pushes)
+	})
+}
+
+func TestStoreClear(t *testing.T) {
+	t.Run("clears one section", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.SetResolution("tailscale", "workbox", "100.64.0.7"))
+		require.NoError(t, s.RecordUsage("work", ActivityConnect))
+
+		require.NoError(t, s.Clear(SectionResolutions))
+		state, err := s.Load()
+		require.NoError(t, err)
+		assert.Empty(t, state.Resolutions)
+		assert.Len(t, state.Usage, 1)
+	})
+
+	t.Run("removes the file without sections", func(t *testing.T) {
+		s := newTestStore(t)
+		require.NoError(t, s.RecordUsage("work", ActivityConnect))
+
+		require.NoError(t, s.Clear())
+		_, err := os.Stat(s.Path())
+		assert.True(t, os.IsNotExist(err))
+		require.NoError(t, s.Clear())
+	})
+
+	t.Run("rejects unknown sections", func(t *testing.T) {
+		s := newTestStore(t)
+		assert.Error(t, s.Clear("chunks"))
+	})
+}
@@ -0,0 +1,38 @@
+// Package cache - Profile usage statistics
+// Copyright (c) 2025 orpheus497
+package cache
+
+import "time"
+
+// Activities recorded in usage statistics
+const (
+	ActivityConnect = "connect"
+	ActivityPush    = "push"
+	ActivityPull    = "pull"
+)
+
+// UsageEntry counts how often a profile was used
+// Usage never expires; klip cache clear usage resets it
+type UsageEntry struct {
+	Connections int       `json:"connections"`
+	Pushes      int       `json:"pushes"`
+	Pulls       int       `json:"pulls"`
+	LastUsed    time.Time `json:"last_used"`
+}
+
+// RecordUsage counts one activity on a profile
+func (s *Store) RecordUsage(profile, activity string) error {
+	return s.update(func(state *State) {
+		entry := state.Usage[profile]
+		switch activity {
+		case ActivityConnect:
+			entry.Connections++
+		case ActivityPush:
+			entry.Pushes++
+		case ActivityPull:
+			entry.Pulls++
+		}
+		entry.LastUsed = s.now()
+		state.Usage[profile] = entry
+	})
+}
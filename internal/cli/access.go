@@ -0,0 +1,44 @@
+// Package cli - Role-based access to profiles
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// ErrAccessCancelled is returned when an operation that requires
+// confirmation is not confirmed
+var ErrAccessCancelled = errors.New("cancelled")
+
+// Authorize applies the profile's access rules for settings.roles to op.
+// A denied operation returns an error; one that requires confirmation is
+// confirmed first, honoring --yes/--force.
+func Authorize(cfg *config.Config, profile *config.Profile, op string) error {
+	roles := cfg.Settings.Roles
+	switch profile.AccessFor(roles, op) {
+	case config.AccessDenied:
+		return fmt.Errorf("%s is disabled on profile '%s' for %s", op, profile.Name, describeRoles(roles))
+	case config.AccessConfirm:
+		confirmed, err := ui.ConfirmDestructive(ui.Destructive, "Profile '%s' requires confirmation for %s. Continue?", profile.Name, op)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			return ErrAccessCancelled
+		}
+	}
+	return nil
+}
+
+// describeRoles names the local roles in messages
+func describeRoles(roles []string) string {
+	if len(roles) == 0 {
+		return "users without a role (settings.roles)"
+	}
+	return "role " + strings.Join(roles, ", ")
+}
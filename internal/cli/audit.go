@@ -0,0 +1,55 @@
+// Package cli - Connection auditing
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"strings"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// AuditConnection records a connection attempt in the audit log, including
+// the resolved address, server host key and authentication method, so it
+// can later be established which machine was actually reached
+func AuditConnection(profile *config.Profile, backendName, resolvedHost string, client *ssh.Client, connErr error) {
+	auditLogger, err := logger.NewAuditLogger(true)
+	if err != nil {
+		return
+	}
+	defer auditLogger.Close()
+
+	metadata := map[string]string{"resolved_host": resolvedHost}
+	if client != nil {
+		info := client.ConnectionInfo()
+		for key, value := range map[string]string{
+			"remote_addr":          info.RemoteAddr,
+			"host_key_type":        info.HostKeyType,
+			"host_key_fingerprint": info.HostKeyFingerprint,
+			"auth_method":          info.AuthMethod,
+		} {
+			if value != "" {
+				metadata[key] = value
+			}
+		}
+
+		// Jump hosts in order, comma-separated
+		var jumpAddrs, jumpKeys []string
+		for _, hop := range info.Jumps {
+			jumpAddrs = append(jumpAddrs, hop.RemoteAddr)
+			jumpKeys = append(jumpKeys, hop.HostKeyFingerprint)
+		}
+		if len(info.Jumps) > 0 {
+			metadata["jump_addrs"] = strings.Join(jumpAddrs, ",")
+			metadata["jump_host_key_fingerprints"] = strings.Join(jumpKeys, ",")
+		}
+	}
+
+	status := "success"
+	if connErr != nil {
+		status = "failed"
+	}
+
+	_ = auditLogger.LogConnection(profile.Name, profile.RemoteUser, profile.RemoteHost, backendName, status, metadata, connErr)
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+func TestAuditConnection(t *testing.T) {
+	// The environment points XDG_STATE_HOME, and so the audit log, at a
+	// temporary directory
+	server := clitest.NewEnv(t).StartSSHServer()
+	address := net.JoinHostPort(server.Host, strconv.Itoa(server.Port))
+	userKey, err := ssh.GetPublicKeyFingerprint(server.KeyPath)
+	require.NoError(t, err)
+
+	// The server is its own jump host
+	sshConfig := func() *ssh.Config {
+		return &ssh.Config{Host: server.Host, Port: server.Port, User: "test", KeyPath: server.KeyPath, NonInteractive: true}
+	}
+	cfg := sshConfig()
+	cfg.Jump = sshConfig()
+	client, err := ssh.NewClient(cfg)
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	defer client.Close()
+	info := client.ConnectionInfo()
+	require.Len(t, info.Jumps, 1)
+	require.NotEmpty(t, info.RemoteAddr)
+	require.NotEmpty(t, info.HostKeyFingerprint)
+
+	profile := config.NewProfile("web", "test", "web")
+	AuditConnection(profile, "lan", server.Host, client, nil)
+	AuditConnection(profile, "lan", server.Host, nil, errors.New("connection refused"))
+
+	events, err := logger.QueryAuditLog(logger.AuditQuery{EventType: "connection"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	ok := events[0]
+	assert.Equal(t, "success", ok.Status)
+	assert.Equal(t, "web", ok.Profile)
+	assert.Equal(t, "lan", ok.Backend)
+	assert.Equal(t, server.Host, ok.Metadata["resolved_host"])
+	assert.Equal(t, info.RemoteAddr, ok.Metadata["remote_addr"])
+	assert.Equal(t, "ssh-ed25519", ok.Metadata["host_key_type"])
+	assert.Equal(t, info.HostKeyFingerprint, ok.Metadata["host_key_fingerprint"])
+	assert.Equal(t, "publickey "+server.KeyPath+" ("+userKey+")", ok.Metadata["auth_method"])
+	assert.Equal(t, address, ok.Metadata["jump_addrs"])
+	assert.Equal(t, info.HostKeyFingerprint, ok.Metadata["jump_host_key_fingerprints"])
+
+	// A failed attempt records only where it was headed
+	failed := events[1]
+	assert.Equal(t, "failed", failed.Status)
+	assert.Equal(t, "connection refused", failed.Error)
+	assert.Equal(t, map[string]string{"resolved_host": server.Host}, failed.Metadata)
+}
@@ -0,0 +1,120 @@
+// Package cli - Shell completion
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// RegisterCompletions adds dynamic shell completion to cmd and every
+// subcommand: --profile/--profiles and profile arguments complete against
+// the configured profiles, --backend against the registered backends,
+// --domain and trust domain arguments against settings.trust_domains, and
+// --output against the output formats and --prefer against the conflict
+// policies. Profile and trust domain arguments
+// are recognized by a <profile>, [profile...] or <trust-domain> first
+// argument in the command's usage line.
+func RegisterCompletions(cmd *cobra.Command) {
+	flagCompletions := map[string]func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective){
+		"profile":  completeProfiles,
+		"profiles": completeProfiles,
+		"backend":  completeBackends,
+		"domain":   completeTrustDomains,
+		"output":   completeOutputFormats,
+		"prefer":   completeConflictPolicies,
+	}
+	for name, complete := range flagCompletions {
+		if cmd.LocalFlags().Lookup(name) != nil {
+			_ = cmd.RegisterFlagCompletionFunc(name, complete)
+		}
+	}
+
+	if cmd.ValidArgsFunction == nil {
+		if fields := strings.Fields(cmd.Use); len(fields) > 1 {
+			repeated := strings.HasSuffix(fields[1], "...")
+			switch arg := strings.Trim(fields[1], "<>[]."); {
+			case arg == "profile" || strings.HasPrefix(arg, "profile|"):
+				cmd.ValidArgsFunction = completeFirstArg(completeProfiles, repeated)
+			case arg == "trust-domain":
+				cmd.ValidArgsFunction = completeFirstArg(completeTrustDomains, repeated)
+			}
+		}
+	}
+
+	for _, sub := range cmd.Commands() {
+		RegisterCompletions(sub)
+	}
+}
+
+// completeProfiles completes configured profile names, described by their
+// user@host
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, name := range cfg.ListProfiles() {
+		profile := cfg.Profiles[name]
+		completions = append(completions, name+"\t"+profile.RemoteUser+"@"+profile.RemoteHost)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBackends completes "auto" and the registered backend names
+func completeBackends(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := []string{}
+	for _, b := range backend.NewRegistry().List() {
+		names = append(names, b.Name())
+	}
+	sort.Strings(names)
+	return append([]string{"auto"}, names...), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTrustDomains completes the trust domains in settings.trust_domains
+func completeTrustDomains(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var domains []string
+	for domain := range cfg.Settings.TrustDomains {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeOutputFormats completes the --output formats
+func completeOutputFormats(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return []string{string(ui.OutputText), string(ui.OutputJSON)}, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConflictPolicies completes the --prefer conflict policies
+func completeConflictPolicies(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	policies := make([]string, len(transfer.ConflictPolicies))
+	for i, p := range transfer.ConflictPolicies {
+		policies[i] = string(p)
+	}
+	return policies, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFirstArg completes the first argument with complete, or every
+// argument if repeated, and nothing after it
+func completeFirstArg(complete func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective), repeated bool) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 && !repeated {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return complete(cmd, args, toComplete)
+	}
+}
@@ -0,0 +1,91 @@
+// Package cli - Confirmation of destructive transfers
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// ConfirmTransfer asks before a transfer that deletes data, honoring
+// --yes/--force. Returns false if the transfer must not proceed.
+func ConfirmTransfer(cfg *transfer.TransferConfig) bool {
+	actions := transfer.DestructiveActions(cfg)
+	if len(actions) == 0 {
+		return true
+	}
+
+	ui.PrintWarning("This transfer will:")
+	ui.PrintList(actions)
+
+	confirmed, err := ui.ConfirmDestructive(ui.Irreversible, "Continue with the transfer?")
+	if err != nil {
+		ui.PrintError("%v", err)
+		return false
+	}
+	if !confirmed {
+		ui.PrintInfo("Cancelled")
+	}
+
+	return confirmed
+}
+
+// ConfirmLimits asks before a transfer that exceeds the profile's
+// max_files or max_total_size, honoring --yes/--force. Non-interactive runs
+// without --yes abort. Returns false if the transfer must not proceed.
+func ConfirmLimits(ctx context.Context, cfg *transfer.TransferConfig) bool {
+	if cfg.DryRun || !cfg.HasLimits() {
+		return true
+	}
+
+	var exceeded []string
+	err := ui.NewStepRunner(1).Run("Checking transfer size", func() error {
+		var err error
+		exceeded, _, err = transfer.CheckLimits(ctx, cfg)
+		return err
+	})
+	if err != nil {
+		ui.PrintError("%v", err)
+		return false
+	}
+	return confirmExceeded(exceeded)
+}
+
+// ConfirmFileLimits is ConfirmLimits for an upload of the given local
+// files, such as the files a sync pass or watched push is about to upload
+func ConfirmFileLimits(cfg *transfer.TransferConfig, files []string) bool {
+	if cfg.DryRun || !cfg.HasLimits() || len(files) == 0 {
+		return true
+	}
+
+	size, err := transfer.MeasureFiles(files)
+	if err != nil {
+		ui.PrintError("%v", err)
+		return false
+	}
+	return confirmExceeded(cfg.ExceededBy(size))
+}
+
+// confirmExceeded asks before a transfer exceeding the limits described in
+// exceeded, if any
+func confirmExceeded(exceeded []string) bool {
+	if len(exceeded) == 0 {
+		return true
+	}
+
+	ui.PrintWarning("This transfer would:")
+	ui.PrintList(exceeded)
+
+	confirmed, err := ui.ConfirmDestructive(ui.Destructive, "Transfer anyway?")
+	if err != nil {
+		ui.PrintError("%v", err)
+		return false
+	}
+	if !confirmed {
+		ui.PrintInfo("Cancelled")
+	}
+
+	return confirmed
+}
@@ -0,0 +1,110 @@
+// Package cli - Sync conflict resolution
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"fmt"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// ConflictReader returns the local and remote contents of a file in
+// conflict, for the resolver's diff
+type ConflictReader func(transfer.Conflict) (local, remote []byte, err error)
+
+// ConflictResolver returns the resolver for sync conflicts with the
+// profile's host: the --prefer policy if one was given, otherwise a prompt
+// offering to keep the local, remote or both versions, show a diff or skip
+// the file. Conflicts are skipped when klip cannot prompt. Every decision
+// is recorded in the audit log.
+func ConflictResolver(profile *config.Profile, backendName string, read ConflictReader) (transfer.ConflictResolver, error) {
+	policy, err := transfer.ParseConflictPolicy(Prefer)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c transfer.Conflict) (transfer.Resolution, error) {
+		resolution, decidedBy := policy.Resolve(c), "prefer="+string(policy)
+		if policy == transfer.PreferAsk {
+			decidedBy = "non-interactive"
+			if ui.IsInteractive() {
+				if resolution, err = promptConflict(c, read); err != nil {
+					return "", err
+				}
+				decidedBy = "user"
+			}
+		}
+
+		if auditLogger, err := logger.NewAuditLogger(true); err == nil {
+			_ = auditLogger.LogConflict(profile.Name, profile.RemoteUser, profile.RemoteHost, backendName, c.Path, string(resolution), decidedBy)
+			auditLogger.Close()
+		}
+		return resolution, nil
+	}, nil
+}
+
+// promptChoice asks the user to pick one of several choices (replaced in
+// tests)
+var promptChoice = ui.PromptChoice
+
+// promptConflict asks how to resolve a conflict until the user picks a
+// resolution
+func promptConflict(c transfer.Conflict, read ConflictReader) (transfer.Resolution, error) {
+	ui.PrintWarning("Conflict: %s", c.Path)
+	ui.PrintKeyValue("Local", describeVersion(c.Local))
+	ui.PrintKeyValue("Remote", describeVersion(c.Remote))
+
+	choices := []string{"Keep local", "Keep remote", "Keep both", "Show diff", "Skip"}
+	resolutions := []transfer.Resolution{transfer.ResolutionLocal, transfer.ResolutionRemote, transfer.ResolutionBoth, "", transfer.ResolutionSkip}
+	for {
+		choice, err := promptChoice("How should it be resolved?", choices, len(choices)-1)
+		if err != nil {
+			return "", err
+		}
+		if resolutions[choice] != "" {
+			return resolutions[choice], nil
+		}
+		showConflictDiff(c, read)
+	}
+}
+
+// describeVersion describes one side's version of a file in conflict
+func describeVersion(v *transfer.FileVersion) string {
+	if v == nil {
+		return "deleted"
+	}
+	return fmt.Sprintf("%s, modified %s", transfer.FormatBytes(v.Size), v.ModTime.Local().Format("2006-01-02 15:04:05"))
+}
+
+// showConflictDiff prints a unified diff between both versions of a file,
+// through the pager if it is long
+func showConflictDiff(c transfer.Conflict, read ConflictReader) {
+	if c.Local == nil || c.Remote == nil {
+		ui.PrintInfo("The file was deleted on one side; there is nothing to compare")
+		return
+	}
+
+	local, remote, err := read(c)
+	if err != nil {
+		ui.PrintError("Failed to read %s: %v", c.Path, err)
+		return
+	}
+	if transfer.IsBinary(local) || transfer.IsBinary(remote) {
+		ui.PrintInfo("Binary files differ")
+		return
+	}
+
+	diff, err := transfer.UnifiedDiff("local/"+c.Path, "remote/"+c.Path, local, remote)
+	if err != nil {
+		ui.PrintError("Failed to compare %s: %v", c.Path, err)
+		return
+	}
+	if diff == "" {
+		ui.PrintInfo("The contents are identical")
+		return
+	}
+	PrintDiff(diff, false)
+}
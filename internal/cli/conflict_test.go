@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orpheus497/klip/internal/transfer"
+)
+
+// stubChoices answers the prompts with choices in turn
+func stubChoices(t *testing.T, choices ...int) {
+	old := promptChoice
+	promptChoice = func(prompt string, options []string, defaultIndex int) (int, error) {
+		require.NotEmpty(t, choices, "more prompts than expected")
+		choice := choices[0]
+		choices = choices[1:]
+		return choice, nil
+	}
+	t.Cleanup(func() {
+		promptChoice = old
+		assert.Empty(t, choices, "fewer prompts than expected")
+	})
+}
+
+func TestPromptConflict(t *testing.T) {
+	version := &transfer.FileVersion{Size: 5, ModTime: time.Unix(1700000000, 0)}
+	conflict := transfer.Conflict{Path: "notes.txt", Local: version, Remote: version}
+	reads := 0
+	read := func(transfer.Conflict) ([]byte, []byte, error) {
+		reads++
+		return []byte("local\n"), []byte("remote\n"), nil
+	}
+
+	for choice, want := range map[int]transfer.Resolution{
+		0: transfer.ResolutionLocal,
+		1: transfer.ResolutionRemote,
+		2: transfer.ResolutionBoth,
+		4: transfer.ResolutionSkip,
+	} {
+		stubChoices(t, choice)
+		resolution, err := promptConflict(conflict, read)
+		require.NoError(t, err)
+		assert.Equal(t, want, resolution)
+	}
+	assert.Zero(t, reads)
+
+	// Showing the diff asks again, and so does a diff of a deleted file,
+	// which reads nothing
+	stubChoices(t, 3, 3, 1)
+	resolution, err := promptConflict(conflict, read)
+	require.NoError(t, err)
+	assert.Equal(t, transfer.ResolutionRemote, resolution)
+	assert.Equal(t, 2, reads)
+
+	stubChoices(t, 3, 0)
+	resolution, err = promptConflict(transfer.Conflict{Path: "gone.txt", Local: version}, read)
+	require.NoError(t, err)
+	assert.Equal(t, transfer.ResolutionLocal, resolution)
+	assert.Equal(t, 2, reads)
+
+	// A failed prompt is returned
+	old := promptChoice
+	promptChoice = func(string, []string, int) (int, error) { return 0, errors.New("interrupted") }
+	t.Cleanup(func() { promptChoice = old })
+	_, err = promptConflict(conflict, read)
+	assert.EqualError(t, err, "interrupted")
+}
@@ -4,32 +4,71 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/cache"
 	"github.com/orpheus497/klip/internal/config"
 	"github.com/orpheus497/klip/internal/logger"
 	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/tracing"
+	"github.com/orpheus497/klip/internal/transfer"
 	"github.com/orpheus497/klip/internal/ui"
+	gossh "golang.org/x/crypto/ssh"
 )
 
+// livenessTimeout bounds the backend queries made after a failed connection
+const livenessTimeout = 5 * time.Second
+
 // ConnectionConfig holds configuration for establishing connections
 type ConnectionConfig struct {
 	ProfileName string
 	BackendName string
 	Timeout     int
 	Verbose     bool
+
+	// NoMux always connects directly instead of reusing a connection held
+	// open by klip mux
+	NoMux bool
+
+	// Operation is checked against the profile's access rules (one of the
+	// config.Op* names); empty for commands that do not act on the host
+	Operation string
 }
 
 // ConnectionHelper assists with connection setup and management
 // This eliminates code duplication across klip, klipc, and klipr commands
 type ConnectionHelper struct {
-	Config       *config.Config
-	Profile      *config.Profile
-	Backend      backend.Backend
-	Log          *logger.Logger
-	ResolvedHost string // The resolved hostname/IP after backend resolution
+	Config        *config.Config
+	Profile       *config.Profile
+	Backend       backend.Backend
+	Log           *logger.Logger
+	Host          string                  // The profile hostname connected to: remote_host or one of hosts
+	ResolvedHost  string                  // The resolved hostname/IP after backend resolution
+	ResolvedJumps []string                // The resolved jump host addresses, if the profile has a jump chain
+	Capabilities  *ssh.RemoteCapabilities // Remote environment, set by DetectCapabilities
+
+	// KnownHostsPath and KeyDir come from the profile's trust domain
+	// (empty for klip's known_hosts and ~/.ssh)
+	KnownHostsPath string
+	KeyDir         string
+
+	// Cache is klip's cache file of resolutions, capabilities and usage,
+	// or nil if it cannot be opened
+	Cache *cache.Store
+
+	// cachedResolution is set when ResolvedHost came from Cache
+	cachedResolution bool
+
+	// mux is a connection through klip mux, returned by CreateSSHClient
+	mux *ssh.Client
 }
 
 // NewConnectionHelper creates a connection helper with profile selection
@@ -43,6 +82,9 @@ func NewConnectionHelper(cfg ConnectionConfig) (*ConnectionHelper, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
+	if err := appConfig.StoreError(); err != nil {
+		ui.PrintWarning("Using the configuration cached locally: %v", err)
+	}
 
 	// Determine and select profile
 	profile, err := selectProfile(appConfig, cfg.ProfileName)
@@ -50,59 +92,240 @@ func NewConnectionHelper(cfg ConnectionConfig) (*ConnectionHelper, error) {
 		return nil, fmt.Errorf("failed to select profile: %w", err)
 	}
 
+	if cfg.Operation != "" {
+		if err := Authorize(appConfig, profile, cfg.Operation); err != nil {
+			return nil, err
+		}
+	}
+
+	// Apply the overrides for the network location; --backend still wins
+	profile, steps := ApplyLocation(appConfig, profile)
+	if cfg.Verbose {
+		PrintLocationSteps(steps)
+	}
+
 	// Override backend if specified via command line
 	if cfg.BackendName != "" {
 		profile = profile.Clone()
 		profile.Backend = config.BackendType(cfg.BackendName)
 	}
 
-	// Detect and select appropriate backend
+	knownHosts, keyDir, err := TrustDomain(appConfig, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := cache.OpenStore()
+	if err != nil {
+		log.Debug("Cache file unavailable", "error", err)
+	}
+
 	registry := backend.NewRegistry()
-	detector := backend.NewDetector(registry)
+
+	// Reuse a connection held open by klip mux, which has already selected
+	// the backend and resolved the host
+	if !cfg.NoMux {
+		if client, info := DialMux(profile.Name, cfg.BackendName); client != nil {
+			if muxBackend, err := registry.Get(info.Backend); err == nil {
+				log.Debug("Reusing connection from klip mux", "backend", info.Backend, "profile", profile.Name)
+				return &ConnectionHelper{
+					Config:         appConfig,
+					Profile:        profile,
+					Backend:        muxBackend,
+					Log:            log,
+					Host:           profile.RemoteHost,
+					ResolvedHost:   info.ResolvedHost,
+					ResolvedJumps:  info.ResolvedJumps,
+					KnownHostsPath: knownHosts,
+					KeyDir:         keyDir,
+					Cache:          store,
+					mux:            client,
+				}, nil
+			}
+			client.Close()
+		}
+	}
+
+	// Detect and select appropriate backend
+	_, span := tracing.Start(context.Background(), "backend.detect",
+		tracing.String("klip.profile", profile.Name),
+		tracing.String("klip.backend.requested", string(profile.Backend)))
+	detector := backend.NewDetector(registry).Restrict(profile.BackendPermitted)
 	selectedBackend, err := detector.SelectBackend(context.Background(), string(profile.Backend))
 	if err != nil {
+		span.Finish(err)
 		return nil, fmt.Errorf("failed to detect backend: %w", err)
 	}
+	span.SetAttrs(tracing.String("klip.backend", selectedBackend.Name()))
+	span.Finish(nil)
 
 	log.Debug("Backend selected", "backend", selectedBackend.Name(), "profile", profile.Name)
 
 	return &ConnectionHelper{
-		Config:  appConfig,
-		Profile: profile,
-		Backend: selectedBackend,
-		Log:     log,
+		Config:         appConfig,
+		Profile:        profile,
+		Backend:        selectedBackend,
+		Log:            log,
+		Host:           profile.RemoteHost,
+		KnownHostsPath: knownHosts,
+		KeyDir:         keyDir,
+		Cache:          store,
 	}, nil
 }
 
 // CreateSSHClient creates and connects an SSH client with proper error handling
 // Returns a connected SSH client ready for use
-func (h *ConnectionHelper) CreateSSHClient(ctx context.Context, timeout int) (*ssh.Client, error) {
-	// Create context with timeout if specified
-	if timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
-		defer cancel()
+func (h *ConnectionHelper) CreateSSHClient(ctx context.Context, timeout int) (client *ssh.Client, err error) {
+	ctx, span := tracing.Start(ctx, "connect",
+		tracing.String("klip.profile", h.Profile.Name),
+		tracing.String("klip.backend", h.Backend.Name()),
+		tracing.Bool("klip.mux", h.mux != nil))
+	defer func() { span.Finish(err) }()
+
+	if h.mux != nil {
+		client = h.mux
+		h.mux = nil
+		h.Log.Info("Connected through klip mux", "host", h.ResolvedHost)
+		h.RecordUsage(cache.ActivityConnect)
+		return client, nil
 	}
 
-	// Resolve hostname via backend
-	hostname, err := h.resolveHostname(ctx)
+	// A profile with alternate hostnames tries each until one is reached,
+	// each within the timeout
+	client, host, err := ConnectHosts(ctx, HostOrder(ctx, h.Backend, h.Profile), time.Duration(timeout)*time.Second, func(ctx context.Context, host string) (*ssh.Client, error) {
+		return h.connectHost(ctx, host, timeout)
+	})
 	if err != nil {
-		return nil, err
+		return nil, h.withLivenessHint(err)
+	}
+	h.Host = host
+	h.RecordUsage(cache.ActivityConnect)
+	return client, nil
+}
+
+// connectHost resolves host, one of the profile's hostnames, via the
+// backend and connects to it
+func (h *ConnectionHelper) connectHost(ctx context.Context, host string, timeout int) (*ssh.Client, error) {
+	hostname, err := h.resolveHostname(ctx, host)
+	if err != nil {
+		return nil, &unresolvedError{err}
 	}
 
 	// Store the resolved hostname for later use (e.g., rsync transfers)
 	h.ResolvedHost = hostname
 
-	h.Log.Debug("Resolved hostname", "backend", h.Backend.Name(), "hostname", hostname)
+	h.Log.Debug("Resolved hostname", "backend", h.Backend.Name(), "host", host, "hostname", hostname)
+
+	client, err := h.dial(ctx, h.Backend, host, hostname, timeout)
+	if err != nil && h.cachedResolution {
+		client, err = h.redialUncached(ctx, host, hostname, timeout, err)
+	}
+	return client, err
+}
+
+// redialUncached handles a failed connection to a cached address: the
+// cached resolution is dropped, and if the backend now resolves the host
+// elsewhere that address is dialed instead. Otherwise dialErr is returned.
+func (h *ConnectionHelper) redialUncached(ctx context.Context, host, cached string, timeout int, dialErr error) (*ssh.Client, error) {
+	if err := h.Cache.InvalidateResolution(h.Backend.Name(), host); err != nil {
+		h.Log.Debug("Failed to update cache file", "error", err)
+	}
+
+	hostname, err := h.lookupHostname(ctx, host)
+	if err != nil || hostname == cached {
+		return nil, dialErr
+	}
+
+	h.Log.Debug("Cached address failed, retrying with fresh resolution", "cached", cached, "hostname", hostname)
+	h.ResolvedHost = hostname
+	return h.dial(ctx, h.Backend, host, hostname, timeout)
+}
+
+// RecordUsage counts an activity on the profile in the cache file
+func (h *ConnectionHelper) RecordUsage(activity string) {
+	if h.Cache == nil {
+		return
+	}
+	if err := h.Cache.RecordUsage(h.Profile.Name, activity); err != nil {
+		h.Log.Debug("Failed to update cache file", "error", err)
+	}
+}
+
+// withLivenessHint adds a suggestion to err when another backend sees the
+// host online
+func (h *ConnectionHelper) withLivenessHint(err error) error {
+	if hint := LivenessHint(h.Backend, h.Profile); hint != "" {
+		return fmt.Errorf("%w; %s", err, hint)
+	}
+	return err
+}
+
+// LivenessHint asks the profile's permitted backends about its host after a
+// connection through b failed, returning a suggestion if another backend
+// sees it online
+func LivenessHint(b backend.Backend, profile *config.Profile) string {
+	ctx, cancel := context.WithTimeout(context.Background(), livenessTimeout)
+	defer cancel()
 
-	// Create SSH configuration
+	detector := backend.NewDetector(backend.NewRegistry()).Restrict(profile.BackendPermitted)
+	return backend.LivenessHint(b.Name(), profile.RemoteHost, detector.PeerLiveness(ctx, profile.RemoteHost))
+}
+
+// sshConfig returns the SSH configuration for hostname, the address of
+// host reached through backend b, resolving the profile's jump hosts
+func (h *ConnectionHelper) sshConfig(ctx context.Context, b backend.Backend, host, hostname string, timeout int) (*ssh.Config, error) {
 	sshConfig := &ssh.Config{
-		Host:        hostname,
-		Port:        h.Profile.SSHPort,
-		User:        h.Profile.RemoteUser,
-		KeyPath:     h.Profile.SSHKeyPath,
-		UsePassword: h.Profile.UsePassword,
-		Timeout:     time.Duration(timeout) * time.Second,
+		Host:               hostname,
+		HostName:           host,
+		Port:               h.Profile.SSHPort,
+		User:               h.Profile.RemoteUser,
+		KeyPath:            h.Profile.SSHKeyPath,
+		UsePassword:        h.Profile.UsePassword,
+		Timeout:            time.Duration(timeout) * time.Second,
+		PassphraseEnv:      PassphraseEnv,
+		KnownHostsPath:     h.KnownHostsPath,
+		KeyDir:             h.KeyDir,
+		DefaultKeys:        h.Config.Settings.DefaultKeys,
+		PKCS11Provider:     h.Profile.PKCS11Provider,
+		PINPrompt:          TokenPIN(),
+		NonInteractive:     NonInteractive,
+		StrictHostKeys:     h.Config.Settings.StrictHostKeys,
+		HostCAKeys:         h.Config.Settings.HostCAKeys,
+		HostKeyFingerprint: h.Profile.HostKeyFingerprint,
+		AllowedCIDRs:       h.Profile.AllowedCIDRs,
+		HostKeyMaxAge:      h.Config.Settings.HostKeyMaxAge(),
+		HostKeyMaxIdle:     h.Config.Settings.HostKeyMaxIdle(),
+	}
+
+	// With jump hosts only the first hop is reached through the backend;
+	// the last hop resolves and dials the remote host itself
+	if len(h.Profile.JumpChain()) > 0 {
+		jumpAddrs, err := ResolveJumpChain(ctx, b, h.Profile)
+		if err != nil {
+			return nil, err
+		}
+		h.ResolvedJumps = jumpAddrs
+		sshConfig.Jump = JumpSSHConfig(h.Profile, jumpAddrs, sshConfig.Timeout)
+		h.Log.Debug("Connecting through jump hosts", "jump_hosts", h.Profile.JumpSpec(), "addresses", strings.Join(jumpAddrs, ","))
+	}
+
+	return sshConfig, nil
+}
+
+// dial connects an SSH client to hostname, the address of host reached
+// through backend b
+func (h *ConnectionHelper) dial(ctx context.Context, b backend.Backend, host, hostname string, timeout int) (*ssh.Client, error) {
+	address, err := CheckEncryptedPath(ctx, b, h.Profile, host)
+	if err != nil {
+		return nil, err
+	}
+	if address != "" {
+		hostname = address
+	}
+
+	sshConfig, err := h.sshConfig(ctx, b, host, hostname, timeout)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create SSH client
@@ -116,47 +339,224 @@ func (h *ConnectionHelper) CreateSSHClient(ctx context.Context, timeout int) (*s
 		"user", sshConfig.User,
 		"host", hostname,
 		"port", sshConfig.Port,
-		"backend", h.Backend.Name())
+		"backend", b.Name())
 
-	if err := client.Connect(ctx); err != nil {
+	err = client.Connect(ctx)
+	AuditConnection(h.Profile, b.Name(), hostname, client, err)
+	if err != nil {
 		return nil, fmt.Errorf("connection failed: %w", err)
 	}
 
 	h.Log.Info("Connected successfully", "host", hostname)
+	h.Log.Debug("Authenticated", "method", client.ConnectionInfo().AuthMethod)
+	PrintHostKeyWarnings(client.ConnectionInfo())
 
 	return client, nil
 }
 
-// resolveHostname resolves the hostname via the selected backend
-// For VPN backends (tailscale, headscale, netbird), this queries the VPN network
+// MultipathClient is an additional connection to the profile's host over
+// a backend other than the selected one
+type MultipathClient struct {
+	Client  *ssh.Client
+	Backend string
+	Address string
+}
+
+// CreateMultipathClients connects to the host over every other connected
+// backend that resolves it to a different address than h.ResolvedHost
+// Backends that cannot reach the host are skipped; the result may be empty
+func (h *ConnectionHelper) CreateMultipathClients(ctx context.Context, timeout int) []MultipathClient {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	// Every path would go through the same jump hosts
+	if len(h.Profile.JumpChain()) > 0 {
+		return nil
+	}
+
+	seen := map[string]bool{canonicalAddress(ctx, h.ResolvedHost): true}
+	var clients []MultipathClient
+
+	for _, b := range backend.NewRegistry().List() {
+		if b.Name() == h.Backend.Name() || !h.Profile.BackendPermitted(b.Name()) || !b.IsAvailable(ctx) || !b.IsConnected(ctx) {
+			continue
+		}
+
+		addr := h.Profile.RemoteHost
+		if b.Name() != "lan" {
+			ip, err := b.GetPeerIP(ctx, h.Profile.RemoteHost)
+			if err != nil {
+				h.Log.Debug("Backend cannot reach host", "backend", b.Name(), "error", err)
+				continue
+			}
+			addr = ip
+		}
+
+		key := canonicalAddress(ctx, addr)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		client, err := h.dial(ctx, b, h.Profile.RemoteHost, addr, timeout)
+		if err != nil {
+			h.Log.Debug("Multipath connection failed", "backend", b.Name(), "address", addr, "error", err)
+			continue
+		}
+		clients = append(clients, MultipathClient{Client: client, Backend: b.Name(), Address: addr})
+	}
+
+	return clients
+}
+
+// canonicalAddress resolves host to its first IP address so the same host
+// reached by name and by IP is recognized as one path
+func canonicalAddress(ctx context.Context, host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return host
+	}
+	return addrs[0]
+}
+
+// resolveHostname resolves host, one of the profile's hostnames, via the
+// selected backend
+// For VPN backends (tailscale, headscale, netbird, zerotier, wireguard), this queries the VPN network
 // to resolve the hostname to an internal IP. For LAN backend, the hostname is
 // used directly and DNS resolution happens at connection time.
-func (h *ConnectionHelper) resolveHostname(ctx context.Context) (string, error) {
+func (h *ConnectionHelper) resolveHostname(ctx context.Context, host string) (hostname string, err error) {
 	// Use the actual backend name (which may be auto-detected)
 	// not the profile setting (which could be "auto")
 	backendName := h.Backend.Name()
+	h.cachedResolution = false
+
+	ctx, span := tracing.Start(ctx, "resolve", tracing.String("klip.host", host))
+	defer func() {
+		span.SetAttrs(tracing.String("klip.address", hostname), tracing.Bool("klip.cached", h.cachedResolution))
+		span.Finish(err)
+	}()
 
 	// For LAN backend, use hostname directly (DNS resolution will happen at connection time)
-	if backendName == "lan" {
-		return h.Profile.RemoteHost, nil
+	// Behind jump hosts the hostname is resolved by the last jump host
+	if backendName == "lan" || len(h.Profile.JumpChain()) > 0 {
+		return host, nil
+	}
+
+	// Reuse the backend's last resolution of the host while it is trusted
+	if h.Cache != nil {
+		if address, ok := h.Cache.Resolution(backendName, host); ok {
+			h.Log.Debug("Using cached resolution", "backend", backendName, "address", address)
+			h.cachedResolution = true
+			return address, nil
+		}
 	}
 
-	// For VPN backends (tailscale, headscale, netbird), resolve hostname to IP via backend
+	return h.lookupHostname(ctx, host)
+}
+
+// lookupHostname resolves host through the VPN backend and stores the
+// address in the cache file
+func (h *ConnectionHelper) lookupHostname(ctx context.Context, host string) (string, error) {
+	backendName := h.Backend.Name()
+
+	// For VPN backends (tailscale, headscale, netbird, zerotier, wireguard), resolve hostname to IP via backend
 	// This ensures we connect through the VPN network rather than attempting direct DNS resolution
-	resolvedHost, err := h.Backend.GetPeerIP(ctx, h.Profile.RemoteHost)
+	resolvedHost, err := h.Backend.GetPeerIP(ctx, host)
 	if err != nil {
 		// Return the error for VPN backends since hostname resolution is critical
 		// for proper routing through the VPN network
 		return "", fmt.Errorf("failed to resolve hostname via %s: %w (hint: ensure the host is reachable via %s)", backendName, err, backendName)
 	}
 
+	if h.Cache != nil {
+		if err := h.Cache.SetResolution(backendName, host, resolvedHost); err != nil {
+			h.Log.Debug("Failed to update cache file", "error", err)
+		}
+	}
+
 	return resolvedHost, nil
 }
 
 // GetResolvedHost returns the resolved hostname without creating a connection
 // Useful for validation and dry-run operations
 func (h *ConnectionHelper) GetResolvedHost(ctx context.Context) (string, error) {
-	return h.resolveHostname(ctx)
+	return h.resolveAny(ctx)
+}
+
+// ScanHostKey reads the key the profile's host presents, through its jump
+// hosts if any, without verifying it or logging in to the host
+func (h *ConnectionHelper) ScanHostKey(ctx context.Context, timeout int) (gossh.PublicKey, error) {
+	hostname, err := h.resolveAny(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.ResolvedHost = hostname
+
+	sshConfig, err := h.sshConfig(ctx, h.Backend, h.Host, hostname, timeout)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.NewClient(sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH client: %w", err)
+	}
+	return client.ScanHostKey(ctx)
+}
+
+// ScanHostKeys reads every key the profile's host presents, like
+// ssh.ScanHostKeys, after the checks connecting makes: the path to the
+// host must be encrypted if the profile requires it, and the address
+// scanned must be in its allowed_cidrs. Profiles with jump hosts use
+// ScanHostKey.
+func (h *ConnectionHelper) ScanHostKeys(ctx context.Context) ([]gossh.PublicKey, error) {
+	hostname, err := h.resolveAny(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.ResolvedHost = hostname
+
+	address, err := CheckEncryptedPath(ctx, h.Backend, h.Profile, h.Host)
+	if err != nil {
+		return nil, err
+	}
+	if address == "" {
+		address = hostname
+	}
+	if len(h.Profile.AllowedCIDRs) > 0 {
+		networks, err := config.ParseCIDRs(h.Profile.AllowedCIDRs)
+		if err != nil {
+			return nil, err
+		}
+		if address, err = ssh.VetAddress(ctx, hostname, networks); err != nil {
+			return nil, err
+		}
+	}
+	return ssh.ScanHostKeys(ctx, address, h.Profile.SSHPort)
+}
+
+// resolveAny resolves the first of the profile's hostnames the backend
+// knows, setting h.Host to it
+func (h *ConnectionHelper) resolveAny(ctx context.Context) (string, error) {
+	hosts := h.Profile.HostNames()
+	var errs []error
+	for _, host := range hosts {
+		hostname, err := h.resolveHostname(ctx, host)
+		if err == nil {
+			h.Host = host
+			return hostname, nil
+		}
+		if len(hosts) == 1 {
+			return "", err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", host, err))
+	}
+	return "", errors.Join(errs...)
 }
 
 // ValidateConnection validates the connection configuration without actually connecting
@@ -178,29 +578,217 @@ func (h *ConnectionHelper) ValidateConnection(ctx context.Context) error {
 	}
 
 	// Try to resolve hostname
-	if _, err := h.resolveHostname(ctx); err != nil {
+	hostname, err := h.resolveAny(ctx)
+	if err != nil {
 		return fmt.Errorf("hostname resolution failed: %w", err)
 	}
+	h.ResolvedHost = hostname
+
+	if err := h.checkAllowedCIDRs(ctx); err != nil {
+		return err
+	}
+	_, err = CheckEncryptedPath(ctx, h.Backend, h.Profile, h.Host)
+	return err
+}
+
+// checkAllowedCIDRs reports an error if the resolved host has an address
+// outside the profile's allowed_cidrs, which connecting refuses. Behind
+// jump hosts the first hop is dialed instead, so nothing is checked here.
+func (h *ConnectionHelper) checkAllowedCIDRs(ctx context.Context) error {
+	if len(h.Profile.AllowedCIDRs) == 0 || len(h.Profile.JumpChain()) > 0 {
+		return nil
+	}
+	networks, err := config.ParseCIDRs(h.Profile.AllowedCIDRs)
+	if err != nil {
+		return err
+	}
+
+	_, err = ssh.VetAddress(ctx, h.ResolvedHost, networks)
+	return err
+}
+
+// ConnectionPlan describes what connecting with a profile would do
+type ConnectionPlan struct {
+	Profile      string
+	Backend      string
+	User         string
+	Host         string
+	ResolvedHost string
+	Port         int
+
+	// JumpHosts lists the jump chain in ssh -J syntax and ResolvedJumps
+	// their addresses (both empty without one)
+	JumpHosts     []string
+	ResolvedJumps []string
+
+	// Auth lists the authentication methods in the order they are tried
+	Auth []ssh.AuthMethodInfo
+
+	// KnownHostKeys lists the host key types in known_hosts (empty if unknown)
+	KnownHostKeys []string
+
+	// HostCAKeys is the number of settings.host_ca_keys entries trusted to
+	// sign host certificates
+	HostCAKeys int
+
+	// PinnedFingerprint is the profile's host_key_fingerprint; when set it
+	// alone decides which host key is accepted
+	PinnedFingerprint string
+
+	// Problem is the first validation failure, if any
+	Problem error
+}
+
+// PlanConnection runs ValidateConnection and inspects authentication and
+// host key status, without connecting to the remote host
+func (h *ConnectionHelper) PlanConnection(ctx context.Context) *ConnectionPlan {
+	plan := &ConnectionPlan{
+		Profile: h.Profile.Name,
+		Backend: h.Backend.Name(),
+		User:    h.Profile.RemoteUser,
+		Host:    h.Profile.RemoteHost,
+		Port:    h.Profile.SSHPort,
+	}
+
+	plan.Problem = h.ValidateConnection(ctx)
+	if h.Host != "" {
+		// One of several hosts may have been chosen
+		plan.Host = h.Host
+	}
+	plan.ResolvedHost = h.ResolvedHost
+	if plan.ResolvedHost == "" {
+		// Connecting would fall back to the configured hostname
+		plan.ResolvedHost = plan.Host
+	}
+
+	if chain := h.Profile.JumpChain(); len(chain) > 0 {
+		for i := range chain {
+			plan.JumpHosts = append(plan.JumpHosts, chain[i].Spec(h.Profile))
+		}
+		jumpAddrs, err := ResolveJumpChain(ctx, h.Backend, h.Profile)
+		if err != nil && plan.Problem == nil {
+			plan.Problem = err
+		}
+		plan.ResolvedJumps = jumpAddrs
+	}
+
+	plan.Auth = ssh.PlanAuth(&ssh.Config{
+		Host:           plan.ResolvedHost,
+		Port:           h.Profile.SSHPort,
+		User:           h.Profile.RemoteUser,
+		KeyPath:        h.Profile.SSHKeyPath,
+		UsePassword:    h.Profile.UsePassword,
+		PassphraseEnv:  PassphraseEnv,
+		KeyDir:         h.KeyDir,
+		DefaultKeys:    h.Config.Settings.DefaultKeys,
+		PKCS11Provider: h.Profile.PKCS11Provider,
+	})
+
+	if keys, err := ssh.KnownHostKeyTypes(h.KnownHostsPath, plan.ResolvedHost, h.Profile.SSHPort); err == nil {
+		plan.KnownHostKeys = keys
+	} else {
+		h.Log.Debug("Failed to check known_hosts", "error", err)
+	}
+	plan.HostCAKeys = len(h.Config.Settings.HostCAKeys)
+	plan.PinnedFingerprint = h.Profile.HostKeyFingerprint
+
+	return plan
+}
+
+// DetectCapabilities returns the remote environment for the connected host
+// Results are cached per profile so only the first connection pays for the probe
+func (h *ConnectionHelper) DetectCapabilities(ctx context.Context, client *ssh.Client) (*ssh.RemoteCapabilities, error) {
+	if h.Cache != nil {
+		if caps, ok := h.Cache.Capabilities(h.Profile.Name, h.Profile.RemoteHost); ok {
+			h.Log.Debug("Using cached remote capabilities", "profile", h.Profile.Name, "os", caps.OS)
+			h.Capabilities = caps
+			return caps, nil
+		}
+	}
+
+	caps, err := ssh.DetectCapabilities(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect remote capabilities: %w", err)
+	}
+
+	h.Log.Debug("Detected remote capabilities",
+		"os", caps.OS,
+		"shell", caps.Shell,
+		"home", caps.HomeDir,
+		"rsync", caps.HasRsync,
+		"sftp", caps.HasSFTP,
+		"scp", caps.HasSCP)
+
+	if h.Cache != nil {
+		if err := h.Cache.SetCapabilities(h.Profile.Name, h.Profile.RemoteHost, caps); err != nil {
+			h.Log.Debug("Failed to update cache file", "error", err)
+		}
+	}
+
+	h.Capabilities = caps
+	return caps, nil
+}
+
+// ResolveMethod switches the profile to another transfer method when the
+// chosen one is unavailable on the host, unless strict_method is set, and
+// warns about the switch and what the fallback method cannot do
+func (h *ConnectionHelper) ResolveMethod() {
+	opts := &h.Profile.TransferOptions
+	resolved, reason := transfer.ResolveMethod(opts.Method, h.Capabilities, opts.StrictMethod)
+	if reason == "" {
+		return
+	}
+
+	var limits string
+	if resolved == "scp" {
+		limits = "; scp does not resume interrupted transfers and cannot verify them, use sudo or preserve extended attributes"
+	}
+	ui.PrintWarning("%s, falling back to %s%s (set transfer_options.strict_method to disable)", reason, resolved, limits)
+	opts.Method = resolved
+}
+
+// DefaultRemoteDest maps a local source path to a default remote destination
+// Paths inside the local home directory are placed at the same location
+// relative to the remote home directory; other paths are used unchanged
+func DefaultRemoteDest(localPath string, caps *ssh.RemoteCapabilities) string {
+	if caps == nil || caps.HomeDir == "" {
+		return localPath
+	}
+
+	localHome, err := os.UserHomeDir()
+	if err != nil {
+		return localPath
+	}
+
+	absPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return localPath
+	}
+
+	rel, err := filepath.Rel(localHome, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return localPath
+	}
 
-	return nil
+	return path.Join(caps.HomeDir, filepath.ToSlash(rel))
 }
 
 // selectProfile selects a profile either by name or interactively
+// The returned profile has global settings and defaults applied
 func selectProfile(cfg *config.Config, profileName string) (*config.Profile, error) {
-	if profileName != "" {
-		// Profile name specified, retrieve it
-		profile, err := cfg.GetProfile(profileName)
+	if profileName == "" {
+		// No profile specified, use interactive selection
+		selector := ui.NewProfileSelector(cfg)
+		_, name, err := selector.SelectProfile()
 		if err != nil {
-			return nil, fmt.Errorf("profile %q not found: %w", profileName, err)
+			return nil, fmt.Errorf("profile selection failed: %w", err)
 		}
-		return profile, nil
+		profileName = name
 	}
 
-	// No profile specified, use interactive selection
-	selector := ui.NewProfileSelector(cfg)
-	profile, _, err := selector.SelectProfile()
+	profile, _, err := cfg.ResolveProfile(profileName)
 	if err != nil {
-		return nil, fmt.Errorf("profile selection failed: %w", err)
+		return nil, fmt.Errorf("profile %q not found: %w", profileName, err)
 	}
 
 	return profile, nil
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+func TestResolveMethod(t *testing.T) {
+	noSFTP := &ssh.RemoteCapabilities{POSIXShell: true, HasRsync: true, HasSCP: true}
+
+	helper := &ConnectionHelper{Profile: &config.Profile{}, Capabilities: noSFTP}
+	helper.Profile.TransferOptions.Method = "sftp"
+	helper.ResolveMethod()
+	assert.Equal(t, "scp", helper.Profile.TransferOptions.Method)
+
+	helper.Profile.TransferOptions.Method = "sftp"
+	helper.Profile.TransferOptions.StrictMethod = true
+	helper.ResolveMethod()
+	assert.Equal(t, "sftp", helper.Profile.TransferOptions.Method)
+}
+
+func TestPlanConnection(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "id_ed25519")
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := gossh.MarshalPrivateKey(private, "")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+
+	// known_hosts records the host at the address it had before it moved
+	hostKey, err := gossh.NewPublicKey(private.Public())
+	require.NoError(t, err)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(t, ssh.AddKnownHost(knownHosts, "100.64.0.5", hostKey))
+
+	tests := []struct {
+		name      string
+		connected bool
+		peers     map[string]string
+		setup     func(p *config.Profile)
+		check     func(t *testing.T, plan *ConnectionPlan)
+	}{
+		{
+			name:      "known host",
+			connected: true,
+			peers:     map[string]string{"web": "100.64.0.5"},
+			check: func(t *testing.T, plan *ConnectionPlan) {
+				assert.NoError(t, plan.Problem)
+				assert.Equal(t, "100.64.0.5", plan.ResolvedHost)
+				assert.Equal(t, []string{"ssh-ed25519"}, plan.KnownHostKeys)
+				assert.Equal(t, []ssh.AuthMethodInfo{{Method: "publickey", Detail: keyPath}}, plan.Auth)
+			},
+		},
+		{
+			name:      "unknown host",
+			connected: true,
+			peers:     map[string]string{"web": "100.64.0.7"},
+			setup:     func(p *config.Profile) { p.RemoteHost = "db" },
+			check: func(t *testing.T, plan *ConnectionPlan) {
+				assert.ErrorContains(t, plan.Problem, "hostname resolution failed")
+				assert.Equal(t, "db", plan.ResolvedHost)
+				assert.Empty(t, plan.KnownHostKeys)
+			},
+		},
+		{
+			// The host key will be asked for again at the new address
+			name:      "changed host address",
+			connected: true,
+			peers:     map[string]string{"web": "100.64.0.9"},
+			check: func(t *testing.T, plan *ConnectionPlan) {
+				assert.NoError(t, plan.Problem)
+				assert.Equal(t, "100.64.0.9", plan.ResolvedHost)
+				assert.Empty(t, plan.KnownHostKeys)
+			},
+		},
+		{
+			name:      "pinned host key",
+			connected: true,
+			peers:     map[string]string{"web": "100.64.0.9"},
+			setup:     func(p *config.Profile) { p.HostKeyFingerprint = gossh.FingerprintSHA256(hostKey) },
+			check: func(t *testing.T, plan *ConnectionPlan) {
+				assert.Equal(t, gossh.FingerprintSHA256(hostKey), plan.PinnedFingerprint)
+			},
+		},
+		{
+			name:      "jump hosts",
+			connected: true,
+			peers:     map[string]string{"bastion": "100.64.0.1"},
+			setup:     func(p *config.Profile) { p.JumpHosts = []config.JumpHost{{Host: "bastion", User: "ops"}} },
+			check: func(t *testing.T, plan *ConnectionPlan) {
+				assert.NoError(t, plan.Problem)
+				assert.Equal(t, []string{"ops@bastion"}, plan.JumpHosts)
+				assert.Equal(t, []string{"100.64.0.1"}, plan.ResolvedJumps)
+				assert.Equal(t, "web", plan.ResolvedHost)
+			},
+		},
+		{
+			name:  "backend down",
+			peers: map[string]string{"web": "100.64.0.5"},
+			check: func(t *testing.T, plan *ConnectionPlan) {
+				assert.ErrorContains(t, plan.Problem, "backend tailscale is not connected")
+				assert.Equal(t, "web", plan.ResolvedHost)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := config.NewProfile("web", "deploy", "web")
+			profile.SSHKeyPath = keyPath
+			if tt.setup != nil {
+				tt.setup(profile)
+			}
+			h := &ConnectionHelper{
+				Config:  &config.Config{},
+				Profile: profile,
+				Backend: &clitest.Backend{
+					Status:    backend.Status{Backend: "tailscale", Connected: tt.connected},
+					Installed: true,
+					Peers:     tt.peers,
+				},
+				Log:            logger.New(false),
+				KnownHostsPath: knownHosts,
+				KeyDir:         dir,
+			}
+			plan := h.PlanConnection(context.Background())
+			assert.Equal(t, "web", plan.Profile)
+			assert.Equal(t, "tailscale", plan.Backend)
+			tt.check(t, plan)
+		})
+	}
+}
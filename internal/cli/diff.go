@@ -0,0 +1,32 @@
+// Package cli - Diff output
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// PrintDiff prints a unified diff with added and removed lines colored,
+// through the pager if it is long and noPager is not set
+func PrintDiff(diff string, noPager bool) {
+	pager := ui.StartPager(noPager)
+	defer pager.Close()
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Print(ui.Bold(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Print(ui.Success(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Print(ui.Error(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Print(ui.Dim(line))
+		default:
+			fmt.Print(line)
+		}
+	}
+}
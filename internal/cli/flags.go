@@ -3,6 +3,11 @@
 package cli
 
 import (
+	"time"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/tracing"
+	"github.com/orpheus497/klip/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +28,42 @@ var (
 	DestPath         string
 	Method           string
 	CompressionLevel int
+
+	// Confirmation flags
+	AssumeYes      bool
+	Force          bool
+	NonInteractive bool
+
+	// Wait flags
+	Wait    bool
+	WaitFor time.Duration
+
+	// Authentication flags
+	PassphraseEnv string
+
+	// Sudo flags
+	Sudo            bool
+	SudoPasswordEnv string
+
+	// Keepalive flags
+	KeepAlive    time.Duration
+	KeepAliveMax int
+	Reconnect    bool
+
+	// Output flags
+	Output string
+
+	// Conflict flags
+	Prefer string
+)
+
+const (
+	// DefaultKeepAlive is the default interval between keepalives
+	DefaultKeepAlive = 15 * time.Second
+
+	// DefaultKeepAliveMax is how many keepalives in a row may go unanswered
+	// before the connection is considered dead
+	DefaultKeepAliveMax = 3
 )
 
 // AddProfileFlags adds profile-related flags to a command
@@ -32,7 +73,7 @@ func AddProfileFlags(cmd *cobra.Command) {
 
 // AddBackendFlags adds backend-related flags to a command
 func AddBackendFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&BackendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird)")
+	cmd.Flags().StringVarP(&BackendName, "backend", "b", "", "VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)")
 }
 
 // AddConnectionFlags adds connection-related flags to a command
@@ -49,10 +90,85 @@ func AddDryRunFlag(cmd *cobra.Command) {
 // AddTransferFlags adds file transfer-related flags to a command
 func AddTransferFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&DestPath, "dest", "d", "", "Destination path")
-	cmd.Flags().StringVarP(&Method, "method", "m", "rsync", "Transfer method (rsync, sftp)")
+	cmd.Flags().StringVarP(&Method, "method", "m", "rsync", "Transfer method (rsync, sftp, delta, scp)")
 	cmd.Flags().IntVarP(&CompressionLevel, "compress", "z", 6, "Compression level (0-9, 0=disabled)")
 }
 
+// AddConfirmFlags adds --yes/-y, --force and --non-interactive to a command
+// and its subcommands
+func AddConfirmFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVarP(&AssumeYes, "yes", "y", false, "Answer yes to confirmation prompts")
+	cmd.PersistentFlags().BoolVar(&Force, "force", false, "Proceed with destructive actions without confirmation")
+	cmd.PersistentFlags().BoolVar(&NonInteractive, "non-interactive", false, "Never prompt: fail instead of asking for input --yes cannot answer")
+}
+
+// AddWaitFlags adds --wait and --for to a command
+func AddWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&Wait, "wait", false, "Wait for the host to come up before connecting")
+	cmd.Flags().DurationVar(&WaitFor, "for", DefaultWaitFor, "How long --wait waits for the host")
+}
+
+// AddKeepAliveFlags adds --keepalive and --keepalive-max to a command
+func AddKeepAliveFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&KeepAlive, "keepalive", DefaultKeepAlive, "Interval between keepalives (0 disables)")
+	cmd.Flags().IntVar(&KeepAliveMax, "keepalive-max", DefaultKeepAliveMax, "Unanswered keepalives in a row before the connection is considered dead")
+}
+
+// AddReconnectFlag adds --reconnect to a command
+func AddReconnectFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&Reconnect, "reconnect", false, "Reconnect and start a new shell when the connection drops")
+}
+
+// AddPassphraseFlags adds --passphrase-env to a command and its subcommands
+func AddPassphraseFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&PassphraseEnv, "passphrase-env", "", "Read the private key passphrase from this environment variable instead of prompting")
+}
+
+// AddSudoFlags adds --sudo and --sudo-password-env to a command
+func AddSudoFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&Sudo, "sudo", false, "Upload to a staging directory and install the files with sudo on the remote host")
+	cmd.Flags().StringVar(&SudoPasswordEnv, "sudo-password-env", "", "Read the remote sudo password from this environment variable instead of prompting")
+}
+
+// AddTraceFlags adds --trace to a command and its subcommands
+func AddTraceFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&tracing.Summary, "trace", false, "Print how long each phase of connections and transfers took")
+}
+
+// AddOutputFlags adds --output to a command and its subcommands
+func AddOutputFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&Output, "output", string(ui.OutputText), "Output format: text or json")
+}
+
+// AddConfigStoreFlags adds --config-store, --config-store-mode and
+// --config-store-ttl to a command and its subcommands. They default to
+// $KLIP_CONFIG_STORE, $KLIP_CONFIG_STORE_MODE and $KLIP_CONFIG_STORE_TTL.
+func AddConfigStoreFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&config.StoreURL, "config-store", config.StoreURL, "Add the profiles of a remote store (consul+https://, etcd+https://, s3:// or https:// URL)")
+	cmd.PersistentFlags().StringVar(&config.StoreMode, "config-store-mode", config.StoreMode, "Whether changes are saved to the config store: ro or rw")
+	cmd.PersistentFlags().DurationVar(&config.StoreTTL, "config-store-ttl", config.StoreTTL, "How long a configuration fetched from the store is used before fetching it again")
+}
+
+// AddConflictFlags adds --prefer to a command
+func AddConflictFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&Prefer, "prefer", "", "Resolve sync conflicts without asking: local, remote, newer, both or skip")
+}
+
+// ApplyOutputFormat selects the output format given with --output
+func ApplyOutputFormat() error {
+	format, err := ui.ParseOutputFormat(Output)
+	if err != nil {
+		return err
+	}
+	ui.SetOutputFormat(format)
+	return nil
+}
+
+// ConfirmPolicy returns the confirmation policy selected by the flags
+func ConfirmPolicy() ui.ConfirmPolicy {
+	return ui.ConfirmPolicy{Yes: AssumeYes, Force: Force, NonInteractive: NonInteractive}
+}
+
 // AddCommonFlags adds all common flags to a command (profile, backend, connection)
 func AddCommonFlags(cmd *cobra.Command) {
 	AddProfileFlags(cmd)
@@ -78,4 +194,17 @@ func ResetFlags() {
 	DestPath = ""
 	Method = "rsync"
 	CompressionLevel = 6
+	AssumeYes = false
+	Force = false
+	NonInteractive = false
+	Wait = false
+	WaitFor = DefaultWaitFor
+	PassphraseEnv = ""
+	KeepAlive = DefaultKeepAlive
+	KeepAliveMax = DefaultKeepAliveMax
+	Reconnect = false
+	Sudo = false
+	SudoPasswordEnv = ""
+	Output = string(ui.OutputText)
+	Prefer = ""
 }
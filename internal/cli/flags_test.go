@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orpheus497/klip/internal/config"
+)
+
+func TestPassphraseEnvFlag(t *testing.T) {
+	t.Cleanup(ResetFlags)
+	root := &cobra.Command{Use: "klip"}
+	AddPassphraseFlags(root)
+	root.AddCommand(&cobra.Command{Use: "push", Run: func(*cobra.Command, []string) {}})
+	root.SetArgs([]string{"push", "--passphrase-env", "KLIP_PASSPHRASE"})
+	require.NoError(t, root.Execute())
+	assert.Equal(t, "KLIP_PASSPHRASE", PassphraseEnv)
+
+	// The variable reaches the remote host's key and every jump hop's
+	profile := &config.Profile{RemoteUser: "deploy", RemoteHost: "db", SSHKeyPath: "/keys/id_ed25519"}
+	h := &ConnectionHelper{Config: &config.Config{}, Profile: profile}
+	cfg, err := h.sshConfig(context.Background(), nil, "db", "db", 30)
+	require.NoError(t, err)
+	assert.Equal(t, "KLIP_PASSPHRASE", cfg.PassphraseEnv)
+
+	profile.JumpHosts = []config.JumpHost{{Host: "edge"}, {Host: "bastion", Key: "/keys/bastion"}}
+	for hop := JumpSSHConfig(profile, []string{"edge", "bastion"}, time.Minute); hop != nil; hop = hop.Jump {
+		assert.Equal(t, "KLIP_PASSPHRASE", hop.PassphraseEnv, hop.Host)
+	}
+}
@@ -0,0 +1,125 @@
+// Package cli - Alternate hostnames of a profile
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// hostRaceStagger delays each LAN probe after the first, so a name listed
+// earlier wins when several answer at about the same time
+const hostRaceStagger = 250 * time.Millisecond
+
+// checkBanner probes a host for an SSH server; replaced in tests
+var checkBanner = ssh.CheckBanner
+
+// HostOrder lists the profile's hostnames (see config.Profile.HostNames) in
+// the order to try them through backend b. VPN backends and jump chains
+// keep the configured order. On the LAN the names are raced: each is
+// probed for an SSH banner and the first to answer is tried first,
+// followed by the others in configured order.
+func HostOrder(ctx context.Context, b backend.Backend, profile *config.Profile) []string {
+	names := profile.HostNames()
+	if len(names) == 1 || b.Name() != "lan" || len(profile.JumpChain()) > 0 {
+		return names
+	}
+
+	winner := raceHosts(ctx, names, profile.SSHPort)
+	if winner == "" {
+		return names
+	}
+	ordered := []string{winner}
+	for _, name := range names {
+		if name != winner {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered
+}
+
+// raceHosts probes names for an SSH server, starting each probe
+// hostRaceStagger after the previous one, and returns the first name to
+// answer, or "" if none does
+func raceHosts(ctx context.Context, names []string, port int) string {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Losing probes are not waited for, so they must not read the variable
+	probe := checkBanner
+	answered := make(chan string, len(names))
+	for i, name := range names {
+		go func(delay time.Duration, name string) {
+			select {
+			case <-ctx.Done():
+				answered <- ""
+				return
+			case <-time.After(delay):
+			}
+			if err := probe(ctx, name, port); err != nil {
+				answered <- ""
+				return
+			}
+			answered <- name
+		}(time.Duration(i)*hostRaceStagger, name)
+	}
+
+	for range names {
+		if name := <-answered; name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// unresolvedError marks a hostname the backend could not resolve
+type unresolvedError struct {
+	err error
+}
+
+func (e *unresolvedError) Error() string { return e.err.Error() }
+func (e *unresolvedError) Unwrap() error { return e.err }
+
+// ConnectHosts connects to the first of hosts that can be reached, calling
+// connect for each in turn, and returns the client and the host it reached.
+// Each call gets a context of its own bounded by timeout (0 for none), so
+// a host that hangs leaves the next one its full time. A host that cannot
+// be resolved, dialed or reached within the timeout moves on to the next
+// one; any other failure, such as a rejected host key or authentication,
+// ends the attempt, as every host names the same machine.
+func ConnectHosts(ctx context.Context, hosts []string, timeout time.Duration, connect func(ctx context.Context, host string) (*ssh.Client, error)) (*ssh.Client, string, error) {
+	var errs []error
+	for _, host := range hosts {
+		client, err := connectWithin(ctx, host, timeout, connect)
+		if err == nil {
+			return client, host, nil
+		}
+		if len(hosts) == 1 {
+			return nil, "", err
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", host, err))
+		var unresolved *unresolvedError
+		timedOut := errors.Is(err, context.DeadlineExceeded)
+		if !errors.As(err, &unresolved) && !ssh.IsUnreachable(err) && !timedOut || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// connectWithin calls connect for one host of ConnectHosts within timeout
+func connectWithin(ctx context.Context, host string, timeout time.Duration, connect func(ctx context.Context, host string) (*ssh.Client, error)) (*ssh.Client, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return connect(ctx, host)
+}
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// namedBackend is a backend that only reports its name
+type namedBackend struct {
+	backend.Backend
+	name string
+}
+
+func (b namedBackend) Name() string { return b.name }
+
+// stubBanner replaces checkBanner for a test: hosts in up answer after
+// their delay, any other host fails
+func stubBanner(t *testing.T, up map[string]time.Duration) {
+	t.Helper()
+	orig := checkBanner
+	checkBanner = func(ctx context.Context, host string, port int) error {
+		delay, ok := up[host]
+		if !ok {
+			return errors.New("connection refused")
+		}
+		select {
+		case <-time.After(delay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	t.Cleanup(func() { checkBanner = orig })
+}
+
+func TestHostOrder(t *testing.T) {
+	profile := &config.Profile{RemoteHost: "a", Hosts: []string{"b", "c"}, SSHPort: 22}
+	lan := namedBackend{name: "lan"}
+
+	t.Run("single name", func(t *testing.T) {
+		stubBanner(t, nil)
+		single := &config.Profile{RemoteHost: "a"}
+		assert.Equal(t, []string{"a"}, HostOrder(context.Background(), lan, single))
+	})
+
+	t.Run("vpn keeps order", func(t *testing.T) {
+		stubBanner(t, map[string]time.Duration{"c": 0})
+		got := HostOrder(context.Background(), namedBackend{name: "tailscale"}, profile)
+		assert.Equal(t, []string{"a", "b", "c"}, got)
+	})
+
+	t.Run("jump chain keeps order", func(t *testing.T) {
+		stubBanner(t, map[string]time.Duration{"c": 0})
+		jumped := *profile
+		jumped.JumpHosts = []config.JumpHost{{Host: "bastion"}}
+		assert.Equal(t, []string{"a", "b", "c"}, HostOrder(context.Background(), lan, &jumped))
+	})
+
+	t.Run("lan puts winner first", func(t *testing.T) {
+		stubBanner(t, map[string]time.Duration{"c": 0})
+		assert.Equal(t, []string{"c", "a", "b"}, HostOrder(context.Background(), lan, profile))
+	})
+
+	t.Run("lan without answer keeps order", func(t *testing.T) {
+		stubBanner(t, nil)
+		assert.Equal(t, []string{"a", "b", "c"}, HostOrder(context.Background(), lan, profile))
+	})
+}
+
+func TestRaceHosts(t *testing.T) {
+	t.Run("first to answer wins", func(t *testing.T) {
+		stubBanner(t, map[string]time.Duration{"a": time.Second, "b": 0})
+		assert.Equal(t, "b", raceHosts(context.Background(), []string{"a", "b"}, 22))
+	})
+
+	t.Run("stagger favours earlier names", func(t *testing.T) {
+		stubBanner(t, map[string]time.Duration{"a": 0, "b": 0})
+		assert.Equal(t, "a", raceHosts(context.Background(), []string{"a", "b"}, 22))
+	})
+
+	t.Run("none answers", func(t *testing.T) {
+		stubBanner(t, nil)
+		assert.Equal(t, "", raceHosts(context.Background(), []string{"a", "b"}, 22))
+	})
+}
+
+func TestConnectHosts(t *testing.T) {
+	unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	t.Run("moves past unresolved and unreachable hosts", func(t *testing.T) {
+		var tried []string
+		want := &ssh.Client{}
+		client, host, err := ConnectHosts(context.Background(), []string{"a", "b", "c"}, 0,
+			func(ctx context.Context, host string) (*ssh.Client, error) {
+				tried = append(tried, host)
+				switch host {
+				case "a":
+					return nil, &unresolvedError{err: errors.New("no such host")}
+				case "b":
+					return nil, unreachable
+				}
+				return want, nil
+			})
+		require.NoError(t, err)
+		assert.Same(t, want, client)
+		assert.Equal(t, "c", host)
+		assert.Equal(t, []string{"a", "b", "c"}, tried)
+	})
+
+	t.Run("stops on other errors", func(t *testing.T) {
+		var tried []string
+		_, _, err := ConnectHosts(context.Background(), []string{"a", "b"}, 0,
+			func(ctx context.Context, host string) (*ssh.Client, error) {
+				tried = append(tried, host)
+				return nil, errors.New("unable to authenticate")
+			})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "a: unable to authenticate")
+		assert.Equal(t, []string{"a"}, tried)
+	})
+
+	t.Run("single host error is returned as is", func(t *testing.T) {
+		_, _, err := ConnectHosts(context.Background(), []string{"a"}, 0,
+			func(ctx context.Context, host string) (*ssh.Client, error) {
+				return nil, unreachable
+			})
+		assert.Same(t, unreachable, err)
+	})
+
+	t.Run("each host gets its own deadline", func(t *testing.T) {
+		const timeout = 100 * time.Millisecond
+		var mu sync.Mutex
+		remaining := map[string]time.Duration{}
+		client, host, err := ConnectHosts(context.Background(), []string{"a", "b"}, timeout,
+			func(ctx context.Context, host string) (*ssh.Client, error) {
+				deadline, ok := ctx.Deadline()
+				require.True(t, ok)
+				mu.Lock()
+				remaining[host] = time.Until(deadline)
+				mu.Unlock()
+				if host == "a" {
+					// A host that hangs until its deadline
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				return &ssh.Client{}, nil
+			})
+		require.NoError(t, err)
+		assert.NotNil(t, client)
+		assert.Equal(t, "b", host)
+		assert.Greater(t, remaining["b"], timeout/2)
+	})
+
+	t.Run("cancelled parent stops", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var tried []string
+		_, _, err := ConnectHosts(ctx, []string{"a", "b"}, time.Second,
+			func(ctx context.Context, host string) (*ssh.Client, error) {
+				tried = append(tried, host)
+				cancel()
+				return nil, unreachable
+			})
+		require.Error(t, err)
+		assert.Equal(t, []string{"a"}, tried)
+	})
+}
@@ -0,0 +1,86 @@
+// Package cli - Jump hosts
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// ResolveJumpChain resolves the address of every jump host in the profile's
+// chain. A hop with its own backend is resolved through that backend; the
+// first hop otherwise goes through b, the same way the remote host would,
+// and later hops are left for the previous hop to resolve.
+func ResolveJumpChain(ctx context.Context, b backend.Backend, profile *config.Profile) ([]string, error) {
+	chain := profile.JumpChain()
+	addrs := make([]string, len(chain))
+	detector := backend.NewDetector(backend.NewRegistry()).Restrict(profile.BackendPermitted)
+
+	for i, hop := range chain {
+		addrs[i] = hop.Host
+
+		hopBackend := b
+		if hop.Backend != "" {
+			var err error
+			if hopBackend, err = detector.SelectBackend(ctx, string(hop.Backend)); err != nil {
+				return nil, fmt.Errorf("jump host %s: %w", hop.Host, err)
+			}
+		} else if i > 0 {
+			continue
+		}
+		if hopBackend.Name() == "lan" {
+			continue
+		}
+
+		ip, err := hopBackend.GetPeerIP(ctx, hop.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve jump host %s via %s: %w", hop.Host, hopBackend.Name(), err)
+		}
+		addrs[i] = ip
+	}
+
+	return addrs, nil
+}
+
+// JumpSSHConfig returns the SSH configuration for the profile's jump chain
+// at the addresses from ResolveJumpChain, last hop outermost; the user and
+// key of each hop default to the profile's own and its timeout to timeout
+func JumpSSHConfig(profile *config.Profile, addrs []string, timeout time.Duration) *ssh.Config {
+	var jump *ssh.Config
+	for i, hop := range profile.JumpChain() {
+		user := hop.User
+		if user == "" {
+			user = profile.RemoteUser
+		}
+		keyPath := hop.Key
+		provider := ""
+		if keyPath == "" {
+			keyPath = profile.SSHKeyPath
+			provider = profile.PKCS11Provider
+		}
+		hopTimeout := timeout
+		if hop.Timeout > 0 {
+			hopTimeout = time.Duration(hop.Timeout) * time.Second
+		}
+
+		jump = &ssh.Config{
+			Host:           addrs[i],
+			HostName:       hop.Host,
+			Port:           hop.SSHPort(),
+			User:           user,
+			KeyPath:        keyPath,
+			UsePassword:    profile.UsePassword && hop.Key == "",
+			Timeout:        hopTimeout,
+			PassphraseEnv:  PassphraseEnv,
+			PKCS11Provider: provider,
+			NonInteractive: NonInteractive,
+			Jump:           jump,
+		}
+	}
+	return jump
+}
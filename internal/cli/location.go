@@ -0,0 +1,43 @@
+// Package cli - Network locations of profiles
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/location"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// locationTimeout bounds detecting the network
+const locationTimeout = 3 * time.Second
+
+// ApplyLocation returns the profile with the overrides for the network
+// location klip is on, and the steps of the choice. The network is only
+// detected for profiles with locations; others are returned unchanged,
+// without steps.
+func ApplyLocation(cfg *config.Config, profile *config.Profile) (*config.Profile, []string) {
+	if len(profile.Locations) == 0 {
+		return profile, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), locationTimeout)
+	defer cancel()
+
+	network := location.Detect(ctx)
+	matched, reason := location.Match(cfg.Settings.Locations, network)
+	var changes []string
+	if matched != nil {
+		profile, changes = profile.ForLocation(matched.Name)
+	}
+	return profile, location.Explain(network, matched, reason, changes)
+}
+
+// PrintLocationSteps explains the choice of ApplyLocation in verbose output
+func PrintLocationSteps(steps []string) {
+	for _, step := range steps {
+		ui.PrintInfo("Location: %s", step)
+	}
+}
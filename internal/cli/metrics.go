@@ -0,0 +1,131 @@
+// Package cli - Prometheus metrics of klip mux
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/metrics"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// backendCheckTimeout bounds the backend checks made for one scrape
+const backendCheckTimeout = 5 * time.Second
+
+// metricsBackends returns the backends whose health is reported; replaced
+// in tests
+var metricsBackends = func() []backend.Backend {
+	return backend.NewRegistry().List()
+}
+
+// MuxMetrics returns the metrics of a mux, described by info and counting
+// in stats, sharing a connection to the profile's host: its clients,
+// channels and relayed bytes, and the health of the backends the profile
+// may use. Every sample is labelled with the profile, so the metrics of
+// several muxes can be scraped side by side.
+func MuxMetrics(info ssh.MuxInfo, stats *ssh.MuxStats, profile *config.Profile) *metrics.Registry {
+	profileLabel := metrics.Label{Name: "profile", Value: info.Profile}
+
+	// count reads one of the mux's counters
+	count := func(v *atomic.Int64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			return []metrics.Sample{{Labels: []metrics.Label{profileLabel}, Value: float64(v.Load())}}
+		}
+	}
+
+	r := metrics.NewRegistry()
+	r.Gauge("klip_mux_info", "Connection shared by the mux, always 1", func() []metrics.Sample {
+		return []metrics.Sample{{Labels: []metrics.Label{
+			profileLabel,
+			{Name: "backend", Value: info.Backend},
+			{Name: "host", Value: info.ResolvedHost},
+		}, Value: 1}}
+	})
+	r.Gauge("klip_mux_start_time_seconds", "Time the mux connected, in seconds since the epoch", func() []metrics.Sample {
+		return []metrics.Sample{{Labels: []metrics.Label{profileLabel}, Value: float64(info.Started.Unix())}}
+	})
+	r.Counter("klip_mux_connections_total", "Connections from klip commands to the mux", count(&stats.Clients))
+	r.Gauge("klip_mux_connections", "Connections from klip commands to the mux open now", count(&stats.ActiveClients))
+	r.Counter("klip_mux_connection_failures_total", "Connections to the mux that failed the handshake", count(&stats.FailedClients))
+	r.Counter("klip_mux_channels_total", "Sessions, SFTP transfers and forwards relayed to the remote host", count(&stats.Channels))
+	r.Gauge("klip_mux_channels", "Channels relayed to the remote host open now", count(&stats.ActiveChannels))
+	r.Counter("klip_mux_channel_failures_total", "Channels the remote host refused", count(&stats.FailedChannels))
+	r.Counter("klip_mux_bytes_total", "Bytes relayed, sent to or received from the remote host", func() []metrics.Sample {
+		return []metrics.Sample{
+			{Labels: []metrics.Label{profileLabel, {Name: "direction", Value: "sent"}}, Value: float64(stats.BytesSent.Load())},
+			{Labels: []metrics.Label{profileLabel, {Name: "direction", Value: "received"}}, Value: float64(stats.BytesReceived.Load())},
+		}
+	})
+
+	health := &backendHealth{profile: profile}
+	r.Gauge("klip_backend_available", "Whether the backend is installed (1) or not (0)", func() []metrics.Sample {
+		return health.samples(profileLabel, func(s backendState) bool { return s.available })
+	})
+	r.Gauge("klip_backend_connected", "Whether the backend is connected (1) or not (0)", func() []metrics.Sample {
+		return health.samples(profileLabel, func(s backendState) bool { return s.connected })
+	})
+	return r
+}
+
+// backendState is the health of a backend when it was last checked
+type backendState struct {
+	name      string
+	available bool
+	connected bool
+}
+
+// backendHealth checks the profile's permitted backends for a scrape,
+// reusing the results for the other metrics of the same scrape
+type backendHealth struct {
+	profile *config.Profile
+
+	mu      sync.Mutex
+	checked time.Time
+	states  []backendState
+}
+
+// check returns the state of every permitted backend, checking them again
+// if the last check is more than a second old
+func (h *backendHealth) check() []backendState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.checked) < time.Second {
+		return h.states
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backendCheckTimeout)
+	defer cancel()
+
+	h.states = nil
+	for _, b := range metricsBackends() {
+		if !h.profile.BackendPermitted(b.Name()) {
+			continue
+		}
+		state := backendState{name: b.Name(), available: b.IsAvailable(ctx)}
+		state.connected = state.available && b.IsConnected(ctx)
+		h.states = append(h.states, state)
+	}
+	h.checked = time.Now()
+	return h.states
+}
+
+// samples returns one sample per backend, 1 where up reports true
+func (h *backendHealth) samples(profileLabel metrics.Label, up func(backendState) bool) []metrics.Sample {
+	var samples []metrics.Sample
+	for _, state := range h.check() {
+		value := 0.0
+		if up(state) {
+			value = 1
+		}
+		samples = append(samples, metrics.Sample{
+			Labels: []metrics.Label{profileLabel, {Name: "backend", Value: state.name}},
+			Value:  value,
+		})
+	}
+	return samples
+}
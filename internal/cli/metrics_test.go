@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// healthBackend is a backend that reports fixed health
+type healthBackend struct {
+	namedBackend
+	available, connected bool
+	checks               *int
+}
+
+func (b healthBackend) IsAvailable(ctx context.Context) bool {
+	*b.checks++
+	return b.available
+}
+
+func (b healthBackend) IsConnected(ctx context.Context) bool { return b.connected }
+
+func TestMuxMetrics(t *testing.T) {
+	checks := 0
+	orig := metricsBackends
+	metricsBackends = func() []backend.Backend {
+		return []backend.Backend{
+			healthBackend{namedBackend: namedBackend{name: "tailscale"}, available: true, connected: true, checks: &checks},
+			healthBackend{namedBackend: namedBackend{name: "netbird"}, available: true, checks: &checks},
+			healthBackend{namedBackend: namedBackend{name: "lan"}, available: true, connected: true, checks: &checks},
+		}
+	}
+	t.Cleanup(func() { metricsBackends = orig })
+
+	info := ssh.MuxInfo{Profile: "web", Backend: "tailscale", ResolvedHost: "100.64.0.7", Started: time.Unix(1700000123, 0)}
+	stats := &ssh.MuxStats{}
+	stats.Clients.Add(3)
+	stats.ActiveClients.Add(1)
+	stats.Channels.Add(5)
+	stats.FailedChannels.Add(1)
+	stats.BytesSent.Add(1024)
+	stats.BytesReceived.Add(2048)
+	profile := &config.Profile{Name: "web", DeniedBackends: []string{"lan"}}
+
+	r := MuxMetrics(info, stats, profile)
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	out := buf.String()
+	for _, line := range []string{
+		`klip_mux_info{profile="web",backend="tailscale",host="100.64.0.7"} 1`,
+		`klip_mux_start_time_seconds{profile="web"} 1.700000123e+09`,
+		`klip_mux_connections_total{profile="web"} 3`,
+		`klip_mux_connections{profile="web"} 1`,
+		`klip_mux_connection_failures_total{profile="web"} 0`,
+		`klip_mux_channels_total{profile="web"} 5`,
+		`klip_mux_channel_failures_total{profile="web"} 1`,
+		`klip_mux_bytes_total{profile="web",direction="sent"} 1024`,
+		`klip_mux_bytes_total{profile="web",direction="received"} 2048`,
+		`klip_backend_available{profile="web",backend="tailscale"} 1`,
+		`klip_backend_connected{profile="web",backend="tailscale"} 1`,
+		`klip_backend_connected{profile="web",backend="netbird"} 0`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+	// Backends the profile may not use are left out
+	assert.NotContains(t, out, `backend="lan"`)
+
+	// Counters are read at each scrape; the backends are checked once for
+	// both health metrics
+	assert.Equal(t, 2, checks)
+	stats.BytesSent.Add(1)
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	assert.Contains(t, buf.String(), `klip_mux_bytes_total{profile="web",direction="sent"} 1025`)
+}
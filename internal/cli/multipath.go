@@ -0,0 +1,35 @@
+// Package cli - Multipath transfer setup
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// EnableMultipath opens connections over the other connected backends and
+// adds them to cfg, reporting the paths in use
+// The returned function closes the extra connections
+func (h *ConnectionHelper) EnableMultipath(ctx context.Context, cfg *transfer.TransferConfig, timeout int) func() {
+	extra := h.CreateMultipathClients(ctx, timeout)
+	if len(extra) == 0 {
+		ui.PrintWarning("No second path to %s found, transferring over %s only", h.Profile.RemoteHost, h.Backend.Name())
+		return func() {}
+	}
+
+	paths := []string{h.Backend.Name() + " (" + h.ResolvedHost + ")"}
+	for _, c := range extra {
+		cfg.MultipathClients = append(cfg.MultipathClients, c.Client)
+		paths = append(paths, c.Backend+" ("+c.Address+")")
+	}
+	ui.PrintInfo("Multipath: striping large files across %s", strings.Join(paths, ", "))
+
+	return func() {
+		for _, c := range extra {
+			c.Client.Close()
+		}
+	}
+}
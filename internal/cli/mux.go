@@ -0,0 +1,37 @@
+// Package cli - Connection reuse through klip mux
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// muxDialTimeout bounds connecting to a local mux socket
+const muxDialTimeout = 2 * time.Second
+
+// DialMux connects to the klip mux holding a connection for profile,
+// returning nil if none is running or it was connected through a backend
+// other than backendName (when set)
+func DialMux(profile, backendName string) (*ssh.Client, *ssh.MuxInfo) {
+	socketPath := ssh.MuxSocketPath(profile)
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), muxDialTimeout)
+	defer cancel()
+
+	client, info, err := ssh.DialMux(ctx, socketPath)
+	if err != nil {
+		return nil, nil
+	}
+	if backendName != "" && backendName != "auto" && backendName != info.Backend {
+		client.Close()
+		return nil, nil
+	}
+	return client, info
+}
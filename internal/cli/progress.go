@@ -0,0 +1,76 @@
+// Package cli - Transfer progress output
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+	"golang.org/x/term"
+)
+
+var (
+	// throughput graphs the speed of the transfer progress lines printed
+	throughput = transfer.NewThroughputGraph()
+
+	// progressLineOpen is set while a progress line waits to be overwritten
+	progressLineOpen bool
+)
+
+// PrintProgress prints a transfer progress message, labelling deletes,
+// permission changes, directory creation and hard links so they stand
+// apart from file transfers. Like status messages, progress goes to stderr
+// in JSON mode.
+func PrintProgress(info transfer.ProgressInfo) {
+	if info.Message == "" {
+		return
+	}
+
+	out := ui.StatusOutput()
+	if info.Operation == transfer.OperationTransfer && info.Speed > 0 {
+		printProgressLine(out, info)
+		return
+	}
+	if progressLineOpen {
+		fmt.Fprintln(out)
+		progressLineOpen = false
+	}
+
+	switch info.Operation {
+	case transfer.OperationDelete:
+		fmt.Fprintf(out, "%s %s\n", ui.Warning("[delete]"), info.Message)
+	case transfer.OperationChmod, transfer.OperationMkdir, transfer.OperationLink, transfer.OperationVerify:
+		fmt.Fprintf(out, "%s %s\n", ui.Dim("["+string(info.Operation)+"]"), info.Message)
+	default:
+		fmt.Fprintln(out, info.Message)
+	}
+}
+
+// printProgressLine prints a progress update of the current file followed
+// by the throughput graph. On a terminal each update overwrites the last;
+// otherwise only the final update of each file is printed.
+func printProgressLine(out io.Writer, info transfer.ProgressInfo) {
+	throughput.Add(info.Speed)
+	done := info.TotalBytes > 0 && info.TransferredBytes >= info.TotalBytes
+
+	line := info.Message
+	if graph := throughput.String(); graph != "" {
+		line += "  " + ui.Dim(graph)
+	}
+
+	if f, ok := out.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		if done {
+			fmt.Fprintln(out, line)
+		}
+		return
+	}
+
+	fmt.Fprintf(out, "\r%s\x1b[K", line)
+	progressLineOpen = !done
+	if done {
+		fmt.Fprintln(out)
+	}
+}
@@ -0,0 +1,77 @@
+// Package cli - Transfer result output
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"time"
+
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// TransferResult is the outcome of a push or pull, rendered as a status line
+// or, with --output json, as a JSON document
+type TransferResult struct {
+	Profile     string  `json:"profile"`
+	Host        string  `json:"host"`
+	Direction   string  `json:"direction"`
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Status      string  `json:"status"`
+	Seconds     float64 `json:"seconds"`
+	Decrypted   int     `json:"decrypted,omitempty"`
+	Error       string  `json:"error,omitempty"`
+
+	// Verified lists the per-file checksums of a transfer run with --verify
+	Verified []transfer.VerifyResult `json:"verified,omitempty"`
+}
+
+// NewTransferResult builds a result from the audit status of a transfer
+func NewTransferResult(profile, host, direction, source, destination, status string, elapsed time.Duration, err error) TransferResult {
+	result := TransferResult{
+		Profile:     profile,
+		Host:        host,
+		Direction:   direction,
+		Source:      source,
+		Destination: destination,
+		Status:      status,
+		Seconds:     elapsed.Seconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// PrintTransferResult reports a transfer. A failed transfer is also
+// reported on stderr so scripts reading JSON still see why it failed.
+func PrintTransferResult(result TransferResult) error {
+	if result.Error != "" {
+		ui.PrintError("Transfer failed: %s", result.Error)
+		for _, file := range result.Verified {
+			switch {
+			case file.Error != "":
+				ui.PrintError("Could not verify %s: %s", file.Path, file.Error)
+			case !file.OK():
+				ui.PrintError("Checksum mismatch: %s (source %s, destination %s)", file.Path, file.SourceSHA256, file.DestSHA256)
+			}
+		}
+		if !ui.JSONOutput() {
+			return nil
+		}
+	}
+
+	return ui.Render(result, func() {
+		if result.Status == "dry_run" {
+			ui.PrintSuccess("Dry run completed in %.2fs", result.Seconds)
+			return
+		}
+		ui.PrintSuccess("Transfer completed in %.2fs", result.Seconds)
+		if len(result.Verified) > 0 {
+			ui.PrintSuccess("Verified %d files (SHA-256)", len(result.Verified))
+		}
+		if result.Decrypted > 0 {
+			ui.PrintSuccess("Decrypted %d files", result.Decrypted)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+// Package cli - Split tunneling checks for LAN connections
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/cache"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// checkLANRoute works out the route of a LAN connection to address, which
+// host resolves to; replaced in tests
+var checkLANRoute = func(ctx context.Context, host, address string) *backend.LANRoute {
+	return backend.NewDetector(backend.NewRegistry()).CheckLANRoute(ctx, host, address)
+}
+
+// knownPeer reports whether a VPN backend has resolved host before, going
+// by the cache file; replaced in tests
+var knownPeer = func(host string) bool {
+	store, err := cache.OpenStore()
+	if err != nil {
+		return false
+	}
+	return len(store.PeerBackends(host)) > 0
+}
+
+// CheckEncryptedPath checks how a connection to host through backend b
+// travels when b is the LAN backend, and returns the address it checked,
+// which the connection must dial rather than resolving host again ("" if
+// nothing was checked). If the host is also a VPN peer but the route
+// crosses the open network, it warns; with the profile's
+// require_encrypted_path it refuses any route no connected VPN carries.
+// Asking every backend for its peers is slow, so without
+// require_encrypted_path only hosts a VPN backend has resolved before are
+// checked. Behind jump hosts the host is dialed by the last one, so only
+// direct connections are checked.
+func CheckEncryptedPath(ctx context.Context, b backend.Backend, profile *config.Profile, host string) (string, error) {
+	if b.Name() != "lan" || len(profile.JumpChain()) > 0 {
+		return "", nil
+	}
+	if !profile.RequireEncryptedPath && !knownPeer(host) {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, livenessTimeout)
+	defer cancel()
+
+	address, err := b.GetPeerIP(ctx, host)
+	if err != nil {
+		if profile.RequireEncryptedPath {
+			return "", fmt.Errorf("require_encrypted_path is set and the route to %s cannot be checked: %w", host, err)
+		}
+		// Connecting reports the resolution failure
+		return "", nil
+	}
+
+	route := checkLANRoute(ctx, host, address)
+	if route.Encrypted() {
+		return address, nil
+	}
+
+	var peers []string
+	for _, peer := range route.Peers {
+		peers = append(peers, peer.Backend)
+	}
+	if profile.RequireEncryptedPath {
+		target := host
+		if address != host {
+			target = fmt.Sprintf("%s (%s)", host, address)
+		}
+		hint := "connect a VPN backend that reaches it"
+		if len(peers) > 0 {
+			hint = "use --backend " + peers[0]
+		}
+		return "", fmt.Errorf("refusing to connect to %s over the open network: require_encrypted_path is set and no connected VPN carries the route; %s", target, hint)
+	}
+	if len(peers) > 0 {
+		ui.PrintWarning("%s is a peer on %s, but the LAN route to %s crosses the open network rather than the VPN; use --backend %s to stay on it",
+			host, strings.Join(peers, ", "), address, peers[0])
+	}
+	return address, nil
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+)
+
+// resolvingBackend is a LAN backend resolving every host to address
+type resolvingBackend struct {
+	namedBackend
+	address string
+	err     error
+}
+
+func (b resolvingBackend) GetPeerIP(ctx context.Context, host string) (string, error) {
+	return b.address, b.err
+}
+
+// stubRoute replaces knownPeer and checkLANRoute for a test: peers are the
+// known peers, routed through vpn, and checked counts the route checks
+func stubRoute(t *testing.T, peers map[string]bool, vpn string, checked *int) {
+	t.Helper()
+	origPeer, origRoute := knownPeer, checkLANRoute
+	knownPeer = func(host string) bool { return peers[host] }
+	checkLANRoute = func(ctx context.Context, host, address string) *backend.LANRoute {
+		*checked++
+		route := &backend.LANRoute{Host: host, Address: address, VPN: vpn}
+		if peers[host] {
+			route.Peers = []backend.PeerLiveness{{Backend: "tailscale", Online: true, IP: "100.64.0.7"}}
+		}
+		return route
+	}
+	t.Cleanup(func() { knownPeer, checkLANRoute = origPeer, origRoute })
+}
+
+func TestCheckEncryptedPath(t *testing.T) {
+	ctx := context.Background()
+	lan := resolvingBackend{namedBackend: namedBackend{name: "lan"}, address: "192.0.2.10"}
+	profile := &config.Profile{RemoteHost: "workbox"}
+	required := &config.Profile{RemoteHost: "workbox", RequireEncryptedPath: true}
+
+	t.Run("unknown hosts are not checked", func(t *testing.T) {
+		checked := 0
+		stubRoute(t, nil, "", &checked)
+		address, err := CheckEncryptedPath(ctx, lan, profile, "workbox")
+		require.NoError(t, err)
+		assert.Empty(t, address)
+		assert.Zero(t, checked)
+	})
+
+	t.Run("vpn backends and jump hosts are not checked", func(t *testing.T) {
+		checked := 0
+		stubRoute(t, map[string]bool{"workbox": true}, "", &checked)
+		tailscale := resolvingBackend{namedBackend: namedBackend{name: "tailscale"}, address: "100.64.0.7"}
+		address, err := CheckEncryptedPath(ctx, tailscale, required, "workbox")
+		require.NoError(t, err)
+		assert.Empty(t, address)
+
+		jumped := &config.Profile{RemoteHost: "workbox", JumpHost: &config.JumpHost{Host: "bastion"}, RequireEncryptedPath: true}
+		address, err = CheckEncryptedPath(ctx, lan, jumped, "workbox")
+		require.NoError(t, err)
+		assert.Empty(t, address)
+		assert.Zero(t, checked)
+	})
+
+	t.Run("known peer returns the checked address", func(t *testing.T) {
+		checked := 0
+		stubRoute(t, map[string]bool{"workbox": true}, "", &checked)
+		address, err := CheckEncryptedPath(ctx, lan, profile, "workbox")
+		require.NoError(t, err)
+		assert.Equal(t, "192.0.2.10", address)
+		assert.Equal(t, 1, checked)
+	})
+
+	t.Run("required path refuses the open network", func(t *testing.T) {
+		checked := 0
+		stubRoute(t, map[string]bool{"workbox": true}, "", &checked)
+		_, err := CheckEncryptedPath(ctx, lan, required, "workbox")
+		assert.ErrorContains(t, err, "refusing to connect to workbox (192.0.2.10)")
+		assert.ErrorContains(t, err, "use --backend tailscale")
+
+		stubRoute(t, nil, "", &checked)
+		_, err = CheckEncryptedPath(ctx, lan, required, "otherbox")
+		assert.ErrorContains(t, err, "connect a VPN backend that reaches it")
+	})
+
+	t.Run("required path allows a vpn route", func(t *testing.T) {
+		checked := 0
+		stubRoute(t, nil, "wireguard", &checked)
+		address, err := CheckEncryptedPath(ctx, lan, required, "workbox")
+		require.NoError(t, err)
+		assert.Equal(t, "192.0.2.10", address)
+	})
+
+	t.Run("required path needs a resolvable host", func(t *testing.T) {
+		checked := 0
+		stubRoute(t, nil, "", &checked)
+		failing := resolvingBackend{namedBackend: namedBackend{name: "lan"}, err: errors.New("no such host")}
+		_, err := CheckEncryptedPath(ctx, failing, required, "workbox")
+		assert.ErrorContains(t, err, "cannot be checked: no such host")
+
+		address, err := CheckEncryptedPath(ctx, failing, profile, "workbox")
+		require.NoError(t, err)
+		assert.Empty(t, address)
+		assert.Zero(t, checked)
+	})
+}
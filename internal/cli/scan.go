@@ -0,0 +1,84 @@
+// Package cli - Pre-upload scanning
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// ScanUpload runs the profile's pre_upload_scan command over the files
+// below source and records the outcome in the audit log. Findings or a
+// scanner that cannot be run block the upload. Returns false if the upload
+// must not proceed.
+func (h *ConnectionHelper) ScanUpload(ctx context.Context, source string) bool {
+	opts := h.Profile.TransferOptions
+	return h.scanUpload(source, func() (*transfer.ScanResult, error) {
+		return transfer.Scan(ctx, opts.PreUploadScan, source, opts.Excludes())
+	})
+}
+
+// ScanUploadFiles is ScanUpload for some files below source, such as the
+// files a sync pass or watched push is about to upload
+func (h *ConnectionHelper) ScanUploadFiles(ctx context.Context, source string, files []string) bool {
+	if len(files) == 0 {
+		return true
+	}
+	return h.scanUpload(source, func() (*transfer.ScanResult, error) {
+		return transfer.ScanFiles(ctx, h.Profile.TransferOptions.PreUploadScan, files)
+	})
+}
+
+// scanUpload runs scan if the profile has a pre_upload_scan command,
+// reporting and auditing its outcome for source
+func (h *ConnectionHelper) scanUpload(source string, scan func() (*transfer.ScanResult, error)) bool {
+	opts := h.Profile.TransferOptions
+	if len(opts.PreUploadScan) == 0 {
+		return true
+	}
+
+	var result *transfer.ScanResult
+	err := ui.NewStepRunner(1).Run("Scanning with "+opts.PreUploadScan[0], func() error {
+		var err error
+		result, err = scan()
+		return err
+	})
+
+	metadata := map[string]string{"command": strings.Join(opts.PreUploadScan, " ")}
+	status := "failed"
+	if result != nil {
+		metadata["files"] = strconv.Itoa(result.Files)
+		status = "clean"
+		if !result.Clean {
+			status = "blocked"
+			metadata["exit_code"] = strconv.Itoa(result.ExitCode)
+			metadata["findings"] = strings.Join(result.Findings, "\n")
+		}
+	}
+
+	if auditLogger, auditErr := logger.NewAuditLogger(true); auditErr == nil {
+		_ = auditLogger.LogScan(h.Profile.Name, h.Profile.RemoteUser, h.Profile.RemoteHost,
+			h.Backend.Name(), source, status, metadata, err)
+		auditLogger.Close()
+	}
+
+	if err != nil {
+		ui.PrintError("Pre-upload scan failed: %v", err)
+		return false
+	}
+	if !result.Clean {
+		ui.PrintError("Pre-upload scan blocked the transfer: %s exited with status %d", opts.PreUploadScan[0], result.ExitCode)
+		if len(result.Findings) > 0 {
+			ui.PrintList(result.Findings)
+		}
+		return false
+	}
+
+	ui.PrintSuccess("Scanned %d file(s), no findings", result.Files)
+	return true
+}
@@ -0,0 +1,79 @@
+// Package cli - Global UI settings
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/logger"
+	"github.com/orpheus497/klip/internal/tracing"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// InitUI applies settings.theme and settings.locale (or the environment's
+// locale), the audit log rotation and sinks of settings.audit, and the
+// trace collector of settings.tracing. Failures leave the default theme,
+// English messages and default rotation active; invalid sinks are skipped
+// and tracing stays off, with a warning.
+func InitUI() {
+	settings := config.DefaultSettings()
+	if path, err := config.ConfigPath(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			if cfg, err := config.Load(); err == nil {
+				settings = cfg.Settings
+			}
+		}
+	}
+
+	if err := ui.ApplyTheme(settings.Theme); err != nil {
+		ui.PrintWarning("Invalid theme setting: %v", err)
+	}
+
+	if err := ui.SetLocale(ui.DetectLocale(settings.Locale)); err != nil {
+		ui.PrintWarning("Failed to load messages: %v", err)
+	}
+
+	logger.Rotation = auditRotation(settings.Audit)
+	logger.Sinks = auditSinks(settings.Audit.Sinks)
+
+	if err := tracing.Configure(settings.Tracing.Endpoint, settings.Tracing.Headers); err != nil {
+		ui.PrintWarning("Tracing disabled: %v", err)
+	}
+	tracing.OnError = func(err error) {
+		ui.PrintWarning("%v", err)
+	}
+}
+
+// auditSinks converts settings.audit.sinks into audit sinks
+func auditSinks(sinks []config.AuditSink) []logger.SinkConfig {
+	var configs []logger.SinkConfig
+	for _, sink := range sinks {
+		sinkConfig := sink.SinkConfig()
+		if err := sinkConfig.Validate(); err != nil {
+			ui.PrintWarning("Invalid audit sink: %v", err)
+			continue
+		}
+		configs = append(configs, sinkConfig)
+	}
+	return configs
+}
+
+// auditRotation converts settings.audit into the audit log rotation policy
+func auditRotation(audit config.AuditSettings) logger.RotationPolicy {
+	const day = 24 * time.Hour
+	policy := logger.RotationPolicy{
+		MaxAge:    time.Duration(audit.RotateDays) * day,
+		Retention: time.Duration(audit.RetentionDays) * day,
+	}
+	if audit.MaxSize != "" {
+		size, err := config.ParseSize(audit.MaxSize)
+		if err != nil {
+			ui.PrintWarning("Invalid audit max_size setting: %v", err)
+			size = logger.DefaultRotation.MaxSize
+		}
+		policy.MaxSize = size
+	}
+	return policy
+}
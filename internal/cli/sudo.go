@@ -0,0 +1,32 @@
+// Package cli - Sudo password handling
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/transfer"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// SudoPassword returns the source of the remote sudo password: the
+// environment variable named by --sudo-password-env if set, or a prompt on
+// the terminal otherwise
+func SudoPassword(profile *config.Profile) transfer.SudoPasswordFunc {
+	return func() (string, error) {
+		if SudoPasswordEnv != "" {
+			password, ok := os.LookupEnv(SudoPasswordEnv)
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", SudoPasswordEnv)
+			}
+			return password, nil
+		}
+
+		if !ui.IsInteractive() {
+			return "", fmt.Errorf("there is no terminal to ask for the sudo password (use --sudo-password-env)")
+		}
+		return ui.PromptPassword(fmt.Sprintf("[sudo] password for %s@%s", profile.RemoteUser, profile.RemoteHost))
+	}
+}
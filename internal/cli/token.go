@@ -0,0 +1,15 @@
+// Package cli - Hardware token PIN
+// Copyright (c) 2025 orpheus497
+package cli
+
+import "github.com/orpheus497/klip/internal/ui"
+
+// TokenPIN returns the prompt for a hardware token's PIN when the
+// ssh-agent loads a profile's PKCS#11 provider, or nil if there is no
+// terminal to ask
+func TokenPIN() func(prompt string) (string, error) {
+	if !ui.IsInteractive() {
+		return nil
+	}
+	return ui.PromptPassword
+}
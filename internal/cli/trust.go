@@ -0,0 +1,69 @@
+// Package cli - Trust domains
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+// TrustDomain returns the known_hosts file and key directory of the
+// profile's trust domain; both are empty for profiles outside one, which
+// use klip's known_hosts and ~/.ssh
+func TrustDomain(cfg *config.Config, profile *config.Profile) (knownHosts, keyDir string, err error) {
+	if profile.TrustDomain == "" {
+		return "", "", nil
+	}
+	if _, ok := cfg.Settings.TrustDomains[profile.TrustDomain]; !ok {
+		return "", "", fmt.Errorf("profile '%s' uses undefined trust domain '%s'", profile.Name, profile.TrustDomain)
+	}
+
+	if knownHosts, err = KnownHostsPath(cfg, profile.TrustDomain); err != nil {
+		return "", "", err
+	}
+	return knownHosts, expandHome(cfg.Settings.TrustDomains[profile.TrustDomain].KeyDir), nil
+}
+
+// KnownHostsPath returns the known_hosts file of a trust domain, or klip's
+// shared known_hosts for ""
+func KnownHostsPath(cfg *config.Config, domain string) (string, error) {
+	if domain == "" {
+		return ssh.GetKnownHostsPath("")
+	}
+	trust, ok := cfg.Settings.TrustDomains[domain]
+	if !ok {
+		return "", fmt.Errorf("trust domain '%s' is not defined in settings.trust_domains", domain)
+	}
+	if knownHosts := expandHome(trust.KnownHosts); knownHosts != "" {
+		return knownHosts, nil
+	}
+	return ssh.GetKnownHostsPath(domain)
+}
+
+// expandHome expands a leading ~/ to the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[2:])
+		}
+	}
+	return path
+}
+
+// PrintHostKeyWarnings prints the host key warnings of a connection and
+// the jump hosts it went through, e.g. keys older than
+// settings.host_key_max_age_days
+func PrintHostKeyWarnings(info ssh.ConnectionInfo) {
+	for _, jump := range info.Jumps {
+		PrintHostKeyWarnings(jump)
+	}
+	for _, warning := range info.HostKeyWarnings {
+		ui.PrintWarning("%s", warning)
+	}
+}
@@ -0,0 +1,129 @@
+// Package cli - Waiting for hosts to come up
+// Copyright (c) 2025 orpheus497
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/ui"
+)
+
+const (
+	// DefaultWaitFor is how long --wait waits for a host by default
+	DefaultWaitFor = 5 * time.Minute
+
+	// WaitInterval is the delay between reachability checks
+	WaitInterval = 5 * time.Second
+
+	// downInterval is the delay between checks while waiting for a host to
+	// go down, shorter since a reboot can be quick
+	downInterval = time.Second
+)
+
+// WaitForHost polls backend resolution and SSH reachability until the host
+// answers or waitFor elapses, showing a spinner meanwhile. Returns the
+// resolved address.
+func WaitForHost(ctx context.Context, b backend.Backend, host string, port int, waitFor time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, waitFor)
+	defer cancel()
+
+	spinner := ui.NewSpinner(fmt.Sprintf(ui.T("Waiting for %s to come up…"), host))
+	spinner.Start()
+	defer spinner.Stop()
+
+	var lastErr error
+	for {
+		addr, err := checkHost(ctx, b, host, port)
+		if err == nil {
+			return addr, nil
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("host %s did not come up within %s: %w", host, waitFor, lastErr)
+		case <-time.After(WaitInterval):
+		}
+	}
+}
+
+// checkHost resolves host through the backend and checks that its SSH
+// server answers
+func checkHost(ctx context.Context, b backend.Backend, host string, port int) (string, error) {
+	addr := host
+	if b.Name() != "lan" {
+		ip, err := b.GetPeerIP(ctx, host)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve via %s: %w", b.Name(), err)
+		}
+		addr = ip
+
+		if peerOffline(ctx, b, host, addr) {
+			return "", fmt.Errorf("peer %s is offline in %s", host, b.Name())
+		}
+	}
+
+	if err := ssh.CheckBanner(ctx, addr, port); err != nil {
+		return "", err
+	}
+
+	return addr, nil
+}
+
+// peerOffline reports whether the backend lists the peer as offline
+// Peers missing from the status are not considered offline
+func peerOffline(ctx context.Context, b backend.Backend, host, addr string) bool {
+	status, err := b.GetStatus(ctx)
+	if err != nil {
+		return false
+	}
+
+	for _, peer := range status.Peers {
+		if peer.IP == addr || strings.EqualFold(peer.Hostname, host) {
+			return !peer.Online
+		}
+	}
+
+	return false
+}
+
+// WaitForHostDown polls like WaitForHost until the host stops answering
+// or waitFor elapses
+func WaitForHostDown(ctx context.Context, b backend.Backend, host string, port int, waitFor time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, waitFor)
+	defer cancel()
+
+	spinner := ui.NewSpinner(fmt.Sprintf(ui.T("Waiting for %s to go down…"), host))
+	spinner.Start()
+	defer spinner.Stop()
+
+	for {
+		if _, err := checkHost(ctx, b, host, port); err != nil && ctx.Err() == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("host %s did not go down within %s", host, waitFor)
+		case <-time.After(downInterval):
+		}
+	}
+}
+
+// WaitForHost waits until the profile's host, or its jump host if it has
+// one, is reachable through the selected backend
+func (h *ConnectionHelper) WaitForHost(ctx context.Context, waitFor time.Duration) error {
+	host, port := h.Profile.FirstHop()
+	addr, err := WaitForHost(ctx, h.Backend, host, port, waitFor)
+	if err != nil {
+		return err
+	}
+
+	h.Log.Debug("Host is up", "host", host, "address", addr)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Package clitest - VPN backend fixtures
+// Copyright (c) 2025 orpheus497
+package clitest
+
+import (
+	"context"
+
+	"github.com/orpheus497/klip/internal/backend"
+)
+
+// Backend is a VPN backend fixture with a fixed status
+type Backend struct {
+	// Status is reported by GetStatus; Status.Backend names the backend
+	Status backend.Status
+
+	// Installed makes the backend available
+	Installed bool
+
+	// Peers maps hostnames to the addresses GetPeerIP resolves them to
+	Peers map[string]string
+
+	// Prio is the auto-detection priority
+	Prio int
+}
+
+// Name returns the backend name
+func (b *Backend) Name() string {
+	return b.Status.Backend
+}
+
+// IsAvailable reports whether the fixture is installed
+func (b *Backend) IsAvailable(ctx context.Context) bool {
+	return b.Installed
+}
+
+// IsConnected reports the fixture's connection status
+func (b *Backend) IsConnected(ctx context.Context) bool {
+	return b.Installed && b.Status.Connected
+}
+
+// GetStatus returns a copy of the fixture's status
+func (b *Backend) GetStatus(ctx context.Context) (*backend.Status, error) {
+	if !b.Installed {
+		return nil, backend.ErrNotAvailable
+	}
+	status := b.Status
+	return &status, nil
+}
+
+// GetPeerIP resolves a hostname from Peers
+func (b *Backend) GetPeerIP(ctx context.Context, hostname string) (string, error) {
+	if ip, ok := b.Peers[hostname]; ok && b.IsConnected(ctx) {
+		return ip, nil
+	}
+	return "", backend.ErrPeerNotFound
+}
+
+// Priority returns the auto-detection priority
+func (b *Backend) Priority() int {
+	return b.Prio
+}
+
+// Registry returns a registry of every supported backend in which the
+// given fixtures replace the real backends of the same name, and all
+// others are fixtures that are not installed
+func Registry(fixtures ...*Backend) func() *backend.Registry {
+	return func() *backend.Registry {
+		registry := backend.NewRegistry()
+		for _, real := range registry.List() {
+			registry.Register(&Backend{Status: backend.Status{Backend: real.Name()}, Prio: real.Priority()})
+		}
+		for _, fixture := range fixtures {
+			registry.Register(fixture)
+		}
+		return registry
+	}
+}
@@ -0,0 +1,198 @@
+// Package clitest runs klip's commands in tests against fixtures and
+// compares their output with golden files
+// Copyright (c) 2025 orpheus497
+package clitest
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/fatih/color"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// update rewrites golden files instead of comparing with them:
+// go test ./cmd/... -update
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// TempDirToken replaces the environment's directory in captured output,
+// so golden files do not depend on where tests run
+const TempDirToken = "$TMP"
+
+// secondsPattern matches the elapsed time of JSON results, which differs
+// on every run and is replaced by 0 in captured output
+var secondsPattern = regexp.MustCompile(`"seconds": [0-9.e+-]+`)
+
+// Env is an isolated environment for running commands: home, XDG
+// directories and PATH point into a temporary directory, colors are off,
+// messages are English and times are shown in UTC
+type Env struct {
+	t *testing.T
+
+	// Dir is the temporary directory holding the environment
+	Dir string
+}
+
+// NewEnv isolates the test from the user's configuration and state. Tests
+// using it must not run in parallel, as it changes process-wide settings.
+func NewEnv(t *testing.T) *Env {
+	t.Helper()
+	dir := t.TempDir()
+
+	for env, sub := range map[string]string{
+		"HOME":            "home",
+		"XDG_CONFIG_HOME": "config",
+		"XDG_STATE_HOME":  "state",
+		"XDG_CACHE_HOME":  "cache",
+		"XDG_DATA_HOME":   "data",
+		"XDG_RUNTIME_DIR": "run",
+		"PATH":            "bin", // no VPN clients, ssh or rsync unless a test adds them
+	} {
+		path := filepath.Join(dir, sub)
+		if err := os.MkdirAll(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(env, path)
+	}
+	t.Setenv("LANG", "C")
+	t.Setenv("LC_ALL", "C")
+	t.Setenv("KLIP_LOCALE", "")
+	t.Setenv("NO_COLOR", "1")
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+
+	noColor, local, storeURL := color.NoColor, time.Local, config.StoreURL
+	color.NoColor, time.Local, config.StoreURL = true, time.UTC, ""
+	t.Cleanup(func() {
+		color.NoColor, time.Local, config.StoreURL = noColor, local, storeURL
+	})
+
+	return &Env{t: t, Dir: dir}
+}
+
+// WriteFile writes a fixture file below the environment's directory and
+// returns its path
+func (e *Env) WriteFile(name, content string) string {
+	e.t.Helper()
+	path := filepath.Join(e.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		e.t.Fatal(err)
+	}
+	return path
+}
+
+// WriteConfig writes klip's configuration file
+func (e *Env) WriteConfig(content string) string {
+	e.t.Helper()
+	rel, err := filepath.Rel(e.Dir, filepath.Join(xdg.ConfigHome, config.AppName, config.ConfigFileName))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return e.WriteFile(rel, content)
+}
+
+// StatePath returns the path of name in klip's state directory
+func (e *Env) StatePath(name string) string {
+	return filepath.Join(xdg.StateHome, config.AppName, name)
+}
+
+// Result is the output of a command
+type Result struct {
+	Stdout string
+	Stderr string
+	Err    error
+}
+
+// Run executes cmd with args, capturing what it writes to stdout and
+// stderr with run-specific parts normalized. cmd must be newly built, as cobra commands keep parsed flags.
+// Commands that call os.Exit cannot be run.
+func (e *Env) Run(cmd *cobra.Command, args ...string) Result {
+	e.t.Helper()
+	cmd.SetArgs(args)
+
+	var result Result
+	stdout, stderr := capture(e.t, func() {
+		result.Err = cmd.Execute()
+	})
+	result.Stdout = normalize(stdout, e.Dir)
+	result.Stderr = normalize(stderr, e.Dir)
+	return result
+}
+
+// normalize replaces the parts of captured output that differ between
+// runs: the environment's directory and elapsed times
+func normalize(output, dir string) string {
+	output = strings.ReplaceAll(output, dir, TempDirToken)
+	return secondsPattern.ReplaceAllString(output, `"seconds": 0`)
+}
+
+// capture runs fn with os.Stdout and os.Stderr redirected into pipes
+func capture(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outBuf, errBuf bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); io.Copy(&outBuf, outR) }()
+	go func() { defer wg.Done(); io.Copy(&errBuf, errR) }()
+
+	os.Stdout, os.Stderr = outW, errW
+	defer func() {
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		outW.Close()
+		errW.Close()
+		wg.Wait()
+		outR.Close()
+		errR.Close()
+		stdout, stderr = outBuf.String(), errBuf.String()
+	}()
+	fn()
+	return
+}
+
+// Golden compares got with testdata/<name>.golden, or writes it there when
+// the tests run with -update
+func Golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	if string(want) != got {
+		t.Errorf("output differs from %s (run the tests with -update to accept it)\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
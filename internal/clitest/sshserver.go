@@ -0,0 +1,204 @@
+// Package clitest - SSH server fixture
+// Copyright (c) 2025 orpheus497
+package clitest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ExecHandler runs a command sent in an exec request and returns its exit
+// status
+type ExecHandler func(command string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// SSHServer is an SSH server on the loopback interface serving the local
+// file system over SFTP. It accepts only the key at KeyPath and refuses
+// exec requests unless started with an ExecHandler, so by default klip
+// finds no POSIX shell and no rsync. It relays direct-tcpip channels, so
+// it can be its own jump host.
+type SSHServer struct {
+	// Host and Port are where the server listens
+	Host string
+	Port int
+
+	// KeyPath is the private key the server accepts, without passphrase
+	KeyPath string
+
+	listener net.Listener
+	exec     ExecHandler
+}
+
+// StartSSHServer starts an SSH server for the test, writes the key it
+// accepts below the environment's directory and records its host key in
+// klip's known_hosts, so commands connect without prompting
+func (e *Env) StartSSHServer() *SSHServer {
+	e.t.Helper()
+	return e.StartExecSSHServer(nil)
+}
+
+// StartExecSSHServer is StartSSHServer with exec requests served by exec
+func (e *Env) StartExecSSHServer(exec ExecHandler) *SSHServer {
+	e.t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	hostKey, err := gossh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	authorized, err := gossh.NewPublicKey(clientPub)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	keyPath := e.WriteFile(filepath.Join("keys", "id_ed25519"), string(pem.EncodeToMemory(block)))
+
+	config := &gossh.ServerConfig{
+		PublicKeyCallback: func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, os.ErrPermission
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	e.t.Cleanup(func() { listener.Close() })
+
+	s := &SSHServer{
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		KeyPath:  keyPath,
+		listener: listener,
+		exec:     exec,
+	}
+	knownHosts := filepath.Join(xdg.ConfigHome, "klip", "known_hosts")
+	if err := os.MkdirAll(filepath.Dir(knownHosts), 0700); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := ssh.AddKnownHost(knownHosts, net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), hostKey.PublicKey()); err != nil {
+		e.t.Fatal(err)
+	}
+
+	go s.serve(config)
+	return s
+}
+
+// serve accepts connections until the listener is closed
+func (s *SSHServer) serve(config *gossh.ServerConfig) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, channels, requests, err := gossh.NewServerConn(conn, config)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			go gossh.DiscardRequests(requests)
+			for newChannel := range channels {
+				if newChannel.ChannelType() == "direct-tcpip" {
+					go relay(newChannel)
+					continue
+				}
+				if newChannel.ChannelType() != "session" {
+					newChannel.Reject(gossh.UnknownChannelType, "only sessions and direct-tcpip are served")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go s.serveSession(channel, requests)
+			}
+		}()
+	}
+}
+
+// relay connects a direct-tcpip channel to the address it asks for
+func relay(newChannel gossh.NewChannel) {
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := gossh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go gossh.DiscardRequests(requests)
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+// serveSession serves the SFTP subsystem and, with an ExecHandler, exec
+// requests on a session and refuses everything else
+func (s *SSHServer) serveSession(channel gossh.Channel, requests <-chan *gossh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		var exec struct{ Command string }
+		if req.Type == "exec" && s.exec != nil && gossh.Unmarshal(req.Payload, &exec) == nil {
+			req.Reply(true, nil)
+			go gossh.DiscardRequests(requests)
+			status := s.exec(exec.Command, channel, channel, channel.Stderr())
+			channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			return
+		}
+		if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" ||
+			binary.BigEndian.Uint32(req.Payload) != uint32(len(req.Payload)-4) {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		server.Serve()
+		server.Close()
+		return
+	}
+}
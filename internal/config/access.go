@@ -0,0 +1,136 @@
+// Package config - Role-based access rules for profiles
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operations that access rules restrict, one per kind of command
+const (
+	OpConnect  = "connect"  // interactive shell (klip <profile>)
+	OpExec     = "exec"     // klip exec
+	OpPush     = "push"     // klipc
+	OpPull     = "pull"     // klipr
+	OpSync     = "sync"     // klip sync
+	OpRead     = "read"     // klip cat, klip diff-file, klip key list-remote
+	OpEdit     = "edit"     // klip edit
+	OpChecksum = "checksum" // klip checksum
+	OpForward  = "forward"  // klip forward
+	OpReboot   = "reboot"   // klip reboot
+	OpKey      = "key"      // klip key deploy and revoke
+	OpMux      = "mux"      // klip mux
+
+	// opAll matches every operation in an access rule
+	opAll = "*"
+)
+
+// Operations lists every operation, in the order documented
+var Operations = []string{OpConnect, OpExec, OpPush, OpPull, OpSync, OpRead, OpEdit, OpChecksum, OpForward, OpReboot, OpKey, OpMux}
+
+// readOnlyOperations cannot change the remote host. mux is not one of them:
+// its socket hands the authenticated connection, shell included, to any
+// local process.
+var readOnlyOperations = map[string]bool{OpPull: true, OpRead: true, OpChecksum: true}
+
+// Access is what an access rule lets a role do with an operation
+type Access int
+
+const (
+	// AccessAllowed runs the operation
+	AccessAllowed Access = iota
+
+	// AccessConfirm asks before running the operation
+	AccessConfirm
+
+	// AccessDenied refuses to run the operation
+	AccessDenied
+)
+
+// AccessRule restricts operations on a profile for some local roles,
+// typically published in a team bundle. A profile's rules are tried in
+// order and the first whose roles match decides.
+type AccessRule struct {
+	// Roles the rule applies to; empty applies to every role
+	Roles []string `yaml:"roles,omitempty"`
+
+	// Confirm lists operations that must be confirmed ("*" for all)
+	Confirm []string `yaml:"confirm,omitempty"`
+
+	// Deny lists operations that are disabled ("*" for all)
+	Deny []string `yaml:"deny,omitempty"`
+
+	// ReadOnly disables every operation that can change the remote host,
+	// leaving pull, read and checksum
+	ReadOnly bool `yaml:"read_only,omitempty"`
+}
+
+// matches reports whether the rule applies to a user with roles
+func (r *AccessRule) matches(roles []string) bool {
+	if len(r.Roles) == 0 {
+		return true
+	}
+	for _, want := range r.Roles {
+		for _, role := range roles {
+			if want == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// access returns what the rule lets its roles do with op
+func (r *AccessRule) access(op string) Access {
+	if (r.ReadOnly && !readOnlyOperations[op]) || listsOperation(r.Deny, op) {
+		return AccessDenied
+	}
+	if listsOperation(r.Confirm, op) {
+		return AccessConfirm
+	}
+	return AccessAllowed
+}
+
+// listsOperation reports whether ops names op or every operation
+func listsOperation(ops []string, op string) bool {
+	for _, name := range ops {
+		if name == op || name == opAll {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessFor returns what a user with roles may do with op on the profile,
+// decided by the first access rule matching the roles. Profiles without a
+// matching rule allow everything.
+func (p *Profile) AccessFor(roles []string, op string) Access {
+	for i := range p.Access {
+		if p.Access[i].matches(roles) {
+			return p.Access[i].access(op)
+		}
+	}
+	return AccessAllowed
+}
+
+// validateAccess checks that access rules name known operations
+func validateAccess(rules []AccessRule) error {
+	known := map[string]bool{opAll: true}
+	for _, op := range Operations {
+		known[op] = true
+	}
+	for i, rule := range rules {
+		for _, op := range append(append([]string(nil), rule.Confirm...), rule.Deny...) {
+			if !known[op] {
+				return fmt.Errorf("access rule %d: unknown operation '%s', must be one of: %s or *", i+1, op, strings.Join(Operations, ", "))
+			}
+		}
+		for _, role := range rule.Roles {
+			if strings.TrimSpace(role) == "" {
+				return fmt.Errorf("access rule %d: empty role", i+1)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProfileAccessFor(t *testing.T) {
+	profile := NewProfile("prod", "deploy", "prod.internal")
+	profile.Access = []AccessRule{
+		{Roles: []string{"sre"}, Confirm: []string{OpExec, OpConnect}},
+		{Roles: []string{"oncall"}, Deny: []string{OpReboot}, Confirm: []string{"*"}},
+		{ReadOnly: true},
+	}
+
+	tests := []struct {
+		roles []string
+		op    string
+		want  Access
+	}{
+		{[]string{"sre"}, OpExec, AccessConfirm},
+		{[]string{"sre"}, OpPush, AccessAllowed},
+		{[]string{"dev", "sre"}, OpConnect, AccessConfirm},
+		{[]string{"oncall"}, OpReboot, AccessDenied},
+		{[]string{"oncall"}, OpPull, AccessConfirm},
+		{[]string{"dev"}, OpPush, AccessDenied},
+		{[]string{"dev"}, OpConnect, AccessDenied},
+		{[]string{"dev"}, OpPull, AccessAllowed},
+		{nil, OpRead, AccessAllowed},
+		{nil, OpSync, AccessDenied},
+		{nil, OpMux, AccessDenied},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, profile.AccessFor(tt.roles, tt.op), "%v %s", tt.roles, tt.op)
+	}
+
+	// Without rules, or without a matching one, everything is allowed
+	assert.Equal(t, AccessAllowed, NewProfile("dev", "me", "dev").AccessFor(nil, OpReboot))
+	profile.Access = profile.Access[:1]
+	assert.Equal(t, AccessAllowed, profile.AccessFor([]string{"dev"}, OpReboot))
+}
+
+func TestProfileAccessValidation(t *testing.T) {
+	var profile Profile
+	require.NoError(t, yaml.Unmarshal([]byte(`
+remote_user: deploy
+remote_host: prod.internal
+ssh_port: 22
+backend: auto
+access:
+  - roles: [sre]
+    confirm: [exec]
+  - read_only: true
+`), &profile))
+	require.NoError(t, profile.Validate())
+	require.Len(t, profile.Access, 2)
+	assert.True(t, profile.Access[1].ReadOnly)
+
+	clone := profile.Clone()
+	clone.Access[0].ReadOnly = true
+	assert.False(t, profile.Access[0].ReadOnly)
+
+	profile.Access = []AccessRule{{Deny: []string{"shell"}}}
+	assert.ErrorContains(t, profile.Validate(), "unknown operation 'shell'")
+
+	profile.Access = []AccessRule{{Roles: []string{" "}, Deny: []string{OpExec}}}
+	assert.ErrorContains(t, profile.Validate(), "empty role")
+}
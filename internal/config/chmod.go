@@ -0,0 +1,196 @@
+// Package config - Permission mode overrides
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// Chmod is a list of permission changes in rsync --chmod syntax, such as
+// "D755,F644" or "Du=rwx,go=rx,Fgo-w", applied in order
+type Chmod []chmodRule
+
+// chmodRule is one comma-separated item of a Chmod spec
+type chmodRule struct {
+	// target is 'D' for directories only, 'F' for files only, or 0
+	target byte
+
+	// octal is the mode an octal rule sets; -1 for symbolic rules
+	octal int64
+
+	// who is the u/g/o/a selection of a symbolic rule; empty means all
+	who string
+
+	// clauses are the operator and permissions pairs, e.g. "+x", "=rw"
+	clauses []string
+}
+
+// ParseChmod parses a spec in rsync --chmod syntax: comma-separated octal
+// modes or chmod-style symbolic modes, each optionally prefixed with D or F
+// to apply only to directories or files
+func ParseChmod(spec string) (Chmod, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("invalid chmod %q: empty", spec)
+	}
+
+	var chmod Chmod
+	for _, item := range strings.Split(spec, ",") {
+		rule, err := parseChmodRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chmod %q: %w", spec, err)
+		}
+		chmod = append(chmod, rule)
+	}
+	return chmod, nil
+}
+
+func parseChmodRule(item string) (chmodRule, error) {
+	rule := chmodRule{octal: -1}
+	rest := item
+	if rest != "" && (rest[0] == 'D' || rest[0] == 'F') {
+		rule.target = rest[0]
+		rest = rest[1:]
+	}
+
+	if rest != "" && rest[0] >= '0' && rest[0] <= '7' {
+		if len(rest) > 4 {
+			return rule, fmt.Errorf("%q: octal mode too long", item)
+		}
+		value, err := strconv.ParseInt(rest, 8, 32)
+		if err != nil {
+			return rule, fmt.Errorf("%q: not an octal mode", item)
+		}
+		rule.octal = value
+		return rule, nil
+	}
+
+	who := strings.IndexAny(rest, "+-=")
+	if who < 0 {
+		return rule, fmt.Errorf("%q: expected an octal mode or [ugoa][+-=][rwxXst]", item)
+	}
+	rule.who = rest[:who]
+	if strings.Trim(rule.who, "ugoa") != "" {
+		return rule, fmt.Errorf("%q: unknown user class in %q", item, rule.who)
+	}
+
+	rest = rest[who:]
+	for rest != "" {
+		end := strings.IndexAny(rest[1:], "+-=")
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end++
+		}
+		clause := rest[:end]
+		if strings.Trim(clause[1:], "rwxXst") != "" {
+			return rule, fmt.Errorf("%q: unknown permission in %q", item, clause[1:])
+		}
+		rule.clauses = append(rule.clauses, clause)
+		rest = rest[end:]
+	}
+	return rule, nil
+}
+
+// Apply returns mode with the changes applied, for a directory if dir is
+// set and a file otherwise. Only permission, setuid, setgid and sticky
+// bits are changed.
+func (c Chmod) Apply(mode fs.FileMode, dir bool) fs.FileMode {
+	bits := UnixMode(mode)
+	for _, rule := range c {
+		if (rule.target == 'D' && !dir) || (rule.target == 'F' && dir) {
+			continue
+		}
+		if rule.octal >= 0 {
+			bits = uint32(rule.octal)
+			continue
+		}
+		bits = rule.applySymbolic(bits, dir)
+	}
+	return mode&^(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky) | ModeFromUnix(bits)
+}
+
+// applySymbolic applies a symbolic rule to unix mode bits
+func (r chmodRule) applySymbolic(bits uint32, dir bool) uint32 {
+	var mask uint32
+	who := r.who
+	if who == "" || strings.Contains(who, "a") {
+		who = "ugo"
+	}
+	for _, class := range who {
+		switch class {
+		case 'u':
+			mask |= 04700
+		case 'g':
+			mask |= 02070
+		case 'o':
+			mask |= 01007
+		}
+	}
+
+	for _, clause := range r.clauses {
+		var perms uint32
+		for _, perm := range clause[1:] {
+			switch perm {
+			case 'r':
+				perms |= 0444
+			case 'w':
+				perms |= 0222
+			case 'x':
+				perms |= 0111
+			case 'X':
+				if dir || bits&0111 != 0 {
+					perms |= 0111
+				}
+			case 's':
+				perms |= 06000
+			case 't':
+				perms |= 01000
+			}
+		}
+		perms &= mask
+
+		switch clause[0] {
+		case '+':
+			bits |= perms
+		case '-':
+			bits &^= perms
+		case '=':
+			bits = bits&^mask | perms
+		}
+	}
+	return bits
+}
+
+// UnixMode converts the permission and special bits of mode to their unix
+// representation
+func UnixMode(mode fs.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// ModeFromUnix converts unix permission and special bits to an fs.FileMode
+func ModeFromUnix(bits uint32) fs.FileMode {
+	mode := fs.FileMode(bits) & fs.ModePerm
+	if bits&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
@@ -4,9 +4,13 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/logger"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,6 +21,9 @@ const (
 	// ConfigFileName is the name of the configuration file
 	ConfigFileName = "config.yaml"
 
+	// MessagesDirName is the directory holding message catalogs
+	MessagesDirName = "messages"
+
 	// LegacyConfigDir is the old LINK config directory for migration
 	LegacyConfigDir = ".LINK"
 )
@@ -34,6 +41,19 @@ type Config struct {
 
 	// configPath stores the path where config was loaded from
 	configPath string
+
+	// store is the remote store profiles were also loaded from, if any,
+	// and storeErr why it could not be reached if an older copy is in use
+	store    Store
+	storeErr error
+
+	// storeCache is the local copy of the store's configuration and
+	// storeDoc that configuration as loaded. storeProfiles are the names
+	// of the profiles taken from it, which are saved to the store rather
+	// than configPath.
+	storeCache    string
+	storeDoc      *storeDocument
+	storeProfiles map[string]bool
 }
 
 // Settings contains global application settings
@@ -41,13 +61,13 @@ type Settings struct {
 	// Verbose enables verbose logging output
 	Verbose bool `yaml:"verbose"`
 
-	// DefaultBackend specifies the preferred VPN backend (auto, lan, tailscale, headscale, netbird)
+	// DefaultBackend specifies the preferred VPN backend (auto, lan, tailscale, headscale, netbird, zerotier, wireguard)
 	DefaultBackend string `yaml:"default_backend"`
 
 	// SSHTimeout is the SSH connection timeout in seconds
 	SSHTimeout int `yaml:"ssh_timeout"`
 
-	// TransferMethod specifies the preferred transfer method (rsync, sftp)
+	// TransferMethod specifies the preferred transfer method (rsync, sftp, delta, scp)
 	TransferMethod string `yaml:"transfer_method"`
 
 	// CompressionLevel specifies the rsync compression level (0-9, 0=disabled)
@@ -55,6 +75,141 @@ type Settings struct {
 
 	// ShowProgress enables progress bars for transfers
 	ShowProgress bool `yaml:"show_progress"`
+
+	// Theme selects the output color theme (default, high-contrast, monochrome)
+	Theme string `yaml:"theme,omitempty"`
+
+	// Locale selects the message catalog (e.g., en, de_DE); empty uses the environment
+	Locale string `yaml:"locale,omitempty"`
+
+	// TrustDomains are separate sets of trusted host keys and SSH keys,
+	// e.g. work and personal, selected by a profile's trust_domain
+	TrustDomains map[string]TrustDomain `yaml:"trust_domains,omitempty"`
+
+	// DefaultKeys are the key files tried, in order, for profiles without
+	// ssh_key_path: names in ~/.ssh or the trust domain's key_dir, or
+	// absolute paths (empty for id_ed25519, id_ecdsa and id_rsa)
+	DefaultKeys []string `yaml:"default_keys,omitempty"`
+
+	// StrictHostKeys rejects hosts missing from known_hosts instead of
+	// asking to trust their key on first use
+	StrictHostKeys bool `yaml:"strict_host_keys,omitempty"`
+
+	// HostCAKeys are SSH CA public keys (or .pub files) trusted to sign
+	// host certificates, so hosts with a valid certificate need no
+	// known_hosts entry
+	HostCAKeys []string `yaml:"host_ca_keys,omitempty"`
+
+	// HostKeyMaxAgeDays warns when connecting to a host whose key klip
+	// first trusted more than this many days ago (0 to never warn)
+	HostKeyMaxAgeDays int `yaml:"host_key_max_age_days,omitempty"`
+
+	// HostKeyMaxIdleDays warns when connecting to a host last contacted
+	// more than this many days ago (0 to never warn)
+	HostKeyMaxIdleDays int `yaml:"host_key_max_idle_days,omitempty"`
+
+	// Teams are the signed profile bundles pulled with klip team pull,
+	// by team name
+	Teams map[string]Team `yaml:"teams,omitempty"`
+
+	// Roles are the local user's roles, matched against the access rules
+	// of profiles shared in team bundles
+	Roles []string `yaml:"roles,omitempty"`
+
+	// Audit controls rotation and retention of the audit log
+	Audit AuditSettings `yaml:"audit"`
+
+	// Tracing exports the phases of connections and transfers to an
+	// OpenTelemetry collector
+	Tracing TracingSettings `yaml:"tracing,omitempty"`
+
+	// Metrics serves Prometheus metrics from klip mux
+	Metrics MetricsSettings `yaml:"metrics,omitempty"`
+
+	// Locations are the networks profiles can override values for,
+	// checked in order when connecting
+	Locations []Location `yaml:"locations,omitempty"`
+}
+
+// MetricsSettings configures the Prometheus metrics served by klip mux
+type MetricsSettings struct {
+	// Listen is the host:port scrapes of /metrics are answered on, e.g.
+	// 127.0.0.1:9464 (empty serves no metrics)
+	Listen string `yaml:"listen,omitempty"`
+}
+
+// TracingSettings configures the OTLP collector traces are sent to. The
+// OTEL_EXPORTER_OTLP_* environment variables take precedence.
+type TracingSettings struct {
+	// Endpoint is the collector's OTLP/HTTP base URL, e.g.
+	// http://localhost:4318; traces are posted to /v1/traces below it
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Headers are sent with every export, e.g. an API key
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// AuditSettings controls when the audit log is rotated into compressed
+// archives and how long archives are kept. Zero disables a rule.
+type AuditSettings struct {
+	// MaxSize rotates the log once it reaches this size (e.g., 10M)
+	MaxSize string `yaml:"max_size"`
+
+	// RotateDays rotates the log once its first event is this many days old
+	RotateDays int `yaml:"rotate_days"`
+
+	// RetentionDays deletes archives rotated more than this many days ago
+	RetentionDays int `yaml:"retention_days"`
+
+	// Sinks also ship every audit event to syslog, journald or a TCP/UDP
+	// JSON collector
+	Sinks []AuditSink `yaml:"sinks,omitempty"`
+}
+
+// AuditSink is a destination audit events are shipped to besides the
+// audit log
+type AuditSink struct {
+	// Type is syslog, journald, tcp or udp
+	Type string `yaml:"type"`
+
+	// Address is host:port for tcp and udp; for syslog empty for the local
+	// daemon or udp://, tcp:// or unix:// and the address; for journald
+	// the journal socket, empty for the default
+	Address string `yaml:"address,omitempty"`
+
+	// Facility is the syslog facility (default auth)
+	Facility string `yaml:"facility,omitempty"`
+
+	// Tag is the syslog tag and journal identifier (default klip)
+	Tag string `yaml:"tag,omitempty"`
+}
+
+// SinkConfig returns the audit logger's configuration of the sink, which
+// also validates it
+func (s AuditSink) SinkConfig() logger.SinkConfig {
+	return logger.SinkConfig{Type: s.Type, Address: s.Address, Facility: s.Facility, Tag: s.Tag}
+}
+
+// HostKeyMaxAge returns HostKeyMaxAgeDays as a duration
+func (s *Settings) HostKeyMaxAge() time.Duration {
+	return time.Duration(s.HostKeyMaxAgeDays) * 24 * time.Hour
+}
+
+// HostKeyMaxIdle returns HostKeyMaxIdleDays as a duration
+func (s *Settings) HostKeyMaxIdle() time.Duration {
+	return time.Duration(s.HostKeyMaxIdleDays) * 24 * time.Hour
+}
+
+// TrustDomain is a known_hosts file and key directory shared by the
+// profiles in it and isolated from every other profile
+type TrustDomain struct {
+	// KnownHosts is the known_hosts file (empty uses
+	// $XDG_CONFIG_HOME/klip/known_hosts.d/<domain>)
+	KnownHosts string `yaml:"known_hosts,omitempty"`
+
+	// KeyDir is searched for default keys instead of ~/.ssh when a profile
+	// has no ssh_key_path (empty keeps ~/.ssh)
+	KeyDir string `yaml:"key_dir,omitempty"`
 }
 
 // DefaultSettings returns settings with sensible defaults
@@ -66,6 +221,11 @@ func DefaultSettings() Settings {
 		TransferMethod:   "rsync",
 		CompressionLevel: 6,
 		ShowProgress:     true,
+		Audit: AuditSettings{
+			MaxSize:       "10M",
+			RotateDays:    30,
+			RetentionDays: 365,
+		},
 	}
 }
 
@@ -86,6 +246,11 @@ func ConfigPath() (string, error) {
 	return filepath.Join(configDir, ConfigFileName), nil
 }
 
+// MessagesDir returns the directory holding per-locale message catalogs
+func MessagesDir() string {
+	return filepath.Join(xdg.ConfigHome, AppName, MessagesDirName)
+}
+
 // LegacyConfigPath returns the path to the old LINK configuration
 func LegacyConfigPath() string {
 	homeDir, err := os.UserHomeDir()
@@ -95,8 +260,22 @@ func LegacyConfigPath() string {
 	return filepath.Join(homeDir, LegacyConfigDir, "config.sh")
 }
 
-// Load reads the configuration from disk
+// Load reads the configuration from disk, adding the profiles of the remote
+// store named by StoreURL if set
 func Load() (*Config, error) {
+	cfg, err := loadFile()
+	if err != nil || StoreURL == "" {
+		return cfg, err
+	}
+	if err := cfg.loadFromStore(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile reads the local configuration file, migrating a legacy
+// configuration if there is none yet
+func loadFile() (*Config, error) {
 	configPath, err := ConfigPath()
 	if err != nil {
 		return nil, err
@@ -137,8 +316,17 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
-// Save writes the configuration to disk
+// Save writes the configuration to disk, and changes to the profiles of
+// its remote store back to the store
 func (c *Config) Save() error {
+	local := c
+	if c.store != nil {
+		if err := c.saveToStore(); err != nil {
+			return err
+		}
+		local = c.withoutStoreProfiles()
+	}
+
 	if c.configPath == "" {
 		path, err := ConfigPath()
 		if err != nil {
@@ -147,7 +335,7 @@ func (c *Config) Save() error {
 		c.configPath = path
 	}
 
-	data, err := yaml.Marshal(c)
+	data, err := yaml.Marshal(local)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -230,11 +418,57 @@ func (c *Config) SetCurrentProfile(name string) error {
 	return nil
 }
 
-// ListProfiles returns all profile names
+// ListProfiles returns all profile names, sorted
 func (c *Config) ListProfiles() []string {
 	names := make([]string, 0, len(c.Profiles))
 	for name := range c.Profiles {
 		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfilesInTrustDomain returns the names of the profiles in a trust
+// domain, sorted
+func (c *Config) ProfilesInTrustDomain(domain string) []string {
+	var names []string
+	for name, profile := range c.Profiles {
+		if profile != nil && profile.TrustDomain == domain {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
 	return names
 }
+
+// MatchProfiles returns the profiles selected by patterns, which are
+// profile names or shell patterns such as "web*", in the order given and
+// without duplicates. Every pattern must match at least one profile.
+func (c *Config) MatchProfiles(patterns []string) ([]string, error) {
+	names := c.ListProfiles()
+	sort.Strings(names)
+
+	var matched []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		found := false
+		for _, name := range names {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid profile pattern '%s': %w", pattern, err)
+			}
+			if !ok {
+				continue
+			}
+			found = true
+			if !seen[name] {
+				seen[name] = true
+				matched = append(matched, name)
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no profile matches '%s'", pattern)
+		}
+	}
+	return matched, nil
+}
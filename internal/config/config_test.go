@@ -1,12 +1,15 @@
 package config
 
 import (
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -68,6 +71,17 @@ func TestProfileValidation(t *testing.T) {
 			},
 			wantError: true,
 		},
+		{
+			name: "empty alternate host",
+			profile: &Profile{
+				RemoteUser: "user",
+				RemoteHost: "host",
+				Hosts:      []string{"host.lan", " "},
+				SSHPort:    22,
+				Backend:    BackendAuto,
+			},
+			wantError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -100,6 +114,30 @@ func TestProfileClone(t *testing.T) {
 	assert.NotEqual(t, original.TransferOptions.ExcludePatterns[0], clone.TransferOptions.ExcludePatterns[0])
 }
 
+func TestProfileHostNames(t *testing.T) {
+	profile := NewProfile("test", "user", "workbox")
+	assert.Equal(t, []string{"workbox"}, profile.HostNames())
+
+	profile.Hosts = []string{"work-lan.local", "100.64.0.5", "workbox", "work-lan.local"}
+	assert.Equal(t, []string{"workbox", "work-lan.local", "100.64.0.5"}, profile.HostNames())
+
+	clone := profile.Clone()
+	clone.Hosts[0] = "other"
+	assert.Equal(t, "work-lan.local", profile.Hosts[0])
+}
+
+func TestProfileSSHCommand(t *testing.T) {
+	profile := NewProfile("test", "user", "host")
+	assert.Equal(t, "ssh -p 22 user@host", profile.SSHCommand())
+
+	profile.SSHPort = 2222
+	profile.SSHKeyPath = "/home/me/my keys/id_ed25519"
+	assert.Equal(t, "ssh -p 2222 -i '/home/me/my keys/id_ed25519' user@host", profile.SSHCommand())
+
+	profile.UsePassword = true
+	assert.Equal(t, "ssh -p 2222 user@host", profile.SSHCommand())
+}
+
 func TestAddProfile(t *testing.T) {
 	cfg := NewConfig()
 
@@ -140,6 +178,209 @@ func TestDeleteProfile(t *testing.T) {
 	assert.Empty(t, cfg.CurrentProfile)
 }
 
+func TestMatchProfiles(t *testing.T) {
+	cfg := NewConfig()
+	for _, name := range []string{"web2", "web1", "db", "web10"} {
+		require.NoError(t, cfg.AddProfile(name, NewProfile(name, "user", name+".example.com")))
+	}
+
+	names, err := cfg.MatchProfiles([]string{"db", "web?"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db", "web1", "web2"}, names)
+
+	names, err = cfg.MatchProfiles([]string{"web1", "web*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web1", "web10", "web2"}, names)
+
+	_, err = cfg.MatchProfiles([]string{"web1", "cache*"})
+	assert.ErrorContains(t, err, "no profile matches 'cache*'")
+
+	_, err = cfg.MatchProfiles([]string{"web["})
+	assert.ErrorContains(t, err, "invalid profile pattern")
+}
+
+func TestTrustDomains(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Settings.TrustDomains = map[string]TrustDomain{"work": {KeyDir: "~/.ssh/work"}}
+	for _, name := range []string{"web", "db", "home"} {
+		profile := NewProfile(name, "user", name+".example.com")
+		if name != "home" {
+			profile.TrustDomain = "work"
+		}
+		require.NoError(t, cfg.AddProfile(name, profile))
+	}
+
+	assert.Equal(t, []string{"db", "web"}, cfg.ProfilesInTrustDomain("work"))
+	assert.Equal(t, []string{"home"}, cfg.ProfilesInTrustDomain(""))
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Profiles["home"].TrustDomain = "personal"
+	assert.ErrorContains(t, cfg.Validate(), "undefined trust domain 'personal'")
+
+	cfg.Profiles["home"].TrustDomain = ""
+	cfg.Settings.TrustDomains["../evil"] = TrustDomain{}
+	assert.ErrorContains(t, cfg.Validate(), "invalid trust domain name")
+}
+
+func TestLocations(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Settings.Locations = []Location{{Name: "home", SSIDs: []string{"HomeWifi"}}}
+	profile := NewProfile("workbox", "user", "workbox")
+	profile.Backend = BackendTailscale
+	profile.JumpHost = &JumpHost{Host: "bastion"}
+	profile.Locations = map[string]LocationOverride{
+		"home": {Backend: BackendLAN, RemoteHost: "192.168.1.20", Direct: true},
+	}
+	require.NoError(t, cfg.AddProfile("workbox", profile))
+	assert.NoError(t, cfg.Validate())
+
+	home, changes := profile.ForLocation("home")
+	assert.Equal(t, []string{"backend lan", "remote_host 192.168.1.20", "no jump hosts"}, changes)
+	assert.Equal(t, BackendLAN, home.Backend)
+	assert.Equal(t, "192.168.1.20", home.RemoteHost)
+	assert.Nil(t, home.JumpHost)
+	assert.Equal(t, "workbox", profile.RemoteHost)
+	assert.NotNil(t, profile.JumpHost)
+
+	// Elsewhere the profile is used as configured
+	away, changes := profile.ForLocation("office")
+	assert.Same(t, profile, away)
+	assert.Empty(t, changes)
+
+	profile.Locations["office"] = LocationOverride{RemoteHost: "10.0.0.5"}
+	assert.ErrorContains(t, cfg.Validate(), "undefined location 'office'")
+	delete(profile.Locations, "office")
+
+	profile.Locations["home"] = LocationOverride{Backend: "carrier-pigeon"}
+	assert.ErrorContains(t, cfg.Validate(), "invalid backend 'carrier-pigeon'")
+	profile.Locations["home"] = LocationOverride{Backend: BackendLAN}
+
+	cfg.Settings.Locations = append(cfg.Settings.Locations, Location{Name: "home"})
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "duplicate location 'home'")
+	assert.ErrorContains(t, err, "needs at least one of ssid, gateway or tailnet")
+}
+
+func TestPKCS11Provider(t *testing.T) {
+	module := filepath.Join(t.TempDir(), "opensc-pkcs11.so")
+	require.NoError(t, os.WriteFile(module, nil, 0644))
+
+	profile := NewProfile("yubikey", "user", "host")
+	profile.PKCS11Provider = module
+	assert.NoError(t, profile.Validate())
+	assert.Contains(t, profile.SSHCommand(), "-I "+module)
+
+	profile.PKCS11Provider = "agent"
+	assert.NoError(t, profile.Validate())
+	assert.NotContains(t, profile.SSHCommand(), "-I")
+
+	profile.PKCS11Provider = "opensc-pkcs11.so"
+	assert.ErrorContains(t, profile.Validate(), "absolute path")
+
+	profile.PKCS11Provider = module
+	profile.SSHKeyPath = "/home/user/.ssh/id_ed25519"
+	assert.ErrorContains(t, profile.Validate(), "cannot both be set")
+
+	cfg := NewConfig()
+	profile.SSHKeyPath = ""
+	profile.PKCS11Provider = filepath.Join(filepath.Dir(module), "missing.so")
+	require.NoError(t, cfg.AddProfile("yubikey", profile))
+	assert.ErrorContains(t, cfg.Validate(), "PKCS#11 module does not exist")
+}
+
+func TestHostKeyFingerprint(t *testing.T) {
+	const pin = "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"
+	for _, input := range []string{pin, pin[len("SHA256:"):], pin + "=", "  " + pin + "  "} {
+		normalized, err := NormalizeFingerprint(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, pin, normalized)
+	}
+	for _, input := range []string{"", "SHA256:", "MD5:16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48", "SHA256:dG9vIHNob3J0", "SHA256:not base64!"} {
+		_, err := NormalizeFingerprint(input)
+		assert.Error(t, err, input)
+	}
+
+	profile := NewProfile("pinned", "user", "host")
+	profile.HostKeyFingerprint = pin
+	assert.NoError(t, profile.Validate())
+	assert.Contains(t, profile.String(), pin)
+
+	profile.HostKeyFingerprint = "SHA256:dG9vIHNob3J0"
+	assert.ErrorContains(t, profile.Validate(), "host_key_fingerprint")
+}
+
+func TestAllowedCIDRs(t *testing.T) {
+	networks, err := ParseCIDRs([]string{"100.64.0.0/10", " fd7a:115c:a1e0::/48 "})
+	require.NoError(t, err)
+	require.Len(t, networks, 2)
+	assert.True(t, networks[0].Contains(net.ParseIP("100.101.2.3")))
+	assert.False(t, networks[0].Contains(net.ParseIP("192.168.1.20")))
+
+	profile := NewProfile("tailnet", "user", "host")
+	profile.AllowedCIDRs = []string{"100.64.0.0/10"}
+	assert.NoError(t, profile.Validate())
+	profile.AllowedCIDRs = []string{"100.64.0.5"}
+	assert.ErrorContains(t, profile.Validate(), "invalid network '100.64.0.5' in allowed_cidrs")
+
+	// A location replaces the allowed networks with its own
+	profile.AllowedCIDRs = []string{"100.64.0.0/10"}
+	profile.Locations = map[string]LocationOverride{"home": {Backend: BackendLAN, AllowedCIDRs: []string{"192.168.1.0/24"}}}
+	variant, changes := profile.ForLocation("home")
+	assert.Equal(t, []string{"192.168.1.0/24"}, variant.AllowedCIDRs)
+	assert.Equal(t, []string{"100.64.0.0/10"}, profile.AllowedCIDRs)
+	assert.Contains(t, changes, "allowed_cidrs 192.168.1.0/24")
+}
+
+func TestMetricsListen(t *testing.T) {
+	profile := NewProfile("web", "user", "host")
+	profile.MetricsListen = "127.0.0.1:9465"
+	assert.NoError(t, profile.Validate())
+	profile.MetricsListen = "9465"
+	assert.ErrorContains(t, profile.Validate(), "invalid metrics_listen '9465'")
+}
+
+func TestDefaultKeysValidation(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Settings.DefaultKeys = []string{"id_ed25519", "work_ecdsa", "/etc/klip/fleet_key"}
+	assert.NoError(t, cfg.Validate())
+
+	for _, key := range []string{"", "keys/id_rsa", "../id_rsa"} {
+		cfg.Settings.DefaultKeys = []string{key}
+		assert.ErrorContains(t, cfg.Validate(), "settings.default_keys", key)
+	}
+}
+
+func TestAuditSinksValidation(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Settings.Audit.Sinks = []AuditSink{{Type: "syslog", Address: "tcp://logs:514", Facility: "local0"}, {Type: "journald"}}
+	assert.NoError(t, cfg.Validate())
+
+	// The audit logger's own checks apply, facility and syslog address too
+	for _, sink := range []AuditSink{{Type: "tcp"}, {Type: "syslog", Facility: "audit"}, {Type: "syslog", Address: "http://logs"}, {Type: "kafka"}} {
+		cfg.Settings.Audit.Sinks = []AuditSink{sink}
+		assert.ErrorContains(t, cfg.Validate(), "settings.audit.sinks[0]", sink.Type)
+	}
+}
+
+func TestDefaultKeysRoundTrip(t *testing.T) {
+	// An empty list means the built-in defaults, like leaving it out, so
+	// saving it without the key keeps its meaning
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte("settings:\n  default_keys: []\n"), &cfg))
+	assert.Empty(t, cfg.Settings.DefaultKeys)
+
+	data, err := yaml.Marshal(&cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "default_keys")
+
+	cfg.Settings.DefaultKeys = []string{"work_ecdsa", "id_ed25519"}
+	data, err = yaml.Marshal(&cfg)
+	require.NoError(t, err)
+	var loaded Config
+	require.NoError(t, yaml.Unmarshal(data, &loaded))
+	assert.Equal(t, []string{"work_ecdsa", "id_ed25519"}, loaded.Settings.DefaultKeys)
+}
+
 func TestSanitizeProfile(t *testing.T) {
 	profile := &Profile{
 		Name:       "  test  ",
@@ -207,3 +448,387 @@ func TestIsPlaceholderValue(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveProfile(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Settings.DefaultBackend = "tailscale"
+	cfg.Settings.TransferMethod = "sftp"
+
+	profile := &Profile{RemoteUser: "user", RemoteHost: "host"}
+	profile.TransferOptions.CompressionLevel = 3
+	require.NoError(t, cfg.AddProfile("test", profile))
+
+	resolved, values, err := cfg.ResolveProfile("test")
+	require.NoError(t, err)
+
+	assert.Equal(t, 22, resolved.SSHPort)
+	assert.Equal(t, BackendTailscale, resolved.Backend)
+	assert.Equal(t, "sftp", resolved.TransferOptions.Method)
+	assert.Equal(t, 3, resolved.TransferOptions.CompressionLevel)
+
+	// The stored profile is left untouched
+	assert.Equal(t, 0, profile.SSHPort)
+	assert.Equal(t, BackendType(""), profile.Backend)
+
+	sources := make(map[string]ValueSource)
+	for _, v := range values {
+		sources[v.Key] = v.Source
+	}
+	assert.Equal(t, SourceProfile, sources["remote_host"])
+	assert.Equal(t, SourceDefault, sources["ssh_port"])
+	assert.Equal(t, SourceSettings, sources["backend"])
+	assert.Equal(t, SourceSettings, sources["transfer_options.method"])
+	assert.Equal(t, SourceProfile, sources["transfer_options.compression_level"])
+
+	_, _, err = cfg.ResolveProfile("missing")
+	assert.Error(t, err)
+}
+
+func TestProfileBackendPermitted(t *testing.T) {
+	p := NewProfile("vault", "admin", "vault.internal")
+	assert.True(t, p.BackendPermitted("lan"))
+
+	p.DeniedBackends = []string{"lan"}
+	assert.False(t, p.BackendPermitted("lan"))
+	assert.True(t, p.BackendPermitted("tailscale"))
+	require.NoError(t, p.Validate())
+
+	p.AllowedBackends = []string{"netbird"}
+	assert.False(t, p.BackendPermitted("tailscale"))
+	assert.True(t, p.BackendPermitted("netbird"))
+
+	p.Backend = BackendLAN
+	assert.Error(t, p.Validate())
+
+	p.Backend = BackendAuto
+	p.AllowedBackends = []string{"lan"}
+	assert.Error(t, p.Validate(), "every backend excluded")
+
+	p.AllowedBackends = []string{"auto"}
+	assert.Error(t, p.Validate())
+}
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec    string
+		listen  string
+		target  string
+		wantErr bool
+	}{
+		{"8080:localhost:80", "localhost:8080", "localhost:80", false},
+		{"0.0.0.0:5432:db.internal:5432", "0.0.0.0:5432", "db.internal:5432", false},
+		{"[::1]:8080:[fd00::1]:80", "[::1]:8080", "[fd00::1]:80", false},
+		{"8080:localhost", "", "", true},
+		{"0:localhost:80", "", "", true},
+		{"8080:localhost:http", "", "", true},
+		{"8080::80", "", "", true},
+		{"[::1:8080:localhost:80", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			f, err := ParseForward(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.listen, f.ListenAddr())
+			assert.Equal(t, tt.target, f.TargetAddr())
+		})
+	}
+
+	p := NewProfile("web", "deploy", "web.example.com")
+	p.Forwards = []string{"8080:localhost:80"}
+	assert.NoError(t, p.Validate())
+	p.Forwards = append(p.Forwards, "bad")
+	assert.Error(t, p.Validate())
+
+	p.Forwards = nil
+	p.RemoteForwards = []string{"9000:localhost:3000"}
+	assert.NoError(t, p.Validate())
+	p.RemoteForwards = []string{"9000:localhost"}
+	assert.Error(t, p.Validate())
+
+	f, err := ParseRemoteForward("9000:localhost:3000")
+	require.NoError(t, err)
+	assert.True(t, f.Remote)
+	assert.Equal(t, "remote localhost:9000 -> local localhost:3000", f.String())
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"1048576", 1048576, false},
+		{"500M", 500 << 20, false},
+		{"10GB", 10 << 30, false},
+		{"1.5k", 1536, false},
+		{"2 TB", 2 << 40, false},
+		{"", 0, true},
+		{"G", 0, true},
+		{"10X", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	p := NewProfile("web", "deploy", "web.example.com")
+	p.TransferOptions.MaxTotalSize = "lots"
+	assert.Error(t, p.Validate())
+	p.TransferOptions.MaxTotalSize = "10G"
+	p.TransferOptions.MaxFiles = -1
+	assert.Error(t, p.Validate())
+}
+
+func TestParseOwner(t *testing.T) {
+	tests := []struct {
+		input       string
+		user, group string
+		wantErr     bool
+	}{
+		{"deploy:www-data", "deploy", "www-data", false},
+		{"deploy", "deploy", "", false},
+		{":www-data", "", "www-data", false},
+		{"1000:33", "1000", "33", false},
+		{":", "", "", true},
+		{"", "", "", true},
+		{"deploy:www data", "", "", true},
+		{"deploy;rm -rf /", "", "", true},
+		{"-R:root", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			user, group, err := ParseOwner(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.user, user)
+			assert.Equal(t, tt.group, group)
+		})
+	}
+
+	p := NewProfile("web", "deploy", "web.example.com")
+	p.TransferOptions.Chown = "deploy:www-data"
+	assert.NoError(t, p.Validate())
+	p.TransferOptions.Chown = "deploy:$(id)"
+	assert.Error(t, p.Validate())
+}
+
+func TestParseChmod(t *testing.T) {
+	for _, spec := range []string{"", "D", "F8", "D75555", "Dq+r", "u+z", "644,", "D755;rm -rf /"} {
+		_, err := ParseChmod(spec)
+		assert.Error(t, err, spec)
+	}
+
+	tests := []struct {
+		spec string
+		mode os.FileMode
+		dir  bool
+		want os.FileMode
+	}{
+		{"D755,F644", 0700, true, 0755},
+		{"D755,F644", 0600, false, 0644},
+		{"D2775", 0700, true, 0775 | os.ModeSetgid},
+		{"go-w", 0777, false, 0755},
+		{"u=rwX,go=rX", 0600, false, 0644},
+		{"u=rwX,go=rX", 0700, false, 0755},
+		{"u=rwX,go=rX", 0700, true, 0755},
+		{"Fa+x", 0644, false, 0755},
+		{"Fa+x", 0700, true, 0700},
+		{"+t", 0777, true, 0777 | os.ModeSticky},
+		{"g+s,o-rwx", 0755, true, 0750 | os.ModeSetgid},
+		{"u+r-w", 0600, false, 0400},
+	}
+	for _, tt := range tests {
+		chmod, err := ParseChmod(tt.spec)
+		require.NoError(t, err, tt.spec)
+		mode := tt.mode
+		if tt.dir {
+			mode |= os.ModeDir
+		}
+		got := chmod.Apply(mode, tt.dir)
+		assert.Equal(t, tt.want, got&^os.ModeDir, "%s on %v", tt.spec, tt.mode)
+		assert.Equal(t, tt.dir, got.IsDir())
+	}
+
+	p := NewProfile("web", "deploy", "web.example.com")
+	p.TransferOptions.Chmod = "F0644"
+	assert.NoError(t, p.Validate())
+	p.TransferOptions.Chmod = "F0649"
+	assert.Error(t, p.Validate())
+}
+
+func TestExcludePresets(t *testing.T) {
+	opts := TransferOptions{
+		ExcludePresets:  []string{"vcs", "macos"},
+		ExcludePatterns: []string{"*.log", ".git"},
+	}
+
+	excludes := opts.Excludes()
+	assert.Contains(t, excludes, ".git")
+	assert.Contains(t, excludes, ".DS_Store")
+	assert.Equal(t, "*.log", excludes[len(excludes)-1])
+	assert.NotContains(t, excludes, "node_modules")
+
+	count := 0
+	for _, pattern := range excludes {
+		if pattern == ".git" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count, "duplicates removed")
+
+	patterns, err := ExpandExcludePresets([]string{"node", "python"})
+	require.NoError(t, err)
+	assert.Contains(t, patterns, "node_modules")
+	assert.Contains(t, patterns, "__pycache__")
+
+	p := NewProfile("web", "deploy", "web.example.com")
+	p.TransferOptions.ExcludePresets = []string{"vcs", "emacs"}
+	assert.ErrorContains(t, p.Validate(), "unknown exclude preset 'emacs'")
+}
+
+func TestJumpHost(t *testing.T) {
+	p := NewProfile("db", "deploy", "db.internal")
+	host, port := p.FirstHop()
+	assert.Equal(t, "db.internal", host)
+	assert.Equal(t, 22, port)
+
+	p.JumpHost = &JumpHost{Host: "bastion"}
+	require.NoError(t, p.Validate())
+	assert.Equal(t, "deploy@bastion", p.JumpHost.Spec(p))
+	assert.Equal(t, "ssh -p 22 -J deploy@bastion deploy@db.internal", p.SSHCommand())
+
+	p.JumpHost = &JumpHost{User: "jump", Host: "bastion", Port: 2222}
+	assert.Equal(t, "jump@bastion:2222", p.JumpHost.Spec(p))
+	host, port = p.FirstHop()
+	assert.Equal(t, "bastion", host)
+	assert.Equal(t, 2222, port)
+
+	clone := p.Clone()
+	clone.JumpHost.Host = "other"
+	assert.Equal(t, "bastion", p.JumpHost.Host)
+
+	p.JumpHost = &JumpHost{Port: 22}
+	assert.ErrorContains(t, p.Validate(), "jump host 1: host is required")
+	p.JumpHost = &JumpHost{Host: "bastion", Port: 70000}
+	assert.Error(t, p.Validate())
+}
+
+func TestJumpChain(t *testing.T) {
+	p := NewProfile("db", "deploy", "db.internal")
+	p.JumpHosts = []JumpHost{
+		{Host: "edge.example.com", Backend: BackendLAN, Timeout: 5},
+		{User: "ops", Host: "bastion", Port: 2222},
+	}
+	require.NoError(t, p.Validate())
+	assert.Equal(t, "deploy@edge.example.com,ops@bastion:2222", p.JumpSpec())
+	assert.Equal(t, "ssh -p 22 -J deploy@edge.example.com,ops@bastion:2222 deploy@db.internal", p.SSHCommand())
+
+	host, port := p.FirstHop()
+	assert.Equal(t, "edge.example.com", host)
+	assert.Equal(t, 22, port)
+
+	clone := p.Clone()
+	clone.JumpHosts[1].Host = "other"
+	assert.Equal(t, "bastion", p.JumpHosts[1].Host)
+
+	p.JumpHost = &JumpHost{Host: "bastion"}
+	assert.ErrorContains(t, p.Validate(), "cannot both be set")
+	p.JumpHost = nil
+
+	p.JumpHosts[1].Backend = BackendAuto
+	assert.ErrorContains(t, p.Validate(), "jump host 2: invalid backend")
+	p.JumpHosts[1].Backend = BackendTailscale
+	p.DeniedBackends = []string{"tailscale"}
+	assert.ErrorContains(t, p.Validate(), "jump host 2: backend 'tailscale' is excluded")
+	p.DeniedBackends = nil
+
+	p.JumpHosts[0].Timeout = -1
+	assert.ErrorContains(t, p.Validate(), "jump host 1: timeout")
+}
+
+func TestSSHConfigHost(t *testing.T) {
+	profile := NewProfile("web", "deploy", "web.tailnet")
+	profile.SSHPort = 2222
+	profile.SSHKeyPath = "/home/user/my keys/id_ed25519"
+	profile.JumpHost = &JumpHost{Host: "bastion"}
+	profile.Description = "Web server"
+
+	assert.Equal(t, `# Web server
+Host web
+    HostName web.tailnet
+    User deploy
+    Port 2222
+    IdentityFile "/home/user/my keys/id_ed25519"
+    IdentitiesOnly yes
+    ProxyJump deploy@bastion
+`, profile.SSHConfigHost().String())
+
+	profile.SSHKeyPath = ""
+	profile.PKCS11Provider = "agent"
+	assert.NotContains(t, profile.SSHConfigHost().String(), "Identit")
+
+	host := profile.SSHConfigHost()
+	host.Notes = []string{"first\nnote", "second"}
+	assert.True(t, strings.HasPrefix(host.String(), "# Web server\n# first note\n# second\nHost web\n"), host.String())
+}
+
+func TestReplaceSSHConfigBlock(t *testing.T) {
+	user := "Host old\n    User me\n"
+	block := "Host web\n    HostName web.tailnet\n"
+	managed := SSHConfigBlockBegin + "\n" + block + SSHConfigBlockEnd + "\n"
+
+	content := ReplaceSSHConfigBlock(user, block, false)
+	assert.Equal(t, user+"\n"+managed, content)
+
+	// Replaced in place, leaving the rest alone
+	updated := ReplaceSSHConfigBlock(content+"Host *\n    ServerAliveInterval 30\n", "Host db\n", false)
+	assert.Equal(t, user+"\n"+SSHConfigBlockBegin+"\nHost db\n"+SSHConfigBlockEnd+"\nHost *\n    ServerAliveInterval 30\n", updated)
+
+	// Moved to the top for Include
+	include := ReplaceSSHConfigBlock(content, "Include /home/user/.ssh/config.d/klip", true)
+	assert.True(t, strings.HasPrefix(include, SSHConfigBlockBegin+"\nInclude /home/user/.ssh/config.d/klip\n"+SSHConfigBlockEnd+"\n\n"+user), include)
+	assert.NotContains(t, include, "Host web")
+
+	assert.Equal(t, user, ReplaceSSHConfigBlock(content, "", false))
+	assert.Equal(t, managed, ReplaceSSHConfigBlock("", block, false))
+
+	assert.Equal(t, block, SSHConfigBlock(user+"\n"+managed))
+	assert.Empty(t, SSHConfigBlock(user))
+	assert.Empty(t, SSHConfigBlock(SSHConfigBlockBegin+"\n"+block))
+}
+
+func TestMergeSSHConfigBlock(t *testing.T) {
+	web := "# Web server\nHost web\n    HostName web.tailnet\n"
+	db := "Host db\n    HostName db.tailnet\n    # pinned\n    UserKnownHostsFile /tmp/db\n"
+	cache := "Host cache\n    HostName cache.tailnet\n"
+	block := "Include /ignored\n" + web + "\n" + db + "\n" + cache
+
+	// Replaced in place, keeping the other entries and their comments
+	newDB := "Host db\n    HostName 100.64.0.9\n"
+	assert.Equal(t, web+"\n"+newDB+"\n"+cache, MergeSSHConfigBlock(block, []string{"db"}, map[string]string{"db": newDB}))
+
+	// Removed, and new entries appended in order
+	mail := "Host mail\n    HostName mail.tailnet\n"
+	ftp := "Host ftp\n    HostName ftp.tailnet\n"
+	merged := MergeSSHConfigBlock(block, []string{"web", "mail", "ftp"}, map[string]string{"web": "", "mail": mail, "ftp": ftp})
+	assert.Equal(t, db+"\n"+cache+"\n"+mail+"\n"+ftp, merged)
+
+	assert.Equal(t, mail, MergeSSHConfigBlock("", []string{"mail"}, map[string]string{"mail": mail}))
+}
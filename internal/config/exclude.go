@@ -0,0 +1,66 @@
+// Package config - Exclude presets
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// excludePresets are curated exclude patterns enabled by name through
+// transfer_options.exclude_presets
+var excludePresets = map[string][]string{
+	"vcs":    {".git", ".svn", ".hg", ".bzr", "CVS"},
+	"node":   {"node_modules", ".npm", ".pnpm-store", ".yarn-cache"},
+	"python": {"__pycache__", "*.pyc", "*.pyo", ".venv", ".tox", ".pytest_cache", ".mypy_cache"},
+	"macos":  {".DS_Store", "._*", ".Spotlight-V100", ".Trashes", ".fseventsd"},
+}
+
+// ExcludePresetNames returns the names of the available exclude presets
+func ExcludePresetNames() []string {
+	names := make([]string, 0, len(excludePresets))
+	for name := range excludePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandExcludePresets returns the patterns of the named presets
+func ExpandExcludePresets(presets []string) ([]string, error) {
+	var patterns []string
+	for _, name := range presets {
+		preset, ok := excludePresets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown exclude preset '%s', must be one of: %s", name, strings.Join(ExcludePresetNames(), ", "))
+		}
+		patterns = append(patterns, preset...)
+	}
+	return patterns, nil
+}
+
+// Excludes returns the patterns of ExcludePresets followed by
+// ExcludePatterns, without duplicates. Unknown presets are skipped.
+func (o *TransferOptions) Excludes() []string {
+	var patterns []string
+	seen := make(map[string]bool)
+
+	add := func(pattern string) {
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	for _, name := range o.ExcludePresets {
+		for _, pattern := range excludePresets[name] {
+			add(pattern)
+		}
+	}
+	for _, pattern := range o.ExcludePatterns {
+		add(pattern)
+	}
+
+	return patterns
+}
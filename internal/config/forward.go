@@ -0,0 +1,127 @@
+// Package config - Port forwarding specifications
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Forward is a port forward. A local forward (ssh -L) listens locally and
+// tunnels connections to the target as seen from the remote host; a remote
+// forward (ssh -R) listens on the remote host and tunnels connections to
+// the target as seen from the local machine.
+type Forward struct {
+	// Remote is true for a remote forward
+	Remote bool
+
+	// BindAddress is the address to listen on (default: localhost)
+	BindAddress string
+
+	// ListenPort is the port to listen on
+	ListenPort int
+
+	// TargetHost and TargetPort are dialed by the other side
+	TargetHost string
+	TargetPort int
+}
+
+// ParseForward parses a forward in ssh -L syntax,
+// [bind_address:]port:host:hostport, e.g. "8080:localhost:80"
+// IPv6 addresses must be enclosed in brackets
+func ParseForward(spec string) (*Forward, error) {
+	fields, err := splitForward(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forward '%s': %w", spec, err)
+	}
+
+	f := &Forward{BindAddress: "localhost"}
+	switch len(fields) {
+	case 3:
+	case 4:
+		f.BindAddress = fields[0]
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("invalid forward '%s': expected [bind_address:]port:host:hostport", spec)
+	}
+
+	if f.ListenPort, err = parseForwardPort(fields[0]); err != nil {
+		return nil, fmt.Errorf("invalid forward '%s': %w", spec, err)
+	}
+	if f.TargetPort, err = parseForwardPort(fields[2]); err != nil {
+		return nil, fmt.Errorf("invalid forward '%s': %w", spec, err)
+	}
+
+	f.TargetHost = fields[1]
+	if f.TargetHost == "" || f.BindAddress == "" {
+		return nil, fmt.Errorf("invalid forward '%s': empty host", spec)
+	}
+
+	return f, nil
+}
+
+// ParseRemoteForward parses a remote forward in ssh -R syntax,
+// [bind_address:]port:host:hostport, e.g. "9000:localhost:3000"
+func ParseRemoteForward(spec string) (*Forward, error) {
+	f, err := ParseForward(spec)
+	if err != nil {
+		return nil, err
+	}
+	f.Remote = true
+	return f, nil
+}
+
+// ListenAddr returns the address to listen on
+func (f *Forward) ListenAddr() string {
+	return net.JoinHostPort(f.BindAddress, strconv.Itoa(f.ListenPort))
+}
+
+// TargetAddr returns the address connections are tunnelled to
+func (f *Forward) TargetAddr() string {
+	return net.JoinHostPort(f.TargetHost, strconv.Itoa(f.TargetPort))
+}
+
+// String describes the forward, e.g. "remote localhost:9000 -> local localhost:3000"
+func (f *Forward) String() string {
+	if f.Remote {
+		return "remote " + f.ListenAddr() + " -> local " + f.TargetAddr()
+	}
+	return "local " + f.ListenAddr() + " -> remote " + f.TargetAddr()
+}
+
+// splitForward splits spec on colons outside of [...] brackets, removing
+// the brackets
+func splitForward(spec string) ([]string, error) {
+	var fields []string
+	for spec != "" {
+		var field string
+		if strings.HasPrefix(spec, "[") {
+			end := strings.Index(spec, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']'")
+			}
+			field, spec = spec[1:end], spec[end+1:]
+			if spec != "" && !strings.HasPrefix(spec, ":") {
+				return nil, fmt.Errorf("expected ':' after ']'")
+			}
+		} else {
+			field, spec, _ = strings.Cut(spec, ":")
+			fields = append(fields, field)
+			continue
+		}
+		fields = append(fields, field)
+		spec = strings.TrimPrefix(spec, ":")
+	}
+	return fields, nil
+}
+
+// parseForwardPort parses a port number in a forward
+func parseForwardPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port '%s' must be between 1 and 65535", s)
+	}
+	return port, nil
+}
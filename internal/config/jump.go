@@ -0,0 +1,100 @@
+// Package config - Jump hosts
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// JumpHost is a bastion host that connections hop through (ssh -J)
+// Only the first jump host needs to be reachable over the backend; each
+// hop connects on to the next and resolves its name itself.
+type JumpHost struct {
+	// User is the login on the jump host (default: the profile's remote_user)
+	User string `yaml:"user,omitempty"`
+
+	// Host is the jump host's hostname or IP, resolved through the backend
+	Host string `yaml:"host"`
+
+	// Port is the jump host's SSH port (default: 22)
+	Port int `yaml:"port,omitempty"`
+
+	// Key is the private key for the jump host (default: the profile's ssh_key_path)
+	Key string `yaml:"key,omitempty"`
+
+	// Backend resolves Host through this backend, e.g. when a later hop is
+	// addressed by its tailnet IP (default: the selected backend for the
+	// first hop, the previous hop's name resolution for later ones)
+	Backend BackendType `yaml:"backend,omitempty"`
+
+	// Timeout is the number of seconds allowed for connecting to this hop
+	// (default: the connection timeout)
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// Validate checks the jump host configuration
+func (j *JumpHost) Validate() error {
+	if j.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if j.Port < 0 || j.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if j.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+// SSHPort returns the jump host's SSH port
+func (j *JumpHost) SSHPort() int {
+	if j.Port == 0 {
+		return 22
+	}
+	return j.Port
+}
+
+// Spec returns the jump host in ssh -J syntax, [user@]host[:port], with
+// the profile's user filled in
+func (j *JumpHost) Spec(p *Profile) string {
+	user := j.User
+	if user == "" {
+		user = p.RemoteUser
+	}
+	host := j.Host
+	if j.Port != 0 && j.Port != 22 {
+		host = net.JoinHostPort(j.Host, strconv.Itoa(j.Port))
+	}
+	return user + "@" + host
+}
+
+// JumpChain returns the jump hosts to connect through in order: jump_hosts,
+// or jump_host as a chain of one (empty connects directly)
+func (p *Profile) JumpChain() []JumpHost {
+	if p.JumpHost != nil {
+		return []JumpHost{*p.JumpHost}
+	}
+	return p.JumpHosts
+}
+
+// JumpSpec returns the jump chain in ssh -J syntax (empty without one)
+func (p *Profile) JumpSpec() string {
+	chain := p.JumpChain()
+	specs := make([]string, len(chain))
+	for i := range chain {
+		specs[i] = chain[i].Spec(p)
+	}
+	return strings.Join(specs, ",")
+}
+
+// FirstHop returns the host and SSH port klip connects to first: the first
+// jump host if there is one, otherwise the remote host itself
+func (p *Profile) FirstHop() (string, int) {
+	if chain := p.JumpChain(); len(chain) > 0 {
+		return chain[0].Host, chain[0].SSHPort()
+	}
+	return p.RemoteHost, p.SSHPort
+}
@@ -0,0 +1,114 @@
+// Package config - Network locations and per-location profile overrides
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Location is a network klip can be on, recognized by its Wi-Fi network,
+// default gateway or tailnet. Every kind of criterion listed must match
+// one of its values; settings.locations are checked in order and the
+// first match wins.
+type Location struct {
+	// Name is referenced by the locations of profiles
+	Name string `yaml:"name"`
+
+	// SSIDs are Wi-Fi network names
+	SSIDs []string `yaml:"ssid,omitempty"`
+
+	// Gateways are IP addresses of the default gateway
+	Gateways []string `yaml:"gateway,omitempty"`
+
+	// Tailnets are names of the tailnet Tailscale is logged in to
+	Tailnets []string `yaml:"tailnet,omitempty"`
+}
+
+// LocationOverride replaces profile values while klip is on a location;
+// unset fields keep the profile's value
+type LocationOverride struct {
+	Backend    BackendType `yaml:"backend,omitempty"`
+	RemoteHost string      `yaml:"remote_host,omitempty"`
+	Hosts      []string    `yaml:"hosts,omitempty"`
+	SSHPort    int         `yaml:"ssh_port,omitempty"`
+
+	// AllowedCIDRs replaces the profile's allowed_cidrs, e.g. with the
+	// LAN's network where the host is reached directly
+	AllowedCIDRs []string `yaml:"allowed_cidrs,omitempty"`
+
+	// Direct connects without the profile's jump hosts
+	Direct bool `yaml:"direct,omitempty"`
+}
+
+// Location returns the entry of settings.locations with the given name, or
+// nil if there is none
+func (s *Settings) Location(name string) *Location {
+	for i := range s.Locations {
+		if s.Locations[i].Name == name {
+			return &s.Locations[i]
+		}
+	}
+	return nil
+}
+
+// ForLocation returns a copy of the profile with the overrides of the
+// named location applied, and a description of each change. The profile
+// itself is returned, without changes, if it has no overrides there.
+func (p *Profile) ForLocation(name string) (*Profile, []string) {
+	override, ok := p.Locations[name]
+	if !ok {
+		return p, nil
+	}
+
+	profile := p.Clone()
+	var changes []string
+	if override.Backend != "" {
+		profile.Backend = override.Backend
+		changes = append(changes, "backend "+string(override.Backend))
+	}
+	if override.RemoteHost != "" {
+		profile.RemoteHost = override.RemoteHost
+		changes = append(changes, "remote_host "+override.RemoteHost)
+	}
+	if len(override.Hosts) > 0 {
+		profile.Hosts = append([]string(nil), override.Hosts...)
+		changes = append(changes, "hosts "+strings.Join(override.Hosts, ", "))
+	}
+	if override.SSHPort != 0 {
+		profile.SSHPort = override.SSHPort
+		changes = append(changes, "ssh_port "+strconv.Itoa(override.SSHPort))
+	}
+	if len(override.AllowedCIDRs) > 0 {
+		profile.AllowedCIDRs = append([]string(nil), override.AllowedCIDRs...)
+		changes = append(changes, "allowed_cidrs "+strings.Join(override.AllowedCIDRs, ", "))
+	}
+	if override.Direct && len(profile.JumpChain()) > 0 {
+		profile.JumpHost = nil
+		profile.JumpHosts = nil
+		changes = append(changes, "no jump hosts")
+	}
+	return profile, changes
+}
+
+// validateLocations checks settings.locations
+func validateLocations(locations []Location) ValidationErrors {
+	var errors ValidationErrors
+	seen := map[string]bool{}
+	for i, location := range locations {
+		field := fmt.Sprintf("settings.locations[%d]", i)
+		switch {
+		case location.Name == "":
+			errors = append(errors, ValidationError{Field: field + ".name", Message: "is required"})
+		case seen[location.Name]:
+			errors = append(errors, ValidationError{Field: field + ".name", Message: fmt.Sprintf("duplicate location '%s'", location.Name)})
+		}
+		seen[location.Name] = true
+
+		if len(location.SSIDs) == 0 && len(location.Gateways) == 0 && len(location.Tailnets) == 0 {
+			errors = append(errors, ValidationError{Field: field, Message: "needs at least one of ssid, gateway or tailnet"})
+		}
+	}
+	return errors
+}
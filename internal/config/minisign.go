@@ -0,0 +1,115 @@
+// Package config - minisign signature verification
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrSignatureKey reports a signature made by none of the trusted keys
+var ErrSignatureKey = errors.New("signed by an untrusted key")
+
+// MinisignKey is a minisign public key
+type MinisignKey struct {
+	// ID is the key ID that ties signatures to the key
+	ID [8]byte
+
+	// Key is the Ed25519 public key
+	Key ed25519.PublicKey
+}
+
+// ParseMinisignKey parses a minisign public key, given as its base64 line
+// (as printed by minisign -G) or as the path to a minisign .pub file
+func ParseMinisignKey(text string) (*MinisignKey, error) {
+	text = strings.TrimSpace(text)
+	if data, err := os.ReadFile(text); err == nil {
+		text = lastLine(string(data))
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("invalid minisign public key '%s'", text)
+	}
+
+	key := &MinisignKey{Key: ed25519.PublicKey(raw[10:])}
+	copy(key.ID[:], raw[2:10])
+	return key, nil
+}
+
+// String returns the key as the base64 line of a minisign .pub file
+func (k *MinisignKey) String() string {
+	raw := append([]byte("Ed"), k.ID[:]...)
+	return base64.StdEncoding.EncodeToString(append(raw, k.Key...))
+}
+
+// IDString returns the key ID as minisign prints it
+func (k *MinisignKey) IDString() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(k.ID[:]))
+}
+
+// lastLine returns the last non-empty line of a minisign file
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// VerifyMinisign checks a minisign signature of message (the contents of a
+// .minisig file), legacy or pre-hashed, including its trusted comment.
+// It returns the key among keys that made the signature.
+func VerifyMinisign(keys []*MinisignKey, message, signature []byte) (*MinisignKey, error) {
+	lines := strings.Split(strings.TrimSpace(string(bytes.ReplaceAll(signature, []byte("\r\n"), []byte("\n")))), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "untrusted comment:") || !strings.HasPrefix(lines[2], "trusted comment:") {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+
+	var key *MinisignKey
+	for _, k := range keys {
+		if bytes.Equal(k.ID[:], sig[2:10]) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w (key ID %016X)", ErrSignatureKey, binary.LittleEndian.Uint64(sig[2:10]))
+	}
+
+	// "ED" signatures are of the BLAKE2b-512 hash of the message
+	signed := message
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		sum := blake2b.Sum512(message)
+		signed = sum[:]
+	default:
+		return nil, fmt.Errorf("unsupported minisign signature algorithm '%s'", sig[:2])
+	}
+	if !ed25519.Verify(key.Key, signed, sig[10:]) {
+		return nil, fmt.Errorf("signature verification failed")
+	}
+
+	// The trusted comment is signed together with the signature
+	trusted := strings.TrimPrefix(lines[2], "trusted comment:")
+	trusted = strings.TrimPrefix(trusted, " ")
+	if !ed25519.Verify(key.Key, append(sig[10:], trusted...), globalSig) {
+		return nil, fmt.Errorf("trusted comment verification failed")
+	}
+	return key, nil
+}
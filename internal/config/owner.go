@@ -0,0 +1,28 @@
+// Package config - File ownership values
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ownerName matches user and group names and numeric IDs
+var ownerName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*\$?$`)
+
+// ParseOwner parses an ownership spec such as "deploy:www-data", "deploy"
+// or ":www-data" (chown syntax). Either part may be empty, but not both.
+func ParseOwner(spec string) (user, group string, err error) {
+	user, group, _ = strings.Cut(spec, ":")
+	if user == "" && group == "" {
+		return "", "", fmt.Errorf("invalid owner %q: expected user[:group] or :group", spec)
+	}
+
+	for _, name := range []string{user, group} {
+		if name != "" && !ownerName.MatchString(name) {
+			return "", "", fmt.Errorf("invalid owner %q: %q is not a valid user or group name", spec, name)
+		}
+	}
+	return user, group, nil
+}
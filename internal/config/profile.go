@@ -1,7 +1,11 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"path/filepath"
 	"strings"
 )
 
@@ -23,6 +27,12 @@ const (
 
 	// BackendNetBird uses NetBird VPN
 	BackendNetBird BackendType = "netbird"
+
+	// BackendZeroTier uses ZeroTier One
+	BackendZeroTier BackendType = "zerotier"
+
+	// BackendWireGuard uses plain WireGuard (wg/wg-quick)
+	BackendWireGuard BackendType = "wireguard"
 )
 
 // Profile represents a connection profile for a remote machine
@@ -42,6 +52,10 @@ type Profile struct {
 	// RemoteHost is the hostname or IP address of the remote machine
 	RemoteHost string `yaml:"remote_host"`
 
+	// Hosts lists other names or addresses of the same machine, e.g. its
+	// LAN name and a VPN address, tried after RemoteHost (see HostNames)
+	Hosts []string `yaml:"hosts,omitempty"`
+
 	// SSHPort is the SSH port (default: 22)
 	SSHPort int `yaml:"ssh_port,omitempty"`
 
@@ -51,13 +65,76 @@ type Profile struct {
 	// UsePassword enables password authentication instead of key-based
 	UsePassword bool `yaml:"use_password,omitempty"`
 
+	// PKCS11Provider is the PKCS#11 module (e.g. opensc-pkcs11.so) for a
+	// key on a smartcard or YubiKey, loaded into the ssh-agent on first
+	// use, or "agent" for the hardware keys the agent already holds
+	// (mutually exclusive with SSHKeyPath)
+	PKCS11Provider string `yaml:"pkcs11_provider,omitempty"`
+
+	// TrustDomain names the entry of settings.trust_domains whose
+	// known_hosts file and key directory the profile uses (empty uses
+	// klip's known_hosts and ~/.ssh)
+	TrustDomain string `yaml:"trust_domain,omitempty"`
+
+	// HostKeyFingerprint pins the SHA256 fingerprint of the host's key
+	// (e.g. "SHA256:uNiVz..."); connections must present it whatever
+	// known_hosts contains
+	HostKeyFingerprint string `yaml:"host_key_fingerprint,omitempty"`
+
+	// Team names the team bundle the profile was pulled from; such
+	// profiles are replaced by klip team refresh
+	Team string `yaml:"team,omitempty"`
+
+	// Access restricts operations for local roles (settings.roles),
+	// usually set by a team bundle; the first matching rule decides
+	Access []AccessRule `yaml:"access,omitempty"`
+
+	// JumpHost is a bastion to connect through (nil connects directly)
+	JumpHost *JumpHost `yaml:"jump_host,omitempty"`
+
+	// JumpHosts is a chain of bastions to connect through in order, for
+	// hosts more than one hop away (mutually exclusive with JumpHost)
+	JumpHosts []JumpHost `yaml:"jump_hosts,omitempty"`
+
+	// AllowedBackends restricts the backends this profile may use (empty allows all)
+	AllowedBackends []string `yaml:"allowed_backends,omitempty"`
+
+	// DeniedBackends lists backends this profile must never use
+	DeniedBackends []string `yaml:"denied_backends,omitempty"`
+
+	// RequireEncryptedPath refuses LAN connections whose route does not go
+	// through a connected VPN
+	RequireEncryptedPath bool `yaml:"require_encrypted_path,omitempty"`
+
+	// MetricsListen is the host:port klip mux serves this profile's
+	// metrics on, so muxes for several profiles can run side by side
+	// (default: settings.metrics.listen)
+	MetricsListen string `yaml:"metrics_listen,omitempty"`
+
+	// AllowedCIDRs are the networks the address klip dials must be in
+	// (e.g. 100.64.0.0/10); connections to any other address are refused
+	// (empty allows all)
+	AllowedCIDRs []string `yaml:"allowed_cidrs,omitempty"`
+
+	// Forwards lists local port forwards opened by klip forward,
+	// in ssh -L syntax ([bind_address:]port:host:hostport)
+	Forwards []string `yaml:"forwards,omitempty"`
+
+	// RemoteForwards lists remote port forwards opened by klip forward,
+	// in ssh -R syntax ([bind_address:]port:host:hostport)
+	RemoteForwards []string `yaml:"remote_forwards,omitempty"`
+
+	// Locations override profile values per network location, keyed by
+	// the name of an entry of settings.locations
+	Locations map[string]LocationOverride `yaml:"locations,omitempty"`
+
 	// TransferOptions contains transfer-specific settings
 	TransferOptions TransferOptions `yaml:"transfer_options,omitempty"`
 }
 
 // TransferOptions contains options for file transfers
 type TransferOptions struct {
-	// Method specifies the transfer method (rsync, sftp)
+	// Method specifies the transfer method (rsync, sftp, delta, scp)
 	Method string `yaml:"method,omitempty"`
 
 	// CompressionLevel specifies the compression level (0-9)
@@ -66,14 +143,111 @@ type TransferOptions struct {
 	// ExcludePatterns contains rsync exclude patterns
 	ExcludePatterns []string `yaml:"exclude_patterns,omitempty"`
 
+	// IncludePatterns limits transfers to files matching one of these
+	// patterns (rsync --include syntax); directories are still traversed
+	IncludePatterns []string `yaml:"include_patterns,omitempty"`
+
+	// ExcludePresets enables curated exclude lists by name (vcs, node, python, macos)
+	ExcludePresets []string `yaml:"exclude_presets,omitempty"`
+
 	// BandwidthLimit limits transfer speed in KB/s (0=unlimited)
 	BandwidthLimit int `yaml:"bandwidth_limit,omitempty"`
 
 	// PreservePermissions preserves file permissions during transfer
 	PreservePermissions bool `yaml:"preserve_permissions,omitempty"`
 
+	// PreserveXattrs preserves extended attributes and ACLs (e.g. SELinux
+	// labels, macOS metadata) during transfer
+	PreserveXattrs bool `yaml:"preserve_xattrs,omitempty"`
+
+	// PreserveHardLinks recreates hard links within directory transfers
+	// instead of copying each link as a separate file
+	PreserveHardLinks bool `yaml:"preserve_hard_links,omitempty"`
+
+	// Sparse leaves runs of zeros as holes at the destination instead of
+	// writing them, for VM disk images and preallocated files
+	Sparse bool `yaml:"sparse,omitempty"`
+
 	// DeleteAfterTransfer deletes source files after successful transfer
 	DeleteAfterTransfer bool `yaml:"delete_after_transfer,omitempty"`
+
+	// NoAtomic uploads files in place instead of under a temporary name
+	// that is renamed into place on success
+	NoAtomic bool `yaml:"no_atomic,omitempty"`
+
+	// NoResume restarts interrupted SFTP transfers from zero instead of
+	// continuing partial files, and disables rsync --partial
+	NoResume bool `yaml:"no_resume,omitempty"`
+
+	// VerifyResume compares the checksum of a partial file with the
+	// source's before continuing it
+	VerifyResume bool `yaml:"verify_resume,omitempty"`
+
+	// Verify compares the SHA-256 of every transferred file on both sides
+	// after the transfer and fails it on a mismatch
+	Verify bool `yaml:"verify,omitempty"`
+
+	// Concurrency is the number of files SFTP directory transfers copy at
+	// once (0=default of 4, 1=one at a time)
+	Concurrency int `yaml:"concurrency,omitempty"`
+
+	// LowMemory copies the files of SFTP directory transfers as the tree is
+	// walked instead of listing them first, for trees of millions of files
+	LowMemory bool `yaml:"low_memory,omitempty"`
+
+	// Segments splits single files of 32 MiB or more into ranges copied
+	// over this many concurrent SFTP streams (0 or 1=one stream)
+	Segments int `yaml:"segments,omitempty"`
+
+	// Dedup remembers the chunks of single files of 32 MiB or more pushed
+	// to the host, so chunks already there are copied server-side instead
+	// of sent again
+	Dedup bool `yaml:"dedup,omitempty"`
+
+	// StagingDir holds partial files on the receiving side (remote for
+	// pushes, local for pulls) until they are moved into place, e.g. on a
+	// faster volume than the destination
+	StagingDir string `yaml:"staging_dir,omitempty"`
+
+	// Chown sets the owner and group of pushed files, e.g. "deploy:www-data"
+	// (chown syntax; rsync --chown)
+	Chown string `yaml:"chown,omitempty"`
+
+	// Chmod overrides the permissions of transferred files, e.g. "D755,F644"
+	// (rsync --chmod syntax)
+	Chmod string `yaml:"chmod,omitempty"`
+
+	// StrictMethod disables automatic fallback to SFTP when rsync is unavailable
+	StrictMethod bool `yaml:"strict_method,omitempty"`
+
+	// RsyncPath is the remote rsync program (rsync --rsync-path), e.g. "sudo rsync"
+	RsyncPath string `yaml:"rsync_path,omitempty"`
+
+	// ExtraRsyncArgs contains additional rsync options (validated against an allowlist)
+	ExtraRsyncArgs []string `yaml:"extra_rsync_args,omitempty"`
+
+	// MaxFiles asks before transfers of more files than this (0=unlimited)
+	MaxFiles int `yaml:"max_files,omitempty"`
+
+	// MaxTotalSize asks before transfers larger than this, e.g. "10G" (empty=unlimited)
+	MaxTotalSize string `yaml:"max_total_size,omitempty"`
+
+	// PreUploadScan is a scanner command run over the files before klipc
+	// uploads them, e.g. ["clamscan", "--infected"]; file paths are appended
+	// and a non-zero exit status blocks the upload
+	PreUploadScan []string `yaml:"pre_upload_scan,omitempty"`
+}
+
+// MaxTotalSizeBytes returns MaxTotalSize in bytes, 0 if unset or invalid
+func (o *TransferOptions) MaxTotalSizeBytes() int64 {
+	if o.MaxTotalSize == "" {
+		return 0
+	}
+	size, err := ParseSize(o.MaxTotalSize)
+	if err != nil {
+		return 0
+	}
+	return size
 }
 
 // NewProfile creates a new profile with defaults
@@ -102,6 +276,11 @@ func (p *Profile) Validate() error {
 	if p.RemoteHost == "" {
 		return fmt.Errorf("remote_host is required")
 	}
+	for _, host := range p.Hosts {
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("hosts cannot contain empty entries")
+		}
+	}
 
 	if p.SSHPort <= 0 || p.SSHPort > 65535 {
 		return fmt.Errorf("ssh_port must be between 1 and 65535")
@@ -113,24 +292,198 @@ func (p *Profile) Validate() error {
 		BackendTailscale: true,
 		BackendHeadscale: true,
 		BackendNetBird:   true,
+		BackendZeroTier:  true,
+		BackendWireGuard: true,
 	}
 
 	if !validBackends[p.Backend] {
-		return fmt.Errorf("invalid backend '%s', must be one of: auto, lan, tailscale, headscale, netbird", p.Backend)
+		return fmt.Errorf("invalid backend '%s', must be one of: auto, lan, tailscale, headscale, netbird, zerotier, wireguard", p.Backend)
+	}
+
+	for _, list := range [][]string{p.AllowedBackends, p.DeniedBackends} {
+		for _, name := range list {
+			if BackendType(name) == BackendAuto || !validBackends[BackendType(name)] {
+				return fmt.Errorf("invalid backend '%s' in allowed_backends/denied_backends, must be one of: lan, tailscale, headscale, netbird, zerotier, wireguard", name)
+			}
+		}
+	}
+
+	if p.Backend != BackendAuto && !p.BackendPermitted(string(p.Backend)) {
+		return fmt.Errorf("backend '%s' is excluded by allowed_backends/denied_backends", p.Backend)
+	}
+
+	permitted := false
+	for _, name := range []BackendType{BackendLAN, BackendTailscale, BackendHeadscale, BackendNetBird, BackendZeroTier, BackendWireGuard} {
+		permitted = permitted || p.BackendPermitted(string(name))
+	}
+	if !permitted {
+		return fmt.Errorf("allowed_backends/denied_backends exclude every backend")
+	}
+
+	for _, spec := range p.Forwards {
+		if _, err := ParseForward(spec); err != nil {
+			return err
+		}
+	}
+	for _, spec := range p.RemoteForwards {
+		if _, err := ParseRemoteForward(spec); err != nil {
+			return err
+		}
+	}
+
+	if p.JumpHost != nil && len(p.JumpHosts) > 0 {
+		return fmt.Errorf("jump_host and jump_hosts cannot both be set")
 	}
 
-	validMethods := map[string]bool{"rsync": true, "sftp": true}
+	if err := validateAccess(p.Access); err != nil {
+		return err
+	}
+
+	if p.PKCS11Provider != "" {
+		if p.SSHKeyPath != "" {
+			return fmt.Errorf("pkcs11_provider and ssh_key_path cannot both be set")
+		}
+		if p.PKCS11Provider != "agent" && !filepath.IsAbs(p.PKCS11Provider) {
+			return fmt.Errorf("pkcs11_provider must be an absolute path to a PKCS#11 module or 'agent'")
+		}
+	}
+	if p.HostKeyFingerprint != "" {
+		if _, err := NormalizeFingerprint(p.HostKeyFingerprint); err != nil {
+			return err
+		}
+	}
+	if _, err := ParseCIDRs(p.AllowedCIDRs); err != nil {
+		return err
+	}
+	if p.MetricsListen != "" {
+		if _, port, err := net.SplitHostPort(p.MetricsListen); err != nil || port == "" {
+			return fmt.Errorf("invalid metrics_listen '%s', must be host:port", p.MetricsListen)
+		}
+	}
+	for i, hop := range p.JumpChain() {
+		if err := hop.Validate(); err != nil {
+			return fmt.Errorf("jump host %d: %w", i+1, err)
+		}
+		if hop.Backend == "" {
+			continue
+		}
+		if hop.Backend == BackendAuto || !validBackends[hop.Backend] {
+			return fmt.Errorf("jump host %d: invalid backend '%s', must be one of: lan, tailscale, headscale, netbird, zerotier, wireguard", i+1, hop.Backend)
+		}
+		if !p.BackendPermitted(string(hop.Backend)) {
+			return fmt.Errorf("jump host %d: backend '%s' is excluded by allowed_backends/denied_backends", i+1, hop.Backend)
+		}
+	}
+
+	validMethods := map[string]bool{"rsync": true, "sftp": true, "delta": true, "scp": true}
 	if p.TransferOptions.Method != "" && !validMethods[p.TransferOptions.Method] {
-		return fmt.Errorf("invalid transfer method '%s', must be 'rsync' or 'sftp'", p.TransferOptions.Method)
+		return fmt.Errorf("invalid transfer method '%s', must be 'rsync', 'sftp', 'delta' or 'scp'", p.TransferOptions.Method)
 	}
 
 	if p.TransferOptions.CompressionLevel < 0 || p.TransferOptions.CompressionLevel > 9 {
 		return fmt.Errorf("compression_level must be between 0 and 9")
 	}
 
+	if len(p.TransferOptions.PreUploadScan) > 0 && strings.TrimSpace(p.TransferOptions.PreUploadScan[0]) == "" {
+		return fmt.Errorf("pre_upload_scan must start with the scanner program")
+	}
+
+	if _, err := ExpandExcludePresets(p.TransferOptions.ExcludePresets); err != nil {
+		return err
+	}
+
+	if p.TransferOptions.Concurrency < 0 {
+		return fmt.Errorf("concurrency cannot be negative")
+	}
+
+	if p.TransferOptions.Segments < 0 {
+		return fmt.Errorf("segments cannot be negative")
+	}
+
+	if p.TransferOptions.MaxFiles < 0 {
+		return fmt.Errorf("max_files cannot be negative")
+	}
+
+	if p.TransferOptions.MaxTotalSize != "" {
+		if _, err := ParseSize(p.TransferOptions.MaxTotalSize); err != nil {
+			return fmt.Errorf("max_total_size: %w", err)
+		}
+	}
+
+	if p.TransferOptions.Chown != "" {
+		if _, _, err := ParseOwner(p.TransferOptions.Chown); err != nil {
+			return fmt.Errorf("chown: %w", err)
+		}
+	}
+
+	if p.TransferOptions.Chmod != "" {
+		if _, err := ParseChmod(p.TransferOptions.Chmod); err != nil {
+			return fmt.Errorf("chmod: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// BackendPermitted reports whether the profile may connect through the
+// named backend
+func (p *Profile) BackendPermitted(name string) bool {
+	for _, denied := range p.DeniedBackends {
+		if denied == name {
+			return false
+		}
+	}
+
+	if len(p.AllowedBackends) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedBackends {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HostNames lists the names the machine is reached by: RemoteHost followed
+// by Hosts, without duplicates
+func (p *Profile) HostNames() []string {
+	names := []string{p.RemoteHost}
+	seen := map[string]bool{p.RemoteHost: true}
+	for _, host := range p.Hosts {
+		if !seen[host] {
+			seen[host] = true
+			names = append(names, host)
+		}
+	}
+	return names
+}
+
+// NormalizeFingerprint returns a SHA256 host key fingerprint the way
+// ssh-keygen prints it, "SHA256:" followed by unpadded base64, accepting it
+// without the prefix or with padding
+func NormalizeFingerprint(fingerprint string) (string, error) {
+	encoded := strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(fingerprint), "SHA256:"), "=")
+	sum, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sum) != sha256.Size {
+		return "", fmt.Errorf("host_key_fingerprint must be a SHA256 fingerprint like 'SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s', got '%s'", fingerprint)
+	}
+	return "SHA256:" + encoded, nil
+}
+
+// ParseCIDRs parses allowed_cidrs entries, e.g. "100.64.0.0/10"
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s' in allowed_cidrs, expected CIDR notation like 100.64.0.0/10", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
 // SSHAddress returns the SSH connection address
 func (p *Profile) SSHAddress() string {
 	if p.SSHPort != 22 {
@@ -139,6 +492,45 @@ func (p *Profile) SSHAddress() string {
 	return fmt.Sprintf("%s@%s", p.RemoteUser, p.RemoteHost)
 }
 
+// SSHCommand returns the equivalent OpenSSH command line for the profile,
+// for use with tools that don't go through klip
+func (p *Profile) SSHCommand() string {
+	port := p.SSHPort
+	if port == 0 {
+		port = 22
+	}
+
+	parts := []string{"ssh", "-p", fmt.Sprintf("%d", port)}
+	if p.SSHKeyPath != "" && !p.UsePassword {
+		parts = append(parts, "-i", shellQuote(p.SSHKeyPath))
+	}
+	if p.PKCS11Provider != "" && p.PKCS11Provider != "agent" && !p.UsePassword {
+		parts = append(parts, "-I", shellQuote(p.PKCS11Provider))
+	}
+	if jump := p.JumpSpec(); jump != "" {
+		parts = append(parts, "-J", shellQuote(jump))
+	}
+	parts = append(parts, shellQuote(fmt.Sprintf("%s@%s", p.RemoteUser, p.RemoteHost)))
+
+	return strings.Join(parts, " ")
+}
+
+// shellQuote single-quotes s for a POSIX shell when it contains characters
+// outside a conservative safe set
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-~", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
 // String returns a string representation of the profile
 func (p *Profile) String() string {
 	var parts []string
@@ -148,16 +540,56 @@ func (p *Profile) String() string {
 	}
 	parts = append(parts, fmt.Sprintf("  Backend: %s", p.Backend))
 	parts = append(parts, fmt.Sprintf("  Remote: %s", p.SSHAddress()))
+	if len(p.Hosts) > 0 {
+		parts = append(parts, fmt.Sprintf("  Other Hosts: %s", strings.Join(p.Hosts, ", ")))
+	}
 	if p.SSHKeyPath != "" {
 		parts = append(parts, fmt.Sprintf("  SSH Key: %s", p.SSHKeyPath))
 	}
+	if p.PKCS11Provider != "" {
+		parts = append(parts, fmt.Sprintf("  PKCS#11 Provider: %s", p.PKCS11Provider))
+	}
+	if p.HostKeyFingerprint != "" {
+		parts = append(parts, fmt.Sprintf("  Host Key Fingerprint: %s", p.HostKeyFingerprint))
+	}
+	if jump := p.JumpSpec(); jump != "" {
+		parts = append(parts, fmt.Sprintf("  Jump Host: %s", jump))
+	}
 	return strings.Join(parts, "\n")
 }
 
 // Clone creates a deep copy of the profile
 func (p *Profile) Clone() *Profile {
 	clone := *p
+	clone.Hosts = append([]string(nil), p.Hosts...)
+	clone.AllowedBackends = append([]string(nil), p.AllowedBackends...)
+	clone.DeniedBackends = append([]string(nil), p.DeniedBackends...)
+	clone.AllowedCIDRs = append([]string(nil), p.AllowedCIDRs...)
+	clone.Forwards = append([]string(nil), p.Forwards...)
+	clone.RemoteForwards = append([]string(nil), p.RemoteForwards...)
+	if p.JumpHost != nil {
+		jump := *p.JumpHost
+		clone.JumpHost = &jump
+	}
+	clone.JumpHosts = append([]JumpHost(nil), p.JumpHosts...)
+	clone.Access = append([]AccessRule(nil), p.Access...)
+	if p.Locations != nil {
+		clone.Locations = make(map[string]LocationOverride, len(p.Locations))
+		for name, override := range p.Locations {
+			override.Hosts = append([]string(nil), override.Hosts...)
+			override.AllowedCIDRs = append([]string(nil), override.AllowedCIDRs...)
+			clone.Locations[name] = override
+		}
+	}
 	clone.TransferOptions.ExcludePatterns = make([]string, len(p.TransferOptions.ExcludePatterns))
 	copy(clone.TransferOptions.ExcludePatterns, p.TransferOptions.ExcludePatterns)
+	clone.TransferOptions.IncludePatterns = make([]string, len(p.TransferOptions.IncludePatterns))
+	copy(clone.TransferOptions.IncludePatterns, p.TransferOptions.IncludePatterns)
+	clone.TransferOptions.ExcludePresets = make([]string, len(p.TransferOptions.ExcludePresets))
+	copy(clone.TransferOptions.ExcludePresets, p.TransferOptions.ExcludePresets)
+	clone.TransferOptions.ExtraRsyncArgs = make([]string, len(p.TransferOptions.ExtraRsyncArgs))
+	copy(clone.TransferOptions.ExtraRsyncArgs, p.TransferOptions.ExtraRsyncArgs)
+	clone.TransferOptions.PreUploadScan = make([]string, len(p.TransferOptions.PreUploadScan))
+	copy(clone.TransferOptions.PreUploadScan, p.TransferOptions.PreUploadScan)
 	return &clone
 }
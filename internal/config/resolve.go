@@ -0,0 +1,154 @@
+// Package config - Effective profile values and their sources
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValueSource identifies where an effective profile value came from
+type ValueSource string
+
+const (
+	// SourceProfile means the value is set in the profile itself
+	SourceProfile ValueSource = "profile"
+
+	// SourceSettings means the value comes from the global settings section
+	SourceSettings ValueSource = "settings"
+
+	// SourceDefault means the value is klip's built-in default
+	SourceDefault ValueSource = "default"
+)
+
+// ResolvedValue is an effective profile value and the source it came from
+type ResolvedValue struct {
+	// Key is the profile field in YAML notation (e.g., transfer_options.method)
+	Key string
+
+	// Value is the effective value, formatted for display
+	Value string
+
+	// Source is where the value came from
+	Source ValueSource
+}
+
+// ResolveProfile returns a copy of the named profile with global settings
+// and built-in defaults applied, along with the source of each value.
+// Precedence, highest first: profile, settings, built-in default.
+func (c *Config) ResolveProfile(name string) (*Profile, []ResolvedValue, error) {
+	original, err := c.GetProfile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile := original.Clone()
+	defaults := DefaultSettings()
+	var values []ResolvedValue
+
+	add := func(key string, value interface{}, source ValueSource) {
+		values = append(values, ResolvedValue{Key: key, Value: fmt.Sprint(value), Source: source})
+	}
+
+	add("remote_user", profile.RemoteUser, SourceProfile)
+	add("remote_host", profile.RemoteHost, SourceProfile)
+	if len(profile.Hosts) > 0 {
+		add("hosts", strings.Join(profile.Hosts, ", "), SourceProfile)
+	}
+
+	switch {
+	case profile.SSHPort != 0:
+		add("ssh_port", profile.SSHPort, SourceProfile)
+	default:
+		profile.SSHPort = 22
+		add("ssh_port", profile.SSHPort, SourceDefault)
+	}
+
+	switch {
+	case profile.Backend != "":
+		add("backend", profile.Backend, SourceProfile)
+	case c.Settings.DefaultBackend != "":
+		profile.Backend = BackendType(c.Settings.DefaultBackend)
+		add("backend", profile.Backend, SourceSettings)
+	default:
+		profile.Backend = BackendType(defaults.DefaultBackend)
+		add("backend", profile.Backend, SourceDefault)
+	}
+
+	if profile.SSHKeyPath != "" {
+		add("ssh_key_path", profile.SSHKeyPath, SourceProfile)
+	} else {
+		add("ssh_key_path", "(default keys)", SourceDefault)
+	}
+	add("use_password", profile.UsePassword, sourceIf(profile.UsePassword))
+	add("host_key_fingerprint", profile.HostKeyFingerprint, sourceIf(profile.HostKeyFingerprint != ""))
+	add("require_encrypted_path", profile.RequireEncryptedPath, sourceIf(profile.RequireEncryptedPath))
+	add("allowed_cidrs", strings.Join(profile.AllowedCIDRs, ", "), sourceIf(len(profile.AllowedCIDRs) > 0))
+	switch {
+	case profile.MetricsListen != "":
+		add("metrics_listen", profile.MetricsListen, SourceProfile)
+	case c.Settings.Metrics.Listen != "":
+		add("metrics_listen", c.Settings.Metrics.Listen, SourceSettings)
+	default:
+		add("metrics_listen", "", SourceDefault)
+	}
+
+	opts := &profile.TransferOptions
+
+	switch {
+	case opts.Method != "":
+		add("transfer_options.method", opts.Method, SourceProfile)
+	case c.Settings.TransferMethod != "":
+		opts.Method = c.Settings.TransferMethod
+		add("transfer_options.method", opts.Method, SourceSettings)
+	default:
+		opts.Method = defaults.TransferMethod
+		add("transfer_options.method", opts.Method, SourceDefault)
+	}
+
+	// compression_level is omitted from YAML when 0, so 0 means unset
+	if opts.CompressionLevel != 0 {
+		add("transfer_options.compression_level", opts.CompressionLevel, SourceProfile)
+	} else {
+		opts.CompressionLevel = c.Settings.CompressionLevel
+		add("transfer_options.compression_level", opts.CompressionLevel, SourceSettings)
+	}
+
+	add("transfer_options.bandwidth_limit", opts.BandwidthLimit, sourceIf(opts.BandwidthLimit != 0))
+	add("transfer_options.preserve_permissions", opts.PreservePermissions, sourceIf(opts.PreservePermissions))
+	add("transfer_options.preserve_xattrs", opts.PreserveXattrs, sourceIf(opts.PreserveXattrs))
+	add("transfer_options.preserve_hard_links", opts.PreserveHardLinks, sourceIf(opts.PreserveHardLinks))
+	add("transfer_options.sparse", opts.Sparse, sourceIf(opts.Sparse))
+	add("transfer_options.delete_after_transfer", opts.DeleteAfterTransfer, sourceIf(opts.DeleteAfterTransfer))
+	add("transfer_options.no_atomic", opts.NoAtomic, sourceIf(opts.NoAtomic))
+	add("transfer_options.no_resume", opts.NoResume, sourceIf(opts.NoResume))
+	add("transfer_options.verify_resume", opts.VerifyResume, sourceIf(opts.VerifyResume))
+	add("transfer_options.verify", opts.Verify, sourceIf(opts.Verify))
+	add("transfer_options.concurrency", opts.Concurrency, sourceIf(opts.Concurrency != 0))
+	add("transfer_options.low_memory", opts.LowMemory, sourceIf(opts.LowMemory))
+	add("transfer_options.segments", opts.Segments, sourceIf(opts.Segments != 0))
+	add("transfer_options.dedup", opts.Dedup, sourceIf(opts.Dedup))
+	add("transfer_options.staging_dir", opts.StagingDir, sourceIf(opts.StagingDir != ""))
+	add("transfer_options.chown", opts.Chown, sourceIf(opts.Chown != ""))
+	add("transfer_options.chmod", opts.Chmod, sourceIf(opts.Chmod != ""))
+	add("transfer_options.strict_method", opts.StrictMethod, sourceIf(opts.StrictMethod))
+	add("transfer_options.exclude_patterns", strings.Join(opts.ExcludePatterns, ", "), sourceIf(len(opts.ExcludePatterns) > 0))
+	add("transfer_options.include_patterns", strings.Join(opts.IncludePatterns, ", "), sourceIf(len(opts.IncludePatterns) > 0))
+	add("transfer_options.exclude_presets", strings.Join(opts.ExcludePresets, ", "), sourceIf(len(opts.ExcludePresets) > 0))
+	add("transfer_options.rsync_path", opts.RsyncPath, sourceIf(opts.RsyncPath != ""))
+	add("transfer_options.extra_rsync_args", strings.Join(opts.ExtraRsyncArgs, " "), sourceIf(len(opts.ExtraRsyncArgs) > 0))
+	add("transfer_options.max_files", opts.MaxFiles, sourceIf(opts.MaxFiles != 0))
+	add("transfer_options.max_total_size", opts.MaxTotalSize, sourceIf(opts.MaxTotalSize != ""))
+	add("transfer_options.pre_upload_scan", strings.Join(opts.PreUploadScan, " "), sourceIf(len(opts.PreUploadScan) > 0))
+
+	return profile, values, nil
+}
+
+// sourceIf returns SourceProfile for values set in the profile and
+// SourceDefault for unset (zero) values
+func sourceIf(set bool) ValueSource {
+	if set {
+		return SourceProfile
+	}
+	return SourceDefault
+}
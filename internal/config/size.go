@@ -0,0 +1,46 @@
+// Package config - Size values
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps size suffixes to multipliers (binary units)
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+	"T":  1 << 40,
+	"TB": 1 << 40,
+}
+
+// ParseSize parses a size such as "500M", "10GB" or "1048576"
+// Units are binary (1K = 1024 bytes) and case-insensitive
+func ParseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(value)
+	}
+
+	number, unit := value[:i], strings.TrimSpace(value[i:])
+	multiplier, ok := sizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size '%s' (use e.g. 500M or 10G)", s)
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s' (use e.g. 500M or 10G)", s)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
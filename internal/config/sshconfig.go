@@ -0,0 +1,219 @@
+// Package config - OpenSSH client configuration export
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markers delimiting the part of an ssh_config file that klip manages
+const (
+	SSHConfigBlockBegin = "# BEGIN klip managed block - changes here are overwritten by klip profile export-ssh-config"
+	SSHConfigBlockEnd   = "# END klip managed block"
+)
+
+// SSHConfigHost is an ssh_config Host entry equivalent to a profile
+type SSHConfigHost struct {
+	// Alias is the name given to ssh, the profile name
+	Alias string
+
+	HostName           string
+	User               string
+	Port               int
+	IdentityFiles      []string
+	PKCS11Provider     string
+	ProxyJump          string
+	UserKnownHostsFile string
+
+	// GlobalKnownHostsFile replaces the system known_hosts, e.g. with
+	// /dev/null for a file trusting only a pinned key
+	GlobalKnownHostsFile string
+
+	// Comment is written above the entry, e.g. the profile description
+	Comment string
+
+	// Notes are written as further comment lines above the entry
+	Notes []string
+}
+
+// SSHConfigHost returns the ssh_config entry for the profile with its
+// remote host and jump hosts as configured
+func (p *Profile) SSHConfigHost() SSHConfigHost {
+	host := SSHConfigHost{
+		Alias:     p.Name,
+		HostName:  p.RemoteHost,
+		User:      p.RemoteUser,
+		Port:      p.SSHPort,
+		ProxyJump: p.JumpSpec(),
+		Comment:   p.Description,
+	}
+	if !p.UsePassword {
+		if p.SSHKeyPath != "" {
+			host.IdentityFiles = []string{p.SSHKeyPath}
+		}
+		if p.PKCS11Provider != "agent" {
+			host.PKCS11Provider = p.PKCS11Provider
+		}
+	}
+	return host
+}
+
+// String returns the entry in ssh_config syntax
+func (h SSHConfigHost) String() string {
+	var b strings.Builder
+	if h.Comment != "" {
+		fmt.Fprintf(&b, "# %s\n", strings.ReplaceAll(h.Comment, "\n", " "))
+	}
+	for _, note := range h.Notes {
+		fmt.Fprintf(&b, "# %s\n", strings.ReplaceAll(note, "\n", " "))
+	}
+	fmt.Fprintf(&b, "Host %s\n", h.Alias)
+	option := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "    %s %s\n", name, sshConfigQuote(value))
+		}
+	}
+	option("HostName", h.HostName)
+	option("User", h.User)
+	if h.Port != 0 && h.Port != 22 {
+		option("Port", fmt.Sprintf("%d", h.Port))
+	}
+	for _, path := range h.IdentityFiles {
+		option("IdentityFile", path)
+	}
+	option("PKCS11Provider", h.PKCS11Provider)
+	if len(h.IdentityFiles) > 0 || h.PKCS11Provider != "" {
+		option("IdentitiesOnly", "yes")
+	}
+	option("ProxyJump", h.ProxyJump)
+	option("UserKnownHostsFile", h.UserKnownHostsFile)
+	option("GlobalKnownHostsFile", h.GlobalKnownHostsFile)
+	return b.String()
+}
+
+// sshConfigQuote double-quotes values containing whitespace, the only
+// quoting ssh_config understands
+func sshConfigQuote(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// SSHConfigBlock returns the content of the klip managed block of the
+// ssh_config content, empty if there is none
+func SSHConfigBlock(content string) string {
+	begin := strings.Index(content, SSHConfigBlockBegin+"\n")
+	if begin < 0 {
+		return ""
+	}
+	start := begin + len(SSHConfigBlockBegin) + 1
+	end := strings.Index(content[start:], SSHConfigBlockEnd+"\n")
+	if end < 0 {
+		return ""
+	}
+	return content[start : start+end]
+}
+
+// MergeSSHConfigBlock returns the managed block content block with the
+// Host entries in entries, keyed by alias: an entry for an alias already
+// in block replaces it in place, an empty one removes it, and the others
+// are appended in the order of aliases. Each entry keeps the comments
+// above its Host line; lines before the first Host line are dropped.
+func MergeSSHConfigBlock(block string, aliases []string, entries map[string]string) string {
+	var order []string
+	existing := make(map[string]string)
+	var current, pending []string
+	alias := ""
+	flush := func() {
+		if alias != "" {
+			if _, seen := existing[alias]; !seen {
+				order = append(order, alias)
+			}
+			existing[alias] = strings.Join(current, "\n") + "\n"
+		}
+		current, alias = nil, ""
+	}
+	for _, line := range strings.Split(block, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			pending = append(pending, line)
+		case strings.HasPrefix(trimmed, "Host ") || strings.HasPrefix(trimmed, "Host\t"):
+			flush()
+			alias = strings.TrimSpace(trimmed[len("Host"):])
+			current = append(pending, line)
+			pending = nil
+		case alias != "":
+			current = append(append(current, pending...), line)
+			pending = nil
+		default:
+			pending = nil
+		}
+	}
+	flush()
+
+	for _, name := range aliases {
+		if _, seen := existing[name]; !seen {
+			order = append(order, name)
+		}
+	}
+	var merged []string
+	for _, name := range order {
+		entry, ok := entries[name]
+		if !ok {
+			entry = existing[name]
+		}
+		if entry != "" {
+			merged = append(merged, entry)
+		}
+	}
+	return strings.Join(merged, "\n")
+}
+
+// ReplaceSSHConfigBlock returns the ssh_config content with the klip
+// managed block replaced by block. If atTop is set, or there was no block,
+// it goes at the start (needed for Include, which must come before any Host
+// entry) or at the end respectively; otherwise it stays where it was. An
+// empty block removes the managed block. Everything outside the markers is
+// kept as is.
+func ReplaceSSHConfigBlock(content, block string, atTop bool) string {
+	managed := ""
+	if block != "" {
+		managed = SSHConfigBlockBegin + "\n" + strings.TrimRight(block, "\n") + "\n" + SSHConfigBlockEnd + "\n"
+	}
+
+	// A begin marker without an end marker is left alone
+	begin := strings.Index(content, SSHConfigBlockBegin+"\n")
+	end := -1
+	if begin >= 0 {
+		if i := strings.Index(content[begin:], SSHConfigBlockEnd+"\n"); i >= 0 {
+			end = begin + i + len(SSHConfigBlockEnd) + 1
+		}
+	}
+	if end >= 0 {
+		if !atTop && managed != "" {
+			return content[:begin] + managed + content[end:]
+		}
+		// Drop the blank line that separated the block
+		before := content[:begin]
+		if strings.HasSuffix(before, "\n\n") {
+			before = before[:len(before)-1]
+		}
+		content = before + content[end:]
+	}
+
+	switch {
+	case managed == "":
+		return content
+	case content == "":
+		return managed
+	case atTop:
+		return managed + "\n" + strings.TrimLeft(content, "\n")
+	case !strings.HasSuffix(content, "\n"):
+		content += "\n"
+	}
+	return content + "\n" + managed
+}
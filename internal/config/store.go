@@ -0,0 +1,427 @@
+// Package config - Remote configuration stores
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// StoreEnv names the remote store holding the configuration
+	StoreEnv = "KLIP_CONFIG_STORE"
+
+	// StoreModeEnv selects whether the remote store is written back to
+	StoreModeEnv = "KLIP_CONFIG_STORE_MODE"
+
+	// StoreTTLEnv is how long a fetched configuration is used before the
+	// store is asked again
+	StoreTTLEnv = "KLIP_CONFIG_STORE_TTL"
+
+	// StoreReadOnly never writes the configuration back to the store
+	StoreReadOnly = "ro"
+
+	// StoreReadWrite saves configuration changes to the store
+	StoreReadWrite = "rw"
+
+	// DefaultStoreTTL is how long a fetched configuration is used by default
+	DefaultStoreTTL = 15 * time.Minute
+
+	// StoreCacheDirName is the directory under the cache directory holding
+	// the last configuration fetched from each store
+	StoreCacheDirName = "config-store"
+
+	// storeTimeout bounds each request to a store
+	storeTimeout = 10 * time.Second
+)
+
+var (
+	// ErrStoreNotFound reports that the store holds no configuration yet
+	ErrStoreNotFound = errors.New("no configuration in store")
+
+	// ErrStoreConflict reports that the configuration in the store changed
+	// since the version a write was based on
+	ErrStoreConflict = errors.New("configuration in store was changed by someone else")
+)
+
+// storeProfileFields are the profile fields a store may set, those of team
+// bundles and the transfer options in storeTransferOptions
+var storeProfileFields = func() map[string]bool {
+	fields := map[string]bool{"transfer_options": true}
+	for field := range teamProfileFields {
+		fields[field] = true
+	}
+	return fields
+}()
+
+// storeTransferOptions are the transfer options a store may set. Options
+// that run commands, delete or chown files or name local paths are left
+// to the local configuration.
+var storeTransferOptions = map[string]bool{
+	"method":               true,
+	"compression_level":    true,
+	"exclude_patterns":     true,
+	"include_patterns":     true,
+	"exclude_presets":      true,
+	"bandwidth_limit":      true,
+	"preserve_permissions": true,
+	"preserve_xattrs":      true,
+	"preserve_hard_links":  true,
+	"sparse":               true,
+	"no_atomic":            true,
+	"no_resume":            true,
+	"verify_resume":        true,
+	"verify":               true,
+	"concurrency":          true,
+	"low_memory":           true,
+	"segments":             true,
+	"dedup":                true,
+	"chmod":                true,
+	"strict_method":        true,
+	"max_files":            true,
+	"max_total_size":       true,
+}
+
+// Store is a remote key-value store holding a fleet's profiles, so they
+// can be managed centrally
+type Store interface {
+	// Get returns the configuration and its version, or ErrStoreNotFound
+	Get(ctx context.Context) ([]byte, string, error)
+
+	// Put replaces the configuration if the store still holds version, or
+	// creates it if version is empty and there is none yet; otherwise it
+	// fails with ErrStoreConflict
+	Put(ctx context.Context, data []byte, version string) error
+
+	// String describes the store in messages, without credentials
+	String() string
+}
+
+// The remote store, set from the environment and overridden by the
+// --config-store flags. An empty StoreURL uses the local config file.
+var (
+	StoreURL  = os.Getenv(StoreEnv)
+	StoreMode = envOr(StoreModeEnv, StoreReadOnly)
+	StoreTTL  = envDuration(StoreTTLEnv, DefaultStoreTTL)
+)
+
+// envOr returns the environment variable name, or fallback if it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envDuration parses the environment variable name as a duration, or
+// returns fallback if it is unset or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return d
+	}
+	return fallback
+}
+
+// OpenStore returns the store at rawURL: consul+https://host:port/key,
+// etcd+https://host:port/key, s3://bucket/key or an https:// URL. Plain
+// http://, consul:// and etcd:// are only accepted for stores on this
+// machine, such as a local Consul agent.
+func OpenStore(rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config store URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "consul", "etcd":
+		if err := requireLoopback(u); err != nil {
+			return nil, err
+		}
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return newHTTPStore(u), nil
+	case "consul", "consul+https":
+		return newConsulStore(u)
+	case "etcd", "etcd+https":
+		return newEtcdStore(u)
+	case "s3":
+		return newS3Store(u)
+	default:
+		return nil, fmt.Errorf("unsupported config store '%s', must be consul, etcd, s3, http or https", u.Scheme)
+	}
+}
+
+// requireLoopback rejects a store reached without TLS unless it is on this
+// machine, since its profiles decide which hosts klip trusts
+func requireLoopback(u *url.URL) error {
+	if isLoopbackHost(u.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("config store %s must use TLS (https://, consul+https:// or etcd+https://); plain HTTP is only allowed to localhost", u.Redacted())
+}
+
+// isLoopbackHost reports whether host names this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// storeDocument is the configuration a store holds: profiles, limited to
+// storeProfileFields
+type storeDocument struct {
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// parseStoreDocument parses the configuration of a store, rejecting
+// anything but profiles and profile fields a store may not set
+func parseStoreDocument(data []byte) (*storeDocument, error) {
+	doc := &storeDocument{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(doc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("config stores may only hold profiles: %w", err)
+	}
+	if doc.Profiles == nil {
+		doc.Profiles = make(map[string]*Profile)
+	}
+	if err := checkProfileFields(data, storeProfileFields, storeTransferOptions, "store", "config stores"); err != nil {
+		return nil, err
+	}
+	for name, profile := range doc.Profiles {
+		if profile == nil {
+			return nil, fmt.Errorf("profile '%s' in store is empty", name)
+		}
+		if err := checkJumpKeys(name, profile, "store", "config stores"); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// storeCachePath returns the local copy of the configuration fetched from
+// the store at rawURL
+func storeCachePath(rawURL string) (string, error) {
+	dir := filepath.Join(xdg.CacheHome, AppName, StoreCacheDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".yaml"), nil
+}
+
+// loadFromStore adds the profiles of the store at StoreURL to the local
+// configuration; local profiles of the same name take precedence. A copy
+// fetched less than StoreTTL ago is used without asking the store; if the
+// store cannot be reached an older copy is used and the error kept in
+// StoreError.
+func (c *Config) loadFromStore() error {
+	if StoreMode != StoreReadOnly && StoreMode != StoreReadWrite {
+		return fmt.Errorf("invalid config store mode '%s', must be '%s' or '%s'", StoreMode, StoreReadOnly, StoreReadWrite)
+	}
+	store, err := OpenStore(StoreURL)
+	if err != nil {
+		return err
+	}
+	cachePath, err := storeCachePath(StoreURL)
+	if err != nil {
+		return err
+	}
+
+	data, fresh := readFresh(cachePath, StoreTTL)
+	if !fresh {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancel()
+
+		fetched, _, err := store.Get(ctx)
+		switch {
+		case err == nil:
+			data = fetched
+			if err := os.WriteFile(cachePath, data, 0600); err != nil {
+				return fmt.Errorf("failed to cache configuration: %w", err)
+			}
+		case errors.Is(err, ErrStoreNotFound):
+			data = nil
+			os.Remove(cachePath)
+		case data != nil:
+			c.storeErr = fmt.Errorf("failed to fetch configuration from %s: %w", store, err)
+		default:
+			return fmt.Errorf("failed to fetch configuration from %s: %w", store, err)
+		}
+	}
+
+	// The store's profiles are parsed twice, so the document as loaded is
+	// kept apart from the profiles commands change
+	doc, err := parseStoreDocument(data)
+	if err != nil {
+		return fmt.Errorf("invalid configuration in %s: %w", store, err)
+	}
+	profiles, err := parseStoreDocument(data)
+	if err != nil {
+		return err
+	}
+
+	c.store = store
+	c.storeCache = cachePath
+	c.storeDoc = doc
+	c.storeProfiles = make(map[string]bool)
+	for name, profile := range profiles.Profiles {
+		if _, ok := c.Profiles[name]; ok {
+			continue
+		}
+		c.Profiles[name] = profile
+		c.storeProfiles[name] = true
+	}
+	return nil
+}
+
+// readFresh returns the file at path and whether it was written less than
+// ttl ago; data is nil if the file cannot be read
+func readFresh(path string, ttl time.Duration) (data []byte, fresh bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, time.Since(info.ModTime()) < ttl
+}
+
+// storeChanges returns the store's configuration with the changes made to
+// its profiles, and whether there are any
+func (c *Config) storeChanges() (*storeDocument, bool, error) {
+	doc := &storeDocument{Profiles: make(map[string]*Profile)}
+	for name, profile := range c.storeDoc.Profiles {
+		doc.Profiles[name] = profile
+	}
+	for name := range c.storeProfiles {
+		if profile, ok := c.Profiles[name]; ok {
+			doc.Profiles[name] = profile
+		} else {
+			delete(doc.Profiles, name)
+		}
+	}
+
+	before, err := yaml.Marshal(c.storeDoc)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	after, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return doc, !bytes.Equal(before, after), nil
+}
+
+// saveToStore writes changes to the store's profiles back to the store and
+// its local copy. The write only succeeds if nobody else changed the store
+// since it was loaded, and is refused in read-only mode.
+func (c *Config) saveToStore() error {
+	doc, changed, err := c.storeChanges()
+	if err != nil || !changed {
+		return err
+	}
+	if StoreMode != StoreReadWrite {
+		return fmt.Errorf("profiles from %s are read-only (set %s=%s to write them back)", c.store, StoreModeEnv, StoreReadWrite)
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if _, err := parseStoreDocument(data); err != nil {
+		return fmt.Errorf("cannot save to %s: %w", c.store, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	current, version, err := c.store.Get(ctx)
+	switch {
+	case errors.Is(err, ErrStoreNotFound):
+		current, version = nil, ""
+	case err != nil:
+		return fmt.Errorf("failed to fetch configuration from %s: %w", c.store, err)
+	case version == "":
+		return fmt.Errorf("%s does not report versions of the configuration, so changes cannot be saved safely", c.store)
+	}
+	if err := c.checkUnchanged(current); err != nil {
+		return err
+	}
+	if err := c.store.Put(ctx, data, version); err != nil {
+		if errors.Is(err, ErrStoreConflict) {
+			return fmt.Errorf("failed to save configuration to %s: %w, run the command again", c.store, err)
+		}
+		return fmt.Errorf("failed to save configuration to %s: %w", c.store, err)
+	}
+
+	if err := os.WriteFile(c.storeCache, data, 0600); err != nil {
+		return fmt.Errorf("failed to cache configuration: %w", err)
+	}
+	c.storeDoc, err = parseStoreDocument(data)
+	return err
+}
+
+// checkUnchanged fails with ErrStoreConflict if the store's configuration,
+// current, is not what the configuration was loaded from
+func (c *Config) checkUnchanged(current []byte) error {
+	doc, err := parseStoreDocument(current)
+	if err != nil {
+		return fmt.Errorf("invalid configuration in %s: %w", c.store, err)
+	}
+	loaded, err := yaml.Marshal(c.storeDoc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	stored, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if !bytes.Equal(loaded, stored) {
+		return fmt.Errorf("failed to save configuration to %s: %w since it was loaded, run the command again", c.store, ErrStoreConflict)
+	}
+	return nil
+}
+
+// withoutStoreProfiles returns the configuration to save locally: all of
+// it but the store's profiles
+func (c *Config) withoutStoreProfiles() *Config {
+	local := *c
+	local.Profiles = make(map[string]*Profile)
+	for name, profile := range c.Profiles {
+		if !c.storeProfiles[name] {
+			local.Profiles[name] = profile
+		}
+	}
+	return &local
+}
+
+// Store returns the remote store the configuration was loaded from, or nil
+// for the local config file
+func (c *Config) Store() Store {
+	return c.store
+}
+
+// StoreError returns why the store could not be reached when an older
+// local copy of its configuration is in use, or nil
+func (c *Config) StoreError() error {
+	return c.storeErr
+}
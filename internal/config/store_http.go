@@ -0,0 +1,309 @@
+// Package config - HTTP, Consul and etcd configuration stores
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// StoreTokenEnv is sent as a bearer token to http(s) stores
+	StoreTokenEnv = "KLIP_CONFIG_STORE_TOKEN"
+
+	// ConsulTokenEnv is the ACL token sent to Consul
+	ConsulTokenEnv = "CONSUL_HTTP_TOKEN"
+
+	// maxStoreSize bounds the configuration read from a store
+	maxStoreSize = 16 << 20
+)
+
+// storeRequest sends an HTTP request to a store and returns the response
+// body of a 2xx response, or ErrStoreNotFound for a 404
+func storeRequest(ctx context.Context, method, target string, body []byte, header http.Header) ([]byte, error) {
+	data, _, err := storeExchange(ctx, method, target, body, header)
+	return data, err
+}
+
+// storeExchange is storeRequest returning the response headers too. A
+// failed precondition is reported as ErrStoreConflict.
+func storeExchange(ctx context.Context, method, target string, body []byte, header http.Header) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxStoreSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil, ErrStoreNotFound
+	case resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict:
+		return nil, nil, ErrStoreConflict
+	case resp.StatusCode/100 != 2:
+		return nil, nil, fmt.Errorf("%s %s: %s", method, req.URL.Redacted(), strings.TrimSpace(resp.Status+" "+firstLine(data)))
+	}
+	return data, resp.Header, nil
+}
+
+// setPrecondition makes a PUT to an HTTP store only succeed if the object
+// still has the ETag version, or does not exist yet if version is empty
+func setPrecondition(header http.Header, version string) {
+	if version == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", version)
+	}
+}
+
+// firstLine returns the first line of an error response
+func firstLine(data []byte) string {
+	line, _, _ := strings.Cut(string(data), "\n")
+	return line
+}
+
+// httpStore keeps the configuration at a URL, read with GET and written
+// with a conditional PUT on its ETag, like a WebDAV share or object store
+// with presigned URLs
+type httpStore struct {
+	url *url.URL
+}
+
+func newHTTPStore(u *url.URL) *httpStore {
+	return &httpStore{url: u}
+}
+
+func (s *httpStore) header() http.Header {
+	header := http.Header{}
+	if token := os.Getenv(StoreTokenEnv); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header
+}
+
+func (s *httpStore) Get(ctx context.Context) ([]byte, string, error) {
+	data, header, err := storeExchange(ctx, http.MethodGet, s.url.String(), nil, s.header())
+	if err != nil {
+		return nil, "", err
+	}
+	return data, header.Get("ETag"), nil
+}
+
+func (s *httpStore) Put(ctx context.Context, data []byte, version string) error {
+	header := s.header()
+	setPrecondition(header, version)
+	_, err := storeRequest(ctx, http.MethodPut, s.url.String(), data, header)
+	return err
+}
+
+func (s *httpStore) String() string {
+	return s.url.Redacted()
+}
+
+// consulStore keeps the configuration under a key of Consul's KV store,
+// written with check-and-set on the key's ModifyIndex
+type consulStore struct {
+	endpoint *url.URL
+	key      string
+}
+
+func newConsulStore(u *url.URL) (*consulStore, error) {
+	key := strings.Trim(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid config store URL '%s', expected consul://host:port/key", u.Redacted())
+	}
+
+	endpoint := &url.URL{Scheme: "http", Host: u.Host, Path: "/v1/kv/" + key, RawQuery: u.RawQuery}
+	if u.Scheme == "consul+https" {
+		endpoint.Scheme = "https"
+	}
+	return &consulStore{endpoint: endpoint, key: key}, nil
+}
+
+func (s *consulStore) header() http.Header {
+	header := http.Header{}
+	if token := os.Getenv(ConsulTokenEnv); token != "" {
+		header.Set("X-Consul-Token", token)
+	}
+	return header
+}
+
+func (s *consulStore) Get(ctx context.Context) ([]byte, string, error) {
+	data, err := storeRequest(ctx, http.MethodGet, s.endpoint.String(), nil, s.header())
+	if err != nil {
+		return nil, "", err
+	}
+	// The value is base64 encoded, which encoding/json decodes for []byte
+	var entries []struct {
+		ModifyIndex uint64 `json:"ModifyIndex"`
+		Value       []byte `json:"Value"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, "", fmt.Errorf("invalid Consul response: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, "", ErrStoreNotFound
+	}
+	return entries[0].Value, strconv.FormatUint(entries[0].ModifyIndex, 10), nil
+}
+
+func (s *consulStore) Put(ctx context.Context, data []byte, version string) error {
+	// cas=0 only creates the key
+	if version == "" {
+		version = "0"
+	}
+	endpoint := *s.endpoint
+	query := endpoint.Query()
+	query.Set("cas", version)
+	endpoint.RawQuery = query.Encode()
+
+	response, err := storeRequest(ctx, http.MethodPut, endpoint.String(), data, s.header())
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(response)) != "true" {
+		return ErrStoreConflict
+	}
+	return nil
+}
+
+func (s *consulStore) String() string {
+	return "consul key " + s.key + " on " + s.endpoint.Host
+}
+
+// etcdStore keeps the configuration under a key of etcd, through the JSON
+// gateway of its v3 API, written in a transaction comparing the key's
+// mod_revision
+type etcdStore struct {
+	endpoint *url.URL
+	key      string
+
+	// user and password authenticate against etcd's auth API if set
+	user, password string
+}
+
+func newEtcdStore(u *url.URL) (*etcdStore, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid config store URL '%s', expected etcd://host:port/key", u.Redacted())
+	}
+
+	s := &etcdStore{endpoint: &url.URL{Scheme: "http", Host: u.Host}, key: "/" + key}
+	if u.Scheme == "etcd+https" {
+		s.endpoint.Scheme = "https"
+	}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	return s, nil
+}
+
+// call posts request to an etcd API method and decodes its response
+func (s *etcdStore) call(ctx context.Context, method string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	if s.user != "" && method != "auth/authenticate" {
+		token, err := s.authenticate(ctx)
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", token)
+	}
+
+	data, err := storeRequest(ctx, http.MethodPost, s.endpoint.String()+"/v3/"+method, body, header)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(data, response)
+}
+
+// authenticate returns a token for the store's user
+func (s *etcdStore) authenticate(ctx context.Context) (string, error) {
+	var response struct {
+		Token string `json:"token"`
+	}
+	request := map[string]string{"name": s.user, "password": s.password}
+	if err := s.call(ctx, "auth/authenticate", request, &response); err != nil {
+		return "", fmt.Errorf("etcd authentication failed: %w", err)
+	}
+	return response.Token, nil
+}
+
+func (s *etcdStore) Get(ctx context.Context) ([]byte, string, error) {
+	// The gateway returns 64-bit integers as strings
+	var response struct {
+		Kvs []struct {
+			Value       []byte `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}
+	// The gateway takes and returns keys and values in base64, which
+	// encoding/json produces for []byte
+	request := map[string][]byte{"key": []byte(s.key)}
+	if err := s.call(ctx, "kv/range", request, &response); err != nil {
+		return nil, "", err
+	}
+	if len(response.Kvs) == 0 {
+		return nil, "", ErrStoreNotFound
+	}
+	return response.Kvs[0].Value, response.Kvs[0].ModRevision, nil
+}
+
+func (s *etcdStore) Put(ctx context.Context, data []byte, version string) error {
+	// A key that does not exist has mod_revision 0
+	if version == "" {
+		version = "0"
+	}
+	request := map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"key":          []byte(s.key),
+			"target":       "MOD",
+			"result":       "EQUAL",
+			"mod_revision": version,
+		}},
+		"success": []map[string]interface{}{{
+			"request_put": map[string][]byte{"key": []byte(s.key), "value": data},
+		}},
+	}
+	var response struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := s.call(ctx, "kv/txn", request, &response); err != nil {
+		return err
+	}
+	if !response.Succeeded {
+		return ErrStoreConflict
+	}
+	return nil
+}
+
+func (s *etcdStore) String() string {
+	return "etcd key " + s.key + " on " + s.endpoint.Host
+}
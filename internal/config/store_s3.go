@@ -0,0 +1,168 @@
+// Package config - S3 configuration store
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Store keeps the configuration in an S3 object, or one of an
+// S3-compatible service such as MinIO, signing requests with AWS
+// Signature Version 4 from the standard AWS environment variables and
+// writing with conditional PUTs on the object's ETag
+type s3Store struct {
+	bucket, key string
+
+	// endpoint is the URL of the object
+	endpoint *url.URL
+
+	region                             string
+	accessKey, secretKey, sessionToken string
+}
+
+func newS3Store(u *url.URL) (*s3Store, error) {
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid config store URL '%s', expected s3://bucket/key", u.Redacted())
+	}
+
+	s := &s3Store{
+		bucket:       u.Host,
+		key:          key,
+		region:       envOr("AWS_REGION", envOr("AWS_DEFAULT_REGION", "us-east-1")),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	// A custom endpoint is addressed path-style, AWS itself by virtual host
+	if endpoint := envOr("AWS_ENDPOINT_URL_S3", os.Getenv("AWS_ENDPOINT_URL")); endpoint != "" {
+		base, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+		}
+		if base.Scheme != "https" {
+			if err := requireLoopback(base); err != nil {
+				return nil, err
+			}
+		}
+		s.endpoint = base.JoinPath(s.bucket, key)
+	} else {
+		s.endpoint = &url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com", Path: "/" + key}
+	}
+
+	// The path is sent exactly as it is signed
+	s.endpoint.RawPath = awsEscapePath(s.endpoint.Path)
+	return s, nil
+}
+
+// awsEscapePath percent-encodes every byte of p but unreserved characters
+// and slashes, as AWS signatures expect
+func awsEscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// request sends a signed request for the object with the headers in header
+func (s *s3Store) request(ctx context.Context, method string, body []byte, header http.Header) ([]byte, http.Header, error) {
+	if s.accessKey != "" {
+		s.sign(method, s.endpoint, header, body, time.Now())
+	}
+	return storeExchange(ctx, method, s.endpoint.String(), body, header)
+}
+
+func (s *s3Store) Get(ctx context.Context) ([]byte, string, error) {
+	data, header, err := s.request(ctx, http.MethodGet, nil, http.Header{})
+	if err != nil {
+		return nil, "", err
+	}
+	return data, header.Get("ETag"), nil
+}
+
+func (s *s3Store) Put(ctx context.Context, data []byte, version string) error {
+	header := http.Header{}
+	setPrecondition(header, version)
+	_, _, err := s.request(ctx, http.MethodPut, data, header)
+	return err
+}
+
+func (s *s3Store) String() string {
+	return "s3://" + s.bucket + "/" + s.key
+}
+
+// sign adds the AWS Signature Version 4 authorization of a request for
+// target to header, signing the host and every header already set
+func (s *s3Store) sign(method string, target *url.URL, header http.Header, body []byte, now time.Time) {
+	now = now.UTC()
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+
+	header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if s.sessionToken != "" {
+		header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	// Canonical headers are lowercase, sorted and trimmed
+	values := map[string]string{"host": target.Host}
+	for name, v := range header {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		target.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + header.Get("X-Amz-Date") + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
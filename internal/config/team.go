@@ -0,0 +1,347 @@
+// Package config - Signed team profile bundles
+// Copyright (c) 2025 orpheus497
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// TeamSignatureSuffix is appended to a bundle's URL to fetch its
+	// minisign signature
+	TeamSignatureSuffix = ".minisig"
+
+	// teamSeparator joins a team's name and a bundle profile's name into
+	// the name of the local profile
+	teamSeparator = "."
+)
+
+// teamProfileFields are the profile fields a team bundle may set: where
+// and how to reach the host and the restrictions on using it. Local
+// paths, commands and transfer behaviour stay under the user's control.
+var teamProfileFields = map[string]bool{
+	"name":                   true,
+	"description":            true,
+	"backend":                true,
+	"remote_user":            true,
+	"remote_host":            true,
+	"hosts":                  true,
+	"ssh_port":               true,
+	"host_key_fingerprint":   true,
+	"trust_domain":           true,
+	"access":                 true,
+	"jump_host":              true,
+	"jump_hosts":             true,
+	"allowed_backends":       true,
+	"denied_backends":        true,
+	"require_encrypted_path": true,
+	"allowed_cidrs":          true,
+	"locations":              true,
+}
+
+// Team is a signed bundle of shared profiles pulled with klip team pull
+type Team struct {
+	// URL is where the bundle is fetched from, an http(s) URL or a file
+	URL string `yaml:"url"`
+
+	// Keys are the minisign public keys trusted to sign the bundle
+	Keys []string `yaml:"keys"`
+
+	// Serial is the serial of the last bundle merged; bundles with a
+	// lower serial are rejected as rollbacks
+	Serial int64 `yaml:"serial,omitempty"`
+
+	// Pulled is when the bundle was last merged
+	Pulled time.Time `yaml:"pulled,omitempty"`
+}
+
+// TeamBundle is the YAML document a team publishes
+type TeamBundle struct {
+	// Team is the suggested team name, used when pulled without --name
+	Team string `yaml:"team,omitempty"`
+
+	// Serial must increase with every bundle published
+	Serial int64 `yaml:"serial"`
+
+	// Expires is when the bundle stops being accepted (zero never expires)
+	Expires time.Time `yaml:"expires,omitempty"`
+
+	// Profiles are the team's profiles by name, without the team prefix
+	Profiles map[string]*Profile `yaml:"profiles"`
+
+	// RevokedKeys are key IDs or public keys no longer trusted to sign
+	// the team's bundles
+	RevokedKeys []string `yaml:"revoked_keys,omitempty"`
+}
+
+// TeamMerge lists the local profiles a bundle changed
+type TeamMerge struct {
+	Added   []string `json:"added,omitempty"`
+	Updated []string `json:"updated,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+
+	// RevokedKeys are the key IDs removed from the team's trusted keys
+	RevokedKeys []string `json:"revoked_keys,omitempty"`
+}
+
+// TeamProfileName returns the local name of a team bundle's profile
+func TeamProfileName(team, profile string) string {
+	return team + teamSeparator + profile
+}
+
+// ValidateTeamName checks that a team name is usable as a profile prefix
+func ValidateTeamName(name string) error {
+	if !trustDomainName.MatchString(name) || strings.Contains(name, teamSeparator) {
+		return fmt.Errorf("invalid team name '%s': use letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// FetchTeamBundle returns the bundle at rawURL and its minisign signature,
+// fetched from rawURL + TeamSignatureSuffix. rawURL is an http(s) URL or
+// a local path.
+func FetchTeamBundle(ctx context.Context, rawURL string) (bundle, signature []byte, err error) {
+	u, err := url.Parse(rawURL)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if bundle, err = storeRequest(ctx, http.MethodGet, rawURL, nil, nil); err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch bundle: %w", err)
+		}
+		if signature, err = storeRequest(ctx, http.MethodGet, rawURL+TeamSignatureSuffix, nil, nil); err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch bundle signature: %w", err)
+		}
+		return bundle, signature, nil
+	}
+
+	path := strings.TrimPrefix(rawURL, "file://")
+	if bundle, err = os.ReadFile(path); err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+	if signature, err = os.ReadFile(path + TeamSignatureSuffix); err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle signature: %w", err)
+	}
+	return bundle, signature, nil
+}
+
+// OpenTeamBundle verifies the signature of a bundle against the team's
+// keys and parses it. A bundle signed by a key it revokes is rejected.
+func OpenTeamBundle(team Team, data, signature []byte) (*TeamBundle, error) {
+	keys := make([]*MinisignKey, 0, len(team.Keys))
+	for _, text := range team.Keys {
+		key, err := ParseMinisignKey(text)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys trusted to sign the bundle")
+	}
+
+	key, err := VerifyMinisign(keys, data, signature)
+	if err != nil {
+		return nil, fmt.Errorf("bad bundle signature: %w", err)
+	}
+
+	bundle := &TeamBundle{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %w", err)
+	}
+	if bundle.revokes(key) {
+		return nil, fmt.Errorf("bundle is signed by key %s, which it revokes", key.IDString())
+	}
+	if err := checkProfileFields(data, teamProfileFields, nil, "bundle", "team bundles"); err != nil {
+		return nil, err
+	}
+
+	for name, profile := range bundle.Profiles {
+		if !trustDomainName.MatchString(name) {
+			return nil, fmt.Errorf("invalid profile name '%s' in bundle", name)
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("profile '%s' in bundle is empty", name)
+		}
+		if err := checkJumpKeys(name, profile, "bundle", "team bundles"); err != nil {
+			return nil, err
+		}
+		SanitizeProfile(profile)
+		if err := profile.Validate(); err != nil {
+			return nil, fmt.Errorf("profile '%s' in bundle: %w", name, err)
+		}
+	}
+	return bundle, nil
+}
+
+// checkProfileFields rejects a document from source whose profiles set
+// fields outside allowed, or transfer options outside transferOptions.
+// who names the kind of source in errors.
+func checkProfileFields(data []byte, allowed, transferOptions map[string]bool, source, who string) error {
+	var raw struct {
+		Profiles map[string]map[string]yaml.Node `yaml:"profiles"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	for name, fields := range raw.Profiles {
+		for field, value := range fields {
+			if !allowed[field] {
+				return fmt.Errorf("profile '%s' in %s sets %s, which %s may not set", name, source, field, who)
+			}
+			if field != "transfer_options" {
+				continue
+			}
+			var options map[string]yaml.Node
+			if err := value.Decode(&options); err != nil {
+				return fmt.Errorf("profile '%s' in %s: %w", name, source, err)
+			}
+			for option := range options {
+				if !transferOptions[option] {
+					return fmt.Errorf("profile '%s' in %s sets transfer_options.%s, which %s may not set", name, source, option, who)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkJumpKeys rejects a profile from source that names a key for one of
+// its jump hosts
+func checkJumpKeys(name string, profile *Profile, source, who string) error {
+	jumps := profile.JumpHosts
+	if profile.JumpHost != nil {
+		jumps = append(jumps, *profile.JumpHost)
+	}
+	for _, jump := range jumps {
+		if jump.Key != "" {
+			return fmt.Errorf("profile '%s' in %s sets a jump host key, which %s may not set", name, source, who)
+		}
+	}
+	return nil
+}
+
+// revokes reports whether the bundle revokes key, by key ID or public key
+func (b *TeamBundle) revokes(key *MinisignKey) bool {
+	for _, revoked := range b.RevokedKeys {
+		if strings.EqualFold(revoked, key.IDString()) || revoked == key.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeTeam makes the profiles of a verified bundle the team's profiles,
+// named <team>.<profile>. Profiles the team no longer publishes are
+// removed, and keys the bundle revokes are no longer trusted. Bundles
+// older than the last one merged, and expired bundles, are rejected.
+func (c *Config) MergeTeam(name string, team Team, bundle *TeamBundle) (*TeamMerge, error) {
+	if err := ValidateTeamName(name); err != nil {
+		return nil, err
+	}
+	if bundle.Serial < team.Serial {
+		return nil, fmt.Errorf("bundle serial %d is older than the last one pulled (%d)", bundle.Serial, team.Serial)
+	}
+	if !bundle.Expires.IsZero() && time.Now().After(bundle.Expires) {
+		return nil, fmt.Errorf("bundle expired on %s", bundle.Expires.Format(time.DateTime))
+	}
+
+	for profileName := range bundle.Profiles {
+		local := TeamProfileName(name, profileName)
+		if existing, ok := c.Profiles[local]; ok && existing.Team != name {
+			return nil, fmt.Errorf("profile '%s' already exists and is not part of team '%s'", local, name)
+		}
+	}
+
+	merge := &TeamMerge{}
+	for local, profile := range c.Profiles {
+		if profile.Team != name {
+			continue
+		}
+		if _, ok := bundle.Profiles[strings.TrimPrefix(local, name+teamSeparator)]; !ok {
+			merge.Removed = append(merge.Removed, local)
+		}
+	}
+	for _, local := range merge.Removed {
+		if err := c.DeleteProfile(local); err != nil {
+			return nil, err
+		}
+	}
+
+	for profileName, profile := range bundle.Profiles {
+		local := TeamProfileName(name, profileName)
+		if _, ok := c.Profiles[local]; ok {
+			merge.Updated = append(merge.Updated, local)
+		} else {
+			merge.Added = append(merge.Added, local)
+		}
+		profile.Name = local
+		profile.Team = name
+		if err := c.AddProfile(local, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	var keys []string
+	for _, text := range team.Keys {
+		key, err := ParseMinisignKey(text)
+		if err != nil {
+			return nil, err
+		}
+		if bundle.revokes(key) {
+			merge.RevokedKeys = append(merge.RevokedKeys, key.IDString())
+			continue
+		}
+		keys = append(keys, key.String())
+	}
+
+	team.Keys = keys
+	team.Serial = bundle.Serial
+	team.Pulled = time.Now()
+	if c.Settings.Teams == nil {
+		c.Settings.Teams = make(map[string]Team)
+	}
+	c.Settings.Teams[name] = team
+
+	sort.Strings(merge.Added)
+	sort.Strings(merge.Updated)
+	sort.Strings(merge.Removed)
+	return merge, nil
+}
+
+// RemoveTeam forgets a team and removes its profiles, returning their names
+func (c *Config) RemoveTeam(name string) ([]string, error) {
+	if _, ok := c.Settings.Teams[name]; !ok {
+		return nil, fmt.Errorf("team '%s' not found", name)
+	}
+
+	removed := c.TeamProfiles(name)
+	for _, local := range removed {
+		if err := c.DeleteProfile(local); err != nil {
+			return nil, err
+		}
+	}
+	delete(c.Settings.Teams, name)
+	return removed, nil
+}
+
+// TeamProfiles returns the names of a team's profiles, sorted
+func (c *Config) TeamProfiles(name string) []string {
+	var names []string
+	for local, profile := range c.Profiles {
+		if profile != nil && profile.Team == name {
+			names = append(names, local)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
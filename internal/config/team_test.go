@@ -0,0 +1,243 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisigner signs like minisign with a fresh key
+type minisigner struct {
+	key     *MinisignKey
+	private ed25519.PrivateKey
+}
+
+func newMinisigner(t *testing.T) *minisigner {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key := &MinisignKey{Key: public}
+	_, err = rand.Read(key.ID[:])
+	require.NoError(t, err)
+	return &minisigner{key: key, private: private}
+}
+
+// sign returns a .minisig file for message, pre-hashed if prehash is set
+func (m *minisigner) sign(message []byte, prehash bool) []byte {
+	alg, signed := "Ed", message
+	if prehash {
+		sum := blake2b.Sum512(message)
+		alg, signed = "ED", sum[:]
+	}
+	sig := append([]byte(alg), m.key.ID[:]...)
+	sig = append(sig, ed25519.Sign(m.private, signed)...)
+
+	trusted := "timestamp:1700000000\tfile:bundle.yaml"
+	global := ed25519.Sign(m.private, append(append([]byte(nil), sig[10:]...), trusted...))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(sig) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	signer := newMinisigner(t)
+	other := newMinisigner(t)
+	message := []byte("serial: 1\n")
+
+	for _, prehash := range []bool{false, true} {
+		key, err := VerifyMinisign([]*MinisignKey{other.key, signer.key}, message, signer.sign(message, prehash))
+		require.NoError(t, err)
+		assert.Equal(t, signer.key.IDString(), key.IDString())
+	}
+
+	_, err := VerifyMinisign([]*MinisignKey{other.key}, message, signer.sign(message, false))
+	assert.ErrorIs(t, err, ErrSignatureKey)
+
+	_, err = VerifyMinisign([]*MinisignKey{signer.key}, []byte("serial: 2\n"), signer.sign(message, true))
+	assert.Error(t, err)
+
+	// The trusted comment cannot be changed
+	lines := strings.Split(string(signer.sign(message, false)), "\n")
+	lines[2] = "trusted comment: timestamp:1\tfile:other.yaml"
+	_, err = VerifyMinisign([]*MinisignKey{signer.key}, message, []byte(strings.Join(lines, "\n")))
+	assert.ErrorContains(t, err, "trusted comment")
+}
+
+func TestParseMinisignKey(t *testing.T) {
+	signer := newMinisigner(t)
+	encoded := signer.key.String()
+
+	key, err := ParseMinisignKey(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, signer.key.IDString(), key.IDString())
+
+	path := filepath.Join(t.TempDir(), "team.pub")
+	require.NoError(t, os.WriteFile(path, []byte("untrusted comment: minisign public key "+key.IDString()+"\n"+encoded+"\n"), 0644))
+	key, err = ParseMinisignKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, key.String())
+
+	_, err = ParseMinisignKey("not a key")
+	assert.Error(t, err)
+}
+
+const teamBundle = `team: ops
+serial: 3
+profiles:
+  web:
+    remote_user: deploy
+    remote_host: web.internal
+  db:
+    remote_user: postgres
+    remote_host: db.internal
+    ssh_port: 2222
+    access:
+      - roles: [dba]
+        confirm: [exec]
+      - read_only: true
+`
+
+// pullTeam verifies and merges a bundle as klip team pull does
+func pullTeam(cfg *Config, name string, team Team, data, signature []byte) (*TeamMerge, error) {
+	bundle, err := OpenTeamBundle(team, data, signature)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.MergeTeam(name, team, bundle)
+}
+
+func TestTeamBundle(t *testing.T) {
+	signer := newMinisigner(t)
+	team := Team{URL: "https://example.com/ops.yaml", Keys: []string{signer.key.String()}}
+
+	t.Run("merges profiles into the team namespace", func(t *testing.T) {
+		cfg := NewConfig()
+		require.NoError(t, cfg.AddProfile("web", NewProfile("web", "me", "localweb")))
+
+		merge, err := pullTeam(cfg, "ops", team, []byte(teamBundle), signer.sign([]byte(teamBundle), true))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ops.db", "ops.web"}, merge.Added)
+
+		assert.Equal(t, "localweb", cfg.Profiles["web"].RemoteHost)
+		require.Contains(t, cfg.Profiles, "ops.db")
+		assert.Equal(t, "ops", cfg.Profiles["ops.db"].Team)
+		assert.Equal(t, 2222, cfg.Profiles["ops.db"].SSHPort)
+		assert.Equal(t, AccessDenied, cfg.Profiles["ops.db"].AccessFor(nil, OpPush))
+		assert.Equal(t, AccessConfirm, cfg.Profiles["ops.db"].AccessFor([]string{"dba"}, OpExec))
+		assert.Equal(t, 22, cfg.Profiles["ops.web"].SSHPort)
+		assert.Equal(t, int64(3), cfg.Settings.Teams["ops"].Serial)
+		assert.Equal(t, []string{"ops.db", "ops.web"}, cfg.TeamProfiles("ops"))
+	})
+
+	t.Run("refresh removes profiles no longer published", func(t *testing.T) {
+		cfg := NewConfig()
+		_, err := pullTeam(cfg, "ops", team, []byte(teamBundle), signer.sign([]byte(teamBundle), false))
+		require.NoError(t, err)
+
+		next := "serial: 4\nprofiles:\n  web:\n    remote_user: deploy\n    remote_host: web2.internal\n"
+		merge, err := pullTeam(cfg, "ops", cfg.Settings.Teams["ops"], []byte(next), signer.sign([]byte(next), false))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ops.web"}, merge.Updated)
+		assert.Equal(t, []string{"ops.db"}, merge.Removed)
+		assert.NotContains(t, cfg.Profiles, "ops.db")
+		assert.Equal(t, "web2.internal", cfg.Profiles["ops.web"].RemoteHost)
+	})
+
+	t.Run("rejects rollbacks", func(t *testing.T) {
+		cfg := NewConfig()
+		old := team
+		old.Serial = 5
+		_, err := pullTeam(cfg, "ops", old, []byte(teamBundle), signer.sign([]byte(teamBundle), false))
+		assert.ErrorContains(t, err, "older")
+	})
+
+	t.Run("rejects expired bundles", func(t *testing.T) {
+		expired := teamBundle + "expires: 2020-01-01T00:00:00Z\n"
+		_, err := pullTeam(NewConfig(), "ops", team, []byte(expired), signer.sign([]byte(expired), false))
+		assert.ErrorContains(t, err, "expired")
+	})
+
+	t.Run("rejects bundles signed by other keys", func(t *testing.T) {
+		forger := newMinisigner(t)
+		_, err := pullTeam(NewConfig(), "ops", team, []byte(teamBundle), forger.sign([]byte(teamBundle), false))
+		assert.ErrorIs(t, err, ErrSignatureKey)
+	})
+
+	t.Run("does not replace local profiles", func(t *testing.T) {
+		cfg := NewConfig()
+		require.NoError(t, cfg.AddProfile("ops.web", NewProfile("ops.web", "me", "mine")))
+		_, err := pullTeam(cfg, "ops", team, []byte(teamBundle), signer.sign([]byte(teamBundle), false))
+		assert.ErrorContains(t, err, "not part of team")
+	})
+
+	t.Run("revokes keys", func(t *testing.T) {
+		successor := newMinisigner(t)
+		both := team
+		both.Keys = []string{signer.key.String(), successor.key.String()}
+
+		revoking := teamBundle + "revoked_keys:\n  - " + signer.key.IDString() + "\n"
+		_, err := pullTeam(NewConfig(), "ops", both, []byte(revoking), signer.sign([]byte(revoking), false))
+		assert.ErrorContains(t, err, "revokes")
+
+		cfg := NewConfig()
+		merge, err := pullTeam(cfg, "ops", both, []byte(revoking), successor.sign([]byte(revoking), false))
+		require.NoError(t, err)
+		assert.Equal(t, []string{signer.key.IDString()}, merge.RevokedKeys)
+		assert.Equal(t, []string{successor.key.String()}, cfg.Settings.Teams["ops"].Keys)
+	})
+
+	t.Run("rejects fields outside the allowlist", func(t *testing.T) {
+		for _, field := range []string{
+			"ssh_key_path: /tmp/key",
+			"pkcs11_provider: /tmp/evil.so",
+			"remote_forwards: [\"8080:localhost:80\"]",
+			"transfer_options:\n      pre_upload_scan: [sh, -c, id]",
+			"transfer_options:\n      delete_after_transfer: true",
+			"jump_host:\n      host: bastion\n      key: /tmp/key",
+		} {
+			bundle := "serial: 1\nprofiles:\n  web:\n    remote_host: web.internal\n    " + field + "\n"
+			_, err := pullTeam(NewConfig(), "ops", team, []byte(bundle), signer.sign([]byte(bundle), false))
+			assert.ErrorContains(t, err, "team bundles may not set", field)
+		}
+
+		allowed := "serial: 1\nprofiles:\n  web:\n    remote_user: deploy\n    remote_host: web.internal\n    host_key_fingerprint: SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s\n    jump_hosts:\n      - host: bastion\n        port: 2222\n"
+		_, err := pullTeam(NewConfig(), "ops", team, []byte(allowed), signer.sign([]byte(allowed), false))
+		assert.NoError(t, err)
+	})
+
+	t.Run("remove forgets the team and its profiles", func(t *testing.T) {
+		cfg := NewConfig()
+		_, err := pullTeam(cfg, "ops", team, []byte(teamBundle), signer.sign([]byte(teamBundle), false))
+		require.NoError(t, err)
+
+		removed, err := cfg.RemoveTeam("ops")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ops.db", "ops.web"}, removed)
+		assert.Empty(t, cfg.Profiles)
+		assert.NotContains(t, cfg.Settings.Teams, "ops")
+	})
+}
+
+func TestFetchTeamBundle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ops.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(teamBundle), 0644))
+
+	_, _, err := FetchTeamBundle(context.Background(), path)
+	assert.ErrorContains(t, err, "signature")
+
+	require.NoError(t, os.WriteFile(path+TeamSignatureSuffix, []byte("sig"), 0644))
+	data, sig, err := FetchTeamBundle(context.Background(), "file://"+path)
+	require.NoError(t, err)
+	assert.Equal(t, teamBundle, string(data))
+	assert.Equal(t, "sig", string(sig))
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -79,6 +81,39 @@ func (c *Config) Validate() error {
 			})
 		}
 
+		for location := range profile.Locations {
+			field := fmt.Sprintf("profiles.%s.locations.%s", name, location)
+			if c.Settings.Location(location) == nil {
+				errors = append(errors, ValidationError{
+					Field:   field,
+					Message: fmt.Sprintf("references undefined location '%s'", location),
+				})
+				continue
+			}
+			variant, _ := profile.ForLocation(location)
+			if err := variant.Validate(); err != nil {
+				errors = append(errors, ValidationError{Field: field, Message: err.Error()})
+			}
+		}
+
+		if profile.TrustDomain != "" {
+			if _, exists := c.Settings.TrustDomains[profile.TrustDomain]; !exists {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("profiles.%s.trust_domain", name),
+					Message: fmt.Sprintf("references undefined trust domain '%s'", profile.TrustDomain),
+				})
+			}
+		}
+
+		if profile.PKCS11Provider != "" && profile.PKCS11Provider != "agent" {
+			if _, err := os.Stat(profile.PKCS11Provider); os.IsNotExist(err) {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("profiles.%s.pkcs11_provider", name),
+					Message: fmt.Sprintf("PKCS#11 module does not exist: %s", profile.PKCS11Provider),
+				})
+			}
+		}
+
 		// Check SSH key path exists if specified
 		if profile.SSHKeyPath != "" {
 			if _, err := os.Stat(profile.SSHKeyPath); os.IsNotExist(err) {
@@ -108,11 +143,13 @@ func (c *Config) validateSettings() error {
 		"tailscale": true,
 		"headscale": true,
 		"netbird":   true,
+		"zerotier":  true,
+		"wireguard": true,
 	}
 	if !validBackends[c.Settings.DefaultBackend] {
 		errors = append(errors, ValidationError{
 			Field:   "settings.default_backend",
-			Message: fmt.Sprintf("invalid backend '%s', must be one of: auto, lan, tailscale, headscale, netbird", c.Settings.DefaultBackend),
+			Message: fmt.Sprintf("invalid backend '%s', must be one of: auto, lan, tailscale, headscale, netbird, zerotier, wireguard", c.Settings.DefaultBackend),
 		})
 	}
 
@@ -131,11 +168,11 @@ func (c *Config) validateSettings() error {
 	}
 
 	// Validate transfer method
-	validMethods := map[string]bool{"rsync": true, "sftp": true}
+	validMethods := map[string]bool{"rsync": true, "sftp": true, "delta": true, "scp": true}
 	if !validMethods[c.Settings.TransferMethod] {
 		errors = append(errors, ValidationError{
 			Field:   "settings.transfer_method",
-			Message: fmt.Sprintf("invalid method '%s', must be 'rsync' or 'sftp'", c.Settings.TransferMethod),
+			Message: fmt.Sprintf("invalid method '%s', must be 'rsync', 'sftp', 'delta' or 'scp'", c.Settings.TransferMethod),
 		})
 	}
 
@@ -147,6 +184,106 @@ func (c *Config) validateSettings() error {
 		})
 	}
 
+	// Validate theme (empty selects the default theme)
+	validThemes := map[string]bool{"": true, "default": true, "high-contrast": true, "monochrome": true}
+	if !validThemes[c.Settings.Theme] {
+		errors = append(errors, ValidationError{
+			Field:   "settings.theme",
+			Message: fmt.Sprintf("invalid theme '%s', must be one of: default, high-contrast, monochrome", c.Settings.Theme),
+		})
+	}
+
+	// Default keys are file names in the key directory or absolute paths
+	for _, key := range c.Settings.DefaultKeys {
+		if strings.TrimSpace(key) == "" || (!filepath.IsAbs(key) && strings.ContainsRune(key, filepath.Separator)) {
+			errors = append(errors, ValidationError{
+				Field:   "settings.default_keys",
+				Message: fmt.Sprintf("invalid key '%s', must be a file name in the key directory or an absolute path", key),
+			})
+		}
+	}
+
+	// Host key age thresholds are days; 0 disables the warning
+	if c.Settings.HostKeyMaxAgeDays < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "settings.host_key_max_age_days",
+			Message: "must not be negative",
+		})
+	}
+	if c.Settings.HostKeyMaxIdleDays < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "settings.host_key_max_idle_days",
+			Message: "must not be negative",
+		})
+	}
+
+	// Audit rotation: a size, and days where 0 disables the rule
+	if c.Settings.Audit.MaxSize != "" {
+		if _, err := ParseSize(c.Settings.Audit.MaxSize); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "settings.audit.max_size",
+				Message: err.Error(),
+			})
+		}
+	}
+	if c.Settings.Audit.RotateDays < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "settings.audit.rotate_days",
+			Message: "must not be negative",
+		})
+	}
+	if c.Settings.Audit.RetentionDays < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "settings.audit.retention_days",
+			Message: "must not be negative",
+		})
+	}
+	if endpoint := c.Settings.Tracing.Endpoint; endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errors = append(errors, ValidationError{
+				Field:   "settings.tracing.endpoint",
+				Message: fmt.Sprintf("invalid endpoint '%s', must be an http:// or https:// URL", endpoint),
+			})
+		}
+	}
+	if listen := c.Settings.Metrics.Listen; listen != "" {
+		if _, port, err := net.SplitHostPort(listen); err != nil || port == "" {
+			errors = append(errors, ValidationError{
+				Field:   "settings.metrics.listen",
+				Message: fmt.Sprintf("invalid address '%s', must be host:port", listen),
+			})
+		}
+	}
+	errors = append(errors, validateLocations(c.Settings.Locations)...)
+	for i, sink := range c.Settings.Audit.Sinks {
+		if err := sink.SinkConfig().Validate(); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   fmt.Sprintf("settings.audit.sinks[%d]", i),
+				Message: err.Error(),
+			})
+		}
+	}
+
+	// Trust domain names become file names
+	for name := range c.Settings.TrustDomains {
+		if !trustDomainName.MatchString(name) {
+			errors = append(errors, ValidationError{
+				Field:   "settings.trust_domains",
+				Message: fmt.Sprintf("invalid trust domain name '%s': use letters, digits, '-', '_' and '.'", name),
+			})
+		}
+	}
+
+	// Team names prefix the names of their profiles
+	for name := range c.Settings.Teams {
+		if err := ValidateTeamName(name); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   "settings.teams",
+				Message: err.Error(),
+			})
+		}
+	}
+
 	if len(errors) > 0 {
 		return errors
 	}
@@ -154,6 +291,9 @@ func (c *Config) validateSettings() error {
 	return nil
 }
 
+// trustDomainName matches trust domain names that are safe as file names
+var trustDomainName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+
 // ValidateProfile validates a single profile without checking the full config
 func ValidateProfile(profile *Profile) error {
 	if profile == nil {
@@ -192,7 +332,12 @@ func SanitizeProfile(profile *Profile) {
 	profile.Description = strings.TrimSpace(profile.Description)
 	profile.RemoteUser = strings.TrimSpace(profile.RemoteUser)
 	profile.RemoteHost = strings.TrimSpace(profile.RemoteHost)
+	for i := range profile.Hosts {
+		profile.Hosts[i] = strings.TrimSpace(profile.Hosts[i])
+	}
 	profile.SSHKeyPath = strings.TrimSpace(profile.SSHKeyPath)
+	profile.PKCS11Provider = strings.TrimSpace(profile.PKCS11Provider)
+	profile.HostKeyFingerprint = strings.TrimSpace(profile.HostKeyFingerprint)
 }
 
 // ValidatePort checks if port is in valid range
@@ -0,0 +1,113 @@
+// Package delta - POSIX cksum and its rolling form
+// Copyright (c) 2025 orpheus497
+package delta
+
+// cksumPoly is the CRC-32 polynomial of POSIX cksum, without the x^32 term
+const cksumPoly = 0x04C11DB7
+
+// cksumTable is the byte-wise table of the MSB-first CRC
+var cksumTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ cksumPoly
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// update feeds one byte to the CRC register
+func update(crc uint32, c byte) uint32 {
+	return crc<<8 ^ cksumTable[byte(crc>>24)^c]
+}
+
+// finish turns the register after n data bytes into the cksum value: the
+// length is fed in, least significant byte first, and the result inverted
+func finish(crc uint32, n int64) uint32 {
+	for ; n > 0; n >>= 8 {
+		crc = update(crc, byte(n))
+	}
+	return ^crc
+}
+
+// Cksum returns the CRC that POSIX cksum prints for data
+func Cksum(data []byte) uint32 {
+	var crc uint32
+	for _, c := range data {
+		crc = update(crc, c)
+	}
+	return finish(crc, int64(len(data)))
+}
+
+// mulmod multiplies two polynomials modulo the cksum polynomial
+func mulmod(a, b uint32) uint32 {
+	var product uint32
+	for i := 31; i >= 0; i-- {
+		if product&0x80000000 != 0 {
+			product = product<<1 ^ cksumPoly
+		} else {
+			product <<= 1
+		}
+		if b&(1<<i) != 0 {
+			product ^= a
+		}
+	}
+	return product
+}
+
+// xpow returns x^n modulo the cksum polynomial
+func xpow(n int64) uint32 {
+	result, square := uint32(1), uint32(2)
+	for ; n > 0; n >>= 1 {
+		if n&1 != 0 {
+			result = mulmod(result, square)
+		}
+		square = mulmod(square, square)
+	}
+	return result
+}
+
+// roller keeps the cksum CRC of a window of fixed size as it slides over
+// data one byte at a time
+type roller struct {
+	size int64
+	crc  uint32
+
+	// out is what each byte contributes to the register once size more
+	// bytes have followed it, removed when it leaves the window
+	out [256]uint32
+}
+
+// newRoller creates a roller for windows of size bytes
+func newRoller(size int64) *roller {
+	r := &roller{size: size}
+	shift := xpow(8 * size)
+	for i := range r.out {
+		r.out[i] = mulmod(cksumTable[i], shift)
+	}
+	return r
+}
+
+// reset starts over with window
+func (r *roller) reset(window []byte) {
+	r.crc = 0
+	for _, c := range window {
+		r.crc = update(r.crc, c)
+	}
+}
+
+// rotate slides the window by one byte, dropping out and adding in
+func (r *roller) rotate(out, in byte) {
+	r.crc = update(r.crc, in) ^ r.out[out]
+}
+
+// sum returns the cksum of the window
+func (r *roller) sum() uint32 {
+	return finish(r.crc, r.size)
+}
@@ -0,0 +1,154 @@
+// Package delta finds the blocks of one file that occur anywhere in another,
+// librsync-style, so that only the rest has to be transferred
+// Copyright (c) 2025 orpheus497
+package delta
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+const (
+	// MinBlockSize is the smallest block size of a signature
+	MinBlockSize = 64 << 10
+
+	// MaxBlocks is the most blocks a signature has; larger files get larger
+	// blocks, since a remote host without rsync hashes each block with
+	// separate commands
+	MaxBlocks = 2048
+
+	// blockAlign is the multiple block sizes are rounded up to
+	blockAlign = 4 << 10
+)
+
+// BlockSize returns the signature block size for a file of size bytes
+func BlockSize(size int64) int64 {
+	b := (size + MaxBlocks - 1) / MaxBlocks
+	b = (b + blockAlign - 1) / blockAlign * blockAlign
+	return max(b, MinBlockSize)
+}
+
+// Block holds the checksums of one block of a file
+type Block struct {
+	// Weak is the POSIX cksum CRC of the block, which Find rolls over every
+	// offset of the scanned file
+	Weak uint32
+
+	// Strong is the hex SHA-256 of the block, confirming a weak match
+	Strong string
+}
+
+// Signature holds the checksums of the full blocks of a file, in order; a
+// final partial block is left out
+type Signature struct {
+	BlockSize int64
+	Blocks    []Block
+}
+
+// NewSignature computes the signature of the data read from r
+func NewSignature(r io.Reader, blockSize int64) (*Signature, error) {
+	sig := &Signature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return sig, nil
+			}
+			return nil, err
+		}
+		sum := sha256.Sum256(buf)
+		sig.Blocks = append(sig.Blocks, Block{Weak: Cksum(buf), Strong: hex.EncodeToString(sum[:])})
+	}
+}
+
+// Match is a block of a signature found in the scanned file
+type Match struct {
+	// Offset is where the block starts in the scanned file
+	Offset int64
+
+	// Block is the index of the block in the signature; blocks with the
+	// same content match at the same offset
+	Block int
+}
+
+// Find scans the data read from r for the blocks of sig, checking the weak
+// checksum at every offset and the strong one where it matches, and returns
+// where blocks occur, by offset and without overlaps
+func Find(ctx context.Context, r io.Reader, sig *Signature) ([]Match, error) {
+	if len(sig.Blocks) == 0 || sig.BlockSize <= 0 {
+		return nil, nil
+	}
+
+	weak := make(map[uint32][]int)
+	for i, b := range sig.Blocks {
+		weak[b.Weak] = append(weak[b.Weak], i)
+	}
+
+	size := int(sig.BlockSize)
+	roll := newRoller(sig.BlockSize)
+	in := bufio.NewReaderSize(r, 1<<20)
+	window := make([]byte, size)
+	ordered := make([]byte, size)
+
+	var matches []Match
+	var offset int64
+	for {
+		// Fill a fresh window at offset
+		if _, err := io.ReadFull(in, window); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return matches, nil
+			}
+			return nil, err
+		}
+		roll.reset(window)
+		head := 0
+
+		for {
+			if candidates, ok := weak[roll.sum()]; ok {
+				copy(ordered, window[head:])
+				copy(ordered[size-head:], window[:head])
+				sum := sha256.Sum256(ordered)
+				strong := hex.EncodeToString(sum[:])
+				if i := findStrong(sig, candidates, strong); i >= 0 {
+					matches = append(matches, Match{Offset: offset, Block: i})
+					offset += sig.BlockSize
+					break
+				}
+			}
+
+			// Slide the window by one byte
+			c, err := in.ReadByte()
+			if errors.Is(err, io.EOF) {
+				return matches, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			roll.rotate(window[head], c)
+			window[head] = c
+			head = (head + 1) % size
+			offset++
+
+			if offset%(1<<20) == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
+
+// findStrong returns the first of the candidate blocks with the strong
+// checksum, or -1
+func findStrong(sig *Signature, candidates []int, strong string) int {
+	for _, i := range candidates {
+		if sig.Blocks[i].Strong == strong {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,93 @@
+package delta
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCksum(t *testing.T) {
+	assert.Equal(t, uint32(4294967295), Cksum(nil))
+	assert.Equal(t, uint32(3015617425), Cksum([]byte("hello\n")))
+	assert.Equal(t, uint32(1260869142), Cksum(make([]byte, 100000)))
+}
+
+func TestCksumMatchesSystem(t *testing.T) {
+	if _, err := exec.LookPath("cksum"); err != nil {
+		t.Skip("cksum not installed")
+	}
+	data := make([]byte, 70000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	cmd := exec.Command("cksum")
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	want, err := strconv.ParseUint(strings.Fields(string(output))[0], 10, 32)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(want), Cksum(data))
+}
+
+func TestRoller(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	const size = 1000
+	r := newRoller(size)
+	r.reset(data[:size])
+	for i := 0; ; i++ {
+		require.Equal(t, Cksum(data[i:i+size]), r.sum(), "window at %d", i)
+		if i+size == len(data) {
+			break
+		}
+		r.rotate(data[i], data[i+size])
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	assert.Equal(t, int64(MinBlockSize), BlockSize(0))
+	assert.Equal(t, int64(MinBlockSize), BlockSize(MinBlockSize*MaxBlocks))
+	assert.Equal(t, int64(512<<10), BlockSize(1<<30))
+	assert.Zero(t, BlockSize(12345678901)%blockAlign)
+}
+
+func TestFind(t *testing.T) {
+	const blockSize = 4096
+	old := make([]byte, 10*blockSize+100)
+	rand.New(rand.NewSource(3)).Read(old)
+
+	sig, err := NewSignature(bytes.NewReader(old), blockSize)
+	require.NoError(t, err)
+	require.Len(t, sig.Blocks, 10)
+
+	// Insert data in block 2 and drop block 6: every other block is found
+	// at its shifted offset
+	var scanned []byte
+	scanned = append(scanned, old[:2*blockSize+10]...)
+	scanned = append(scanned, []byte("inserted")...)
+	scanned = append(scanned, old[2*blockSize+10:6*blockSize]...)
+	scanned = append(scanned, old[7*blockSize:]...)
+
+	matches, err := Find(context.Background(), bytes.NewReader(scanned), sig)
+	require.NoError(t, err)
+
+	var blocks []int
+	for _, m := range matches {
+		blocks = append(blocks, m.Block)
+		assert.Equal(t, old[m.Block*blockSize:(m.Block+1)*blockSize], scanned[m.Offset:m.Offset+blockSize])
+	}
+	assert.Equal(t, []int{0, 1, 3, 4, 5, 7, 8, 9}, blocks)
+
+	// Nothing to find in unrelated data
+	other := make([]byte, 3*blockSize)
+	matches, err = Find(context.Background(), bytes.NewReader(other), sig)
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
@@ -0,0 +1,360 @@
+// Package doctor - Configuration, key, tool and backend checks
+// Copyright (c) 2025 orpheus497
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Config checks that the configuration loads and validates. path names
+// where it was loaded from, in messages and remedies.
+func Config(cfg *config.Config, path string, loadErr error) []Check {
+	if loadErr != nil {
+		return []Check{{
+			Category: "config", Name: path, Status: Fail,
+			Message: fmt.Sprintf("cannot be loaded: %v", loadErr),
+			Remedy:  fmt.Sprintf("Fix the YAML in %s, or move it aside and run 'klip init'", path),
+		}}
+	}
+
+	var checks []Check
+	if err := cfg.StoreError(); err != nil {
+		checks = append(checks, Check{
+			Category: "config", Name: path, Status: Warn,
+			Message: fmt.Sprintf("using the copy cached locally: %v", err),
+			Remedy:  "Check that the config store is reachable and the credentials for it are set",
+		})
+	}
+
+	err := cfg.Validate()
+	var invalid config.ValidationErrors
+	switch {
+	case errors.As(err, &invalid):
+		for _, ve := range invalid {
+			checks = append(checks, Check{
+				Category: "config", Name: ve.Field, Status: Fail,
+				Message: ve.Message,
+				Remedy:  fmt.Sprintf("Correct %s in %s", ve.Field, path),
+			})
+		}
+	case err != nil:
+		checks = append(checks, Check{
+			Category: "config", Name: path, Status: Fail,
+			Message: err.Error(),
+			Remedy:  fmt.Sprintf("Correct %s", path),
+		})
+	case len(cfg.Profiles) == 0:
+		checks = append(checks, Check{
+			Category: "config", Name: path, Status: Warn,
+			Message: "valid, but has no profiles",
+			Remedy:  "Add one with 'klip profile add'",
+		})
+	default:
+		checks = append(checks, Check{
+			Category: "config", Name: path, Status: OK,
+			Message: fmt.Sprintf("valid, %s", plural(len(cfg.Profiles), "profile")),
+		})
+	}
+	return checks
+}
+
+// Keys checks the private keys the profiles authenticate with: those they
+// name, or the default keys of keyDir ("" for ~/.ssh), names as in
+// settings.default_keys, for profiles that name none. Each key is checked
+// once.
+func Keys(profiles []*config.Profile, keyDir func(*config.Profile) string, names []string) []Check {
+	var checks []Check
+	seen := map[string]bool{}
+	check := func(path string) {
+		path = expandHome(path)
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		checks = append(checks, KeyFile(path))
+		if dir := filepath.Dir(path); !seen[dir] {
+			seen[dir] = true
+			if c, ok := keyDirCheck(dir); ok {
+				checks = append(checks, c)
+			}
+		}
+	}
+
+	for _, profile := range profiles {
+		if profile.SSHKeyPath != "" {
+			check(profile.SSHKeyPath)
+		}
+		for _, hop := range profile.JumpChain() {
+			if hop.Key != "" {
+				check(hop.Key)
+			}
+		}
+		if profile.SSHKeyPath != "" || profile.UsePassword || profile.PKCS11Provider != "" {
+			continue
+		}
+
+		defaults := ssh.DefaultKeyPaths(keyDir(profile), names)
+		for _, path := range defaults {
+			check(path)
+		}
+		if len(defaults) == 0 && os.Getenv("SSH_AUTH_SOCK") == "" {
+			checks = append(checks, Check{
+				Category: "keys", Name: profile.Name, Status: Fail,
+				Message: "has no key to authenticate with: no ssh_key_path, no default keys and no ssh-agent",
+				Remedy:  "Create a key with 'ssh-keygen -t ed25519' and add it to the host's authorized_keys, or set ssh_key_path",
+			})
+		}
+	}
+	return checks
+}
+
+// KeyFile checks that a private key exists, is readable only by its owner
+// and parses
+func KeyFile(path string) Check {
+	c := Check{Category: "keys", Name: path}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		c.Status, c.Message = Fail, "does not exist"
+		c.Remedy = fmt.Sprintf("Create it with 'ssh-keygen -t ed25519 -f %s', or correct ssh_key_path", path)
+		return c
+	case err != nil:
+		c.Status, c.Message = Fail, fmt.Sprintf("cannot be read: %v", err)
+		return c
+	case !info.Mode().IsRegular():
+		c.Status, c.Message = Fail, "is not a regular file"
+		c.Remedy = "Point ssh_key_path at the private key file"
+		return c
+	}
+
+	mode := info.Mode().Perm()
+	if runtime.GOOS != "windows" && mode&0077 != 0 {
+		c.Status, c.Message = Fail, fmt.Sprintf("is readable by other users (mode %04o), so ssh refuses it", mode)
+		c.Remedy = fmt.Sprintf("chmod 600 %s", path)
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.Status, c.Message = Fail, fmt.Sprintf("cannot be read: %v", err)
+		return c
+	}
+	var missing *gossh.PassphraseMissingError
+	if _, err := gossh.ParsePrivateKey(data); err != nil && !errors.As(err, &missing) {
+		c.Status, c.Message = Fail, fmt.Sprintf("is not a private key: %v", err)
+		c.Remedy = "Point ssh_key_path at the private key, not the .pub file"
+		return c
+	}
+
+	c.Status, c.Message = OK, fmt.Sprintf("private key, mode %04o", mode)
+	if missing != nil {
+		c.Message += ", protected by a passphrase"
+	}
+	return c
+}
+
+// keyDirCheck warns about a key directory other users can write to, where
+// they could replace keys
+func keyDirCheck(dir string) (Check, bool) {
+	// Shared directories like /tmp are sticky, so keys in them cannot be
+	// replaced by others
+	info, err := os.Stat(dir)
+	if err != nil || runtime.GOOS == "windows" || info.Mode().Perm()&0022 == 0 || info.Mode()&os.ModeSticky != 0 {
+		return Check{}, false
+	}
+	return Check{
+		Category: "keys", Name: dir, Status: Warn,
+		Message: fmt.Sprintf("is writable by other users (mode %04o)", info.Mode().Perm()),
+		Remedy:  fmt.Sprintf("chmod 700 %s", dir),
+	}, true
+}
+
+// Tools checks the local programs transfers use. Without rsync they fall
+// back to SFTP, unless strict is set for the rsync method.
+func Tools(lookPath func(string) (string, error), method string, strict bool) []Check {
+	path, err := lookPath("rsync")
+	if err == nil {
+		return []Check{{Category: "tools", Name: "rsync", Status: OK, Message: "found at " + path}}
+	}
+
+	c := Check{
+		Category: "tools", Name: "rsync", Status: Warn,
+		Message: "is not installed, transfers fall back to SFTP",
+		Remedy:  installHint("rsync"),
+	}
+	if method == "rsync" && strict {
+		c.Status, c.Message = Fail, "is not installed and strict_method is set, so rsync transfers fail"
+	}
+	return []Check{c}
+}
+
+// installHint says how to install a package on this platform
+func installHint(pkg string) string {
+	switch runtime.GOOS {
+	case "darwin":
+		return fmt.Sprintf("Install it with 'brew install %s'", pkg)
+	case "freebsd":
+		return fmt.Sprintf("Install it with 'pkg install %s'", pkg)
+	case "windows":
+		return fmt.Sprintf("Install %s through WSL, MSYS2 or Cygwin and add it to PATH", pkg)
+	}
+	return fmt.Sprintf("Install it with the package manager, e.g. 'sudo apt install %s' or 'sudo dnf install %s'", pkg, pkg)
+}
+
+// backendHint is how to install and connect a backend
+type backendHint struct {
+	cli     string
+	install string
+	connect string
+}
+
+var backendHints = map[string]backendHint{
+	"tailscale": {"tailscale", "https://tailscale.com/download", "tailscale up"},
+	"headscale": {"tailscale", "https://tailscale.com/download", "tailscale up --login-server <headscale-url>"},
+	"netbird":   {"netbird", "https://docs.netbird.io/how-to/installation", "netbird up"},
+	"zerotier":  {"zerotier-cli", "https://www.zerotier.com/download/", "zerotier-cli join <network-id>"},
+	"wireguard": {"wg", "https://www.wireguard.com/install/", "wg-quick up <interface>"},
+}
+
+// Backends checks, highest priority first, whether each backend's CLI is
+// installed and connected.
+// With a profile, backends it may not use are skipped, and the backend it
+// asks for must be installed and connected.
+func Backends(ctx context.Context, backends []backend.Backend, profile *config.Profile) []Check {
+	backends = append([]backend.Backend(nil), backends...)
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Priority() > backends[j].Priority() })
+
+	var checks []Check
+	for _, b := range backends {
+		name := b.Name()
+		c := Check{Category: "backend", Name: name}
+		if name == "lan" {
+			c.Status, c.Message = OK, "always available"
+			checks = append(checks, c)
+			continue
+		}
+		if profile != nil && !profile.BackendPermitted(name) {
+			c.Status, c.Message = Skip, "not permitted by the profile"
+			checks = append(checks, c)
+			continue
+		}
+
+		hint := backendHints[name]
+		required := profile != nil && string(profile.Backend) == name
+		switch {
+		case !b.IsAvailable(ctx):
+			c.Status, c.Message = Skip, fmt.Sprintf("not installed (%s not found)", hint.cli)
+			if required {
+				c.Status = Fail
+				c.Remedy = fmt.Sprintf("Install %s from %s", name, hint.install)
+			}
+		case !b.IsConnected(ctx):
+			c.Status, c.Message = Warn, "installed, but not connected"
+			c.Remedy = fmt.Sprintf("Connect with '%s'", hint.connect)
+			if required {
+				c.Status = Fail
+			}
+		default:
+			c.Status, c.Message = OK, "connected"
+			if status, err := b.GetStatus(ctx); err == nil && status.LocalIP != "" {
+				c.Message += ", local address " + status.LocalIP
+			}
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// Resolver looks up the addresses of a name, like net.Resolver.LookupHost
+type Resolver func(ctx context.Context, host string) ([]string, error)
+
+// DNS checks that each hostname resolves the way connections resolve it:
+// through b, or with lookup on the LAN backend. Addresses are skipped.
+func DNS(ctx context.Context, hosts []string, lookup Resolver, b backend.Backend) []Check {
+	var checks []Check
+	for _, host := range hosts {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		c := Check{Category: "dns", Name: host}
+
+		if b != nil && b.Name() != "lan" {
+			if peer, err := b.GetPeerIP(ctx, host); err != nil {
+				c.Status, c.Message = Fail, fmt.Sprintf("%s does not know it: %v", b.Name(), err)
+				c.Remedy = fmt.Sprintf("Check the peer's name with '%s status', or set the profile's backend to lan if the host is reachable directly", backendHints[b.Name()].cli)
+			} else {
+				c.Status, c.Message = OK, fmt.Sprintf("%s resolves it to %s", b.Name(), peer)
+			}
+			checks = append(checks, c)
+			continue
+		}
+
+		if addrs, err := lookup(ctx, host); err != nil {
+			c.Status, c.Message = Fail, fmt.Sprintf("does not resolve: %v", err)
+			c.Remedy = "Check the name, add it to the hosts file, or set remote_host to its address"
+		} else {
+			c.Status, c.Message = OK, "resolves to "+strings.Join(addrs, ", ")
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// Remote checks the transfer tools of a host klip logged in to
+func Remote(caps *ssh.RemoteCapabilities) []Check {
+	rsync := Check{Category: "remote", Name: "rsync"}
+	switch {
+	case caps.HasRsync:
+		rsync.Status, rsync.Message = OK, "found at "+caps.RsyncPath
+	case !caps.POSIXShell:
+		rsync.Status, rsync.Message = Skip, "the login shell is not POSIX, rsync was not looked for"
+	default:
+		rsync.Status, rsync.Message = Warn, "is not installed on the host, transfers fall back to SFTP"
+		rsync.Remedy = "Install rsync on the host"
+	}
+
+	sftp := Check{Category: "remote", Name: "sftp"}
+	switch {
+	case caps.HasSFTP:
+		sftp.Status, sftp.Message = OK, "subsystem enabled"
+	case caps.HasSCP:
+		sftp.Status, sftp.Message = Warn, "subsystem disabled, transfers fall back to scp"
+	default:
+		sftp.Status, sftp.Message = Fail, "subsystem disabled and scp missing, so only rsync can transfer files"
+	}
+	if !caps.HasSFTP {
+		sftp.Remedy = "Add 'Subsystem sftp internal-sftp' to the host's sshd_config and reload sshd"
+	}
+	return []Check{rsync, sftp}
+}
+
+// expandHome expands a leading ~/ to the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[2:])
+		}
+	}
+	return path
+}
+
+// plural formats a count of things, e.g. "1 profile" or "2 profiles"
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
@@ -0,0 +1,81 @@
+// Package doctor diagnoses problems with the configuration, keys, tools,
+// backends and network path klip depends on, suggesting how to fix each
+// Copyright (c) 2025 orpheus497
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	// OK means nothing needs to be done
+	OK Status = "ok"
+
+	// Warn means klip works, but not as well as it could
+	Warn Status = "warn"
+
+	// Fail means something klip needs is broken
+	Fail Status = "fail"
+
+	// Skip means the check could not be made
+	Skip Status = "skip"
+)
+
+// Check is the result of one diagnostic
+type Check struct {
+	// Category groups related checks: config, keys, tools, backend, dns,
+	// path, known_hosts or remote
+	Category string `json:"category"`
+
+	// Name identifies what was checked, e.g. a file, tool or host
+	Name string `json:"name"`
+
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+
+	// Remedy says how to fix a warning or failure
+	Remedy string `json:"remedy,omitempty"`
+}
+
+// Report collects the checks of one run
+type Report struct {
+	Version  string    `json:"version"`
+	Platform string    `json:"platform"`
+	Profile  string    `json:"profile,omitempty"`
+	Time     time.Time `json:"time"`
+	Checks   []Check   `json:"checks"`
+}
+
+// Add appends checks to the report
+func (r *Report) Add(checks ...Check) {
+	r.Checks = append(r.Checks, checks...)
+}
+
+// Count returns the number of checks with the given status
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteFile saves the report as JSON, e.g. to attach to a bug report
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
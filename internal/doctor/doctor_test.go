@@ -0,0 +1,296 @@
+package doctor
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestConfig(t *testing.T) {
+	checks := Config(nil, "/cfg.yaml", errors.New("failed to parse config file"))
+	require.Len(t, checks, 1)
+	assert.Equal(t, Fail, checks[0].Status)
+	assert.Contains(t, checks[0].Remedy, "klip init")
+
+	cfg := config.NewConfig()
+	checks = Config(cfg, "/cfg.yaml", nil)
+	assert.Equal(t, Warn, checks[0].Status)
+
+	cfg.Profiles["web"] = &config.Profile{Name: "web", RemoteUser: "admin", RemoteHost: "web", SSHPort: 22, Backend: config.BackendLAN}
+	checks = Config(cfg, "/cfg.yaml", nil)
+	assert.Equal(t, []Check{{Category: "config", Name: "/cfg.yaml", Status: OK, Message: "valid, 1 profile"}}, checks)
+
+	cfg.CurrentProfile = "missing"
+	checks = Config(cfg, "/cfg.yaml", nil)
+	require.Len(t, checks, 1)
+	assert.Equal(t, Fail, checks[0].Status)
+	assert.Equal(t, "current_profile", checks[0].Name)
+	assert.Equal(t, "Correct current_profile in /cfg.yaml", checks[0].Remedy)
+}
+
+func TestKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := gossh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+
+	c := KeyFile(keyPath)
+	assert.Equal(t, OK, c.Status)
+	assert.Equal(t, "private key, mode 0600", c.Message)
+
+	require.NoError(t, os.Chmod(keyPath, 0644))
+	c = KeyFile(keyPath)
+	assert.Equal(t, Fail, c.Status)
+	assert.Equal(t, "chmod 600 "+keyPath, c.Remedy)
+
+	pubPath := filepath.Join(dir, "id_ed25519.pub")
+	require.NoError(t, os.WriteFile(pubPath, []byte("ssh-ed25519 AAAA"), 0600))
+	c = KeyFile(pubPath)
+	assert.Equal(t, Fail, c.Status)
+	assert.Contains(t, c.Remedy, "not the .pub file")
+
+	c = KeyFile(filepath.Join(dir, "missing"))
+	assert.Equal(t, Fail, c.Status)
+	assert.Contains(t, c.Remedy, "ssh-keygen")
+}
+
+func TestKeysWithoutAnyKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	profile := &config.Profile{Name: "web"}
+	checks := Keys([]*config.Profile{profile}, func(*config.Profile) string { return t.TempDir() }, nil)
+	require.Len(t, checks, 1)
+	assert.Equal(t, Fail, checks[0].Status)
+	assert.Equal(t, "web", checks[0].Name)
+
+	// Password profiles need no key
+	profile.UsePassword = true
+	assert.Empty(t, Keys([]*config.Profile{profile}, func(*config.Profile) string { return t.TempDir() }, nil))
+}
+
+func TestTools(t *testing.T) {
+	found := func(string) (string, error) { return "/usr/bin/rsync", nil }
+	missing := func(string) (string, error) { return "", errors.New("not found") }
+
+	assert.Equal(t, OK, Tools(found, "rsync", true)[0].Status)
+	assert.Equal(t, Warn, Tools(missing, "rsync", false)[0].Status)
+	assert.Equal(t, Fail, Tools(missing, "rsync", true)[0].Status)
+	assert.Equal(t, Warn, Tools(missing, "sftp", true)[0].Status)
+}
+
+func TestBackends(t *testing.T) {
+	ctx := context.Background()
+	backends := []backend.Backend{
+		&clitest.Backend{Status: backend.Status{Backend: "lan", Connected: true}, Installed: true, Prio: 10},
+		&clitest.Backend{Status: backend.Status{Backend: "tailscale", Connected: true, LocalIP: "100.64.0.1"}, Installed: true, Prio: 100},
+		&clitest.Backend{Status: backend.Status{Backend: "netbird"}, Installed: true, Prio: 80},
+		&clitest.Backend{Status: backend.Status{Backend: "zerotier"}, Prio: 70},
+	}
+
+	checks := Backends(ctx, backends, nil)
+	require.Len(t, checks, 4)
+	assert.Equal(t, Check{Category: "backend", Name: "tailscale", Status: OK, Message: "connected, local address 100.64.0.1"}, checks[0])
+	assert.Equal(t, Warn, checks[1].Status)
+	assert.Equal(t, "Connect with 'netbird up'", checks[1].Remedy)
+	assert.Equal(t, Skip, checks[2].Status)
+	assert.Equal(t, OK, checks[3].Status)
+
+	// The backend a profile asks for must work
+	profile := &config.Profile{Backend: "netbird", DeniedBackends: []string{"tailscale"}}
+	checks = Backends(ctx, backends, profile)
+	assert.Equal(t, Skip, checks[0].Status)
+	assert.Equal(t, Fail, checks[1].Status)
+}
+
+func TestDNS(t *testing.T) {
+	ctx := context.Background()
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		if host == "web.lan" {
+			return []string{"192.168.1.20"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	lan := &clitest.Backend{Status: backend.Status{Backend: "lan", Connected: true}, Installed: true}
+	tailscale := &clitest.Backend{
+		Status:    backend.Status{Backend: "tailscale", Connected: true},
+		Installed: true,
+		Peers:     map[string]string{"web": "100.64.0.5"},
+	}
+
+	checks := DNS(ctx, []string{"web.lan", "10.0.0.5", "gone.lan"}, lookup, lan)
+	require.Len(t, checks, 2)
+	assert.Equal(t, Check{Category: "dns", Name: "web.lan", Status: OK, Message: "resolves to 192.168.1.20"}, checks[0])
+	assert.Equal(t, Fail, checks[1].Status)
+
+	// VPN backends resolve names themselves
+	checks = DNS(ctx, []string{"web", "web.lan"}, lookup, tailscale)
+	require.Len(t, checks, 2)
+	assert.Equal(t, "tailscale resolves it to 100.64.0.5", checks[0].Message)
+	assert.Equal(t, Fail, checks[1].Status)
+	assert.Contains(t, checks[1].Remedy, "tailscale status")
+}
+
+func TestPath(t *testing.T) {
+	ctx := context.Background()
+	up := func(ctx context.Context, host string, port int) error { return nil }
+
+	// pinger answers payloads up to a path MTU
+	pinger := func(mtu int) Pinger {
+		return func(ctx context.Context, host string, size int) error {
+			if size+28 > mtu {
+				return errors.New("message too long")
+			}
+			return nil
+		}
+	}
+
+	checks := Path(ctx, "web", "192.168.1.20", 22, "lan", pinger(1500), up)
+	require.Len(t, checks, 2)
+	assert.Equal(t, OK, checks[0].Status)
+	assert.Equal(t, "1500-byte packets reach the host unfragmented", checks[1].Message)
+
+	// 1280 is enough through a VPN
+	checks = Path(ctx, "web", "100.64.0.5", 22, "tailscale", pinger(1280), up)
+	assert.Equal(t, OK, checks[1].Status)
+
+	// but not on the LAN, where the MTU is narrowed down
+	checks = Path(ctx, "web", "192.168.1.20", 22, "lan", pinger(1492), up)
+	assert.Equal(t, Warn, checks[1].Status)
+	assert.Contains(t, checks[1].Message, "only 1486-byte packets")
+
+	checks = Path(ctx, "web", "192.168.1.20", 22, "lan", func(context.Context, string, int) error { return ErrNoPing }, up)
+	assert.Equal(t, Skip, checks[1].Status)
+	checks = Path(ctx, "web", "192.168.1.20", 22, "lan", pinger(0), up)
+	assert.Equal(t, Skip, checks[1].Status)
+
+	checks = Path(ctx, "web", "192.168.1.20", 2222, "lan", pinger(1500), func(ctx context.Context, host string, port int) error {
+		return errors.New("connection refused")
+	})
+	require.Len(t, checks, 1)
+	assert.Equal(t, Fail, checks[0].Status)
+	assert.Contains(t, checks[0].Remedy, "port 2222")
+}
+
+func TestRoute(t *testing.T) {
+	route := &backend.LANRoute{Host: "web", Address: "192.168.1.20"}
+	assert.Equal(t, OK, Route(route, false).Status)
+	assert.Equal(t, Fail, Route(route, true).Status)
+
+	route.Peers = []backend.PeerLiveness{{Backend: "tailscale", Online: true, IP: "100.64.0.5"}}
+	c := Route(route, false)
+	assert.Equal(t, Warn, c.Status)
+	assert.Contains(t, c.Remedy, "--backend tailscale")
+
+	route.VPN = "zerotier"
+	assert.Equal(t, OK, Route(route, true).Status)
+}
+
+func TestHostKeys(t *testing.T) {
+	newKey := func() gossh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		key, err := gossh.NewPublicKey(pub)
+		require.NoError(t, err)
+		return key
+	}
+	hostKey, oldKey := newKey(), newKey()
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	c, callback := KnownHostsFile(path)
+	assert.Equal(t, Skip, c.Status)
+	assert.Nil(t, callback)
+
+	lines := knownhosts.Line([]string{"100.64.0.5"}, hostKey) + "\n" +
+		knownhosts.Line([]string{"[web]:2222"}, hostKey) + "\n" +
+		knownhosts.Line([]string{"[web.lan]:2222"}, oldKey) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(lines), 0600))
+	c, callback = KnownHostsFile(path)
+	assert.Equal(t, OK, c.Status)
+	require.NotNil(t, callback)
+
+	checks := HostKeys(callback, path, []string{"100.64.0.5"}, 22, hostKey, nil)
+	assert.Equal(t, OK, checks[0].Status)
+	assert.Contains(t, checks[0].Message, ssh.FormatFingerprint(hostKey))
+
+	checks = HostKeys(callback, path, []string{"100.64.0.5"}, 22, newKey(), nil)
+	assert.Equal(t, Fail, checks[0].Status)
+	assert.Contains(t, checks[0].Remedy, "ssh-keygen -R 100.64.0.5 -f "+path)
+
+	checks = HostKeys(callback, path, []string{"100.64.0.6"}, 22, hostKey, nil)
+	assert.Equal(t, Warn, checks[0].Status)
+
+	// Without the server's key the names are compared with each other
+	checks = HostKeys(callback, path, []string{"web", "web.lan", "web.example.com"}, 2222, nil, nil)
+	require.Len(t, checks, 4)
+	assert.Equal(t, OK, checks[0].Status)
+	assert.Equal(t, OK, checks[1].Status)
+	assert.Equal(t, Warn, checks[2].Status)
+	assert.Equal(t, Check{
+		Category: "known_hosts", Name: "web.lan", Status: Warn,
+		Message: "has different keys recorded than web, so one of them is stale",
+		Remedy:  "Remove the stale entry with 'ssh-keygen -R <host> -f " + path + "' and reconnect",
+	}, checks[3])
+
+	require.NoError(t, os.WriteFile(path, []byte("@bogus line\n"), 0600))
+	c, callback = KnownHostsFile(path)
+	assert.Equal(t, Fail, c.Status)
+	assert.Nil(t, callback)
+
+	// A pinned fingerprint is checked instead of known_hosts
+	c = Pinned("web", "100.64.0.5", gossh.FingerprintSHA256(hostKey), hostKey)
+	assert.Equal(t, OK, c.Status)
+	c = Pinned("web", "100.64.0.5", gossh.FingerprintSHA256(oldKey), hostKey)
+	assert.Equal(t, Fail, c.Status)
+	assert.Contains(t, c.Message, gossh.FingerprintSHA256(hostKey))
+	assert.Equal(t, "Confirm the new fingerprint with the host's administrator, then run 'klip profile pin-key web'", c.Remedy)
+}
+
+func TestRemote(t *testing.T) {
+	checks := Remote(&ssh.RemoteCapabilities{POSIXShell: true, HasRsync: true, RsyncPath: "/usr/bin/rsync", HasSFTP: true})
+	assert.Equal(t, OK, checks[0].Status)
+	assert.Equal(t, OK, checks[1].Status)
+
+	checks = Remote(&ssh.RemoteCapabilities{POSIXShell: true, HasSCP: true})
+	assert.Equal(t, Warn, checks[0].Status)
+	assert.Equal(t, Warn, checks[1].Status)
+	assert.Contains(t, checks[1].Remedy, "Subsystem sftp")
+
+	checks = Remote(&ssh.RemoteCapabilities{})
+	assert.Equal(t, Skip, checks[0].Status)
+	assert.Equal(t, Fail, checks[1].Status)
+}
+
+func TestReport(t *testing.T) {
+	report := &Report{Version: "2.2.0", Platform: "linux/amd64", Profile: "web"}
+	report.Add(Check{Category: "config", Name: "config.yaml", Status: OK, Message: "valid"},
+		Check{Category: "tools", Name: "rsync", Status: Warn, Message: "is not installed", Remedy: "Install it"})
+	assert.Equal(t, 1, report.Count(OK))
+	assert.Equal(t, 1, report.Count(Warn))
+	assert.Equal(t, 0, report.Count(Fail))
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, report.WriteFile(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded Report
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, report.Checks, decoded.Checks)
+	assert.Contains(t, string(data), `"remedy": "Install it"`)
+}
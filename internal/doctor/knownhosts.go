@@ -0,0 +1,200 @@
+// Package doctor - known_hosts consistency checks
+// Copyright (c) 2025 orpheus497
+package doctor
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsFile checks that a known_hosts file parses and that only its
+// owner can write to it, returning its host key callback for HostKeys (nil
+// if it does not exist or cannot be parsed)
+func KnownHostsFile(path string) (Check, gossh.HostKeyCallback) {
+	c := Check{Category: "known_hosts", Name: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		c.Status, c.Message = Skip, "does not exist yet, no host keys are trusted"
+		return c, nil
+	}
+	if err != nil {
+		c.Status, c.Message = Fail, fmt.Sprintf("cannot be read: %v", err)
+		return c, nil
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		c.Status, c.Message = Fail, fmt.Sprintf("cannot be parsed: %v", err)
+		c.Remedy = "Correct or delete the line named in the error"
+		return c, nil
+	}
+
+	c.Status, c.Message = OK, "parses"
+	if mode := info.Mode().Perm(); runtime.GOOS != "windows" && mode&0022 != 0 {
+		c.Status, c.Message = Warn, fmt.Sprintf("is writable by other users (mode %04o), who could add host keys", mode)
+		c.Remedy = fmt.Sprintf("chmod 600 %s", path)
+	}
+	return c, callback
+}
+
+// HostKeys checks the entries of a known_hosts file for the names and
+// addresses of one host. With the key the server presents, each entry is
+// compared with it; without, the entries are compared with each other.
+func HostKeys(callback gossh.HostKeyCallback, path string, hosts []string, port int, presented gossh.PublicKey, hostCAs []gossh.PublicKey) []Check {
+	var checks []Check
+	if presented != nil {
+		for _, host := range hosts {
+			checks = append(checks, verifyPresented(callback, path, host, port, presented, hostCAs))
+		}
+		return checks
+	}
+
+	// Without the server's key, names and addresses of the same host should
+	// at least share a key
+	recorded := map[string][]gossh.PublicKey{}
+	var known []string
+	for _, host := range hosts {
+		keys, err := knownKeys(callback, host, port)
+		if err != nil {
+			continue
+		}
+		c := Check{Category: "known_hosts", Name: host}
+		if len(keys) == 0 {
+			c.Status, c.Message = Warn, "not trusted yet, the first connection asks to confirm its key"
+			c.Remedy = "Compare the fingerprint with the host's administrator when asked, or import the key with 'klip hostkey import'"
+		} else {
+			c.Status, c.Message = OK, "trusted, "+keyTypes(keys)
+			recorded[host] = keys
+			known = append(known, host)
+		}
+		checks = append(checks, c)
+	}
+	for i := 1; i < len(known); i++ {
+		if !shareKey(recorded[known[0]], recorded[known[i]]) {
+			checks = append(checks, Check{
+				Category: "known_hosts", Name: known[i], Status: Warn,
+				Message: fmt.Sprintf("has different keys recorded than %s, so one of them is stale", known[0]),
+				Remedy:  fmt.Sprintf("Remove the stale entry with 'ssh-keygen -R <host> -f %s' and reconnect", path),
+			})
+		}
+	}
+	return checks
+}
+
+// verifyPresented compares the known_hosts entries of host with the key
+// the server presented
+func verifyPresented(callback gossh.HostKeyCallback, path, host string, port int, key gossh.PublicKey, hostCAs []gossh.PublicKey) Check {
+	c := Check{Category: "known_hosts", Name: host}
+	if cert, ok := key.(*gossh.Certificate); ok {
+		for _, ca := range hostCAs {
+			if bytes.Equal(ca.Marshal(), cert.SignatureKey.Marshal()) {
+				c.Status, c.Message = OK, "presents a certificate signed by a trusted host CA"
+				return c
+			}
+		}
+		key = cert.Key
+	}
+
+	fingerprint := ssh.FormatFingerprint(key)
+	err := callback(net.JoinHostPort(host, strconv.Itoa(port)), placeholderAddr(host, port), key)
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		c.Status, c.Message = OK, fmt.Sprintf("matches the %s key the server presents (%s)", key.Type(), fingerprint)
+	case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+		c.Status = Fail
+		c.Message = fmt.Sprintf("has a different key recorded than the %s key the server presents (%s); the host was reinstalled, or someone is intercepting the connection", key.Type(), fingerprint)
+		c.Remedy = fmt.Sprintf("Confirm the new fingerprint with the host's administrator, then remove the old entry with 'ssh-keygen -R %s -f %s' and reconnect", knownhosts.Normalize(net.JoinHostPort(host, strconv.Itoa(port))), path)
+	case errors.As(err, &keyErr):
+		c.Status = Warn
+		c.Message = fmt.Sprintf("not trusted yet, the first connection asks to confirm its %s key (%s)", key.Type(), fingerprint)
+		c.Remedy = "Compare the fingerprint with the host's administrator when asked, or import the key with 'klip hostkey import'"
+	default:
+		c.Status, c.Message = Fail, fmt.Sprintf("cannot be checked: %v", err)
+	}
+	return c
+}
+
+// Pinned checks that the key host presents has the fingerprint the
+// profile pins, which klip accepts instead of known_hosts entries
+func Pinned(profile, host, pin string, key gossh.PublicKey) Check {
+	c := Check{Category: "known_hosts", Name: host + " pin"}
+	if cert, ok := key.(*gossh.Certificate); ok {
+		key = cert.Key
+	}
+	fingerprint := gossh.FingerprintSHA256(key)
+	pinned, err := config.NormalizeFingerprint(pin)
+	switch {
+	case err != nil:
+		c.Status, c.Message = Fail, err.Error()
+	case pinned == fingerprint:
+		c.Status, c.Message = OK, fmt.Sprintf("the %s key the server presents has the pinned fingerprint", key.Type())
+	default:
+		c.Status = Fail
+		c.Message = fmt.Sprintf("the %s key the server presents has fingerprint %s, not the pinned %s; the host was reinstalled, or someone is intercepting the connection", key.Type(), fingerprint, pinned)
+		c.Remedy = fmt.Sprintf("Confirm the new fingerprint with the host's administrator, then run 'klip profile pin-key %s'", profile)
+	}
+	return c
+}
+
+// knownKeys returns the keys recorded for host:port, checking it with a
+// key no host can have so the KeyError lists them
+func knownKeys(callback gossh.HostKeyCallback, host string, port int) ([]gossh.PublicKey, error) {
+	probe, err := gossh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil, err
+	}
+	err = callback(net.JoinHostPort(host, strconv.Itoa(port)), placeholderAddr(host, port), probe)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil, err
+	}
+	keys := make([]gossh.PublicKey, len(keyErr.Want))
+	for i, known := range keyErr.Want {
+		keys[i] = known.Key
+	}
+	return keys, nil
+}
+
+// placeholderAddr is the remote address given to a known_hosts callback:
+// host itself if it is an address, so entries for it match
+func placeholderAddr(host string, port int) net.Addr {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+	return &net.TCPAddr{IP: ip, Port: port}
+}
+
+// keyTypes lists the types of keys, e.g. "ssh-ed25519, ecdsa-sha2-nistp256"
+func keyTypes(keys []gossh.PublicKey) string {
+	types := make([]string, len(keys))
+	for i, key := range keys {
+		types[i] = key.Type()
+	}
+	return strings.Join(types, ", ")
+}
+
+// shareKey reports whether a and b have a key in common
+func shareKey(a, b []gossh.PublicKey) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if bytes.Equal(x.Marshal(), y.Marshal()) {
+				return true
+			}
+		}
+	}
+	return false
+}
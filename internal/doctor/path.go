@@ -0,0 +1,184 @@
+// Package doctor - Network path and MTU checks
+// Copyright (c) 2025 orpheus497
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/backend"
+)
+
+// ErrNoPing is returned by a Pinger that cannot send pings on this system
+var ErrNoPing = errors.New("ping is not available")
+
+// Pinger sends one ping of size bytes of payload to host that may not be
+// fragmented, returning nil if it is answered
+type Pinger func(ctx context.Context, host string, size int) error
+
+// BannerChecker reports whether an SSH server answers on host:port, like
+// ssh.CheckBanner
+type BannerChecker func(ctx context.Context, host string, port int) error
+
+// probeMTUs are the packet sizes tried first: Ethernet, the IPv6 minimum
+// most VPNs use, and the IPv4 minimum every path must carry
+var probeMTUs = []int{1500, 1280, 576}
+
+// Path checks that an SSH server answers on addr:port and how large a
+// packet reaches it unfragmented. name labels the checks, e.g. the host or
+// jump host name. Below 1500 bytes on the LAN, or 1280 through a VPN,
+// large packets are likely dropped somewhere, which stalls transfers while
+// small interactive packets still get through.
+func Path(ctx context.Context, name, addr string, port int, backendName string, ping Pinger, banner BannerChecker) []Check {
+	reach := Check{Category: "path", Name: name}
+	if err := banner(ctx, addr, port); err != nil {
+		reach.Status = Fail
+		reach.Message = fmt.Sprintf("no SSH server answers on %s: %v", net.JoinHostPort(addr, strconv.Itoa(port)), err)
+		reach.Remedy = fmt.Sprintf("Check that the host is up, sshd runs on it, port %d is open in its firewall and ssh_port is right", port)
+		return []Check{reach}
+	}
+	reach.Status = OK
+	reach.Message = "SSH server answers on " + net.JoinHostPort(addr, strconv.Itoa(port))
+
+	return []Check{reach, pathMTU(ctx, name, addr, backendName, ping)}
+}
+
+// Route checks that a LAN connection to a host that is also a VPN peer
+// does not cross the open network instead of the VPN, and that one to a
+// profile with require_encrypted_path goes through a VPN at all
+func Route(route *backend.LANRoute, require bool) Check {
+	c := Check{Category: "path", Name: route.Host + " route"}
+	switch {
+	case route.VPN != "":
+		c.Status, c.Message = OK, fmt.Sprintf("the LAN route to %s goes through %s", route.Address, route.VPN)
+		return c
+	case route.Encrypted():
+		c.Status, c.Message = OK, fmt.Sprintf("%s is this machine", route.Address)
+		return c
+	}
+
+	var peers []string
+	for _, peer := range route.Peers {
+		peers = append(peers, peer.Backend)
+	}
+	switch {
+	case require:
+		c.Status = Fail
+		c.Message = fmt.Sprintf("the LAN route to %s crosses the open network, which require_encrypted_path refuses", route.Address)
+		c.Remedy = "Connect a VPN backend that reaches the host and set the profile's backend to it"
+	case len(peers) > 0:
+		c.Status = Warn
+		c.Message = fmt.Sprintf("is a peer on %s, but the LAN route to %s crosses the open network rather than the VPN", strings.Join(peers, ", "), route.Address)
+		c.Remedy = fmt.Sprintf("Connect with --backend %s, or set require_encrypted_path in the profile to refuse the LAN", peers[0])
+	default:
+		c.Status, c.Message = OK, fmt.Sprintf("the LAN route to %s is direct; the host is not a VPN peer", route.Address)
+	}
+	return c
+}
+
+// pathMTU finds the largest packet that reaches addr, narrowing it down
+// when it is smaller than expected
+func pathMTU(ctx context.Context, name, addr, backendName string, ping Pinger) Check {
+	c := Check{Category: "path", Name: name + " MTU"}
+	expected := 1280
+	if backendName == "lan" {
+		expected = 1500
+	}
+
+	// IPv6 headers are 40 bytes, IPv4 ones 20; ICMP adds 8
+	overhead := 28
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		overhead = 48
+	}
+	fits := func(mtu int) (bool, error) {
+		err := ping(ctx, addr, mtu-overhead)
+		if errors.Is(err, ErrNoPing) {
+			return false, err
+		}
+		return err == nil, nil
+	}
+
+	largest, tooLarge := 0, 0
+	for _, mtu := range probeMTUs {
+		ok, err := fits(mtu)
+		if err != nil {
+			c.Status, c.Message = Skip, "ping is not available, the path MTU was not checked"
+			return c
+		}
+		if ok {
+			largest = mtu
+			break
+		}
+		tooLarge = mtu
+	}
+
+	switch {
+	case largest == 0:
+		c.Status, c.Message = Skip, "the host does not answer ping, the path MTU was not checked"
+		return c
+	case largest >= expected:
+		c.Status, c.Message = OK, fmt.Sprintf("%d-byte packets reach the host unfragmented", largest)
+		return c
+	}
+
+	// Narrow it down to 8 bytes between the largest that fit and the
+	// smallest that did not
+	for tooLarge-largest > 8 {
+		mid := (largest + tooLarge) / 2
+		if ok, _ := fits(mid); ok {
+			largest = mid
+		} else {
+			tooLarge = mid
+		}
+	}
+	c.Status = Warn
+	c.Message = fmt.Sprintf("only %d-byte packets reach the host unfragmented, less than the %d expected on %s; large transfers may stall", largest, expected, backendName)
+	c.Remedy = fmt.Sprintf("Lower the MTU of the interface or VPN to %d, or enable MSS clamping on the router in between", largest)
+	return c
+}
+
+// SystemPing pings with the system's ping command, setting the don't
+// fragment flag
+func SystemPing(ctx context.Context, host string, size int) error {
+	ipv6 := strings.Contains(host, ":")
+	var args []string
+	switch runtime.GOOS {
+	case "linux":
+		args = []string{"-c", "1", "-W", "2", "-M", "do", "-s", strconv.Itoa(size), host}
+		if ipv6 {
+			args = append([]string{"-6"}, args...)
+		}
+	case "darwin", "freebsd":
+		if ipv6 {
+			// ping6 cannot forbid fragmentation
+			return ErrNoPing
+		}
+		args = []string{"-c", "1", "-t", "2", "-D", "-s", strconv.Itoa(size), host}
+	case "windows":
+		args = []string{"-n", "1", "-w", "2000", "-f", "-l", strconv.Itoa(size), host}
+	default:
+		return ErrNoPing
+	}
+	if _, err := exec.LookPath("ping"); err != nil {
+		return ErrNoPing
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ping", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ping failed: %w", err)
+	}
+	// Windows ping succeeds even when only an error was answered
+	if runtime.GOOS == "windows" && !strings.Contains(string(out), "TTL=") {
+		return errors.New("no echo reply")
+	}
+	return nil
+}
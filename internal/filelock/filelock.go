@@ -0,0 +1,32 @@
+// Package filelock - Advisory locks on files shared by klip processes
+// Copyright (c) 2025 orpheus497
+package filelock
+
+import (
+	"fmt"
+	"os"
+)
+
+// Suffix is appended to a file's path to name its lock file
+const Suffix = ".lock"
+
+// Lock takes an exclusive lock for the file at path, waiting while another
+// process holds it, and returns a function releasing it. The lock is held
+// on a separate lock file next to path, which stays in place, so it
+// survives path being replaced by a rename. Locks are advisory: they only
+// exclude other callers of Lock.
+func Lock(path string) (func(), error) {
+	f, err := os.OpenFile(path+Suffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
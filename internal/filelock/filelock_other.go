@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+// Package filelock - Platforms without file locks
+// Copyright (c) 2025 orpheus497
+package filelock
+
+import "os"
+
+// lock does nothing where file locks are not available
+func lock(f *os.File) error {
+	return nil
+}
+
+// unlock does nothing where file locks are not available
+func unlock(f *os.File) {}
@@ -0,0 +1,51 @@
+// Package filelock tests
+// Copyright (c) 2025 orpheus497
+package filelock
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockExcludesOtherHolders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	require.NoError(t, os.WriteFile(path, []byte("0"), 0600))
+
+	// Every increment is a read-modify-write that must not interleave
+	const workers, rounds = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				unlock, err := Lock(path)
+				if !assert.NoError(t, err) {
+					return
+				}
+				data, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				n, _ := strconv.Atoi(string(data))
+				assert.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(n+1)), 0600))
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(workers*rounds), string(data))
+	assert.FileExists(t, path+Suffix)
+}
+
+func TestLockMissingDirectory(t *testing.T) {
+	_, err := Lock(filepath.Join(t.TempDir(), "missing", "file"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+// Package filelock - flock on Unix
+// Copyright (c) 2025 orpheus497
+package filelock
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock takes an exclusive flock on f, retrying when a signal interrupts
+// the wait
+func lock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlock releases the flock on f
+func unlock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
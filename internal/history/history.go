@@ -0,0 +1,139 @@
+// Package history records commands run with klip exec per profile
+// Copyright (c) 2025 orpheus497
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	// HistoryDirName is the directory under the XDG state directory that
+	// holds one history file per profile
+	HistoryDirName = "history"
+
+	// MaxEntries is how many commands are kept per profile
+	MaxEntries = 1000
+)
+
+// Entry is a command run on a profile's host
+type Entry struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+}
+
+// History is the command history of one profile, oldest entry first
+// Entries are numbered from 1, as in a shell's history
+type History struct {
+	path    string
+	Entries []Entry
+}
+
+// Path returns the XDG-compliant path to a profile's history file
+func Path(profile string) (string, error) {
+	dir := filepath.Join(xdg.StateHome, "klip", HistoryDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return filepath.Join(dir, profile+".json"), nil
+}
+
+// Load loads a profile's history from disk
+// A missing history file yields an empty history
+func Load(profile string) (*History, error) {
+	path, err := Path(profile)
+	if err != nil {
+		return nil, err
+	}
+	return load(path)
+}
+
+// load loads the history file at path
+func load(path string) (*History, error) {
+	h := &History{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &h.Entries); err != nil {
+		return nil, fmt.Errorf("failed to parse history %s: %w", path, err)
+	}
+
+	return h, nil
+}
+
+// Add appends a command and writes the history to disk, dropping the
+// oldest entries beyond MaxEntries
+func (h *History) Add(command string) error {
+	h.Entries = append(h.Entries, Entry{Command: command, Time: time.Now()})
+	if len(h.Entries) > MaxEntries {
+		h.Entries = h.Entries[len(h.Entries)-MaxEntries:]
+	}
+
+	return h.save()
+}
+
+// Clear removes all entries and writes the history to disk
+func (h *History) Clear() error {
+	h.Entries = nil
+	return h.save()
+}
+
+// Expand resolves a history reference: "!N" is entry N, "!-N" the Nth
+// most recent entry and "!!" the most recent one
+// ok is false if ref is not a history reference
+func (h *History) Expand(ref string) (command string, ok bool, err error) {
+	if !strings.HasPrefix(ref, "!") || strings.ContainsAny(ref, " \t") {
+		return "", false, nil
+	}
+
+	var index int
+	switch num := ref[1:]; {
+	case num == "!":
+		index = len(h.Entries)
+	case strings.HasPrefix(num, "-"):
+		n, err := strconv.Atoi(num[1:])
+		if err != nil || n < 1 {
+			return "", true, fmt.Errorf("invalid history reference '%s'", ref)
+		}
+		index = len(h.Entries) + 1 - n
+	default:
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return "", true, fmt.Errorf("invalid history reference '%s'", ref)
+		}
+		index = n
+	}
+
+	if index < 1 || index > len(h.Entries) {
+		return "", true, fmt.Errorf("%s: event not found", ref)
+	}
+
+	return h.Entries[index-1].Command, true, nil
+}
+
+// save writes the history to disk
+func (h *History) save() error {
+	data, err := json.MarshalIndent(h.Entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal history: %w", err)
+	}
+
+	if err := os.WriteFile(h.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+
+	return nil
+}
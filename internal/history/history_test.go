@@ -0,0 +1,79 @@
+// Package history tests
+// Copyright (c) 2025 orpheus497
+package history
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHistory(t *testing.T) *History {
+	return &History{path: filepath.Join(t.TempDir(), "web.json")}
+}
+
+func TestHistoryAdd(t *testing.T) {
+	h := newTestHistory(t)
+	require.NoError(t, h.Add("uptime"))
+	require.NoError(t, h.Add("df -h"))
+
+	loaded, err := load(h.path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Entries, 2)
+	assert.Equal(t, "uptime", loaded.Entries[0].Command)
+	assert.Equal(t, "df -h", loaded.Entries[1].Command)
+
+	require.NoError(t, loaded.Clear())
+	loaded, err = load(h.path)
+	require.NoError(t, err)
+	assert.Empty(t, loaded.Entries)
+}
+
+func TestHistoryTrim(t *testing.T) {
+	h := newTestHistory(t)
+	for i := 0; i < MaxEntries; i++ {
+		h.Entries = append(h.Entries, Entry{Command: "old"})
+	}
+	require.NoError(t, h.Add("new"))
+
+	assert.Len(t, h.Entries, MaxEntries)
+	assert.Equal(t, "new", h.Entries[MaxEntries-1].Command)
+}
+
+func TestHistoryExpand(t *testing.T) {
+	h := newTestHistory(t)
+	h.Entries = []Entry{{Command: "uptime"}, {Command: "df -h"}, {Command: "free -m"}}
+
+	tests := []struct {
+		ref     string
+		want    string
+		ok      bool
+		wantErr bool
+	}{
+		{"!1", "uptime", true, false},
+		{"!3", "free -m", true, false},
+		{"!!", "free -m", true, false},
+		{"!-2", "df -h", true, false},
+		{"!4", "", true, true},
+		{"!0", "", true, true},
+		{"!-4", "", true, true},
+		{"!abc", "", true, true},
+		{"uptime", "", false, false},
+		{"! echo", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, ok, err := h.Expand(tt.ref)
+			assert.Equal(t, tt.ok, ok)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,343 @@
+// Package integrity provides checksum manifests of remote directories for klip
+// Copyright (c) 2025 orpheus497
+package integrity
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/pkg/sftp"
+)
+
+const (
+	// Algorithm is the hash algorithm used for manifests
+	Algorithm = "sha256"
+
+	// ManifestsDirName is the directory holding stored manifests
+	ManifestsDirName = "manifests"
+)
+
+// hashScript hashes every regular file below the current directory with
+// whichever SHA-256 tool the remote host provides
+const hashScript = `if command -v sha256sum >/dev/null 2>&1; then h="sha256sum"; ` +
+	`elif command -v shasum >/dev/null 2>&1; then h="shasum -a 256"; ` +
+	`else exit 127; fi; find . -type f -exec $h {} +`
+
+// Manifest records the hashes of all files below a remote directory
+type Manifest struct {
+	// Profile is the profile the manifest was created with
+	Profile string `json:"profile"`
+
+	// Host is the remote host the manifest was created on
+	Host string `json:"host"`
+
+	// Dir is the remote directory, as given when creating the manifest
+	Dir string `json:"dir"`
+
+	// Algorithm is the hash algorithm (always sha256)
+	Algorithm string `json:"algorithm"`
+
+	// CreatedAt is when the manifest was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// Files maps slash-separated paths relative to Dir to hex digests
+	Files map[string]string `json:"files"`
+}
+
+// Drift describes how a directory differs from its manifest
+type Drift struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// Empty reports whether the directory matches the manifest
+func (d *Drift) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Create hashes all files below dir on the remote host
+// Hashing runs remotely when sha256sum or shasum is available; otherwise
+// files are streamed over SFTP and hashed locally
+func Create(ctx context.Context, client *ssh.Client, profile, host, dir string) (*Manifest, error) {
+	files := make(map[string]string)
+	add := func(name, sum string) { files[name] = sum }
+
+	if err := hashRemote(ctx, client, dir, add); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		files = make(map[string]string)
+		if err := hashSFTP(ctx, client, dir, add); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Manifest{
+		Profile:   profile,
+		Host:      host,
+		Dir:       dir,
+		Algorithm: Algorithm,
+		CreatedAt: time.Now(),
+		Files:     files,
+	}, nil
+}
+
+// Compare reports the differences between the manifest and current hashes
+func (m *Manifest) Compare(current map[string]string) *Drift {
+	drift := &Drift{}
+
+	for name, sum := range current {
+		want, ok := m.Files[name]
+		switch {
+		case !ok:
+			drift.Added = append(drift.Added, name)
+		case want != sum:
+			drift.Modified = append(drift.Modified, name)
+		}
+	}
+	for name := range m.Files {
+		if _, ok := current[name]; !ok {
+			drift.Removed = append(drift.Removed, name)
+		}
+	}
+
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+	sort.Strings(drift.Modified)
+
+	return drift
+}
+
+// Verify hashes the files below the manifest's directory again and
+// reports how they differ from it. Hashes are compared as they arrive
+// rather than collected, so large trees do not need a second copy of the
+// manifest in memory; in exchange every file seen is removed from
+// m.Files, which afterwards holds only the removed files.
+func (m *Manifest) Verify(ctx context.Context, client *ssh.Client) (*Drift, error) {
+	drift := &Drift{}
+	seen := 0
+	compare := func(name, sum string) {
+		seen++
+		want, ok := m.Files[name]
+		switch {
+		case !ok:
+			drift.Added = append(drift.Added, name)
+		case want != sum:
+			drift.Modified = append(drift.Modified, name)
+		}
+		delete(m.Files, name)
+	}
+
+	// Files already compared cannot be compared again, so SFTP only takes
+	// over if the remote tool failed before hashing anything
+	err := hashRemote(ctx, client, m.Dir, compare)
+	if err != nil && seen == 0 && ctx.Err() == nil {
+		err = hashSFTP(ctx, client, m.Dir, compare)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	for name := range m.Files {
+		drift.Removed = append(drift.Removed, name)
+	}
+
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+	sort.Strings(drift.Modified)
+
+	return drift, nil
+}
+
+// ManifestPath returns the default location of the manifest for a profile
+// and remote directory
+func ManifestPath(profile, dir string) (string, error) {
+	manifestDir := filepath.Join(xdg.DataHome, "klip", ManifestsDirName, profile)
+	if err := os.MkdirAll(manifestDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(manifestDir, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// Save writes the manifest to path
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads a manifest from path
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if m.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported manifest algorithm: %q", m.Algorithm)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]string)
+	}
+
+	return &m, nil
+}
+
+// hashRemote hashes files with a hashing tool on the remote host, calling
+// visit with each file's relative path and digest as its line arrives
+func hashRemote(ctx context.Context, client *ssh.Client, dir string, visit func(name, sum string)) error {
+	command := "cd -- " + remoteDirArg(dir) + " && { " + hashScript + "; }"
+
+	var parseErr error
+	var stderr []string
+	err := client.RunCommandLines(ctx, command, func(line string, isStderr bool) {
+		if isStderr {
+			stderr = append(stderr, line)
+			return
+		}
+		name, sum, err := parseHashLine(line)
+		if err != nil {
+			if parseErr == nil {
+				parseErr = err
+			}
+			return
+		}
+		visit(name, sum)
+	})
+	if err != nil {
+		if len(stderr) > 0 {
+			return fmt.Errorf("failed to hash remote files: %w: %s", err, strings.Join(stderr, "; "))
+		}
+		return fmt.Errorf("failed to hash remote files: %w", err)
+	}
+
+	return parseErr
+}
+
+// parseHashLine parses a line of sha256sum output into a relative path and
+// its digest. Lines for names containing a newline or backslash start with
+// a backslash and have those characters escaped.
+func parseHashLine(line string) (string, string, error) {
+	escaped := strings.HasPrefix(line, `\`)
+	if escaped {
+		line = line[1:]
+	}
+
+	sum, name, ok := strings.Cut(line, " ")
+	if !ok || len(sum) != sha256.Size*2 {
+		return "", "", fmt.Errorf("unexpected hash output: %q", line)
+	}
+	// Text mode uses two spaces, binary mode a space and an asterisk
+	name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+
+	if escaped {
+		name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+	}
+
+	return strings.TrimPrefix(name, "./"), strings.ToLower(sum), nil
+}
+
+// hashSFTP hashes files by streaming them over SFTP, calling visit with
+// each file's relative path and digest
+func hashSFTP(ctx context.Context, client *ssh.Client, dir string, visit func(name, sum string)) error {
+	sftpClient, err := sftp.NewClient(client.GetClient())
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	root := dir
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok || dir == "~" {
+		home, err := sftpClient.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get remote home directory: %w", err)
+		}
+		root = path.Join(home, rest)
+	}
+
+	walker := sftpClient.Walk(root)
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := walker.Err(); err != nil {
+			return fmt.Errorf("failed to walk %s: %w", walker.Path(), err)
+		}
+		if !walker.Stat().Mode().IsRegular() {
+			continue
+		}
+
+		sum, err := hashSFTPFile(sftpClient, walker.Path())
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), root), "/")
+		visit(rel, sum)
+	}
+
+	return nil
+}
+
+// hashSFTPFile returns the hex SHA-256 digest of a remote file
+func hashSFTPFile(client *sftp.Client, name string) (string, error) {
+	f, err := client.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, bufio.NewReader(f)); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteDirArg quotes dir for the remote shell, keeping a leading ~/
+// expandable
+func remoteDirArg(dir string) string {
+	if dir == "~" {
+		return `"$HOME"`
+	}
+	if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		return `"$HOME"/` + quote(rest)
+	}
+	return quote(dir)
+}
+
+// quote single-quotes s for a POSIX shell
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
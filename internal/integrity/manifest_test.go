@@ -0,0 +1,152 @@
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHashLine(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{sum + "  ./file.txt", "file.txt"},
+		{sum + " *./bin/tool", "bin/tool"},
+		{sum + "  ./with space", "with space"},
+		{`\` + sum + `  ./new\nline`, "new\nline"},
+		{`\` + sum + `  ./back\\slash`, `back\slash`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			name, got, err := parseHashLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, name)
+			assert.Equal(t, sum, got)
+		})
+	}
+
+	_, _, err := parseHashLine("find: ./secret: Permission denied")
+	assert.Error(t, err)
+}
+
+func TestManifestCompare(t *testing.T) {
+	m := &Manifest{Files: map[string]string{
+		"same":    "1",
+		"changed": "2",
+		"gone":    "3",
+	}}
+
+	drift := m.Compare(map[string]string{
+		"same":    "1",
+		"changed": "4",
+		"new":     "5",
+	})
+
+	assert.False(t, drift.Empty())
+	assert.Equal(t, []string{"new"}, drift.Added)
+	assert.Equal(t, []string{"gone"}, drift.Removed)
+	assert.Equal(t, []string{"changed"}, drift.Modified)
+
+	assert.True(t, m.Compare(m.Files).Empty())
+}
+
+func TestManifestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m := &Manifest{
+		Profile:   "web",
+		Dir:       "/srv/www",
+		Algorithm: Algorithm,
+		Files:     map[string]string{"index.html": "abc"},
+	}
+	require.NoError(t, m.Save(path))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, m.Files, loaded.Files)
+	assert.Equal(t, "/srv/www", loaded.Dir)
+}
+
+func TestRemoteDirArg(t *testing.T) {
+	assert.Equal(t, `"$HOME"`, remoteDirArg("~"))
+	assert.Equal(t, `"$HOME"/'site files'`, remoteDirArg("~/site files"))
+	assert.Equal(t, `'/srv/it'"'"'s'`, remoteDirArg("/srv/it's"))
+}
+
+// connectTestServer connects to an SSH server that serves only SFTP, so
+// hashing falls back from the remote tools to SFTP
+func connectTestServer(t *testing.T) *ssh.Client {
+	env := clitest.NewEnv(t)
+	server := env.StartSSHServer()
+	client, err := ssh.NewClient(&ssh.Config{
+		Host:           server.Host,
+		Port:           server.Port,
+		User:           "test",
+		KeyPath:        server.KeyPath,
+		NonInteractive: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestManifestVerify(t *testing.T) {
+	client := connectTestServer(t)
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	write("same.txt", "same")
+	write("sub/changed.txt", "before")
+	write("gone.txt", "gone")
+
+	m, err := Create(context.Background(), client, "test", "127.0.0.1", dir)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 3)
+	assert.Equal(t, hex.EncodeToString(sha256Sum("same")), m.Files["same.txt"])
+
+	// Unchanged, the directory matches its manifest, and every file seen
+	// is removed from the manifest
+	drift, err := m.Verify(context.Background(), client)
+	require.NoError(t, err)
+	assert.True(t, drift.Empty(), "%+v", drift)
+	assert.Empty(t, m.Files)
+
+	m, err = Create(context.Background(), client, "test", "127.0.0.1", dir)
+	require.NoError(t, err)
+	write("sub/changed.txt", "after")
+	write("new.txt", "new")
+	require.NoError(t, os.Remove(filepath.Join(dir, "gone.txt")))
+
+	drift, err = m.Verify(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new.txt"}, drift.Added)
+	assert.Equal(t, []string{"gone.txt"}, drift.Removed)
+	assert.Equal(t, []string{"sub/changed.txt"}, drift.Modified)
+	assert.Equal(t, map[string]string{"gone.txt": hex.EncodeToString(sha256Sum("gone"))}, m.Files, "only the removed files are left")
+
+	// A cancelled verification reports the cancellation, not drift
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = m.Verify(ctx, client)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func sha256Sum(content string) []byte {
+	sum := sha256.Sum256([]byte(content))
+	return sum[:]
+}
@@ -0,0 +1,263 @@
+// Package location detects the network klip runs on and picks the
+// matching entry of settings.locations, whose profile overrides apply
+// Copyright (c) 2025 orpheus497
+package location
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/config"
+)
+
+// Network identifies the network the machine is on; what cannot be
+// detected is left empty
+type Network struct {
+	SSID    string `json:"ssid,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	Tailnet string `json:"tailnet,omitempty"`
+}
+
+// String lists the detected values, e.g. "ssid HomeWifi, gateway 192.168.1.1"
+func (n Network) String() string {
+	var parts []string
+	if n.SSID != "" {
+		parts = append(parts, "ssid "+n.SSID)
+	}
+	if n.Gateway != "" {
+		parts = append(parts, "gateway "+n.Gateway)
+	}
+	if n.Tailnet != "" {
+		parts = append(parts, "tailnet "+n.Tailnet)
+	}
+	if len(parts) == 0 {
+		return "nothing detected"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Detect finds the Wi-Fi network, default gateway and tailnet
+func Detect(ctx context.Context) Network {
+	return Network{
+		SSID:    detectSSID(ctx),
+		Gateway: detectGateway(ctx),
+		Tailnet: detectTailnet(ctx),
+	}
+}
+
+// Match returns the first location n matches, with the criteria that
+// matched, or nil if none does
+func Match(locations []config.Location, n Network) (*config.Location, string) {
+	for i := range locations {
+		if reason, ok := matches(&locations[i], n); ok {
+			return &locations[i], reason
+		}
+	}
+	return nil, ""
+}
+
+// matches reports whether every kind of criterion of l has a value equal
+// to n's, listing them
+func matches(l *config.Location, n Network) (string, bool) {
+	var reasons []string
+	for _, criterion := range []struct {
+		kind   string
+		values []string
+		value  string
+	}{
+		{"ssid", l.SSIDs, n.SSID},
+		{"gateway", l.Gateways, n.Gateway},
+		{"tailnet", l.Tailnets, n.Tailnet},
+	} {
+		if len(criterion.values) == 0 {
+			continue
+		}
+		if !contains(criterion.values, criterion.value) {
+			return "", false
+		}
+		reasons = append(reasons, criterion.kind+" "+criterion.value)
+	}
+	return strings.Join(reasons, ", "), len(reasons) > 0
+}
+
+// contains reports whether value is one of values; tailnet and SSID names
+// are compared as given, gateways as addresses
+func contains(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+		if ip := net.ParseIP(v); ip != nil && ip.Equal(net.ParseIP(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// output runs a command, returning its output or "" if it fails
+func output(ctx context.Context, name string, args ...string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// detectSSID returns the name of the Wi-Fi network the machine is on
+func detectSSID(ctx context.Context) string {
+	switch runtime.GOOS {
+	case "linux":
+		if ssid := strings.TrimSpace(output(ctx, "iwgetid", "-r")); ssid != "" {
+			return ssid
+		}
+		return parseNmcliSSID(output(ctx, "nmcli", "-t", "-f", "active,ssid", "dev", "wifi"))
+	case "darwin":
+		if ssid := parseAirportNetwork(output(ctx, "networksetup", "-getairportnetwork", "en0")); ssid != "" {
+			return ssid
+		}
+		return parseField(output(ctx, "ipconfig", "getsummary", "en0"), "SSID")
+	case "windows":
+		return parseField(output(ctx, "netsh", "wlan", "show", "interfaces"), "SSID")
+	case "freebsd":
+		return parseIfconfigSSID(output(ctx, "ifconfig", "wlan0"))
+	}
+	return ""
+}
+
+// detectGateway returns the address of the default gateway
+func detectGateway(ctx context.Context) string {
+	switch runtime.GOOS {
+	case "linux":
+		routes, err := os.ReadFile("/proc/net/route")
+		if err != nil {
+			return ""
+		}
+		return parseProcRoute(string(routes))
+	case "windows":
+		return parseRoutePrint(output(ctx, "route", "print", "-4", "0.0.0.0"))
+	}
+	// macOS and the BSDs
+	return parseField(output(ctx, "route", "-n", "get", "default"), "gateway")
+}
+
+// detectTailnet returns the tailnet Tailscale is logged in to
+func detectTailnet(ctx context.Context) string {
+	tailnet, err := (&backend.TailscaleBackend{}).Tailnet(ctx)
+	if err != nil {
+		return ""
+	}
+	return tailnet
+}
+
+// parseNmcliSSID finds the active network in nmcli's terse output, where
+// colons in names are escaped
+func parseNmcliSSID(out string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if ssid, ok := strings.CutPrefix(scanner.Text(), "yes:"); ok {
+			return strings.ReplaceAll(ssid, `\:`, ":")
+		}
+	}
+	return ""
+}
+
+// parseAirportNetwork reads "Current Wi-Fi Network: <name>"
+func parseAirportNetwork(out string) string {
+	_, ssid, ok := strings.Cut(strings.TrimSpace(out), "Network: ")
+	if !ok {
+		return ""
+	}
+	return ssid
+}
+
+// parseField returns the value of the first "name : value" line, as in
+// the output of netsh, ipconfig getsummary and route get
+func parseField(out, name string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// ifconfigSSID matches the network of FreeBSD's ifconfig, quoted if it
+// contains spaces
+var ifconfigSSID = regexp.MustCompile(`\bssid ("[^"]*"|\S+) channel`)
+
+// parseIfconfigSSID reads the ssid of a wlan interface's ifconfig output
+func parseIfconfigSSID(out string) string {
+	m := ifconfigSSID.FindStringSubmatch(out)
+	if m == nil {
+		return ""
+	}
+	return strings.Trim(m[1], `"`)
+}
+
+// parseProcRoute finds the default route in /proc/net/route, whose
+// addresses are hex in host (little-endian) byte order
+func parseProcRoute(routes string) string {
+	scanner := bufio.NewScanner(strings.NewReader(routes))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		if !ip.IsUnspecified() {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// parseRoutePrint finds the default route in Windows' route print output:
+// destination 0.0.0.0, netmask 0.0.0.0, then the gateway
+func parseRoutePrint(out string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[0] == "0.0.0.0" && fields[1] == "0.0.0.0" && net.ParseIP(fields[2]) != nil {
+			return fields[2]
+		}
+	}
+	return ""
+}
+
+// Explain describes how a location was chosen for a profile, for verbose
+// output
+func Explain(n Network, matched *config.Location, reason string, changes []string) []string {
+	steps := []string{fmt.Sprintf("network: %s", n)}
+	switch {
+	case matched == nil:
+		steps = append(steps, "no location matches, the profile is used as configured")
+	case len(changes) == 0:
+		steps = append(steps, fmt.Sprintf("location %s matches (%s), but the profile has no overrides for it", matched.Name, reason))
+	default:
+		steps = append(steps, fmt.Sprintf("location %s matches (%s), applying %s", matched.Name, reason, strings.Join(changes, ", ")))
+	}
+	return steps
+}
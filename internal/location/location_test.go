@@ -0,0 +1,97 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	locations := []config.Location{
+		{Name: "office", SSIDs: []string{"Corp"}, Gateways: []string{"10.0.0.1"}},
+		{Name: "home", SSIDs: []string{"HomeWifi", "HomeWifi-5G"}},
+		{Name: "wired-home", Gateways: []string{"192.168.1.1"}},
+		{Name: "work-tailnet", Tailnets: []string{"corp.example.com"}},
+	}
+
+	matched, reason := Match(locations, Network{SSID: "HomeWifi-5G", Gateway: "192.168.1.1"})
+	require.NotNil(t, matched)
+	assert.Equal(t, "home", matched.Name)
+	assert.Equal(t, "ssid HomeWifi-5G", reason)
+
+	// Every kind a location lists must match
+	matched, _ = Match(locations, Network{SSID: "Corp", Gateway: "10.0.0.254"})
+	assert.Nil(t, matched)
+	matched, reason = Match(locations, Network{SSID: "Corp", Gateway: "10.0.0.1"})
+	require.NotNil(t, matched)
+	assert.Equal(t, "ssid Corp, gateway 10.0.0.1", reason)
+
+	// Gateways compare as addresses
+	matched, _ = Match(locations, Network{Gateway: "::ffff:192.168.1.1"})
+	require.NotNil(t, matched)
+	assert.Equal(t, "wired-home", matched.Name)
+
+	matched, _ = Match(locations, Network{Tailnet: "corp.example.com"})
+	require.NotNil(t, matched)
+	assert.Equal(t, "work-tailnet", matched.Name)
+
+	matched, _ = Match(locations, Network{})
+	assert.Nil(t, matched)
+}
+
+func TestParseGateway(t *testing.T) {
+	routes := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	0000A8C0	00000000	0001	0	0	600	00FFFFFF	0	0	0
+wlan0	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+`
+	assert.Equal(t, "192.168.1.1", parseProcRoute(routes))
+	assert.Empty(t, parseProcRoute("Iface\tDestination\tGateway\n"))
+
+	routeGet := `   route to: default
+destination: default
+       mask: default
+    gateway: 10.0.0.1
+  interface: en0
+`
+	assert.Equal(t, "10.0.0.1", parseField(routeGet, "gateway"))
+
+	routePrint := `IPv4 Route Table
+===========================================================================
+Active Routes:
+Network Destination        Netmask          Gateway       Interface  Metric
+          0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.20     25
+===========================================================================
+`
+	assert.Equal(t, "192.168.1.1", parseRoutePrint(routePrint))
+}
+
+func TestParseSSID(t *testing.T) {
+	assert.Equal(t, "Cafe: Guest", parseNmcliSSID("no:Neighbour\nyes:Cafe\\: Guest\n"))
+	assert.Empty(t, parseNmcliSSID("no:Neighbour\n"))
+
+	assert.Equal(t, "HomeWifi", parseAirportNetwork("Current Wi-Fi Network: HomeWifi\n"))
+	assert.Empty(t, parseAirportNetwork("You are not associated with an AirPort network.\n"))
+
+	netsh := `    Name                   : Wi-Fi
+    State                  : connected
+    SSID                   : HomeWifi
+    BSSID                  : aa:bb:cc:dd:ee:ff
+`
+	assert.Equal(t, "HomeWifi", parseField(netsh, "SSID"))
+
+	assert.Equal(t, "Home Wifi", parseIfconfigSSID("\tssid \"Home Wifi\" channel 6 (2437 MHz 11g) bssid aa:bb:cc:dd:ee:ff\n"))
+	assert.Equal(t, "HomeWifi", parseIfconfigSSID("\tssid HomeWifi channel 6 (2437 MHz 11g)\n"))
+}
+
+func TestExplain(t *testing.T) {
+	n := Network{SSID: "HomeWifi"}
+	home := &config.Location{Name: "home"}
+	assert.Equal(t, []string{
+		"network: ssid HomeWifi",
+		"location home matches (ssid HomeWifi), applying backend lan, remote_host 192.168.1.20",
+	}, Explain(n, home, "ssid HomeWifi", []string{"backend lan", "remote_host 192.168.1.20"}))
+	assert.Equal(t, "no location matches, the profile is used as configured", Explain(Network{}, nil, "", nil)[1])
+	assert.Equal(t, "network: nothing detected", Explain(Network{}, nil, "", nil)[0])
+}
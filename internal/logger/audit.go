@@ -4,9 +4,11 @@ package logger
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -33,8 +35,10 @@ type AuditEvent struct {
 // AuditLogger logs security and operational events
 // Thread-safe implementation with JSON output
 type AuditLogger struct {
+	path    string
 	file    *os.File
 	encoder *json.Encoder
+	sinks   []*sink
 	enabled bool
 	mu      sync.Mutex
 }
@@ -47,24 +51,59 @@ func NewAuditLogger(enabled bool) (*AuditLogger, error) {
 	}
 
 	// Get XDG-compliant state directory for audit log
-	auditPath := filepath.Join(xdg.StateHome, "klip", "audit.log")
+	auditPath := filepath.Join(xdg.StateHome, "klip", AuditLogName)
 
 	// Ensure directory exists with secure permissions
 	if err := os.MkdirAll(filepath.Dir(auditPath), 0700); err != nil {
 		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
 	}
 
-	// Open audit log file (append mode, create if not exists)
-	file, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	// Rotate according to the policy; a failed rotation must not stop
+	// events from being recorded
+	_ = rotateAuditLog(filepath.Dir(auditPath), Rotation, time.Now())
+
+	a := &AuditLogger{path: auditPath, sinks: openSinks(), enabled: true}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// open opens the audit log file for appending, creating it if needed
+func (a *AuditLogger) open() error {
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	a.file = file
+	a.encoder = json.NewEncoder(file)
+	return nil
+}
+
+// reopenIfRotated switches to a new audit log file when the open one was
+// rotated or removed, by this or another process, or is itself due for
+// rotation, so long-running commands keep writing to the active log
+// rather than to an archive that is compressed and deleted under them;
+// callers must hold a.mu
+func (a *AuditLogger) reopenIfRotated(now time.Time) error {
+	current, err := a.file.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open audit log: %w", err)
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	onDisk, err := os.Stat(a.path)
+	if err == nil && os.SameFile(current, onDisk) {
+		if !rotationDue(a.path, onDisk.Size(), Rotation, now) {
+			return nil
+		}
+		_ = rotateAuditLog(filepath.Dir(a.path), Rotation, now)
 	}
 
-	return &AuditLogger{
-		file:    file,
-		encoder: json.NewEncoder(file),
-		enabled: true,
-	}, nil
+	old := a.file
+	if err := a.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return nil
 }
 
 // Log logs a generic audit event
@@ -81,15 +120,31 @@ func (a *AuditLogger) Log(event AuditEvent) error {
 	event.Timestamp = time.Now().UTC()
 
 	// Encode and write to file
+	if err := a.reopenIfRotated(event.Timestamp); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
 	if err := a.encoder.Encode(event); err != nil {
 		return fmt.Errorf("failed to write audit event: %w", err)
 	}
 
-	return nil
+	// Ship to the sinks; the file stays the complete record if they fail
+	if len(a.sinks) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+	var errs []error
+	for _, s := range a.sinks {
+		errs = append(errs, s.send(event, line))
+	}
+	return errors.Join(errs...)
 }
 
 // LogConnection logs a connection event (success or failure)
-func (a *AuditLogger) LogConnection(profile, user, host, backend, status string, err error) error {
+// metadata records what was actually connected to (address, host key, auth method)
+func (a *AuditLogger) LogConnection(profile, user, host, backend, status string, metadata map[string]string, err error) error {
 	event := AuditEvent{
 		EventType: "connection",
 		Profile:   profile,
@@ -97,6 +152,7 @@ func (a *AuditLogger) LogConnection(profile, user, host, backend, status string,
 		Host:      host,
 		Backend:   backend,
 		Status:    status,
+		Metadata:  metadata,
 	}
 
 	if err != nil {
@@ -127,6 +183,64 @@ func (a *AuditLogger) LogTransfer(profile, user, host, backend, operation, sourc
 	return a.Log(event)
 }
 
+// LogScan logs a pre-upload scan and whether it blocked the transfer
+func (a *AuditLogger) LogScan(profile, user, host, backend, source, status string, metadata map[string]string, err error) error {
+	event := AuditEvent{
+		EventType: "scan",
+		Profile:   profile,
+		User:      user,
+		Host:      host,
+		Backend:   backend,
+		Operation: "pre_upload_scan",
+		Source:    source,
+		Status:    status,
+		Metadata:  metadata,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	return a.Log(event)
+}
+
+// LogConflict logs how a sync conflict was resolved and whether the user
+// or the --prefer policy decided
+func (a *AuditLogger) LogConflict(profile, user, host, backend, path, resolution, decidedBy string) error {
+	return a.Log(AuditEvent{
+		EventType: "sync_conflict",
+		Profile:   profile,
+		User:      user,
+		Host:      host,
+		Backend:   backend,
+		Operation: "resolve_conflict",
+		Source:    path,
+		Status:    resolution,
+		Metadata:  map[string]string{"decided_by": decidedBy},
+	})
+}
+
+// LogDivergence logs a change in whether the two sides of a monitored
+// sync pair differ, with the number of differing files
+func (a *AuditLogger) LogDivergence(profile, user, host, backend, source, dest string, files int) error {
+	status := "in_sync"
+	if files > 0 {
+		status = "diverged"
+	}
+	return a.Log(AuditEvent{
+		EventType:   "sync_divergence",
+		Profile:     profile,
+		User:        user,
+		Host:        host,
+		Backend:     backend,
+		Operation:   "monitor",
+		Source:      source,
+		Destination: dest,
+		Status:      status,
+		Metadata:    map[string]string{"files": strconv.Itoa(files)},
+	})
+}
+
 // LogProfileChange logs profile creation, modification, or deletion
 func (a *AuditLogger) LogProfileChange(profile, operation, status string, err error) error {
 	event := AuditEvent{
@@ -190,12 +304,15 @@ func (a *AuditLogger) Close() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	for _, s := range a.sinks {
+		s.close()
+	}
 	return a.file.Close()
 }
 
 // GetAuditLogPath returns the path to the audit log file
 func GetAuditLogPath() (string, error) {
-	return filepath.Join(xdg.StateHome, "klip", "audit.log"), nil
+	return filepath.Join(xdg.StateHome, "klip", AuditLogName), nil
 }
 
 // IsEnabled returns whether audit logging is enabled
@@ -0,0 +1,142 @@
+// Package logger - Audit log queries
+// Copyright (c) 2025 orpheus497
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditQuery selects audit events; empty fields match every event
+type AuditQuery struct {
+	EventType string
+	Status    string
+	Profile   string
+
+	// Since and Until bound the event timestamps (zero is unbounded)
+	Since time.Time
+	Until time.Time
+
+	// Limit keeps only the most recent events (0 keeps all)
+	Limit int
+}
+
+// Match reports whether an event is selected by the query
+func (q AuditQuery) Match(event AuditEvent) bool {
+	switch {
+	case q.EventType != "" && event.EventType != q.EventType:
+		return false
+	case q.Status != "" && event.Status != q.Status:
+		return false
+	case q.Profile != "" && event.Profile != q.Profile:
+		return false
+	case !q.Since.IsZero() && event.Timestamp.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && event.Timestamp.After(q.Until):
+		return false
+	}
+	return true
+}
+
+// QueryAuditLog returns the events of the audit log and its archives
+// selected by q, oldest first
+func QueryAuditLog(q AuditQuery) ([]AuditEvent, error) {
+	return queryAuditDir(auditDir(), q)
+}
+
+// queryAuditDir searches the audit log and archives in dir
+func queryAuditDir(dir string, q AuditQuery) ([]AuditEvent, error) {
+	archives, err := auditArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []AuditEvent
+	for _, archive := range archives {
+		// An archive only holds events from before its rotation
+		if !q.Since.IsZero() && archive.rotated.Before(q.Since) {
+			continue
+		}
+		if err := scanAuditFile(archive.path, archive.compressed, q, &events); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanAuditFile(filepath.Join(dir, AuditLogName), false, q, &events); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+	return events, nil
+}
+
+// scanAuditFile appends the events of a log file selected by q to events,
+// skipping lines that are not events. A missing file has no events.
+func scanAuditFile(path string, compressed bool, q AuditQuery, events *[]AuditEvent) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compressed {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if q.Match(event) {
+			*events = append(*events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// ParseSince parses a point in time given as an age before now, such as
+// "90m", "36h", "7d" or "2w", or as a date ("2025-01-31") or RFC 3339 time
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, suffix)); err == nil && strings.HasSuffix(value, suffix) && n >= 0 {
+			return now.Add(-time.Duration(n) * unit), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s' (use e.g. 36h, 7d, 2w, 2025-01-31 or an RFC 3339 time)", value)
+}
@@ -0,0 +1,83 @@
+// Package logger tests
+// Copyright (c) 2025 orpheus497
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryAuditLog(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	dir := t.TempDir()
+
+	// An old compressed archive, a recent one and the active log
+	writeAuditLog(t, filepath.Join(dir, "audit-20250501T000000.000Z.log"),
+		AuditEvent{Timestamp: now.Add(-40 * day), EventType: "transfer", Status: "failed", Profile: "web"})
+	require.NoError(t, compressArchive(filepath.Join(dir, "audit-20250501T000000.000Z.log")))
+	writeAuditLog(t, filepath.Join(dir, "audit-20250530T000000.000Z.log"),
+		AuditEvent{Timestamp: now.Add(-3 * day), EventType: "transfer", Status: "failed", Profile: "db"},
+		AuditEvent{Timestamp: now.Add(-3 * day), EventType: "connection", Status: "failed", Profile: "db"})
+	writeAuditLog(t, filepath.Join(dir, AuditLogName),
+		AuditEvent{Timestamp: now.Add(-time.Hour), EventType: "transfer", Status: "success", Profile: "web"},
+		AuditEvent{Timestamp: now.Add(-time.Minute), EventType: "transfer", Status: "failed", Profile: "web"})
+
+	// A torn line from an interrupted write is skipped
+	file, err := os.OpenFile(filepath.Join(dir, AuditLogName), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"timestamp":`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	t.Run("filters by type, status and time", func(t *testing.T) {
+		events, err := queryAuditDir(dir, AuditQuery{EventType: "transfer", Status: "failed", Since: now.Add(-7 * day)})
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "db", events[0].Profile)
+		assert.Equal(t, "web", events[1].Profile)
+	})
+
+	t.Run("searches compressed archives", func(t *testing.T) {
+		events, err := queryAuditDir(dir, AuditQuery{Status: "failed", Profile: "web"})
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.True(t, events[0].Timestamp.Before(events[1].Timestamp))
+	})
+
+	t.Run("limits to the most recent events", func(t *testing.T) {
+		events, err := queryAuditDir(dir, AuditQuery{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, now.Add(-time.Minute), events[0].Timestamp)
+	})
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for value, want := range map[string]time.Time{
+		"7d":                   now.Add(-7 * 24 * time.Hour),
+		"2w":                   now.Add(-14 * 24 * time.Hour),
+		"36h":                  now.Add(-36 * time.Hour),
+		"2025-05-01T08:00:00Z": time.Date(2025, 5, 1, 8, 0, 0, 0, time.UTC),
+	} {
+		got, err := ParseSince(value, now)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+
+	got, err := ParseSince("2025-05-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.Day())
+
+	for _, value := range []string{"", "yesterday", "-3d", "7x"} {
+		_, err := ParseSince(value, now)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,213 @@
+// Package logger - Audit log rotation and retention
+// Copyright (c) 2025 orpheus497
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// AuditLogName is the file name of the active audit log
+	AuditLogName = "audit.log"
+
+	// auditArchivePrefix and the suffixes name rotated audit logs,
+	// audit-<rotation time>.log until compressed, then .log.gz
+	auditArchivePrefix     = "audit-"
+	auditArchiveSuffix     = ".log"
+	auditCompressedSuffix  = ".log.gz"
+	auditArchiveTimeFormat = "20060102T150405.000Z"
+
+	// archiveSettleTime is how long a rotated log must be left alone
+	// before it is compressed, so processes that opened it before the
+	// rotation can finish writing to it
+	archiveSettleTime = time.Minute
+)
+
+// RotationPolicy decides when the audit log is rotated and how long
+// archives are kept. Zero values disable the respective rule.
+type RotationPolicy struct {
+	// MaxSize rotates the log once it reaches this many bytes
+	MaxSize int64
+
+	// MaxAge rotates the log once its first event is this old
+	MaxAge time.Duration
+
+	// Retention deletes archives rotated longer ago than this
+	Retention time.Duration
+}
+
+// DefaultRotation rotates the audit log at 10 MiB or after 30 days and
+// keeps archives for a year
+var DefaultRotation = RotationPolicy{
+	MaxSize:   10 << 20,
+	MaxAge:    30 * 24 * time.Hour,
+	Retention: 365 * 24 * time.Hour,
+}
+
+// Rotation is the policy applied whenever the audit log is opened, set
+// from settings.audit at startup
+var Rotation = DefaultRotation
+
+// auditDir returns the directory holding the audit log and its archives
+func auditDir() string {
+	path, _ := GetAuditLogPath()
+	return filepath.Dir(path)
+}
+
+// RotateAuditLog rotates the audit log now if it is not empty, regardless
+// of the policy, and applies the policy's retention to the archives
+func RotateAuditLog() error {
+	policy := Rotation
+	policy.MaxSize = 1
+	return rotateAuditLog(auditDir(), policy, time.Now())
+}
+
+// rotateAuditLog rotates dir's audit log when policy says it is due,
+// compresses archives no process writes to anymore and deletes archives
+// past retention. Several processes may rotate at once; only one rename
+// of the log succeeds.
+func rotateAuditLog(dir string, policy RotationPolicy, now time.Time) error {
+	path := filepath.Join(dir, AuditLogName)
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && rotationDue(path, info.Size(), policy, now) {
+		archive := filepath.Join(dir, auditArchivePrefix+now.UTC().Format(auditArchiveTimeFormat)+auditArchiveSuffix)
+		if err := os.Rename(path, archive); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+
+	archives, err := auditArchives(dir)
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		if policy.Retention > 0 && now.Sub(archive.rotated) > policy.Retention {
+			if err := os.Remove(archive.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove expired audit archive: %w", err)
+			}
+			continue
+		}
+		if !archive.compressed {
+			if info, err := os.Stat(archive.path); err == nil && now.Sub(info.ModTime()) >= archiveSettleTime {
+				if err := compressArchive(archive.path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rotationDue reports whether the log at path, of size bytes, must be rotated
+func rotationDue(path string, size int64, policy RotationPolicy, now time.Time) bool {
+	if policy.MaxSize > 0 && size >= policy.MaxSize {
+		return true
+	}
+	if policy.MaxAge <= 0 {
+		return false
+	}
+	first, ok := firstEventTime(path)
+	return ok && now.Sub(first) >= policy.MaxAge
+}
+
+// firstEventTime returns the timestamp of the first event in a log
+func firstEventTime(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return time.Time{}, false
+	}
+	var event AuditEvent
+	if err := json.Unmarshal(line, &event); err != nil || event.Timestamp.IsZero() {
+		return time.Time{}, false
+	}
+	return event.Timestamp, true
+}
+
+// auditArchive is a rotated audit log
+type auditArchive struct {
+	path       string
+	rotated    time.Time
+	compressed bool
+}
+
+// auditArchives returns the rotated logs in dir, oldest first
+func auditArchives(dir string) ([]auditArchive, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list audit archives: %w", err)
+	}
+
+	var archives []auditArchive
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, auditArchivePrefix) {
+			continue
+		}
+		archive := auditArchive{path: filepath.Join(dir, name)}
+		stamp := strings.TrimPrefix(name, auditArchivePrefix)
+		switch {
+		case strings.HasSuffix(stamp, auditCompressedSuffix):
+			stamp = strings.TrimSuffix(stamp, auditCompressedSuffix)
+			archive.compressed = true
+		case strings.HasSuffix(stamp, auditArchiveSuffix):
+			stamp = strings.TrimSuffix(stamp, auditArchiveSuffix)
+		default:
+			continue
+		}
+		if archive.rotated, err = time.Parse(auditArchiveTimeFormat, stamp); err != nil {
+			continue
+		}
+		archives = append(archives, archive)
+	}
+	// Names sort by rotation time
+	return archives, nil
+}
+
+// compressArchive replaces a rotated log with its gzip-compressed copy
+func compressArchive(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to compress audit archive: %w", err)
+	}
+	defer src.Close()
+
+	target := strings.TrimSuffix(path, auditArchiveSuffix) + auditCompressedSuffix
+	tmp := target + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to compress audit archive: %w", err)
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to compress audit archive: %w", err)
+	}
+	return os.Remove(path)
+}
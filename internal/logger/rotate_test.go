@@ -0,0 +1,158 @@
+// Package logger tests
+// Copyright (c) 2025 orpheus497
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAuditLog writes events as an audit log file
+func writeAuditLog(t *testing.T, path string, events ...AuditEvent) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	for _, event := range events {
+		require.NoError(t, encoder.Encode(event))
+	}
+}
+
+// archiveNames returns the names of the archives in dir
+func archiveNames(t *testing.T, dir string) []string {
+	archives, err := auditArchives(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, archive := range archives {
+		names = append(names, filepath.Base(archive.path))
+	}
+	return names
+}
+
+func TestRotateAuditLog(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	event := AuditEvent{Timestamp: now.Add(-time.Hour), EventType: "transfer", Status: "success"}
+
+	t.Run("rotates by size", func(t *testing.T) {
+		dir := t.TempDir()
+		writeAuditLog(t, filepath.Join(dir, AuditLogName), event, event)
+
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{MaxSize: 1 << 20}, now))
+		assert.FileExists(t, filepath.Join(dir, AuditLogName))
+
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{MaxSize: 10}, now))
+		assert.NoFileExists(t, filepath.Join(dir, AuditLogName))
+		assert.Equal(t, []string{"audit-20250601T120000.000Z.log"}, archiveNames(t, dir))
+	})
+
+	t.Run("rotates by age of the first event", func(t *testing.T) {
+		dir := t.TempDir()
+		writeAuditLog(t, filepath.Join(dir, AuditLogName), event)
+
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{MaxAge: 2 * time.Hour}, now))
+		assert.FileExists(t, filepath.Join(dir, AuditLogName))
+
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{MaxAge: time.Hour}, now))
+		assert.NoFileExists(t, filepath.Join(dir, AuditLogName))
+	})
+
+	t.Run("compresses settled archives", func(t *testing.T) {
+		dir := t.TempDir()
+		writeAuditLog(t, filepath.Join(dir, AuditLogName), event)
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{MaxSize: 1}, now))
+
+		// Written to a moment ago, so left alone
+		archive := filepath.Join(dir, "audit-20250601T120000.000Z.log")
+		require.NoError(t, os.Chtimes(archive, now, now))
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{}, now.Add(time.Second)))
+		assert.Equal(t, []string{"audit-20250601T120000.000Z.log"}, archiveNames(t, dir))
+
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{}, now.Add(archiveSettleTime)))
+		assert.Equal(t, []string{"audit-20250601T120000.000Z.log.gz"}, archiveNames(t, dir))
+
+		events, err := queryAuditDir(dir, AuditQuery{})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "transfer", events[0].EventType)
+	})
+
+	t.Run("deletes archives past retention", func(t *testing.T) {
+		dir := t.TempDir()
+		writeAuditLog(t, filepath.Join(dir, "audit-20240101T000000.000Z.log"), event)
+		writeAuditLog(t, filepath.Join(dir, "audit-20250501T000000.000Z.log"), event)
+		writeAuditLog(t, filepath.Join(dir, "audit-notes.log"), event)
+		recent := filepath.Join(dir, "audit-20250501T000000.000Z.log")
+		require.NoError(t, os.Chtimes(recent, now.Add(-time.Hour), now.Add(-time.Hour)))
+
+		require.NoError(t, rotateAuditLog(dir, RotationPolicy{Retention: 90 * 24 * time.Hour}, now))
+		assert.Equal(t, []string{"audit-20250501T000000.000Z.log.gz"}, archiveNames(t, dir))
+		assert.FileExists(t, filepath.Join(dir, "audit-notes.log"))
+	})
+}
+
+// openTestAuditLogger opens an audit logger writing to dir
+func openTestAuditLogger(t *testing.T, dir string) *AuditLogger {
+	a := &AuditLogger{path: filepath.Join(dir, AuditLogName), enabled: true}
+	require.NoError(t, a.open())
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+// readAuditLog returns the event types in an audit log file
+func readAuditLog(t *testing.T, path string) []string {
+	var events []AuditEvent
+	require.NoError(t, scanAuditFile(path, false, AuditQuery{}, &events))
+	var types []string
+	for _, event := range events {
+		types = append(types, event.EventType)
+	}
+	return types
+}
+
+func TestAuditLoggerReopens(t *testing.T) {
+	orig := Rotation
+	t.Cleanup(func() { Rotation = orig })
+	Rotation = RotationPolicy{}
+
+	t.Run("after another process rotated the log", func(t *testing.T) {
+		dir := t.TempDir()
+		a := openTestAuditLogger(t, dir)
+		require.NoError(t, a.Log(AuditEvent{EventType: "first"}))
+
+		archive := filepath.Join(dir, "audit-20250601T120000.000Z.log")
+		require.NoError(t, os.Rename(filepath.Join(dir, AuditLogName), archive))
+		require.NoError(t, a.Log(AuditEvent{EventType: "second"}))
+
+		assert.Equal(t, []string{"first"}, readAuditLog(t, archive))
+		assert.Equal(t, []string{"second"}, readAuditLog(t, filepath.Join(dir, AuditLogName)))
+	})
+
+	t.Run("after the log was removed", func(t *testing.T) {
+		dir := t.TempDir()
+		a := openTestAuditLogger(t, dir)
+		require.NoError(t, a.Log(AuditEvent{EventType: "first"}))
+		require.NoError(t, os.Remove(filepath.Join(dir, AuditLogName)))
+
+		require.NoError(t, a.Log(AuditEvent{EventType: "second"}))
+		assert.Equal(t, []string{"second"}, readAuditLog(t, filepath.Join(dir, AuditLogName)))
+	})
+
+	t.Run("rotates the log itself when it is due", func(t *testing.T) {
+		dir := t.TempDir()
+		a := openTestAuditLogger(t, dir)
+		require.NoError(t, a.Log(AuditEvent{EventType: "first"}))
+
+		Rotation = RotationPolicy{MaxSize: 1}
+		t.Cleanup(func() { Rotation = RotationPolicy{} })
+		require.NoError(t, a.Log(AuditEvent{EventType: "second"}))
+
+		assert.Equal(t, []string{"second"}, readAuditLog(t, filepath.Join(dir, AuditLogName)))
+		require.Len(t, archiveNames(t, dir), 1)
+	})
+}
@@ -0,0 +1,377 @@
+// Package logger - Audit event sinks
+// Copyright (c) 2025 orpheus497
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink types
+const (
+	// SinkSyslog sends events to the local syslog daemon or a remote one
+	SinkSyslog = "syslog"
+
+	// SinkJournald sends events to the systemd journal with their fields
+	SinkJournald = "journald"
+
+	// SinkTCP and SinkUDP send events as JSON, one per line over TCP or
+	// one per datagram over UDP
+	SinkTCP = "tcp"
+	SinkUDP = "udp"
+)
+
+const (
+	// sinkTimeout bounds connecting to a sink and each write to it
+	sinkTimeout = 2 * time.Second
+
+	// sinkBackoff is how long a sink is skipped after it failed, so an
+	// unreachable collector delays one event rather than every one
+	sinkBackoff = time.Minute
+
+	// DefaultSinkTag identifies klip's messages in syslog and the journal
+	DefaultSinkTag = "klip"
+
+	// DefaultSinkFacility is the syslog facility of audit events
+	DefaultSinkFacility = "auth"
+)
+
+// SinkConfig is a destination audit events are shipped to in addition
+// to the audit log
+type SinkConfig struct {
+	// Type is SinkSyslog, SinkJournald, SinkTCP or SinkUDP
+	Type string
+
+	// Address is host:port for tcp and udp. For syslog it is empty for
+	// the local daemon, or udp://, tcp:// or unix:// followed by the
+	// address; for journald it is the journal socket, empty for the default.
+	Address string
+
+	// Facility is the syslog facility (default auth)
+	Facility string
+
+	// Tag is the syslog tag and journal identifier (default klip)
+	Tag string
+}
+
+// Sinks are the sinks every audit logger ships events to, set from
+// settings.audit.sinks at startup
+var Sinks []SinkConfig
+
+// syslogFacilities maps facility names to their codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Syslog severities of audit events
+const (
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// localSyslogSockets are where local syslog daemons listen
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// defaultJournalSocket is where journald receives native messages
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// Validate checks a sink's type, address and facility
+func (c SinkConfig) Validate() error {
+	switch c.Type {
+	case SinkTCP, SinkUDP:
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("%s sink needs an address as host:port: %w", c.Type, err)
+		}
+	case SinkSyslog:
+		if c.Address != "" {
+			if _, _, err := syslogAddress(c.Address); err != nil {
+				return err
+			}
+		}
+	case SinkJournald:
+	default:
+		return fmt.Errorf("invalid sink type '%s', must be syslog, journald, tcp or udp", c.Type)
+	}
+	if _, ok := syslogFacilities[c.facility()]; !ok {
+		return fmt.Errorf("invalid syslog facility '%s'", c.Facility)
+	}
+	return nil
+}
+
+func (c SinkConfig) facility() string {
+	if c.Facility == "" {
+		return DefaultSinkFacility
+	}
+	return c.Facility
+}
+
+func (c SinkConfig) tag() string {
+	if c.Tag == "" {
+		return DefaultSinkTag
+	}
+	return c.Tag
+}
+
+// String describes the sink in messages
+func (c SinkConfig) String() string {
+	if c.Address == "" {
+		return c.Type
+	}
+	return c.Type + " " + c.Address
+}
+
+// syslogAddress splits a syslog address into network and address
+func syslogAddress(address string) (network, addr string, err error) {
+	scheme, rest, ok := strings.Cut(address, "://")
+	if !ok {
+		scheme, rest = "udp", address
+	}
+	switch scheme {
+	case "udp", "tcp":
+		if _, _, err := net.SplitHostPort(rest); err != nil {
+			return "", "", fmt.Errorf("invalid syslog address '%s': %w", address, err)
+		}
+	case "unix":
+		if rest == "" {
+			return "", "", fmt.Errorf("invalid syslog address '%s': no socket path", address)
+		}
+		scheme = "unixgram"
+	default:
+		return "", "", fmt.Errorf("invalid syslog address '%s', must start with udp://, tcp:// or unix://", address)
+	}
+	return scheme, rest, nil
+}
+
+// sink ships audit events to one destination. Connections are opened on
+// the first event and reopened once after a failed write.
+type sink struct {
+	config SinkConfig
+	dial   func() (net.Conn, error)
+	format func(event AuditEvent, line []byte) []byte
+	conn   net.Conn
+}
+
+// newSink prepares a sink without connecting to it
+func newSink(config SinkConfig) (*sink, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &sink{config: config}
+	dialer := func(network, address string) func() (net.Conn, error) {
+		return func() (net.Conn, error) { return net.DialTimeout(network, address, sinkTimeout) }
+	}
+
+	switch config.Type {
+	case SinkTCP:
+		s.dial = dialer("tcp", config.Address)
+		s.format = func(_ AuditEvent, line []byte) []byte { return append(line, '\n') }
+	case SinkUDP:
+		s.dial = dialer("udp", config.Address)
+		s.format = func(_ AuditEvent, line []byte) []byte { return line }
+	case SinkSyslog:
+		if config.Address == "" {
+			s.dial = dialLocalSyslog
+			s.format = s.formatSyslog(false)
+		} else {
+			network, address, _ := syslogAddress(config.Address)
+			s.dial = dialer(network, address)
+			s.format = s.formatSyslog(network != "unixgram")
+		}
+	case SinkJournald:
+		socket := config.Address
+		if socket == "" {
+			socket = defaultJournalSocket
+		}
+		s.dial = dialer("unixgram", socket)
+		s.format = s.formatJournal
+	}
+	return s, nil
+}
+
+// dialLocalSyslog connects to the local syslog daemon's socket
+func dialLocalSyslog() (net.Conn, error) {
+	var lastErr error
+	for _, path := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.DialTimeout(network, path, sinkTimeout)
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+	}
+	return nil, fmt.Errorf("no local syslog daemon: %w", lastErr)
+}
+
+// failedSinks records when each sink that could not be reached failed,
+// by description, across the audit loggers of the process
+var (
+	failedSinks   = make(map[string]time.Time)
+	failedSinksMu sync.Mutex
+)
+
+// send ships an event, given as its JSON encoding, unless the sink failed
+// less than sinkBackoff ago
+func (s *sink) send(event AuditEvent, line []byte) error {
+	key := s.config.String()
+	failedSinksMu.Lock()
+	failed, ok := failedSinks[key]
+	failedSinksMu.Unlock()
+	if ok && time.Since(failed) < sinkBackoff {
+		return fmt.Errorf("audit sink %s: skipped since it failed at %s", s.config, failed.Format(time.TimeOnly))
+	}
+
+	err := s.deliver(event, line)
+	failedSinksMu.Lock()
+	if err != nil {
+		failedSinks[key] = time.Now()
+	} else {
+		delete(failedSinks, key)
+	}
+	failedSinksMu.Unlock()
+	return err
+}
+
+// deliver writes an event to the sink, reconnecting once if the write
+// fails
+func (s *sink) deliver(event AuditEvent, line []byte) error {
+	message := s.format(event, line)
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(); err != nil {
+				s.conn = nil
+				return fmt.Errorf("audit sink %s: %w", s.config, err)
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(sinkTimeout))
+		if _, err = s.conn.Write(message); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return fmt.Errorf("audit sink %s: %w", s.config, err)
+}
+
+// close closes the sink's connection
+func (s *sink) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// severity is the syslog severity of an event: warning for failures
+func severity(event AuditEvent) int {
+	switch {
+	case event.Error != "", event.Status == "failed", event.Status == "blocked":
+		return severityWarning
+	default:
+		return severityInfo
+	}
+}
+
+// formatSyslog returns a formatter of syslog messages, in the format of
+// the standard library's log/syslog: with a hostname and RFC 3339 time
+// for remote daemons, without for local ones
+func (s *sink) formatSyslog(remote bool) func(AuditEvent, []byte) []byte {
+	priority := syslogFacilities[s.config.facility()] * 8
+	tag := s.config.tag()
+	hostname, _ := os.Hostname()
+
+	return func(event AuditEvent, line []byte) []byte {
+		pri := priority + severity(event)
+		if remote {
+			return fmt.Appendf(nil, "<%d>%s %s %s[%d]: %s\n", pri, event.Timestamp.Format(time.RFC3339), hostname, tag, os.Getpid(), line)
+		}
+		return fmt.Appendf(nil, "<%d>%s %s[%d]: %s\n", pri, event.Timestamp.Local().Format(time.Stamp), tag, os.Getpid(), line)
+	}
+}
+
+// formatJournal encodes an event in journald's native protocol, with the
+// JSON event as MESSAGE and its main fields as KLIP_* fields
+func (s *sink) formatJournal(event AuditEvent, line []byte) []byte {
+	var b []byte
+	field := func(name, value string) {
+		if value == "" {
+			return
+		}
+		if !strings.Contains(value, "\n") {
+			b = append(b, name+"="+value+"\n"...)
+			return
+		}
+		// Values with newlines are sent with their length
+		b = append(b, name+"\n"...)
+		n := uint64(len(value))
+		for i := 0; i < 8; i++ {
+			b = append(b, byte(n>>(8*i)))
+		}
+		b = append(b, value+"\n"...)
+	}
+
+	field("MESSAGE", string(line))
+	field("PRIORITY", fmt.Sprint(severity(event)))
+	field("SYSLOG_IDENTIFIER", s.config.tag())
+	field("SYSLOG_FACILITY", fmt.Sprint(syslogFacilities[s.config.facility()]))
+	field("KLIP_EVENT_TYPE", event.EventType)
+	field("KLIP_PROFILE", event.Profile)
+	field("KLIP_USER", event.User)
+	field("KLIP_HOST", event.Host)
+	field("KLIP_BACKEND", event.Backend)
+	field("KLIP_OPERATION", event.Operation)
+	field("KLIP_STATUS", event.Status)
+	field("KLIP_ERROR", event.Error)
+	return b
+}
+
+// openSinks prepares the configured sinks, skipping invalid ones
+func openSinks() []*sink {
+	var sinks []*sink
+	for _, config := range Sinks {
+		if s, err := newSink(config); err == nil {
+			sinks = append(sinks, s)
+		}
+	}
+	return sinks
+}
+
+// TestSinks sends a test event to every configured sink, including those
+// skipped after a failure, and returns the error of each, nil where the
+// event was sent. Delivery over UDP and to
+// datagram sockets is not confirmed by the receiver.
+func TestSinks() []error {
+	event := AuditEvent{
+		Timestamp: time.Now().UTC(),
+		EventType: "sink_test",
+		Status:    "success",
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return []error{err}
+	}
+
+	errs := make([]error, len(Sinks))
+	for i, config := range Sinks {
+		s, err := newSink(config)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		errs[i] = s.deliver(event, line)
+		s.close()
+	}
+	return errs
+}
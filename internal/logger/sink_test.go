@@ -0,0 +1,241 @@
+// Package logger tests
+// Copyright (c) 2025 orpheus497
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sinkEvent is the event the sink tests ship
+var sinkEvent = AuditEvent{
+	Timestamp: time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC),
+	EventType: "transfer",
+	Profile:   "web",
+	User:      "deploy",
+	Host:      "web.example.com",
+	Operation: "push",
+	Status:    "failed",
+	Error:     "permission denied",
+}
+
+// sendEvent ships sinkEvent through a new sink for config
+func sendEvent(t *testing.T, config SinkConfig) {
+	s, err := newSink(config)
+	require.NoError(t, err)
+	defer s.close()
+	line, err := json.Marshal(sinkEvent)
+	require.NoError(t, err)
+	require.NoError(t, s.send(sinkEvent, line))
+}
+
+// listenUnixgram listens on a datagram socket in a temporary directory
+func listenUnixgram(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+// receive reads one datagram
+func receive(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 64*1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestTCPSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	sendEvent(t, SinkConfig{Type: SinkTCP, Address: listener.Addr().String()})
+
+	select {
+	case line := <-received:
+		var event AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		assert.Equal(t, sinkEvent, event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func TestUDPSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sendEvent(t, SinkConfig{Type: SinkUDP, Address: conn.LocalAddr().String()})
+
+	var event AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(receive(t, conn)), &event))
+	assert.Equal(t, sinkEvent, event)
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, path := listenUnixgram(t)
+
+	sendEvent(t, SinkConfig{Type: SinkSyslog, Address: "unix://" + path, Facility: "local3", Tag: "klip-test"})
+
+	// local3 (19) * 8 + warning (4) for a failed event
+	message := receive(t, conn)
+	assert.True(t, strings.HasPrefix(message, "<156>"), message)
+	assert.Contains(t, message, " klip-test[")
+	assert.Contains(t, message, `"event_type":"transfer"`)
+}
+
+func TestUDPSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	event := sinkEvent
+	event.Status, event.Error = "success", ""
+	s, err := newSink(SinkConfig{Type: SinkSyslog, Address: conn.LocalAddr().String()})
+	require.NoError(t, err)
+	defer s.close()
+	line, err := json.Marshal(event)
+	require.NoError(t, err)
+	require.NoError(t, s.send(event, line))
+
+	// auth (4) * 8 + info (6), with the time and hostname for remote daemons
+	message := receive(t, conn)
+	assert.True(t, strings.HasPrefix(message, "<38>2025-03-14T09:30:00Z "), message)
+	assert.Contains(t, message, " klip[")
+}
+
+func TestJournaldSink(t *testing.T) {
+	conn, path := listenUnixgram(t)
+
+	sendEvent(t, SinkConfig{Type: SinkJournald, Address: path})
+
+	fields := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(receive(t, conn), "\n"), "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		require.True(t, ok, line)
+		fields[name] = value
+	}
+	assert.Equal(t, "4", fields["PRIORITY"])
+	assert.Equal(t, "klip", fields["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "transfer", fields["KLIP_EVENT_TYPE"])
+	assert.Equal(t, "failed", fields["KLIP_STATUS"])
+	assert.Equal(t, "permission denied", fields["KLIP_ERROR"])
+
+	var event AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(fields["MESSAGE"]), &event))
+	assert.Equal(t, sinkEvent, event)
+}
+
+func TestSinkReconnects(t *testing.T) {
+	conn, path := listenUnixgram(t)
+	s, err := newSink(SinkConfig{Type: SinkJournald, Address: path})
+	require.NoError(t, err)
+	defer s.close()
+
+	require.NoError(t, s.send(sinkEvent, []byte("{}")))
+	receive(t, conn)
+
+	// A closed connection is reopened on the next event
+	s.conn.Close()
+	require.NoError(t, s.send(sinkEvent, []byte("{}")))
+	receive(t, conn)
+}
+
+func TestSinkValidate(t *testing.T) {
+	tests := []struct {
+		config SinkConfig
+		err    string
+	}{
+		{SinkConfig{Type: SinkTCP, Address: "collector:5140"}, ""},
+		{SinkConfig{Type: SinkSyslog}, ""},
+		{SinkConfig{Type: SinkSyslog, Address: "tcp://logs:514", Facility: "local0"}, ""},
+		{SinkConfig{Type: SinkJournald}, ""},
+		{SinkConfig{Type: SinkUDP}, "needs an address"},
+		{SinkConfig{Type: SinkTCP, Address: "collector"}, "needs an address"},
+		{SinkConfig{Type: SinkSyslog, Address: "http://logs:514"}, "must start with"},
+		{SinkConfig{Type: SinkSyslog, Address: "unix://"}, "no socket path"},
+		{SinkConfig{Type: SinkSyslog, Facility: "audit"}, "invalid syslog facility"},
+		{SinkConfig{Type: "kafka"}, "invalid sink type"},
+	}
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if tt.err == "" {
+			assert.NoError(t, err, tt.config.String())
+		} else {
+			assert.ErrorContains(t, err, tt.err, tt.config.String())
+		}
+	}
+}
+
+func TestTestSinks(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sinks := Sinks
+	defer func() { Sinks = sinks }()
+	Sinks = []SinkConfig{
+		{Type: SinkUDP, Address: conn.LocalAddr().String()},
+		{Type: SinkJournald, Address: filepath.Join(t.TempDir(), "missing")},
+	}
+
+	errs := TestSinks()
+	require.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.ErrorContains(t, errs[1], "audit sink journald")
+	assert.Contains(t, receive(t, conn), `"event_type":"sink_test"`)
+}
+
+func TestSinkBackoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sock")
+	s, err := newSink(SinkConfig{Type: SinkJournald, Address: path})
+	require.NoError(t, err)
+	defer s.close()
+	t.Cleanup(func() {
+		failedSinksMu.Lock()
+		delete(failedSinks, s.config.String())
+		failedSinksMu.Unlock()
+	})
+
+	// A sink that cannot be reached is skipped for the next events, even
+	// once it is back, rather than delaying each of them
+	assert.ErrorContains(t, s.send(sinkEvent, []byte("{}")), "no such file")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.ErrorContains(t, s.send(sinkEvent, []byte("{}")), "skipped since it failed")
+
+	// After the backoff it is tried again
+	failedSinksMu.Lock()
+	failedSinks[s.config.String()] = time.Now().Add(-sinkBackoff)
+	failedSinksMu.Unlock()
+	require.NoError(t, s.send(sinkEvent, []byte("{}")))
+	receive(t, conn)
+	failedSinksMu.Lock()
+	_, failed := failedSinks[s.config.String()]
+	failedSinksMu.Unlock()
+	assert.False(t, failed)
+}
@@ -0,0 +1,145 @@
+// Package metrics exposes counters and gauges in the Prometheus text
+// format for long-running klip processes such as klip mux
+// Copyright (c) 2025 orpheus497
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// contentType is the Prometheus text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Label is a metric label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a metric, told apart from its other values by
+// its labels
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Value returns the single unlabelled sample of a metric
+func Value(v float64) []Sample {
+	return []Sample{{Value: v}}
+}
+
+// metric is a registered metric whose samples are collected on each scrape
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	collect func() []Sample
+}
+
+// Registry holds metrics and serves their current values
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers a metric that only goes up, read by collect on each
+// scrape. By convention its name ends in _total.
+func (r *Registry) Counter(name, help string, collect func() []Sample) {
+	r.register(metric{name: name, help: help, kind: "counter", collect: collect})
+}
+
+// Gauge registers a metric that goes up and down, read by collect on each
+// scrape
+func (r *Registry) Gauge(name, help string, collect func() []Sample) {
+	r.register(metric{name: name, help: help, kind: "gauge", collect: collect})
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric to w in the text exposition format, sorted by
+// name
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	sort.SliceStable(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, helpEscaper.Replace(m.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+		for _, sample := range m.collect() {
+			bw.WriteString(m.name)
+			if len(sample.Labels) > 0 {
+				labels := make([]string, len(sample.Labels))
+				for i, label := range sample.Labels {
+					labels[i] = fmt.Sprintf(`%s="%s"`, label.Name, labelEscaper.Replace(label.Value))
+				}
+				fmt.Fprintf(bw, "{%s}", strings.Join(labels, ","))
+			}
+			fmt.Fprintf(bw, " %s\n", formatValue(sample.Value))
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
+
+// Serve answers scrapes of /metrics on listener until ctx is cancelled
+func (r *Registry) Serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("metrics server failed: %w", err)
+	}
+	return nil
+}
+
+// Escaping of help text and label values in the text format
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// formatValue formats a sample value, with the format's names for
+// infinities
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	bytesSent := 1024.0
+	r.Counter("klip_mux_bytes_total", "Bytes relayed", func() []Sample {
+		return []Sample{
+			{Labels: []Label{{"profile", "web"}, {"direction", "sent"}}, Value: bytesSent},
+			{Labels: []Label{{"profile", "web"}, {"direction", "received"}}, Value: 3.5e9},
+		}
+	})
+	r.Gauge("klip_backend_up", "Backend health\nwith \\ escapes", func() []Sample {
+		return []Sample{{Labels: []Label{{"backend", `a"b\c` + "\n"}}, Value: 1}}
+	})
+	r.Gauge("klip_mux_clients", "Connected clients", func() []Sample { return Value(math.Inf(1)) })
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	assert.Equal(t, `# HELP klip_backend_up Backend health\nwith \\ escapes
+# TYPE klip_backend_up gauge
+klip_backend_up{backend="a\"b\\c\n"} 1
+# HELP klip_mux_bytes_total Bytes relayed
+# TYPE klip_mux_bytes_total counter
+klip_mux_bytes_total{profile="web",direction="sent"} 1024
+klip_mux_bytes_total{profile="web",direction="received"} 3.5e+09
+# HELP klip_mux_clients Connected clients
+# TYPE klip_mux_clients gauge
+klip_mux_clients +Inf
+`, buf.String())
+
+	// Values are collected again on every write
+	bytesSent = 2048
+	buf.Reset()
+	require.NoError(t, r.Write(&buf))
+	assert.Contains(t, buf.String(), `direction="sent"} 2048`)
+}
+
+func TestServe(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("klip_test_total", "Test", func() []Sample { return Value(7) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.Serve(ctx, listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, contentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "klip_test_total 7\n")
+
+	resp, err = http.Get("http://" + listener.Addr().String() + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
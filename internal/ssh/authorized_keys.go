@@ -0,0 +1,305 @@
+// Package ssh - Remote authorized_keys
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// authorizedKeysPath is the remote user's authorized_keys, relative to the
+// SFTP server's starting directory (their home)
+const authorizedKeysPath = ".ssh/authorized_keys"
+
+// ErrKeyAlreadyAuthorized is returned by AuthorizeKey when the key is
+// already deployed and there was nothing to change
+var ErrKeyAlreadyAuthorized = errors.New("key already deployed")
+
+// AuthorizeMode selects what AuthorizeKey does with the keys already in
+// authorized_keys
+type AuthorizeMode int
+
+const (
+	// AuthorizeAppend adds the key next to the keys already authorized
+	AuthorizeAppend AuthorizeMode = iota
+
+	// AuthorizeSole replaces authorized_keys so that the key is the only one
+	// that can log in
+	AuthorizeSole
+)
+
+// AuthorizeKey adds publicKey to the remote user's authorized_keys over
+// SFTP, creating ~/.ssh (0700) and the file (0600) if needed. A key that is
+// already authorized is not added twice; ErrKeyAlreadyAuthorized is returned
+// instead. In AuthorizeSole mode every other entry is removed, with the
+// previous file backed up first.
+func AuthorizeKey(client *Client, publicKey []byte, mode AuthorizeMode) error {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	line := append(bytes.TrimRight(publicKey, "\r\n"), '\n')
+
+	sftpClient, err := sftp.NewClient(client.GetClient())
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	// Ensure .ssh directory exists with correct permissions
+	sshDir := path.Dir(authorizedKeysPath)
+	if err := sftpClient.MkdirAll(sshDir); err != nil {
+		// Directory might already exist, try to continue
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to create .ssh directory: %w", err)
+		}
+	}
+
+	// Set .ssh directory permissions (0700)
+	if err := sftpClient.Chmod(sshDir, 0700); err != nil {
+		return fmt.Errorf("failed to set .ssh directory permissions: %w", err)
+	}
+
+	existing, err := readAuthorizedKeys(sftpClient)
+	if err != nil {
+		return err
+	}
+	entries := parseAuthorizedKeys(existing)
+
+	if mode == AuthorizeSole {
+		if len(entries) == 1 && entries[0].Fingerprint == fingerprint {
+			return ErrKeyAlreadyAuthorized
+		}
+		_, err := replaceAuthorizedKeys(sftpClient, existing, line)
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Fingerprint == fingerprint {
+			return ErrKeyAlreadyAuthorized
+		}
+	}
+
+	// Open authorized_keys file for append
+	f, err := sftpClient.OpenFile(authorizedKeysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	if err != nil {
+		return fmt.Errorf("failed to open authorized_keys: %w", err)
+	}
+	defer f.Close()
+
+	// Not every SFTP server honors the append flag, so write at the end
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to open authorized_keys: %w", err)
+	}
+
+	// Start on a new line if the last entry has no trailing newline
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		line = append([]byte("\n"), line...)
+	}
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	// Set correct permissions on authorized_keys (0600)
+	if err := sftpClient.Chmod(authorizedKeysPath, 0600); err != nil {
+		return fmt.Errorf("failed to set authorized_keys permissions: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeKey removes every entry for publicKey, in authorized_keys format,
+// from the remote user's authorized_keys over SFTP and returns how many
+// were removed
+func RevokeKey(client *Client, publicKey []byte) (int, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return 0, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	removed, _, err := RevokeFingerprint(client, ssh.FingerprintSHA256(key))
+	return removed, err
+}
+
+// RevokeFingerprint removes every entry for the key with the given SHA256
+// fingerprint from the remote user's authorized_keys over SFTP. It returns
+// how many were removed and where the previous file was backed up.
+func RevokeFingerprint(client *Client, fingerprint string) (int, string, error) {
+	sftpClient, err := sftp.NewClient(client.GetClient())
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	data, err := readAuthorizedKeys(sftpClient)
+	if err != nil {
+		return 0, "", err
+	}
+
+	kept, removed := removeAuthorizedKey(data, NormalizeFingerprint(fingerprint))
+	if removed == 0 {
+		return 0, "", nil
+	}
+
+	backupPath, err := replaceAuthorizedKeys(sftpClient, data, kept)
+	if err != nil {
+		return 0, "", err
+	}
+	return removed, backupPath, nil
+}
+
+// replaceAuthorizedKeys backs up the current authorized_keys content old
+// and replaces the file with content, returning the backup's path. The new
+// content is written to a temporary file and renamed over the original, so
+// a failed write never leaves it truncated.
+func replaceAuthorizedKeys(sftpClient *sftp.Client, old, content []byte) (string, error) {
+	backupPath := authorizedKeysPath + ".klip-bak." + time.Now().Format("20060102-150405")
+	if err := writeRemoteFile(sftpClient, backupPath, old); err != nil {
+		return "", fmt.Errorf("failed to back up authorized_keys: %w", err)
+	}
+
+	tmpPath := authorizedKeysPath + ".klip-tmp"
+	if err := writeRemoteFile(sftpClient, tmpPath, content); err != nil {
+		sftpClient.Remove(tmpPath)
+		return "", err
+	}
+
+	var err error
+	if _, ok := sftpClient.HasExtension("posix-rename@openssh.com"); ok {
+		err = sftpClient.PosixRename(tmpPath, authorizedKeysPath)
+	} else if err = sftpClient.Remove(authorizedKeysPath); err == nil || os.IsNotExist(err) {
+		err = sftpClient.Rename(tmpPath, authorizedKeysPath)
+	}
+	if err != nil {
+		sftpClient.Remove(tmpPath)
+		return "", fmt.Errorf("failed to replace authorized_keys: %w", err)
+	}
+	return backupPath, nil
+}
+
+// AuthorizedKey is a key entry in a remote authorized_keys file
+type AuthorizedKey struct {
+	Line        int      `json:"line"`
+	Type        string   `json:"type"`
+	Fingerprint string   `json:"fingerprint"`
+	Comment     string   `json:"comment,omitempty"`
+	Options     []string `json:"options,omitempty"`
+
+	// Duplicate is set on every entry after the first for the same key
+	Duplicate bool `json:"duplicate"`
+}
+
+// ListAuthorizedKeys returns the key entries in the remote user's
+// authorized_keys, read over SFTP. A missing file has no entries.
+func ListAuthorizedKeys(client *Client) ([]AuthorizedKey, error) {
+	sftpClient, err := sftp.NewClient(client.GetClient())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	data, err := readAuthorizedKeys(sftpClient)
+	if err != nil {
+		return nil, err
+	}
+	return parseAuthorizedKeys(data), nil
+}
+
+// NormalizeFingerprint returns a SHA256 fingerprint with its "SHA256:"
+// prefix, which may be left off on the command line
+func NormalizeFingerprint(fingerprint string) string {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		return fingerprint
+	}
+	return "SHA256:" + fingerprint
+}
+
+// readAuthorizedKeys returns the remote authorized_keys content, empty if
+// the file does not exist
+func readAuthorizedKeys(sftpClient *sftp.Client) ([]byte, error) {
+	f, err := sftpClient.Open(authorizedKeysPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open authorized_keys: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+	return data, nil
+}
+
+// writeRemoteFile writes data to a new 0600 file at remotePath
+func writeRemoteFile(sftpClient *sftp.Client, remotePath string, data []byte) error {
+	f, err := sftpClient.OpenFile(remotePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", remotePath, err)
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to set %s permissions: %w", remotePath, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", remotePath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+// parseAuthorizedKeys returns the key entries in authorized_keys content
+// data, skipping comments, blank lines and lines that don't parse
+func parseAuthorizedKeys(data []byte) []AuthorizedKey {
+	var entries []AuthorizedKey
+	seen := make(map[string]bool)
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		key, comment, options, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			continue
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		entries = append(entries, AuthorizedKey{
+			Line:        i + 1,
+			Type:        key.Type(),
+			Fingerprint: fingerprint,
+			Comment:     comment,
+			Options:     options,
+			Duplicate:   seen[fingerprint],
+		})
+		seen[fingerprint] = true
+	}
+	return entries
+}
+
+// removeAuthorizedKey returns the authorized_keys content data without the
+// lines for the key with the given SHA256 fingerprint, and how many were
+// removed. Comments, blank lines and lines that don't parse are kept as
+// they are.
+func removeAuthorizedKey(data []byte, fingerprint string) ([]byte, int) {
+	var kept bytes.Buffer
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if parsed, _, _, _, err := ssh.ParseAuthorizedKey(line); err == nil && ssh.FingerprintSHA256(parsed) == fingerprint {
+			removed++
+			continue
+		}
+		kept.Write(line)
+	}
+	return kept.Bytes(), removed
+}
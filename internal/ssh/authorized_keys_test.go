@@ -0,0 +1,132 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newAuthorizedKeysClient returns a client of a server whose home directory
+// is returned as well
+func newAuthorizedKeysClient(t *testing.T) (*Client, string) {
+	home := t.TempDir()
+	server := newTestServer(t)
+	server.handle = serveSFTP(t, home)
+	return server.connect(t), home
+}
+
+func TestAuthorizeKey(t *testing.T) {
+	client, home := newAuthorizedKeysClient(t)
+	other := ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())
+	key := ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())
+	path := filepath.Join(home, ".ssh", "authorized_keys")
+
+	// ~/.ssh and the file are created
+	require.NoError(t, AuthorizeKey(client, other, AuthorizeAppend))
+	info, err := os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A last entry without a newline is terminated first
+	require.NoError(t, os.WriteFile(path, other[:len(other)-1], 0600))
+	require.NoError(t, AuthorizeKey(client, key, AuthorizeAppend))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(other)+string(key), string(data))
+
+	// Deploying again changes nothing
+	assert.ErrorIs(t, AuthorizeKey(client, key, AuthorizeAppend), ErrKeyAlreadyAuthorized)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(other)+string(key), string(data))
+
+	assert.ErrorContains(t, AuthorizeKey(client, []byte("not a key"), AuthorizeAppend), "invalid public key")
+}
+
+func TestAuthorizeKeySole(t *testing.T) {
+	client, home := newAuthorizedKeysClient(t)
+	other := ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())
+	key := ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey())
+	path := filepath.Join(home, ".ssh", "authorized_keys")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	previous := "# team keys\n" + string(other) + string(key)
+	require.NoError(t, os.WriteFile(path, []byte(previous), 0600))
+
+	// Every other entry is removed, with the previous file backed up
+	require.NoError(t, AuthorizeKey(client, key, AuthorizeSole))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(key), string(data))
+
+	backups, err := filepath.Glob(path + ".klip-bak.*")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	data, err = os.ReadFile(backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, previous, string(data))
+
+	// Once it is the only key there is nothing to do
+	assert.ErrorIs(t, AuthorizeKey(client, key, AuthorizeSole), ErrKeyAlreadyAuthorized)
+	_, err = os.Stat(path + ".klip-tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	data := strings.Join([]string{
+		"# team keys",
+		line + " alice@laptop",
+		"",
+		"not a key",
+		`from="10.0.0.0/8",no-pty ` + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other))) + " ci",
+		line + " alice@desktop",
+	}, "\n")
+
+	entries := parseAuthorizedKeys([]byte(data))
+	require.Len(t, entries, 3)
+	assert.Equal(t, AuthorizedKey{
+		Line:        2,
+		Type:        key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Comment:     "alice@laptop",
+	}, entries[0])
+	assert.Equal(t, 5, entries[1].Line)
+	assert.Equal(t, []string{`from="10.0.0.0/8"`, "no-pty"}, entries[1].Options)
+	assert.False(t, entries[1].Duplicate)
+	assert.Equal(t, 6, entries[2].Line)
+	assert.True(t, entries[2].Duplicate, "the same key again is a duplicate")
+
+	assert.Empty(t, parseAuthorizedKeys(nil))
+}
+
+func TestRemoveAuthorizedKey(t *testing.T) {
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	otherLine := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other)))
+	data := "# team keys\n" + line + " alice\nnot a key\n" + otherLine + " bob\n\nno-pty " + line
+
+	// Every line of the key goes, with or without options or a final
+	// newline; everything else is kept as it was
+	kept, removed := removeAuthorizedKey([]byte(data), ssh.FingerprintSHA256(key))
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, "# team keys\nnot a key\n"+otherLine+" bob\n\n", string(kept))
+
+	kept, removed = removeAuthorizedKey([]byte(data), "SHA256:unknown")
+	assert.Zero(t, removed)
+	assert.Equal(t, data, string(kept))
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	assert.Equal(t, "SHA256:abc", NormalizeFingerprint("abc"))
+	assert.Equal(t, "SHA256:abc", NormalizeFingerprint("SHA256:abc"))
+}
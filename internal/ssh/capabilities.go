@@ -0,0 +1,118 @@
+// Package ssh - Remote environment detection
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// capabilityProbe prints one key=value pair per line describing the remote
+// environment. It only uses POSIX sh builtins so it runs on minimal hosts.
+const capabilityProbe = `printf 'os=%s\n' "$(uname -s 2>/dev/null)"; ` +
+	`printf 'arch=%s\n' "$(uname -m 2>/dev/null)"; ` +
+	`printf 'shell=%s\n' "$SHELL"; ` +
+	`printf 'home=%s\n' "$HOME"; ` +
+	`printf 'rsync=%s\n' "$(command -v rsync 2>/dev/null)"; ` +
+	`printf 'scp=%s\n' "$(command -v scp 2>/dev/null)"`
+
+// RemoteCapabilities describes the environment of a remote host
+type RemoteCapabilities struct {
+	// OS is the remote kernel name as reported by uname -s (e.g., Linux, Darwin)
+	OS string `json:"os"`
+
+	// Arch is the remote machine architecture as reported by uname -m
+	Arch string `json:"arch"`
+
+	// Shell is the remote user's login shell
+	Shell string `json:"shell"`
+
+	// HomeDir is the remote user's home directory
+	HomeDir string `json:"home_dir"`
+
+	// RsyncPath is the location of rsync on the remote host (empty if missing)
+	RsyncPath string `json:"rsync_path,omitempty"`
+
+	// HasRsync indicates rsync is installed on the remote host
+	HasRsync bool `json:"has_rsync"`
+
+	// HasSCP indicates scp is installed on the remote host
+	HasSCP bool `json:"has_scp"`
+
+	// HasSFTP indicates the SFTP subsystem is enabled on the remote host
+	HasSFTP bool `json:"has_sftp"`
+
+	// POSIXShell indicates the remote shell accepted the POSIX probe command
+	POSIXShell bool `json:"posix_shell"`
+
+	// DetectedAt is when the capabilities were detected
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// DetectCapabilities probes the remote host for its OS, shell, home directory
+// and available transfer tools over an established connection
+func DetectCapabilities(ctx context.Context, client *Client) (*RemoteCapabilities, error) {
+	if !client.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	caps := &RemoteCapabilities{
+		DetectedAt: time.Now(),
+	}
+
+	// Probe the shell environment. Non-POSIX shells (e.g., Windows cmd.exe)
+	// fail here, which is not fatal: SFTP detection below still works.
+	if output, err := client.RunCommand(ctx, capabilityProbe); err == nil {
+		caps.POSIXShell = true
+		parseCapabilityProbe(output, caps)
+	}
+
+	// Probe the SFTP subsystem
+	if sftpClient, err := sftp.NewClient(client.GetClient()); err == nil {
+		caps.HasSFTP = true
+		if caps.HomeDir == "" {
+			if wd, err := sftpClient.Getwd(); err == nil {
+				caps.HomeDir = wd
+			}
+		}
+		sftpClient.Close()
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return caps, nil
+}
+
+// parseCapabilityProbe fills caps from the key=value output of capabilityProbe
+func parseCapabilityProbe(output string, caps *RemoteCapabilities) {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "os":
+			caps.OS = value
+		case "arch":
+			caps.Arch = value
+		case "shell":
+			caps.Shell = value
+		case "home":
+			caps.HomeDir = value
+		case "rsync":
+			caps.RsyncPath = value
+			caps.HasRsync = value != ""
+		case "scp":
+			caps.HasSCP = value != ""
+		}
+	}
+}
@@ -2,14 +2,21 @@
 package ssh
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/orpheus497/klip/internal/tracing"
+	"github.com/orpheus497/klip/internal/ui"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 )
@@ -20,6 +27,47 @@ type Client struct {
 	client *ssh.Client
 	host   string
 	port   int
+	info   ConnectionInfo
+
+	// jump is the bastion the connection is relayed through, if any
+	jump *Client
+
+	// skippedKeys are the keys the running Connect could not unlock,
+	// reported if authentication fails
+	skippedKeys []string
+
+	// allowed are the networks a direct connection may reach (nil allows
+	// all), from Config.AllowedCIDRs
+	allowed []*net.IPNet
+
+	// traceCtx, handshakeSpan and authSpan trace the phases of the
+	// running Connect, which the host key callback separates
+	traceCtx      context.Context
+	handshakeSpan *tracing.Span
+	authSpan      *tracing.Span
+}
+
+// ConnectionInfo records what a connection attempt actually talked to,
+// for auditing. Fields are empty if the attempt failed before reaching them.
+type ConnectionInfo struct {
+	// RemoteAddr is the IP address and port that was dialed
+	RemoteAddr string
+
+	// Jumps records what each jump host the connection was relayed through
+	// talked to, in order from the first hop
+	Jumps []ConnectionInfo
+
+	// HostKeyType and HostKeyFingerprint identify the server's host key
+	HostKeyType        string
+	HostKeyFingerprint string
+
+	// AuthMethod is the authentication method that succeeded, or the last
+	// one attempted if authentication failed
+	AuthMethod string
+
+	// HostKeyWarnings are the reasons to re-verify the host key, e.g. its
+	// age (see Config.HostKeyMaxAge)
+	HostKeyWarnings []string
 }
 
 // Config contains SSH client configuration
@@ -31,6 +79,70 @@ type Config struct {
 	Password    string
 	UsePassword bool
 	Timeout     time.Duration
+
+	// PassphraseEnv names an environment variable holding the passphrase
+	// for encrypted private keys, instead of prompting
+	PassphraseEnv string
+
+	// HostName is the host's configured name when Host is an address it
+	// was resolved to; host certificates may name either
+	HostName string
+
+	// KnownHostsPath is the known_hosts file host keys are verified
+	// against and added to (empty for klip's default, see GetKnownHostsPath)
+	KnownHostsPath string
+
+	// KeyDir is searched for default keys instead of ~/.ssh
+	KeyDir string
+
+	// DefaultKeys are the default keys tried, in order, when KeyPath is
+	// empty (nil for DefaultKeyNames, see DefaultKeyPaths)
+	DefaultKeys []string
+
+	// PKCS11Provider is a PKCS#11 module whose keys on a smartcard or
+	// security key sign through the ssh-agent, or PKCS11Agent for the
+	// hardware keys the agent already holds; it replaces KeyPath and the
+	// default keys
+	PKCS11Provider string
+
+	// PINPrompt asks for the token PIN when the agent loads PKCS11Provider
+	// (nil if there is no terminal)
+	PINPrompt func(prompt string) (string, error)
+
+	// NonInteractive fails instead of prompting for a key passphrase, a
+	// password or confirmation of an unknown host key
+	NonInteractive bool
+
+	// StrictHostKeys rejects hosts missing from known_hosts instead of
+	// asking whether to trust them
+	StrictHostKeys bool
+
+	// HostCAKeys are CA public keys, or files of them, trusted to sign
+	// host certificates (see ParseHostCAKeys)
+	HostCAKeys []string
+
+	// HostKeyFingerprint pins the SHA256 fingerprint the host's key must
+	// have; known_hosts and host CAs are then not consulted. It applies to
+	// this hop only, never to Jump.
+	HostKeyFingerprint string
+
+	// HostKeyMaxAge and HostKeyMaxIdle add a host key warning to the
+	// ConnectionInfo when the key was first trusted, or the host last
+	// contacted, longer ago (0 to never warn)
+	HostKeyMaxAge  time.Duration
+	HostKeyMaxIdle time.Duration
+
+	// AllowedCIDRs are the networks the dialed address must be in, e.g.
+	// "100.64.0.0/10"; a connection anywhere else is closed before the
+	// handshake. Behind a jump host it applies to the first hop, the only
+	// address dialed directly.
+	AllowedCIDRs []string
+
+	// Jump is the jump host to connect through (ssh -J); the remote host
+	// is then dialed from the jump host, so Host may be a name only it
+	// resolves. Jump may have a Jump of its own for multi-hop chains, and
+	// each hop's Timeout bounds connecting to that hop.
+	Jump *Config
 }
 
 // NewClient creates a new SSH client
@@ -43,74 +155,177 @@ func NewClient(cfg *Config) (*Client, error) {
 		cfg.Timeout = 30 * time.Second
 	}
 
-	authMethods := []ssh.AuthMethod{}
+	c := &Client{
+		host: cfg.Host,
+		port: cfg.Port,
+	}
 
-	// Try key-based authentication first
-	if !cfg.UsePassword && cfg.KeyPath != "" {
-		keyAuth, err := publicKeyAuth(cfg.KeyPath)
-		if err == nil {
-			authMethods = append(authMethods, keyAuth)
-		}
+	authMethods, _ := buildAuthMethods(cfg, func(method string) {
+		c.info.AuthMethod = method
+	}, func(err error) {
+		c.skippedKeys = append(c.skippedKeys, err.Error())
+	})
+
+	if len(authMethods) == 0 {
+		return nil, fmt.Errorf("no authentication methods available")
 	}
 
-	// Try default SSH keys if no specific key provided
-	if len(authMethods) == 0 && !cfg.UsePassword {
-		if defaultAuth := tryDefaultKeys(); defaultAuth != nil {
-			authMethods = append(authMethods, defaultAuth...)
+	if cfg.Jump != nil {
+		// Jump hosts belong to the same trust domain unless set otherwise
+		if cfg.Jump.KnownHostsPath == "" {
+			cfg.Jump.KnownHostsPath = cfg.KnownHostsPath
+		}
+		if cfg.Jump.KeyDir == "" {
+			cfg.Jump.KeyDir = cfg.KeyDir
+		}
+		if len(cfg.Jump.DefaultKeys) == 0 {
+			cfg.Jump.DefaultKeys = cfg.DefaultKeys
+		}
+		if cfg.Jump.PINPrompt == nil {
+			cfg.Jump.PINPrompt = cfg.PINPrompt
+		}
+		cfg.Jump.StrictHostKeys = cfg.Jump.StrictHostKeys || cfg.StrictHostKeys
+		if cfg.Jump.HostCAKeys == nil {
+			cfg.Jump.HostCAKeys = cfg.HostCAKeys
 		}
+		if cfg.Jump.HostKeyMaxAge == 0 {
+			cfg.Jump.HostKeyMaxAge = cfg.HostKeyMaxAge
+		}
+		if cfg.Jump.HostKeyMaxIdle == 0 {
+			cfg.Jump.HostKeyMaxIdle = cfg.HostKeyMaxIdle
+		}
+		if cfg.Jump.AllowedCIDRs == nil {
+			cfg.Jump.AllowedCIDRs = cfg.AllowedCIDRs
+		}
+		jump, err := NewClient(cfg.Jump)
+		if err != nil {
+			return nil, fmt.Errorf("jump host: %w", err)
+		}
+		c.jump = jump
 	}
 
-	// Add password authentication if requested or as fallback
-	if cfg.UsePassword && cfg.Password != "" {
-		authMethods = append(authMethods, ssh.Password(cfg.Password))
+	hostCAs, err := ParseHostCAKeys(cfg.HostCAKeys)
+	if err != nil {
+		return nil, err
 	}
 
-	// Add keyboard-interactive for password prompt
-	if cfg.UsePassword || len(authMethods) == 0 {
-		authMethods = append(authMethods, ssh.KeyboardInteractive(keyboardInteractiveChallenge))
+	for _, cidr := range cfg.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network '%s': %w", cidr, err)
+		}
+		c.allowed = append(c.allowed, network)
 	}
 
-	if len(authMethods) == 0 {
-		return nil, fmt.Errorf("no authentication methods available")
-	}
+	// Host key records are best effort; without them nothing is tracked
+	recordsPath, _ := HostKeyRecordsPath()
 
-	clientConfig := &ssh.ClientConfig{
-		User:            cfg.User,
-		Auth:            authMethods,
-		HostKeyCallback: NewHostKeyCallback(),
-		Timeout:         cfg.Timeout,
+	verifyHostKey := NewHostKeyCallback(HostKeyPolicy{
+		KnownHostsPath: cfg.KnownHostsPath,
+		HostCAs:        hostCAs,
+		HostName:       cfg.HostName,
+		Fingerprint:    cfg.HostKeyFingerprint,
+		Strict:         cfg.StrictHostKeys,
+		NonInteractive: cfg.NonInteractive,
+		RecordsPath:    recordsPath,
+		MaxKeyAge:      cfg.HostKeyMaxAge,
+		MaxIdle:        cfg.HostKeyMaxIdle,
+		Warn: func(message string) {
+			c.info.HostKeyWarnings = append(c.info.HostKeyWarnings, message)
+		},
+	})
+	c.config = &ssh.ClientConfig{
+		User: cfg.User,
+		Auth: authMethods,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			c.info.HostKeyType = key.Type()
+			c.info.HostKeyFingerprint = ssh.FingerprintSHA256(key)
+			err := verifyHostKey(hostname, remote, key)
+			c.handshakeSpan.SetAttrs(tracing.String("ssh.host_key_type", key.Type()))
+			c.handshakeSpan.Finish(err)
+			if err == nil {
+				_, c.authSpan = tracing.Start(c.traceCtx, "ssh.auth")
+			}
+			return err
+		},
+		Timeout: cfg.Timeout,
 	}
 
-	return &Client{
-		config: clientConfig,
-		host:   cfg.Host,
-		port:   cfg.Port,
-	}, nil
+	return c, nil
+}
+
+// ConnectionInfo returns what the last Connect attempt talked to
+func (c *Client) ConnectionInfo() ConnectionInfo {
+	return c.info
+}
+
+// AuthKeyFingerprint returns the fingerprint of the key the connection
+// authenticated with, as recorded in AuthMethod, or "" if no key signed
+func (i ConnectionInfo) AuthKeyFingerprint() string {
+	if !strings.HasPrefix(i.AuthMethod, "publickey ") || !strings.HasSuffix(i.AuthMethod, ")") {
+		return ""
+	}
+	open := strings.LastIndex(i.AuthMethod, " (")
+	if open < 0 {
+		return ""
+	}
+	return i.AuthMethod[open+2 : len(i.AuthMethod)-1]
 }
 
 // Connect establishes the SSH connection
-func (c *Client) Connect(ctx context.Context) error {
+// The context bounds the dial and handshake only; once connected, the
+// connection lives until Close is called
+func (c *Client) Connect(ctx context.Context) (err error) {
 	address := fmt.Sprintf("%s:%d", c.host, c.port)
 
-	// Create a dialer with context support
-	dialer := &net.Dialer{
-		Timeout: c.config.Timeout,
-	}
+	ctx, span := tracing.Start(ctx, "ssh.connect", tracing.String("server.address", c.host), tracing.Int("server.port", c.port))
+	defer func() { span.Finish(err) }()
 
-	conn, err := dialer.DialContext(ctx, "tcp", address)
+	c.info = ConnectionInfo{}
+	c.skippedKeys = nil
+	dialCtx, dialSpan := tracing.Start(ctx, "ssh.dial")
+	conn, err := c.dial(dialCtx, address)
+	dialSpan.Finish(err)
 	if err != nil {
-		return fmt.Errorf("failed to dial: %w", err)
+		return err
 	}
-
-	// Wrap connection to support context cancellation
-	connWithContext := &contextConn{
-		Conn: conn,
-		ctx:  ctx,
+	c.info.RemoteAddr = conn.RemoteAddr().String()
+	if c.jump != nil {
+		// Channels through the jump host have no real remote address
+		c.info.RemoteAddr = address
 	}
 
-	sshConn, chans, reqs, err := ssh.NewClientConn(connWithContext, address, c.config)
+	// Abort the handshake if the context is cancelled before it completes
+	handshakeDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshakeDone:
+		}
+	}()
+
+	// The host key is verified at the end of the key exchange, which
+	// separates the handshake from authentication
+	_, c.handshakeSpan = tracing.Start(ctx, "ssh.handshake")
+	c.authSpan = nil
+	c.traceCtx = ctx
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, c.config)
+	close(handshakeDone)
+	c.handshakeSpan.Finish(err)
+	c.authSpan.SetAttrs(tracing.String("ssh.auth_method", c.info.AuthMethod))
+	c.authSpan.Finish(err)
 	if err != nil {
 		conn.Close()
+		if c.jump != nil {
+			c.jump.Close()
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to create SSH connection: %w", ctx.Err())
+		}
+		if len(c.skippedKeys) > 0 {
+			return fmt.Errorf("failed to create SSH connection: %w (skipped keys: %s)", err, strings.Join(c.skippedKeys, "; "))
+		}
 		return fmt.Errorf("failed to create SSH connection: %w", err)
 	}
 
@@ -118,12 +333,148 @@ func (c *Client) Connect(ctx context.Context) error {
 	return nil
 }
 
-// Close closes the SSH connection
+// dial opens the TCP connection to address, directly or through the jump
+// host. A jump host connection is closed again if the remote host cannot
+// be reached from it.
+func (c *Client) dial(ctx context.Context, address string) (net.Conn, error) {
+	if c.jump == nil {
+		// Name resolution ends when the first connection attempt starts
+		var lookup *tracing.Span
+		if net.ParseIP(c.host) == nil {
+			_, lookup = tracing.Start(ctx, "dns", tracing.String("dns.question.name", c.host))
+		}
+		// Dial an address checked against the allowed networks rather than
+		// letting the dialer pick any the name resolves to
+		if len(c.allowed) > 0 {
+			host, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %s: %w", address, err)
+			}
+			ip, err := VetAddress(ctx, host, c.allowed)
+			lookup.Finish(err)
+			if err != nil {
+				return nil, err
+			}
+			address = net.JoinHostPort(ip, port)
+		}
+		dialer := &net.Dialer{
+			Timeout: c.config.Timeout,
+			ControlContext: func(ctx context.Context, network, address string, conn syscall.RawConn) error {
+				lookup.Finish(nil)
+				return nil
+			},
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		lookup.Finish(err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial: %w", err)
+		}
+		if err := c.checkAllowed(conn.RemoteAddr()); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	jumpCtx, cancel := withTimeout(ctx, c.jump.config.Timeout)
+	defer cancel()
+	if err := c.jump.Connect(jumpCtx); err != nil {
+		return nil, fmt.Errorf("failed to connect to jump host %s: %w", c.jump.host, err)
+	}
+	hop := c.jump.info
+	hop.Jumps = nil
+	c.info.Jumps = append(append([]ConnectionInfo(nil), c.jump.info.Jumps...), hop)
+
+	dialCtx, cancelDial := withTimeout(ctx, c.config.Timeout)
+	defer cancelDial()
+	conn, err := c.jump.client.DialContext(dialCtx, "tcp", address)
+	if err != nil {
+		c.jump.Close()
+		return nil, fmt.Errorf("failed to dial %s from jump host: %w", address, err)
+	}
+	return conn, nil
+}
+
+// withTimeout bounds ctx by timeout, or leaves it unbounded when timeout
+// is zero, as net.Dialer treats a zero Timeout
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// checkAllowed refuses a connection to an address outside the allowed
+// networks, which a spoofed DNS answer or the wrong backend could lead to
+func (c *Client) checkAllowed(remote net.Addr) error {
+	if len(c.allowed) == 0 {
+		return nil
+	}
+	if tcp, ok := remote.(*net.TCPAddr); ok {
+		if inNetworks(tcp.IP, c.allowed) {
+			return nil
+		}
+		return outsideAllowed(c.host, tcp.IP.String(), c.allowed)
+	}
+	return outsideAllowed(c.host, remote.String(), c.allowed)
+}
+
+// VetAddress returns the address to dial host at within the allowed
+// networks: host itself if it is an IP address, or else the first address
+// it resolves to. A name with any address outside the networks is
+// refused, so the address dialed cannot depend on which one is tried.
+func VetAddress(ctx context.Context, host string, allowed []*net.IPNet) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if !inNetworks(ip, allowed) {
+			return "", outsideAllowed(host, host, allowed)
+		}
+		return host, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s to check it against the allowed networks: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !inNetworks(ip, allowed) {
+			return "", outsideAllowed(host, ip.String(), allowed)
+		}
+	}
+	return ips[0].String(), nil
+}
+
+// inNetworks reports whether ip is in one of networks
+func inNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// outsideAllowed is the error for connecting to host at an address outside
+// the allowed networks
+func outsideAllowed(host, address string, allowed []*net.IPNet) error {
+	networks := make([]string, len(allowed))
+	for i, network := range allowed {
+		networks[i] = network.String()
+	}
+	return fmt.Errorf("refusing to connect to %s: %s is outside the allowed networks (%s)", host, address, strings.Join(networks, ", "))
+}
+
+// Close closes the SSH connection and the jump host connection under it
 func (c *Client) Close() error {
+	var err error
 	if c.client != nil {
-		return c.client.Close()
+		err = c.client.Close()
 	}
-	return nil
+	if c.jump != nil {
+		if jumpErr := c.jump.Close(); err == nil {
+			err = jumpErr
+		}
+	}
+	return err
 }
 
 // IsConnected checks if the client is connected
@@ -131,6 +482,69 @@ func (c *Client) IsConnected() bool {
 	return c.client != nil
 }
 
+// KeepAlive sends a keepalive request every interval until ctx is
+// cancelled, like ssh's ServerAliveInterval. If maxMissed keepalives in a
+// row go unanswered within an interval (ServerAliveCountMax), or the
+// connection fails, it is considered dead: it is closed and an error is
+// returned.
+func (c *Client) KeepAlive(ctx context.Context, interval time.Duration, maxMissed int) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	maxMissed = max(maxMissed, 1)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		reply := make(chan error, 1)
+		go func() {
+			// Servers reject the unknown request, but any reply proves liveness
+			_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+			reply <- err
+		}()
+
+		var err error
+		select {
+		case <-ctx.Done():
+			return nil
+		case err = <-reply:
+			missed = 0
+		case <-time.After(interval):
+			if missed++; missed < maxMissed {
+				continue
+			}
+			err = fmt.Errorf("%d keepalives unanswered", missed)
+		}
+		if err != nil {
+			c.client.Close()
+			return fmt.Errorf("keepalive failed: %w", err)
+		}
+	}
+}
+
+// IsConnectionLost reports whether err from a session means the connection
+// dropped, as opposed to the remote shell or command exiting
+func IsConnectionLost(err error) bool {
+	var missing *ssh.ExitMissingError
+	return errors.As(err, &missing) || errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed)
+}
+
+// IsUnreachable reports whether err from Connect means the host could not
+// be reached, as opposed to an SSH server rejecting the connection
+func IsUnreachable(err error) bool {
+	var opErr *net.OpError
+	var channelErr *ssh.OpenChannelError
+	return errors.As(err, &opErr) || errors.As(err, &channelErr)
+}
+
 // GetClient returns the underlying SSH client
 func (c *Client) GetClient() *ssh.Client {
 	return c.client
@@ -171,6 +585,212 @@ func (c *Client) RunCommand(ctx context.Context, command string) (string, error)
 	return string(output), nil
 }
 
+// RunCommandInput executes a command with stdin connected to input and
+// returns the output
+func (c *Client) RunCommandInput(ctx context.Context, command string, input io.Reader) (string, error) {
+	session, err := c.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	session.Stdin = input
+
+	// Set up context cancellation
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	output, err := session.CombinedOutput(command)
+	if err != nil {
+		return string(output), fmt.Errorf("command failed: %w", err)
+	}
+
+	return string(output), nil
+}
+
+// LineCallback receives a single line of remote command output
+// isStderr reports whether the line was written to the remote stderr
+type LineCallback func(line string, isStderr bool)
+
+// RunCommandStream executes a command and copies its output to the given
+// writers as it is produced, instead of buffering until completion
+// A nil writer discards the corresponding stream
+func (c *Client) RunCommandStream(ctx context.Context, command string, stdout, stderr io.Writer) error {
+	return c.RunCommandPipe(ctx, command, nil, stdout, stderr)
+}
+
+// RunCommandPipe is RunCommandStream with stdin fed from stdin until it
+// reaches EOF, which closes the remote stdin; nil leaves it empty
+// The command may exit before stdin is used up, as with ssh
+func (c *Client) RunCommandPipe(ctx context.Context, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := c.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := pipeStdin(session, stdin); err != nil {
+		return err
+	}
+
+	// Set up context cancellation
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	if err := session.Run(command); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("command failed: %w", ctx.Err())
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
+
+// RunCommandTerminal executes a command on a pseudo-terminal, like ssh -t,
+// connected to the local stdin, stdout and stderr. If stdin is a terminal it
+// is put in raw mode while the command runs and its size is passed on.
+func (c *Client) RunCommandTerminal(ctx context.Context, command string) error {
+	session, err := c.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	width, height := 80, 24
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+		}
+		defer term.Restore(fd, oldState)
+
+		if w, h, err := term.GetSize(fd); err == nil {
+			width, height = w, h
+		}
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty(terminalType(), height, width, modes); err != nil {
+		return fmt.Errorf("failed to request pty: %w", err)
+	}
+
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	if err := pipeStdin(session, os.Stdin); err != nil {
+		return err
+	}
+
+	// Set up context cancellation
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+
+	if err := session.Run(command); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("command failed: %w", ctx.Err())
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+// terminalType returns the local TERM for the remote pseudo-terminal
+func terminalType() string {
+	if t := os.Getenv("TERM"); t != "" {
+		return t
+	}
+	return "xterm-256color"
+}
+
+// pipeStdin copies stdin to the session in the background. Unlike setting
+// session.Stdin, the session does not wait for stdin to reach EOF before
+// returning, so a command that ignores its input does not hang on a
+// terminal or an open pipe.
+func pipeStdin(session *ssh.Session, stdin io.Reader) error {
+	if stdin == nil {
+		return nil
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open remote stdin: %w", err)
+	}
+	go func() {
+		io.Copy(w, stdin)
+		w.Close()
+	}()
+	return nil
+}
+
+// ExitStatus returns the exit status of the remote command that caused err.
+// A command killed by a signal reports 128 plus the signal number, as
+// shells do. ok is false if the command did not exit, e.g. because the
+// connection dropped.
+func ExitStatus(err error) (status int, ok bool) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// RunCommandLines executes a command and invokes callback for every line of
+// stdout and stderr as it arrives
+// Calls to callback are serialized, so it does not need to be thread-safe
+func (c *Client) RunCommandLines(ctx context.Context, command string, callback LineCallback) error {
+	var mu sync.Mutex
+	stdout := newLineWriter(func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		callback(line, false)
+	})
+	stderr := newLineWriter(func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		callback(line, true)
+	})
+
+	err := c.RunCommandStream(ctx, command, stdout, stderr)
+
+	// Deliver any trailing output that was not newline-terminated
+	stdout.Flush()
+	stderr.Flush()
+
+	return err
+}
+
 // InteractiveShell starts an interactive SSH shell
 func (c *Client) InteractiveShell() error {
 	session, err := c.NewSession()
@@ -222,40 +842,308 @@ func (c *Client) InteractiveShell() error {
 	return session.Wait()
 }
 
+// AuthMethodInfo describes an authentication method considered for a connection
+type AuthMethodInfo struct {
+	// Method is the SSH authentication method (publickey, password, keyboard-interactive)
+	Method string
+
+	// Detail identifies the credential, e.g. the key file
+	Detail string
+
+	// Problem explains why the method will be skipped (empty if it will be tried)
+	Problem string
+}
+
+// PlanAuth returns the authentication methods NewClient would use for cfg,
+// in the order they are tried, including configured methods that will be
+// skipped and why
+func PlanAuth(cfg *Config) []AuthMethodInfo {
+	_, infos := buildAuthMethods(cfg, func(string) {}, func(error) {})
+	return infos
+}
+
+// buildAuthMethods assembles the authentication methods for cfg
+// record is called with a description of each method as it is attempted,
+// and skip with the reason a passphrase-protected key could not be unlocked
+// or a hardware key could not be used
+func buildAuthMethods(cfg *Config, record func(method string), skip func(err error)) ([]ssh.AuthMethod, []AuthMethodInfo) {
+	var methods []ssh.AuthMethod
+	var infos []AuthMethodInfo
+
+	// A hardware token replaces key files
+	if !cfg.UsePassword && cfg.PKCS11Provider != "" {
+		methods = append(methods, hardwareKeyAuth(cfg.PKCS11Provider, cfg.PINPrompt, record, skip))
+		info := AuthMethodInfo{Method: "publickey", Detail: hardwareKeyDetail(cfg.PKCS11Provider)}
+		if _, err := agentSocket(); err != nil {
+			info.Problem = err.Error()
+		}
+		infos = append(infos, info)
+	}
+
+	// Then the profile's key file
+	if !cfg.UsePassword && cfg.PKCS11Provider == "" && cfg.KeyPath != "" {
+		keyAuth, encrypted, err := publicKeyAuth(cfg.KeyPath, cfg.PassphraseEnv, cfg.NonInteractive, record, skip)
+		if err == nil {
+			methods = append(methods, keyAuth)
+			infos = append(infos, AuthMethodInfo{Method: "publickey", Detail: keyDetail(cfg.KeyPath, encrypted)})
+		} else {
+			infos = append(infos, AuthMethodInfo{Method: "publickey", Detail: cfg.KeyPath, Problem: err.Error()})
+		}
+	}
+
+	// Try default SSH keys if no specific key provided
+	if len(methods) == 0 && !cfg.UsePassword {
+		defaultAuth, defaultInfos := tryDefaultKeys(cfg.KeyDir, cfg.DefaultKeys, cfg.PassphraseEnv, cfg.NonInteractive, record, skip)
+		if defaultAuth != nil {
+			methods = append(methods, defaultAuth)
+		}
+		infos = append(infos, defaultInfos...)
+	}
+
+	// Add password authentication if requested or as fallback
+	if cfg.UsePassword && cfg.Password != "" {
+		password := cfg.Password
+		methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+			record("password")
+			return password, nil
+		}))
+		infos = append(infos, AuthMethodInfo{Method: "password", Detail: "configured password"})
+	}
+
+	// Add keyboard-interactive for password prompt
+	if cfg.UsePassword || len(methods) == 0 {
+		methods = append(methods, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			record("keyboard-interactive")
+			if cfg.NonInteractive && len(questions) > 0 {
+				return nil, fmt.Errorf("the server asks for a password and klip is running non-interactively")
+			}
+			return keyboardInteractiveChallenge(user, instruction, questions, echos)
+		}))
+		infos = append(infos, AuthMethodInfo{Method: "keyboard-interactive", Detail: "password prompt"})
+	}
+
+	return methods, infos
+}
+
 // publicKeyAuth creates SSH auth from private key file
-func publicKeyAuth(keyPath string) (ssh.AuthMethod, error) {
+// Passphrase-protected keys are unlocked when the method is first tried, so
+// the passphrase is only asked for if earlier methods did not succeed.
+// record is called when the server accepts the key and it signs, skip if
+// it cannot be unlocked.
+func publicKeyAuth(keyPath, passphraseEnv string, nonInteractive bool, record func(method string), skip func(err error)) (ssh.AuthMethod, bool, error) {
 	key, err := os.ReadFile(keyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key: %w", err)
+		return nil, false, fmt.Errorf("failed to read private key: %w", err)
 	}
 
 	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signer, err := unlockKey(keyPath, key, passphraseEnv, nonInteractive)
+			if err != nil {
+				// Skip the key rather than aborting the handshake, so
+				// remaining methods are still tried
+				skip(err)
+				return nil, nil
+			}
+			return []ssh.Signer{recordSigner(signer, keyPath, record)}, nil
+		}), true, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, false, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
-	return ssh.PublicKeys(signer), nil
+	return ssh.PublicKeys(recordSigner(signer, keyPath, record)), false, nil
 }
 
-// tryDefaultKeys tries to load default SSH keys
-func tryDefaultKeys() []ssh.AuthMethod {
-	homeDir, err := os.UserHomeDir()
+// recordSigner wraps signer so that record is called when it signs
+func recordSigner(signer ssh.Signer, keyPath string, record func(method string)) ssh.Signer {
+	algSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return signer
+	}
+
+	return &recordingSigner{
+		AlgorithmSigner: algSigner,
+		method:          fmt.Sprintf("publickey %s (%s)", keyPath, ssh.FingerprintSHA256(signer.PublicKey())),
+		record:          record,
+	}
+}
+
+// recordingSigner reports when a key is used to sign, which only happens
+// once the server has accepted the key
+type recordingSigner struct {
+	ssh.AlgorithmSigner
+	method string
+	record func(method string)
+}
+
+// Sign records the key's use and signs data
+func (s *recordingSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	s.record(s.method)
+	return s.AlgorithmSigner.Sign(rand, data)
+}
+
+// SignWithAlgorithm records the key's use and signs data with algorithm
+func (s *recordingSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.record(s.method)
+	return s.AlgorithmSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// tryDefaultKeys loads the default SSH keys from keyDir (~/.ssh if empty)
+// into a single auth method that offers them to the server in order: the
+// SSH library tries only the first method of each kind, so one method per
+// key would stop at the first key. Passphrase-protected keys are unlocked
+// only once the server accepts them, or when the method is first tried if
+// their public key is unknown; skip is called for those that cannot be.
+// Returns the method, nil if no key loads, and a description of each key.
+func tryDefaultKeys(keyDir string, names []string, passphraseEnv string, nonInteractive bool, record func(method string), skip func(err error)) (ssh.AuthMethod, []AuthMethodInfo) {
+	var signers []ssh.Signer
+	var locked []*lockedKey
+	var infos []AuthMethodInfo
+	for _, keyPath := range DefaultKeyPaths(keyDir, names) {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			infos = append(infos, AuthMethodInfo{Method: "publickey", Detail: keyPath, Problem: fmt.Sprintf("failed to read private key: %v", err)})
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			lk := &lockedKey{keyPath: keyPath, key: key, pub: missing.PublicKey, passphraseEnv: passphraseEnv, nonInteractive: nonInteractive}
+			if lk.pub == nil {
+				lk.pub = publicKeyFile(keyPath + ".pub")
+			}
+			if lk.pub != nil {
+				signers = append(signers, recordSigner(lk, keyPath, record))
+			} else {
+				locked = append(locked, lk)
+			}
+			infos = append(infos, AuthMethodInfo{Method: "publickey", Detail: keyDetail(keyPath, true)})
+			continue
+		}
+		if err != nil {
+			infos = append(infos, AuthMethodInfo{Method: "publickey", Detail: keyPath, Problem: fmt.Sprintf("failed to parse private key: %v", err)})
+			continue
+		}
+		signers = append(signers, recordSigner(signer, keyPath, record))
+		infos = append(infos, AuthMethodInfo{Method: "publickey", Detail: keyDetail(keyPath, false)})
+	}
+
+	if len(signers) == 0 && len(locked) == 0 {
+		return nil, infos
+	}
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		result := append([]ssh.Signer(nil), signers...)
+		for _, lk := range locked {
+			signer, err := lk.unlock()
+			if err != nil {
+				skip(err)
+				continue
+			}
+			result = append(result, recordSigner(signer, lk.keyPath, record))
+		}
+		return result, nil
+	}), infos
+}
+
+// publicKeyFile returns the public key in an authorized_keys format file
+// such as id_ed25519.pub, or nil if there is none
+func publicKeyFile(path string) ssh.PublicKey {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
 	if err != nil {
 		return nil
 	}
+	return pub
+}
 
-	sshDir := filepath.Join(homeDir, ".ssh")
-	defaultKeys := []string{"id_rsa", "id_ed25519", "id_ecdsa", "id_dsa"}
+// lockedKey is a passphrase-protected key offered by its public key and
+// unlocked when the server accepts it and it has to sign
+type lockedKey struct {
+	keyPath        string
+	key            []byte
+	pub            ssh.PublicKey
+	passphraseEnv  string
+	nonInteractive bool
+}
 
-	var methods []ssh.AuthMethod
-	for _, keyFile := range defaultKeys {
-		keyPath := filepath.Join(sshDir, keyFile)
-		if auth, err := publicKeyAuth(keyPath); err == nil {
-			methods = append(methods, auth)
+// unlock returns the key's signer, asking for the passphrase unless the
+// key was unlocked before
+func (k *lockedKey) unlock() (ssh.Signer, error) {
+	return unlockKey(k.keyPath, k.key, k.passphraseEnv, k.nonInteractive)
+}
+
+// PublicKey returns the key's public key
+func (k *lockedKey) PublicKey() ssh.PublicKey {
+	return k.pub
+}
+
+// Sign unlocks the key and signs data
+func (k *lockedKey) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	signer, err := k.unlock()
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand, data)
+}
+
+// SignWithAlgorithm unlocks the key and signs data with algorithm
+func (k *lockedKey) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	signer, err := k.unlock()
+	if err != nil {
+		return nil, err
+	}
+	algSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("key %s cannot sign with %s", k.keyPath, algorithm)
+	}
+	return algSigner.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// DefaultKeyNames are the default keys tried when none are configured,
+// strongest first. DSA keys are left out: OpenSSH no longer accepts them.
+var DefaultKeyNames = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// DefaultKeyPaths returns the default keys that exist in keyDir, or in
+// ~/.ssh if keyDir is empty, in the order they are tried. names are file
+// names in keyDir or absolute paths, nil for DefaultKeyNames.
+func DefaultKeyPaths(keyDir string, names []string) []string {
+	if keyDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil
 		}
+		keyDir = filepath.Join(homeDir, ".ssh")
+	}
+	if len(names) == 0 {
+		names = DefaultKeyNames
 	}
 
-	return methods
+	var paths []string
+	for _, name := range names {
+		keyPath := name
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(keyDir, name)
+		}
+		if _, err := os.Stat(keyPath); err == nil {
+			paths = append(paths, keyPath)
+		}
+	}
+	return paths
+}
+
+// keyDetail describes a key for AuthMethodInfo
+func keyDetail(keyPath string, encrypted bool) string {
+	if encrypted {
+		return keyPath + " (passphrase-protected)"
+	}
+	return keyPath
 }
 
 // keyboardInteractiveChallenge handles keyboard-interactive authentication
@@ -263,19 +1151,16 @@ func keyboardInteractiveChallenge(user, instruction string, questions []string,
 	answers := make([]string, len(questions))
 
 	for i, question := range questions {
-		fmt.Print(question)
-
 		var answer string
+		var err error
 		if echos[i] {
-			fmt.Scanln(&answer)
+			answer, err = ui.ReadLine(question)
 		} else {
 			// Read password without echo
-			passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-			if err != nil {
-				return nil, err
-			}
-			answer = string(passwordBytes)
-			fmt.Println()
+			answer, err = ui.ReadSecret(question)
+		}
+		if err != nil {
+			return nil, err
 		}
 
 		answers[i] = answer
@@ -284,30 +1169,6 @@ func keyboardInteractiveChallenge(user, instruction string, questions []string,
 	return answers, nil
 }
 
-// contextConn wraps net.Conn to support context cancellation
-type contextConn struct {
-	net.Conn
-	ctx context.Context
-}
-
-func (c *contextConn) Read(b []byte) (n int, err error) {
-	select {
-	case <-c.ctx.Done():
-		return 0, c.ctx.Err()
-	default:
-		return c.Conn.Read(b)
-	}
-}
-
-func (c *contextConn) Write(b []byte) (n int, err error) {
-	select {
-	case <-c.ctx.Done():
-		return 0, c.ctx.Err()
-	default:
-		return c.Conn.Write(b)
-	}
-}
-
 // CopyReader is a helper to copy from a reader with context support
 func CopyReader(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
 	written := int64(0)
@@ -342,3 +1203,39 @@ func CopyReader(ctx context.Context, dst io.Writer, src io.Reader) (int64, error
 	}
 	return written, nil
 }
+
+// lineWriter is an io.Writer that splits written data into lines
+type lineWriter struct {
+	buf    []byte
+	onLine func(line string)
+}
+
+// newLineWriter creates a writer that calls onLine for every complete line
+func newLineWriter(onLine func(line string)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+// Write buffers data and emits each complete line without its terminator
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.buf[:idx]), "\r")
+		w.buf = w.buf[idx+1:]
+		w.onLine(line)
+	}
+
+	return len(p), nil
+}
+
+// Flush emits any buffered partial line
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.onLine(strings.TrimSuffix(string(w.buf), "\r"))
+		w.buf = nil
+	}
+}
@@ -0,0 +1,555 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestClientCheckAllowed(t *testing.T) {
+	cfg := &Config{Host: "db", UsePassword: true, Password: testPassword, AllowedCIDRs: []string{"100.64.0.0/10", "fd7a:115c:a1e0::/48"}}
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+
+	assert.NoError(t, client.checkAllowed(&net.TCPAddr{IP: net.ParseIP("100.101.2.3"), Port: 22}))
+	assert.NoError(t, client.checkAllowed(&net.TCPAddr{IP: net.ParseIP("fd7a:115c:a1e0::5"), Port: 22}))
+	err = client.checkAllowed(&net.TCPAddr{IP: net.ParseIP("192.168.1.20"), Port: 22})
+	assert.EqualError(t, err, "refusing to connect to db: 192.168.1.20 is outside the allowed networks (100.64.0.0/10, fd7a:115c:a1e0::/48)")
+
+	// Without allowed networks anything goes
+	client, err = NewClient(&Config{Host: "db", UsePassword: true, Password: testPassword})
+	require.NoError(t, err)
+	assert.NoError(t, client.checkAllowed(&net.TCPAddr{IP: net.ParseIP("192.168.1.20"), Port: 22}))
+
+	_, err = NewClient(&Config{Host: "db", UsePassword: true, Password: testPassword, AllowedCIDRs: []string{"100.64.0.5"}})
+	assert.ErrorContains(t, err, "invalid allowed network")
+}
+
+func TestVetAddress(t *testing.T) {
+	ctx := context.Background()
+	loopback, err := config.ParseCIDRs([]string{"127.0.0.0/8", "::1/128"})
+	require.NoError(t, err)
+	private, err := config.ParseCIDRs([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	address, err := VetAddress(ctx, "127.0.0.1", loopback)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", address)
+	_, err = VetAddress(ctx, "127.0.0.1", private)
+	assert.ErrorContains(t, err, "127.0.0.1 is outside the allowed networks (10.0.0.0/8)")
+
+	// A name is dialed at one of its addresses, and only if all of them
+	// are allowed
+	address, err = VetAddress(ctx, "localhost", loopback)
+	require.NoError(t, err)
+	assert.True(t, net.ParseIP(address).IsLoopback())
+	_, err = VetAddress(ctx, "localhost", private)
+	assert.ErrorContains(t, err, "refusing to connect to localhost")
+	partial, err := config.ParseCIDRs([]string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	if ips, _ := net.LookupIP("localhost"); len(ips) > 1 {
+		_, err = VetAddress(ctx, "localhost", partial)
+		assert.ErrorContains(t, err, "outside the allowed networks")
+	}
+}
+
+func TestClientAllowedCIDRs(t *testing.T) {
+	server := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The connection is refused before the handshake
+	cfg := server.config(t)
+	cfg.AllowedCIDRs = []string{"10.0.0.0/8"}
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+	_, err = client.ScanHostKey(ctx)
+	assert.ErrorContains(t, err, "outside the allowed networks")
+
+	cfg = server.config(t)
+	cfg.Host = "localhost"
+	cfg.AllowedCIDRs = []string{"127.0.0.0/8", "::1/128"}
+	client, err = NewClient(cfg)
+	require.NoError(t, err)
+	_, err = client.ScanHostKey(ctx)
+	assert.NoError(t, err)
+}
+
+func TestClientJumpInheritsAllowedCIDRs(t *testing.T) {
+	jump := &Config{Host: "bastion", UsePassword: true, Password: testPassword}
+	client, err := NewClient(&Config{Host: "db", UsePassword: true, Password: testPassword, AllowedCIDRs: []string{"100.64.0.0/10"}, Jump: jump})
+	require.NoError(t, err)
+
+	// The first hop is the address dialed directly, so it is checked
+	require.Len(t, client.jump.allowed, 1)
+	assert.Equal(t, "100.64.0.0/10", client.jump.allowed[0].String())
+	assert.Error(t, client.jump.checkAllowed(&net.TCPAddr{IP: net.ParseIP("192.168.1.20"), Port: 22}))
+
+	// A hop with networks of its own keeps them
+	jump = &Config{Host: "bastion", UsePassword: true, Password: testPassword, AllowedCIDRs: []string{"192.168.1.0/24"}}
+	client, err = NewClient(&Config{Host: "db", UsePassword: true, Password: testPassword, AllowedCIDRs: []string{"100.64.0.0/10"}, Jump: jump})
+	require.NoError(t, err)
+	assert.NoError(t, client.jump.checkAllowed(&net.TCPAddr{IP: net.ParseIP("192.168.1.20"), Port: 22}))
+}
+
+// writeTestKey writes a new ed25519 key to dir/name, encrypted with
+// passphrase unless it is empty, with a .pub file if withPub, and returns
+// its public key
+func writeTestKey(t *testing.T, dir, name, passphrase string, withPub bool) ssh.PublicKey {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(private, name)
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(private, name, []byte(passphrase))
+	}
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+
+	pub, err := ssh.NewPublicKey(private.Public())
+	require.NoError(t, err)
+	if withPub {
+		require.NoError(t, os.WriteFile(path+".pub", ssh.MarshalAuthorizedKey(pub), 0644))
+	}
+	return pub
+}
+
+// keyConfig returns a configuration logging in to server with the default
+// keys names in dir
+func keyConfig(t *testing.T, server *testServer, dir string, names ...string) *Config {
+	cfg := server.config(t)
+	cfg.UsePassword = false
+	cfg.Password = ""
+	cfg.KeyDir = dir
+	cfg.DefaultKeys = names
+	return cfg
+}
+
+// isUnlocked reports whether the key at keyPath was decrypted
+func isUnlocked(keyPath string) bool {
+	unlockedKeysMu.Lock()
+	defer unlockedKeysMu.Unlock()
+	_, ok := unlockedKeys[keyPath]
+	return ok
+}
+
+func TestDefaultKeyPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"id_rsa", "id_ed25519", "work_ecdsa"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	fleet := filepath.Join(t.TempDir(), "fleet_key")
+	require.NoError(t, os.WriteFile(fleet, nil, 0600))
+
+	// Built-in names in their fixed order, for an unset or empty list
+	want := []string{filepath.Join(dir, "id_ed25519"), filepath.Join(dir, "id_rsa")}
+	assert.Equal(t, want, DefaultKeyPaths(dir, nil))
+	assert.Equal(t, want, DefaultKeyPaths(dir, []string{}))
+
+	// Configured names keep their order; missing keys are left out
+	assert.Equal(t, []string{filepath.Join(dir, "work_ecdsa"), fleet, filepath.Join(dir, "id_rsa")},
+		DefaultKeyPaths(dir, []string{"work_ecdsa", "missing", fleet, "id_rsa"}))
+}
+
+func TestDefaultKeysOrder(t *testing.T) {
+	dir := t.TempDir()
+	first := writeTestKey(t, dir, "first", "", false)
+	second := writeTestKey(t, dir, "second", "", false)
+	third := writeTestKey(t, dir, "third", "", false)
+	server := newTestServer(t)
+	server.authorized = []ssh.PublicKey{third}
+
+	client, err := server.connectWith(t, keyConfig(t, server, dir, "first", "missing", "second", "third"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{ssh.FingerprintSHA256(first), ssh.FingerprintSHA256(second), ssh.FingerprintSHA256(third)}, server.offeredKeys())
+	assert.Contains(t, client.ConnectionInfo().AuthMethod, filepath.Join(dir, "third"))
+	assert.Contains(t, client.ConnectionInfo().AuthMethod, ssh.FingerprintSHA256(third))
+}
+
+func TestDefaultKeysUnlockAccepted(t *testing.T) {
+	t.Setenv("KLIP_TEST_PASSPHRASE", "hunter2")
+
+	t.Run("rejected key stays locked", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestKey(t, dir, "locked", "hunter2", true)
+		plain := writeTestKey(t, dir, "plain", "", false)
+		server := newTestServer(t)
+		server.authorized = []ssh.PublicKey{plain}
+
+		cfg := keyConfig(t, server, dir, "locked", "plain")
+		cfg.PassphraseEnv = "KLIP_TEST_PASSPHRASE"
+		_, err := server.connectWith(t, cfg)
+		require.NoError(t, err)
+		assert.Len(t, server.offeredKeys(), 2)
+		assert.False(t, isUnlocked(filepath.Join(dir, "locked")))
+	})
+
+	t.Run("accepted key is unlocked", func(t *testing.T) {
+		dir := t.TempDir()
+		locked := writeTestKey(t, dir, "locked", "hunter2", true)
+		server := newTestServer(t)
+		server.authorized = []ssh.PublicKey{locked}
+
+		cfg := keyConfig(t, server, dir, "locked")
+		cfg.PassphraseEnv = "KLIP_TEST_PASSPHRASE"
+		client, err := server.connectWith(t, cfg)
+		require.NoError(t, err)
+		assert.True(t, isUnlocked(filepath.Join(dir, "locked")))
+		assert.Contains(t, client.ConnectionInfo().AuthMethod, filepath.Join(dir, "locked"))
+	})
+
+	t.Run("key that cannot be unlocked is reported", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestKey(t, dir, "locked", "hunter2", false)
+		server := newTestServer(t)
+
+		cfg := keyConfig(t, server, dir)
+		cfg.KeyPath = filepath.Join(dir, "locked")
+		cfg.PassphraseEnv = "KLIP_TEST_UNSET"
+		_, err := server.connectWith(t, cfg)
+		assert.ErrorContains(t, err, "skipped keys: environment variable KLIP_TEST_UNSET is not set")
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := withTimeout(context.Background(), 0)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok, "a zero timeout leaves the context unbounded")
+	assert.NoError(t, ctx.Err())
+
+	ctx, cancel = withTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.True(t, ok)
+}
+
+func TestKeepAlive(t *testing.T) {
+	t.Run("answered", func(t *testing.T) {
+		server := newTestServer(t)
+		client := server.connect(t)
+
+		// Replies keep the connection open until the context ends, even
+		// the refusals servers send for the unknown request
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, client.KeepAlive(ctx, 20*time.Millisecond, 1))
+		assert.GreaterOrEqual(t, server.keepalives.Load(), int32(3))
+		_, _, err := client.GetClient().SendRequest("keepalive@openssh.com", true, nil)
+		assert.NoError(t, err, "connection still open")
+	})
+
+	t.Run("unanswered", func(t *testing.T) {
+		server := newTestServer(t)
+		client := server.connect(t)
+		server.unresponsive.Store(true)
+
+		// maxMissed keepalives in a row go unanswered, and the connection
+		// is closed
+		start := time.Now()
+		err := client.KeepAlive(context.Background(), 20*time.Millisecond, 3)
+		assert.EqualError(t, err, "keepalive failed: 3 keepalives unanswered")
+		assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+		_, err = client.GetClient().NewSession()
+		assert.True(t, IsConnectionLost(err), "%v", err)
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		client, err := NewClient(&Config{Host: "127.0.0.1"})
+		require.NoError(t, err)
+		assert.EqualError(t, client.KeepAlive(context.Background(), time.Second, 3), "not connected")
+	})
+}
+
+func TestIsConnectionLost(t *testing.T) {
+	assert.True(t, IsConnectionLost(&ssh.ExitMissingError{}))
+	assert.True(t, IsConnectionLost(io.EOF))
+	assert.True(t, IsConnectionLost(fmt.Errorf("read: %w", net.ErrClosed)))
+	assert.False(t, IsConnectionLost(&ssh.ExitError{}))
+	assert.False(t, IsConnectionLost(errors.New("command not found")))
+	assert.False(t, IsConnectionLost(nil))
+
+	// A session whose channel closes without an exit status lost its
+	// connection
+	server := newTestServer(t)
+	server.handle = func(newChannel ssh.NewChannel) {
+		ch, reqs, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		req := <-reqs
+		req.Reply(true, nil)
+		ch.Close()
+	}
+	session, err := server.connect(t).NewSession()
+	require.NoError(t, err)
+	err = session.Run("sleep 60")
+	assert.True(t, IsConnectionLost(err), "%v", err)
+}
+
+// serveCommands is a channel handler running sessions whose exec request
+// runs one of a few commands: "cat" echoes the session's input, "exit N"
+// exits with status N, "mixed" writes lines to stdout and stderr, the last
+// one unterminated, and anything else is not found. The terminal type
+// and size of each pty-req are sent on ptys.
+func serveCommands(ptys chan<- string) func(ssh.NewChannel) {
+	return func(newChannel ssh.NewChannel) {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.Prohibited, "sessions only")
+			return
+		}
+		ch, reqs, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		defer ch.Close()
+		for req := range reqs {
+			switch req.Type {
+			case "pty-req":
+				var pty struct {
+					Term                         string
+					Columns, Rows, Width, Height uint32
+					Modes                        string
+				}
+				if ssh.Unmarshal(req.Payload, &pty) == nil {
+					ptys <- fmt.Sprintf("%s %dx%d", pty.Term, pty.Columns, pty.Rows)
+				}
+				req.Reply(true, nil)
+			case "exec":
+				var exec struct{ Command string }
+				if ssh.Unmarshal(req.Payload, &exec) != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				status := 0
+				switch name, arg, _ := strings.Cut(exec.Command, " "); name {
+				case "cat":
+					io.Copy(ch, ch)
+				case "exit":
+					status, _ = strconv.Atoi(arg)
+				case "mixed":
+					io.WriteString(ch, "out 1\r\nout ")
+					io.WriteString(ch.Stderr(), "err 1\n")
+					io.WriteString(ch, "2\nout 3")
+				default:
+					fmt.Fprintf(ch.Stderr(), "sh: %s: not found\n", name)
+					status = 127
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+				return
+			default:
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func TestRunCommandPipe(t *testing.T) {
+	server := newTestServer(t)
+	server.handle = serveCommands(nil)
+	client := server.connect(t)
+
+	// stdin reaches the command until EOF
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, client.RunCommandPipe(context.Background(), "cat", strings.NewReader("hello\n"), &stdout, &stderr))
+	assert.Equal(t, "hello\n", stdout.String())
+	assert.Empty(t, stderr.String())
+
+	// A non-zero exit is an error carrying the status
+	err := client.RunCommandPipe(context.Background(), "exit 3", nil, &stdout, &stderr)
+	status, ok := ExitStatus(err)
+	assert.True(t, ok, "%v", err)
+	assert.Equal(t, 3, status)
+
+	err = client.RunCommandPipe(context.Background(), "rsnyc", nil, &stdout, &stderr)
+	status, ok = ExitStatus(err)
+	assert.True(t, ok, "%v", err)
+	assert.Equal(t, 127, status)
+	assert.Equal(t, "sh: rsnyc: not found\n", stderr.String())
+
+	// A command that did not exit has no status
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.RunCommandPipe(ctx, "cat", nil, nil, nil)
+	require.Error(t, err)
+	_, ok = ExitStatus(err)
+	assert.False(t, ok)
+	_, ok = ExitStatus(nil)
+	assert.False(t, ok)
+}
+
+func TestRunCommandTerminal(t *testing.T) {
+	t.Setenv("TERM", "vt100")
+	// Not a terminal, so the default size is requested
+	stdin, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer w.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = oldStdin })
+
+	ptys := make(chan string, 1)
+	server := newTestServer(t)
+	server.handle = serveCommands(ptys)
+	client := server.connect(t)
+
+	err = client.RunCommandTerminal(context.Background(), "exit 5")
+	status, ok := ExitStatus(err)
+	assert.True(t, ok, "%v", err)
+	assert.Equal(t, 5, status)
+	select {
+	case pty := <-ptys:
+		assert.Equal(t, "vt100 80x24", pty)
+	default:
+		t.Fatal("no pty-req was sent")
+	}
+}
+
+func TestConnectionInfoAuthKeyFingerprint(t *testing.T) {
+	for method, want := range map[string]string{
+		"publickey /home/me/my keys/id_ed25519 (SHA256:abc)":      "SHA256:abc",
+		"publickey pkcs11:/usr/lib/opensc-pkcs11.so (SHA256:def)": "SHA256:def",
+		"password":             "",
+		"keyboard-interactive": "",
+		"":                     "",
+	} {
+		assert.Equal(t, want, ConnectionInfo{AuthMethod: method}.AuthKeyFingerprint(), method)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := newLineWriter(func(line string) { lines = append(lines, line) })
+
+	// Lines split across writes are joined, CRLF endings are dropped and
+	// several lines in one write are each emitted
+	for _, p := range []string{"fir", "st\nsec", "ond\r", "\nthird\r\nfour", "th\n\n"} {
+		n, err := w.Write([]byte(p))
+		require.NoError(t, err)
+		assert.Equal(t, len(p), n)
+	}
+	assert.Equal(t, []string{"first", "second", "third", "fourth", ""}, lines)
+
+	// A trailing partial line is only emitted by Flush, once
+	lines = nil
+	w.Write([]byte("partial\r"))
+	assert.Empty(t, lines)
+	w.Flush()
+	w.Flush()
+	assert.Equal(t, []string{"partial"}, lines)
+}
+
+func TestRunCommandLines(t *testing.T) {
+	server := newTestServer(t)
+	server.handle = serveCommands(nil)
+	client := server.connect(t)
+
+	var stdout, stderr []string
+	require.NoError(t, client.RunCommandLines(context.Background(), "mixed", func(line string, isStderr bool) {
+		if isStderr {
+			stderr = append(stderr, line)
+		} else {
+			stdout = append(stdout, line)
+		}
+	}))
+	assert.Equal(t, []string{"out 1", "out 2", "out 3"}, stdout)
+	assert.Equal(t, []string{"err 1"}, stderr)
+
+	// RunCommandStream keeps the streams apart unchanged
+	var rawOut, rawErr bytes.Buffer
+	require.NoError(t, client.RunCommandStream(context.Background(), "mixed", &rawOut, &rawErr))
+	assert.Equal(t, "out 1\r\nout 2\nout 3", rawOut.String())
+	assert.Equal(t, "err 1\n", rawErr.String())
+}
+
+func TestPlanAuth(t *testing.T) {
+	dir := t.TempDir()
+	writeTestKey(t, dir, "id_ed25519", "", false)
+	writeTestKey(t, dir, "id_ecdsa", "secret", true)
+	writeTestKey(t, dir, "work", "", false)
+	writeTestKey(t, dir, "locked", "secret", true)
+	key := func(name string) AuthMethodInfo {
+		return AuthMethodInfo{Method: "publickey", Detail: filepath.Join(dir, name)}
+	}
+	keyboard := AuthMethodInfo{Method: "keyboard-interactive", Detail: "password prompt"}
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want []AuthMethodInfo
+	}{
+		{
+			name: "explicit key",
+			cfg:  Config{KeyPath: filepath.Join(dir, "work"), KeyDir: dir},
+			want: []AuthMethodInfo{key("work")},
+		},
+		{
+			name: "encrypted key",
+			cfg:  Config{KeyPath: filepath.Join(dir, "locked"), KeyDir: dir},
+			want: []AuthMethodInfo{{Method: "publickey", Detail: filepath.Join(dir, "locked") + " (passphrase-protected)"}},
+		},
+		{
+			name: "missing key falls back to default keys",
+			cfg:  Config{KeyPath: filepath.Join(dir, "gone"), KeyDir: dir, DefaultKeys: []string{"id_ed25519"}},
+			want: []AuthMethodInfo{
+				{Method: "publickey", Detail: filepath.Join(dir, "gone"), Problem: "failed to read private key: open " + filepath.Join(dir, "gone") + ": no such file or directory"},
+				key("id_ed25519"),
+			},
+		},
+		{
+			name: "default keys in the configured order",
+			cfg:  Config{KeyDir: dir, DefaultKeys: []string{"id_ecdsa", "id_rsa", "id_ed25519"}},
+			want: []AuthMethodInfo{
+				{Method: "publickey", Detail: filepath.Join(dir, "id_ecdsa") + " (passphrase-protected)"},
+				key("id_ed25519"),
+			},
+		},
+		{
+			name: "no keys",
+			cfg:  Config{KeyDir: t.TempDir()},
+			want: []AuthMethodInfo{keyboard},
+		},
+		{
+			name: "hardware keys replace key files",
+			cfg:  Config{KeyPath: filepath.Join(dir, "work"), KeyDir: dir, PKCS11Provider: PKCS11Agent},
+			want: []AuthMethodInfo{{Method: "publickey", Detail: "hardware keys in ssh-agent", Problem: "SSH_AUTH_SOCK is not set; hardware keys are used through a running ssh-agent"}},
+		},
+		{
+			name: "password",
+			cfg:  Config{KeyPath: filepath.Join(dir, "work"), KeyDir: dir, UsePassword: true, Password: testPassword},
+			want: []AuthMethodInfo{{Method: "password", Detail: "configured password"}, keyboard},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, PlanAuth(&tt.cfg))
+		})
+	}
+
+	// With an agent the hardware keys can be tried
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(dir, "agent.sock"))
+	assert.Equal(t, []AuthMethodInfo{{Method: "publickey", Detail: "PKCS#11 /usr/lib/opensc-pkcs11.so via ssh-agent"}},
+		PlanAuth(&Config{PKCS11Provider: "/usr/lib/opensc-pkcs11.so"}))
+}
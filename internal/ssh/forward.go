@@ -0,0 +1,152 @@
+// Package ssh - Port forwarding
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// ForwardEvent reports a tunnelled connection opening or closing
+type ForwardEvent struct {
+	// From is the address of the peer that connected to the listener
+	From string
+
+	// Open is true when the connection was established, false when it closed
+	Open bool
+
+	// Err is set if the target could not be dialed
+	Err error
+}
+
+// ForwardLocal accepts connections on ln and tunnels each of them to
+// target, dialed from the remote host (ssh -L). It blocks until ctx is
+// cancelled or ln fails, then closes ln and waits for open tunnels to end.
+// notify, if not nil, is called for every connection opened or closed.
+func (c *Client) ForwardLocal(ctx context.Context, ln net.Listener, target string, notify func(ForwardEvent)) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+
+	return serveForward(ctx, ln, func() (net.Conn, error) {
+		return c.client.Dial("tcp", target)
+	}, target, notify)
+}
+
+// ForwardRemote asks the remote host to listen on listenAddr and tunnels
+// each connection it accepts to target, dialed locally (ssh -R). It blocks
+// until ctx is cancelled or the connection drops.
+// notify, if not nil, is called for every connection opened or closed.
+func (c *Client) ForwardRemote(ctx context.Context, listenAddr, target string, notify func(ForwardEvent)) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+
+	ln, err := c.client.Listen("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("remote host refused to listen on %s: %w", listenAddr, err)
+	}
+
+	var dialer net.Dialer
+	return serveForward(ctx, ln, func() (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", target)
+	}, target, notify)
+}
+
+// serveForward accepts connections on ln and pipes each of them to a
+// connection opened with dial
+func serveForward(ctx context.Context, ln net.Listener, dial func() (net.Conn, error), target string, notify func(ForwardEvent)) error {
+	if notify == nil {
+		notify = func(ForwardEvent) {}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	closed := false
+
+	// Closing the listener unblocks Accept; closing open connections ends
+	// their copy loops
+	closeAll := func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		closed = true
+		for conn := range conns {
+			conn.Close()
+		}
+	}
+	stop := context.AfterFunc(ctx, closeAll)
+	defer stop()
+
+	var err error
+	for {
+		var accepted net.Conn
+		accepted, err = ln.Accept()
+		if err != nil {
+			break
+		}
+
+		mu.Lock()
+		if closed {
+			mu.Unlock()
+			accepted.Close()
+			continue
+		}
+		conns[accepted] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, accepted)
+				mu.Unlock()
+				accepted.Close()
+			}()
+
+			from := accepted.RemoteAddr().String()
+			dialed, err := dial()
+			if err != nil {
+				notify(ForwardEvent{From: from, Err: fmt.Errorf("failed to connect to %s: %w", target, err)})
+				return
+			}
+			defer dialed.Close()
+
+			notify(ForwardEvent{From: from, Open: true})
+			pipe(accepted, dialed)
+			notify(ForwardEvent{From: from})
+		}()
+	}
+
+	closeAll()
+	wg.Wait()
+
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return fmt.Errorf("failed to accept connection: %w", err)
+}
+
+// pipe copies between a and b in both directions until either side is done
+func pipe(a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
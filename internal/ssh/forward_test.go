@@ -0,0 +1,338 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// listenEcho starts a TCP server on the loopback interface that echoes
+// what it receives, stopped when the test ends, and returns its address
+func listenEcho(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// closedAddress returns a loopback address nothing listens on
+func closedAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// serveDirectTCPIP is a channel handler that dials the target of each
+// direct-tcpip channel, like sshd does for ssh -L
+func serveDirectTCPIP(newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "direct-tcpip" {
+		newChannel.Reject(ssh.Prohibited, "direct-tcpip only")
+		return
+	}
+	var target struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn)
+}
+
+// roundTrip writes msg to conn and returns what is read back
+func roundTrip(t *testing.T, conn net.Conn, msg string) string {
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err := conn.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	return string(buf)
+}
+
+func TestForwardLocal(t *testing.T) {
+	server := newTestServer(t)
+	server.handle = serveDirectTCPIP
+	client := server.connect(t)
+
+	// forward starts forwarding from a new loopback listener to target and
+	// returns the listener address, the events and a function that stops
+	// the forward and returns its error
+	forward := func(t *testing.T, target string) (string, chan ForwardEvent, func() error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		events := make(chan ForwardEvent, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- client.ForwardLocal(ctx, ln, target, func(ev ForwardEvent) { events <- ev })
+		}()
+		return ln.Addr().String(), events, func() error {
+			cancel()
+			return <-done
+		}
+	}
+
+	t.Run("tunnels connections", func(t *testing.T) {
+		addr, events, stop := forward(t, listenEcho(t))
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", roundTrip(t, conn, "hello"))
+		opened := <-events
+		assert.True(t, opened.Open)
+		assert.NoError(t, opened.Err)
+		assert.Equal(t, conn.LocalAddr().String(), opened.From)
+
+		conn.Close()
+		closed := <-events
+		assert.False(t, closed.Open)
+		assert.Equal(t, opened.From, closed.From)
+
+		require.NoError(t, stop())
+		_, err = net.Dial("tcp", addr)
+		assert.Error(t, err, "listener still open after the forward stopped")
+	})
+
+	// Stopping the forward ends the tunnels still open
+	t.Run("stop closes tunnels", func(t *testing.T) {
+		addr, events, stop := forward(t, listenEcho(t))
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Equal(t, "ping", roundTrip(t, conn, "ping"))
+		assert.True(t, (<-events).Open)
+
+		require.NoError(t, stop())
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("unreachable target", func(t *testing.T) {
+		target := closedAddress(t)
+		addr, events, stop := forward(t, target)
+		defer stop()
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		ev := <-events
+		assert.False(t, ev.Open)
+		assert.ErrorContains(t, ev.Err, "failed to connect to "+target)
+
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		c, err := NewClient(server.config(t))
+		require.NoError(t, err)
+		assert.ErrorContains(t, c.ForwardLocal(context.Background(), ln, listenEcho(t), nil), "not connected")
+	})
+}
+
+// remoteForwards serves the tcpip-forward requests of one client
+// connection, like sshd does for ssh -R
+type remoteForwards struct {
+	conn *ssh.ServerConn
+
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+}
+
+// newRemoteForwards returns the forwards of conn
+func newRemoteForwards(conn *ssh.ServerConn) *remoteForwards {
+	return &remoteForwards{conn: conn, listeners: make(map[string]net.Listener)}
+}
+
+// handle serves req if it starts or cancels a forward, and reports whether
+// it did
+func (f *remoteForwards) handle(req *ssh.Request) bool {
+	if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" {
+		return false
+	}
+
+	var bind struct {
+		Addr string
+		Port uint32
+	}
+	if err := ssh.Unmarshal(req.Payload, &bind); err != nil {
+		req.Reply(false, nil)
+		return true
+	}
+	addr := net.JoinHostPort(bind.Addr, strconv.Itoa(int(bind.Port)))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if req.Type == "cancel-tcpip-forward" {
+		ln, ok := f.listeners[addr]
+		if ok {
+			ln.Close()
+			delete(f.listeners, addr)
+		}
+		req.Reply(ok, nil)
+		return true
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		req.Reply(false, nil)
+		return true
+	}
+	port := uint32(ln.Addr().(*net.TCPAddr).Port)
+	f.listeners[net.JoinHostPort(bind.Addr, strconv.Itoa(int(port)))] = ln
+	req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			origin := conn.RemoteAddr().(*net.TCPAddr)
+			go func() {
+				defer conn.Close()
+				ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+					Addr       string
+					Port       uint32
+					OriginAddr string
+					OriginPort uint32
+				}{bind.Addr, port, origin.IP.String(), uint32(origin.Port)}))
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				pipe(ch, conn)
+			}()
+		}
+	}()
+	return true
+}
+
+// closeAll stops every forward when the connection ends
+func (f *remoteForwards) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ln := range f.listeners {
+		ln.Close()
+	}
+}
+
+func TestForwardRemote(t *testing.T) {
+	server := newTestServer(t)
+	server.forwards = true
+
+	// forward starts forwarding from a free port on the server to target
+	// and returns the port's address, the events, a function that stops
+	// the forward and the channel receiving its error
+	forward := func(t *testing.T, client *Client, target string) (string, chan ForwardEvent, context.CancelFunc, chan error) {
+		addr := closedAddress(t)
+		events := make(chan ForwardEvent, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- client.ForwardRemote(ctx, addr, target, func(ev ForwardEvent) { events <- ev })
+		}()
+
+		// The forward is up once the server listens
+		require.Eventually(t, func() bool {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			for (<-events).Open {
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+
+		return addr, events, cancel, done
+	}
+
+	t.Run("tunnels connections", func(t *testing.T) {
+		addr, events, stop, done := forward(t, server.connect(t), listenEcho(t))
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", roundTrip(t, conn, "hello"))
+		assert.True(t, (<-events).Open)
+		conn.Close()
+		assert.False(t, (<-events).Open)
+
+		stop()
+		require.NoError(t, <-done)
+		require.Eventually(t, func() bool {
+			_, err := net.Dial("tcp", addr)
+			return err != nil
+		}, 5*time.Second, 10*time.Millisecond, "server still listening after the forward stopped")
+	})
+
+	t.Run("unreachable target", func(t *testing.T) {
+		target := closedAddress(t)
+		addr, events, stop, _ := forward(t, server.connect(t), target)
+		defer stop()
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.ErrorContains(t, (<-events).Err, "failed to connect to "+target)
+	})
+
+	// A dropped connection ends the forward with an error, so klip forward
+	// can reconnect
+	t.Run("connection lost", func(t *testing.T) {
+		client := server.connect(t)
+		_, _, stop, done := forward(t, client, listenEcho(t))
+		defer stop()
+		client.GetClient().Close()
+		assert.ErrorContains(t, <-done, "failed to accept connection")
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		server := newTestServer(t)
+		addr := closedAddress(t)
+		err := server.connect(t).ForwardRemote(context.Background(), addr, listenEcho(t), nil)
+		assert.ErrorContains(t, err, "remote host refused to listen on "+addr)
+	})
+}
@@ -1,10 +1,16 @@
 package ssh
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // HealthCheckResult contains the result of an SSH health check
@@ -87,6 +93,130 @@ func QuickCheck(ctx context.Context, host string, port int) bool {
 	return err == nil || isAuthError(err)
 }
 
+// CheckBanner reports whether an SSH server is answering on host:port by
+// reading its version banner. Unlike QuickCheck it never performs a key
+// exchange, so it cannot trigger host key prompts and is safe to poll.
+func CheckBanner(ctx context.Context, host string, port int) error {
+	if port == 0 {
+		port = 22
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("failed to dial: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no SSH banner: %w", err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("not an SSH server: %q", strings.TrimSpace(banner))
+	}
+
+	return nil
+}
+
+// errHostKeyScanned ends the handshake of readHostKey once the key is known
+var errHostKeyScanned = errors.New("host key scanned")
+
+// ScanHostKey returns the host key the SSH server on host:port presents,
+// like ssh-keyscan. The handshake stops after the key exchange, so nothing
+// is verified or authenticated.
+func ScanHostKey(ctx context.Context, host string, port int) (ssh.PublicKey, error) {
+	if port == 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	return readHostKey(conn, address, "")
+}
+
+// scanAlgorithms are the host key algorithms ScanHostKeys asks for, one
+// per key type
+var scanAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+}
+
+// ScanHostKeys returns every host key the SSH server on host:port has, one
+// handshake per key type like ssh-keyscan. Key types the server doesn't
+// offer are skipped; it is an error if it offers none of them.
+func ScanHostKeys(ctx context.Context, host string, port int) ([]ssh.PublicKey, error) {
+	if port == 0 {
+		port = 22
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+
+	var keys []ssh.PublicKey
+	var lastErr error
+	for _, algorithm := range scanAlgorithms {
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial: %w", err)
+		}
+		key, err := readHostKey(conn, address, algorithm)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, lastErr
+	}
+	return keys, nil
+}
+
+// ScanHostKey reads the key the remote host presents, like the ScanHostKey
+// function, dialing it through the jump host if the client has one
+func (c *Client) ScanHostKey(ctx context.Context) (ssh.PublicKey, error) {
+	address := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+	conn, err := c.dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return readHostKey(conn, address, "")
+}
+
+// readHostKey starts an SSH handshake on conn, closing it once the server
+// has presented its host key; algorithm limits the key to one host key
+// algorithm unless empty
+func readHostKey(conn net.Conn, address, algorithm string) (ssh.PublicKey, error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: "klip",
+		HostKeyCallback: func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errHostKeyScanned
+		},
+	}
+	if algorithm != "" {
+		config.HostKeyAlgorithms = []string{algorithm}
+	}
+	_, _, _, err := ssh.NewClientConn(conn, address, config)
+	if key == nil {
+		return nil, fmt.Errorf("failed to read host key: %w", err)
+	}
+	return key, nil
+}
+
 // isAuthError checks if an error is an authentication error
 func isAuthError(err error) bool {
 	if err == nil {
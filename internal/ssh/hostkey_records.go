@@ -0,0 +1,132 @@
+// Package ssh - Host key age tracking
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/filelock"
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyRecordsFileName is the name of the host key record file in klip's
+// XDG state directory
+const HostKeyRecordsFileName = "host_keys.json"
+
+// HostKeyRecord is when a host key was first trusted and last verified by
+// klip. Keys trusted before klip tracked them count from their first
+// verification after.
+type HostKeyRecord struct {
+	FirstSeen    time.Time `json:"first_seen"`
+	LastVerified time.Time `json:"last_verified"`
+}
+
+// HostKeyRecordsPath returns the XDG-compliant path to the host key records
+func HostKeyRecordsPath() (string, error) {
+	stateDir := filepath.Join(xdg.StateHome, "klip")
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return filepath.Join(stateDir, HostKeyRecordsFileName), nil
+}
+
+// LoadHostKeyRecords reads the host key records at path, keyed by host
+// and key fingerprint (see hostKeyRecordKey). A missing or corrupt file
+// yields no records.
+func LoadHostKeyRecords(path string) map[string]HostKeyRecord {
+	records := make(map[string]HostKeyRecord)
+	if data, err := os.ReadFile(path); err == nil {
+		if json.Unmarshal(data, &records) != nil {
+			records = make(map[string]HostKeyRecord)
+		}
+	}
+	return records
+}
+
+// hostKeyRecordKey identifies a host's key in the records
+func hostKeyRecordKey(hostname string, key ssh.PublicKey) string {
+	return hostname + " " + ssh.FingerprintSHA256(key)
+}
+
+// recordHostKey marks hostname's key as verified at now in the records at
+// path and returns its previous record (zero for a key seen the first
+// time). The file is locked from the read to the write, so concurrent
+// connections never drop each other's records.
+func recordHostKey(path, hostname string, key ssh.PublicKey, now time.Time) (HostKeyRecord, error) {
+	unlock, err := filelock.Lock(path)
+	if err != nil {
+		return HostKeyRecord{}, err
+	}
+	defer unlock()
+
+	records := LoadHostKeyRecords(path)
+	id := hostKeyRecordKey(hostname, key)
+
+	previous := records[id]
+	record := HostKeyRecord{FirstSeen: previous.FirstSeen, LastVerified: now}
+	if record.FirstSeen.IsZero() {
+		record.FirstSeen = now
+	}
+	records[id] = record
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return previous, fmt.Errorf("failed to marshal host key records: %w", err)
+	}
+
+	// Write through a temporary file so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return previous, fmt.Errorf("failed to write host key records: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return previous, fmt.Errorf("failed to write host key records: %w", err)
+	}
+	return previous, nil
+}
+
+// trackHostKey records that hostname's key was verified and warns if it
+// was first trusted more than MaxKeyAge ago or last verified more than
+// MaxIdle ago. Certificates are not tracked: their CA vouches for them and
+// they are meant to be reissued.
+func (p HostKeyPolicy) trackHostKey(hostname string, key ssh.PublicKey) {
+	if p.RecordsPath == "" {
+		return
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		return
+	}
+
+	now := time.Now()
+	previous, err := recordHostKey(p.RecordsPath, hostname, key, now)
+	if err != nil || previous.FirstSeen.IsZero() || p.Warn == nil {
+		return
+	}
+
+	if age := now.Sub(previous.FirstSeen); p.MaxKeyAge > 0 && age > p.MaxKeyAge {
+		p.Warn(fmt.Sprintf("The %s host key of %s was first trusted %d days ago; verify its fingerprint %s with the host's administrator or rotate it",
+			key.Type(), hostname, days(age), ssh.FingerprintSHA256(key)))
+	}
+	if idle := now.Sub(previous.LastVerified); p.MaxIdle > 0 && idle > p.MaxIdle {
+		p.Warn(fmt.Sprintf("%s was last contacted %d days ago; check that its %s key fingerprint %s is still the one you expect",
+			hostname, days(idle), key.Type(), ssh.FingerprintSHA256(key)))
+	}
+}
+
+// days returns d in whole days
+func days(d time.Duration) int {
+	return int(d / (24 * time.Hour))
+}
@@ -0,0 +1,116 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordHostKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HostKeyRecordsFileName)
+	key := newTestSigner(t).PublicKey()
+	first := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := first.Add(48 * time.Hour)
+
+	// A key seen the first time has no previous record
+	previous, err := recordHostKey(path, "server", key, first)
+	require.NoError(t, err)
+	assert.True(t, previous.FirstSeen.IsZero())
+
+	// Later verifications keep when it was first seen
+	previous, err = recordHostKey(path, "server", key, later)
+	require.NoError(t, err)
+	assert.True(t, previous.FirstSeen.Equal(first))
+	assert.True(t, previous.LastVerified.Equal(first))
+
+	records := LoadHostKeyRecords(path)
+	record := records[hostKeyRecordKey("server", key)]
+	assert.True(t, record.FirstSeen.Equal(first))
+	assert.True(t, record.LastVerified.Equal(later))
+
+	// The same key under another name is recorded separately
+	previous, err = recordHostKey(path, "alias", key, later)
+	require.NoError(t, err)
+	assert.True(t, previous.FirstSeen.IsZero())
+	assert.Len(t, LoadHostKeyRecords(path), 2)
+}
+
+func TestRecordHostKeyConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HostKeyRecordsFileName)
+	key := newTestSigner(t).PublicKey()
+
+	// Every connection's record survives the others' writes
+	const hosts = 20
+	var wg sync.WaitGroup
+	for i := 0; i < hosts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := recordHostKey(path, fmt.Sprintf("host%d", i), key, time.Now())
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, LoadHostKeyRecords(path), hosts)
+	matches, err := filepath.Glob(path + ".*.tmp")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestLoadHostKeyRecordsCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HostKeyRecordsFileName)
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+	assert.Empty(t, LoadHostKeyRecords(path))
+
+	// A corrupt file is replaced by the next record
+	_, err := recordHostKey(path, "server", newTestSigner(t).PublicKey(), time.Now())
+	require.NoError(t, err)
+	assert.Len(t, LoadHostKeyRecords(path), 1)
+}
+
+func TestTrackHostKey(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	newPolicy := func(t *testing.T, warnings *[]string) HostKeyPolicy {
+		return HostKeyPolicy{
+			RecordsPath: filepath.Join(t.TempDir(), HostKeyRecordsFileName),
+			MaxKeyAge:   24 * time.Hour,
+			MaxIdle:     24 * time.Hour,
+			Warn:        func(message string) { *warnings = append(*warnings, message) },
+		}
+	}
+
+	t.Run("new and recent keys do not warn", func(t *testing.T) {
+		var warnings []string
+		policy := newPolicy(t, &warnings)
+		policy.trackHostKey("server", key)
+		policy.trackHostKey("server", key)
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("old and idle keys warn", func(t *testing.T) {
+		var warnings []string
+		policy := newPolicy(t, &warnings)
+		_, err := recordHostKey(policy.RecordsPath, "server", key, time.Now().Add(-72*time.Hour))
+		require.NoError(t, err)
+
+		policy.trackHostKey("server", key)
+		require.Len(t, warnings, 2)
+		assert.Contains(t, warnings[0], "first trusted 3 days ago")
+		assert.Contains(t, warnings[1], "last contacted 3 days ago")
+	})
+
+	t.Run("certificates are not tracked", func(t *testing.T) {
+		var warnings []string
+		policy := newPolicy(t, &warnings)
+		cert := newHostCert(t, newTestSigner(t), key, uint64(time.Now().Add(time.Hour).Unix()), "server")
+		policy.trackHostKey("server", cert)
+		assert.NoFileExists(t, policy.RecordsPath)
+	})
+}
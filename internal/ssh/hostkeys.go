@@ -3,33 +3,67 @@
 package ssh
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/ed25519"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/ui"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // GetKnownHostsPath returns the XDG-compliant path to the known_hosts file
-func GetKnownHostsPath() (string, error) {
+// for a trust domain: known_hosts for profiles outside one ("") and
+// known_hosts.d/<domain> otherwise
+func GetKnownHostsPath(domain string) (string, error) {
 	configDir := filepath.Join(xdg.ConfigHome, "klip")
-	if err := os.MkdirAll(configDir, 0700); err != nil {
+	knownHostsPath := filepath.Join(configDir, "known_hosts")
+	if domain != "" {
+		knownHostsPath = filepath.Join(configDir, "known_hosts.d", domain)
+	}
+	if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0700); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return knownHostsPath, nil
+}
+
+// PinnedKnownHostsPath returns the known_hosts file that trusts only a
+// profile's pinned host key, for ssh_config entries exported for it
+func PinnedKnownHostsPath(profile string) (string, error) {
+	dir := filepath.Join(xdg.ConfigHome, "klip", "known_hosts.pinned")
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return "", fmt.Errorf("failed to create config directory: %w", err)
 	}
-	return filepath.Join(configDir, "known_hosts"), nil
+	return filepath.Join(dir, filepath.Base(profile)), nil
 }
 
-// LoadKnownHosts loads the known_hosts file and returns a host key callback
-func LoadKnownHosts() (ssh.HostKeyCallback, error) {
-	knownHostsPath, err := GetKnownHostsPath()
+// knownHostsFile returns knownHostsPath, or the default known_hosts file if
+// it is empty, creating its directory
+func knownHostsFile(knownHostsPath string) (string, error) {
+	if knownHostsPath == "" {
+		return GetKnownHostsPath("")
+	}
+	if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0700); err != nil {
+		return "", fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+	return knownHostsPath, nil
+}
+
+// LoadKnownHosts loads a known_hosts file (empty for the default) and
+// returns a host key callback
+func LoadKnownHosts(knownHostsPath string) (ssh.HostKeyCallback, error) {
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
 	if err != nil {
 		return nil, err
 	}
@@ -52,11 +86,67 @@ func LoadKnownHosts() (ssh.HostKeyCallback, error) {
 	return callback, nil
 }
 
-// NewHostKeyCallback creates a host key callback with interactive verification
-func NewHostKeyCallback() ssh.HostKeyCallback {
+// HostKeyPolicy controls how NewHostKeyCallback verifies host keys
+type HostKeyPolicy struct {
+	// KnownHostsPath is the known_hosts file (empty for the default)
+	KnownHostsPath string
+
+	// HostCAs are trusted to sign host certificates; a host presenting a
+	// valid certificate from one of them needs no known_hosts entry
+	HostCAs []ssh.PublicKey
+
+	// HostName is accepted as a certificate principal besides the dialed
+	// address, e.g. the profile's remote_host when dialing its IP
+	HostName string
+
+	// Fingerprint is the SHA256 fingerprint the host's key must have (see
+	// config.NormalizeFingerprint); when set, only a key matching it is
+	// accepted, whatever known_hosts contains
+	Fingerprint string
+
+	// Strict and NonInteractive reject unknown hosts instead of asking
+	Strict         bool
+	NonInteractive bool
+
+	// RecordsPath is the file tracking when each host key was first
+	// trusted and last verified (empty to not track them)
+	RecordsPath string
+
+	// MaxKeyAge and MaxIdle are how long after a key was first trusted, or
+	// its host last contacted, Warn is called (0 to never warn)
+	MaxKeyAge time.Duration
+	MaxIdle   time.Duration
+	Warn      func(message string)
+}
+
+// hostKeyPromptMu serializes unknown-host prompts, so connections made in
+// parallel (klip exec on several profiles) ask one at a time instead of
+// interleaving their questions and reading each other's answers
+var hostKeyPromptMu sync.Mutex
+
+// readHostKeyAnswer reads the answer to an unknown-host prompt (replaced
+// in tests)
+var readHostKeyAnswer = ui.ReadLine
+
+// NewHostKeyCallback creates a host key callback with interactive
+// verification against a known_hosts file, trusting host certificates
+// signed by the policy's host CAs
+func NewHostKeyCallback(policy HostKeyPolicy) ssh.HostKeyCallback {
+	knownHostsPath, strict, nonInteractive := policy.KnownHostsPath, policy.Strict, policy.NonInteractive
+
 	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if policy.Fingerprint != "" {
+			return policy.checkPinned(hostname, key)
+		}
+
+		// A certificate from a trusted CA must be valid for this host; it
+		// never falls back to known_hosts
+		if cert, ok := key.(*ssh.Certificate); ok && isHostCA(policy.HostCAs, cert.SignatureKey) {
+			return policy.checkCertificate(hostname, remote, cert)
+		}
+
 		// Try to load known hosts
-		knownHostsCallback, err := LoadKnownHosts()
+		knownHostsCallback, err := LoadKnownHosts(knownHostsPath)
 		if err != nil {
 			// If we can't load known hosts, fail securely
 			return fmt.Errorf("failed to load known hosts: %w", err)
@@ -66,9 +156,20 @@ func NewHostKeyCallback() ssh.HostKeyCallback {
 		err = knownHostsCallback(hostname, remote, key)
 		if err == nil {
 			// Host key is known and matches
+			policy.trackHostKey(hostname, key)
 			return nil
 		}
 
+		// Certificates from an unknown CA are verified by the host key
+		// they certify, like OpenSSH does
+		if cert, ok := key.(*ssh.Certificate); ok {
+			key = cert.Key
+			if err = knownHostsCallback(hostname, remote, key); err == nil {
+				policy.trackHostKey(hostname, key)
+				return nil
+			}
+		}
+
 		// Check if this is a key mismatch (potential MITM) or unknown host
 		if knownHostsErr, ok := err.(*knownhosts.KeyError); ok {
 			if len(knownHostsErr.Want) > 0 {
@@ -81,29 +182,44 @@ func NewHostKeyCallback() ssh.HostKeyCallback {
 					key.Type(), FormatFingerprint(key))
 			}
 
-			// Unknown host - ask user
-			fmt.Printf("\n")
-			fmt.Printf("The authenticity of host '%s (%s)' can't be established.\n", hostname, remote)
-			fmt.Printf("%s key fingerprint is %s\n", key.Type(), FormatFingerprint(key))
-			fmt.Printf("Are you sure you want to continue connecting (yes/no)? ")
+			if strict {
+				return fmt.Errorf("host key verification failed: '%s' is not in known_hosts and strict_host_keys is set (%s key fingerprint is %s); import its key with 'klip hostkey import'", hostname, key.Type(), FormatFingerprint(key))
+			}
+			if nonInteractive {
+				return fmt.Errorf("host key verification failed: '%s' is not a known host and klip is running non-interactively (%s key fingerprint is %s); connect once interactively to accept it", hostname, key.Type(), FormatFingerprint(key))
+			}
+
+			// Unknown host - ask user, one prompt at a time. A parallel
+			// connection to the same host may have been accepted while
+			// this one waited, so known_hosts is checked again first.
+			hostKeyPromptMu.Lock()
+			defer hostKeyPromptMu.Unlock()
+			if VerifyHostKey(knownHostsPath, hostname, key) == nil {
+				policy.trackHostKey(hostname, key)
+				return nil
+			}
+
+			// Like ssh, ask on stderr so stdout keeps only the command's output
+			fmt.Fprintf(os.Stderr, "\n")
+			fmt.Fprintf(os.Stderr, "The authenticity of host '%s (%s)' can't be established.\n", hostname, remote)
+			fmt.Fprintf(os.Stderr, "%s key fingerprint is %s\n", key.Type(), FormatFingerprint(key))
 
-			reader := bufio.NewReader(os.Stdin)
-			response, err := reader.ReadString('\n')
+			response, err := readHostKeyAnswer("Are you sure you want to continue connecting (yes/no)? ")
 			if err != nil {
 				return fmt.Errorf("failed to read user input: %w", err)
 			}
 
-			response = strings.ToLower(strings.TrimSpace(response))
-			if response != "yes" {
+			if strings.ToLower(response) != "yes" {
 				return fmt.Errorf("host key verification failed: user rejected")
 			}
 
 			// User accepted, add to known hosts
-			if err := AddKnownHost(hostname, key); err != nil {
+			if err := AddKnownHost(knownHostsPath, hostname, key); err != nil {
 				return fmt.Errorf("failed to add host to known_hosts: %w", err)
 			}
 
-			fmt.Printf("Warning: Permanently added '%s' (%s) to the list of known hosts.\n", hostname, key.Type())
+			fmt.Fprintf(os.Stderr, "Warning: Permanently added '%s' (%s) to the list of known hosts.\n", hostname, key.Type())
+			policy.trackHostKey(hostname, key)
 			return nil
 		}
 
@@ -112,9 +228,214 @@ func NewHostKeyCallback() ssh.HostKeyCallback {
 	}
 }
 
-// AddKnownHost adds a host and its public key to the known_hosts file
-func AddKnownHost(hostname string, key ssh.PublicKey) error {
-	knownHostsPath, err := GetKnownHostsPath()
+// checkPinned accepts key, or the key a certificate certifies, only if it
+// has the pinned fingerprint
+func (p HostKeyPolicy) checkPinned(hostname string, key ssh.PublicKey) error {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	pinned := pinnedFingerprint(p.Fingerprint)
+	presented := ssh.FingerprintSHA256(key)
+	if presented != "SHA256:"+pinned {
+		return fmt.Errorf("host key verification failed: '%s' presented a %s key with fingerprint %s, but the profile pins SHA256:%s; "+
+			"if the host was reinstalled, confirm the new fingerprint with its administrator and run 'klip profile pin-key'",
+			hostname, key.Type(), presented, pinned)
+	}
+
+	// Record the key unless it is known, so WritePinnedKnownHosts finds it
+	// for system ssh; keys recorded before are left alone
+	var keyErr *knownhosts.KeyError
+	if err := VerifyHostKey(p.KnownHostsPath, hostname, key); errors.As(err, &keyErr) {
+		if err := AddKnownHost(p.KnownHostsPath, hostname, key); err != nil {
+			return fmt.Errorf("failed to add host to known_hosts: %w", err)
+		}
+	}
+	p.trackHostKey(hostname, key)
+	return nil
+}
+
+// pinnedFingerprint returns a pinned fingerprint without its SHA256:
+// prefix and base64 padding
+func pinnedFingerprint(fingerprint string) string {
+	return strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(fingerprint), "SHA256:"), "=")
+}
+
+// WritePinnedKnownHosts writes a known_hosts file at path that trusts only
+// the keys with the pinned fingerprint, for any host, so system ssh
+// enforces a profile's host_key_fingerprint like the Go client does. The
+// keys are taken from a known_hosts file (empty for the default), where
+// connecting with klip records them.
+func WritePinnedKnownHosts(knownHostsPath, fingerprint, path string) error {
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(knownHostsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	pinned := "SHA256:" + pinnedFingerprint(fingerprint)
+	seen := make(map[string]bool)
+	var lines strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		marker, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil || marker != "" || ssh.FingerprintSHA256(key) != pinned {
+			continue
+		}
+		if encoded := string(key.Marshal()); !seen[encoded] {
+			seen[encoded] = true
+			lines.WriteString(knownhosts.Line([]string{"*"}, key) + "\n")
+		}
+	}
+	if len(seen) == 0 {
+		return fmt.Errorf("the pinned host key %s is not in %s; connect once with klip to record it", pinned, knownHostsPath)
+	}
+
+	if err := os.WriteFile(path, []byte(lines.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write pinned known_hosts: %w", err)
+	}
+	return nil
+}
+
+// WriteHostCAKnownHosts writes a known_hosts file at path trusting the
+// host CAs of settings.host_ca_keys (see ParseHostCAKeys) for any host with
+// @cert-authority lines, so system ssh accepts the host certificates the Go
+// client accepts
+func WriteHostCAKnownHosts(entries []string, path string) error {
+	keys, err := ParseHostCAKeys(entries)
+	if err != nil {
+		return err
+	}
+
+	var lines strings.Builder
+	for _, key := range keys {
+		lines.WriteString("@cert-authority " + knownhosts.Line([]string{"*"}, key) + "\n")
+	}
+	if err := os.WriteFile(path, []byte(lines.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write host CA known_hosts: %w", err)
+	}
+	return nil
+}
+
+// checkCertificate verifies a host certificate from a trusted CA for the
+// dialed address or, failing that, the policy's host name
+func (p HostKeyPolicy) checkCertificate(hostname string, remote net.Addr, cert *ssh.Certificate) error {
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+			return isHostCA(p.HostCAs, auth)
+		},
+	}
+
+	err := checker.CheckHostKey(hostname, remote, cert)
+	if err != nil && p.HostName != "" {
+		if _, port, splitErr := net.SplitHostPort(hostname); splitErr == nil {
+			if checker.CheckHostKey(net.JoinHostPort(p.HostName, port), remote, cert) == nil {
+				return nil
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("host certificate verification failed: %w", err)
+	}
+	return nil
+}
+
+// isHostCA reports whether key is one of hostCAs
+func isHostCA(hostCAs []ssh.PublicKey, key ssh.PublicKey) bool {
+	for _, ca := range hostCAs {
+		if bytes.Equal(ca.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseHostCAKeys parses settings.host_ca_keys: each entry is a CA public
+// key in authorized_keys format or the path of a file of them (e.g. the
+// CA's .pub file), with ~ expanded
+func ParseHostCAKeys(entries []string) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(entry)); err == nil {
+			keys = append(keys, key)
+			continue
+		}
+
+		path := entry
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("host CA key %q is neither a public key nor a readable file: %w", entry, err)
+		}
+
+		found := 0
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+			if err != nil {
+				return nil, fmt.Errorf("invalid host CA key in %s: %w", path, err)
+			}
+			keys = append(keys, key)
+			found++
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("no host CA keys in %s", path)
+		}
+	}
+	return keys, nil
+}
+
+// KnownHostKeyTypes returns the key types recorded in a known_hosts file
+// (empty for the default) for a host without connecting to it. An empty
+// result means the host is unknown and its key will have to be confirmed
+// on first connection.
+func KnownHostKeyTypes(knownHostsPath, host string, port int) ([]string, error) {
+	callback, err := LoadKnownHosts(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check with a key no host can have: a KeyError then lists the keys
+	// known_hosts expects for the host, if any
+	probeKey, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create probe key: %w", err)
+	}
+
+	remote := &net.TCPAddr{IP: net.ParseIP(host), Port: port}
+	if remote.IP == nil {
+		remote.IP = net.IPv4zero
+	}
+
+	err = callback(net.JoinHostPort(host, fmt.Sprintf("%d", port)), remote, probeKey)
+	keyErr, ok := err.(*knownhosts.KeyError)
+	if !ok {
+		if err != nil {
+			return nil, fmt.Errorf("failed to check known_hosts: %w", err)
+		}
+		return nil, nil
+	}
+
+	var types []string
+	for _, known := range keyErr.Want {
+		types = append(types, known.Key.Type())
+	}
+	return types, nil
+}
+
+// AddKnownHost adds a host and its public key to a known_hosts file (empty
+// for the default)
+func AddKnownHost(knownHostsPath, hostname string, key ssh.PublicKey) error {
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
 	if err != nil {
 		return err
 	}
@@ -173,9 +494,53 @@ func GetKeyFingerprint(keyPath string) (string, error) {
 	return FormatFingerprint(key.PublicKey()), nil
 }
 
-// VerifyHostKey verifies a host key against known_hosts without connecting
-func VerifyHostKey(hostname string, key ssh.PublicKey) error {
-	callback, err := LoadKnownHosts()
+// GetPublicKeyFingerprint returns the SHA256 fingerprint of a key, as shown
+// by ssh-keygen -l
+func GetPublicKeyFingerprint(keyPath string) (string, error) {
+	key, err := readPublicKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(key), nil
+}
+
+// ReadAuthorizedKey returns the public half of the private key at keyPath
+// as an authorized_keys line
+func ReadAuthorizedKey(keyPath string) ([]byte, error) {
+	key, err := readPublicKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.MarshalAuthorizedKey(key), nil
+}
+
+// readPublicKey returns the public half of the private key at keyPath. The
+// .pub file is preferred so encrypted private keys don't need to be
+// decrypted.
+func readPublicKey(keyPath string) (ssh.PublicKey, error) {
+	if pubData, err := os.ReadFile(keyPath + ".pub"); err == nil {
+		if pub, _, _, _, err := ssh.ParseAuthorizedKey(pubData); err == nil {
+			return pub, nil
+		}
+	}
+
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	key, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	return key.PublicKey(), nil
+}
+
+// VerifyHostKey verifies a host key against a known_hosts file (empty for
+// the default) without connecting
+func VerifyHostKey(knownHostsPath, hostname string, key ssh.PublicKey) error {
+	callback, err := LoadKnownHosts(knownHostsPath)
 	if err != nil {
 		return err
 	}
@@ -186,41 +551,314 @@ func VerifyHostKey(hostname string, key ssh.PublicKey) error {
 	return callback(hostname, addr, key)
 }
 
-// RemoveKnownHost removes all entries for a hostname from known_hosts
-func RemoveKnownHost(hostname string) error {
-	knownHostsPath, err := GetKnownHostsPath()
+// KnownHost is an entry of a known_hosts file
+type KnownHost struct {
+	Line int `json:"line"`
+
+	// Marker is "cert-authority" or "revoked" for marked entries
+	Marker      string   `json:"marker,omitempty"`
+	Hosts       []string `json:"hosts"`
+	Type        string   `json:"type"`
+	Fingerprint string   `json:"fingerprint"`
+	Comment     string   `json:"comment,omitempty"`
+}
+
+// ListKnownHosts returns the entries of a known_hosts file (empty for the
+// default), limited to those for hosts if any are given. Hosts match like
+// in MigrateKnownHosts, so hashed entries are only listed unfiltered.
+func ListKnownHosts(knownHostsPath string, hosts []string) ([]KnownHost, error) {
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	data, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, host := range hosts {
+		wanted[host] = true
 	}
 
-	// Read all lines
-	file, err := os.Open(knownHostsPath)
+	var entries []KnownHost
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(hosts) > 0 && !knownHostsLineMatches(line, wanted, true) {
+			continue
+		}
+		marker, names, key, comment, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, KnownHost{
+			Line:        i + 1,
+			Marker:      marker,
+			Hosts:       names,
+			Type:        key.Type(),
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Comment:     comment,
+		})
+	}
+	return entries, nil
+}
+
+// RemoveKnownHost removes the entries for a hostname from a known_hosts
+// file (empty for the default) and returns how many there were. Entries
+// match like in MigrateKnownHosts, whatever their port; hashed entries and
+// @cert-authority and @revoked lines are kept.
+func RemoveKnownHost(knownHostsPath, hostname string) (int, error) {
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(knownHostsPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // Nothing to remove
+			return 0, nil // Nothing to remove
 		}
-		return fmt.Errorf("failed to open known_hosts: %w", err)
+		return 0, fmt.Errorf("failed to read known_hosts: %w", err)
 	}
-	defer file.Close()
 
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Skip lines containing the hostname
-		if !strings.Contains(line, hostname) {
-			lines = append(lines, line)
+	wanted := map[string]bool{hostname: true}
+	var kept []string
+	removed := 0
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if knownHostsLineMatches(line, wanted, false) {
+			removed++
+			continue
 		}
+		kept = append(kept, line)
+	}
+	if removed == 0 {
+		return 0, nil
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read known_hosts: %w", err)
+	tmpPath := knownHostsPath + ".klip-tmp"
+	content := ""
+	if len(kept) > 0 {
+		content = strings.Join(kept, "\n") + "\n"
+	}
+	if err := os.WriteFile(tmpPath, []byte(content), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	if err := os.Rename(tmpPath, knownHostsPath); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to replace known_hosts: %w", err)
+	}
+	return removed, nil
+}
+
+// MigrateKnownHosts copies the entries for hosts from one known_hosts file
+// to another, e.g. into a trust domain's file, skipping entries the
+// destination already has. With move they are removed from the source.
+// Entries match if any of their host names, without brackets and port,
+// is one of hosts, marker lines included so revocations move with the
+// keys; hashed entries are left alone. Returns the number of entries
+// migrated.
+func MigrateKnownHosts(from, to string, hosts []string, move bool) (int, error) {
+	data, err := os.ReadFile(from)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read known_hosts: %w", err)
 	}
 
-	// Write back filtered lines
-	if err := os.WriteFile(knownHostsPath, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
-		return fmt.Errorf("failed to write known_hosts: %w", err)
+	wanted := make(map[string]bool)
+	for _, host := range hosts {
+		wanted[host] = true
 	}
 
-	return nil
+	existing := make(map[string]bool)
+	if data, err := os.ReadFile(to); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			existing[strings.TrimSpace(line)] = true
+		}
+	}
+
+	var kept, migrated []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if !knownHostsLineMatches(line, wanted, true) {
+			kept = append(kept, line)
+			continue
+		}
+		if !existing[strings.TrimSpace(line)] {
+			migrated = append(migrated, line)
+			existing[strings.TrimSpace(line)] = true
+		}
+		if !move {
+			kept = append(kept, line)
+		}
+	}
+
+	if len(migrated) > 0 {
+		to, err := knownHostsFile(to)
+		if err != nil {
+			return 0, err
+		}
+		file, err := os.OpenFile(to, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open known_hosts for writing: %w", err)
+		}
+		_, err = file.WriteString(strings.Join(migrated, "\n") + "\n")
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to write to known_hosts: %w", err)
+		}
+	}
+
+	if move {
+		if err := os.WriteFile(from, []byte(strings.Join(kept, "\n")+"\n"), 0600); err != nil {
+			return len(migrated), fmt.Errorf("failed to write known_hosts: %w", err)
+		}
+	}
+	return len(migrated), nil
+}
+
+// knownHostsLineMatches reports whether a known_hosts line is an entry
+// for one of hosts. Marker lines (@cert-authority, @revoked) only match
+// with markers, so a host's revocations are not removed or exported with
+// its keys.
+func knownHostsLineMatches(line string, hosts map[string]bool, markers bool) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	patterns := fields[0]
+	if strings.HasPrefix(patterns, "@") {
+		// Marker lines have the hosts next
+		if !markers || len(fields) < 4 {
+			return false
+		}
+		patterns = fields[1]
+	}
+
+	for _, pattern := range strings.Split(patterns, ",") {
+		host := pattern
+		if strings.HasPrefix(host, "[") {
+			if end := strings.Index(host, "]"); end > 0 {
+				host = host[1:end]
+			}
+		}
+		if hosts[host] {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportKnownHosts returns the entries of a known_hosts file (empty for the
+// default), limited to those for hosts if any are given, without marker
+// lines then. Comments, blank lines and lines that don't parse are left
+// out.
+func ExportKnownHosts(knownHostsPath string, hosts []string) ([]string, error) {
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, host := range hosts {
+		wanted[host] = true
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, _, err := ssh.ParseKnownHosts([]byte(line)); err != nil {
+			continue
+		}
+		if len(hosts) > 0 && !knownHostsLineMatches(line, wanted, false) {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries, nil
+}
+
+// ImportKnownHosts adds the entries of a known_hosts bundle to a
+// known_hosts file (empty for the default) and returns how many were new.
+// Every line must be a valid entry, comment or blank, so a damaged bundle
+// is rejected as a whole. With replace the file ends up holding only the
+// bundle's entries.
+func ImportKnownHosts(knownHostsPath string, bundle []byte, replace bool) (int, error) {
+	var entries []string
+	for i, line := range strings.Split(string(bundle), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, _, err := ssh.ParseKnownHosts([]byte(line)); err != nil {
+			return 0, fmt.Errorf("line %d: invalid known_hosts entry: %w", i+1, err)
+		}
+		entries = append(entries, line)
+	}
+
+	knownHostsPath, err := knownHostsFile(knownHostsPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var lines []string
+	existing := make(map[string]bool)
+	if !replace {
+		if data, err := os.ReadFile(knownHostsPath); err == nil {
+			for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+				if line != "" {
+					lines = append(lines, line)
+				}
+				existing[strings.TrimSpace(line)] = true
+			}
+		} else if !os.IsNotExist(err) {
+			return 0, fmt.Errorf("failed to read known_hosts: %w", err)
+		}
+	}
+
+	added := 0
+	for _, entry := range entries {
+		if existing[entry] {
+			continue
+		}
+		existing[entry] = true
+		lines = append(lines, entry)
+		added++
+	}
+	if added == 0 && !replace {
+		return 0, nil
+	}
+
+	// Write a temporary file and rename it into place, so a failed write
+	// never leaves known_hosts truncated
+	tmpPath := knownHostsPath + ".klip-tmp"
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	if err := os.WriteFile(tmpPath, []byte(content), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	if err := os.Rename(tmpPath, knownHostsPath); err != nil {
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to replace known_hosts: %w", err)
+	}
+	return added, nil
 }
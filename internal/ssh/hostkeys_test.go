@@ -0,0 +1,398 @@
+package ssh
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestCheckPinned(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	policy := HostKeyPolicy{KnownHostsPath: knownHosts, Fingerprint: ssh.FingerprintSHA256(key)}
+
+	// The pinned key is accepted and recorded
+	require.NoError(t, policy.checkPinned("db:22", key))
+	assert.NoError(t, VerifyHostKey(knownHosts, "db:22", key))
+	require.NoError(t, policy.checkPinned("db:22", key))
+	data, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"))
+
+	// Any other key is refused, even if known_hosts trusts it
+	require.NoError(t, AddKnownHost(knownHosts, "web:22", other))
+	err = policy.checkPinned("web:22", other)
+	assert.ErrorContains(t, err, "but the profile pins "+ssh.FingerprintSHA256(key))
+
+	// The pinned key is recorded beside a different key already known,
+	// for system ssh
+	require.NoError(t, policy.checkPinned("web:22", key))
+	assert.NoError(t, VerifyHostKey(knownHosts, "web:22", other))
+	assert.NoError(t, WritePinnedKnownHosts(knownHosts, policy.Fingerprint, filepath.Join(t.TempDir(), "pinned")))
+
+	// The pin may omit the SHA256: prefix and carry base64 padding
+	policy.Fingerprint = strings.TrimPrefix(ssh.FingerprintSHA256(key), "SHA256:") + "="
+	assert.NoError(t, policy.checkPinned("db:22", key))
+
+	// A certificate is checked by the key it certifies
+	cert := &ssh.Certificate{Key: key, CertType: ssh.HostCert, ValidBefore: ssh.CertTimeInfinity}
+	require.NoError(t, cert.SignCert(strings.NewReader(strings.Repeat("x", 1024)), newTestSigner(t)))
+	assert.NoError(t, policy.checkPinned("db:22", cert))
+	cert = &ssh.Certificate{Key: other, CertType: ssh.HostCert, ValidBefore: ssh.CertTimeInfinity}
+	require.NoError(t, cert.SignCert(strings.NewReader(strings.Repeat("x", 1024)), newTestSigner(t)))
+	assert.Error(t, policy.checkPinned("db:22", cert))
+}
+
+func TestWritePinnedKnownHosts(t *testing.T) {
+	dir := t.TempDir()
+	knownHosts, pinned := filepath.Join(dir, "known_hosts"), filepath.Join(dir, "pinned")
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+
+	err := WritePinnedKnownHosts(knownHosts, ssh.FingerprintSHA256(key), pinned)
+	assert.ErrorContains(t, err, "is not in")
+	assert.NoFileExists(t, pinned)
+
+	lines := []string{
+		"@revoked * " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		knownhosts.Line([]string{"db"}, other),
+		knownhosts.Line([]string{"db"}, key),
+		knownhosts.Line([]string{"db.example.com"}, key),
+	}
+	require.NoError(t, os.WriteFile(knownHosts, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+	require.NoError(t, WritePinnedKnownHosts(knownHosts, ssh.FingerprintSHA256(key), pinned))
+
+	// Only the pinned key is trusted, for any host; OpenSSH also matches
+	// * against [host]:port
+	data, err := os.ReadFile(pinned)
+	require.NoError(t, err)
+	assert.Equal(t, knownhosts.Line([]string{"*"}, key)+"\n", string(data))
+	assert.NoError(t, VerifyHostKey(pinned, "10.0.0.5:22", key))
+	assert.Error(t, VerifyHostKey(pinned, "db:22", other))
+}
+
+func TestClientScanHostKey(t *testing.T) {
+	server := newTestServer(t)
+	client, err := NewClient(server.config(t))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	key, err := client.ScanHostKey(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, server.hostKey.PublicKey().Marshal(), key.Marshal())
+
+	// Nothing was trusted by scanning
+	_, err = os.Stat(server.config(t).KnownHostsPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// writeKnownHosts writes a known_hosts file of lines
+func writeKnownHosts(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+	return path
+}
+
+func TestListKnownHosts(t *testing.T) {
+	key, ca := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca)))
+	path := writeKnownHosts(t,
+		"# comment",
+		knownhosts.Line([]string{"db", "10.0.0.5"}, key),
+		knownhosts.Line([]string{"[web]:2222"}, key)+" web server",
+		"@cert-authority *.example.com "+authorized,
+		"@revoked db "+authorized,
+		"not a valid line",
+	)
+
+	entries, err := ListKnownHosts(path, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, KnownHost{Line: 2, Hosts: []string{"db", "10.0.0.5"}, Type: key.Type(), Fingerprint: ssh.FingerprintSHA256(key)}, entries[0])
+	assert.Equal(t, "web server", entries[1].Comment)
+	assert.Equal(t, "cert-authority", entries[2].Marker)
+
+	// Filtering matches names without brackets and port, and lists the
+	// host's marker lines
+	entries, err = ListKnownHosts(path, []string{"db", "web"})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, []int{2, 3, 5}, []int{entries[0].Line, entries[1].Line, entries[2].Line})
+	assert.Equal(t, "revoked", entries[2].Marker)
+
+	entries, err = ListKnownHosts(filepath.Join(t.TempDir(), "missing"), nil)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRemoveKnownHost(t *testing.T) {
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	revoked := "@revoked db " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other)))
+	path := writeKnownHosts(t,
+		knownhosts.Line([]string{"db"}, key),
+		knownhosts.Line([]string{"[db]:2222"}, other),
+		revoked,
+		knownhosts.Line([]string{"web"}, key),
+		knownhosts.HashHostname("db")+" "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+	)
+
+	// Every port's entry goes, but revocations and hashed entries stay
+	removed, err := RemoveKnownHost(path, "db")
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	entries, err := ListKnownHosts(path, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "revoked", entries[0].Marker)
+	assert.Equal(t, []string{"web"}, entries[1].Hosts)
+
+	removed, err = RemoveKnownHost(path, "db")
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+	removed, err = RemoveKnownHost(filepath.Join(t.TempDir(), "missing"), "db")
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+func TestUnknownHostPromptsSerialized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key := newTestSigner(t).PublicKey()
+
+	// Parallel connections to the same unknown host ask one at a time, and
+	// only the first asks at all: the others find the key it accepted
+	var asking, asked atomic.Int32
+	oldRead := readHostKeyAnswer
+	readHostKeyAnswer = func(prompt string) (string, error) {
+		if asking.Add(1) > 1 {
+			t.Error("prompts overlapped")
+		}
+		time.Sleep(20 * time.Millisecond)
+		asked.Add(1)
+		asking.Add(-1)
+		return "yes", nil
+	}
+	t.Cleanup(func() { readHostKeyAnswer = oldRead })
+
+	callback := NewHostKeyCallback(HostKeyPolicy{KnownHostsPath: path})
+	remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, callback("db:22", remote, key))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), asked.Load())
+	require.NoError(t, VerifyHostKey(path, "db:22", key))
+}
+
+func TestExportKnownHostsSkipsMarkers(t *testing.T) {
+	key := newTestSigner(t).PublicKey()
+	ca := "@cert-authority db " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	path := writeKnownHosts(t, knownhosts.Line([]string{"db"}, key), ca)
+
+	entries, err := ExportKnownHosts(path, []string{"db"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{knownhosts.Line([]string{"db"}, key)}, entries)
+	entries, err = ExportKnownHosts(path, nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestExportKnownHosts(t *testing.T) {
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	db := knownhosts.Line([]string{"db", "10.0.0.5"}, key)
+	web := knownhosts.Line([]string{"[web]:2222"}, other)
+	path := writeKnownHosts(t, "# klip known hosts", db, "", "garbage", "  "+web+"  ")
+
+	// Comments, blanks and damaged lines are left out, and entries trimmed
+	entries, err := ExportKnownHosts(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{db, web}, entries)
+
+	// Hosts match any of an entry's names, on any port
+	entries, err = ExportKnownHosts(path, []string{"10.0.0.5", "web"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{db, web}, entries)
+	entries, err = ExportKnownHosts(path, []string{"mail"})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = ExportKnownHosts(filepath.Join(t.TempDir(), "missing"), nil)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestImportKnownHosts(t *testing.T) {
+	key, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	db := knownhosts.Line([]string{"db"}, key)
+	web := knownhosts.Line([]string{"web"}, other)
+	path := writeKnownHosts(t, db)
+
+	// Only new entries are added, after the existing ones
+	added, err := ImportKnownHosts(path, []byte("# bundle\n"+db+"\n\n"+web+"\n"+web+"\n"), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, db+"\n"+web+"\n", string(data))
+
+	added, err = ImportKnownHosts(path, []byte(web), false)
+	require.NoError(t, err)
+	assert.Zero(t, added)
+
+	// A damaged bundle is rejected as a whole
+	_, err = ImportKnownHosts(path, []byte(knownhosts.Line([]string{"mail"}, key)+"\ngarbage\n"), false)
+	assert.ErrorContains(t, err, "line 2: invalid known_hosts entry")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, db+"\n"+web+"\n", string(data))
+
+	// Replacing keeps only the bundle, even an empty one
+	added, err = ImportKnownHosts(path, []byte(web+"\n"), true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, web+"\n", string(data))
+	_, err = ImportKnownHosts(path, nil, true)
+	require.NoError(t, err)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	_, err = os.Stat(path + ".klip-tmp")
+	assert.True(t, os.IsNotExist(err), "no temporary file is left behind")
+
+	// A missing file is created
+	missing := filepath.Join(t.TempDir(), "known_hosts")
+	added, err = ImportKnownHosts(missing, []byte(db), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	require.NoError(t, VerifyHostKey(missing, "db:22", key))
+}
+
+func TestScanHostKeys(t *testing.T) {
+	server := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The server only has an ed25519 key; the other types are skipped
+	keys, err := ScanHostKeys(ctx, server.host, server.port)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, server.hostKey.PublicKey().Marshal(), keys[0].Marshal())
+
+	key, err := ScanHostKey(ctx, server.host, server.port)
+	require.NoError(t, err)
+	assert.Equal(t, server.hostKey.PublicKey().Marshal(), key.Marshal())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	_, err = ScanHostKeys(ctx, "127.0.0.1", port)
+	assert.ErrorContains(t, err, "failed to dial")
+}
+
+// newHostCert returns a host certificate for key signed by ca, valid for
+// principals until validBefore
+func newHostCert(t *testing.T, ca ssh.Signer, key ssh.PublicKey, validBefore uint64, principals ...string) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: principals,
+		ValidBefore:     validBefore,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return cert
+}
+
+func TestParseHostCAKeys(t *testing.T) {
+	ca, other := newTestSigner(t).PublicKey(), newTestSigner(t).PublicKey()
+	inline := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca)))
+
+	keys, err := ParseHostCAKeys([]string{inline})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, ca.Marshal(), keys[0].Marshal())
+
+	// A file may hold several keys, with comments and blank lines
+	file := filepath.Join(t.TempDir(), "ca.pub")
+	content := "# fleet CAs\n" + inline + "\n\n" + string(ssh.MarshalAuthorizedKey(other))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+	keys, err = ParseHostCAKeys([]string{file})
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	_, err = ParseHostCAKeys([]string{filepath.Join(t.TempDir(), "missing.pub")})
+	assert.ErrorContains(t, err, "neither a public key nor a readable file")
+
+	empty := filepath.Join(t.TempDir(), "empty.pub")
+	require.NoError(t, os.WriteFile(empty, []byte("# none\n"), 0600))
+	_, err = ParseHostCAKeys([]string{empty})
+	assert.ErrorContains(t, err, "no host CA keys")
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pub")
+	require.NoError(t, os.WriteFile(invalid, []byte("not a key\n"), 0600))
+	_, err = ParseHostCAKeys([]string{invalid})
+	assert.ErrorContains(t, err, "invalid host CA key")
+}
+
+func TestCheckCertificate(t *testing.T) {
+	ca := newTestSigner(t)
+	key := newTestSigner(t).PublicKey()
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 22}
+	policy := HostKeyPolicy{HostCAs: []ssh.PublicKey{ca.PublicKey()}}
+
+	cert := newHostCert(t, ca, key, ssh.CertTimeInfinity, "db")
+	assert.NoError(t, policy.checkCertificate("db:22", remote, cert))
+	assert.ErrorContains(t, policy.checkCertificate("web:22", remote, cert), "host certificate verification failed")
+
+	// Dialing the address, the profile's host name is accepted as principal
+	assert.Error(t, policy.checkCertificate("10.0.0.5:22", remote, cert))
+	policy.HostName = "db"
+	assert.NoError(t, policy.checkCertificate("10.0.0.5:22", remote, cert))
+
+	// Expired certificates and those of other CAs are refused
+	expired := newHostCert(t, ca, key, uint64(time.Now().Add(-time.Hour).Unix()), "db")
+	assert.Error(t, policy.checkCertificate("db:22", remote, expired))
+	foreign := newHostCert(t, newTestSigner(t), key, ssh.CertTimeInfinity, "db")
+	assert.Error(t, policy.checkCertificate("db:22", remote, foreign))
+}
+
+func TestWriteHostCAKnownHosts(t *testing.T) {
+	ca := newTestSigner(t)
+	path := filepath.Join(t.TempDir(), "ca_known_hosts")
+	require.NoError(t, WriteHostCAKnownHosts([]string{strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))}, path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	marker, hosts, key, _, _, err := ssh.ParseKnownHosts(data)
+	require.NoError(t, err)
+	assert.Equal(t, "cert-authority", marker)
+	assert.Equal(t, []string{"*"}, hosts)
+	assert.Equal(t, ca.PublicKey().Marshal(), key.Marshal())
+
+	// The file accepts the CA's certificates the way ssh reads it
+	callback, err := knownhosts.New(path)
+	require.NoError(t, err)
+	cert := newHostCert(t, ca, newTestSigner(t).PublicKey(), ssh.CertTimeInfinity, "db")
+	assert.NoError(t, callback("db:22", &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 22}, cert))
+
+	assert.Error(t, WriteHostCAKnownHosts([]string{"not a key"}, path))
+}
@@ -1,17 +1,16 @@
 package ssh
 
 import (
-	"context"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
-	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -24,6 +23,9 @@ const (
 
 	// KeyTypeED25519 represents ED25519 keys
 	KeyTypeED25519 KeyType = "ed25519"
+
+	// DefaultKeyType is the type of keys klip generates unless told otherwise
+	DefaultKeyType = KeyTypeED25519
 )
 
 // GenerateKeyPair generates an SSH key pair
@@ -113,67 +115,6 @@ func SaveKeyPair(privateKeyPath, publicKeyPath string, privateKey, publicKey []b
 	return nil
 }
 
-// DeployPublicKey deploys a public key to a remote host using SFTP for security
-func DeployPublicKey(ctx context.Context, cfg *Config, publicKey []byte) error {
-	client, err := NewClient(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to create SSH client: %w", err)
-	}
-
-	if err := client.Connect(ctx); err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
-	}
-	defer client.Close()
-
-	// Create SFTP client for secure file operations
-	sftpClient, err := sftp.NewClient(client.GetClient())
-	if err != nil {
-		return fmt.Errorf("failed to create SFTP client: %w", err)
-	}
-	defer sftpClient.Close()
-
-	// Ensure .ssh directory exists with correct permissions
-	sshDir := ".ssh"
-	if err := sftpClient.MkdirAll(sshDir); err != nil {
-		// Directory might already exist, try to continue
-		if !os.IsExist(err) {
-			return fmt.Errorf("failed to create .ssh directory: %w", err)
-		}
-	}
-
-	// Set .ssh directory permissions (0700)
-	if err := sftpClient.Chmod(sshDir, 0700); err != nil {
-		return fmt.Errorf("failed to set .ssh directory permissions: %w", err)
-	}
-
-	// Open authorized_keys file for append
-	authKeysPath := filepath.Join(sshDir, "authorized_keys")
-	f, err := sftpClient.OpenFile(authKeysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
-	if err != nil {
-		return fmt.Errorf("failed to open authorized_keys: %w", err)
-	}
-	defer f.Close()
-
-	// Write public key atomically
-	if _, err := f.Write(publicKey); err != nil {
-		return fmt.Errorf("failed to write public key: %w", err)
-	}
-
-	// Ensure newline at end if not present
-	if len(publicKey) > 0 && publicKey[len(publicKey)-1] != '\n' {
-		if _, err := f.Write([]byte("\n")); err != nil {
-			return fmt.Errorf("failed to write newline: %w", err)
-		}
-	}
-
-	// Set correct permissions on authorized_keys (0600)
-	if err := sftpClient.Chmod(authKeysPath, 0600); err != nil {
-		return fmt.Errorf("failed to set authorized_keys permissions: %w", err)
-	}
-
-	return nil
-}
-
 // GetDefaultKeyPath returns the default SSH key path for a given key type
 func GetDefaultKeyPath(keyType KeyType) (string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -219,7 +160,8 @@ func ValidateKeyPair(privateKeyPath, publicKeyPath string) error {
 	}
 
 	_, err = ssh.ParsePrivateKey(privateKeyData)
-	if err != nil {
+	var missing *ssh.PassphraseMissingError
+	if err != nil && !errors.As(err, &missing) {
 		return fmt.Errorf("invalid private key: %w", err)
 	}
 
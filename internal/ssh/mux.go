@@ -0,0 +1,378 @@
+// Package ssh - Connection multiplexing
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adrg/xdg"
+	"golang.org/x/crypto/ssh"
+)
+
+// Global requests answered by the mux itself instead of the remote host
+const (
+	muxInfoRequest = "info@mux.klip"
+	muxStopRequest = "stop@mux.klip"
+)
+
+// MuxInfo describes the upstream connection a mux shares
+type MuxInfo struct {
+	Profile       string         `json:"profile"`
+	Backend       string         `json:"backend"`
+	ResolvedHost  string         `json:"resolved_host"`
+	ResolvedJumps []string       `json:"resolved_jumps,omitempty"`
+	Connection    ConnectionInfo `json:"connection"`
+	Started       time.Time      `json:"started"`
+	PID           int            `json:"pid"`
+}
+
+// MuxSocketPath returns the path of the mux socket for a profile, in the
+// XDG runtime directory
+func MuxSocketPath(profile string) string {
+	return filepath.Join(xdg.RuntimeDir, "klip", "mux-"+profile+".sock")
+}
+
+// Mux shares one upstream connection with local clients over a unix
+// socket, like an OpenSSH control master. Each client runs an SSH
+// handshake with the mux itself, without authentication since the socket
+// is only accessible to its owner, and its channels and requests are
+// relayed over the upstream connection.
+type Mux struct {
+	upstream *Client
+	info     MuxInfo
+	config   *ssh.ServerConfig
+	stop     chan struct{}
+	stopOnce sync.Once
+	stats    MuxStats
+}
+
+// MuxStats counts what a mux has relayed, for monitoring
+type MuxStats struct {
+	// Clients counts the clients that connected, ActiveClients those
+	// connected now and FailedClients those whose handshake failed
+	Clients       atomic.Int64
+	ActiveClients atomic.Int64
+	FailedClients atomic.Int64
+
+	// Channels counts the channels relayed upstream, ActiveChannels those
+	// open now and FailedChannels those the upstream connection refused
+	Channels       atomic.Int64
+	ActiveChannels atomic.Int64
+	FailedChannels atomic.Int64
+
+	// BytesSent counts the bytes relayed from clients to the remote host
+	// and BytesReceived those from the remote host to clients
+	BytesSent     atomic.Int64
+	BytesReceived atomic.Int64
+}
+
+// countingWriter adds the bytes written through it to n
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// NewMux creates a mux sharing upstream, which must be connected
+func NewMux(upstream *Client, info MuxInfo) (*Mux, error) {
+	if !upstream.IsConnected() {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate mux host key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate mux host key: %w", err)
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	info.Connection = upstream.ConnectionInfo()
+	return &Mux{
+		upstream: upstream,
+		info:     info,
+		config:   config,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// ListenMux listens on socketPath, replacing a stale socket left by a mux
+// that is no longer running
+func ListenMux(socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a mux is already listening on %s", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// Serve accepts clients on listener until ctx is cancelled or a client
+// stops the mux, returning nil, or the upstream connection closes. The
+// listener is closed on return.
+func (m *Mux) Serve(ctx context.Context, listener net.Listener) error {
+	upstreamDone := make(chan struct{})
+	go func() {
+		m.upstream.client.Wait()
+		close(upstreamDone)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-m.stop:
+		case <-upstreamDone:
+		}
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-upstreamDone:
+				return fmt.Errorf("upstream connection closed")
+			case <-ctx.Done():
+				return nil
+			case <-m.stop:
+				return nil
+			default:
+				listener.Close()
+				return fmt.Errorf("failed to accept mux client: %w", err)
+			}
+		}
+		go m.serveConn(conn)
+	}
+}
+
+// Info describes the upstream connection the mux shares
+func (m *Mux) Info() MuxInfo {
+	return m.info
+}
+
+// Stats returns the mux's counters, updated while it serves
+func (m *Mux) Stats() *MuxStats {
+	return &m.stats
+}
+
+// Stop makes Serve return
+func (m *Mux) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// serveConn relays one client's channels and requests until it disconnects
+func (m *Mux) serveConn(conn net.Conn) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, m.config)
+	if err != nil {
+		m.stats.FailedClients.Add(1)
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+
+	m.stats.Clients.Add(1)
+	m.stats.ActiveClients.Add(1)
+	defer m.stats.ActiveClients.Add(-1)
+
+	go m.handleRequests(reqs)
+	for newChannel := range chans {
+		go m.relayChannel(newChannel)
+	}
+}
+
+// handleRequests answers mux requests and relays other global requests,
+// such as keepalives, upstream
+func (m *Mux) handleRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case muxInfoRequest:
+			payload, err := json.Marshal(m.info)
+			req.Reply(err == nil, payload)
+		case muxStopRequest:
+			req.Reply(true, nil)
+			m.Stop()
+		case "tcpip-forward", "cancel-tcpip-forward":
+			// Connections to a remote forward could not be routed back to
+			// the client that asked for it
+			req.Reply(false, nil)
+		default:
+			ok, payload, err := m.upstream.client.SendRequest(req.Type, req.WantReply, req.Payload)
+			req.Reply(ok && err == nil, payload)
+		}
+	}
+}
+
+// relayChannel opens the same channel upstream and copies data and
+// requests both ways until either side closes it
+func (m *Mux) relayChannel(newChannel ssh.NewChannel) {
+	up, upReqs, err := m.upstream.client.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		m.stats.FailedChannels.Add(1)
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+
+	down, downReqs, err := newChannel.Accept()
+	if err != nil {
+		up.Close()
+		return
+	}
+	m.stats.Channels.Add(1)
+	m.stats.ActiveChannels.Add(1)
+	defer m.stats.ActiveChannels.Add(-1)
+
+	// Client to upstream; the client closing the channel closes it upstream.
+	// inFlight is held while a request is relayed, so that a reply sent just
+	// before the upstream channel closes still reaches the client.
+	var inFlight sync.Mutex
+	go func() {
+		io.Copy(countingWriter{up, &m.stats.BytesSent}, down)
+		up.CloseWrite()
+	}()
+	go func() {
+		relayRequests(up, downReqs, &inFlight)
+		up.Close()
+	}()
+
+	// Upstream to client, until the upstream channel is closed
+	var output sync.WaitGroup
+	output.Add(2)
+	go func() {
+		defer output.Done()
+		io.Copy(countingWriter{down, &m.stats.BytesReceived}, up)
+	}()
+	go func() {
+		defer output.Done()
+		io.Copy(countingWriter{down.Stderr(), &m.stats.BytesReceived}, up.Stderr())
+	}()
+	relayRequests(down, upReqs, nil)
+	output.Wait()
+	down.CloseWrite()
+
+	inFlight.Lock()
+	down.Close()
+	inFlight.Unlock()
+}
+
+// relayRequests forwards channel requests, such as pty-req, exec and
+// exit-status, to dst, holding inFlight (if set) until each is answered
+func relayRequests(dst ssh.Channel, reqs <-chan *ssh.Request, inFlight *sync.Mutex) {
+	for req := range reqs {
+		if inFlight != nil {
+			inFlight.Lock()
+		}
+		ok, err := dst.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			req.Reply(ok && err == nil, nil)
+		}
+		if inFlight != nil {
+			inFlight.Unlock()
+		}
+	}
+}
+
+// DialMux connects to the mux listening on socketPath. The returned client
+// behaves like a direct connection to the remote host; closing it leaves
+// the mux and its upstream connection running.
+func DialMux(ctx context.Context, socketPath string) (*Client, *MuxInfo, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to mux: %w", err)
+	}
+
+	// Abort the handshake if the context is cancelled before it completes
+	handshakeDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-handshakeDone:
+		}
+	}()
+
+	config := &ssh.ClientConfig{
+		User: "klip",
+		// The socket is only accessible to its owner, who started the mux
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, socketPath, config)
+	close(handshakeDone)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to connect to mux: %w", err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	ok, payload, err := client.SendRequest(muxInfoRequest, true, nil)
+	if err == nil && !ok {
+		err = fmt.Errorf("request refused")
+	}
+	var info MuxInfo
+	if err == nil {
+		err = json.Unmarshal(payload, &info)
+	}
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to query mux: %w", err)
+	}
+
+	return &Client{client: client, host: info.ResolvedHost, info: info.Connection}, &info, nil
+}
+
+// StopMux asks the mux listening on socketPath to exit
+func StopMux(ctx context.Context, socketPath string) error {
+	client, _, err := DialMux(ctx, socketPath)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, _, err := client.client.SendRequest(muxStopRequest, true, nil); err != nil {
+		return fmt.Errorf("failed to stop mux: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveEcho is a channel handler running sessions whose exec request
+// echoes the session's input back
+func serveEcho(newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "session" {
+		newChannel.Reject(ssh.Prohibited, "sessions only")
+		return
+	}
+	ch, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		io.Copy(ch, ch)
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, 0)
+		ch.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+// startMux shares a connection to server through a mux listening on a
+// socket in a temporary directory, stopped when the test ends, and returns
+// the mux and its socket
+func startMux(t *testing.T, server *testServer) (*Mux, string) {
+	mux, err := NewMux(server.connect(t), MuxInfo{Profile: "web", Backend: "lan", ResolvedHost: server.host})
+	require.NoError(t, err)
+
+	socketPath := filepath.Join(t.TempDir(), "mux.sock")
+	listener, err := ListenMux(socketPath)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- mux.Serve(ctx, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+	return mux, socketPath
+}
+
+func TestMuxStats(t *testing.T) {
+	server := newTestServer(t)
+	server.handle = serveEcho
+	mux, socketPath := startMux(t, server)
+	stats := mux.Stats()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, info, err := DialMux(ctx, socketPath)
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, "web", info.Profile)
+	assert.Eventually(t, func() bool { return stats.ActiveClients.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	session, err := client.GetClient().NewSession()
+	require.NoError(t, err)
+	session.Stdin = strings.NewReader("hello mux")
+	out, err := session.Output("cat")
+	require.NoError(t, err)
+	assert.Equal(t, "hello mux", string(out))
+
+	// Channels the remote host refuses are counted as failures
+	_, err = client.GetClient().Dial("tcp", "127.0.0.1:1")
+	assert.Error(t, err)
+
+	// A client that is not speaking SSH fails the handshake
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	conn.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	conn.Close()
+
+	assert.Eventually(t, func() bool {
+		return stats.FailedClients.Load() == 1 && stats.ActiveChannels.Load() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), stats.Clients.Load())
+	assert.Equal(t, int64(1), stats.Channels.Load())
+	assert.Equal(t, int64(1), stats.FailedChannels.Load())
+	assert.Equal(t, int64(len("hello mux")), stats.BytesSent.Load())
+	assert.Equal(t, int64(len("hello mux")), stats.BytesReceived.Load())
+
+	client.Close()
+	assert.Eventually(t, func() bool { return stats.ActiveClients.Load() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDialMux(t *testing.T) {
+	server := newTestServer(t)
+	server.handle = serveEcho
+	mux, socketPath := startMux(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, info, err := DialMux(ctx, socketPath)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The info describes the upstream connection, which the client reports
+	// as its own
+	assert.Equal(t, mux.Info(), *info)
+	assert.Equal(t, "lan", info.Backend)
+	assert.Equal(t, server.host, info.ResolvedHost)
+	assert.NotEmpty(t, info.Connection.HostKeyFingerprint)
+	assert.Equal(t, info.Connection, client.ConnectionInfo())
+
+	// Remote forwards are refused, as their connections could not be
+	// routed back to this client
+	_, err = client.GetClient().Listen("tcp", "127.0.0.1:0")
+	assert.Error(t, err)
+
+	// Closing the client leaves the mux serving others
+	client.Close()
+	other, _, err := DialMux(ctx, socketPath)
+	require.NoError(t, err)
+	other.Close()
+
+	_, _, err = DialMux(ctx, filepath.Join(t.TempDir(), "missing.sock"))
+	assert.ErrorContains(t, err, "failed to connect to mux")
+}
+
+func TestStopMux(t *testing.T) {
+	server := newTestServer(t)
+	mux, err := NewMux(server.connect(t), MuxInfo{Profile: "web"})
+	require.NoError(t, err)
+	socketPath := filepath.Join(t.TempDir(), "mux.sock")
+	listener, err := ListenMux(socketPath)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- mux.Serve(context.Background(), listener) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, StopMux(ctx, socketPath))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("mux still serving after StopMux")
+	}
+
+	// The socket no longer accepts clients
+	_, _, err = DialMux(ctx, socketPath)
+	assert.Error(t, err)
+}
+
+func TestListenMux(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "run", "mux.sock")
+
+	// The directory is created and the socket is private
+	listener, err := ListenMux(socketPath)
+	require.NoError(t, err)
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	dirInfo, err := os.Stat(filepath.Dir(socketPath))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), dirInfo.Mode().Perm())
+
+	// A running mux is not replaced
+	_, err = ListenMux(socketPath)
+	assert.ErrorContains(t, err, "already listening")
+
+	// The socket of a mux that is gone is
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	_, err = os.Stat(socketPath)
+	require.NoError(t, err, "stale socket left behind")
+	listener, err = ListenMux(socketPath)
+	require.NoError(t, err)
+	listener.Close()
+}
@@ -0,0 +1,76 @@
+// Package ssh - Passphrase-protected private keys
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/orpheus497/klip/internal/ui"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// maxPassphraseAttempts is how often a wrong passphrase may be re-entered
+const maxPassphraseAttempts = 3
+
+// unlockedKeys caches decrypted keys by path for the process lifetime, so
+// a passphrase is asked for at most once even across several connections
+var (
+	unlockedKeys   = make(map[string]ssh.Signer)
+	unlockedKeysMu sync.Mutex
+)
+
+// unlockKey decrypts a passphrase-protected private key, taking the
+// passphrase from the environment variable passphraseEnv if set, or
+// prompting on the terminal otherwise unless nonInteractive
+func unlockKey(keyPath string, pemBytes []byte, passphraseEnv string, nonInteractive bool) (ssh.Signer, error) {
+	unlockedKeysMu.Lock()
+	defer unlockedKeysMu.Unlock()
+
+	if signer, ok := unlockedKeys[keyPath]; ok {
+		return signer, nil
+	}
+
+	if passphraseEnv != "" {
+		passphrase, ok := os.LookupEnv(passphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", passphraseEnv)
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s with passphrase from %s: %w", keyPath, passphraseEnv, err)
+		}
+		unlockedKeys[keyPath] = signer
+		return signer, nil
+	}
+
+	if nonInteractive || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("key %s is passphrase-protected and there is no terminal to ask (use --passphrase-env)", keyPath)
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := ui.ReadSecret(fmt.Sprintf("Enter passphrase for key %s: ", keyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+		if err == nil {
+			unlockedKeys[keyPath] = signer
+			return signer, nil
+		}
+		if !isWrongPassphrase(err) || attempt == maxPassphraseAttempts {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", keyPath, err)
+		}
+		fmt.Fprintln(os.Stderr, "Incorrect passphrase, try again.")
+	}
+}
+
+// isWrongPassphrase reports whether err means the passphrase was incorrect
+func isWrongPassphrase(err error) bool {
+	return errors.Is(err, x509.IncorrectPasswordError)
+}
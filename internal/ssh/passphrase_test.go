@@ -0,0 +1,55 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnlockKey(t *testing.T) {
+	dir := t.TempDir()
+	pub := writeTestKey(t, dir, "id_ed25519", "s3cret", false)
+	keyPath := filepath.Join(dir, "id_ed25519")
+	pemBytes, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+
+	t.Run("unset variable", func(t *testing.T) {
+		_, err := unlockKey(keyPath, pemBytes, "KLIP_TEST_UNSET", false)
+		assert.ErrorContains(t, err, "KLIP_TEST_UNSET is not set")
+		assert.False(t, isUnlocked(keyPath))
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		t.Setenv("KLIP_TEST_PASSPHRASE", "wrong")
+		_, err := unlockKey(keyPath, pemBytes, "KLIP_TEST_PASSPHRASE", false)
+		assert.ErrorContains(t, err, "with passphrase from KLIP_TEST_PASSPHRASE")
+		assert.False(t, isUnlocked(keyPath))
+	})
+
+	t.Run("no terminal to ask", func(t *testing.T) {
+		_, err := unlockKey(keyPath, pemBytes, "", true)
+		assert.ErrorContains(t, err, "use --passphrase-env")
+	})
+
+	t.Run("passphrase from the environment", func(t *testing.T) {
+		t.Setenv("KLIP_TEST_PASSPHRASE", "s3cret")
+		signer, err := unlockKey(keyPath, pemBytes, "KLIP_TEST_PASSPHRASE", false)
+		require.NoError(t, err)
+		assert.Equal(t, pub.Marshal(), signer.PublicKey().Marshal())
+		assert.True(t, isUnlocked(keyPath))
+	})
+
+	// Once unlocked, the key is not asked for again, even without a way to
+	// ask: the cached signer is returned
+	t.Run("cached", func(t *testing.T) {
+		signer, err := unlockKey(keyPath, pemBytes, "", true)
+		require.NoError(t, err)
+		assert.Equal(t, pub.Marshal(), signer.PublicKey().Marshal())
+		signer, err = unlockKey(keyPath, pemBytes, "KLIP_TEST_UNSET", false)
+		require.NoError(t, err)
+		assert.Equal(t, pub.Marshal(), signer.PublicKey().Marshal())
+	})
+}
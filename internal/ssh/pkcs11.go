@@ -0,0 +1,208 @@
+// Package ssh - Hardware token keys
+// Copyright (c) 2025 orpheus497
+package ssh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// PKCS11Agent as a PKCS#11 provider uses the keys the ssh-agent already
+// holds, e.g. from yubikey-agent or gpg-agent, without loading a module
+const PKCS11Agent = "agent"
+
+// ssh-agent protocol messages for loading a PKCS#11 provider, which
+// golang.org/x/crypto/ssh/agent does not implement
+const (
+	agentAddSmartcardKey = 20
+	agentFailure         = 5
+	agentSuccess         = 6
+
+	// maxAgentReply bounds the reply read from the agent
+	maxAgentReply = 256 * 1024
+)
+
+// agentConn is the process's ssh-agent connection; it stays open because
+// the agent signs during every handshake. loadedProviders records the
+// PKCS#11 modules loaded into it, so the PIN is asked for at most once.
+var (
+	agentConn       agent.ExtendedAgent
+	loadedProviders = make(map[string]bool)
+	agentMu         sync.Mutex
+)
+
+// agentSocket returns the ssh-agent socket from SSH_AUTH_SOCK
+func agentSocket() (string, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return "", fmt.Errorf("SSH_AUTH_SOCK is not set; hardware keys are used through a running ssh-agent")
+	}
+	return socket, nil
+}
+
+// hardwareKeyAuth creates SSH auth from the keys on a smartcard or security
+// key, signed by the ssh-agent. Unless provider is PKCS11Agent the agent is
+// asked to load the PKCS#11 module first, with the PIN from pinPrompt; that
+// happens when the method is tried, so the PIN is only asked for if needed.
+// skip is called with the reason the token could not be used.
+func hardwareKeyAuth(provider string, pinPrompt func(prompt string) (string, error), record func(method string), skip func(err error)) ssh.AuthMethod {
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		signers, err := hardwareKeySigners(provider, pinPrompt, skip)
+		if err != nil {
+			// Skip the token rather than aborting the handshake, so
+			// remaining methods are still tried
+			skip(fmt.Errorf("hardware key: %w", err))
+			return nil, nil
+		}
+		for i, signer := range signers {
+			signers[i] = recordSigner(signer, "pkcs11:"+provider, record)
+		}
+		return signers, nil
+	})
+}
+
+// hardwareKeySigners returns the ssh-agent's keys, after loading provider
+// into it if needed. If loading fails but the agent holds keys, they are
+// returned and skip is called with the reason.
+func hardwareKeySigners(provider string, pinPrompt func(prompt string) (string, error), skip func(err error)) ([]ssh.Signer, error) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+
+	socket, err := agentSocket()
+	if err != nil {
+		return nil, err
+	}
+	if agentConn == nil {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		agentConn = agent.NewClient(conn)
+	}
+
+	if provider != PKCS11Agent && !loadedProviders[provider] {
+		keys, err := agentConn.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+		}
+		if !providerLoaded(keys, provider) {
+			if err := loadProvider(socket, provider, pinPrompt); err != nil {
+				// The agent refuses a provider it has already loaded,
+				// which it may list under the keys' labels instead
+				if len(keys) == 0 {
+					return nil, err
+				}
+				skip(fmt.Errorf("%w; tried the keys ssh-agent already holds", err))
+			}
+		}
+		loadedProviders[provider] = true
+	}
+
+	signers, err := agentConn.Signers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ssh-agent keys: %w", err)
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("ssh-agent holds no keys (is the token plugged in?)")
+	}
+	return signers, nil
+}
+
+// providerLoaded reports whether the agent lists keys from provider, which
+// ssh-agent comments with the module path when the key has no label
+func providerLoaded(keys []*agent.Key, provider string) bool {
+	resolved, err := filepath.EvalSymlinks(provider)
+	if err != nil {
+		resolved = provider
+	}
+	for _, key := range keys {
+		if key.Comment == provider || key.Comment == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// loadProvider asks the ssh-agent at socket to load the keys of a PKCS#11
+// module, unlocking the token with the PIN from pinPrompt
+func loadProvider(socket, provider string, pinPrompt func(prompt string) (string, error)) error {
+	if pinPrompt == nil {
+		return fmt.Errorf("PKCS#11 provider %s needs a PIN and there is no terminal to ask", provider)
+	}
+	pin, err := pinPrompt(fmt.Sprintf("Enter PIN for %s", filepath.Base(provider)))
+	if err != nil {
+		return fmt.Errorf("failed to read PIN: %w", err)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	defer conn.Close()
+
+	ok, err := addSmartcardKey(conn, provider, pin)
+	if err != nil {
+		return fmt.Errorf("failed to load %s into ssh-agent: %w", provider, err)
+	}
+	if !ok {
+		return fmt.Errorf("ssh-agent could not load %s (wrong PIN, or token not present)", provider)
+	}
+	return nil
+}
+
+// addSmartcardKey sends an SSH_AGENTC_ADD_SMARTCARD_KEY request over conn
+// and reports whether the agent accepted it
+func addSmartcardKey(conn io.ReadWriter, provider, pin string) (bool, error) {
+	msg := []byte{agentAddSmartcardKey}
+	msg = appendAgentString(msg, provider)
+	msg = appendAgentString(msg, pin)
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	if _, err := conn.Write(append(frame, msg...)); err != nil {
+		return false, err
+	}
+
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return false, err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size == 0 || size > maxAgentReply {
+		return false, fmt.Errorf("invalid reply length %d from agent", size)
+	}
+	reply := make([]byte, size)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return false, err
+	}
+
+	switch reply[0] {
+	case agentSuccess:
+		return true, nil
+	case agentFailure:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected reply %d from agent", reply[0])
+	}
+}
+
+// appendAgentString appends s in the agent protocol's string encoding
+func appendAgentString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// hardwareKeyDetail describes a hardware key for AuthMethodInfo
+func hardwareKeyDetail(provider string) string {
+	if provider == PKCS11Agent {
+		return "hardware keys in ssh-agent"
+	}
+	return "PKCS#11 " + provider + " via ssh-agent"
+}
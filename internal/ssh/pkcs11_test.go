@@ -0,0 +1,160 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// readAgentString reads a string in the agent protocol's encoding from b
+func readAgentString(t *testing.T, b []byte) (string, []byte) {
+	require.GreaterOrEqual(t, len(b), 4)
+	n := binary.BigEndian.Uint32(b)
+	require.GreaterOrEqual(t, uint32(len(b)-4), n)
+	return string(b[4 : 4+n]), b[4+n:]
+}
+
+func TestAddSmartcardKey(t *testing.T) {
+	// agentReplying returns a connection to an agent that checks the
+	// request and answers with reply, framed with length
+	agentReplying := func(t *testing.T, length uint32, reply []byte) net.Conn {
+		client, server := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+		go func() {
+			defer server.Close()
+			var size [4]byte
+			if _, err := io.ReadFull(server, size[:]); err != nil {
+				return
+			}
+			msg := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(server, msg); err != nil {
+				return
+			}
+			assert.Equal(t, byte(agentAddSmartcardKey), msg[0])
+			provider, rest := readAgentString(t, msg[1:])
+			pin, rest := readAgentString(t, rest)
+			assert.Equal(t, "/usr/lib/opensc-pkcs11.so", provider)
+			assert.Equal(t, "123456", pin)
+			assert.Empty(t, rest)
+
+			server.Write(append(binary.BigEndian.AppendUint32(nil, length), reply...))
+		}()
+		return client
+	}
+
+	tests := []struct {
+		name    string
+		length  uint32
+		reply   []byte
+		want    bool
+		wantErr string
+	}{
+		{name: "success", length: 1, reply: []byte{agentSuccess}, want: true},
+		{name: "failure", length: 1, reply: []byte{agentFailure}},
+		{name: "unexpected reply", length: 1, reply: []byte{99}, wantErr: "unexpected reply 99"},
+		{name: "empty reply", length: 0, wantErr: "invalid reply length 0"},
+		{name: "oversized reply", length: maxAgentReply + 1, wantErr: "invalid reply length"},
+		{name: "truncated reply", length: 4, reply: []byte{agentSuccess}, wantErr: "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := addSmartcardKey(agentReplying(t, tt.length, tt.reply), "/usr/lib/opensc-pkcs11.so", "123456")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+}
+
+// startAgent serves keyring as the ssh-agent at SSH_AUTH_SOCK for the
+// test, with the process's agent connection reset
+func startAgent(t *testing.T, keyring agent.Agent) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	agentMu.Lock()
+	agentConn, loadedProviders = nil, make(map[string]bool)
+	agentMu.Unlock()
+	t.Cleanup(func() { agentConn = nil })
+}
+
+func TestHardwareKeySigners(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pin := func(string) (string, error) { return "123456", nil }
+
+	t.Run("keys in the agent", func(t *testing.T) {
+		keyring := agent.NewKeyring()
+		require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: private, Comment: "yubikey"}))
+		startAgent(t, keyring)
+
+		var skipped []error
+		signers, err := hardwareKeySigners(PKCS11Agent, nil, func(err error) { skipped = append(skipped, err) })
+		require.NoError(t, err)
+		assert.Len(t, signers, 1)
+		assert.Empty(t, skipped)
+	})
+
+	t.Run("empty agent", func(t *testing.T) {
+		startAgent(t, agent.NewKeyring())
+		_, err := hardwareKeySigners(PKCS11Agent, nil, func(error) {})
+		assert.ErrorContains(t, err, "holds no keys")
+	})
+
+	// The agent refuses the module, which is reported while the keys it
+	// already holds are still used
+	t.Run("provider refused", func(t *testing.T) {
+		keyring := agent.NewKeyring()
+		require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: private, Comment: "PIV AUTH key"}))
+		startAgent(t, keyring)
+
+		var skipped []error
+		signers, err := hardwareKeySigners("/usr/lib/opensc-pkcs11.so", pin, func(err error) { skipped = append(skipped, err) })
+		require.NoError(t, err)
+		assert.Len(t, signers, 1)
+		require.Len(t, skipped, 1)
+		assert.ErrorContains(t, skipped[0], "could not load /usr/lib/opensc-pkcs11.so")
+		assert.ErrorContains(t, skipped[0], "tried the keys ssh-agent already holds")
+	})
+
+	t.Run("provider refused by an empty agent", func(t *testing.T) {
+		startAgent(t, agent.NewKeyring())
+		_, err := hardwareKeySigners("/usr/lib/opensc-pkcs11.so", pin, func(error) {})
+		assert.ErrorContains(t, err, "could not load /usr/lib/opensc-pkcs11.so")
+
+		_, err = hardwareKeySigners("/usr/lib/other-pkcs11.so", nil, func(error) {})
+		assert.ErrorContains(t, err, "no terminal to ask")
+	})
+
+	t.Run("no agent", func(t *testing.T) {
+		t.Setenv("SSH_AUTH_SOCK", "")
+		_, err := hardwareKeySigners(PKCS11Agent, nil, func(error) {})
+		assert.ErrorContains(t, err, "SSH_AUTH_SOCK is not set")
+	})
+}
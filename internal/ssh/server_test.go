@@ -0,0 +1,208 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testPassword is the password testServer accepts
+const testPassword = "secret"
+
+// testServer is an SSH server on the loopback interface
+type testServer struct {
+	host    string
+	port    int
+	hostKey ssh.Signer
+
+	// handle serves the channels clients open; they are rejected if nil
+	handle func(ssh.NewChannel)
+
+	// authorized are the public keys accepted besides testPassword
+	authorized []ssh.PublicKey
+
+	// offered are the fingerprints of the keys clients offered, in order
+	mu      sync.Mutex
+	offered []string
+
+	// keepalives counts the global requests received; with unresponsive
+	// set they are left unanswered, like a host that went away
+	keepalives   atomic.Int32
+	unresponsive atomic.Bool
+
+	// forwards makes the server listen for clients on request (ssh -R);
+	// such requests are refused otherwise
+	forwards bool
+}
+
+// newTestSigner returns a new ed25519 key
+func newTestSigner(t testing.TB) ssh.Signer {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(private)
+	require.NoError(t, err)
+	return signer
+}
+
+// newTestServer starts an SSH server accepting testPassword, stopped when
+// the test ends
+func newTestServer(t testing.TB) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	s := &testServer{host: "127.0.0.1", port: listener.Addr().(*net.TCPAddr).Port, hostKey: newTestSigner(t)}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != testPassword {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.offered = append(s.offered, ssh.FingerprintSHA256(key))
+			for _, authorized := range s.authorized {
+				if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(s.hostKey)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+// serve runs one client connection
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go func() {
+		forwards := newRemoteForwards(serverConn)
+		defer forwards.closeAll()
+		for req := range reqs {
+			if s.forwards && forwards.handle(req) {
+				continue
+			}
+			s.keepalives.Add(1)
+			if req.WantReply && !s.unresponsive.Load() {
+				req.Reply(false, nil)
+			}
+		}
+	}()
+	for ch := range chans {
+		if s.handle == nil {
+			ch.Reject(ssh.Prohibited, "no channels")
+			continue
+		}
+		go s.handle(ch)
+	}
+}
+
+// address returns the host:port the server listens on
+func (s *testServer) address() string {
+	return net.JoinHostPort(s.host, strconv.Itoa(s.port))
+}
+
+// config returns a client configuration for the server
+func (s *testServer) config(t testing.TB) *Config {
+	return &Config{
+		Host:           s.host,
+		Port:           s.port,
+		User:           "klip",
+		UsePassword:    true,
+		Password:       testPassword,
+		KnownHostsPath: t.TempDir() + "/known_hosts",
+		NonInteractive: true,
+	}
+}
+
+// connect returns a client connected to the server, which trusts its host
+// key, closed when the test ends
+func (s *testServer) connect(t testing.TB) *Client {
+	client, err := s.connectWith(t, s.config(t))
+	require.NoError(t, err)
+	return client
+}
+
+// connectWith connects a client configured by cfg to the server, trusting
+// its host key in cfg.KnownHostsPath; it is closed when the test ends
+func (s *testServer) connectWith(t testing.TB, cfg *Config) (*Client, error) {
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.address())}, s.hostKey.PublicKey())
+	require.NoError(t, os.WriteFile(cfg.KnownHostsPath, []byte(line+"\n"), 0600))
+
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, nil
+}
+
+// offeredKeys returns the fingerprints of the keys clients offered
+func (s *testServer) offeredKeys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.offered...)
+}
+
+// serveSFTP returns a channel handler serving the sftp subsystem from the
+// local directory home
+func serveSFTP(t testing.TB, home string) func(ssh.NewChannel) {
+	return func(newChannel ssh.NewChannel) {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "session only")
+			return
+		}
+		ch, reqs, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		defer ch.Close()
+		for req := range reqs {
+			ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+			req.Reply(ok, nil)
+			if !ok {
+				continue
+			}
+			server, err := sftp.NewServer(ch, sftp.WithServerWorkingDirectory(home))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			server.Serve()
+			return
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package tracing - OTLP exporter
+// Copyright (c) 2025 orpheus497
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/version"
+)
+
+// exportTimeout bounds sending a trace, which the command waits for
+const exportTimeout = 5 * time.Second
+
+// tracesPath is where OTLP/HTTP collectors receive traces
+const tracesPath = "/v1/traces"
+
+// OTLP span status codes and kinds
+const (
+	statusError  = 2
+	kindInternal = 1
+)
+
+// OTLPExporter sends traces to an OpenTelemetry collector over OTLP/HTTP
+// with JSON encoding
+type OTLPExporter struct {
+	// URL receives the traces, e.g. http://localhost:4318/v1/traces
+	URL string
+
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string
+
+	// ServiceName is the service.name resource attribute
+	ServiceName string
+
+	client *http.Client
+}
+
+// NewOTLPExporter returns an exporter posting to url
+func NewOTLPExporter(rawURL string, headers map[string]string, serviceName string) (*OTLPExporter, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s': must be an http:// or https:// URL", rawURL)
+	}
+	return &OTLPExporter{
+		URL:         rawURL,
+		Headers:     headers,
+		ServiceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+	}, nil
+}
+
+// Configure sets Exporter from the standard OpenTelemetry environment
+// variables, which take precedence, or the collector endpoint and headers
+// of settings.tracing. Tracing stays off without an endpoint.
+func Configure(endpoint string, headers map[string]string) error {
+	Exporter = nil
+
+	tracesURL := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if tracesURL == "" {
+		if env := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); env != "" {
+			endpoint = env
+		}
+		if endpoint != "" {
+			tracesURL = strings.TrimSuffix(endpoint, "/") + tracesPath
+		}
+	}
+	if tracesURL == "" {
+		return nil
+	}
+
+	merged := map[string]string{}
+	for name, value := range headers {
+		merged[name] = value
+	}
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		envHeaders, err := parseHeaders(os.Getenv(env))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", env, err)
+		}
+		for name, value := range envHeaders {
+			merged[name] = value
+		}
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = filepath.Base(os.Args[0])
+	}
+
+	exporter, err := NewOTLPExporter(tracesURL, merged, serviceName)
+	if err != nil {
+		return err
+	}
+	Exporter = exporter
+	return nil
+}
+
+// parseHeaders parses the W3C baggage-like list of the OTEL_*_HEADERS
+// variables: name=value pairs separated by commas, values URL-encoded
+func parseHeaders(list string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("'%s' is not name=value", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		headers[strings.TrimSpace(name)] = decoded
+	}
+	return headers, nil
+}
+
+// Export sends spans to the collector
+func (e *OTLPExporter) Export(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode trace: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to export trace: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export trace: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to export trace: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// OTLP/JSON messages (opentelemetry/proto/collector/trace/v1)
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	otlpSpan struct {
+		TraceID      string     `json:"traceId"`
+		SpanID       string     `json:"spanId"`
+		ParentSpanID string     `json:"parentSpanId,omitempty"`
+		Name         string     `json:"name"`
+		Kind         int        `json:"kind"`
+		Start        string     `json:"startTimeUnixNano"`
+		End          string     `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr `json:"attributes,omitempty"`
+		Status       otlpStatus `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	}
+)
+
+// request builds the export request of spans
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	traceID := TraceID()
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID: traceID,
+			SpanID:  hex.EncodeToString(s.ID[:]),
+			Name:    s.Name,
+			Kind:    kindInternal,
+			Start:   strconv.FormatInt(s.Start.UnixNano(), 10),
+			End:     strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.ParentID != ([8]byte{}) {
+			span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		for _, attr := range s.Attrs {
+			span.Attributes = append(span.Attributes, otlpAttribute(attr))
+		}
+		if s.Err != nil {
+			span.Status = otlpStatus{Code: statusError, Message: s.Err.Error()}
+		}
+		converted = append(converted, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttr{
+			otlpAttribute(String("service.name", e.ServiceName)),
+			otlpAttribute(String("service.version", version.Version)),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/orpheus497/klip", Version: version.Version},
+			Spans: converted,
+		}},
+	}}}
+}
+
+// otlpAttribute converts an attribute; values other than strings, integers
+// and booleans are sent as strings
+func otlpAttribute(attr Attr) otlpAttr {
+	var value otlpValue
+	switch v := attr.Value.(type) {
+	case string:
+		value.StringValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		value.IntValue = &s
+	case bool:
+		value.BoolValue = &v
+	default:
+		s := fmt.Sprint(v)
+		value.StringValue = &s
+	}
+	return otlpAttr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector is an OTLP/HTTP collector receiving requests
+func collector(t *testing.T, status int) (*httptest.Server, chan *http.Request, chan []byte) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests, bodies
+}
+
+// clearOTELEnv unsets the OpenTelemetry environment for a test
+func clearOTELEnv(t *testing.T) {
+	for _, env := range []string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+		"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_SERVICE_NAME",
+	} {
+		t.Setenv(env, "")
+	}
+	t.Cleanup(func() { Exporter = nil })
+}
+
+func TestExport(t *testing.T) {
+	clearOTELEnv(t)
+	server, requests, bodies := collector(t, http.StatusOK)
+	t.Setenv("OTEL_SERVICE_NAME", "klipc")
+	require.NoError(t, Configure(server.URL+"/", map[string]string{"Authorization": "Bearer secret"}))
+
+	ctx, root := Start(context.Background(), "connect", String("klip.profile", "web"), Int("server.port", 22))
+	_, auth := Start(ctx, "ssh.auth", Bool("klip.cached", true))
+	auth.Finish(errors.New("permission denied"))
+	root.Finish(nil)
+
+	r := <-requests
+	assert.Equal(t, "/v1/traces", r.URL.Path)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+	var request otlpRequest
+	require.NoError(t, json.Unmarshal(<-bodies, &request))
+	require.Len(t, request.ResourceSpans, 1)
+	resource := request.ResourceSpans[0]
+	assert.Equal(t, "service.name", resource.Resource.Attributes[0].Key)
+	assert.Equal(t, "klipc", *resource.Resource.Attributes[0].Value.StringValue)
+
+	spans := resource.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "connect", spans[0].Name)
+	assert.Empty(t, spans[0].ParentSpanID)
+	assert.Len(t, spans[0].TraceID, 32)
+	assert.Len(t, spans[0].SpanID, 16)
+	assert.Equal(t, "22", *spans[0].Attributes[1].Value.IntValue)
+	assert.Zero(t, spans[0].Status.Code)
+
+	assert.Equal(t, "ssh.auth", spans[1].Name)
+	assert.Equal(t, spans[0].TraceID, spans[1].TraceID)
+	assert.Equal(t, spans[0].SpanID, spans[1].ParentSpanID)
+	assert.True(t, *spans[1].Attributes[0].Value.BoolValue)
+	assert.Equal(t, otlpStatus{Code: statusError, Message: "permission denied"}, spans[1].Status)
+}
+
+func TestExportFailure(t *testing.T) {
+	clearOTELEnv(t)
+	server, _, _ := collector(t, http.StatusUnauthorized)
+	require.NoError(t, Configure(server.URL, nil))
+
+	var exportErr error
+	oldOnError := OnError
+	OnError = func(err error) { exportErr = err }
+	defer func() { OnError = oldOnError }()
+
+	_, span := Start(context.Background(), "transfer")
+	span.Finish(nil)
+	assert.ErrorContains(t, exportErr, "401 Unauthorized")
+}
+
+func TestConfigure(t *testing.T) {
+	clearOTELEnv(t)
+
+	// Without an endpoint tracing stays off
+	require.NoError(t, Configure("", nil))
+	assert.Nil(t, Exporter)
+	assert.False(t, Enabled())
+
+	require.NoError(t, Configure("http://collector:4318", map[string]string{"X-Team": "ops", "X-Key": "a"}))
+	assert.Equal(t, "http://collector:4318/v1/traces", Exporter.URL)
+
+	// The environment takes precedence over settings
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://otel.example.com")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "X-Key=b%20c, X-Env=1")
+	require.NoError(t, Configure("http://collector:4318", map[string]string{"X-Team": "ops", "X-Key": "a"}))
+	assert.Equal(t, "https://otel.example.com/v1/traces", Exporter.URL)
+	assert.Equal(t, map[string]string{"X-Team": "ops", "X-Key": "b c", "X-Env": "1"}, Exporter.Headers)
+
+	// The traces endpoint is used as given
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "https://otel.example.com/custom")
+	require.NoError(t, Configure("", nil))
+	assert.Equal(t, "https://otel.example.com/custom", Exporter.URL)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "broken")
+	assert.ErrorContains(t, Configure("", nil), "OTEL_EXPORTER_OTLP_HEADERS")
+
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "collector:4318")
+	assert.ErrorContains(t, Configure("", nil), "must be an http:// or https:// URL")
+	assert.Nil(t, Exporter)
+}
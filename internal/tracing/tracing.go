@@ -0,0 +1,224 @@
+// Package tracing records how long connections and transfers spend in each
+// phase as OpenTelemetry spans, printed with --trace and exported to an
+// OTLP collector
+// Copyright (c) 2025 orpheus497
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Summary prints every finished trace on stderr (--trace)
+	Summary bool
+
+	// Exporter sends finished traces to an OTLP collector; nil exports
+	// nothing
+	Exporter *OTLPExporter
+
+	// OnError reports traces that could not be exported
+	OnError = func(err error) {}
+
+	// output receives summaries
+	output io.Writer = os.Stderr
+)
+
+// Enabled reports whether spans are recorded
+func Enabled() bool {
+	return Summary || Exporter != nil
+}
+
+// Attr is a span attribute
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attr {
+	return Attr{Key: key, Value: int64(value)}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Span is one timed phase of a trace. Spans started from a context holding
+// another span are its children; others are roots. A trace is printed and
+// exported when its root ends, so spans still running then are left out.
+//
+// All methods do nothing on a nil Span, which Start returns while tracing
+// is disabled.
+type Span struct {
+	ID       [8]byte
+	ParentID [8]byte
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Err      error
+
+	trace *trace
+	depth int
+}
+
+// trace collects the finished spans under a root
+type trace struct {
+	mu    sync.Mutex
+	root  *Span
+	spans []*Span
+}
+
+// traceID is shared by every trace of the process, so the phases of one
+// klip run appear together in the collector
+var (
+	traceID     [16]byte
+	traceIDOnce sync.Once
+)
+
+// TraceID returns the process's trace ID in hex
+func TraceID() string {
+	traceIDOnce.Do(func() { rand.Read(traceID[:]) })
+	return hex.EncodeToString(traceID[:])
+}
+
+type spanKey struct{}
+
+// Start begins a span as a child of the span in ctx, or as a root
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	s := &Span{Name: name, Start: time.Now(), Attrs: attrs}
+	rand.Read(s.ID[:])
+	if parent, _ := ctx.Value(spanKey{}).(*Span); parent != nil {
+		s.ParentID = parent.ID
+		s.trace = parent.trace
+		s.depth = parent.depth + 1
+	} else {
+		s.trace = &trace{root: s}
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttrs adds attributes to a span that has not ended
+func (s *Span) SetAttrs(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if s.End.IsZero() {
+		s.Attrs = append(s.Attrs, attrs...)
+	}
+}
+
+// Finish ends a span, failed if err is not nil. Only the first call counts.
+// Finishing a root prints and exports its trace.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.trace.mu.Lock()
+	if !s.End.IsZero() {
+		s.trace.mu.Unlock()
+		return
+	}
+	s.End = time.Now()
+	s.Err = err
+	s.trace.spans = append(s.trace.spans, s)
+	var spans []*Span
+	if s.trace.root == s {
+		spans = append(spans, s.trace.spans...)
+	}
+	s.trace.mu.Unlock()
+
+	if spans == nil {
+		return
+	}
+	spans = treeOrder(s, spans)
+	if Summary {
+		printSummary(output, spans)
+	}
+	if Exporter != nil {
+		if err := Exporter.Export(spans); err != nil {
+			OnError(err)
+		}
+	}
+}
+
+// treeOrder lists the root and, depth first, the spans under it, children
+// in the order they started
+func treeOrder(root *Span, spans []*Span) []*Span {
+	children := map[[8]byte][]*Span{}
+	for _, s := range spans {
+		if s != root {
+			children[s.ParentID] = append(children[s.ParentID], s)
+		}
+	}
+
+	var ordered []*Span
+	var visit func(s *Span)
+	visit = func(s *Span) {
+		ordered = append(ordered, s)
+		next := children[s.ID]
+		sort.SliceStable(next, func(i, j int) bool { return next[i].Start.Before(next[j].Start) })
+		for _, child := range next {
+			visit(child)
+		}
+	}
+	visit(root)
+	return ordered
+}
+
+// Duration is how long a finished span took
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// printSummary prints a trace as an indented tree of spans with their
+// durations and attributes
+func printSummary(w io.Writer, spans []*Span) {
+	width := 0
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = strings.Repeat("  ", s.depth) + s.Name
+		width = max(width, len(names[i]))
+	}
+
+	for i, s := range spans {
+		line := fmt.Sprintf("%-*s %8s", width, names[i], formatDuration(s.Duration()))
+		for _, attr := range s.Attrs {
+			line += fmt.Sprintf(" %s=%v", attr.Key, attr.Value)
+		}
+		if s.Err != nil {
+			line += fmt.Sprintf(" (failed: %v)", s.Err)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// formatDuration shows milliseconds below a second and hundredths above
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enableSummary records spans and captures the summaries printed
+func enableSummary(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	oldSummary, oldOutput := Summary, output
+	Summary, output = true, &buf
+	t.Cleanup(func() { Summary, output = oldSummary, oldOutput })
+	return &buf
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "connect")
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+
+	// A nil span does nothing
+	span.SetAttrs(String("k", "v"))
+	span.Finish(errors.New("failed"))
+}
+
+func TestSpanTree(t *testing.T) {
+	buf := enableSummary(t)
+
+	ctx, root := Start(context.Background(), "connect", String("klip.profile", "web"))
+	resolveCtx, resolve := Start(ctx, "resolve")
+	_, lookup := Start(resolveCtx, "dns")
+	lookup.Finish(nil)
+	resolve.Finish(nil)
+	_, handshake := Start(ctx, "ssh.handshake")
+	handshake.Finish(errors.New("connection reset"))
+	handshake.Finish(nil)
+
+	// Spans still running when the root ends are left out
+	_, late := Start(ctx, "ssh.auth")
+	assert.Empty(t, buf.String())
+	root.Finish(nil)
+	late.Finish(nil)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[0], "connect "), lines[0])
+	assert.Contains(t, lines[0], "klip.profile=web")
+	assert.True(t, strings.HasPrefix(lines[1], "  resolve "), lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "    dns "), lines[2])
+	assert.True(t, strings.HasPrefix(lines[3], "  ssh.handshake "), lines[3])
+	assert.Contains(t, lines[3], "(failed: connection reset)")
+
+	assert.Equal(t, root.ID, resolve.ParentID)
+	assert.Equal(t, resolve.ID, lookup.ParentID)
+	assert.Equal(t, [8]byte{}, root.ParentID)
+}
+
+func TestSeparateRoots(t *testing.T) {
+	buf := enableSummary(t)
+
+	_, detect := Start(context.Background(), "backend.detect")
+	_, transfer := Start(context.Background(), "transfer")
+	detect.Finish(nil)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	transfer.Finish(nil)
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "0ms", formatDuration(0))
+	assert.Equal(t, "850ms", formatDuration(850*time.Millisecond))
+	assert.Equal(t, "12.00s", formatDuration(12*time.Second))
+	assert.Equal(t, "3.25s", formatDuration(3250*time.Millisecond))
+}
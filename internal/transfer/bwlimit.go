@@ -0,0 +1,75 @@
+// Package transfer - Bandwidth limiting for SFTP copies
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter spreads the copies of a transfer over time so they average
+// at most rate bytes per second, shared by files copied at once
+type rateLimiter struct {
+	mu    sync.Mutex
+	rate  float64
+	start time.Time
+	sent  int64
+}
+
+// newRateLimiter returns a limiter for kbps KB/s, or nil for no limit
+func newRateLimiter(kbps int) *rateLimiter {
+	if kbps <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(kbps) * 1024}
+}
+
+// wait blocks until n more bytes fit within the rate. Time spent idle is
+// not saved up for later bursts.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	due := l.start.Add(time.Duration(float64(l.sent) / l.rate * float64(time.Second)))
+	if l.start.IsZero() || now.Sub(due) > time.Second {
+		l.start, l.sent = now, 0
+	}
+	l.sent += int64(n)
+	due = l.start.Add(time.Duration(float64(l.sent) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitedReader reads from r no faster than its limiter allows
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if waitErr := l.limiter.wait(l.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
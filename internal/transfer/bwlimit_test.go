@@ -0,0 +1,31 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	assert.Nil(t, newRateLimiter(0))
+	assert.NoError(t, newRateLimiter(0).wait(context.Background(), 1<<20))
+
+	// 100 KB at 400 KB/s takes about a quarter of a second
+	limiter := newRateLimiter(400)
+	start := time.Now()
+	r := &limitedReader{ctx: context.Background(), r: bytes.NewReader(make([]byte, 100*1024)), limiter: limiter}
+	n, err := io.Copy(io.Discard, r)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100*1024, n)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+
+	// A cancelled copy stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, newRateLimiter(1).wait(ctx, 1<<20), context.Canceled)
+}
@@ -0,0 +1,115 @@
+// Package transfer - Ownership and permission overrides
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/orpheus497/klip/internal/config"
+)
+
+// rsyncVersionPattern extracts the version from 'rsync --version'
+var rsyncVersionPattern = regexp.MustCompile(`version (\d+)\.(\d+)`)
+
+// rsyncSupportsChown reports whether the rsync that printed version has
+// --chown (3.1.0 and later)
+func rsyncSupportsChown(version string) bool {
+	match := rsyncVersionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return false
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return major > 3 || (major == 3 && minor >= 1)
+}
+
+// chownCommand is the remote command that gives paths the owner in spec,
+// and everything below them when recursive. -h changes symlinks rather
+// than what they point to.
+func chownCommand(spec string, recursive bool, paths ...string) string {
+	command := "chown -h"
+	if recursive {
+		command = "chown -R -h"
+	}
+	command += " -- " + quoteRemoteShellArg(spec)
+	for _, p := range paths {
+		command += " " + quoteRemoteShellArg(toUnixPath(p))
+	}
+	return command
+}
+
+// pushedChownCommand is the remote command that gives the entries a push
+// created the owner in cfg.Chown, leaving the destination directory they
+// were copied into alone: a pushed file, which lands inside the
+// destination if that is an existing directory, the copied directory, or
+// each top-level entry of a directory whose contents were copied. Empty
+// if the push copied nothing.
+func pushedChownCommand(cfg *TransferConfig) string {
+	info, err := os.Stat(cfg.SourcePath)
+	if err != nil {
+		return ""
+	}
+	dest := toUnixPath(cfg.DestPath)
+
+	if !info.IsDir() {
+		inside := path.Join(dest, filepath.Base(cfg.SourcePath))
+		return fmt.Sprintf("if [ -d %s ]; then %s; else %s; fi", quoteRemoteShellArg(dest),
+			chownCommand(cfg.Chown, false, inside), chownCommand(cfg.Chown, false, dest))
+	}
+	if cfg.DirectoryMode == DirModeInto {
+		return chownCommand(cfg.Chown, true, Destination(cfg))
+	}
+
+	entries, err := os.ReadDir(cfg.SourcePath)
+	if err != nil {
+		return ""
+	}
+	filter := cfg.filter()
+	var paths []string
+	for _, entry := range entries {
+		if !filter.skip(entry.Name(), entry.IsDir()) {
+			paths = append(paths, path.Join(dest, entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	return chownCommand(cfg.Chown, true, paths...)
+}
+
+// chownPushed applies the owner in cfg.Chown to what a push created
+func chownPushed(ctx context.Context, runner CommandRunner, cfg *TransferConfig) error {
+	command := pushedChownCommand(cfg)
+	if command == "" {
+		return nil
+	}
+	return chownRemote(ctx, runner, cfg.Chown, cfg.DestPath, command)
+}
+
+// chownRemote runs command, a chown of remotePath to spec, on the remote
+// host
+func chownRemote(ctx context.Context, runner CommandRunner, spec, remotePath, command string) error {
+	if runner == nil {
+		return fmt.Errorf("chown needs an SSH connection to run chown on the remote host")
+	}
+	if output, err := runner.RunCommand(ctx, command); err != nil {
+		return fmt.Errorf("failed to chown %s to %s: %w%s", remotePath, spec, err, commandOutput(output))
+	}
+	return nil
+}
+
+// chmodRules returns the parsed permission overrides, nil without any.
+// NewTransfer has already validated them.
+func (c *TransferConfig) chmodRules() config.Chmod {
+	if c.Chmod == "" {
+		return nil
+	}
+	rules, _ := config.ParseChmod(c.Chmod)
+	return rules
+}
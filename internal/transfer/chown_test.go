@@ -0,0 +1,104 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRsyncSupportsChown(t *testing.T) {
+	assert.True(t, rsyncSupportsChown("rsync  version 3.2.7  protocol version 31"))
+	assert.True(t, rsyncSupportsChown("rsync  version 3.1.0  protocol version 31"))
+	assert.False(t, rsyncSupportsChown("rsync  version 3.0.9  protocol version 30"))
+	assert.False(t, rsyncSupportsChown("rsync  version 2.6.9  compatible  protocol version 29"))
+	assert.False(t, rsyncSupportsChown("openrsync: protocol version 29"))
+}
+
+func TestChownCommand(t *testing.T) {
+	assert.Equal(t, "chown -R -h -- deploy:www-data /srv/www", chownCommand("deploy:www-data", true, "/srv/www"))
+	assert.Equal(t, `chown -h -- :www-data '/srv/it'"'"'s' /srv/b`, chownCommand(":www-data", false, "/srv/it's", "/srv/b"))
+}
+
+func TestPushedChownCommand(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(file, []byte("key=value"), 0644))
+	site := filepath.Join(dir, "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(site, "css"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(site, "index.html"), []byte("hi"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(site, "notes.tmp"), []byte("x"), 0644))
+
+	cfg := &TransferConfig{SourcePath: file, DestPath: "/etc", Chown: "app", Direction: DirectionPush}
+	assert.Equal(t, "if [ -d /etc ]; then chown -h -- app /etc/app.conf; else chown -h -- app /etc; fi", pushedChownCommand(cfg))
+
+	cfg = &TransferConfig{SourcePath: site, DestPath: "/srv", Chown: "app", Direction: DirectionPush, DirectoryMode: DirModeInto}
+	assert.Equal(t, "chown -R -h -- app /srv/site", pushedChownCommand(cfg))
+
+	cfg.DirectoryMode = DirModeContents
+	cfg.ExcludePatterns = []string{"*.tmp"}
+	assert.Equal(t, "chown -R -h -- app /srv/css /srv/index.html", pushedChownCommand(cfg))
+
+	cfg.ExcludePatterns = []string{"*"}
+	assert.Empty(t, pushedChownCommand(cfg))
+}
+
+// currentOwner returns a chown spec naming the current user and group
+func currentOwner(t *testing.T) string {
+	user, err := exec.Command("id", "-un").Output()
+	if err != nil {
+		t.Skip("id not available")
+	}
+	group, err := exec.Command("id", "-gn").Output()
+	require.NoError(t, err)
+	return strings.TrimSpace(string(user)) + ":" + strings.TrimSpace(string(group))
+}
+
+func TestChownRemote(t *testing.T) {
+	spec := currentOwner(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	require.NoError(t, os.WriteFile(file, []byte("hi"), 0644))
+
+	runner := &localRunner{}
+	require.NoError(t, chownRemote(context.Background(), runner, spec, file, chownCommand(spec, false, file)))
+	require.Len(t, runner.commands, 1)
+	assert.Equal(t, chownCommand(spec, false, file), runner.commands[0])
+
+	err := chownRemote(context.Background(), runner, "klip-no-such-user", file, chownCommand("klip-no-such-user", false, file))
+	assert.ErrorContains(t, err, "failed to chown")
+
+	assert.Error(t, chownRemote(context.Background(), nil, spec, file, chownCommand(spec, false, file)))
+}
+
+func TestChownPushedIntoExistingDirectory(t *testing.T) {
+	spec := currentOwner(t)
+	src := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(src, []byte("key=value"), 0644))
+
+	// Push the file into an existing directory, as "klipc app.conf /etc/" does
+	etc := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(etc, "other.conf"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(etc, "app.conf"), []byte("key=value"), 0644))
+	runner := &localRunner{}
+	cfg := &TransferConfig{SourcePath: src, DestPath: etc, Direction: DirectionPush, Chown: spec}
+
+	require.NoError(t, chownPushed(context.Background(), runner, cfg))
+	require.Len(t, runner.commands, 1)
+
+	// Only the pushed file is chowned, never the directory or its other entries
+	assert.Contains(t, runner.commands[0], "then "+chownCommand(spec, false, filepath.Join(etc, "app.conf"))+";")
+	assert.NotContains(t, runner.commands[0], "-R")
+	assert.NotContains(t, runner.commands[0], "other.conf")
+
+	// A missing user fails in the branch that ran, proving the file was targeted
+	cfg.Chown = "klip-no-such-user"
+	err := chownPushed(context.Background(), runner, cfg)
+	assert.ErrorContains(t, err, "failed to chown")
+	assert.Contains(t, runner.commands[1], "/app.conf;")
+}
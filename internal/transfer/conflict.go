@@ -0,0 +1,127 @@
+// Package transfer - Conflict resolution for bidirectional sync
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// FileVersion is one side's version of a file in conflict
+type FileVersion struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Conflict is a file changed on both sides since the last sync, or changed
+// on one side and deleted on the other
+type Conflict struct {
+	// Path is the file relative to the synced directories, slash-separated
+	Path string
+
+	// Local and Remote are the versions on each side (nil if deleted)
+	Local  *FileVersion
+	Remote *FileVersion
+}
+
+// Resolution is how a conflict is resolved
+type Resolution string
+
+const (
+	// ResolutionLocal overwrites the remote file with the local one (or
+	// deletes it if the local file was deleted)
+	ResolutionLocal Resolution = "local"
+
+	// ResolutionRemote overwrites the local file with the remote one (or
+	// deletes it if the remote file was deleted)
+	ResolutionRemote Resolution = "remote"
+
+	// ResolutionBoth keeps both versions on both sides, the remote one under
+	// ConflictCopyName
+	ResolutionBoth Resolution = "both"
+
+	// ResolutionSkip leaves both sides as they are until the next sync
+	ResolutionSkip Resolution = "skip"
+)
+
+// ConflictResolver decides how to resolve a conflict
+type ConflictResolver func(Conflict) (Resolution, error)
+
+// ConflictPolicy resolves conflicts without asking (--prefer)
+type ConflictPolicy string
+
+const (
+	// PreferAsk asks interactively and skips conflicts otherwise
+	PreferAsk ConflictPolicy = ""
+
+	// PreferLocal and PreferRemote always keep that side's version
+	PreferLocal  ConflictPolicy = "local"
+	PreferRemote ConflictPolicy = "remote"
+
+	// PreferNewer keeps the most recently modified version; a file deleted
+	// on one side is kept from the other
+	PreferNewer ConflictPolicy = "newer"
+
+	// PreferBoth keeps both versions
+	PreferBoth ConflictPolicy = "both"
+
+	// PreferSkip leaves conflicts unresolved
+	PreferSkip ConflictPolicy = "skip"
+)
+
+// ConflictPolicies lists the policies accepted by ParseConflictPolicy
+var ConflictPolicies = []ConflictPolicy{PreferLocal, PreferRemote, PreferNewer, PreferBoth, PreferSkip}
+
+// ParseConflictPolicy parses a --prefer value (empty for PreferAsk)
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	if s == "" {
+		return PreferAsk, nil
+	}
+	for _, p := range ConflictPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+	names := make([]string, len(ConflictPolicies))
+	for i, p := range ConflictPolicies {
+		names[i] = string(p)
+	}
+	return PreferAsk, fmt.Errorf("invalid conflict policy %q, must be one of %s", s, strings.Join(names, ", "))
+}
+
+// Resolve returns the policy's resolution of c. PreferAsk skips it.
+func (p ConflictPolicy) Resolve(c Conflict) Resolution {
+	switch p {
+	case PreferLocal:
+		return ResolutionLocal
+	case PreferRemote:
+		return ResolutionRemote
+	case PreferBoth:
+		return ResolutionBoth
+	case PreferNewer:
+		switch {
+		case c.Local == nil:
+			return ResolutionRemote
+		case c.Remote == nil:
+			return ResolutionLocal
+		case c.Remote.ModTime.After(c.Local.ModTime):
+			return ResolutionRemote
+		default:
+			return ResolutionLocal
+		}
+	default:
+		return ResolutionSkip
+	}
+}
+
+// ConflictCopyName returns the name the side's version of a file is kept
+// under when both versions are kept, e.g. "notes.conflict-remote.txt"
+func ConflictCopyName(name, side string) string {
+	ext := path.Ext(name)
+	if ext == name || strings.HasSuffix(strings.TrimSuffix(name, ext), "/") {
+		ext = ""
+	}
+	return strings.TrimSuffix(name, ext) + ".conflict-" + side + ext
+}
@@ -0,0 +1,59 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflictPolicyResolve(t *testing.T) {
+	older := &FileVersion{Size: 10, ModTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	newer := &FileVersion{Size: 20, ModTime: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		policy   ConflictPolicy
+		conflict Conflict
+		want     Resolution
+	}{
+		{PreferLocal, Conflict{Local: older, Remote: newer}, ResolutionLocal},
+		{PreferRemote, Conflict{Local: newer, Remote: older}, ResolutionRemote},
+		{PreferBoth, Conflict{Local: older, Remote: newer}, ResolutionBoth},
+		{PreferSkip, Conflict{Local: older, Remote: newer}, ResolutionSkip},
+		{PreferAsk, Conflict{Local: older, Remote: newer}, ResolutionSkip},
+		{PreferNewer, Conflict{Local: older, Remote: newer}, ResolutionRemote},
+		{PreferNewer, Conflict{Local: newer, Remote: older}, ResolutionLocal},
+		{PreferNewer, Conflict{Local: nil, Remote: older}, ResolutionRemote},
+		{PreferNewer, Conflict{Local: older, Remote: nil}, ResolutionLocal},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.policy.Resolve(tt.conflict), "%q", tt.policy)
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	p, err := ParseConflictPolicy("newer")
+	require.NoError(t, err)
+	assert.Equal(t, PreferNewer, p)
+
+	p, err = ParseConflictPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, PreferAsk, p)
+
+	_, err = ParseConflictPolicy("mine")
+	assert.Error(t, err)
+}
+
+func TestConflictCopyName(t *testing.T) {
+	for name, want := range map[string]string{
+		"notes.txt":          "notes.conflict-remote.txt",
+		"docs/report.tar.gz": "docs/report.tar.conflict-remote.gz",
+		"Makefile":           "Makefile.conflict-remote",
+		".bashrc":            ".bashrc.conflict-remote",
+		"home/.profile":      "home/.profile.conflict-remote",
+	} {
+		assert.Equal(t, want, ConflictCopyName(name, "remote"), name)
+	}
+}
@@ -0,0 +1,123 @@
+// Package transfer - Reusing chunks already pushed to the remote host
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/cache"
+	"github.com/pkg/sftp"
+)
+
+// dedupBatchSize is how many chunk copies are run per remote command
+const dedupBatchSize = 64
+
+// chunkHashes returns the hex SHA-256 digest of each MultipathChunkSize
+// chunk of a file
+func chunkHashes(f *os.File, size int64) ([]string, error) {
+	hashes := make([]string, 0, (size+MultipathChunkSize-1)/MultipathChunkSize)
+	buf := make([]byte, MultipathChunkSize)
+	for offset := int64(0); offset < size; offset += MultipathChunkSize {
+		n, err := f.ReadAt(buf[:min(MultipathChunkSize, size-offset)], offset)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to hash %s: %w", f.Name(), err)
+		}
+		sum := sha256.Sum256(buf[:n])
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	return hashes, nil
+}
+
+// chunkOffsets returns the offsets of every chunk of a file
+func chunkOffsets(size int64) []int64 {
+	var offsets []int64
+	for offset := int64(0); offset < size; offset += MultipathChunkSize {
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+// reusedChunk is a chunk of the file being pushed that is copied from a
+// file already on the remote host instead of sent
+type reusedChunk struct {
+	offset int64
+	from   cache.ChunkLocation
+}
+
+// planReuse looks up the chunks of the file being pushed to target in the
+// chunk cache. A chunk is only reused from a remote file that still has the
+// size and modification time it was recorded with, and never from target
+// itself, which is truncated before the copies run.
+func planReuse(client *sftp.Client, chunks *cache.ChunkCache, hashes []string, target string) []reusedChunk {
+	valid := make(map[string]bool)
+	var reused []reusedChunk
+	for i, hash := range hashes {
+		loc, ok := chunks.Lookup(hash)
+		if !ok || loc.Path == target {
+			continue
+		}
+
+		isValid, checked := valid[loc.Path]
+		if !checked {
+			info, err := client.Stat(loc.Path)
+			isValid = err == nil && info.Mode().IsRegular() && info.Size() == loc.Size && info.ModTime().Unix() == loc.ModTime.Unix()
+			valid[loc.Path] = isValid
+		}
+		if isValid {
+			reused = append(reused, reusedChunk{offset: int64(i) * MultipathChunkSize, from: loc})
+		}
+	}
+	return reused
+}
+
+// copyReusedChunks copies reused chunks into target on the remote host with
+// dd, so their data never crosses the network
+func copyReusedChunks(ctx context.Context, runner CommandRunner, reused []reusedChunk, target string) error {
+	for start := 0; start < len(reused); start += dedupBatchSize {
+		var commands []string
+		for _, c := range reused[start:min(start+dedupBatchSize, len(reused))] {
+			commands = append(commands, fmt.Sprintf("dd if=%s of=%s bs=%d skip=%d seek=%d count=1 conv=notrunc 2>/dev/null",
+				quoteRemoteShellArg(c.from.Path), quoteRemoteShellArg(target), MultipathChunkSize,
+				c.from.Offset/MultipathChunkSize, c.offset/MultipathChunkSize))
+		}
+		if _, err := runner.RunCommand(ctx, strings.Join(commands, " && ")); err != nil {
+			return fmt.Errorf("failed to copy chunks on the remote host: %w", err)
+		}
+	}
+	return nil
+}
+
+// missingOffsets returns the offsets of the chunks that must be sent
+func missingOffsets(size int64, reused []reusedChunk) []int64 {
+	skip := make(map[int64]bool, len(reused))
+	for _, c := range reused {
+		skip[c.offset] = true
+	}
+
+	var offsets []int64
+	for _, offset := range chunkOffsets(size) {
+		if !skip[offset] {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+// reusedSources returns the remote files chunks were reused from
+func reusedSources(reused []reusedChunk) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, c := range reused {
+		if !seen[c.from.Path] {
+			seen[c.from.Path] = true
+			paths = append(paths, c.from.Path)
+		}
+	}
+	return paths
+}
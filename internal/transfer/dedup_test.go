@@ -0,0 +1,108 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/cache"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkReuse(t *testing.T) {
+	dir := t.TempDir()
+	old := make([]byte, 3*MultipathChunkSize+100)
+	_, err := rand.Read(old)
+	require.NoError(t, err)
+
+	// A previously pushed file, recorded in the cache
+	pushed := filepath.Join(dir, "build-1.tar")
+	require.NoError(t, os.WriteFile(pushed, old, 0644))
+	f, err := os.Open(pushed)
+	require.NoError(t, err)
+	defer f.Close()
+	hashes, err := chunkHashes(f, int64(len(old)))
+	require.NoError(t, err)
+	require.Len(t, hashes, 4)
+
+	chunks, err := cache.LoadChunkCacheFile(filepath.Join(dir, "chunks.json"), MultipathChunkSize)
+	require.NoError(t, err)
+	info, err := os.Stat(pushed)
+	require.NoError(t, err)
+	require.NoError(t, chunks.Record(pushed, info.Size(), info.ModTime(), hashes))
+
+	// The new file under another name differs only in its second chunk
+	data := bytes.Clone(old)
+	data[MultipathChunkSize+1] ^= 0xff
+	local := filepath.Join(dir, "build-2.tar")
+	require.NoError(t, os.WriteFile(local, data, 0644))
+	src, err := os.Open(local)
+	require.NoError(t, err)
+	defer src.Close()
+	newHashes, err := chunkHashes(src, int64(len(data)))
+	require.NoError(t, err)
+
+	target := filepath.Join(dir, "remote", "build-2.tar")
+	require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+	require.NoError(t, os.WriteFile(target, make([]byte, len(data)), 0644))
+
+	client := newPipeSFTPClient(t)
+	reused := planReuse(client, chunks, newHashes, target)
+	require.Len(t, reused, 3)
+	assert.Equal(t, []string{pushed}, reusedSources(reused))
+
+	runner := &localRunner{}
+	require.NoError(t, copyReusedChunks(context.Background(), runner, reused, target))
+	offsets := missingOffsets(int64(len(data)), reused)
+	assert.Equal(t, []int64{MultipathChunkSize}, offsets)
+
+	m := NewMultipathTransfer(&TransferConfig{})
+	err = m.stripe(context.Background(), []*sftp.Client{client}, int64(len(data)), local, offsets, func(c *sftp.Client) (io.ReaderAt, io.WriterAt, func(), error) {
+		f, err := c.OpenFile(target, os.O_WRONLY)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return src, f, func() { f.Close() }, nil
+	})
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestPlanReuseSkipsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("chunk contents")
+	pushed := filepath.Join(dir, "pushed.bin")
+	require.NoError(t, os.WriteFile(pushed, data, 0644))
+
+	sum, err := chunkHashes(mustOpen(t, pushed), int64(len(data)))
+	require.NoError(t, err)
+	chunks, err := cache.LoadChunkCacheFile(filepath.Join(dir, "chunks.json"), MultipathChunkSize)
+	require.NoError(t, err)
+	info, err := os.Stat(pushed)
+	require.NoError(t, err)
+	require.NoError(t, chunks.Record(pushed, info.Size()+1, info.ModTime(), sum))
+
+	client := newPipeSFTPClient(t)
+	assert.Empty(t, planReuse(client, chunks, sum, filepath.Join(dir, "target.bin")))
+
+	// The file being written is never its own source
+	require.NoError(t, chunks.Record(pushed, info.Size(), info.ModTime(), sum))
+	assert.Len(t, planReuse(client, chunks, sum, filepath.Join(dir, "target.bin")), 1)
+	assert.Empty(t, planReuse(client, chunks, sum, pushed))
+}
+
+func mustOpen(t *testing.T, name string) *os.File {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
@@ -0,0 +1,327 @@
+// Package transfer - Delta transfers without rsync
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/delta"
+	"github.com/pkg/sftp"
+)
+
+const (
+	// DeltaSuffix is appended to the remote path of a push to name the file
+	// holding the data the remote file lacks until it is assembled
+	DeltaSuffix = ".klip-delta"
+
+	// deltaBatch is how many pieces one assembly command joins
+	deltaBatch = 256
+)
+
+// errDeltaSkipped reports that a file is copied whole since there is no
+// previous version to reuse or it is too small to be worth it
+var errDeltaSkipped = errors.New("delta transfer skipped")
+
+// deltaPiece is a run of the new file: count blocks of the old file from
+// block, or length bytes of literal data from offset
+type deltaPiece struct {
+	block, count   int64
+	offset, length int64
+}
+
+// deltaWorthwhile reports whether files of the old and new sizes are large
+// enough for a delta transfer to save anything
+func deltaWorthwhile(oldSize, newSize int64) bool {
+	return oldSize >= 2*delta.MinBlockSize && newSize >= 2*delta.MinBlockSize
+}
+
+// deltaPieces splits a new file of size bytes into runs of matched blocks
+// and literal data, merging blocks that follow each other in both files
+func deltaPieces(matches []delta.Match, blockSize, size int64) []deltaPiece {
+	var pieces []deltaPiece
+	var pos int64
+	for _, m := range matches {
+		if m.Offset > pos {
+			pieces = append(pieces, deltaPiece{block: -1, offset: pos, length: m.Offset - pos})
+		}
+		last := len(pieces) - 1
+		if last >= 0 && pieces[last].block >= 0 && pieces[last].block+pieces[last].count == int64(m.Block) {
+			pieces[last].count++
+		} else {
+			pieces = append(pieces, deltaPiece{block: int64(m.Block), count: 1})
+		}
+		pos = m.Offset + blockSize
+	}
+	if pos < size {
+		pieces = append(pieces, deltaPiece{block: -1, offset: pos, length: size - pos})
+	}
+	return pieces
+}
+
+// remoteSignature computes the signature of the first blocks full blocks
+// of a remote file with POSIX tools, cksum for the weak checksum and
+// sha256sum or shasum for the strong one
+func remoteSignature(ctx context.Context, runner CommandRunner, name string, blockSize, blocks int64) (*delta.Signature, error) {
+	command := fmt.Sprintf(`f=%s; `+
+		`if command -v sha256sum >/dev/null 2>&1; then h=sha256sum; `+
+		`elif command -v shasum >/dev/null 2>&1; then h="shasum -a 256"; else exit 127; fi; `+
+		`i=0; while [ $i -lt %d ]; do `+
+		`c=$(dd if="$f" bs=%d skip=$i count=1 2>/dev/null | cksum) && `+
+		`s=$(dd if="$f" bs=%[3]d skip=$i count=1 2>/dev/null | $h) || exit 1; `+
+		`echo "$i ${c%%%% *} ${s%%%% *}"; i=$((i+1)); done`,
+		quoteRemoteShellArg(name), blocks, blockSize)
+
+	output, err := runner.RunCommand(ctx, command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum remote blocks: %w", err)
+	}
+
+	sig := &delta.Signature{BlockSize: blockSize}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != strconv.Itoa(len(sig.Blocks)) {
+			return nil, fmt.Errorf("unexpected remote checksum output: %q", line)
+		}
+		weak, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected remote checksum output: %q", line)
+		}
+		sig.Blocks = append(sig.Blocks, delta.Block{Weak: uint32(weak), Strong: strings.ToLower(fields[2])})
+	}
+	if int64(len(sig.Blocks)) != blocks {
+		return nil, fmt.Errorf("remote checksums cover %d of %d blocks", len(sig.Blocks), blocks)
+	}
+	return sig, nil
+}
+
+// fallBack reports whether a failed delta transfer of name should be
+// retried as a full copy, telling why unless there was nothing to reuse
+func (s *SFTPTransfer) fallBack(ctx context.Context, err error, name string) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if !errors.Is(err, errDeltaSkipped) {
+		s.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
+			CurrentFile: name,
+			Message:     fmt.Sprintf("Delta transfer of %s failed, copying whole file: %v", name, err),
+		})
+	}
+	return true
+}
+
+// pushDelta updates the remote file to the content of the local one by
+// uploading only the data the remote file lacks. Through runner, the remote
+// host joins it with the blocks it already has using dd, tail and head into
+// a temporary file, which replaces the remote file once its SHA-256 matches.
+func (s *SFTPTransfer) pushDelta(ctx context.Context, runner CommandRunner, client *sftp.Client, localFile *os.File, stat os.FileInfo, localPath, remotePath string) error {
+	if runner == nil {
+		return errDeltaSkipped
+	}
+	info, err := client.Stat(remotePath)
+	if err != nil || !info.Mode().IsRegular() || !deltaWorthwhile(info.Size(), stat.Size()) {
+		return errDeltaSkipped
+	}
+
+	blockSize := delta.BlockSize(info.Size())
+	sig, err := remoteSignature(ctx, runner, remotePath, blockSize, info.Size()/blockSize)
+	if err != nil {
+		return err
+	}
+	matches, err := delta.Find(ctx, io.NewSectionReader(localFile, 0, stat.Size()), sig)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return errDeltaSkipped
+	}
+	pieces := deltaPieces(matches, blockSize, stat.Size())
+
+	// Upload the literal data in order into one file
+	literal := remotePath + DeltaSuffix
+	var readers []io.Reader
+	var literalSize int64
+	for i, p := range pieces {
+		if p.block < 0 {
+			readers = append(readers, io.NewSectionReader(localFile, p.offset, p.length))
+			pieces[i].offset = literalSize
+			literalSize += p.length
+		}
+	}
+	defer client.Remove(literal)
+
+	literalFile, err := client.OpenFile(literal, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+	err = s.copyWithProgress(ctx, literalFile, io.MultiReader(readers...), 0, literalSize, localPath)
+	if closeErr := literalFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// The old file must stay intact while it is read, so the new one is
+	// always assembled under another name
+	target := s.config.remoteTemp(remotePath)
+	if target == remotePath {
+		target = remotePath + AtomicSuffix
+	}
+	if err := s.assemble(ctx, runner, pieces, blockSize, remotePath, literal, target); err != nil {
+		client.Remove(target)
+		return err
+	}
+
+	localSum, err := fileSHA256(localFile)
+	if err != nil {
+		return err
+	}
+	if sums := remoteSHA256(ctx, runner, []verifyPair{{remote: target}}); sums[target] != localSum {
+		client.Remove(target)
+		return fmt.Errorf("assembled file does not match")
+	}
+
+	if err := s.preserveMode(target, stat.Mode(), client.Chmod); err != nil {
+		client.Remove(target)
+		return err
+	}
+	if err := moveRemote(ctx, runner, client, target, remotePath); err != nil {
+		client.Remove(target)
+		return err
+	}
+
+	s.notifyProgress(ProgressInfo{
+		Operation:   OperationTransfer,
+		CurrentFile: localPath,
+		Message:     fmt.Sprintf("Delta transfer of %s sent %d of %d bytes", localPath, literalSize, stat.Size()),
+	})
+	return nil
+}
+
+// assemble writes the new file described by pieces to target on the
+// remote host, taking blocks from old and literal data from literal
+func (s *SFTPTransfer) assemble(ctx context.Context, runner CommandRunner, pieces []deltaPiece, blockSize int64, old, literal, target string) error {
+	redirect := ">"
+	for start := 0; start < len(pieces); start += deltaBatch {
+		var parts []string
+		for _, p := range pieces[start:min(start+deltaBatch, len(pieces))] {
+			if p.block >= 0 {
+				parts = append(parts, fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d 2>/dev/null",
+					quoteRemoteShellArg(old), blockSize, p.block, p.count))
+			} else {
+				parts = append(parts, fmt.Sprintf("tail -c +%d %s | head -c %d",
+					p.offset+1, quoteRemoteShellArg(literal), p.length))
+			}
+		}
+
+		command := fmt.Sprintf("{ %s; } %s %s", strings.Join(parts, "; "), redirect, quoteRemoteShellArg(target))
+		if _, err := runner.RunCommand(ctx, command); err != nil {
+			return fmt.Errorf("failed to assemble remote file: %w", err)
+		}
+		redirect = ">>"
+	}
+	return nil
+}
+
+// pullDelta updates the local file to the content of the remote one,
+// reading the blocks the local file already has from it and only the rest
+// from the remote host, and checks the result against the SHA-256 runner
+// computes remotely
+func (s *SFTPTransfer) pullDelta(ctx context.Context, runner CommandRunner, remoteFile *sftp.File, stat os.FileInfo, remotePath, localPath string) error {
+	if runner == nil {
+		return errDeltaSkipped
+	}
+	old, err := os.Open(localPath)
+	if err != nil {
+		return errDeltaSkipped
+	}
+	defer old.Close()
+	info, err := old.Stat()
+	if err != nil || !info.Mode().IsRegular() || !deltaWorthwhile(info.Size(), stat.Size()) {
+		return errDeltaSkipped
+	}
+
+	blockSize := delta.BlockSize(stat.Size())
+	blocks := stat.Size() / blockSize
+	sig, err := remoteSignature(ctx, runner, remotePath, blockSize, blocks)
+	if err != nil {
+		return err
+	}
+	matches, err := delta.Find(ctx, old, sig)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return errDeltaSkipped
+	}
+
+	// A block found in the old file can be used wherever the remote file
+	// has the same content
+	found := make(map[string]int64)
+	for _, m := range matches {
+		found[sig.Blocks[m.Block].Strong] = m.Offset
+	}
+	var readers []io.Reader
+	var reused int64
+	for i := int64(0); i < blocks; i++ {
+		if offset, ok := found[sig.Blocks[i].Strong]; ok {
+			readers = append(readers, io.NewSectionReader(old, offset, blockSize))
+			reused += blockSize
+		} else {
+			readers = append(readers, io.NewSectionReader(remoteFile, i*blockSize, blockSize))
+		}
+	}
+	readers = append(readers, io.NewSectionReader(remoteFile, blocks*blockSize, stat.Size()-blocks*blockSize))
+
+	target := s.config.localTemp(localPath)
+	if target == localPath {
+		target = localPath + AtomicSuffix
+	} else if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	newFile, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer newFile.Close()
+
+	err = s.copyWithProgress(ctx, newFile, io.MultiReader(readers...), 0, stat.Size(), remotePath)
+	var localSum string
+	if err == nil {
+		localSum, err = fileSHA256(newFile)
+	}
+	if err == nil {
+		err = newFile.Close()
+	}
+	if err == nil {
+		sums := remoteSHA256(ctx, runner, []verifyPair{{remote: remotePath}})
+		if sums[remotePath] != localSum {
+			err = fmt.Errorf("assembled file does not match")
+		}
+	}
+	if err == nil {
+		err = s.preserveMode(target, stat.Mode(), os.Chmod)
+	}
+	if err == nil {
+		err = moveLocal(target, localPath)
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	s.notifyProgress(ProgressInfo{
+		Operation:   OperationTransfer,
+		CurrentFile: remotePath,
+		Message:     fmt.Sprintf("Delta transfer of %s received %d of %d bytes", remotePath, stat.Size()-reused, stat.Size()),
+	})
+	return nil
+}
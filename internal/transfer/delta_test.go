@@ -0,0 +1,154 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/delta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deltaFiles writes an old file and a new one that shares most blocks with
+// it but has data inserted, replaced and appended
+func deltaFiles(t *testing.T, oldPath, newPath string) []byte {
+	old := make([]byte, 40*delta.MinBlockSize+123)
+	rand.New(rand.NewSource(1)).Read(old)
+
+	var data []byte
+	data = append(data, old[:5*delta.MinBlockSize+17]...)
+	data = append(data, []byte("inserted data")...)
+	data = append(data, old[5*delta.MinBlockSize+17:20*delta.MinBlockSize]...)
+	data = append(data, bytes.Repeat([]byte("replaced"), delta.MinBlockSize/8)...)
+	data = append(data, old[21*delta.MinBlockSize:]...)
+	data = append(data, []byte("appended data")...)
+
+	require.NoError(t, os.WriteFile(oldPath, old, 0644))
+	require.NoError(t, os.WriteFile(newPath, data, 0640))
+	return data
+}
+
+func TestDeltaPieces(t *testing.T) {
+	matches := []delta.Match{{Offset: 0, Block: 0}, {Offset: 10, Block: 1}, {Offset: 25, Block: 4}, {Offset: 35, Block: 2}}
+	pieces := deltaPieces(matches, 10, 50)
+	assert.Equal(t, []deltaPiece{
+		{block: 0, count: 2},
+		{block: -1, offset: 20, length: 5},
+		{block: 4, count: 1},
+		{block: 2, count: 1},
+		{block: -1, offset: 45, length: 5},
+	}, pieces)
+}
+
+func TestRemoteSignature(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	data := make([]byte, 3*delta.MinBlockSize+5)
+	rand.New(rand.NewSource(2)).Read(data)
+	require.NoError(t, os.WriteFile(name, data, 0644))
+
+	want, err := delta.NewSignature(bytes.NewReader(data), delta.MinBlockSize)
+	require.NoError(t, err)
+	got, err := remoteSignature(context.Background(), &localRunner{}, name, delta.MinBlockSize, 3)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestSFTPPushDelta(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.bin")
+	local := filepath.Join(dir, "local.bin")
+	data := deltaFiles(t, remote, local)
+
+	s := NewSFTPTransfer(&TransferConfig{Method: "delta", PreservePermissions: true})
+	var messages []string
+	s.SetProgressCallback(func(info ProgressInfo) {
+		if info.Message != "" {
+			messages = append(messages, info.Message)
+		}
+	})
+
+	f, err := os.Open(local)
+	require.NoError(t, err)
+	defer f.Close()
+	stat, err := f.Stat()
+	require.NoError(t, err)
+
+	runner := &localRunner{}
+	require.NoError(t, s.pushDelta(context.Background(), runner, newPipeSFTPClient(t), f, stat, local, remote))
+
+	got, err := os.ReadFile(remote)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	info, err := os.Stat(remote)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// Only the changed blocks were sent, and nothing is left behind
+	require.NotEmpty(t, messages)
+	assert.Contains(t, messages[len(messages)-1], fmt.Sprintf("sent %d of %d bytes", 2*delta.MinBlockSize+123+26, len(data)))
+	assert.NoFileExists(t, remote+DeltaSuffix)
+	assert.NoFileExists(t, remote+AtomicSuffix)
+}
+
+func TestSFTPPushDeltaSkipped(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.bin")
+	local := filepath.Join(dir, "local.bin")
+	require.NoError(t, os.WriteFile(local, bytes.Repeat([]byte("x"), 3*delta.MinBlockSize), 0644))
+
+	f, err := os.Open(local)
+	require.NoError(t, err)
+	defer f.Close()
+	stat, err := f.Stat()
+	require.NoError(t, err)
+
+	s := NewSFTPTransfer(&TransferConfig{Method: "delta"})
+	client := newPipeSFTPClient(t)
+
+	// Nothing to reuse without a remote file, a runner or shared blocks
+	err = s.pushDelta(context.Background(), &localRunner{}, client, f, stat, local, remote)
+	assert.ErrorIs(t, err, errDeltaSkipped)
+	require.NoError(t, os.WriteFile(remote, bytes.Repeat([]byte("y"), 3*delta.MinBlockSize), 0644))
+	err = s.pushDelta(context.Background(), nil, client, f, stat, local, remote)
+	assert.ErrorIs(t, err, errDeltaSkipped)
+	err = s.pushDelta(context.Background(), &localRunner{}, client, f, stat, local, remote)
+	assert.ErrorIs(t, err, errDeltaSkipped)
+	assert.False(t, s.fallBack(context.Background(), nil, local))
+	assert.True(t, s.fallBack(context.Background(), err, local))
+}
+
+func TestSFTPPullDelta(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.bin")
+	local := filepath.Join(dir, "local.bin")
+	data := deltaFiles(t, local, remote)
+
+	client := newPipeSFTPClient(t)
+	remoteFile, err := client.Open(remote)
+	require.NoError(t, err)
+	defer remoteFile.Close()
+	stat, err := remoteFile.Stat()
+	require.NoError(t, err)
+
+	s := NewSFTPTransfer(&TransferConfig{Method: "delta", PreservePermissions: true})
+	var message string
+	s.SetProgressCallback(func(info ProgressInfo) {
+		if info.Message != "" {
+			message = info.Message
+		}
+	})
+	runner := &localRunner{}
+	require.NoError(t, s.pullDelta(context.Background(), runner, remoteFile, stat, remote, local))
+
+	got, err := os.ReadFile(local)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	assert.True(t, strings.HasPrefix(message, "Delta transfer of "+remote+" received "), message)
+	assert.NoFileExists(t, local+AtomicSuffix)
+}
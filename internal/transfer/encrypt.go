@@ -0,0 +1,337 @@
+// Package transfer - Client-side encryption of transferred files
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/pkg/sftp"
+)
+
+// Encryption schemes
+const (
+	EncryptionAge = "age"
+	EncryptionGPG = "gpg"
+)
+
+// Encryption encrypts files before upload and decrypts them after retrieval
+// so remote hosts only ever store ciphertext
+type Encryption struct {
+	// Scheme is the encryption scheme (age, gpg)
+	Scheme string
+
+	// Arg is the age recipients or identity file, or the gpg recipient
+	Arg string
+}
+
+// ParseEncryption parses a --encrypt/--decrypt value such as
+// "age:recipients.txt", "gpg:alice@example.com" or "gpg"
+func ParseEncryption(spec string) (*Encryption, error) {
+	scheme, arg, _ := strings.Cut(spec, ":")
+
+	switch scheme {
+	case EncryptionAge:
+		if arg == "" {
+			return nil, fmt.Errorf("age requires a key file (age:<file>)")
+		}
+		return &Encryption{Scheme: scheme, Arg: arg}, nil
+	case EncryptionGPG:
+		if _, err := exec.LookPath("gpg"); err != nil {
+			return nil, fmt.Errorf("gpg not found in PATH")
+		}
+		return &Encryption{Scheme: scheme, Arg: arg}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encryption scheme %q (use age:<file> or gpg[:<recipient>])", scheme)
+	}
+}
+
+// Suffix returns the file name suffix of encrypted files
+func (e *Encryption) Suffix() string {
+	return "." + e.Scheme
+}
+
+// EncryptTree encrypts the file or directory at src into stagingDir,
+// mirroring its layout with the scheme suffix appended to file names
+// Returns the staged path to upload in place of src
+func (e *Encryption) EncryptTree(ctx context.Context, src, stagingDir string) (string, error) {
+	var recipients []age.Recipient
+	if e.Scheme == EncryptionAge {
+		var err error
+		if recipients, err = loadAgeRecipients(e.Arg); err != nil {
+			return "", err
+		}
+	}
+
+	src = filepath.Clean(src)
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	encrypt := func(in, out string) error {
+		if e.Scheme == EncryptionGPG {
+			return e.runGPG(ctx, "--encrypt", in, out)
+		}
+		return ageEncryptFile(in, out, recipients)
+	}
+
+	if !info.IsDir() {
+		staged := filepath.Join(stagingDir, filepath.Base(src)+e.Suffix())
+		return staged, encrypt(src, staged)
+	}
+
+	staged := filepath.Join(stagingDir, filepath.Base(src))
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(staged, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0700)
+		case d.Type().IsRegular():
+			return encrypt(path, target+e.Suffix())
+		default:
+			// Symlinks and special files have no content to protect
+			return nil
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", src, err)
+	}
+
+	return staged, nil
+}
+
+// DecryptFiles decrypts the files with the scheme suffix among files, e.g.
+// those a pull wrote (see PulledFiles), replacing the ciphertext with the
+// plaintext. Other files are left alone, and a file whose plaintext name
+// already exists is refused rather than overwritten.
+// Returns the number of files decrypted
+func (e *Encryption) DecryptFiles(ctx context.Context, files []string) (int, error) {
+	var identities []age.Identity
+	if e.Scheme == EncryptionAge {
+		var err error
+		if identities, err = loadAgeIdentities(e.Arg); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if !strings.HasSuffix(name, e.Suffix()) {
+			continue
+		}
+		if info, err := os.Lstat(name); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		plain := strings.TrimSuffix(name, e.Suffix())
+		if _, err := os.Lstat(plain); err == nil {
+			return count, fmt.Errorf("refusing to decrypt %s: %s already exists", name, plain)
+		}
+
+		var err error
+		if e.Scheme == EncryptionGPG {
+			err = e.runGPG(ctx, "--decrypt", name, plain)
+		} else {
+			err = ageDecryptFile(name, plain, identities)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+
+		count++
+		if err := os.Remove(name); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// PulledFiles returns the local paths of the regular files a pull of cfg
+// wrote, from a listing of the remote source over SFTP
+func PulledFiles(ctx context.Context, cfg *TransferConfig) ([]string, error) {
+	if cfg.SSHClient == nil || !cfg.SSHClient.IsConnected() {
+		return nil, fmt.Errorf("not connected to list the pulled files")
+	}
+	client, err := sftp.NewClient(cfg.SSHClient.GetClient())
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	defer client.Close()
+
+	var files []string
+	err = transferredFiles(ctx, cfg, client, func(pair verifyPair) error {
+		files = append(files, pair.local)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pulled files: %w", err)
+	}
+	return files, nil
+}
+
+// runGPG encrypts or decrypts in to out with the gpg binary
+func (e *Encryption) runGPG(ctx context.Context, mode, in, out string) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0700); err != nil {
+		return err
+	}
+
+	args := []string{"--batch", "--yes", "--quiet", mode, "--output", out}
+	if mode == "--encrypt" && e.Arg != "" {
+		args = append(args, "--recipient", e.Arg)
+	}
+	args = append(args, "--", in)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "gpg", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("gpg failed on %s: %w: %s", in, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// ageEncryptFile encrypts in to out for the given recipients
+func ageEncryptFile(in, out string, recipients []age.Recipient) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return writeFile(out, func(w io.Writer) error {
+		enc, err := age.Encrypt(w, recipients...)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(enc, src); err != nil {
+			return err
+		}
+		return enc.Close()
+	})
+}
+
+// ageDecryptFile decrypts in to out with the given identities
+func ageDecryptFile(in, out string, identities []age.Identity) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dec, err := age.Decrypt(bufio.NewReader(src), identities...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+
+	return writeFile(out, func(w io.Writer) error {
+		_, err := io.Copy(w, dec)
+		return err
+	})
+}
+
+// writeFile creates out with owner-only permissions and fills it with fill,
+// removing it again if fill fails. An existing out is never overwritten.
+func writeFile(out string, fill func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := fill(f); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+
+	return f.Close()
+}
+
+// loadAgeRecipients reads age (age1...) and SSH public key recipients, one
+// per line
+func loadAgeRecipients(path string) ([]age.Recipient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	var recipients []age.Recipient
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r age.Recipient
+		if strings.HasPrefix(line, "age1") {
+			r, err = age.ParseX25519Recipient(line)
+		} else {
+			r, err = agessh.ParseRecipient(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient in %s: %w", path, err)
+		}
+		recipients = append(recipients, r)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients in %s", path)
+	}
+
+	return recipients, nil
+}
+
+// loadAgeIdentities reads an age identity file or an unencrypted SSH
+// private key
+func loadAgeIdentities(path string) ([]age.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+
+	if bytes.Contains(data, []byte("PRIVATE KEY")) {
+		identity, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH identity in %s: %w", path, err)
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity in %s: %w", path, err)
+	}
+
+	return identities, nil
+}
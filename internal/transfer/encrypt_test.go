@@ -0,0 +1,87 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEncryption(t *testing.T) {
+	enc, err := ParseEncryption("age:recipients.txt")
+	require.NoError(t, err)
+	assert.Equal(t, EncryptionAge, enc.Scheme)
+	assert.Equal(t, "recipients.txt", enc.Arg)
+	assert.Equal(t, ".age", enc.Suffix())
+
+	_, err = ParseEncryption("age")
+	assert.Error(t, err)
+
+	_, err = ParseEncryption("rot13:key")
+	assert.Error(t, err)
+}
+
+func TestAgeEncryptDecryptTree(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	keys := t.TempDir()
+	recipientsFile := filepath.Join(keys, "recipients.txt")
+	identityFile := filepath.Join(keys, "identity.txt")
+	require.NoError(t, os.WriteFile(recipientsFile, []byte("# backup key\n"+identity.Recipient().String()+"\n"), 0600))
+	require.NoError(t, os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600))
+
+	src := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "css"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "index.html"), []byte("<h1>hi</h1>"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "css", "main.css"), []byte("body{}"), 0644))
+
+	ctx := context.Background()
+	staging := t.TempDir()
+
+	staged, err := (&Encryption{Scheme: EncryptionAge, Arg: recipientsFile}).EncryptTree(ctx, src, staging)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(staging, "site"), staged)
+
+	ciphertext, err := os.ReadFile(filepath.Join(staged, "index.html.age"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "<h1>hi</h1>")
+	assert.FileExists(t, filepath.Join(staged, "css", "main.css.age"))
+
+	// Ciphertext that was already there is not among the files decrypted
+	other := filepath.Join(staged, "old.txt.age")
+	require.NoError(t, os.WriteFile(other, []byte("not ours"), 0600))
+	files := []string{filepath.Join(staged, "index.html.age"), filepath.Join(staged, "css", "main.css.age")}
+
+	decryption := &Encryption{Scheme: EncryptionAge, Arg: identityFile}
+	count, err := decryption.DecryptFiles(ctx, files)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	plain, err := os.ReadFile(filepath.Join(staged, "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "<h1>hi</h1>", string(plain))
+	assert.NoFileExists(t, filepath.Join(staged, "index.html.age"))
+	assert.FileExists(t, other)
+
+	// An existing plaintext file is never overwritten
+	_, err = (&Encryption{Scheme: EncryptionAge, Arg: recipientsFile}).EncryptTree(ctx, filepath.Join(src, "index.html"), filepath.Join(staged, "again"))
+	require.NoError(t, err)
+	again := filepath.Join(staged, "again", "index.html.age")
+	require.NoError(t, os.WriteFile(filepath.Join(staged, "again", "index.html"), []byte("keep me"), 0644))
+	_, err = decryption.DecryptFiles(ctx, []string{again})
+	assert.ErrorContains(t, err, "already exists")
+	kept, err := os.ReadFile(filepath.Join(staged, "again", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "keep me", string(kept))
+	assert.FileExists(t, again)
+
+	// Single files are staged with the suffix appended
+	staged, err = (&Encryption{Scheme: EncryptionAge, Arg: recipientsFile}).EncryptTree(ctx, filepath.Join(src, "index.html"), staging)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(staging, "index.html.age"), staged)
+}
@@ -0,0 +1,161 @@
+// Package transfer - Exclude and include patterns
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pathFilter decides which files of a directory transfer are copied where
+// rsync's --exclude and --include are not available (SFTP, size checks,
+// scans and verification), matching patterns like rsync does
+type pathFilter struct {
+	excludes []pathPattern
+	includes []pathPattern
+}
+
+// newPathFilter compiles exclude and include patterns. With include
+// patterns, only files matching one of them are copied.
+func newPathFilter(excludes, includes []string) *pathFilter {
+	return &pathFilter{excludes: compilePatterns(excludes), includes: compilePatterns(includes)}
+}
+
+// filter returns the transfer's exclude and include filter
+func (cfg *TransferConfig) filter() *pathFilter {
+	return newPathFilter(cfg.ExcludePatterns, cfg.IncludePatterns)
+}
+
+// skip reports whether a source-relative, slash-separated path is left
+// out: if it matches an exclude pattern, or if it is a file matching none
+// of the include patterns. Directories are only skipped by excludes, so
+// included files below them are still found.
+func (f *pathFilter) skip(rel string, isDir bool) bool {
+	for _, p := range f.excludes {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+	if len(f.includes) == 0 || isDir {
+		return false
+	}
+	for _, p := range f.includes {
+		if p.match(rel, isDir) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathPattern is a compiled rsync-style pattern
+type pathPattern struct {
+	re *regexp.Regexp
+
+	// dirOnly patterns end in / and only match directories
+	dirOnly bool
+
+	// anchored patterns start with / and match from the transfer root
+	anchored bool
+
+	// hasSlash patterns, which contain a / or **, match the path (or its
+	// trailing components), the others only the file name
+	hasSlash bool
+}
+
+// compilePatterns compiles patterns, skipping empty and malformed ones
+func compilePatterns(patterns []string) []pathPattern {
+	var compiled []pathPattern
+	for _, pattern := range patterns {
+		p := pathPattern{}
+		if trimmed := strings.TrimSuffix(pattern, "/"); trimmed != pattern {
+			p.dirOnly = true
+			pattern = trimmed
+		}
+		if trimmed := strings.TrimPrefix(pattern, "/"); trimmed != pattern {
+			p.anchored = true
+			pattern = trimmed
+		}
+		if pattern == "" {
+			continue
+		}
+		p.hasSlash = p.anchored || strings.Contains(pattern, "/") || strings.Contains(pattern, "**")
+
+		// A trailing /*** matches the directory as well as everything in it
+		expr := globToRegexp(pattern)
+		if dir, ok := strings.CutSuffix(pattern, "/***"); ok && dir != "" {
+			expr = globToRegexp(dir) + "(/.*)?"
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			continue
+		}
+		p.re = re
+		compiled = append(compiled, p)
+	}
+	return compiled
+}
+
+// match reports whether the pattern matches a source-relative path
+func (p pathPattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.hasSlash {
+		return p.re.MatchString(path.Base(rel))
+	}
+	if p.re.MatchString(rel) {
+		return true
+	}
+	if p.anchored {
+		return false
+	}
+
+	// Unanchored patterns may match the trailing components of the path
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' && p.re.MatchString(rel[i+1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp translates an rsync wildcard pattern into a regular
+// expression: * matches within a path component, ** across components, ?
+// one character other than /, and [...] a character class
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
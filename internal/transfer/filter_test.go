@@ -0,0 +1,86 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "app.log", false, true},
+		{"*.log", "var/log/app.log", false, true},
+		{"*.log", "app.log.1", false, false},
+		{"node_modules", "web/node_modules", true, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"/dist", "dist", true, true},
+		{"/dist", "web/dist", true, false},
+		{"docs/*.md", "docs/index.md", false, true},
+		{"docs/*.md", "site/docs/index.md", false, true},
+		{"docs/*.md", "docs/api/index.md", false, false},
+		{"docs/**.md", "docs/api/index.md", false, true},
+		{"**/testdata", "pkg/a/testdata", true, true},
+		{"tmp**", "web/tmp/cache/x", false, true},
+		{"tmp**", "web/tmp", true, true},
+		{"/tmp**", "web/tmp/x", false, false},
+		{"cache/**", "cache/a/b", false, true},
+		{"cache/**", "cache", true, false},
+		{"cache/***", "cache", true, true},
+		{"cache/***", "web/cache/a/b", false, true},
+		{"cache/***", "cachex", true, false},
+		{"file?.txt", "file1.txt", false, true},
+		{"file?.txt", "file10.txt", false, false},
+		{"[ab]*.conf", "app.conf", false, true},
+		{"[!ab]*.conf", "app.conf", false, false},
+		{"a\\*b", "a*b", false, true},
+		{"a\\*b", "axb", false, false},
+	}
+
+	for _, tt := range tests {
+		patterns := compilePatterns([]string{tt.pattern})
+		require.Len(t, patterns, 1, tt.pattern)
+		assert.Equal(t, tt.want, patterns[0].match(tt.rel, tt.isDir), "%s ~ %s", tt.pattern, tt.rel)
+	}
+}
+
+func TestPathFilterSkip(t *testing.T) {
+	f := newPathFilter([]string{"vendor"}, []string{"*.go", "/go.mod"})
+
+	assert.False(t, f.skip("main.go", false))
+	assert.False(t, f.skip("pkg/util.go", false))
+	assert.False(t, f.skip("go.mod", false))
+	assert.True(t, f.skip("pkg/go.mod", false), "anchored include")
+	assert.True(t, f.skip("README.md", false))
+	assert.False(t, f.skip("pkg", true), "directories are traversed for includes")
+	assert.True(t, f.skip("vendor", true), "excludes take precedence")
+
+	assert.False(t, newPathFilter(nil, nil).skip("anything", false))
+}
+
+func TestSFTPPushDirectoryIncludes(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"main.go", "README.md", "pkg/util.go", "pkg/notes.txt", "vendor/dep/dep.go"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), 0644))
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	s := NewSFTPTransfer(&TransferConfig{ExcludePatterns: []string{"vendor/"}, IncludePatterns: []string{"*.go"}})
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest))
+
+	assert.FileExists(t, filepath.Join(dest, "main.go"))
+	assert.FileExists(t, filepath.Join(dest, "pkg", "util.go"))
+	assert.NoFileExists(t, filepath.Join(dest, "README.md"))
+	assert.NoFileExists(t, filepath.Join(dest, "pkg", "notes.txt"))
+	assert.NoDirExists(t, filepath.Join(dest, "vendor"))
+}
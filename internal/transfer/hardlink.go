@@ -0,0 +1,109 @@
+// Package transfer - Hard link preservation
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// hardlinkExtension is the OpenSSH SFTP extension for creating hard links
+const hardlinkExtension = "hardlink@openssh.com"
+
+// hardLinks remembers the destination of the first transferred link of
+// every multiply-linked file, keyed by its device and inode, so later links
+// to the same file are recreated instead of copied again
+type hardLinks map[string]string
+
+// link returns the destination an earlier link of key was transferred to,
+// recording dest as that destination if key has not been seen yet
+func (h hardLinks) link(key, dest string) (string, bool) {
+	if first, ok := h[key]; ok {
+		return first, true
+	}
+	h[key] = dest
+	return "", false
+}
+
+// remoteHardLinks lists the regular files below remoteRoot that have more
+// than one link, mapping each path relative to remoteRoot to its
+// device:inode key. SFTP does not report inodes, so this runs find on the
+// remote host.
+func remoteHardLinks(ctx context.Context, runner CommandRunner, remoteRoot string) (map[string]string, error) {
+	command := fmt.Sprintf("find %s -type f -links +1 -printf '%%D:%%i %%P\\0'", quoteRemoteShellArg(remoteRoot))
+	output, err := runner.RunCommand(ctx, command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hard links on the remote host (preserve_hard_links needs GNU find): %w", err)
+	}
+	return parseHardLinks(output), nil
+}
+
+// parseHardLinks parses NUL-terminated "device:inode path" records
+func parseHardLinks(output string) map[string]string {
+	links := make(map[string]string)
+	for _, record := range strings.Split(output, "\x00") {
+		key, name, ok := strings.Cut(record, " ")
+		if ok && name != "" {
+			links[name] = key
+		}
+	}
+	return links
+}
+
+// linkRemote recreates a hard link on the remote host, replacing any
+// existing file at newname. Returns false without error if the server
+// cannot create hard links, so the caller copies the file instead.
+func (s *SFTPTransfer) linkRemote(client *sftp.Client, oldname, newname string) (bool, error) {
+	if _, ok := client.HasExtension(hardlinkExtension); !ok {
+		return false, nil
+	}
+
+	if s.config.DryRun {
+		s.notifyLink(oldname, newname)
+		return true, nil
+	}
+
+	if err := client.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to replace %s: %w", newname, err)
+	}
+	if err := client.Link(oldname, newname); err != nil {
+		return false, fmt.Errorf("failed to link %s to %s: %w", newname, oldname, err)
+	}
+	s.notifyLink(oldname, newname)
+	return true, nil
+}
+
+// linkLocal recreates a hard link locally, replacing any existing file at
+// newname
+func (s *SFTPTransfer) linkLocal(oldname, newname string) error {
+	if s.config.DryRun {
+		s.notifyLink(oldname, newname)
+		return nil
+	}
+
+	if err := os.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace %s: %w", newname, err)
+	}
+	if err := os.Link(oldname, newname); err != nil {
+		return fmt.Errorf("failed to link %s to %s: %w", newname, oldname, err)
+	}
+	s.notifyLink(oldname, newname)
+	return nil
+}
+
+// notifyLink reports a recreated hard link
+func (s *SFTPTransfer) notifyLink(oldname, newname string) {
+	message := fmt.Sprintf("Linked: %s => %s", newname, oldname)
+	if s.config.DryRun {
+		message = fmt.Sprintf("Would link: %s => %s", newname, oldname)
+	}
+	s.notifyProgress(ProgressInfo{
+		Operation:   OperationLink,
+		CurrentFile: newname,
+		Message:     message,
+	})
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+// Package transfer - Hard link detection elsewhere
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import "os"
+
+// localLinkKey reports no hard links where inodes are not available
+func localLinkKey(info os.FileInfo) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,82 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sameFile reports whether two paths are hard links to one file
+func sameFile(t *testing.T, a, b string) bool {
+	infoA, err := os.Stat(a)
+	require.NoError(t, err)
+	infoB, err := os.Stat(b)
+	require.NoError(t, err)
+	return os.SameFile(infoA, infoB)
+}
+
+func newHardLinkTree(t *testing.T) string {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "snapshots", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "data.bin"), []byte("shared"), 0644))
+	require.NoError(t, os.Link(filepath.Join(src, "data.bin"), filepath.Join(src, "snapshots", "b", "data.bin")))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "other.bin"), []byte("shared"), 0644))
+	return src
+}
+
+func TestSFTPPushDirectoryHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard link detection needs inodes")
+	}
+	src := newHardLinkTree(t)
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	s := NewSFTPTransfer(&TransferConfig{PreserveHardLinks: true, NoAtomic: true})
+	linked := 0
+	s.SetProgressCallback(func(info ProgressInfo) {
+		if info.Operation == OperationLink {
+			linked++
+		}
+	})
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest))
+
+	assert.Equal(t, 1, linked)
+	assert.True(t, sameFile(t, filepath.Join(dest, "data.bin"), filepath.Join(dest, "snapshots", "b", "data.bin")))
+	assert.False(t, sameFile(t, filepath.Join(dest, "data.bin"), filepath.Join(dest, "other.bin")))
+
+	// Without the option every link is copied
+	dest = filepath.Join(t.TempDir(), "dest")
+	s = NewSFTPTransfer(&TransferConfig{})
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest))
+	assert.False(t, sameFile(t, filepath.Join(dest, "data.bin"), filepath.Join(dest, "snapshots", "b", "data.bin")))
+}
+
+func TestSFTPPullDirectoryHardLinks(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("remote hard link listing needs GNU find")
+	}
+	src := newHardLinkTree(t)
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	links, err := remoteHardLinks(context.Background(), &localRunner{}, src)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+	assert.Equal(t, links["data.bin"], links["snapshots/b/data.bin"])
+
+	s := NewSFTPTransfer(&TransferConfig{PreserveHardLinks: true})
+	require.NoError(t, s.pullDirectory(context.Background(), newPipeSFTPClient(t), src, dest, links))
+
+	assert.True(t, sameFile(t, filepath.Join(dest, "data.bin"), filepath.Join(dest, "snapshots", "b", "data.bin")))
+	assert.False(t, sameFile(t, filepath.Join(dest, "data.bin"), filepath.Join(dest, "other.bin")))
+}
+
+func TestParseHardLinks(t *testing.T) {
+	links := parseHardLinks("2049:15 a b.txt\x002049:15 dir/c\x00")
+	assert.Equal(t, map[string]string{"a b.txt": "2049:15", "dir/c": "2049:15"}, links)
+	assert.Empty(t, parseHardLinks(""))
+}
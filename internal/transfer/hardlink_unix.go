@@ -0,0 +1,21 @@
+//go:build unix
+
+// Package transfer - Hard link detection on Unix
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// localLinkKey returns the device:inode key of a regular file with more
+// than one link
+func localLinkKey(info os.FileInfo) (string, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() || stat.Nlink < 2 {
+		return "", false
+	}
+	return fmt.Sprintf("%d:%d", uint64(stat.Dev), uint64(stat.Ino)), true
+}
@@ -0,0 +1,297 @@
+// Package transfer - Queues of transfer jobs
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	// JobsDirName is the directory under the XDG state directory holding
+	// each profile's job queue
+	JobsDirName = "jobs"
+
+	// DefaultJobConcurrency is how many jobs of a queue run at once
+	DefaultJobConcurrency = 2
+)
+
+// ErrNoJobQueue reports that a profile has no saved job queue
+var ErrNoJobQueue = errors.New("no job queue")
+
+// JobStatus is the state of a job in its queue
+type JobStatus string
+
+const (
+	// JobPending has not run yet, or was interrupted
+	JobPending JobStatus = "pending"
+
+	// JobRunning is being transferred
+	JobRunning JobStatus = "running"
+
+	// JobDone completed successfully
+	JobDone JobStatus = "done"
+
+	// JobFailed failed and is retried when the queue is resumed
+	JobFailed JobStatus = "failed"
+)
+
+// Job is one source and destination pair of a queue
+type Job struct {
+	ID     int    `json:"id"`
+	Source string `json:"source"`
+
+	// Dest is the destination, or empty for the default destination
+	Dest string `json:"dest,omitempty"`
+
+	Status JobStatus `json:"status"`
+	Error  string    `json:"error,omitempty"`
+
+	// Seconds is how long the last run of the job took
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// JobQueue is a batch of transfers to one profile's host, saved to disk
+// as jobs start and finish so an interrupted batch can be resumed. A queue
+// built directly instead of by NewJobQueue is never saved, as for dry runs.
+type JobQueue struct {
+	path string
+	mu   sync.Mutex
+
+	Profile string    `json:"profile"`
+	Created time.Time `json:"created"`
+	Jobs    []*Job    `json:"jobs"`
+}
+
+// JobQueuePath returns the XDG-compliant path to a profile's job queue.
+// Only the last element of the profile name is used, so it cannot point
+// outside the jobs directory.
+func JobQueuePath(profile string) (string, error) {
+	dir := filepath.Join(xdg.StateHome, "klip", JobsDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+	return filepath.Join(dir, filepath.Base(profile)+".json"), nil
+}
+
+// ParseJobs reads one job per line: a source, optionally followed by a
+// destination. Source and destination are separated by a tab, or by
+// spaces if the line has no tab. Blank lines and lines starting with #
+// are ignored. Jobs are numbered from 1 and pending.
+func ParseJobs(r io.Reader) ([]*Job, error) {
+	var jobs []*Job
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var fields []string
+		if strings.Contains(text, "\t") {
+			for _, field := range strings.Split(text, "\t") {
+				if field = strings.TrimSpace(field); field != "" {
+					fields = append(fields, field)
+				}
+			}
+		} else {
+			fields = strings.Fields(text)
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a source and an optional destination, got %d fields", line, len(fields))
+		}
+
+		job := &Job{ID: len(jobs) + 1, Source: fields[0], Status: JobPending}
+		if len(fields) == 2 {
+			job.Dest = fields[1]
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no jobs given")
+	}
+	return jobs, nil
+}
+
+// NewJobQueue returns a queue of jobs for a profile, saved in place of the
+// profile's previous queue
+func NewJobQueue(profile string, jobs []*Job) (*JobQueue, error) {
+	path, err := JobQueuePath(profile)
+	if err != nil {
+		return nil, err
+	}
+	return &JobQueue{path: path, Profile: profile, Created: time.Now(), Jobs: jobs}, nil
+}
+
+// LoadJobQueue loads a profile's saved job queue, or returns ErrNoJobQueue
+func LoadJobQueue(profile string) (*JobQueue, error) {
+	path, err := JobQueuePath(profile)
+	if err != nil {
+		return nil, err
+	}
+	return LoadJobQueueFile(path)
+}
+
+// LoadJobQueueFile loads the job queue stored at path
+func LoadJobQueueFile(path string) (*JobQueue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoJobQueue
+		}
+		return nil, fmt.Errorf("failed to read job queue: %w", err)
+	}
+
+	q := &JobQueue{path: path}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("failed to parse job queue %s: %w", path, err)
+	}
+	return q, nil
+}
+
+// Unfinished returns the jobs that have not completed successfully
+func (q *JobQueue) Unfinished() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []*Job
+	for _, job := range q.Jobs {
+		if job.Status != JobDone {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// Save writes the queue to disk, replacing the previous file atomically
+func (q *JobQueue) Save() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.save()
+}
+
+// save is Save for callers holding q.mu
+func (q *JobQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal job queue: %w", err)
+	}
+
+	tmpPath := q.path + AtomicSuffix
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write job queue: %w", err)
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write job queue: %w", err)
+	}
+
+	return nil
+}
+
+// Remove deletes the saved queue, once every job has completed
+func (q *JobQueue) Remove() error {
+	if q.path == "" {
+		return nil
+	}
+	if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove job queue: %w", err)
+	}
+	return nil
+}
+
+// Run runs the unfinished jobs of the queue with run, up to concurrency at
+// once, saving the queue as each job starts and finishes. A failed job
+// does not stop the others. Jobs still running when ctx is cancelled
+// are marked pending again, so resuming the queue runs them from the start.
+func (q *JobQueue) Run(ctx context.Context, concurrency int, run func(ctx context.Context, job *Job) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := q.Unfinished()
+	queue := make(chan *Job)
+	var wg sync.WaitGroup
+	var saveErr error
+	var failed int
+
+	// setStatus records a job's progress; callers must not hold q.mu
+	setStatus := func(job *Job, status JobStatus, err error, elapsed time.Duration) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		job.Status = status
+		job.Error = ""
+		if err != nil {
+			job.Error = err.Error()
+		}
+		if elapsed > 0 {
+			job.Seconds = elapsed.Seconds()
+		}
+		if status == JobFailed {
+			failed++
+		}
+		if err := q.save(); err != nil && saveErr == nil {
+			saveErr = err
+		}
+	}
+
+	for i := 0; i < min(concurrency, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				setStatus(job, JobRunning, nil, 0)
+				start := time.Now()
+				err := run(ctx, job)
+				switch {
+				case ctx.Err() != nil:
+					setStatus(job, JobPending, nil, 0)
+				case err != nil:
+					setStatus(job, JobFailed, err, time.Since(start))
+				default:
+					setStatus(job, JobDone, nil, time.Since(start))
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case saveErr != nil:
+		return saveErr
+	case failed > 0:
+		return fmt.Errorf("%d of %d jobs failed", failed, len(jobs))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJobs(t *testing.T) {
+	jobs, err := ParseJobs(strings.NewReader(`# nightly uploads
+./logs  /var/log/archive
+
+./site
+My Documents/report.pdf	/srv/reports/
+`))
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	assert.Equal(t, Job{ID: 1, Source: "./logs", Dest: "/var/log/archive", Status: JobPending}, *jobs[0])
+	assert.Equal(t, Job{ID: 2, Source: "./site", Status: JobPending}, *jobs[1])
+	assert.Equal(t, Job{ID: 3, Source: "My Documents/report.pdf", Dest: "/srv/reports/", Status: JobPending}, *jobs[2])
+
+	_, err = ParseJobs(strings.NewReader("a b c\n"))
+	assert.ErrorContains(t, err, "line 1")
+
+	_, err = ParseJobs(strings.NewReader("# nothing\n\n"))
+	assert.Error(t, err)
+}
+
+// newTestQueue returns a queue of jobs for the given sources stored in a
+// temporary directory
+func newTestQueue(t *testing.T, sources ...string) *JobQueue {
+	jobs, err := ParseJobs(strings.NewReader(strings.Join(sources, "\n")))
+	require.NoError(t, err)
+	return &JobQueue{path: filepath.Join(t.TempDir(), "work.json"), Profile: "work", Jobs: jobs}
+}
+
+func TestJobQueueRun(t *testing.T) {
+	t.Run("runs every job with bounded concurrency", func(t *testing.T) {
+		q := newTestQueue(t, "a", "b", "c", "d", "e")
+		var running, peak int32
+		err := q.Run(context.Background(), 2, func(ctx context.Context, job *Job) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			defer atomic.AddInt32(&running, -1)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, peak, int32(2))
+		assert.Empty(t, q.Unfinished())
+	})
+
+	t.Run("failed jobs do not stop the others", func(t *testing.T) {
+		q := newTestQueue(t, "a", "b", "c")
+		err := q.Run(context.Background(), 1, func(ctx context.Context, job *Job) error {
+			if job.Source == "b" {
+				return errors.New("permission denied")
+			}
+			return nil
+		})
+		require.EqualError(t, err, "1 of 3 jobs failed")
+		assert.Equal(t, JobDone, q.Jobs[0].Status)
+		assert.Equal(t, JobFailed, q.Jobs[1].Status)
+		assert.Equal(t, "permission denied", q.Jobs[1].Error)
+		assert.Equal(t, JobDone, q.Jobs[2].Status)
+
+		// The saved queue resumes with the failed job only
+		loaded, err := LoadJobQueueFile(q.path)
+		require.NoError(t, err)
+		unfinished := loaded.Unfinished()
+		require.Len(t, unfinished, 1)
+		assert.Equal(t, "b", unfinished[0].Source)
+
+		var ran []string
+		require.NoError(t, loaded.Run(context.Background(), 2, func(ctx context.Context, job *Job) error {
+			ran = append(ran, job.Source)
+			return nil
+		}))
+		assert.Equal(t, []string{"b"}, ran)
+		assert.Empty(t, loaded.Jobs[1].Error)
+	})
+
+	t.Run("interrupted jobs are pending again", func(t *testing.T) {
+		q := newTestQueue(t, "a", "b", "c")
+		ctx, cancel := context.WithCancel(context.Background())
+		var once sync.Once
+		err := q.Run(ctx, 1, func(ctx context.Context, job *Job) error {
+			if job.Source == "a" {
+				return nil
+			}
+			once.Do(cancel)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		require.ErrorIs(t, err, context.Canceled)
+
+		loaded, err := LoadJobQueueFile(q.path)
+		require.NoError(t, err)
+		assert.Equal(t, JobDone, loaded.Jobs[0].Status)
+		assert.Equal(t, JobPending, loaded.Jobs[1].Status)
+		assert.Equal(t, JobPending, loaded.Jobs[2].Status)
+	})
+}
+
+func TestJobQueueRemove(t *testing.T) {
+	q := newTestQueue(t, "a")
+	require.NoError(t, q.Save())
+	require.NoError(t, q.Remove())
+
+	_, err := LoadJobQueueFile(q.path)
+	assert.ErrorIs(t, err, ErrNoJobQueue)
+	assert.NoError(t, q.Remove())
+}
+
+func TestJobQueuePath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+	dir := filepath.Join(xdg.StateHome, "klip", JobsDirName)
+
+	path, err := JobQueuePath("work")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "work.json"), path)
+
+	// A name with path separators stays inside the jobs directory
+	for _, profile := range []string{"../../config/klip/config", "/etc/passwd", "a/b"} {
+		path, err := JobQueuePath(profile)
+		require.NoError(t, err)
+		assert.Equal(t, dir, filepath.Dir(path), profile)
+	}
+}
@@ -0,0 +1,160 @@
+// Package transfer - Transfer size guardrails
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// errLimitReached stops a source walk once every limit is exceeded
+var errLimitReached = errors.New("limit reached")
+
+// SourceSize is the number of files and bytes a transfer would copy
+type SourceSize struct {
+	Files int
+	Bytes int64
+
+	// Partial is true if counting stopped early because every limit was
+	// already exceeded, so the real size is larger
+	Partial bool
+}
+
+// HasLimits reports whether the transfer has a file count or size limit
+func (cfg *TransferConfig) HasLimits() bool {
+	return cfg.MaxFiles > 0 || cfg.MaxTotalSize > 0
+}
+
+// CheckLimits measures the transfer source and describes each limit it
+// exceeds. Empty if the transfer is within its limits or has none.
+// Exclude patterns are matched against file names and relative paths, an
+// approximation of rsync's filter rules.
+func CheckLimits(ctx context.Context, cfg *TransferConfig) ([]string, *SourceSize, error) {
+	if !cfg.HasLimits() {
+		return nil, nil, nil
+	}
+
+	size, err := measureSource(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg.ExceededBy(size), size, nil
+}
+
+// ExceededBy describes each limit of the transfer that size exceeds
+func (cfg *TransferConfig) ExceededBy(size *SourceSize) []string {
+	atLeast := ""
+	if size.Partial {
+		atLeast = "at least "
+	}
+
+	var exceeded []string
+	if cfg.MaxFiles > 0 && size.Files > cfg.MaxFiles {
+		exceeded = append(exceeded, fmt.Sprintf("copy %s%d files (max_files is %d)", atLeast, size.Files, cfg.MaxFiles))
+	}
+	if cfg.MaxTotalSize > 0 && size.Bytes > cfg.MaxTotalSize {
+		exceeded = append(exceeded, fmt.Sprintf("copy %s%s (max_total_size is %s)",
+			atLeast, FormatBytes(size.Bytes), FormatBytes(cfg.MaxTotalSize)))
+	}
+	return exceeded
+}
+
+// MeasureFiles counts the given local files and their bytes, for limits on
+// uploads of some files of a directory
+func MeasureFiles(files []string) (*SourceSize, error) {
+	size := &SourceSize{}
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure %s: %w", name, err)
+		}
+		if info.Mode().IsRegular() {
+			size.Files++
+			size.Bytes += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// measureSource counts the files and bytes below the transfer source,
+// walking the local or the remote side
+func measureSource(ctx context.Context, cfg *TransferConfig) (*SourceSize, error) {
+	size := &SourceSize{}
+	filter := cfg.filter()
+
+	add := func(rel string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if rel != "." && filter.skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		size.Files++
+		size.Bytes += info.Size()
+
+		filesOver := cfg.MaxFiles == 0 || size.Files > cfg.MaxFiles
+		bytesOver := cfg.MaxTotalSize == 0 || size.Bytes > cfg.MaxTotalSize
+		if filesOver && bytesOver {
+			size.Partial = true
+			return errLimitReached
+		}
+		return nil
+	}
+
+	var err error
+	if cfg.Direction == DirectionPush {
+		root := filepath.Clean(cfg.SourcePath)
+		err = walkTree(ctx, localFS, root, func(name string, info fs.FileInfo) error {
+			rel, err := filepath.Rel(root, name)
+			if err != nil {
+				return err
+			}
+			return add(filepath.ToSlash(rel), info)
+		})
+	} else {
+		err = measureRemote(ctx, cfg, add)
+	}
+
+	if err != nil && !errors.Is(err, errLimitReached) {
+		return nil, fmt.Errorf("failed to measure transfer source: %w", err)
+	}
+
+	return size, nil
+}
+
+// measureRemote walks the remote transfer source over SFTP
+func measureRemote(ctx context.Context, cfg *TransferConfig, add func(rel string, info fs.FileInfo) error) error {
+	if cfg.SSHClient == nil || !cfg.SSHClient.IsConnected() {
+		return fmt.Errorf("SSH client not connected")
+	}
+
+	client, err := sftp.NewClient(cfg.SSHClient.GetClient())
+	if err != nil {
+		return fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer client.Close()
+
+	root := path.Clean(toUnixPath(cfg.SourcePath))
+	return walkTree(ctx, remoteFS(client), root, func(name string, info fs.FileInfo) error {
+		rel := "."
+		if name != root {
+			rel = strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+		}
+		return add(rel, info)
+	})
+}
@@ -0,0 +1,52 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLimits(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "node_modules", "pkg"), 0755))
+	for _, name := range []string{"a.txt", "b.txt", "c.log", "node_modules/pkg/index.js"} {
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), make([]byte, 1024), 0644))
+	}
+
+	tests := []struct {
+		name     string
+		cfg      TransferConfig
+		exceeded int
+		files    int
+		partial  bool
+	}{
+		{"no limits", TransferConfig{}, 0, 0, false},
+		{"within limits", TransferConfig{MaxFiles: 10, MaxTotalSize: 1 << 20}, 0, 4, false},
+		{"too many files", TransferConfig{MaxFiles: 2}, 1, 3, true},
+		{"too large", TransferConfig{MaxTotalSize: 2048}, 1, 3, true},
+		{"files over, size within", TransferConfig{MaxFiles: 2, MaxTotalSize: 1 << 20}, 1, 4, false},
+		{"excluded files not counted", TransferConfig{MaxFiles: 2, ExcludePatterns: []string{"*.log", "node_modules"}}, 0, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.SourcePath = src
+			cfg.Direction = DirectionPush
+
+			exceeded, size, err := CheckLimits(context.Background(), &cfg)
+			require.NoError(t, err)
+			assert.Len(t, exceeded, tt.exceeded)
+			if !cfg.HasLimits() {
+				assert.Nil(t, size)
+				return
+			}
+			assert.Equal(t, tt.files, size.Files)
+			assert.Equal(t, tt.partial, size.Partial)
+		})
+	}
+}
@@ -0,0 +1,448 @@
+// Package transfer - Multipath transfers striped across several connections
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/pkg/sftp"
+)
+
+// MultipathChunkSize is the size of the chunks striped across paths
+const MultipathChunkSize = 8 * 1024 * 1024
+
+// SegmentMinSize is the smallest file split into segments with
+// TransferConfig.Segments; smaller files gain little over one stream
+const SegmentMinSize = 4 * MultipathChunkSize
+
+// MultipathTransfer copies a single large file over several SSH connections
+// to the same host (e.g., via LAN and Tailscale), and over Segments
+// concurrent SFTP streams on each, at once. Chunks are handed out from a
+// shared queue so faster paths carry more of the data, and the reassembled
+// file is verified with a SHA-256 checksum.
+type MultipathTransfer struct {
+	config           *TransferConfig
+	progressCallback ProgressCallback
+	mu               sync.Mutex
+}
+
+// NewMultipathTransfer creates a new multipath transfer
+// cfg.SSHClient and cfg.MultipathClients are the paths to stripe across
+func NewMultipathTransfer(cfg *TransferConfig) *MultipathTransfer {
+	return &MultipathTransfer{
+		config: cfg,
+	}
+}
+
+// SetProgressCallback sets the progress callback
+func (m *MultipathTransfer) SetProgressCallback(callback ProgressCallback) {
+	m.progressCallback = callback
+}
+
+// Execute performs the multipath transfer
+func (m *MultipathTransfer) Execute(ctx context.Context) error {
+	clients := append([]*ssh.Client{m.config.SSHClient}, m.config.MultipathClients...)
+
+	sftpClients := make([]*sftp.Client, 0, len(clients))
+	defer func() {
+		for _, c := range sftpClients {
+			c.Close()
+		}
+	}()
+	for _, client := range clients {
+		if client == nil || !client.IsConnected() {
+			return fmt.Errorf("SSH client not connected")
+		}
+		c, err := sftp.NewClient(client.GetClient())
+		if err != nil {
+			return fmt.Errorf("failed to create SFTP client: %w", err)
+		}
+		sftpClients = append(sftpClients, c)
+	}
+
+	if err := checkRemotePaths(sftpClients[0], m.config); err != nil {
+		return err
+	}
+
+	if m.config.Direction == DirectionPush {
+		return m.push(ctx, sftpClients)
+	}
+	return m.pull(ctx, sftpClients)
+}
+
+// push stripes a local file to the remote host
+func (m *MultipathTransfer) push(ctx context.Context, clients []*sftp.Client) error {
+	localPath := m.config.SourcePath
+	remotePath := toUnixPath(m.config.DestPath)
+	if info, err := clients[0].Stat(remotePath); err == nil && info.IsDir() {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+
+	if m.config.DryRun {
+		m.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
+			CurrentFile: localPath,
+			Message:     fmt.Sprintf("Would transfer over %s: %s -> %s", m.describeStreams(len(clients)), localPath, remotePath),
+		})
+		return nil
+	}
+
+	local, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer local.Close()
+
+	stat, err := local.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+
+	if err := clients[0].MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	// Upload under a temporary name or into the staging directory so
+	// consumers never see a partial file
+	target := m.config.remoteTemp(remotePath)
+	if m.config.StagingDir != "" {
+		if err := clients[0].MkdirAll(path.Dir(target)); err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+
+	hashes, err := m.pushTo(ctx, clients, local, stat.Size(), target)
+	if rules := m.config.chmodRules(); err == nil && rules != nil {
+		if err = clients[0].Chmod(target, rules.Apply(stat.Mode(), false)); err != nil {
+			err = fmt.Errorf("failed to set permissions on %s: %w", target, err)
+		}
+	}
+	if err != nil {
+		if target != remotePath {
+			clients[0].Remove(target)
+		}
+		return err
+	}
+
+	if target != remotePath {
+		if err := moveRemote(ctx, m.config.runner(), clients[0], target, remotePath); err != nil {
+			return err
+		}
+	}
+	if m.config.Chown != "" {
+		if err := chownRemote(ctx, m.config.runner(), m.config.Chown, remotePath, chownCommand(m.config.Chown, false, remotePath)); err != nil {
+			return err
+		}
+	}
+	if hashes != nil {
+		m.recordChunks(clients[0], remotePath, hashes)
+	}
+	return nil
+}
+
+// pushTo stripes local to remotePath and verifies the result. With a
+// chunk cache, chunks already on the remote host are copied there instead
+// of sent, and the file's chunk hashes are returned for the cache.
+func (m *MultipathTransfer) pushTo(ctx context.Context, clients []*sftp.Client, local *os.File, size int64, remotePath string) ([]string, error) {
+	remote, err := clients[0].Create(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote file: %w", err)
+	}
+	err = remote.Truncate(size)
+	remote.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to size remote file: %w", err)
+	}
+
+	var hashes []string
+	var reused []reusedChunk
+	offsets := chunkOffsets(size)
+	if m.config.ChunkCache != nil {
+		if hashes, err = chunkHashes(local, size); err != nil {
+			return nil, err
+		}
+		reused = planReuse(clients[0], m.config.ChunkCache, hashes, remotePath)
+		if err := copyReusedChunks(ctx, m.config.runner(), reused, remotePath); err != nil {
+			m.notifyProgress(ProgressInfo{Message: fmt.Sprintf("%v; sending the whole file", err)})
+			reused = nil
+		} else if len(reused) > 0 {
+			m.notifyProgress(ProgressInfo{Message: fmt.Sprintf("Reusing %d of %d chunks already on the remote host", len(reused), len(hashes))})
+		}
+		offsets = missingOffsets(size, reused)
+	}
+
+	open := func(c *sftp.Client) (io.ReaderAt, io.WriterAt, func(), error) {
+		f, err := c.OpenFile(remotePath, os.O_WRONLY)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open remote file: %w", err)
+		}
+		return local, f, func() { f.Close() }, nil
+	}
+	if err := m.stripe(ctx, clients, size, local.Name(), offsets, open); err != nil {
+		return nil, err
+	}
+
+	want, err := fileSHA256(local)
+	if err != nil {
+		return nil, err
+	}
+	err = m.verify(ctx, remotePath, want)
+	if err != nil && len(reused) > 0 {
+		// A reused file changed without changing its size or modification
+		// time; forget it and send the reused chunks after all
+		_ = m.config.ChunkCache.Forget(reusedSources(reused)...)
+		m.notifyProgress(ProgressInfo{Message: "Reused chunks did not match, sending them"})
+
+		offsets = make([]int64, len(reused))
+		for i, c := range reused {
+			offsets[i] = c.offset
+		}
+		if err := m.stripe(ctx, clients, size, local.Name(), offsets, open); err != nil {
+			return nil, err
+		}
+		err = m.verify(ctx, remotePath, want)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// recordChunks adds a pushed file's chunk hashes to the chunk cache; a
+// cache that cannot be written only costs the next push its reuse
+func (m *MultipathTransfer) recordChunks(client *sftp.Client, remotePath string, hashes []string) {
+	info, err := client.Stat(remotePath)
+	if err == nil {
+		err = m.config.ChunkCache.Record(remotePath, info.Size(), info.ModTime(), hashes)
+	}
+	if err != nil {
+		m.notifyProgress(ProgressInfo{Message: fmt.Sprintf("Could not update chunk cache: %v", err)})
+	}
+}
+
+// pull stripes a remote file to the local host
+func (m *MultipathTransfer) pull(ctx context.Context, clients []*sftp.Client) error {
+	remotePath := toUnixPath(m.config.SourcePath)
+	localPath := m.config.DestPath
+	if isDirectory(localPath) {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+
+	if m.config.DryRun {
+		m.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
+			CurrentFile: remotePath,
+			Message:     fmt.Sprintf("Would transfer over %s: %s -> %s", m.describeStreams(len(clients)), remotePath, localPath),
+		})
+		return nil
+	}
+
+	stat, err := clients[0].Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat remote file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create local directory: %w", err)
+	}
+
+	// Write into the staging directory first if there is one
+	target := m.config.localTemp(localPath)
+	if target != localPath {
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+
+	if err := m.pullTo(ctx, clients, remotePath, stat.Size(), target); err != nil {
+		if target != localPath {
+			os.Remove(target)
+		}
+		return err
+	}
+
+	if target != localPath {
+		return moveLocal(target, localPath)
+	}
+	return nil
+}
+
+// pullTo stripes remotePath to localPath and verifies the result
+func (m *MultipathTransfer) pullTo(ctx context.Context, clients []*sftp.Client, remotePath string, size int64, localPath string) error {
+	local, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer local.Close()
+
+	if err := local.Truncate(size); err != nil {
+		return fmt.Errorf("failed to size local file: %w", err)
+	}
+
+	err = m.stripe(ctx, clients, size, remotePath, chunkOffsets(size), func(c *sftp.Client) (io.ReaderAt, io.WriterAt, func(), error) {
+		f, err := c.Open(remotePath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open remote file: %w", err)
+		}
+		return f, local, func() { f.Close() }, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	got, err := fileSHA256(local)
+	if err != nil {
+		return err
+	}
+	return m.verify(ctx, remotePath, got)
+}
+
+// openFunc opens the source and destination of a stripe on one path
+type openFunc func(c *sftp.Client) (io.ReaderAt, io.WriterAt, func(), error)
+
+// streams returns the number of concurrent streams per path
+func (m *MultipathTransfer) streams() int {
+	return max(m.config.Segments, 1)
+}
+
+// describeStreams describes the paths and streams of a transfer for humans
+func (m *MultipathTransfer) describeStreams(paths int) string {
+	if m.streams() == 1 {
+		return fmt.Sprintf("%d paths", paths)
+	}
+	if paths == 1 {
+		return fmt.Sprintf("%d segments", m.streams())
+	}
+	return fmt.Sprintf("%d paths with %d segments each", paths, m.streams())
+}
+
+// stripe copies the chunks at offsets of a size-byte file, with streams()
+// workers per path pulling chunks from a shared queue, each with its own
+// file handles. Progress counts the other chunks as already transferred.
+func (m *MultipathTransfer) stripe(ctx context.Context, clients []*sftp.Client, size int64, filename string, offsets []int64, open openFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan int64)
+	go func() {
+		defer close(chunks)
+		for _, offset := range offsets {
+			select {
+			case chunks <- offset:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var transferred atomic.Int64
+	transferred.Store(size)
+	for _, offset := range offsets {
+		transferred.Add(-min(MultipathChunkSize, size-offset))
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(clients)*m.streams())
+
+	for i := 0; i < len(clients)*m.streams(); i++ {
+		src, dst, closeFn, err := open(clients[i%len(clients)])
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer closeFn()
+
+			buf := make([]byte, MultipathChunkSize)
+			for offset := range chunks {
+				n := min(int64(len(buf)), size-offset)
+				if err := copyChunk(dst, src, buf[:n], offset); err != nil {
+					errs <- fmt.Errorf("chunk at offset %d failed: %w", offset, err)
+					cancel()
+					return
+				}
+
+				m.notifyProgress(ProgressInfo{
+					Operation:        OperationTransfer,
+					TotalBytes:       size,
+					TransferredBytes: transferred.Add(n),
+					CurrentFile:      filename,
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// copyChunk copies len(buf) bytes at offset from src to dst
+func copyChunk(dst io.WriterAt, src io.ReaderAt, buf []byte, offset int64) error {
+	if _, err := src.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return err
+	}
+	_, err := dst.WriteAt(buf, offset)
+	return err
+}
+
+// verify compares the remote file's checksum with the local one
+// Hosts without sha256sum or shasum are skipped with a notice
+func (m *MultipathTransfer) verify(ctx context.Context, remotePath, localSum string) error {
+	command := fmt.Sprintf("if command -v sha256sum >/dev/null 2>&1; then sha256sum -- %[1]s; else shasum -a 256 -- %[1]s; fi",
+		quoteRemoteShellArg(remotePath))
+
+	output, err := m.config.SSHClient.RunCommand(ctx, command)
+	if err != nil {
+		m.notifyProgress(ProgressInfo{
+			Message: fmt.Sprintf("Could not verify checksum of %s: %v", remotePath, err),
+		})
+		return nil
+	}
+
+	remoteSum, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(output), `\`), " ")
+	if !strings.EqualFold(remoteSum, localSum) {
+		return fmt.Errorf("checksum mismatch after reassembly: local %s, remote %s", localSum, remoteSum)
+	}
+
+	return nil
+}
+
+// notifyProgress sends progress information to the callback
+// Workers report concurrently, so calls are serialized
+func (m *MultipathTransfer) notifyProgress(info ProgressInfo) {
+	if m.progressCallback == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.progressCallback(info)
+}
+
+// fileSHA256 returns the hex SHA-256 digest of an open file
+func fileSHA256(f *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, 1<<62)); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", f.Name(), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
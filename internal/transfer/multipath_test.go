@@ -0,0 +1,146 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPipeSFTPClient returns an SFTP client served in-process from the local
+// filesystem
+func newPipeSFTPClient(t testing.TB, options ...sftp.ServerOption) *sftp.Client {
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverRead, serverWrite}, options...)
+	require.NoError(t, err)
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientRead, clientWrite)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		serverWrite.Close()
+		client.Close()
+	})
+	return client
+}
+
+func TestMultipathStripe(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 2*MultipathChunkSize+12345)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	remotePath := filepath.Join(dir, "remote.bin")
+	require.NoError(t, os.WriteFile(remotePath, data, 0644))
+
+	local, err := os.Create(filepath.Join(dir, "local.bin"))
+	require.NoError(t, err)
+	defer local.Close()
+
+	clients := []*sftp.Client{newPipeSFTPClient(t), newPipeSFTPClient(t)}
+	var last ProgressInfo
+	m := NewMultipathTransfer(&TransferConfig{})
+	m.SetProgressCallback(func(info ProgressInfo) { last = info })
+
+	err = m.stripe(context.Background(), clients, int64(len(data)), remotePath, chunkOffsets(int64(len(data))), func(c *sftp.Client) (io.ReaderAt, io.WriterAt, func(), error) {
+		f, err := c.Open(remotePath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return f, local, func() { f.Close() }, nil
+	})
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(local.Name())
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+	assert.Equal(t, int64(len(data)), last.TransferredBytes)
+
+	want, err := os.Open(remotePath)
+	require.NoError(t, err)
+	defer want.Close()
+	wantSum, err := fileSHA256(want)
+	require.NoError(t, err)
+	gotSum, err := fileSHA256(local)
+	require.NoError(t, err)
+	assert.Equal(t, wantSum, gotSum)
+}
+
+func TestMultipathStripeSegments(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 3*MultipathChunkSize+678)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	local := filepath.Join(dir, "local.bin")
+	require.NoError(t, os.WriteFile(local, data, 0644))
+	src, err := os.Open(local)
+	require.NoError(t, err)
+	defer src.Close()
+
+	remotePath := filepath.Join(dir, "remote.bin")
+	require.NoError(t, os.WriteFile(remotePath, make([]byte, len(data)), 0644))
+
+	// One connection carries all segments, each over its own file handle
+	opened := 0
+	m := NewMultipathTransfer(&TransferConfig{Segments: 4})
+	err = m.stripe(context.Background(), []*sftp.Client{newPipeSFTPClient(t)}, int64(len(data)), local, chunkOffsets(int64(len(data))), func(c *sftp.Client) (io.ReaderAt, io.WriterAt, func(), error) {
+		opened++
+		f, err := c.OpenFile(remotePath, os.O_WRONLY)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return src, f, func() { f.Close() }, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, opened)
+
+	got, err := os.ReadFile(remotePath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestNewTransferSegments(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.bin")
+	require.NoError(t, os.WriteFile(small, []byte("tiny"), 0644))
+	large := filepath.Join(dir, "large.bin")
+	require.NoError(t, os.WriteFile(large, nil, 0644))
+	require.NoError(t, os.Truncate(large, SegmentMinSize))
+
+	for name, tt := range map[string]struct {
+		source    string
+		segments  int
+		segmented bool
+	}{
+		"large file":     {large, 4, true},
+		"small file":     {small, 4, false},
+		"directory":      {dir, 4, false},
+		"single segment": {large, 1, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			xfer, err := NewTransfer(&TransferConfig{
+				SourcePath: tt.source,
+				DestPath:   "/tmp/dest",
+				Direction:  DirectionPush,
+				Method:     "sftp",
+				Segments:   tt.segments,
+			})
+			require.NoError(t, err)
+			_, segmented := xfer.(*MultipathTransfer)
+			assert.Equal(t, tt.segmented, segmented)
+		})
+	}
+}
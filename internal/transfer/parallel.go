@@ -0,0 +1,161 @@
+// Package transfer - Parallel SFTP directory transfers
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency is the number of files SFTP directory transfers copy
+// at once unless TransferConfig.Concurrency is set
+const DefaultConcurrency = 4
+
+// fileCopy is a regular file of a directory transfer
+type fileCopy struct {
+	src  string
+	dest string
+	size int64
+}
+
+// linkCopy is a hard link of a directory transfer, recreated at dest once
+// first has been copied; src is copied instead if linking is not possible
+type linkCopy struct {
+	src   string
+	dest  string
+	first string
+}
+
+// concurrency returns how many files to copy at once. Dry runs list files
+// one at a time so their output keeps the walk order.
+func (s *SFTPTransfer) concurrency() int {
+	if s.config.DryRun {
+		return 1
+	}
+	if s.config.Concurrency > 0 {
+		return s.config.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// copyFiles copies files with up to concurrency() workers, reporting the
+// progress of all of them together, and stops at the first error
+func (s *SFTPTransfer) copyFiles(ctx context.Context, files []fileCopy, copyFile func(ctx context.Context, src, dest string) error) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	var totalBytes int64
+	for _, f := range files {
+		totalBytes += f.size
+	}
+	s.tracker = newProgressTracker(len(files), totalBytes)
+	defer func() { s.tracker = nil }()
+
+	pool := s.startCopies(ctx, copyFile)
+	for _, f := range files {
+		if pool.add(f) != nil {
+			break
+		}
+	}
+	return pool.wait()
+}
+
+// fileQueue returns how a directory walk hands over its files: queue takes
+// each file, and finish, given the walk's error, completes the copies.
+// Files are listed and copied by copyFiles once the walk is done, or with
+// LowMemory copied while the walk goes on, with progress reporting no
+// file or byte totals.
+func (s *SFTPTransfer) fileQueue(ctx context.Context, copyFile func(ctx context.Context, src, dest string) error) (queue func(fileCopy) error, finish func(walkErr error) error) {
+	if !s.config.LowMemory {
+		var files []fileCopy
+		queue = func(f fileCopy) error {
+			files = append(files, f)
+			return nil
+		}
+		finish = func(walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			return s.copyFiles(ctx, files, copyFile)
+		}
+		return queue, finish
+	}
+
+	s.tracker = newProgressTracker(0, 0)
+	pool := s.startCopies(ctx, copyFile)
+	finish = func(walkErr error) error {
+		defer func() { s.tracker = nil }()
+
+		// A failed copy stops the walk, which then reports the cancellation
+		if err := pool.wait(); err != nil {
+			return err
+		}
+		return walkErr
+	}
+	return pool.add, finish
+}
+
+// copyPool copies files with up to concurrency() workers as they are
+// added, so a directory walk can hand them over without listing them first
+type copyPool struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	jobs     chan fileCopy
+	wg       sync.WaitGroup
+	once     sync.Once
+	firstErr error
+}
+
+// startCopies starts the workers of a copy pool. s.tracker must be set.
+func (s *SFTPTransfer) startCopies(ctx context.Context, copyFile func(ctx context.Context, src, dest string) error) *copyPool {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &copyPool{ctx: ctx, cancel: cancel, jobs: make(chan fileCopy)}
+
+	for i := 0; i < s.concurrency(); i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for f := range p.jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				err := copyFile(ctx, f.src, f.dest)
+				s.tracker.forget(f.src)
+				if err != nil {
+					p.once.Do(func() {
+						p.firstErr = err
+						cancel()
+					})
+					continue
+				}
+				s.tracker.FileCompleted()
+			}
+		}()
+	}
+
+	return p
+}
+
+// add queues a file, waiting for a free worker. It fails once a copy has
+// failed or ctx is done.
+func (p *copyPool) add(f fileCopy) error {
+	select {
+	case p.jobs <- f:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// wait waits for the queued files to be copied and returns the first error
+func (p *copyPool) wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+	defer p.cancel()
+
+	if p.firstErr != nil {
+		return p.firstErr
+	}
+	return p.ctx.Err()
+}
@@ -0,0 +1,193 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSFTPParallelDirectory(t *testing.T) {
+	src := t.TempDir()
+	var totalBytes int64
+	for i := 0; i < 40; i++ {
+		name := filepath.Join(src, fmt.Sprintf("dir%d", i%4), fmt.Sprintf("file%02d.txt", i))
+		data := strings.Repeat("x", 1000*(i+1))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.NoError(t, os.WriteFile(name, []byte(data), 0644))
+		totalBytes += int64(len(data))
+	}
+
+	for _, tt := range []struct {
+		name      string
+		direction TransferDirection
+	}{
+		{"push", DirectionPush},
+		{"pull", DirectionPull},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "dest")
+			s := NewSFTPTransfer(&TransferConfig{Concurrency: 8})
+
+			var last ProgressInfo
+			s.SetProgressCallback(func(info ProgressInfo) {
+				if info.Operation == OperationTransfer {
+					assert.GreaterOrEqual(t, info.TransferredBytes, last.TransferredBytes, "aggregated progress never goes back")
+					last = info
+				}
+			})
+
+			client := newPipeSFTPClient(t)
+			if tt.direction == DirectionPush {
+				require.NoError(t, s.pushDirectory(context.Background(), client, src, dest))
+			} else {
+				require.NoError(t, s.pullDirectory(context.Background(), client, src, dest, nil))
+			}
+
+			assert.Equal(t, 40, last.FilesTotal)
+			assert.Equal(t, totalBytes, last.TotalBytes)
+			assert.Equal(t, totalBytes, last.TransferredBytes)
+
+			err := filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+				require.NoError(t, err)
+				if info.Mode().IsRegular() {
+					rel, _ := filepath.Rel(src, name)
+					want, _ := os.ReadFile(name)
+					got, err := os.ReadFile(filepath.Join(dest, rel))
+					require.NoError(t, err)
+					assert.Equal(t, want, got, rel)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSFTPLowMemoryDirectory(t *testing.T) {
+	src := t.TempDir()
+	var totalBytes int64
+	for i := 0; i < 30; i++ {
+		name := filepath.Join(src, fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%02d.txt", i))
+		data := strings.Repeat("y", 500*(i+1))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.NoError(t, os.WriteFile(name, []byte(data), 0644))
+		totalBytes += int64(len(data))
+	}
+
+	for name, direction := range map[string]TransferDirection{"push": DirectionPush, "pull": DirectionPull} {
+		t.Run(name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "dest")
+			s := NewSFTPTransfer(&TransferConfig{Concurrency: 4, LowMemory: true})
+
+			var last ProgressInfo
+			s.SetProgressCallback(func(info ProgressInfo) {
+				if info.Operation == OperationTransfer {
+					last = info
+				}
+			})
+
+			client := newPipeSFTPClient(t)
+			if direction == DirectionPush {
+				require.NoError(t, s.pushDirectory(context.Background(), client, src, dest))
+			} else {
+				require.NoError(t, s.pullDirectory(context.Background(), client, src, dest, nil))
+			}
+
+			// Totals are unknown while the tree is still being walked
+			assert.Zero(t, last.FilesTotal)
+			assert.Zero(t, last.TotalBytes)
+			assert.Equal(t, totalBytes, last.TransferredBytes)
+			assert.Nil(t, s.tracker)
+
+			for i := 0; i < 30; i++ {
+				rel := filepath.Join(fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%02d.txt", i))
+				got, err := os.ReadFile(filepath.Join(dest, rel))
+				require.NoError(t, err)
+				assert.Len(t, got, 500*(i+1), rel)
+			}
+		})
+	}
+}
+
+// TestSFTPLowMemoryLargeTree walks a large tree in low-memory mode and
+// checks the heap stays bounded. Set KLIP_LARGE_TREE_FILES to run it with
+// millions of files.
+func TestSFTPLowMemoryLargeTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creates a large tree")
+	}
+	files := 20000
+	if n, err := strconv.Atoi(os.Getenv("KLIP_LARGE_TREE_FILES")); err == nil && n > 0 {
+		files = n
+	}
+
+	src := t.TempDir()
+	for i := 0; i < files; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("d%05d", i/1000))
+		if i%1000 == 0 {
+			require.NoError(t, os.Mkdir(dir, 0755))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%07d", i)), nil, 0644))
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	baseline, peak := stats.HeapAlloc, stats.HeapAlloc
+
+	s := NewSFTPTransfer(&TransferConfig{DryRun: true, LowMemory: true})
+	seen := 0
+	s.SetProgressCallback(func(info ProgressInfo) {
+		if info.Operation != OperationTransfer {
+			return
+		}
+		if seen++; seen%1000 == 0 {
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+		}
+	})
+
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, "/dest"))
+	assert.Equal(t, files, seen)
+	assert.Less(t, peak-baseline, uint64(32<<20), "heap grew by %d bytes", peak-baseline)
+}
+
+func TestSFTPParallelDirectoryStopsOnError(t *testing.T) {
+	src := t.TempDir()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(src, fmt.Sprintf("file%02d", i)), []byte("data"), 0644))
+	}
+
+	// A directory where a file should go cannot be replaced by it
+	dest := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "file05", "child"), 0755))
+
+	s := NewSFTPTransfer(&TransferConfig{Concurrency: 4, NoAtomic: true})
+	err := s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest)
+	require.Error(t, err)
+}
+
+func TestProgressTrackerAggregates(t *testing.T) {
+	pt := newProgressTracker(2, 300)
+
+	pt.Update(ProgressInfo{CurrentFile: "a", TransferredBytes: 50})
+	pt.Update(ProgressInfo{CurrentFile: "b", TransferredBytes: 100})
+	info := pt.Update(ProgressInfo{CurrentFile: "a", TransferredBytes: 100})
+	pt.FileCompleted()
+
+	assert.Equal(t, int64(200), info.TransferredBytes)
+	assert.Equal(t, int64(300), info.TotalBytes)
+	assert.Equal(t, 2, info.FilesTotal)
+
+	stats := pt.GetStats()
+	assert.Equal(t, 1, stats.CompletedFiles)
+	assert.Equal(t, int64(200), stats.TransferredBytes)
+}
@@ -1,17 +1,27 @@
 package transfer
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
 )
 
-// ProgressBar wraps a progress bar for file transfers
+// ProgressBar wraps a progress bar for file transfers, followed by a graph
+// of recent throughput
 type ProgressBar struct {
-	bar       *progressbar.ProgressBar
-	startTime time.Time
-	lastBytes int64
+	bar         *progressbar.ProgressBar
+	description string
+	startTime   time.Time
+	lastBytes   int64
+
+	// graph is fed with the speed since the last sample
+	graph       *ThroughputGraph
+	sampleTime  time.Time
+	sampleBytes int64
 }
 
 // NewProgressBar creates a new progress bar
@@ -21,20 +31,41 @@ func NewProgressBar(totalBytes int64, description string) *ProgressBar {
 		description,
 	)
 
+	now := time.Now()
 	return &ProgressBar{
-		bar:       bar,
-		startTime: time.Now(),
+		bar:         bar,
+		description: description,
+		startTime:   now,
+		graph:       NewThroughputGraph(),
+		sampleTime:  now,
 	}
 }
 
 // Update updates the progress bar
 func (p *ProgressBar) Update(current int64) {
 	if p.bar != nil {
+		p.sample(current)
 		p.bar.Set64(current)
 		p.lastBytes = current
 	}
 }
 
+// sample feeds the throughput graph once per ThroughputInterval and shows
+// it after the description
+func (p *ProgressBar) sample(current int64) {
+	elapsed := time.Since(p.sampleTime)
+	if elapsed < ThroughputInterval {
+		return
+	}
+
+	p.graph.Add(int64(float64(current-p.sampleBytes) / elapsed.Seconds()))
+	p.sampleTime = time.Now()
+	p.sampleBytes = current
+	if graph := p.graph.String(); graph != "" {
+		p.bar.Describe(p.description + " " + graph)
+	}
+}
+
 // Finish completes the progress bar
 func (p *ProgressBar) Finish() {
 	if p.bar != nil {
@@ -56,45 +87,73 @@ func (p *ProgressBar) GetAverageSpeed() int64 {
 	return int64(float64(p.lastBytes) / elapsed.Seconds())
 }
 
-// ProgressTracker tracks progress across multiple files
+// ProgressTracker tracks progress across multiple files, including files
+// transferred concurrently. It is safe for concurrent use.
 type ProgressTracker struct {
+	mu               sync.Mutex
 	totalFiles       int
 	completedFiles   int
 	totalBytes       int64
 	transferredBytes int64
+	fileBytes        map[string]int64
 	currentFile      string
 	startTime        time.Time
 	bar              *ProgressBar
 }
 
-// NewProgressTracker creates a new progress tracker
+// NewProgressTracker creates a new progress tracker with a progress bar
 func NewProgressTracker(totalFiles int, totalBytes int64) *ProgressTracker {
+	pt := newProgressTracker(totalFiles, totalBytes)
+	pt.bar = NewProgressBar(totalBytes, "Transferring")
+	return pt
+}
+
+// newProgressTracker creates a progress tracker without a progress bar
+func newProgressTracker(totalFiles int, totalBytes int64) *ProgressTracker {
 	return &ProgressTracker{
 		totalFiles: totalFiles,
 		totalBytes: totalBytes,
+		fileBytes:  make(map[string]int64),
 		startTime:  time.Now(),
-		bar:        NewProgressBar(totalBytes, "Transferring"),
 	}
 }
 
-// Update updates the tracker with current progress
-func (pt *ProgressTracker) Update(info ProgressInfo) {
-	if info.CurrentFile != pt.currentFile {
-		pt.currentFile = info.CurrentFile
-		if pt.completedFiles < pt.totalFiles {
-			pt.completedFiles++
-		}
-	}
+// Update records the progress of one file and returns info with the byte
+// and file counts of the whole transfer
+func (pt *ProgressTracker) Update(info ProgressInfo) ProgressInfo {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
 
-	pt.transferredBytes = info.TransferredBytes
+	pt.currentFile = info.CurrentFile
+	pt.transferredBytes += info.TransferredBytes - pt.fileBytes[info.CurrentFile]
+	pt.fileBytes[info.CurrentFile] = info.TransferredBytes
 
 	if pt.bar != nil {
 		pt.bar.Update(pt.transferredBytes)
 	}
+
+	info.TotalBytes = pt.totalBytes
+	info.TransferredBytes = pt.transferredBytes
+	info.FilesTotal = pt.totalFiles
+	info.FilesTransferred = pt.completedFiles
+	if elapsed := time.Since(pt.startTime).Seconds(); elapsed > 0 {
+		info.Speed = int64(float64(pt.transferredBytes) / elapsed)
+	}
+	return info
+}
+
+// forget drops the per-file progress of a file that is done, so trackers
+// of large trees only remember the files in flight
+func (pt *ProgressTracker) forget(file string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	delete(pt.fileBytes, file)
 }
 
 // FileCompleted marks a file as completed
 func (pt *ProgressTracker) FileCompleted() {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
 	pt.completedFiles++
 }
 
@@ -107,6 +166,9 @@ func (pt *ProgressTracker) Finish() {
 
 // GetStats returns progress statistics
 func (pt *ProgressTracker) GetStats() ProgressStats {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
 	elapsed := time.Since(pt.startTime)
 	var speed int64
 	if elapsed.Seconds() > 0 {
@@ -178,3 +240,48 @@ func (ps ProgressStats) formatDuration(d time.Duration) string {
 
 	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
 }
+
+// copyProgress copies data, passing the progress of every write to notify,
+// counting from offset bytes already transferred
+func copyProgress(ctx context.Context, dst io.Writer, src io.Reader, offset, total int64, filename string, notify func(ProgressInfo)) error {
+	written := offset
+	buf := make([]byte, 32*1024)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			nw, ew := dst.Write(buf[0:nr])
+			if nw > 0 {
+				written += int64(nw)
+
+				// Report progress
+				notify(ProgressInfo{
+					Operation:        OperationTransfer,
+					TotalBytes:       total,
+					TransferredBytes: written,
+					CurrentFile:      filename,
+				})
+			}
+			if ew != nil {
+				return ew
+			}
+			if nr != nw {
+				return io.ErrShortWrite
+			}
+		}
+		if er != nil {
+			if er != io.EOF {
+				return er
+			}
+			break
+		}
+	}
+
+	return nil
+}
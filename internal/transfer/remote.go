@@ -0,0 +1,84 @@
+// Package transfer - Server-side file operations
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/sftp"
+)
+
+// posixRenameExtension is the OpenSSH SFTP extension for renames that
+// replace an existing target atomically
+const posixRenameExtension = "posix-rename@openssh.com"
+
+// CommandRunner runs a shell command on the remote host, e.g. *ssh.Client
+type CommandRunner interface {
+	RunCommand(ctx context.Context, command string) (string, error)
+}
+
+// RemoteRename moves oldname to newname on the remote host, replacing
+// newname if it exists. The rename is atomic if the server offers the
+// posix-rename extension (OpenSSH does); otherwise newname is removed
+// first, since plain SFTP renames refuse to overwrite.
+func RemoteRename(client *sftp.Client, oldname, newname string) error {
+	if _, ok := client.HasExtension(posixRenameExtension); ok {
+		if err := client.PosixRename(oldname, newname); err != nil {
+			return fmt.Errorf("failed to rename %s to %s: %w", oldname, newname, err)
+		}
+		return nil
+	}
+
+	if err := client.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace %s: %w", newname, err)
+	}
+	if err := client.Rename(oldname, newname); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", oldname, newname, err)
+	}
+	return nil
+}
+
+// RemoteCopy copies the file src to dst on the remote host, preserving its
+// mode. The copy runs server-side with cp when runner is set and the remote
+// host has a POSIX shell, so no data crosses the network; otherwise the file
+// is streamed through this machine over SFTP.
+func RemoteCopy(ctx context.Context, runner CommandRunner, client *sftp.Client, src, dst string) error {
+	if runner != nil {
+		command := fmt.Sprintf("cp -p -- %s %s", quoteRemoteShellArg(src), quoteRemoteShellArg(dst))
+		if _, err := runner.RunCommand(ctx, command); err == nil {
+			return nil
+		}
+	}
+
+	in, err := client.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+
+	out, err := client.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+
+	if err := client.Chmod(dst, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", dst, err)
+	}
+	return nil
+}
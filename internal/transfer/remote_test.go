@@ -0,0 +1,85 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localRunner runs remote commands on this machine, standing in for the
+// SSH client when the SFTP server is local
+type localRunner struct {
+	commands []string
+}
+
+func (r *localRunner) RunCommand(ctx context.Context, command string) (string, error) {
+	r.commands = append(r.commands, command)
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	return string(output), err
+}
+
+func (r *localRunner) RunCommandInput(ctx context.Context, command string, input io.Reader) (string, error) {
+	r.commands = append(r.commands, command)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = input
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestRemoteRename(t *testing.T) {
+	dir := t.TempDir()
+	client := newPipeSFTPClient(t)
+
+	oldname := filepath.Join(dir, ".app.conf.klip-tmp")
+	newname := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(oldname, []byte("new"), 0644))
+	require.NoError(t, os.WriteFile(newname, []byte("old"), 0644))
+
+	require.NoError(t, RemoteRename(client, oldname, newname))
+
+	data, err := os.ReadFile(newname)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	assert.NoFileExists(t, oldname)
+
+	assert.Error(t, RemoteRename(client, oldname, newname))
+}
+
+func TestRemoteCopy(t *testing.T) {
+	dir := t.TempDir()
+	client := newPipeSFTPClient(t)
+
+	src := filepath.Join(dir, "run me.sh")
+	require.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\n"), 0750))
+	require.NoError(t, os.Chmod(src, 0750))
+
+	// Server-side copy with cp
+	runner := &localRunner{}
+	dst := filepath.Join(dir, "copy.sh")
+	require.NoError(t, RemoteCopy(context.Background(), runner, client, src, dst))
+	require.Len(t, runner.commands, 1)
+	assert.Contains(t, runner.commands[0], "cp -p -- '")
+
+	info, err := os.Stat(dst)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	// Streamed over SFTP without a shell
+	dst = filepath.Join(dir, "streamed.sh")
+	require.NoError(t, RemoteCopy(context.Background(), nil, client, src, dst))
+
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(data))
+	info, err = os.Stat(dst)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	assert.Error(t, RemoteCopy(context.Background(), nil, client, filepath.Join(dir, "missing"), dst))
+}
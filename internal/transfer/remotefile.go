@@ -0,0 +1,166 @@
+// Package transfer - Reading and comparing small remote files
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DefaultReadLimit is the largest remote file read by klip cat and
+// klip diff-file unless --max-size says otherwise
+const DefaultReadLimit = 1024 * 1024
+
+// ReadRemoteFile reads a remote file over SFTP into memory, failing if it
+// is larger than limit bytes. A leading ~/ is the remote home directory.
+func ReadRemoteFile(client *sftp.Client, name string, limit int64) ([]byte, error) {
+	name, err := ExpandRemoteHome(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := client.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+	if info.Size() > limit {
+		return nil, fmt.Errorf("%s is %s, larger than the %s limit", name, FormatBytes(info.Size()), FormatBytes(limit))
+	}
+
+	// Files without a size (e.g. in /proc) may still grow past the limit
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than the %s limit", name, FormatBytes(limit))
+	}
+	return data, nil
+}
+
+// maxSymlinks is how many symbolic links resolveRemoteLinks follows before
+// giving up, as the kernel does
+const maxSymlinks = 40
+
+// WriteRemoteFile replaces a remote file with data and sets its mode. The
+// data is written to <name>.klip-tmp and renamed over the file, so a failed
+// upload never leaves it truncated. A symbolic link is followed, so the
+// file it points to is replaced and the link kept. The temporary file gets
+// the mode, and the owner and group of the file it replaces, before any
+// data is written to it; if the owner cannot be kept, the file is left
+// alone.
+func WriteRemoteFile(client *sftp.Client, name string, data []byte, mode os.FileMode) error {
+	name, err := resolveRemoteLinks(client, name)
+	if err != nil {
+		return err
+	}
+
+	tmpName := name + AtomicSuffix
+	f, err := client.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpName, err)
+	}
+	fail := func(format string, err error) error {
+		f.Close()
+		client.Remove(tmpName)
+		return fmt.Errorf(format, tmpName, err)
+	}
+
+	if err := f.Chmod(mode.Perm()); err != nil {
+		return fail("failed to set %s permissions: %w", err)
+	}
+	if info, err := client.Stat(name); err == nil {
+		if stat, ok := info.Sys().(*sftp.FileStat); ok {
+			if err := f.Chown(int(stat.UID), int(stat.GID)); err != nil {
+				return fail("failed to give %s the owner of the file it replaces: %w", err)
+			}
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		return fail("failed to write %s: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		client.Remove(tmpName)
+		return fmt.Errorf("failed to write %s: %w", tmpName, err)
+	}
+	if err := RemoteRename(client, tmpName, name); err != nil {
+		client.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// resolveRemoteLinks follows name through symbolic links to the path they
+// lead to, which need not exist
+func resolveRemoteLinks(client *sftp.Client, name string) (string, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		info, err := client.Lstat(name)
+		if os.IsNotExist(err) {
+			return name, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return name, nil
+		}
+
+		target, err := client.ReadLink(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read link %s: %w", name, err)
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(name), target)
+		}
+		name = target
+	}
+	return "", fmt.Errorf("too many levels of symbolic links in %s", name)
+}
+
+// ExpandRemoteHome resolves a leading ~/ in a remote path to the remote
+// home directory
+func ExpandRemoteHome(client *sftp.Client, name string) (string, error) {
+	rest, ok := strings.CutPrefix(name, "~/")
+	if !ok && name != "~" {
+		return name, nil
+	}
+	home, err := client.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get remote home directory: %w", err)
+	}
+	return path.Join(home, rest), nil
+}
+
+// IsBinary reports whether data looks like a binary file, i.e. contains
+// a NUL byte
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// UnifiedDiff returns a unified diff from one text to another with three
+// lines of context (empty if they are equal)
+func UnifiedDiff(fromName, toName string, from, to []byte) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(from)),
+		B:        difflib.SplitLines(string(to)),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
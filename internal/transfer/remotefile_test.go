@@ -0,0 +1,115 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRemoteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(name, []byte("listen 80\n"), 0644))
+	client := newPipeSFTPClient(t)
+
+	data, err := ReadRemoteFile(client, name, DefaultReadLimit)
+	require.NoError(t, err)
+	assert.Equal(t, "listen 80\n", string(data))
+
+	_, err = ReadRemoteFile(client, name, 4)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than")
+
+	_, err = ReadRemoteFile(client, dir, DefaultReadLimit)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is a directory")
+
+	_, err = ReadRemoteFile(client, filepath.Join(dir, "missing"), DefaultReadLimit)
+	assert.Error(t, err)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	diff, err := UnifiedDiff("local/app.conf", "remote/app.conf", []byte("a\nb\nc\n"), []byte("a\nB\nc\n"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(diff, "--- local/app.conf\n+++ remote/app.conf\n"))
+	assert.Contains(t, diff, "-b\n+B\n")
+
+	diff, err = UnifiedDiff("a", "b", []byte("same\n"), []byte("same\n"))
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	assert.True(t, IsBinary([]byte{0x7f, 'E', 'L', 'F', 0}))
+	assert.False(t, IsBinary([]byte("text")))
+}
+
+func TestWriteRemoteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(name, []byte("listen 80\n"), 0640))
+	client := newPipeSFTPClient(t)
+
+	require.NoError(t, WriteRemoteFile(client, name, []byte("listen 8080\n"), 0640))
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "listen 8080\n", string(data))
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assert.NoFileExists(t, name+AtomicSuffix)
+}
+
+func TestWriteRemoteFileFollowsLinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "conf", "app.conf")
+	require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+	require.NoError(t, os.WriteFile(target, []byte("old\n"), 0600))
+	link := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.Symlink(filepath.Join("conf", "app.conf"), link))
+	chained := filepath.Join(dir, "current.conf")
+	require.NoError(t, os.Symlink(link, chained))
+	client := newPipeSFTPClient(t)
+
+	// The file the links lead to is replaced and the links are kept
+	require.NoError(t, WriteRemoteFile(client, chained, []byte("new\n"), 0600))
+	assert.Equal(t, "new\n", readSyncFile(t, target))
+	for _, name := range []string{link, chained} {
+		info, err := os.Lstat(name)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink, name)
+	}
+	assert.NoFileExists(t, target+AtomicSuffix)
+
+	// A link to a missing file creates it
+	dangling := filepath.Join(dir, "dangling.conf")
+	require.NoError(t, os.Symlink("missing.conf", dangling))
+	require.NoError(t, WriteRemoteFile(client, dangling, []byte("x"), 0644))
+	assert.Equal(t, "x", readSyncFile(t, filepath.Join(dir, "missing.conf")))
+
+	loop := filepath.Join(dir, "loop")
+	require.NoError(t, os.Symlink("loop", loop))
+	assert.ErrorContains(t, WriteRemoteFile(client, loop, []byte("x"), 0644), "too many levels")
+}
+
+func TestWriteRemoteFileKeepsOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of a file needs root")
+	}
+	name := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(name, []byte("old\n"), 0640))
+	require.NoError(t, os.Chown(name, 1234, 5678))
+
+	client := newPipeSFTPClient(t)
+	require.NoError(t, WriteRemoteFile(client, name, []byte("new\n"), 0640))
+	info, err := client.Stat(name)
+	require.NoError(t, err)
+	stat := info.Sys().(*sftp.FileStat)
+	assert.Equal(t, uint32(1234), stat.UID)
+	assert.Equal(t, uint32(5678), stat.GID)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
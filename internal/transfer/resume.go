@@ -0,0 +1,108 @@
+// Package transfer - Resuming partial SFTP transfers
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// resumeOffset returns where to continue writing a partial file from a
+// source: the partial file's size if it is shorter than the source and was
+// last written no earlier than the source was modified, and its prefix
+// matches the source's where compared, otherwise 0. Partial files under a
+// temporary or staging name are only left behind by klip, so their prefix
+// is compared with VerifyResume only; a shorter file at the destination
+// itself (inPlace) may be an older version and is always compared.
+// Modification times are compared to the second, as SFTP reports them.
+func (s *SFTPTransfer) resumeOffset(partial, source os.FileInfo, inPlace bool, sourcePrefix, partialPrefix func(int64) (string, error)) int64 {
+	size, total := partial.Size(), source.Size()
+	if s.config.NoResume || size <= 0 || size >= total {
+		return 0
+	}
+	// A source modified after the partial file was written has changed
+	// since the interrupted transfer
+	if partial.ModTime().Truncate(time.Second).Before(source.ModTime().Truncate(time.Second)) {
+		return 0
+	}
+	if !s.config.VerifyResume && !inPlace {
+		return size
+	}
+
+	want, err := sourcePrefix(size)
+	if err != nil {
+		return 0
+	}
+	got, err := partialPrefix(size)
+	if err != nil || !strings.EqualFold(want, got) {
+		return 0
+	}
+	return size
+}
+
+// seekResume positions the destination and source at offset to continue
+// a partial file
+func (s *SFTPTransfer) seekResume(dst, src io.Seeker, offset int64, filename string) error {
+	if offset == 0 {
+		return nil
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek partial file: %w", err)
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek source file: %w", err)
+	}
+	s.notifyProgress(ProgressInfo{
+		CurrentFile: filename,
+		Message:     fmt.Sprintf("Resuming %s at %s", filename, FormatBytes(offset)),
+	})
+	return nil
+}
+
+// prefixSHA256 returns the hex SHA-256 digest of the first n bytes of r
+func prefixSHA256(r io.ReaderAt, n int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, n)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remotePrefixSHA256 returns the digest of the first n bytes of a remote
+// file, computed on the remote host when runner is set and it has head and
+// sha256sum or shasum, otherwise by reading the prefix over SFTP
+func remotePrefixSHA256(ctx context.Context, runner CommandRunner, client *sftp.Client, name string, n int64) (string, error) {
+	if runner != nil {
+		command := fmt.Sprintf("head -c %d -- %s | if command -v sha256sum >/dev/null 2>&1; then sha256sum; else shasum -a 256; fi",
+			n, quoteRemoteShellArg(name))
+		if output, err := runner.RunCommand(ctx, command); err == nil {
+			if sum, _, _ := strings.Cut(strings.TrimSpace(output), " "); len(sum) == sha256.Size*2 {
+				return sum, nil
+			}
+		}
+	}
+
+	f, err := client.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return prefixSHA256(f, n)
+}
+
+// resumeFlags returns the flags to open a destination file with: truncated
+// unless writing continues at offset
+func resumeFlags(offset int64) int {
+	if offset > 0 {
+		return os.O_WRONLY | os.O_CREATE
+	}
+	return os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+}
@@ -0,0 +1,109 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSFTPResumePush(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("0123456789", 10000))
+	local := filepath.Join(dir, "backup.tar")
+	require.NoError(t, os.WriteFile(local, data, 0644))
+
+	remote := filepath.Join(dir, "remote", "backup.tar")
+	require.NoError(t, os.MkdirAll(filepath.Dir(remote), 0755))
+
+	tests := []struct {
+		name     string
+		cfg      TransferConfig
+		partial  []byte
+		stale    bool
+		resumeAt int64
+	}{
+		{"continues partial upload", TransferConfig{}, data[:30000], false, 30000},
+		{"verified partial upload", TransferConfig{VerifyResume: true}, data[:30000], false, 30000},
+		{"verify rejects different prefix", TransferConfig{VerifyResume: true}, []byte("garbage"), false, 0},
+		{"no resume", TransferConfig{NoResume: true}, data[:30000], false, 0},
+		{"partial not shorter than source", TransferConfig{}, append(data, 'x'), false, 0},
+		{"source modified after partial", TransferConfig{}, data[:30000], true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(remote+AtomicSuffix, tt.partial, 0644))
+			if tt.stale {
+				past := time.Now().Add(-time.Hour)
+				require.NoError(t, os.Chtimes(remote+AtomicSuffix, past, past))
+			}
+
+			var firstWrite int64 = -1
+			s := NewSFTPTransfer(&tt.cfg)
+			s.SetProgressCallback(func(info ProgressInfo) {
+				if info.Operation == OperationTransfer && firstWrite < 0 {
+					firstWrite = info.TransferredBytes
+				}
+			})
+
+			require.NoError(t, s.pushFile(context.Background(), newPipeSFTPClient(t), local, remote))
+
+			got, err := os.ReadFile(remote)
+			require.NoError(t, err)
+			assert.Equal(t, data, got)
+			assert.NoFileExists(t, remote+AtomicSuffix)
+			assert.Greater(t, firstWrite, tt.resumeAt)
+			assert.LessOrEqual(t, firstWrite, tt.resumeAt+32*1024)
+		})
+	}
+}
+
+func TestSFTPResumePullInPlace(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("abcdefghij", 10000))
+	remote := filepath.Join(dir, "remote.log")
+	require.NoError(t, os.WriteFile(remote, data, 0644))
+
+	// A shorter file at the destination itself is only continued if it is
+	// a prefix of the source
+	for name, partial := range map[string][]byte{
+		"prefix":        data[:50000],
+		"older version": []byte(strings.Repeat("x", 50000)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			local := filepath.Join(t.TempDir(), "remote.log")
+			require.NoError(t, os.WriteFile(local, partial, 0644))
+
+			s := NewSFTPTransfer(&TransferConfig{})
+			require.NoError(t, s.pullFile(context.Background(), newPipeSFTPClient(t), remote, local))
+
+			got, err := os.ReadFile(local)
+			require.NoError(t, err)
+			assert.Equal(t, data, got)
+		})
+	}
+}
+
+func TestSFTPResumeSparse(t *testing.T) {
+	dir := t.TempDir()
+	data := sparseImage()
+	local := filepath.Join(dir, "disk.img")
+	require.NoError(t, os.WriteFile(local, data, 0644))
+
+	remote := filepath.Join(dir, "remote.img")
+	require.NoError(t, os.WriteFile(remote+AtomicSuffix, data[:3*sparseBlockSize], 0644))
+
+	s := NewSFTPTransfer(&TransferConfig{Sparse: true})
+	require.NoError(t, s.pushFile(context.Background(), newPipeSFTPClient(t), local, remote))
+
+	got, err := os.ReadFile(remote)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assertHoles(t, remote)
+}
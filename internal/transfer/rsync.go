@@ -2,18 +2,43 @@ package transfer
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // RsyncTransfer implements file transfer using rsync
 type RsyncTransfer struct {
 	config           *TransferConfig
 	progressCallback ProgressCallback
+
+	// remoteShell overrides the -e command (set when bridging over SSHClient)
+	remoteShell string
+
+	// pinnedKnownHosts is the known_hosts file trusting only the profile's
+	// pinned host key, for system ssh
+	pinnedKnownHosts string
+
+	// hostCAKnownHosts is the known_hosts file trusting settings.host_ca_keys
+	// as certificate authorities, for system ssh
+	hostCAKnownHosts string
+
+	// vettedHost is the address system ssh dials instead of the remote
+	// host's name, checked against allowed_cidrs, and hostKeyAlias the name
+	// its host key is recorded under
+	vettedHost   string
+	hostKeyAlias string
 }
 
 // NewRsyncTransfer creates a new rsync-based transfer
@@ -35,14 +60,70 @@ func (r *RsyncTransfer) Execute(ctx context.Context) error {
 		return fmt.Errorf("rsync not found in PATH: %w", err)
 	}
 
+	// Fail fast on missing remote paths instead of mid-transfer
+	if err := CheckRemotePaths(r.config); err != nil {
+		return err
+	}
+
+	// Run the remote rsync over the established connection when there is one,
+	// falling back to the system ssh binary otherwise
+	var env []string
+	if r.config.SSHClient != nil && r.config.SSHClient.IsConnected() {
+		bridge, err := startRsyncBridge(ctx, r.config.SSHClient)
+		if err != nil {
+			return err
+		}
+		defer bridge.Close()
+
+		remoteShell, err := bridge.RemoteShell()
+		if err != nil {
+			return err
+		}
+		r.remoteShell = remoteShell
+		env = bridge.Env()
+	}
+
+	// System ssh dials an address checked against allowed_cidrs
+	if r.remoteShell == "" {
+		if err := r.vetRemoteHost(ctx); err != nil {
+			return err
+		}
+	}
+
+	// System ssh enforces a pinned host key through a known_hosts file
+	// holding only that key
+	if r.remoteShell == "" && r.config.Profile.HostKeyFingerprint != "" {
+		pinned, err := r.writePinnedKnownHosts()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(pinned)
+		r.pinnedKnownHosts = pinned
+	}
+
+	// System ssh trusts the host CAs through @cert-authority lines in a
+	// second known_hosts file
+	if r.remoteShell == "" && len(r.config.HostCAKeys) > 0 {
+		caFile, err := r.writeHostCAKnownHosts()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(caFile)
+		r.hostCAKnownHosts = caFile
+	}
+
 	// Build rsync command
 	args := r.buildRsyncArgs()
 
 	cmd := exec.CommandContext(ctx, "rsync", args...)
+	cmd.Env = env
 
 	// Capture output for progress parsing
 	if r.config.ShowProgress && r.progressCallback != nil {
-		return r.executeWithProgress(ctx, cmd)
+		if err := r.executeWithProgress(ctx, cmd); err != nil {
+			return err
+		}
+		return r.chownPushed(ctx)
 	}
 
 	// Execute without progress
@@ -51,7 +132,22 @@ func (r *RsyncTransfer) Execute(ctx context.Context) error {
 		return fmt.Errorf("rsync failed: %w\nOutput: %s", err, string(output))
 	}
 
-	return nil
+	return r.chownPushed(ctx)
+}
+
+// chownByRsync reports whether pushed files get their owner from rsync
+// --chown, which the local rsync must be new enough for
+func (r *RsyncTransfer) chownByRsync() bool {
+	return r.config.Chown != "" && r.config.Direction == DirectionPush && rsyncSupportsChown(localRsyncVersion())
+}
+
+// chownPushed runs chown on the remote host after a push if rsync could
+// not apply the owner itself
+func (r *RsyncTransfer) chownPushed(ctx context.Context) error {
+	if r.config.Chown == "" || r.config.Direction != DirectionPush || r.config.DryRun || r.chownByRsync() {
+		return nil
+	}
+	return chownPushed(ctx, r.config.runner(), r.config)
 }
 
 // buildRsyncArgs builds the argument list for rsync
@@ -65,9 +161,38 @@ func (r *RsyncTransfer) buildRsyncArgs() []string {
 		args = append(args, "-r") // Recursive
 	}
 
+	// Extended attributes and ACLs, as far as the local rsync supports them
+	if r.config.PreserveXattrs {
+		args = append(args, rsyncXattrArgs(localRsyncVersion())...)
+	}
+
+	// Hard links within the transfer
+	if r.config.PreserveHardLinks {
+		args = append(args, "-H")
+	}
+
+	// Sparse files, e.g. VM disk images
+	if r.config.Sparse {
+		args = append(args, "-S")
+	}
+
+	// Permission overrides, e.g. D755,F644
+	if r.config.Chmod != "" {
+		args = append(args, "--chmod="+r.config.Chmod)
+	}
+
+	// Ownership of pushed files; older rsyncs are followed by a remote chown
+	if r.chownByRsync() {
+		args = append(args, "--chown="+r.config.Chown)
+	}
+
 	// Verbose mode
 	args = append(args, "-v")
 
+	// Send file names to the remote rsync without shell word-splitting so
+	// paths containing spaces or shell metacharacters are taken literally
+	args = append(args, "--protect-args")
+
 	// Progress information
 	if r.config.ShowProgress {
 		args = append(args, "--progress")
@@ -95,6 +220,22 @@ func (r *RsyncTransfer) buildRsyncArgs() []string {
 		args = append(args, "--exclude", pattern)
 	}
 
+	// Include patterns - rsync applies the first matching rule, so after
+	// the excludes, every directory is traversed, included files are kept
+	// and everything else is excluded
+	var includes []string
+	for _, pattern := range r.config.IncludePatterns {
+		if err := ValidateExcludePattern(pattern); err != nil {
+			continue
+		}
+		includes = append(includes, "--include", pattern)
+	}
+	if len(includes) > 0 {
+		args = append(args, "--include", "*/")
+		args = append(args, includes...)
+		args = append(args, "--exclude", "*")
+	}
+
 	// Delete source after transfer
 	if r.config.DeleteAfterTransfer {
 		args = append(args, "--remove-source-files")
@@ -106,64 +247,293 @@ func (r *RsyncTransfer) buildRsyncArgs() []string {
 	}
 
 	// Partial transfer support (resume)
-	args = append(args, "--partial")
+	if !r.config.NoResume {
+		args = append(args, "--partial")
+	}
+
+	// Atomic uploads: files are written to .~tmp~ and renamed into place at
+	// the end, so consumers never see partial files
+	if r.config.Direction == DirectionPush && !r.config.NoAtomic {
+		args = append(args, "--delay-updates")
+	}
+
+	// Partial files on the receiving side go to the staging directory
+	if r.config.StagingDir != "" {
+		args = append(args, "--temp-dir="+r.config.StagingDir)
+	}
+
+	// Remote rsync program override (e.g., non-standard location or sudo)
+	if r.config.RsyncPath != "" {
+		args = append(args, "--rsync-path="+r.config.RsyncPath)
+	}
+
+	// Additional options (validated against the allowlist in NewTransfer)
+	args = append(args, r.config.ExtraRsyncArgs...)
 
 	// SSH options
+	// rsync splits the -e value on whitespace itself, so each argument is
+	// quoted to keep key paths with spaces intact
 	sshArgs := r.buildSSHArgs()
-	if len(sshArgs) > 0 {
-		args = append(args, "-e", fmt.Sprintf("ssh %s", strings.Join(sshArgs, " ")))
+	if r.remoteShell != "" {
+		args = append(args, "-e", r.remoteShell)
+	} else if len(sshArgs) > 0 {
+		quoted := make([]string, len(sshArgs))
+		for i, arg := range sshArgs {
+			quoted[i] = quoteRemoteShellArg(arg)
+		}
+		args = append(args, "-e", "ssh "+strings.Join(quoted, " "))
 	}
 
 	// Determine the host to use for the rsync connection.
-	// ResolvedHost is set by the ConnectionHelper after backend detection and
-	// contains the VPN-resolved IP address for VPN backends (tailscale, headscale, netbird).
+	// remoteHost's ResolvedHost is set by the ConnectionHelper after backend detection and
+	// contains the VPN-resolved IP address for VPN backends (tailscale, headscale, netbird, zerotier, wireguard).
 	// This ensures rsync connects through the correct network path.
 	// If ResolvedHost is empty (e.g., for LAN backend or if resolution was skipped),
 	// the original profile hostname is used and DNS resolution happens at connection time.
-	remoteHost := r.config.Profile.RemoteHost
-	if r.config.ResolvedHost != "" {
-		remoteHost = r.config.ResolvedHost
+	remoteHost := r.remoteHost()
+	if r.vettedHost != "" {
+		remoteHost = r.vettedHost
 	}
 
 	// Source and destination
+	// A trailing slash on the source tells rsync to copy directory contents
+	source := r.config.SourcePath
+	if r.config.DirectoryMode == DirModeContents && !strings.HasSuffix(source, "/") {
+		source += "/"
+	}
+
 	if r.config.Direction == DirectionPush {
 		// Local to remote
-		args = append(args, r.config.SourcePath)
-		args = append(args, fmt.Sprintf("%s@%s:%s",
-			r.config.Profile.RemoteUser,
-			remoteHost,
-			r.config.DestPath))
+		args = append(args, localPathArg(source))
+		args = append(args, remotePathArg(r.config.Profile.RemoteUser, remoteHost, r.config.DestPath))
 	} else {
 		// Remote to local
-		args = append(args, fmt.Sprintf("%s@%s:%s",
-			r.config.Profile.RemoteUser,
-			remoteHost,
-			r.config.SourcePath))
-		args = append(args, r.config.DestPath)
+		args = append(args, remotePathArg(r.config.Profile.RemoteUser, remoteHost, source))
+		args = append(args, localPathArg(r.config.DestPath))
 	}
 
 	return args
 }
 
+// remotePathArg formats a user@host:path rsync operand
+// IPv6 literals are bracketed so their colons aren't taken as the path separator
+func remotePathArg(user, host, remotePath string) string {
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return fmt.Sprintf("%s@%s:%s", user, host, remotePath)
+}
+
+// localPathArg prevents local paths from being parsed as rsync options or
+// as remote host specifications
+func localPathArg(localPath string) string {
+	if strings.HasPrefix(localPath, "-") || (!filepath.IsAbs(localPath) && strings.Contains(localPath, ":")) {
+		return "./" + localPath
+	}
+	return localPath
+}
+
+// quoteRemoteShellArg quotes an argument for rsync's -e command parser, which
+// follows POSIX shell single-quote rules
+func quoteRemoteShellArg(arg string) string {
+	safe := regexp.MustCompile(`^[a-zA-Z0-9_./=:@%+,\-]+$`)
+	if arg != "" && safe.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// quoteSSHOptionPath double-quotes a path with blanks in an ssh -o value,
+// where a list of files such as UserKnownHostsFile is split at whitespace
+func quoteSSHOptionPath(path string) string {
+	if strings.ContainsAny(path, " \t") {
+		return `"` + path + `"`
+	}
+	return path
+}
+
 // buildSSHArgs builds SSH arguments for rsync
 func (r *RsyncTransfer) buildSSHArgs() []string {
 	args := []string{}
 
-	// SSH port
-	if r.config.Profile.SSHPort != 22 {
-		args = append(args, "-p", strconv.Itoa(r.config.Profile.SSHPort))
+	// SSH port (always explicit so ~/.ssh/config can't redirect the connection)
+	port := r.config.Profile.SSHPort
+	if port == 0 {
+		port = 22
+	}
+	args = append(args, "-p", strconv.Itoa(port))
+
+	// SSH key; a trust domain's key directory replaces ~/.ssh, and a
+	// hardware token is used through the ssh-agent, which the Go client
+	// has already loaded its PKCS#11 provider into
+	keyArgs := r.trustDomainKeyArgs()
+	if r.config.Profile.PKCS11Provider != "" {
+		keyArgs = nil
 	}
-
-	// SSH key
 	if r.config.Profile.SSHKeyPath != "" {
 		args = append(args, "-i", r.config.Profile.SSHKeyPath)
+	} else {
+		args = append(args, keyArgs...)
 	}
 
 	// SECURITY: Never disable strict host key checking as it prevents MITM attacks
-	// Host key verification is handled automatically via klip's known_hosts management
-	// in ~/.config/klip/known_hosts. If you encounter host key errors, use:
-	//   klip health --verify-host <profile>
+	// Point ssh at klip's known_hosts so rsync trusts exactly the same host keys
+	// as the Go client, which has already verified (or TOFU-added) this host
+	// before the transfer starts
+	var knownHostsFiles []string
+	if r.config.KnownHostsPath != "" {
+		knownHostsFiles = append(knownHostsFiles, quoteSSHOptionPath(r.config.KnownHostsPath))
+	} else if knownHostsPath, err := ssh.GetKnownHostsPath(""); err == nil {
+		knownHostsFiles = append(knownHostsFiles, quoteSSHOptionPath(knownHostsPath))
+	}
+	if r.hostCAKnownHosts != "" {
+		knownHostsFiles = append(knownHostsFiles, quoteSSHOptionPath(r.hostCAKnownHosts))
+	}
+	hostKeyArgs := []string{"-o", "StrictHostKeyChecking=yes"}
+	if len(knownHostsFiles) > 0 {
+		hostKeyArgs = append([]string{"-o", "UserKnownHostsFile=" + strings.Join(knownHostsFiles, " ")}, hostKeyArgs...)
+	}
+	if r.hostKeyAlias != "" {
+		args = append(args, "-o", "HostKeyAlias="+r.hostKeyAlias)
+	}
+	if r.pinnedKnownHosts != "" {
+		// The pin replaces known_hosts for the remote host, but not for
+		// its jump hosts
+		args = append(args, "-o", "UserKnownHostsFile="+quoteSSHOptionPath(r.pinnedKnownHosts), "-o", "GlobalKnownHostsFile="+os.DevNull, "-o", "StrictHostKeyChecking=yes")
+	} else {
+		args = append(args, hostKeyArgs...)
+	}
+
+	// Jump hosts: every hop is a ProxyCommand rather than -J, so each uses
+	// its own key and the same known_hosts as the Go client instead of
+	// ~/.ssh/config; each hop's command tunnels through the previous one
+	if chain := r.config.Profile.JumpChain(); len(chain) > 0 {
+		proxy := ""
+		for i, hop := range chain {
+			if i < len(r.config.ResolvedJumps) {
+				hop.Host = r.config.ResolvedJumps[i]
+			}
+			proxy = r.jumpProxyCommand(hop, keyArgs, hostKeyArgs, proxy)
+		}
+		args = append(args, "-o", "ProxyCommand="+proxy)
+	}
+
+	return args
+}
+
+// jumpProxyCommand returns the ProxyCommand that reaches a jump hop and
+// forwards to the next host, tunnelled through the previous hop's command
+// when there is one. ssh expands % tokens in a ProxyCommand once per level,
+// so the nested command's are doubled to reach its own ssh intact.
+func (r *RsyncTransfer) jumpProxyCommand(hop config.JumpHost, keyArgs, hostKeyArgs []string, through string) string {
+	user := hop.User
+	if user == "" {
+		user = r.config.Profile.RemoteUser
+	}
+	keyPath := hop.Key
+	if keyPath == "" {
+		keyPath = r.config.Profile.SSHKeyPath
+	}
+
+	proxy := []string{"ssh", "-p", strconv.Itoa(hop.SSHPort())}
+	if keyPath != "" {
+		proxy = append(proxy, "-i", keyPath)
+	} else {
+		proxy = append(proxy, keyArgs...)
+	}
+	proxy = append(proxy, hostKeyArgs...)
+	if through != "" {
+		proxy = append(proxy, "-o", "ProxyCommand="+strings.ReplaceAll(through, "%", "%%"))
+	}
+	proxy = append(proxy, "-W", "%h:%p", user+"@"+hop.Host)
+	for i, arg := range proxy {
+		proxy[i] = quoteRemoteShellArg(arg)
+	}
+	return strings.Join(proxy, " ")
+}
+
+// remoteHost returns the host rsync connects to: the resolved address if
+// there is one, or else the profile's remote host
+func (r *RsyncTransfer) remoteHost() string {
+	if r.config.ResolvedHost != "" {
+		return r.config.ResolvedHost
+	}
+	return r.config.Profile.RemoteHost
+}
+
+// vetRemoteHost resolves the remote host for system ssh when the profile
+// has allowed_cidrs, so ssh dials the address checked against them instead
+// of resolving the name again. The host key is still looked up under the
+// name, as the Go client records it. Behind jump hosts the remote host is
+// dialed from the last hop, so nothing is checked.
+func (r *RsyncTransfer) vetRemoteHost(ctx context.Context) error {
+	if len(r.config.Profile.AllowedCIDRs) == 0 || len(r.config.Profile.JumpChain()) > 0 {
+		return nil
+	}
+	networks, err := config.ParseCIDRs(r.config.Profile.AllowedCIDRs)
+	if err != nil {
+		return err
+	}
+
+	host := r.remoteHost()
+	address, err := ssh.VetAddress(ctx, host, networks)
+	if err != nil {
+		return err
+	}
+	if address != host {
+		port := r.config.Profile.SSHPort
+		if port == 0 {
+			port = 22
+		}
+		r.vettedHost = address
+		r.hostKeyAlias = knownhosts.Normalize(net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+	return nil
+}
+
+// writePinnedKnownHosts writes the known_hosts file for the profile's
+// pinned host key to a temporary file, which the caller removes
+func (r *RsyncTransfer) writePinnedKnownHosts() (string, error) {
+	f, err := os.CreateTemp("", "klip-pinned-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create pinned known_hosts: %w", err)
+	}
+	f.Close()
 
+	if err := ssh.WritePinnedKnownHosts(r.config.KnownHostsPath, r.config.Profile.HostKeyFingerprint, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeHostCAKnownHosts writes the known_hosts file for settings.host_ca_keys
+// to a temporary file, which the caller removes
+func (r *RsyncTransfer) writeHostCAKnownHosts() (string, error) {
+	f, err := os.CreateTemp("", "klip-host-ca-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create host CA known_hosts: %w", err)
+	}
+	f.Close()
+
+	if err := ssh.WriteHostCAKnownHosts(r.config.HostCAKeys, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// trustDomainKeyArgs returns ssh options that offer only the default keys
+// in the trust domain's key directory, or those of settings.default_keys,
+// in the order the Go client does, instead of ssh's own; none with neither
+func (r *RsyncTransfer) trustDomainKeyArgs() []string {
+	if r.config.KeyDir == "" && len(r.config.DefaultKeys) == 0 {
+		return nil
+	}
+	args := []string{"-o", "IdentitiesOnly=yes"}
+	for _, keyPath := range ssh.DefaultKeyPaths(r.config.KeyDir, r.config.DefaultKeys) {
+		args = append(args, "-i", keyPath)
+	}
 	return args
 }
 
@@ -187,6 +557,7 @@ func (r *RsyncTransfer) executeWithProgress(ctx context.Context, cmd *exec.Cmd)
 	done := make(chan error, 1)
 	go func() {
 		scanner := bufio.NewScanner(stdout)
+		scanner.Split(scanRsyncLines)
 		for scanner.Scan() {
 			// Check context periodically during scanning
 			select {
@@ -268,17 +639,61 @@ func (r *RsyncTransfer) parseProgressLine(line string) {
 			total = (transferred * 100) / int64(percentage)
 		}
 
-		// Speed is in matches[3] but we'll skip parsing it for now
-
 		r.progressCallback(ProgressInfo{
+			Operation:        OperationTransfer,
 			TransferredBytes: transferred,
 			TotalBytes:       total,
+			Speed:            parseRsyncSpeed(matches[3]),
 			Message:          line,
 		})
 	} else {
 		// Just send the line as a message
 		r.progressCallback(ProgressInfo{
-			Message: line,
+			Operation: rsyncLineOperation(line),
+			Message:   line,
 		})
 	}
 }
+
+// scanRsyncLines splits rsync output at line feeds and at the carriage
+// returns rsync --progress ends its updates of the current file with, so
+// each update is reported as it happens
+func scanRsyncLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// parseRsyncSpeed converts an rsync speed such as 123.45MB/s into
+// bytes/second, or 0 if it cannot be parsed
+func parseRsyncSpeed(s string) int64 {
+	s = strings.TrimSuffix(s, "/s")
+	number := strings.TrimRightFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0
+	}
+
+	multipliers := map[string]float64{"B": 1, "kB": 1 << 10, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "TB": 1 << 40}
+	multiplier, ok := multipliers[strings.TrimPrefix(s, number)]
+	if !ok {
+		return 0
+	}
+	return int64(value * multiplier)
+}
+
+// rsyncLineOperation classifies a line of rsync -v output
+func rsyncLineOperation(line string) Operation {
+	switch {
+	case strings.HasPrefix(line, "deleting "):
+		return OperationDelete
+	case strings.HasPrefix(line, "created directory "):
+		return OperationMkdir
+	default:
+		return ""
+	}
+}
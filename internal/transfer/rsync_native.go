@@ -0,0 +1,270 @@
+// Package transfer - rsync over klip's own SSH connection
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/orpheus497/klip/internal/ssh"
+)
+
+// rsyncProxyEnv carries the bridge socket path to the proxy process
+const rsyncProxyEnv = "KLIP_RSYNC_PROXY_SOCKET"
+
+// The bridge answers the proxy with frames of a kind byte, a big-endian
+// uint32 length and the payload: the remote command's stdout in data
+// frames, then one exit frame holding its exit status as a uint32
+const (
+	bridgeFrameData byte = 'd'
+	bridgeFrameExit byte = 'x'
+)
+
+// bridgeLostStatus is the exit code when the remote command's status is
+// unknown, the code ssh uses when the connection fails
+const bridgeLostStatus = 255
+
+// IsRsyncProxyInvocation reports whether the current process was started by
+// rsync as its remote shell (see rsyncBridge). Binaries that run rsync
+// transfers must check this before parsing their own command line.
+func IsRsyncProxyInvocation() bool {
+	return os.Getenv(rsyncProxyEnv) != ""
+}
+
+// RunRsyncProxy acts as rsync's remote shell: it forwards the remote command
+// line and stdin/stdout to the parent klip process over the bridge socket.
+// rsync invokes it as: <self> [-l user] host command...
+// Returns the exit status of the remote command, so rsync reports e.g. a
+// missing remote rsync (127) as it does with ssh.
+func RunRsyncProxy() int {
+	return runRsyncProxy(os.Args[1:], os.Getenv(rsyncProxyEnv), os.Stdin, os.Stdout, os.Stderr)
+}
+
+// runRsyncProxy is RunRsyncProxy with its arguments, socket and standard
+// streams passed in
+func runRsyncProxy(args []string, socket string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) >= 2 && args[0] == "-l" {
+		args = args[2:]
+	}
+	if len(args) < 2 {
+		fmt.Fprintln(stderr, "klip rsync proxy: missing host or command")
+		return 1
+	}
+	command := strings.Join(args[1:], " ")
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fmt.Fprintf(stderr, "klip rsync proxy: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, command+"\n"); err != nil {
+		fmt.Fprintf(stderr, "klip rsync proxy: %v\n", err)
+		return 1
+	}
+
+	go func() {
+		io.Copy(conn, stdin)
+		if uc, ok := conn.(*net.UnixConn); ok {
+			uc.CloseWrite()
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			fmt.Fprintln(stderr, "klip rsync proxy: connection to klip lost")
+			return bridgeLostStatus
+		}
+		size := int64(binary.BigEndian.Uint32(header[1:]))
+
+		switch header[0] {
+		case bridgeFrameData:
+			if _, err := io.CopyN(stdout, reader, size); err != nil {
+				return bridgeLostStatus
+			}
+		case bridgeFrameExit:
+			var status uint32
+			if size != 4 || binary.Read(reader, binary.BigEndian, &status) != nil {
+				return bridgeLostStatus
+			}
+			return int(status)
+		default:
+			fmt.Fprintf(stderr, "klip rsync proxy: unknown frame %q\n", header[0])
+			return bridgeLostStatus
+		}
+	}
+}
+
+// writeBridgeFrame writes one frame of the bridge's reply
+func writeBridgeFrame(w io.Writer, kind byte, payload []byte) error {
+	header := make([]byte, 5, 5+len(payload))
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// bridgeDataWriter frames everything written to it as data
+type bridgeDataWriter struct {
+	w io.Writer
+}
+
+func (d bridgeDataWriter) Write(p []byte) (int, error) {
+	if err := writeBridgeFrame(d.w, bridgeFrameData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rsyncBridge lets a local rsync process reach the remote rsync server through
+// an established ssh.Client. rsync is pointed at the klip executable as its
+// remote shell; that proxy process connects back over a private unix socket
+// and the bridge runs the requested command in a session on the existing
+// connection, so authentication, host verification and backend resolution
+// are exactly those of the Go client.
+type rsyncBridge struct {
+	client   *ssh.Client
+	dir      string
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// startRsyncBridge starts listening for the proxy process
+func startRsyncBridge(ctx context.Context, client *ssh.Client) (*rsyncBridge, error) {
+	dir, err := os.MkdirTemp("", "klip-rsync-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bridge directory: %w", err)
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "bridge.sock"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create bridge socket: %w", err)
+	}
+
+	b := &rsyncBridge{
+		client:   client,
+		dir:      dir,
+		listener: listener,
+	}
+
+	b.wg.Add(1)
+	go b.acceptLoop(ctx)
+
+	return b, nil
+}
+
+// acceptLoop serves proxy connections until the listener is closed
+func (b *rsyncBridge) acceptLoop(ctx context.Context) {
+	defer b.wg.Done()
+
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer conn.Close()
+			if err := b.serve(ctx, conn); err != nil {
+				fmt.Fprintf(os.Stderr, "klip rsync bridge: %v\n", err)
+			}
+		}()
+	}
+}
+
+// serve runs one proxied remote command on the SSH connection
+func (b *rsyncBridge) serve(ctx context.Context, conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read remote command: %w", err)
+	}
+	command = strings.TrimSuffix(command, "\n")
+
+	session, err := b.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	session.Stdout = bridgeDataWriter{conn}
+	session.Stderr = os.Stderr
+
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("failed to start remote rsync: %w", err)
+	}
+
+	go func() {
+		io.Copy(stdin, reader)
+		stdin.Close()
+	}()
+
+	// Stop the remote side if the transfer is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	// Failures before rsync's protocol starts, such as no rsync on the
+	// remote host, are only visible in the exit status
+	status := 0
+	if err := session.Wait(); err != nil {
+		var ok bool
+		if status, ok = ssh.ExitStatus(err); !ok {
+			status = bridgeLostStatus
+		}
+	}
+
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], uint32(status))
+	if err := writeBridgeFrame(conn, bridgeFrameExit, payload[:]); err != nil {
+		return fmt.Errorf("failed to send exit status: %w", err)
+	}
+
+	return nil
+}
+
+// RemoteShell returns the -e value that makes rsync use the bridge
+func (b *rsyncBridge) RemoteShell() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate klip executable: %w", err)
+	}
+	return quoteRemoteShellArg(self), nil
+}
+
+// Env returns the environment for the rsync process
+func (b *rsyncBridge) Env() []string {
+	return append(os.Environ(), rsyncProxyEnv+"="+b.listener.Addr().String())
+}
+
+// Close stops the bridge and removes its socket
+func (b *rsyncBridge) Close() error {
+	err := b.listener.Close()
+	b.wg.Wait()
+	os.RemoveAll(b.dir)
+	return err
+}
@@ -0,0 +1,57 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/clitest"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRsyncBridgeProxy(t *testing.T) {
+	server := clitest.NewEnv(t).StartExecSSHServer(func(command string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if command != "rsync --server ." {
+			fmt.Fprintf(stderr, "sh: %s: not found\n", strings.Fields(command)[0])
+			return 127
+		}
+		io.Copy(stdout, stdin)
+		return 0
+	})
+	client, err := ssh.NewClient(&ssh.Config{
+		Host:           server.Host,
+		Port:           server.Port,
+		User:           "test",
+		KeyPath:        server.KeyPath,
+		NonInteractive: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(context.Background()))
+	t.Cleanup(func() { client.Close() })
+
+	bridge, err := startRsyncBridge(context.Background(), client)
+	require.NoError(t, err)
+	defer bridge.Close()
+	socket := bridge.listener.Addr().String()
+
+	// stdin reaches the remote command and its output comes back whole,
+	// larger than a single frame
+	input := strings.Repeat("rsync protocol data\n", 10000)
+	var stdout, stderr bytes.Buffer
+	status := runRsyncProxy([]string{"-l", "test", "host", "rsync", "--server", "."}, socket, strings.NewReader(input), &stdout, &stderr)
+	assert.Equal(t, 0, status, stderr.String())
+	assert.Equal(t, input, stdout.String())
+
+	// The remote exit status becomes the proxy's, as with ssh
+	stdout.Reset()
+	status = runRsyncProxy([]string{"host", "rsnyc", "--server", "."}, socket, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, 127, status)
+	assert.Empty(t, stdout.String())
+
+	assert.Equal(t, 1, runRsyncProxy([]string{"-l", "test", "host"}, socket, strings.NewReader(""), &stdout, &stderr))
+}
@@ -0,0 +1,405 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// newTestRsyncTransfer returns a transfer that trusts a known_hosts file
+// below the temporary directory rather than the user's
+func newTestRsyncTransfer(direction TransferDirection, source, dest string) *RsyncTransfer {
+	profile := config.NewProfile("test", "user", "host")
+	return NewRsyncTransfer(&TransferConfig{
+		Profile:        profile,
+		SourcePath:     source,
+		DestPath:       dest,
+		Direction:      direction,
+		KnownHostsPath: filepath.Join(os.TempDir(), "klip-test", "known_hosts"),
+	})
+}
+
+func TestBuildRsyncArgsHostilePaths(t *testing.T) {
+	hostile := []string{
+		"my file.txt",
+		"$(rm -rf ~).txt",
+		"a;b&c|d",
+		"it's \"quoted\"",
+		"`whoami`",
+		"tab\there",
+	}
+
+	for _, name := range hostile {
+		t.Run(name, func(t *testing.T) {
+			push := newTestRsyncTransfer(DirectionPush, "/tmp/"+name, "/srv/"+name)
+			args := push.buildRsyncArgs()
+
+			assert.Contains(t, args, "--protect-args")
+			// Paths are passed as single argv entries, never split or re-quoted
+			assert.Equal(t, "/tmp/"+name, args[len(args)-2])
+			assert.Equal(t, "user@host:/srv/"+name, args[len(args)-1])
+
+			pull := newTestRsyncTransfer(DirectionPull, "/srv/"+name, "/tmp/"+name)
+			args = pull.buildRsyncArgs()
+			assert.Equal(t, "user@host:/srv/"+name, args[len(args)-2])
+			assert.Equal(t, "/tmp/"+name, args[len(args)-1])
+		})
+	}
+}
+
+func TestBuildRsyncArgsAtomic(t *testing.T) {
+	push := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	assert.Contains(t, push.buildRsyncArgs(), "--delay-updates")
+
+	push.config.NoAtomic = true
+	assert.NotContains(t, push.buildRsyncArgs(), "--delay-updates")
+
+	pull := newTestRsyncTransfer(DirectionPull, "/srv/file", "/tmp/file")
+	assert.NotContains(t, pull.buildRsyncArgs(), "--delay-updates")
+}
+
+func TestBuildRsyncArgsHardLinks(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/backup", "/srv/backup")
+	assert.NotContains(t, r.buildRsyncArgs(), "-H")
+
+	r.config.PreserveHardLinks = true
+	assert.Contains(t, r.buildRsyncArgs(), "-H")
+}
+
+func TestBuildRsyncArgsSparse(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/var/lib/vm/disk.qcow2", "/srv/vm/disk.qcow2")
+	assert.NotContains(t, r.buildRsyncArgs(), "-S")
+
+	r.config.Sparse = true
+	assert.Contains(t, r.buildRsyncArgs(), "-S")
+}
+
+func TestBuildRsyncArgsStagingDir(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPull, "/srv/db.dump", "/tmp/db.dump")
+	r.config.StagingDir = "/scratch/klip"
+	assert.Contains(t, r.buildRsyncArgs(), "--temp-dir=/scratch/klip")
+}
+
+func TestBuildRsyncArgsChown(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/site", "/srv/www")
+	r.config.Chown = "deploy:www-data"
+	if rsyncSupportsChown(localRsyncVersion()) {
+		assert.Contains(t, r.buildRsyncArgs(), "--chown=deploy:www-data")
+	} else {
+		assert.NotContains(t, r.buildRsyncArgs(), "--chown=deploy:www-data")
+	}
+
+	r = newTestRsyncTransfer(DirectionPull, "/srv/www", "/tmp/site")
+	r.config.Chown = "deploy:www-data"
+	assert.NotContains(t, r.buildRsyncArgs(), "--chown=deploy:www-data")
+}
+
+func TestBuildRsyncArgsChmod(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/site", "/srv/www")
+	assert.NotContains(t, strings.Join(r.buildRsyncArgs(), " "), "--chmod")
+
+	r.config.Chmod = "D755,F644"
+	assert.Contains(t, r.buildRsyncArgs(), "--chmod=D755,F644")
+}
+
+func TestBuildRsyncArgsIncludes(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/src", "/srv/src")
+	r.config.ExcludePatterns = []string{"vendor"}
+	assert.NotContains(t, r.buildRsyncArgs(), "--include")
+
+	r.config.IncludePatterns = []string{"*.go", "go.mod"}
+	args := strings.Join(r.buildRsyncArgs(), " ")
+	assert.Contains(t, args, "--exclude vendor --include */ --include *.go --include go.mod --exclude *")
+}
+
+func TestBuildRsyncArgsLocalPathNotOption(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "--delete", "dest")
+	args := r.buildRsyncArgs()
+	assert.Equal(t, "./--delete", args[len(args)-2])
+
+	r = newTestRsyncTransfer(DirectionPull, "src", "host:file")
+	args = r.buildRsyncArgs()
+	assert.Equal(t, "./host:file", args[len(args)-1])
+}
+
+func TestBuildRsyncArgsIPv6Host(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.ResolvedHost = "fd7a:115c:a1e0::1"
+	args := r.buildRsyncArgs()
+	assert.Equal(t, "user@[fd7a:115c:a1e0::1]:/srv/file", args[len(args)-1])
+}
+
+func TestBuildRsyncArgsQuotesSSHCommand(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.Profile.SSHKeyPath = "/home/user/my keys/id_ed25519"
+	r.config.Profile.SSHPort = 2222
+
+	args := r.buildRsyncArgs()
+
+	var sshCmd string
+	for i, arg := range args {
+		if arg == "-e" {
+			sshCmd = args[i+1]
+		}
+	}
+	assert.True(t, strings.HasPrefix(sshCmd, "ssh -p 2222 -i '/home/user/my keys/id_ed25519' "), sshCmd)
+}
+
+func TestBuildSSHArgsSharesKnownHosts(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	args := r.buildSSHArgs()
+	assert.Equal(t, []string{"-p", "22"}, args[:2])
+	assert.Contains(t, args, "UserKnownHostsFile="+r.config.KnownHostsPath)
+	assert.Contains(t, args, "StrictHostKeyChecking=yes")
+
+	// Without a trust domain, klip's default known_hosts is used
+	r.config.KnownHostsPath = ""
+	args = r.buildSSHArgs()
+	assert.Contains(t, args, "UserKnownHostsFile="+filepath.Join(xdg.ConfigHome, "klip", "known_hosts"))
+	assert.Contains(t, args, "StrictHostKeyChecking=yes")
+
+	// ssh splits the list of files at whitespace, so a path like macOS's
+	// ~/Library/Application Support is quoted, also beside the CA file
+	r.config.KnownHostsPath = "/Users/me/Library/Application Support/klip/known_hosts"
+	r.hostCAKnownHosts = "/tmp/klip-ca"
+	args = r.buildSSHArgs()
+	assert.Contains(t, args, `UserKnownHostsFile="/Users/me/Library/Application Support/klip/known_hosts" /tmp/klip-ca`)
+}
+
+func TestBuildSSHArgsPinnedHostKey(t *testing.T) {
+	dir := t.TempDir()
+	signer, err := gossh.NewSignerFromKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	require.NoError(t, err)
+	require.NoError(t, ssh.AddKnownHost(filepath.Join(dir, "known_hosts"), "db", signer.PublicKey()))
+
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.KnownHostsPath = filepath.Join(dir, "known_hosts")
+	r.config.Profile.HostKeyFingerprint = gossh.FingerprintSHA256(signer.PublicKey())
+	r.config.Profile.JumpHosts = []config.JumpHost{{Host: "bastion"}}
+	pinned, err := r.writePinnedKnownHosts()
+	require.NoError(t, err)
+	defer os.Remove(pinned)
+	r.pinnedKnownHosts = pinned
+
+	// The remote host is checked against the pinned key only, its jump
+	// host against known_hosts
+	args := r.buildSSHArgs()
+	assert.Equal(t, []string{"-o", "UserKnownHostsFile=" + pinned, "-o", "GlobalKnownHostsFile=" + os.DevNull, "-o", "StrictHostKeyChecking=yes"}, args[2:8])
+	proxy := args[len(args)-1]
+	assert.Contains(t, proxy, "UserKnownHostsFile="+r.config.KnownHostsPath)
+	assert.NotContains(t, proxy, pinned)
+
+	r.config.Profile.HostKeyFingerprint = "SHA256:" + strings.Repeat("A", 43)
+	_, err = r.writePinnedKnownHosts()
+	assert.ErrorContains(t, err, "is not in")
+}
+
+func TestBuildSSHArgsHostCA(t *testing.T) {
+	signer, err := gossh.NewSignerFromKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	require.NoError(t, err)
+
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	r.config.HostCAKeys = []string{strings.TrimSpace(string(gossh.MarshalAuthorizedKey(signer.PublicKey())))}
+	r.config.Profile.JumpHosts = []config.JumpHost{{Host: "bastion"}}
+	caFile, err := r.writeHostCAKnownHosts()
+	require.NoError(t, err)
+	defer os.Remove(caFile)
+	r.hostCAKnownHosts = caFile
+
+	data, err := os.ReadFile(caFile)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "@cert-authority * ssh-ed25519 "))
+
+	// The remote host and its jump host trust the CA beside known_hosts
+	args := r.buildSSHArgs()
+	assert.Contains(t, args, "UserKnownHostsFile="+r.config.KnownHostsPath+" "+caFile)
+	assert.Contains(t, args[len(args)-1], quoteRemoteShellArg("UserKnownHostsFile="+r.config.KnownHostsPath+" "+caFile))
+
+	r.config.HostCAKeys = []string{"not a key"}
+	_, err = r.writeHostCAKnownHosts()
+	assert.Error(t, err)
+}
+
+func TestRsyncVetRemoteHost(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.Profile.RemoteHost = "localhost"
+	r.config.Profile.SSHPort = 2222
+
+	// Without allowed_cidrs ssh resolves the name itself
+	require.NoError(t, r.vetRemoteHost(context.Background()))
+	assert.Empty(t, r.vettedHost)
+
+	r.config.Profile.AllowedCIDRs = []string{"10.0.0.0/8"}
+	assert.ErrorContains(t, r.vetRemoteHost(context.Background()), "outside the allowed networks")
+
+	// ssh dials the checked address and looks up the name's host key
+	r.config.Profile.AllowedCIDRs = []string{"127.0.0.0/8", "::1/128"}
+	require.NoError(t, r.vetRemoteHost(context.Background()))
+	assert.True(t, net.ParseIP(r.vettedHost).IsLoopback())
+	assert.Equal(t, "[localhost]:2222", r.hostKeyAlias)
+	assert.Contains(t, r.buildSSHArgs(), "HostKeyAlias=[localhost]:2222")
+	args := r.buildRsyncArgs()
+	assert.Contains(t, args[len(args)-1], r.vettedHost)
+	assert.NotContains(t, args[len(args)-1], "localhost")
+}
+
+func TestBuildSSHArgsTrustDomain(t *testing.T) {
+	keyDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(keyDir, "id_ed25519"), []byte("key"), 0600))
+
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.KnownHostsPath = "/home/user/.config/klip/known_hosts.d/work"
+	r.config.KeyDir = keyDir
+
+	args := strings.Join(r.buildSSHArgs(), " ")
+	assert.Contains(t, args, "UserKnownHostsFile=/home/user/.config/klip/known_hosts.d/work")
+	assert.Contains(t, args, "IdentitiesOnly=yes -i "+filepath.Join(keyDir, "id_ed25519"))
+
+	r.config.Profile.SSHKeyPath = "/home/user/.ssh/work_ed25519"
+	args = strings.Join(r.buildSSHArgs(), " ")
+	assert.NotContains(t, args, "IdentitiesOnly")
+	assert.Contains(t, args, "-i /home/user/.ssh/work_ed25519")
+}
+
+func TestBuildSSHArgsPKCS11Provider(t *testing.T) {
+	keyDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(keyDir, "id_ed25519"), []byte("key"), 0600))
+
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.KeyDir = keyDir
+	r.config.Profile.PKCS11Provider = "/usr/lib/opensc-pkcs11.so"
+
+	args := strings.Join(r.buildSSHArgs(), " ")
+	assert.NotContains(t, args, "IdentitiesOnly")
+	assert.NotContains(t, args, " -i ")
+	assert.NotContains(t, args, "-I")
+}
+
+func TestQuoteRemoteShellArg(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"/path/to/key", "/path/to/key"},
+		{"with space", "'with space'"},
+		{"it's", `'it'"'"'s'`},
+		{"$HOME", "'$HOME'"},
+		{"", "''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.want, quoteRemoteShellArg(tt.input))
+		})
+	}
+}
+
+func TestBuildRsyncArgsDirectoryMode(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/site", "/srv/www")
+	r.config.DirectoryMode = DirModeContents
+	args := r.buildRsyncArgs()
+	assert.Equal(t, "/tmp/site/", args[len(args)-2])
+
+	r.config.DirectoryMode = DirModeInto
+	args = r.buildRsyncArgs()
+	assert.Equal(t, "/tmp/site", args[len(args)-2])
+
+	r = newTestRsyncTransfer(DirectionPull, "/srv/www", "/tmp/site")
+	r.config.DirectoryMode = DirModeContents
+	args = r.buildRsyncArgs()
+	assert.Equal(t, "user@host:/srv/www/", args[len(args)-2])
+}
+
+func TestParseProgressLineOperation(t *testing.T) {
+	tests := []struct {
+		line string
+		want Operation
+	}{
+		{"deleting old/file.txt", OperationDelete},
+		{"created directory /srv/app", OperationMkdir},
+		{"      1,234,567  50%  123.45MB/s    0:00:12", OperationTransfer},
+		{"sent 1,234 bytes  received 56 bytes", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			r := newTestRsyncTransfer(DirectionPush, "/src", "/dest")
+			var got ProgressInfo
+			r.SetProgressCallback(func(info ProgressInfo) { got = info })
+
+			r.parseProgressLine(tt.line)
+			assert.Equal(t, tt.want, got.Operation)
+		})
+	}
+}
+
+func TestBuildSSHArgsJumpHost(t *testing.T) {
+	r := newTestRsyncTransfer(DirectionPush, "/tmp/file", "/srv/file")
+	r.config.Profile.SSHKeyPath = "/home/user/my keys/id_ed25519"
+	r.config.Profile.JumpHost = &config.JumpHost{Host: "bastion", Port: 2222}
+	r.config.ResolvedJumps = []string{"100.64.0.5"}
+
+	args := r.buildSSHArgs()
+
+	var proxy string
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "ProxyCommand=") && args[i-1] == "-o" {
+			proxy = strings.TrimPrefix(arg, "ProxyCommand=")
+		}
+	}
+	assert.True(t, strings.HasPrefix(proxy, "ssh -p 2222 -i '/home/user/my keys/id_ed25519' "), proxy)
+	assert.True(t, strings.HasSuffix(proxy, " -W %h:%p user@100.64.0.5"), proxy)
+	assert.Contains(t, proxy, "StrictHostKeyChecking=yes")
+
+	r.config.Profile.JumpHost = nil
+	r.config.Profile.JumpHosts = []config.JumpHost{{Host: "edge", Key: "/keys/edge"}, {Host: "bastion", User: "ops"}}
+	r.config.ResolvedJumps = []string{"100.64.0.5", "bastion"}
+
+	// Each hop is its own ProxyCommand with its own key, tunnelled through
+	// the previous hop's, with the inner % tokens escaped for the outer ssh
+	args = r.buildSSHArgs()
+	proxy = strings.TrimPrefix(args[len(args)-1], "ProxyCommand=")
+	assert.NotContains(t, proxy, " -J ")
+	assert.True(t, strings.HasPrefix(proxy, "ssh -p 22 -i '/home/user/my keys/id_ed25519' "), proxy)
+	assert.True(t, strings.HasSuffix(proxy, " -W %h:%p ops@bastion"), proxy)
+	assert.Contains(t, proxy, "'ProxyCommand=ssh -p 22 -i /keys/edge ")
+	assert.Contains(t, proxy, "-W %%h:%%p user@100.64.0.5'")
+	assert.Equal(t, "edge", r.config.Profile.JumpHosts[0].Host, "profile left unchanged")
+}
+
+func TestParseRsyncSpeed(t *testing.T) {
+	assert.Equal(t, int64(512), parseRsyncSpeed("512.00B/s"))
+	assert.Equal(t, int64(1536), parseRsyncSpeed("1.50kB/s"))
+	assert.Equal(t, int64(2<<20), parseRsyncSpeed("2.00MB/s"))
+	assert.Equal(t, int64(0), parseRsyncSpeed("fast"))
+	assert.Equal(t, int64(0), parseRsyncSpeed("1.00XB/s"))
+}
+
+func TestScanRsyncLines(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader("file.bin\n  1,024  10%  1.00kB/s  0:00:09\r  10,240 100%  2.00kB/s  0:00:05\n"))
+	scanner.Split(scanRsyncLines)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Equal(t, []string{"file.bin", "  1,024  10%  1.00kB/s  0:00:09", "  10,240 100%  2.00kB/s  0:00:05"}, lines)
+}
@@ -0,0 +1,156 @@
+// Package transfer - Pre-upload scanning
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/tracing"
+)
+
+// scanBatchSize is the number of files passed to one scanner invocation,
+// keeping command lines well below the system argument limit
+const scanBatchSize = 500
+
+// maxScanFindings is the number of scanner output lines kept for summaries
+const maxScanFindings = 20
+
+// ScanResult is the outcome of a pre-upload scan
+type ScanResult struct {
+	// Files is the number of files scanned
+	Files int
+
+	// Clean is true if every scanner invocation exited with status 0
+	Clean bool
+
+	// ExitCode is the first non-zero exit status of the scanner
+	ExitCode int
+
+	// Findings are the last lines of output from failing invocations
+	Findings []string
+}
+
+// Scan runs command over the regular files below source, skipping exclude
+// patterns, with the file paths appended as arguments in batches. A
+// non-zero exit status counts as findings, so the scanner must exit 0 only
+// for clean files (clamscan, trufflehog --fail). An error is returned if
+// the scanner could not be run at all.
+func Scan(ctx context.Context, command []string, source string, excludes []string) (result *ScanResult, err error) {
+	ctx, span := tracing.Start(ctx, "transfer.scan", tracing.String("klip.source", source))
+	defer func() { span.Finish(err) }()
+
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no scan command configured")
+	}
+	program, err := exec.LookPath(command[0])
+	if err != nil {
+		return nil, fmt.Errorf("scan command not found: %w", err)
+	}
+
+	files, err := scanFiles(ctx, source, excludes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files to scan: %w", err)
+	}
+	return scanBatches(ctx, span, command, program, files)
+}
+
+// ScanFiles runs command over the given local files like Scan, for
+// uploads of some files of a directory, such as a sync pass
+func ScanFiles(ctx context.Context, command []string, files []string) (result *ScanResult, err error) {
+	ctx, span := tracing.Start(ctx, "transfer.scan")
+	defer func() { span.Finish(err) }()
+
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no scan command configured")
+	}
+	program, err := exec.LookPath(command[0])
+	if err != nil {
+		return nil, fmt.Errorf("scan command not found: %w", err)
+	}
+	return scanBatches(ctx, span, command, program, files)
+}
+
+// scanBatches runs program, the resolved command[0], over files in
+// batches and records the outcome on span
+func scanBatches(ctx context.Context, span *tracing.Span, command []string, program string, files []string) (*ScanResult, error) {
+	result := &ScanResult{Files: len(files), Clean: true}
+	for start := 0; start < len(files); start += scanBatchSize {
+		batch := files[start:min(start+scanBatchSize, len(files))]
+
+		args := append(append([]string{}, command[1:]...), batch...)
+
+		var output bytes.Buffer
+		cmd := exec.CommandContext(ctx, program, args...)
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			continue
+		case errors.As(err, &exitErr) && ctx.Err() == nil:
+			if result.Clean {
+				result.ExitCode = exitErr.ExitCode()
+			}
+			result.Clean = false
+			result.Findings = append(result.Findings, outputLines(output.String())...)
+		default:
+			return nil, fmt.Errorf("failed to run %s: %w", command[0], err)
+		}
+	}
+
+	if len(result.Findings) > maxScanFindings {
+		result.Findings = result.Findings[len(result.Findings)-maxScanFindings:]
+	}
+
+	span.SetAttrs(tracing.Int("klip.files", result.Files), tracing.Bool("klip.clean", result.Clean))
+	return result, nil
+}
+
+// scanFiles lists the regular files below source, or source itself if it
+// is a file, sorted
+func scanFiles(ctx context.Context, source string, excludes []string) ([]string, error) {
+	root := filepath.Clean(source)
+	filter := newPathFilter(excludes, nil)
+	var files []string
+
+	err := walkTree(ctx, localFS, root, func(name string, info os.FileInfo) error {
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		if rel != "." && filter.skip(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, name)
+		}
+		return nil
+	})
+
+	sort.Strings(files)
+	return files, err
+}
+
+// outputLines splits command output into its non-empty lines
+func outputLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
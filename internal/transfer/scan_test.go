@@ -0,0 +1,53 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"app.conf":         "listen 8080\n",
+		"secrets/.env":     "AWS_SECRET_ACCESS_KEY=abc\n",
+		".git/config":      "AWS_SECRET_ACCESS_KEY=old\n",
+		"docs/readme.txt":  "hello\n",
+		"docs/notes.txt":   "more\n",
+		"empty/.gitignore": "",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(content), 0644))
+	}
+
+	// grep exits 0 when it finds a match, so invert it into a scanner
+	scanner := []string{"sh", "-c", `! grep -H AWS_SECRET "$@"`, "scan"}
+
+	result, err := Scan(context.Background(), scanner, src, []string{".git"})
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Files)
+	assert.False(t, result.Clean)
+	assert.Equal(t, 1, result.ExitCode)
+	require.Len(t, result.Findings, 1)
+	assert.Contains(t, result.Findings[0], filepath.Join("secrets", ".env"))
+
+	result, err = Scan(context.Background(), scanner, src, []string{".git", "secrets"})
+	require.NoError(t, err)
+	assert.True(t, result.Clean)
+	assert.Empty(t, result.Findings)
+
+	result, err = Scan(context.Background(), scanner, filepath.Join(src, "app.conf"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Files)
+	assert.True(t, result.Clean)
+
+	_, err = Scan(context.Background(), []string{"klip-no-such-scanner"}, src, nil)
+	assert.ErrorContains(t, err, "scan command not found")
+
+	_, err = Scan(context.Background(), nil, src, nil)
+	assert.Error(t, err)
+}
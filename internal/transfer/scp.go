@@ -0,0 +1,685 @@
+// Package transfer - SCP transfers for hosts without rsync or SFTP
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/config"
+)
+
+// scpConn is a remote scp speaking the scp protocol over the stdin and
+// stdout of an exec channel
+type scpConn struct {
+	r    *bufio.Reader
+	w    io.WriteCloser
+	wait func() error
+}
+
+// scpStarter starts a remote command for an scp transfer
+type scpStarter func(ctx context.Context, command string) (*scpConn, error)
+
+// scpMove is a pushed file sent under a temporary name, to be moved into
+// place once the transfer succeeded
+type scpMove struct {
+	temp string
+	dest string
+}
+
+// SCPTransfer implements file transfer with the scp protocol, running scp
+// -t or -f on the remote host, for servers with neither rsync nor an SFTP
+// subsystem. It shares the SFTP transfer's handling of local files, modes
+// and progress.
+type SCPTransfer struct {
+	*SFTPTransfer
+	start  scpStarter
+	runner CommandRunner
+
+	// moves are the files of the current push sent under temporary names
+	moves []scpMove
+}
+
+// NewSCPTransfer creates a new SCP-based transfer
+func NewSCPTransfer(cfg *TransferConfig) *SCPTransfer {
+	s := &SCPTransfer{SFTPTransfer: NewSFTPTransfer(cfg), runner: cfg.runner()}
+	s.start = s.startSession
+	return s
+}
+
+// validateSCP rejects options that need SFTP or a remote shell to stat,
+// rename or hash remote files
+func validateSCP(cfg *TransferConfig) error {
+	options := []struct {
+		set  bool
+		name string
+	}{
+		{cfg.Verify, "verify"},
+		{cfg.Sudo, "sudo"},
+		{cfg.PreserveXattrs, "preserve_xattrs"},
+		{cfg.StagingDir != "", "staging_dir"},
+	}
+	for _, option := range options {
+		if option.set {
+			return fmt.Errorf("%s cannot be combined with method scp", option.name)
+		}
+	}
+	return nil
+}
+
+// Execute performs the SCP transfer
+func (s *SCPTransfer) Execute(ctx context.Context) error {
+	if s.config.Direction == DirectionPull {
+		return s.pull(ctx)
+	}
+
+	if err := s.push(ctx); err != nil || s.config.DryRun || s.config.Chown == "" {
+		return err
+	}
+	return chownPushed(ctx, s.config.runner(), s.config)
+}
+
+// startSession runs command in a session on the SSH connection
+func (s *SCPTransfer) startSession(ctx context.Context, command string) (*scpConn, error) {
+	if s.config.SSHClient == nil || !s.config.SSHClient.IsConnected() {
+		return nil, fmt.Errorf("SSH client not connected")
+	}
+
+	session, err := s.config.SSHClient.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start remote scp: %w", err)
+	}
+
+	// Stop the remote side if the transfer is cancelled
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	wait := func() error {
+		defer session.Close()
+		defer close(done)
+		err := session.Wait()
+		if err != nil && stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	return &scpConn{r: bufio.NewReader(stdout), w: stdin, wait: wait}, nil
+}
+
+// command builds the remote scp command line for target. Paths starting
+// with a dash are prefixed with ./ instead of ending the options with --,
+// which the scp of some appliances does not accept.
+func (s *SCPTransfer) command(flags, target string) string {
+	if strings.HasPrefix(target, "-") {
+		target = "./" + target
+	}
+	return fmt.Sprintf("scp %s %s", flags, quoteRemoteShellArg(target))
+}
+
+// ack reads the status the remote scp sends after each message: zero for
+// success, or 1 (warning) or 2 (error) followed by a message
+func (c *scpConn) ack() error {
+	status, err := c.r.ReadByte()
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	switch status {
+	case 0:
+		return nil
+	case 1, 2:
+		message, _ := c.r.ReadString('\n')
+		return fmt.Errorf("remote scp: %s", strings.TrimSpace(message))
+	default:
+		return fmt.Errorf("unexpected scp response %q", status)
+	}
+}
+
+// send sends a protocol message and waits for its status
+func (c *scpConn) send(message string) error {
+	if _, err := io.WriteString(c.w, message+"\n"); err != nil {
+		return err
+	}
+	return c.ack()
+}
+
+// ok sends a success status
+func (c *scpConn) ok() error {
+	_, err := c.w.Write([]byte{0})
+	return err
+}
+
+// close ends the remote scp and waits for it to exit. It returns err, or
+// the exit error of the remote scp if that explains err better.
+func (c *scpConn) close(err error) error {
+	c.w.Close()
+	waitErr := c.wait()
+	if waitErr != nil && (err == nil || err == io.ErrUnexpectedEOF) {
+		return fmt.Errorf("remote scp failed: %w", waitErr)
+	}
+	return err
+}
+
+// sink starts a remote scp receiving into target and waits until it is
+// ready, which fails if target does not suit the flags. With -p, scp sets
+// the modes sent instead of leaving existing files alone.
+func (s *SCPTransfer) sink(ctx context.Context, flags, target string) (*scpConn, error) {
+	flags += " -t"
+	if s.config.PreservePermissions || s.chmod != nil {
+		flags = "-p " + flags
+	}
+	c, err := s.start(ctx, s.command(strings.TrimSpace(flags), target))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.ack(); err != nil {
+		return nil, c.close(err)
+	}
+	return c, nil
+}
+
+// push sends the source to the remote host. Unless uploads are not atomic,
+// files are sent under temporary names and moved into place with mv once
+// all of them arrived, so consumers never see a partial file.
+func (s *SCPTransfer) push(ctx context.Context) error {
+	source := s.config.SourcePath
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+	dest := toUnixPath(s.config.DestPath)
+
+	if s.config.DryRun {
+		return s.listPush(ctx, source, dest, info)
+	}
+
+	s.moves = nil
+	if err := s.pushSource(ctx, source, dest, info); err != nil {
+		s.removeTemps(ctx)
+		return err
+	}
+	return s.commitMoves(ctx)
+}
+
+// pushSource sends the file or directory source to dest
+func (s *SCPTransfer) pushSource(ctx context.Context, source, dest string, info os.FileInfo) error {
+	if !info.IsDir() {
+		if s.config.NoAtomic {
+			c, err := s.sink(ctx, "", dest)
+			if err != nil {
+				return err
+			}
+			return c.close(s.sendFile(ctx, c, source, filepath.Base(source), dest))
+		}
+
+		// The temporary file goes next to the file it replaces, so
+		// whether dest is a directory must be known up front
+		remotePath := dest
+		if s.remoteIsDir(ctx, dest) {
+			remotePath = path.Join(dest, filepath.Base(source))
+		}
+		c, err := s.sink(ctx, "-d", path.Dir(remotePath))
+		if err != nil {
+			return err
+		}
+		return c.close(s.sendFile(ctx, c, source, path.Base(remotePath), remotePath))
+	}
+
+	filter := s.config.filter()
+	root := toUnixPath(Destination(s.config))
+	contents := func(c *scpConn) error {
+		if s.config.DirectoryMode == DirModeInto {
+			return s.sendDir(c, filepath.Base(source), info.Mode(), func() error {
+				return s.sendEntries(ctx, c, filter, source, "", root)
+			})
+		}
+		return s.sendEntries(ctx, c, filter, source, "", root)
+	}
+
+	// -d makes scp check that the destination is a directory; if it does
+	// not exist, the directory sent first creates it instead
+	c, err := s.sink(ctx, "-r -d", dest)
+	if err == nil {
+		return c.close(contents(c))
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if c, err = s.sink(ctx, "-r", dest); err != nil {
+		return err
+	}
+	return c.close(s.sendDir(c, path.Base(dest), info.Mode(), func() error { return contents(c) }))
+}
+
+// remoteIsDir reports whether name is a directory on the remote host
+func (s *SCPTransfer) remoteIsDir(ctx context.Context, name string) bool {
+	if s.runner == nil {
+		return false
+	}
+	_, err := s.runner.RunCommand(ctx, "test -d "+quoteRemoteShellArg(name))
+	return err == nil
+}
+
+// scpMoveBatch is how many files commitMoves moves with one command
+const scpMoveBatch = 100
+
+// commitMoves moves the files sent under temporary names into place
+func (s *SCPTransfer) commitMoves(ctx context.Context) error {
+	if len(s.moves) == 0 {
+		return nil
+	}
+	if s.runner == nil {
+		s.moves = nil
+		return fmt.Errorf("atomic scp uploads need an SSH connection to run mv on the remote host; set no_atomic to write in place")
+	}
+
+	for start := 0; start < len(s.moves); start += scpMoveBatch {
+		end := start + scpMoveBatch
+		if end > len(s.moves) {
+			end = len(s.moves)
+		}
+		commands := make([]string, 0, end-start)
+		for _, move := range s.moves[start:end] {
+			commands = append(commands, fmt.Sprintf("mv -f -- %s %s", quoteRemoteShellArg(move.temp), quoteRemoteShellArg(move.dest)))
+		}
+		if output, err := s.runner.RunCommand(ctx, strings.Join(commands, " && ")); err != nil {
+			s.moves = s.moves[start:]
+			s.removeTemps(ctx)
+			return fmt.Errorf("failed to move uploaded files into place (set no_atomic for hosts without a shell): %w%s", err, commandOutput(output))
+		}
+	}
+	s.moves = nil
+	return nil
+}
+
+// removeTemps removes the temporary files of a failed push, as far as
+// they can be removed
+func (s *SCPTransfer) removeTemps(ctx context.Context) {
+	if s.runner != nil && len(s.moves) > 0 {
+		for start := 0; start < len(s.moves); start += scpMoveBatch {
+			end := start + scpMoveBatch
+			if end > len(s.moves) {
+				end = len(s.moves)
+			}
+			args := make([]string, 0, end-start)
+			for _, move := range s.moves[start:end] {
+				args = append(args, quoteRemoteShellArg(move.temp))
+			}
+			_, _ = s.runner.RunCommand(context.WithoutCancel(ctx), "rm -f -- "+strings.Join(args, " "))
+		}
+	}
+	s.moves = nil
+}
+
+// listPush reports the files a dry run would send
+func (s *SCPTransfer) listPush(ctx context.Context, source, dest string, info os.FileInfo) error {
+	if !info.IsDir() {
+		s.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
+			CurrentFile: source,
+			Message:     fmt.Sprintf("Would transfer: %s -> %s", source, dest),
+		})
+		return nil
+	}
+
+	filter := s.config.filter()
+	root := toUnixPath(Destination(s.config))
+	return walkTree(ctx, localFS, source, func(name string, info os.FileInfo) error {
+		rel, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		if rel != "." && filter.skip(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			s.notifyProgress(ProgressInfo{
+				Operation:   OperationTransfer,
+				CurrentFile: name,
+				Message:     fmt.Sprintf("Would transfer: %s -> %s", name, path.Join(root, filepath.ToSlash(rel))),
+			})
+		}
+		return nil
+	})
+}
+
+// sendEntries sends the files and directories in dir, whose path relative
+// to the source is rel, skipping excluded ones. root is where the source's
+// contents land on the remote host.
+func (s *SCPTransfer) sendEntries(ctx context.Context, c *scpConn, filter *pathFilter, dir, rel, root string) error {
+	entries, err := readLocalDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := filepath.Join(dir, info.Name())
+		entryRel := path.Join(rel, info.Name())
+		if filter.skip(entryRel, info.IsDir()) {
+			continue
+		}
+
+		if info.IsDir() {
+			err = s.sendDir(c, info.Name(), info.Mode(), func() error {
+				return s.sendEntries(ctx, c, filter, name, entryRel, root)
+			})
+		} else {
+			err = s.sendFile(ctx, c, name, info.Name(), path.Join(root, entryRel))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDir sends a directory named name, with the contents sent by contents
+func (s *SCPTransfer) sendDir(c *scpConn, name string, mode os.FileMode, contents func() error) error {
+	if err := checkSCPName(name); err != nil {
+		return err
+	}
+	if err := c.send(fmt.Sprintf("D%04o 0 %s", config.UnixMode(s.sendMode(mode)), name)); err != nil {
+		return err
+	}
+	if err := contents(); err != nil {
+		return err
+	}
+	return c.send("E")
+}
+
+// sendFile sends the local file localPath under name, which lands at
+// remotePath. Unless uploads are not atomic it is sent under a temporary
+// name and recorded for commitMoves. Files that are not regular once
+// symbolic links are followed are skipped.
+func (s *SCPTransfer) sendFile(ctx context.Context, c *scpConn, localPath, name, remotePath string) error {
+	if err := checkSCPName(name); err != nil {
+		return err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open local file: %w", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat local file: %w", err)
+	}
+	if !stat.Mode().IsRegular() {
+		return nil
+	}
+
+	if !s.config.NoAtomic {
+		name += AtomicSuffix
+		s.moves = append(s.moves, scpMove{temp: remotePath + AtomicSuffix, dest: remotePath})
+	}
+	if err := c.send(fmt.Sprintf("C%04o %d %s", config.UnixMode(s.sendMode(stat.Mode())), stat.Size(), name)); err != nil {
+		return err
+	}
+
+	// The size was announced, so a file that shrinks meanwhile cannot be sent
+	data := &io.LimitedReader{R: f, N: stat.Size()}
+	if err := s.copyWithProgress(ctx, c.w, data, 0, stat.Size(), localPath); err != nil {
+		return err
+	}
+	if data.N > 0 {
+		return fmt.Errorf("%s shrank while it was sent", localPath)
+	}
+	if err := c.ok(); err != nil {
+		return err
+	}
+	return c.ack()
+}
+
+// sendMode returns the mode to send for a file or directory of mode
+func (s *SCPTransfer) sendMode(mode os.FileMode) os.FileMode {
+	if s.chmod != nil {
+		return s.chmod.Apply(mode, mode.IsDir())
+	}
+	return mode
+}
+
+// checkSCPName rejects file names the scp protocol cannot carry, or that
+// would leave the directory they are sent to
+func checkSCPName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\n") {
+		return fmt.Errorf("invalid file name for scp: %q", name)
+	}
+	return nil
+}
+
+// parseSCPHeader parses the mode, size and name of a C or D message
+func parseSCPHeader(line string) (os.FileMode, int64, string, error) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid scp message: %q", line)
+	}
+	mode, err := strconv.ParseUint(fields[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid scp message: %q", line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, 0, "", fmt.Errorf("invalid scp message: %q", line)
+	}
+	if err := checkSCPName(fields[2]); err != nil {
+		return 0, 0, "", err
+	}
+	return config.ModeFromUnix(uint32(mode)), size, fields[2], nil
+}
+
+// scpDir is a directory being received
+type scpDir struct {
+	local string
+	rel   string
+	skip  bool
+}
+
+// pull receives the source from the remote host
+func (s *SCPTransfer) pull(ctx context.Context) error {
+	source := toUnixPath(s.config.SourcePath)
+	if s.config.DryRun {
+		s.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
+			CurrentFile: source,
+			Message:     fmt.Sprintf("Would transfer: %s -> %s", source, s.config.DestPath),
+		})
+		return nil
+	}
+
+	c, err := s.start(ctx, s.command("-r -f", source))
+	if err != nil {
+		return err
+	}
+	return c.close(s.receive(ctx, c))
+}
+
+// receive writes the files and directories sent by a remote scp source
+func (s *SCPTransfer) receive(ctx context.Context, c *scpConn) error {
+	var (
+		dirs  []dirMode
+		stack []scpDir
+	)
+	filter := s.config.filter()
+	mkdirAll := func(dir string) error { return os.MkdirAll(dir, 0755) }
+
+	if err := c.ok(); err != nil {
+		return err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		kind, err := c.r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch kind {
+		case 1, 2:
+			return fmt.Errorf("remote scp: %s", line)
+		case 'T':
+			// Modification times are not preserved
+		case 'E':
+			if len(stack) == 0 {
+				return fmt.Errorf("unexpected scp message: E")
+			}
+			stack = stack[:len(stack)-1]
+		case 'C', 'D':
+			mode, size, name, err := parseSCPHeader(line)
+			if err != nil {
+				return err
+			}
+
+			var parent scpDir
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			entry := scpDir{rel: path.Join(parent.rel, name), skip: parent.skip}
+			switch {
+			case len(stack) > 0:
+				entry.local = filepath.Join(parent.local, name)
+				entry.skip = entry.skip || filter.skip(entry.rel, kind == 'D')
+			case kind == 'D' && s.config.DirectoryMode == DirModeInto:
+				entry.local = filepath.Join(s.config.DestPath, name)
+				entry.rel = ""
+			case kind == 'D':
+				entry.local = s.config.DestPath
+				entry.rel = ""
+			case isDirectory(s.config.DestPath):
+				entry.local = filepath.Join(s.config.DestPath, name)
+			default:
+				entry.local = s.config.DestPath
+			}
+
+			if kind == 'D' {
+				if !entry.skip {
+					dirs = append(dirs, dirMode{path: entry.local, mode: mode | os.ModeDir})
+					if err := s.mkdir(entry.local, mkdirAll); err != nil {
+						return err
+					}
+				}
+				stack = append(stack, entry)
+			} else if err := s.receiveFile(ctx, c, entry, mode, size); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected scp message: %q", string(kind)+line)
+		}
+
+		if err := c.ok(); err != nil {
+			return err
+		}
+	}
+
+	if len(stack) > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return s.preserveDirModes(dirs, os.Chmod)
+}
+
+// receiveFile accepts a C message and writes the size bytes of the file
+// sent next, or discards them if the file is excluded. Unless downloads are
+// not atomic, the file is written under a temporary name and renamed into
+// place once complete.
+func (s *SCPTransfer) receiveFile(ctx context.Context, c *scpConn, entry scpDir, mode os.FileMode, size int64) error {
+	if err := c.ok(); err != nil {
+		return err
+	}
+
+	data := &io.LimitedReader{R: c.r, N: size}
+	if entry.skip {
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return err
+		}
+		if data.N > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		return c.ack()
+	}
+
+	target := entry.local
+	if !s.config.NoAtomic {
+		target += AtomicSuffix
+	}
+	err := s.writeReceived(ctx, c, data, target, entry.local, mode, size)
+	if err == nil && target != entry.local {
+		err = os.Rename(target, entry.local)
+	}
+	if err != nil && target != entry.local {
+		os.Remove(target)
+	}
+	return err
+}
+
+// writeReceived writes the file data to target and sets its mode
+func (s *SCPTransfer) writeReceived(ctx context.Context, c *scpConn, data *io.LimitedReader, target, localPath string, mode os.FileMode, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create local directory: %w", err)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	err = s.copyWithProgress(ctx, f, data, 0, size, localPath)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if data.N > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	if err := c.ack(); err != nil {
+		return err
+	}
+	return s.preserveMode(target, mode, os.Chmod)
+}
@@ -0,0 +1,283 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLocalSCPTransfer returns an SCP transfer whose remote scp and
+// commands run locally
+func newLocalSCPTransfer(t *testing.T, cfg *TransferConfig) *SCPTransfer {
+	if _, err := exec.LookPath("scp"); err != nil {
+		t.Skip("scp not installed")
+	}
+
+	s := NewSCPTransfer(cfg)
+	s.runner = &localRunner{}
+	s.start = func(ctx context.Context, command string) (*scpConn, error) {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		stdin, err := cmd.StdinPipe()
+		require.NoError(t, err)
+		stdout, err := cmd.StdoutPipe()
+		require.NoError(t, err)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		require.NoError(t, cmd.Start())
+		return &scpConn{r: bufio.NewReader(stdout), w: stdin, wait: cmd.Wait}, nil
+	}
+	return s
+}
+
+// makeSCPSource creates a small tree with an excluded file
+func makeSCPSource(t *testing.T, root string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sub", "deep"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("alpha"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("bravo"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "deep", "c.txt"), bytes.Repeat([]byte("c"), 100000), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "skip.log"), []byte("log"), 0644))
+}
+
+// assertSCPTree checks the tree made by makeSCPSource arrived at root
+func assertSCPTree(t *testing.T, root string) {
+	data, err := os.ReadFile(filepath.Join(root, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "alpha", string(data))
+	data, err = os.ReadFile(filepath.Join(root, "sub", "deep", "c.txt"))
+	require.NoError(t, err)
+	assert.Len(t, data, 100000)
+	assert.FileExists(t, filepath.Join(root, "sub", "b.txt"))
+	assert.NoFileExists(t, filepath.Join(root, "sub", "skip.log"))
+
+	info, err := os.Stat(filepath.Join(root, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestSCPPushFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "file.txt")
+	require.NoError(t, os.WriteFile(src, []byte("contents"), 0644))
+
+	// A file lands at the destination path, or inside an existing directory
+	dest := filepath.Join(dir, "copy.txt")
+	s := newLocalSCPTransfer(t, &TransferConfig{SourcePath: src, DestPath: dest, Direction: DirectionPush})
+	require.NoError(t, s.Execute(context.Background()))
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(data))
+
+	destDir := filepath.Join(dir, "out")
+	require.NoError(t, os.Mkdir(destDir, 0755))
+	s = newLocalSCPTransfer(t, &TransferConfig{SourcePath: src, DestPath: destDir, Direction: DirectionPush})
+	require.NoError(t, s.Execute(context.Background()))
+	assert.FileExists(t, filepath.Join(destDir, "file.txt"))
+
+	// A missing parent directory is reported by the remote scp
+	s = newLocalSCPTransfer(t, &TransferConfig{SourcePath: src, DestPath: filepath.Join(dir, "missing", "x"), Direction: DirectionPush})
+	assert.Error(t, s.Execute(context.Background()))
+}
+
+// assertNoTemps checks that no temporary file is left below root
+func assertNoTemps(t *testing.T, root string) {
+	t.Helper()
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(name, AtomicSuffix) {
+			t.Errorf("temporary file left behind: %s", name)
+		}
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func TestSCPPushAtomic(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	makeSCPSource(t, src)
+	dest := filepath.Join(dir, "dest")
+
+	// Files are sent under temporary names and moved into place
+	s := newLocalSCPTransfer(t, &TransferConfig{SourcePath: src, DestPath: dest, Direction: DirectionPush, DirectoryMode: DirModeContents})
+	require.NoError(t, s.Execute(context.Background()))
+	assertNoTemps(t, dest)
+	commands := s.runner.(*localRunner).commands
+	require.NotEmpty(t, commands)
+	assert.Contains(t, commands[len(commands)-1], "mv -f -- ")
+	assert.Contains(t, commands[len(commands)-1], "a.txt"+AtomicSuffix)
+
+	// A failed move leaves the files in place and removes the temporary ones
+	target := filepath.Join(dir, "target.txt")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0644))
+	s = newLocalSCPTransfer(t, &TransferConfig{SourcePath: filepath.Join(src, "a.txt"), DestPath: target, Direction: DirectionPush})
+	s.runner = &failingMoveRunner{}
+	assert.ErrorContains(t, s.Execute(context.Background()), "no_atomic")
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	assertNoTemps(t, dir)
+
+	// Without atomic uploads, files are written in place without commands
+	s = newLocalSCPTransfer(t, &TransferConfig{SourcePath: filepath.Join(src, "a.txt"), DestPath: target, Direction: DirectionPush, NoAtomic: true})
+	require.NoError(t, s.Execute(context.Background()))
+	data, err = os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "alpha", string(data))
+	assert.Empty(t, s.runner.(*localRunner).commands)
+}
+
+// failingMoveRunner runs commands locally, except mv
+type failingMoveRunner struct {
+	localRunner
+}
+
+func (r *failingMoveRunner) RunCommand(ctx context.Context, command string) (string, error) {
+	if strings.HasPrefix(command, "mv ") {
+		return "mv: not found", errors.New("exit status 127")
+	}
+	return r.localRunner.RunCommand(ctx, command)
+}
+
+func TestSCPPushDirectory(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	makeSCPSource(t, src)
+
+	for _, mode := range []DirectoryMode{DirModeInto, DirModeContents} {
+		for _, exists := range []bool{true, false} {
+			dest := filepath.Join(t.TempDir(), "dest")
+			if exists {
+				require.NoError(t, os.Mkdir(dest, 0755))
+			}
+
+			s := newLocalSCPTransfer(t, &TransferConfig{
+				SourcePath:          src,
+				DestPath:            dest,
+				Direction:           DirectionPush,
+				DirectoryMode:       mode,
+				ExcludePatterns:     []string{"*.log"},
+				PreservePermissions: true,
+			})
+			require.NoError(t, s.Execute(context.Background()), "mode %v, exists %v", mode, exists)
+
+			root := dest
+			if mode == DirModeInto {
+				root = filepath.Join(dest, "src")
+			}
+			assertSCPTree(t, root)
+		}
+	}
+}
+
+func TestSCPPull(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	makeSCPSource(t, src)
+
+	for _, mode := range []DirectoryMode{DirModeInto, DirModeContents} {
+		dest := t.TempDir()
+		s := newLocalSCPTransfer(t, &TransferConfig{
+			SourcePath:          src,
+			DestPath:            dest,
+			Direction:           DirectionPull,
+			DirectoryMode:       mode,
+			ExcludePatterns:     []string{"*.log"},
+			PreservePermissions: true,
+		})
+		require.NoError(t, s.Execute(context.Background()))
+
+		root := dest
+		if mode == DirModeInto {
+			root = filepath.Join(dest, "src")
+		}
+		assertSCPTree(t, root)
+	}
+
+	// A file lands inside an existing directory
+	dest := t.TempDir()
+	s := newLocalSCPTransfer(t, &TransferConfig{SourcePath: filepath.Join(src, "a.txt"), DestPath: dest, Direction: DirectionPull})
+	require.NoError(t, s.Execute(context.Background()))
+	assert.FileExists(t, filepath.Join(dest, "a.txt"))
+
+	s = newLocalSCPTransfer(t, &TransferConfig{SourcePath: filepath.Join(src, "missing"), DestPath: dest, Direction: DirectionPull})
+	assert.Error(t, s.Execute(context.Background()))
+	assertNoTemps(t, dest)
+}
+
+func TestSCPPullAtomic(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(dest, []byte("old"), 0644))
+
+	// The source ends before its announced size: the existing file is kept
+	s := NewSCPTransfer(&TransferConfig{SourcePath: "app.conf", DestPath: dest, Direction: DirectionPull})
+	s.start = func(ctx context.Context, command string) (*scpConn, error) {
+		cmd := exec.CommandContext(ctx, "sh", "-c", `head -c 1 >/dev/null; printf 'C0644 10 app.conf\nnew'`)
+		stdin, err := cmd.StdinPipe()
+		require.NoError(t, err)
+		stdout, err := cmd.StdoutPipe()
+		require.NoError(t, err)
+		require.NoError(t, cmd.Start())
+		return &scpConn{r: bufio.NewReader(stdout), w: stdin, wait: cmd.Wait}, nil
+	}
+
+	assert.Error(t, s.Execute(context.Background()))
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+	assertNoTemps(t, filepath.Dir(dest))
+}
+
+func TestSCPPullRejectsEscapingNames(t *testing.T) {
+	dest := t.TempDir()
+	s := NewSCPTransfer(&TransferConfig{SourcePath: "src", DestPath: dest, Direction: DirectionPull, DirectoryMode: DirModeInto})
+	s.start = func(ctx context.Context, command string) (*scpConn, error) {
+		cmd := exec.CommandContext(ctx, "sh", "-c", `head -c 1 >/dev/null; printf 'D0755 0 src\n'; head -c 1 >/dev/null; printf 'C0644 3 ../evil\nabc'; cat >/dev/null`)
+		stdin, err := cmd.StdinPipe()
+		require.NoError(t, err)
+		stdout, err := cmd.StdoutPipe()
+		require.NoError(t, err)
+		require.NoError(t, cmd.Start())
+		return &scpConn{r: bufio.NewReader(stdout), w: stdin, wait: cmd.Wait}, nil
+	}
+
+	err := s.Execute(context.Background())
+	assert.ErrorContains(t, err, "invalid file name")
+	assert.NoFileExists(t, filepath.Join(dest, "evil"))
+}
+
+func TestValidateSCP(t *testing.T) {
+	assert.NoError(t, validateSCP(&TransferConfig{Method: "scp", PreservePermissions: true}))
+	assert.ErrorContains(t, validateSCP(&TransferConfig{Method: "scp", Verify: true}), "verify")
+	assert.ErrorContains(t, validateSCP(&TransferConfig{Method: "scp", StagingDir: "/tmp"}), "staging_dir")
+}
+
+func TestResolveMethodSCP(t *testing.T) {
+	noSFTP := &ssh.RemoteCapabilities{POSIXShell: true, HasSCP: true}
+
+	method, reason := ResolveMethod("sftp", noSFTP, false)
+	assert.Equal(t, "scp", method)
+	assert.NotEmpty(t, reason)
+
+	method, _ = ResolveMethod("delta", noSFTP, true)
+	assert.Equal(t, "delta", method)
+
+	method, reason = ResolveMethod("sftp", &ssh.RemoteCapabilities{POSIXShell: true}, false)
+	assert.Equal(t, "sftp", method)
+	assert.Empty(t, reason)
+
+	method, _ = ResolveMethod("rsync", noSFTP, false)
+	assert.Equal(t, "scp", method)
+
+	method, reason = ResolveMethod("sftp", &ssh.RemoteCapabilities{HasSFTP: true, HasSCP: true}, false)
+	assert.Equal(t, "sftp", method)
+	assert.Empty(t, reason)
+}
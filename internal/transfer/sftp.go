@@ -5,21 +5,35 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 
+	"github.com/orpheus497/klip/internal/config"
 	"github.com/pkg/sftp"
 )
 
 // SFTPTransfer implements file transfer using SFTP
 type SFTPTransfer struct {
 	config           *TransferConfig
+	chmod            config.Chmod
 	progressCallback ProgressCallback
+
+	// limiter enforces the bandwidth limit across concurrent copies
+	limiter *rateLimiter
+
+	// mu serializes progress callbacks of concurrently copied files, and
+	// tracker aggregates their progress during a directory transfer
+	mu      sync.Mutex
+	tracker *ProgressTracker
 }
 
 // NewSFTPTransfer creates a new SFTP-based transfer
 func NewSFTPTransfer(cfg *TransferConfig) *SFTPTransfer {
 	return &SFTPTransfer{
-		config: cfg,
+		config:  cfg,
+		chmod:   cfg.chmodRules(),
+		limiter: newRateLimiter(cfg.BandwidthLimit),
 	}
 }
 
@@ -41,6 +55,11 @@ func (s *SFTPTransfer) Execute(ctx context.Context) error {
 	}
 	defer sftpClient.Close()
 
+	// Fail fast on missing remote paths instead of mid-transfer
+	if err := checkRemotePaths(sftpClient, s.config); err != nil {
+		return err
+	}
+
 	// Execute transfer based on direction
 	if s.config.Direction == DirectionPush {
 		return s.push(ctx, sftpClient)
@@ -55,10 +74,28 @@ func (s *SFTPTransfer) push(ctx context.Context, client *sftp.Client) error {
 		return fmt.Errorf("failed to stat source: %w", err)
 	}
 
+	dest := s.config.DestPath
 	if srcInfo.IsDir() {
-		return s.pushDirectory(ctx, client, s.config.SourcePath, s.config.DestPath)
+		if s.config.DirectoryMode == DirModeInto {
+			dest = path.Join(toUnixPath(dest), filepath.Base(s.config.SourcePath))
+		}
+		err = s.pushDirectory(ctx, client, s.config.SourcePath, dest)
+	} else {
+		err = s.pushFile(ctx, client, s.config.SourcePath, dest)
+	}
+
+	if err != nil || s.config.DryRun {
+		return err
+	}
+	if s.config.PreserveXattrs {
+		if err := pushXattrs(ctx, s.config.SSHClient, client, s.config.SourcePath, dest); err != nil {
+			return err
+		}
 	}
-	return s.pushFile(ctx, client, s.config.SourcePath, s.config.DestPath)
+	if s.config.Chown != "" {
+		return chownPushed(ctx, s.config.runner(), s.config)
+	}
+	return nil
 }
 
 // pull transfers files from remote to local
@@ -68,16 +105,33 @@ func (s *SFTPTransfer) pull(ctx context.Context, client *sftp.Client) error {
 		return fmt.Errorf("failed to stat remote source: %w", err)
 	}
 
+	dest := s.config.DestPath
 	if srcInfo.IsDir() {
-		return s.pullDirectory(ctx, client, s.config.SourcePath, s.config.DestPath)
+		if s.config.DirectoryMode == DirModeInto {
+			dest = filepath.Join(dest, path.Base(toUnixPath(s.config.SourcePath)))
+		}
+		var links map[string]string
+		if s.config.PreserveHardLinks {
+			if links, err = remoteHardLinks(ctx, s.config.SSHClient, s.config.SourcePath); err != nil {
+				return err
+			}
+		}
+		err = s.pullDirectory(ctx, client, s.config.SourcePath, dest, links)
+	} else {
+		err = s.pullFile(ctx, client, s.config.SourcePath, dest)
+	}
+
+	if err != nil || !s.config.PreserveXattrs || s.config.DryRun {
+		return err
 	}
-	return s.pullFile(ctx, client, s.config.SourcePath, s.config.DestPath)
+	return pullXattrs(ctx, s.config.SSHClient, s.config.SourcePath, dest)
 }
 
 // pushFile transfers a single file to remote
 func (s *SFTPTransfer) pushFile(ctx context.Context, client *sftp.Client, localPath, remotePath string) error {
 	if s.config.DryRun {
 		s.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
 			CurrentFile: localPath,
 			Message:     fmt.Sprintf("Would transfer: %s -> %s", localPath, remotePath),
 		})
@@ -106,21 +160,65 @@ func (s *SFTPTransfer) pushFile(ctx context.Context, client *sftp.Client, localP
 		}
 	}
 
+	// Send only what an existing remote file lacks
+	if s.config.Method == "delta" {
+		if err := s.pushDelta(ctx, s.config.runner(), client, localFile, stat, localPath, remotePath); !s.fallBack(ctx, err, localPath) {
+			return err
+		}
+	}
+
+	// Upload under a temporary name or into the staging directory so
+	// consumers never see a partial file
+	target := s.config.remoteTemp(remotePath)
+	if s.config.StagingDir != "" {
+		if err := client.MkdirAll(path.Dir(target)); err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+
+	// Continue a partial upload left behind by an interrupted transfer
+	var offset int64
+	if info, err := client.Stat(target); err == nil && info.Mode().IsRegular() {
+		offset = s.resumeOffset(info, stat, target == remotePath,
+			func(n int64) (string, error) { return prefixSHA256(localFile, n) },
+			func(n int64) (string, error) {
+				return remotePrefixSHA256(ctx, s.config.runner(), client, target, n)
+			})
+	}
+
 	// Create remote file
-	remoteFile, err := client.Create(remotePath)
+	remoteFile, err := client.OpenFile(target, resumeFlags(offset))
 	if err != nil {
 		return fmt.Errorf("failed to create remote file: %w", err)
 	}
 	defer remoteFile.Close()
 
 	// Copy with progress
-	return s.copyWithProgress(ctx, remoteFile, localFile, stat.Size(), localPath)
+	err = s.seekResume(remoteFile, localFile, offset, localPath)
+	if err == nil {
+		err = s.copySparse(ctx, remoteFile, localFile, offset, stat.Size(), localPath)
+	}
+	if err == nil {
+		err = remoteFile.Close()
+	}
+	if err == nil {
+		err = s.preserveMode(target, stat.Mode(), client.Chmod)
+	}
+	if err == nil && target != remotePath {
+		err = moveRemote(ctx, s.config.runner(), client, target, remotePath)
+	}
+	if err != nil && target != remotePath && s.config.NoResume {
+		client.Remove(target)
+	}
+
+	return err
 }
 
 // pullFile transfers a single file from remote
 func (s *SFTPTransfer) pullFile(ctx context.Context, client *sftp.Client, remotePath, localPath string) error {
 	if s.config.DryRun {
 		s.notifyProgress(ProgressInfo{
+			Operation:   OperationTransfer,
 			CurrentFile: remotePath,
 			Message:     fmt.Sprintf("Would transfer: %s -> %s", remotePath, localPath),
 		})
@@ -146,24 +244,81 @@ func (s *SFTPTransfer) pullFile(ctx context.Context, client *sftp.Client, remote
 		return fmt.Errorf("failed to create local directory: %w", err)
 	}
 
+	// Fetch only what an existing local file lacks
+	if s.config.Method == "delta" {
+		if err := s.pullDelta(ctx, s.config.runner(), remoteFile, stat, remotePath, localPath); !s.fallBack(ctx, err, remotePath) {
+			return err
+		}
+	}
+
+	// Write into the staging directory first if there is one
+	target := s.config.localTemp(localPath)
+	if target != localPath {
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+
+	// Continue a partial download left behind by an interrupted transfer
+	var offset int64
+	if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() {
+		offset = s.resumeOffset(info, stat, target == localPath,
+			func(n int64) (string, error) {
+				return remotePrefixSHA256(ctx, s.config.runner(), client, remotePath, n)
+			},
+			func(n int64) (string, error) {
+				f, err := os.Open(target)
+				if err != nil {
+					return "", err
+				}
+				defer f.Close()
+				return prefixSHA256(f, n)
+			})
+	}
+
 	// Create local file
-	localFile, err := os.Create(localPath)
+	localFile, err := os.OpenFile(target, resumeFlags(offset), 0666)
 	if err != nil {
 		return fmt.Errorf("failed to create local file: %w", err)
 	}
 	defer localFile.Close()
 
 	// Copy with progress
-	return s.copyWithProgress(ctx, localFile, remoteFile, stat.Size(), remotePath)
+	err = s.seekResume(localFile, remoteFile, offset, remotePath)
+	if err == nil {
+		err = s.copySparse(ctx, localFile, remoteFile, offset, stat.Size(), remotePath)
+	}
+	if err == nil {
+		err = localFile.Close()
+	}
+	if err == nil {
+		err = s.preserveMode(target, stat.Mode(), os.Chmod)
+	}
+	if err == nil && target != localPath {
+		err = moveLocal(target, localPath)
+	}
+	if err != nil && target != localPath && s.config.NoResume {
+		os.Remove(target)
+	}
+
+	return err
 }
 
-// pushDirectory recursively transfers a directory to remote
+// pushDirectory recursively transfers a directory to remote. Directories
+// are created while walking it; files are then copied concurrently and hard
+// links recreated once the files they link to are in place.
 func (s *SFTPTransfer) pushDirectory(ctx context.Context, client *sftp.Client, localPath, remotePath string) error {
-	return filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	var (
+		dirs      []dirMode
+		linkFiles []linkCopy
+	)
+	links := make(hardLinks)
+	filter := s.config.filter()
+	queue, finish := s.fileQueue(ctx, func(ctx context.Context, src, dest string) error {
+		return s.pushFile(ctx, client, src, dest)
+	})
 
+	err := walkTree(ctx, localFS, localPath, func(path string, info os.FileInfo) error {
 		// Check context cancellation
 		select {
 		case <-ctx.Done():
@@ -177,28 +332,64 @@ func (s *SFTPTransfer) pushDirectory(ctx context.Context, client *sftp.Client, l
 			return err
 		}
 
+		if relPath != "." && filter.skip(filepath.ToSlash(relPath), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		remoteDest := filepath.Join(remotePath, relPath)
 
 		if info.IsDir() {
-			if !s.config.DryRun {
-				return client.MkdirAll(remoteDest)
+			dirs = append(dirs, dirMode{path: remoteDest, mode: info.Mode()})
+			return s.mkdir(remoteDest, client.MkdirAll)
+		}
+
+		if s.config.PreserveHardLinks {
+			if key, ok := localLinkKey(info); ok {
+				if first, seen := links.link(key, toUnixPath(remoteDest)); seen {
+					linkFiles = append(linkFiles, linkCopy{src: path, dest: remoteDest, first: first})
+					return nil
+				}
 			}
-			return nil
 		}
 
-		return s.pushFile(ctx, client, path, remoteDest)
+		return queue(fileCopy{src: path, dest: remoteDest, size: info.Size()})
 	})
-}
-
-// pullDirectory recursively transfers a directory from remote
-func (s *SFTPTransfer) pullDirectory(ctx context.Context, client *sftp.Client, remotePath, localPath string) error {
-	walker := client.Walk(remotePath)
+	if err := finish(err); err != nil {
+		return err
+	}
 
-	for walker.Step() {
-		if err := walker.Err(); err != nil {
+	for _, l := range linkFiles {
+		linked, err := s.linkRemote(client, l.first, toUnixPath(l.dest))
+		if err == nil && !linked {
+			err = s.pushFile(ctx, client, l.src, l.dest)
+		}
+		if err != nil {
 			return err
 		}
+	}
+
+	return s.preserveDirModes(dirs, client.Chmod)
+}
+
+// pullDirectory recursively transfers a directory from remote like
+// pushDirectory. remoteLinks maps multiply-linked files to their remoteHardLinks keys
+// (nil unless hard links are preserved)
+func (s *SFTPTransfer) pullDirectory(ctx context.Context, client *sftp.Client, remotePath, localPath string, remoteLinks map[string]string) error {
+	var (
+		dirs      []dirMode
+		linkFiles []linkCopy
+	)
+	links := make(hardLinks)
+	mkdirAll := func(dir string) error { return os.MkdirAll(dir, 0755) }
+	filter := s.config.filter()
+	queue, finish := s.fileQueue(ctx, func(ctx context.Context, src, dest string) error {
+		return s.pullFile(ctx, client, src, dest)
+	})
 
+	err := walkTree(ctx, remoteFS(client), remotePath, func(path string, info os.FileInfo) error {
 		// Check context cancellation
 		select {
 		case <-ctx.Done():
@@ -206,80 +397,148 @@ func (s *SFTPTransfer) pullDirectory(ctx context.Context, client *sftp.Client, r
 		default:
 		}
 
-		path := walker.Path()
-		info := walker.Stat()
-
 		// Calculate relative path
 		relPath, err := filepath.Rel(remotePath, path)
 		if err != nil {
 			return err
 		}
 
+		if relPath != "." && filter.skip(filepath.ToSlash(relPath), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		localDest := filepath.Join(localPath, relPath)
 
 		if info.IsDir() {
-			if !s.config.DryRun {
-				if err := os.MkdirAll(localDest, 0755); err != nil {
-					return err
-				}
+			dirs = append(dirs, dirMode{path: localDest, mode: info.Mode()})
+			return s.mkdir(localDest, mkdirAll)
+		}
+
+		if key, ok := remoteLinks[filepath.ToSlash(relPath)]; ok {
+			if first, seen := links.link(key, localDest); seen {
+				linkFiles = append(linkFiles, linkCopy{src: path, dest: localDest, first: first})
+				return nil
 			}
-			continue
 		}
 
-		if err := s.pullFile(ctx, client, path, localDest); err != nil {
+		return queue(fileCopy{src: path, dest: localDest, size: info.Size()})
+	})
+	if err := finish(err); err != nil {
+		return err
+	}
+
+	for _, l := range linkFiles {
+		if err := s.linkLocal(l.first, l.dest); err != nil {
 			return err
 		}
 	}
 
+	return s.preserveDirModes(dirs, os.Chmod)
+}
+
+// mkdir creates a directory of a directory transfer
+func (s *SFTPTransfer) mkdir(dir string, mkdirAll func(string) error) error {
+	if s.config.DryRun {
+		s.notifyProgress(ProgressInfo{
+			Operation:   OperationMkdir,
+			CurrentFile: dir,
+			Message:     fmt.Sprintf("Would create directory: %s", dir),
+		})
+		return nil
+	}
+
+	if err := mkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	s.notifyProgress(ProgressInfo{
+		Operation:   OperationMkdir,
+		CurrentFile: dir,
+		Message:     fmt.Sprintf("Created directory: %s", dir),
+	})
+
 	return nil
 }
 
-// copyWithProgress copies data with progress reporting
-func (s *SFTPTransfer) copyWithProgress(ctx context.Context, dst io.Writer, src io.Reader, total int64, filename string) error {
-	var written int64
-	buf := make([]byte, 32*1024)
+// dirMode is a created directory and the mode of its source
+type dirMode struct {
+	path string
+	mode os.FileMode
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+// preserveDirModes applies directory modes after their contents have been
+// written, deepest first, so read-only directories can still be filled
+func (s *SFTPTransfer) preserveDirModes(dirs []dirMode, chmod func(string, os.FileMode) error) error {
+	if s.config.DryRun {
+		return nil
+	}
 
-		nr, er := src.Read(buf)
-		if nr > 0 {
-			nw, ew := dst.Write(buf[0:nr])
-			if nw > 0 {
-				written += int64(nw)
-
-				// Report progress
-				s.notifyProgress(ProgressInfo{
-					TotalBytes:       total,
-					TransferredBytes: written,
-					CurrentFile:      filename,
-				})
-			}
-			if ew != nil {
-				return ew
-			}
-			if nr != nw {
-				return io.ErrShortWrite
-			}
-		}
-		if er != nil {
-			if er != io.EOF {
-				return er
-			}
-			break
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := s.preserveMode(dirs[i].path, dirs[i].mode, chmod); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// preserveMode applies the source's permission bits to a transferred file
+// or directory when permissions are preserved, and the chmod overrides on
+// top of them
+func (s *SFTPTransfer) preserveMode(name string, mode os.FileMode, chmod func(string, os.FileMode) error) error {
+	if s.chmod != nil {
+		mode = s.chmod.Apply(mode, mode.IsDir())
+	} else if !s.config.PreservePermissions {
+		return nil
+	}
+
+	perm := mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if err := chmod(name, perm); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", name, err)
+	}
+	s.notifyProgress(ProgressInfo{
+		Operation:   OperationChmod,
+		CurrentFile: name,
+		Message:     fmt.Sprintf("Set mode %04o: %s", mode.Perm(), name),
+	})
+
+	return nil
+}
+
+// copySparse copies data with progress reporting into a newly created or
+// resumed file positioned at offset, leaving runs of zeros as holes if
+// sparse transfers are enabled
+func (s *SFTPTransfer) copySparse(ctx context.Context, dst sparseFile, src io.Reader, offset, total int64, filename string) error {
+	if !s.config.Sparse {
+		return s.copyWithProgress(ctx, dst, src, offset, total, filename)
+	}
+
+	w := &sparseWriter{file: dst, offset: offset}
+	if err := s.copyWithProgress(ctx, w, src, offset, total, filename); err != nil {
+		return err
+	}
+	return w.Finish()
+}
+
+// copyWithProgress copies data with progress reporting, counting from
+// offset bytes already transferred
+func (s *SFTPTransfer) copyWithProgress(ctx context.Context, dst io.Writer, src io.Reader, offset, total int64, filename string) error {
+	if s.limiter != nil {
+		src = &limitedReader{ctx: ctx, r: src, limiter: s.limiter}
+	}
+	return copyProgress(ctx, dst, src, offset, total, filename, s.notifyProgress)
+}
+
 // notifyProgress sends progress information to the callback
 func (s *SFTPTransfer) notifyProgress(info ProgressInfo) {
+	if s.tracker != nil && info.Operation == OperationTransfer {
+		info = s.tracker.Update(info)
+	}
 	if s.progressCallback != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
 		s.progressCallback(info)
 	}
 }
@@ -0,0 +1,127 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSFTPPushDirectoryOperations(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0750))
+	require.NoError(t, os.Chmod(src, 0555))
+	t.Cleanup(func() { os.Chmod(src, 0755) })
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	s := NewSFTPTransfer(&TransferConfig{PreservePermissions: true})
+
+	ops := make(map[Operation]int)
+	s.SetProgressCallback(func(info ProgressInfo) { ops[info.Operation]++ })
+
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest))
+	t.Cleanup(func() { os.Chmod(dest, 0755) })
+
+	assert.Equal(t, 2, ops[OperationMkdir])
+	assert.Equal(t, 3, ops[OperationChmod])
+	assert.Positive(t, ops[OperationTransfer])
+
+	info, err := os.Stat(filepath.Join(dest, "bin", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	info, err = os.Stat(dest)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0555), info.Mode().Perm(), "read-only directory mode applied after its contents")
+}
+
+func TestSFTPPushDirectoryChmod(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "private"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "private", "index.html"), []byte("hi"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "deploy.sh"), []byte("#!/bin/sh\n"), 0700))
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	s := NewSFTPTransfer(&TransferConfig{Chmod: "D755,F644,Fu+X"})
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest))
+
+	for name, want := range map[string]os.FileMode{
+		"":                   0755,
+		"private":            0755,
+		"private/index.html": 0644,
+		"deploy.sh":          0644,
+	} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		require.NoError(t, err)
+		assert.Equal(t, want, info.Mode().Perm(), name)
+	}
+}
+
+func TestSFTPPushDirectoryExcludes(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"main.go", ".git/HEAD", "pkg/.DS_Store", "pkg/util.go", "node_modules/left-pad/index.js"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), 0644))
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	s := NewSFTPTransfer(&TransferConfig{ExcludePatterns: []string{".git", "node_modules", ".DS_Store"}})
+	require.NoError(t, s.pushDirectory(context.Background(), newPipeSFTPClient(t), src, dest))
+
+	assert.FileExists(t, filepath.Join(dest, "main.go"))
+	assert.FileExists(t, filepath.Join(dest, "pkg", "util.go"))
+	assert.NoDirExists(t, filepath.Join(dest, ".git"))
+	assert.NoDirExists(t, filepath.Join(dest, "node_modules"))
+	assert.NoFileExists(t, filepath.Join(dest, "pkg", ".DS_Store"))
+}
+
+func TestSFTPPushDirectoryMode(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "site")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "index.html"), []byte("hi"), 0644))
+
+	for mode, want := range map[DirectoryMode]string{
+		DirModeInto:     "site/index.html",
+		DirModeContents: "index.html",
+	} {
+		dest := t.TempDir()
+		s := NewSFTPTransfer(&TransferConfig{SourcePath: src, DestPath: dest, DirectoryMode: mode})
+		require.NoError(t, s.push(context.Background(), newPipeSFTPClient(t)))
+		assert.FileExists(t, filepath.Join(dest, want))
+	}
+}
+
+func TestSFTPPushFileAtomic(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(src, []byte("a,b,c\n"), 0644))
+
+	for _, noAtomic := range []bool{false, true} {
+		dest := filepath.Join(t.TempDir(), "report.csv")
+		s := NewSFTPTransfer(&TransferConfig{NoAtomic: noAtomic})
+
+		var sawFinal, sawTemp bool
+		s.SetProgressCallback(func(info ProgressInfo) {
+			if info.Operation != OperationTransfer {
+				return
+			}
+			_, err := os.Stat(dest)
+			sawFinal = sawFinal || err == nil
+			_, err = os.Stat(dest + AtomicSuffix)
+			sawTemp = sawTemp || err == nil
+		})
+
+		require.NoError(t, s.pushFile(context.Background(), newPipeSFTPClient(t), src, dest))
+
+		assert.Equal(t, noAtomic, sawFinal, "destination visible during upload")
+		assert.Equal(t, !noAtomic, sawTemp, "temporary file used")
+		assert.NoFileExists(t, dest+AtomicSuffix)
+
+		data, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "a,b,c\n", string(data))
+	}
+}
@@ -0,0 +1,60 @@
+// Package transfer - Sparse file writes
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// sparseBlockSize is the granularity at which runs of zeros become holes
+const sparseBlockSize = 4096
+
+// sparseFile is a destination file that can be written sparsely, e.g.
+// *os.File or *sftp.File
+type sparseFile interface {
+	io.WriteSeeker
+	Truncate(size int64) error
+}
+
+// sparseWriter writes through to a newly created file but seeks over
+// blocks of zeros instead of writing them, so they become holes on
+// filesystems that support them. Finish must be called after the last
+// write to extend the file over a trailing hole.
+type sparseWriter struct {
+	file   sparseFile
+	offset int64
+}
+
+// Write writes p, skipping blocks that are all zeros
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	var zeros [sparseBlockSize]byte
+
+	written := 0
+	for written < len(p) {
+		block := p[written:min(written+sparseBlockSize, len(p))]
+
+		if bytes.Equal(block, zeros[:len(block)]) {
+			if _, err := w.file.Seek(int64(len(block)), io.SeekCurrent); err != nil {
+				return written, fmt.Errorf("failed to skip hole: %w", err)
+			}
+		} else if n, err := w.file.Write(block); err != nil {
+			return written + n, err
+		}
+
+		written += len(block)
+		w.offset += int64(len(block))
+	}
+
+	return written, nil
+}
+
+// Finish sets the file size to the number of bytes written, which
+// materializes a hole at the end of the file
+func (w *sparseWriter) Finish() error {
+	if err := w.file.Truncate(w.offset); err != nil {
+		return fmt.Errorf("failed to set sparse file size: %w", err)
+	}
+	return nil
+}
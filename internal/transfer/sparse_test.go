@@ -0,0 +1,62 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sparseImage returns data with a hole at the start, in the middle and at
+// the end, like a preallocated disk image
+func sparseImage() []byte {
+	data := make([]byte, 10*sparseBlockSize+100)
+	copy(data[2*sparseBlockSize:], bytes.Repeat([]byte("boot"), 1000))
+	copy(data[7*sparseBlockSize+10:], []byte("superblock"))
+	return data
+}
+
+func TestSparseWriter(t *testing.T) {
+	data := sparseImage()
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.img"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	w := &sparseWriter{file: f}
+	n, err := w.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	require.NoError(t, w.Finish())
+
+	got, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assertHoles(t, f.Name())
+}
+
+func TestSFTPPushFileSparse(t *testing.T) {
+	dir := t.TempDir()
+	data := sparseImage()
+	local := filepath.Join(dir, "disk.img")
+	require.NoError(t, os.WriteFile(local, data, 0644))
+
+	remote := filepath.Join(dir, "remote.img")
+	s := NewSFTPTransfer(&TransferConfig{Sparse: true})
+	require.NoError(t, s.pushFile(context.Background(), newPipeSFTPClient(t), local, remote))
+
+	got, err := os.ReadFile(remote)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assertHoles(t, remote)
+
+	pulled := filepath.Join(dir, "pulled.img")
+	require.NoError(t, s.pullFile(context.Background(), newPipeSFTPClient(t), remote, pulled))
+	got, err = os.ReadFile(pulled)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assertHoles(t, pulled)
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allocatedBytes returns the disk space allocated to a file
+func allocatedBytes(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	return int64(stat.Blocks) * 512
+}
+
+// assertHoles checks that the file at path has fewer bytes allocated than
+// its size, i.e. that runs of zeros were skipped rather than written. It
+// is skipped on filesystems without holes.
+func assertHoles(t *testing.T, path string) {
+	t.Helper()
+
+	probe := filepath.Join(t.TempDir(), "probe")
+	require.NoError(t, os.WriteFile(probe, nil, 0644))
+	require.NoError(t, os.Truncate(probe, 1<<20))
+	if allocatedBytes(t, probe) > 0 {
+		t.Log("filesystem does not support holes")
+		return
+	}
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, allocatedBytes(t, path), info.Size(), "%s has no holes", path)
+}
@@ -0,0 +1,105 @@
+// Package transfer - Staging directory for partial files
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+)
+
+// stagingName is the name a file destined for dest is staged under; the
+// hash keeps files with the same name from different directories apart
+func stagingName(dest string) string {
+	sum := sha256.Sum256([]byte(dest))
+	return ".klip-" + hex.EncodeToString(sum[:6]) + "-" + path.Base(toUnixPath(dest)) + AtomicSuffix
+}
+
+// remoteTemp returns where a push to remotePath is written until it is
+// complete: the staging directory, a temporary name next to remotePath, or
+// remotePath itself if uploads are not atomic
+func (c *TransferConfig) remoteTemp(remotePath string) string {
+	if c.StagingDir != "" {
+		return path.Join(toUnixPath(c.StagingDir), stagingName(remotePath))
+	}
+	if !c.NoAtomic {
+		return remotePath + AtomicSuffix
+	}
+	return remotePath
+}
+
+// localTemp returns where a pull to localPath is written until it is
+// complete: the staging directory or localPath itself
+func (c *TransferConfig) localTemp(localPath string) string {
+	if c.StagingDir != "" {
+		return filepath.Join(c.StagingDir, stagingName(localPath))
+	}
+	return localPath
+}
+
+// runner returns the SSH client for remote commands, or nil without one
+func (c *TransferConfig) runner() CommandRunner {
+	if c.SSHClient == nil {
+		return nil
+	}
+	return c.SSHClient
+}
+
+// moveRemote moves a finished file into place on the remote host. A
+// staging directory may be on another filesystem, which SFTP cannot rename
+// across, so a failed rename is retried with mv when runner is set.
+func moveRemote(ctx context.Context, runner CommandRunner, client *sftp.Client, oldname, newname string) error {
+	err := RemoteRename(client, oldname, newname)
+	if err == nil || runner == nil {
+		return err
+	}
+
+	command := fmt.Sprintf("mv -f -- %s %s", quoteRemoteShellArg(oldname), quoteRemoteShellArg(newname))
+	if _, mvErr := runner.RunCommand(ctx, command); mvErr != nil {
+		return err
+	}
+	return nil
+}
+
+// moveLocal moves a finished file into place locally, copying it if the
+// staging directory is on another filesystem
+func moveLocal(oldname, newname string) error {
+	if err := os.Rename(oldname, newname); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(oldname)
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", oldname, newname, err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", oldname, newname, err)
+	}
+
+	out, err := os.OpenFile(newname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", oldname, newname, err)
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(newname, info.Mode().Perm())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", oldname, newname, err)
+	}
+
+	return os.Remove(oldname)
+}
@@ -0,0 +1,80 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagingName(t *testing.T) {
+	a := stagingName("/srv/www/a/index.html")
+	b := stagingName("/srv/www/b/index.html")
+	assert.NotEqual(t, a, b)
+	assert.Contains(t, a, "index.html")
+	assert.Equal(t, a, stagingName("/srv/www/a/index.html"))
+}
+
+func TestSFTPStagingDir(t *testing.T) {
+	dir := t.TempDir()
+	staging := filepath.Join(dir, "staging")
+	local := filepath.Join(dir, "disk.img")
+	require.NoError(t, os.WriteFile(local, []byte("image"), 0640))
+
+	var stagedFiles []string
+	s := NewSFTPTransfer(&TransferConfig{StagingDir: staging, PreservePermissions: true})
+	s.SetProgressCallback(func(info ProgressInfo) {
+		entries, _ := os.ReadDir(staging)
+		for _, entry := range entries {
+			stagedFiles = append(stagedFiles, entry.Name())
+		}
+	})
+
+	remote := filepath.Join(dir, "remote", "disk.img")
+	require.NoError(t, s.pushFile(context.Background(), newPipeSFTPClient(t), local, remote))
+
+	data, err := os.ReadFile(remote)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+	assert.Contains(t, stagedFiles, stagingName(remote), "written to the staging directory first")
+	assert.NoFileExists(t, remote+AtomicSuffix)
+
+	entries, err := os.ReadDir(staging)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	stagedFiles = nil
+	pulled := filepath.Join(dir, "pulled.img")
+	require.NoError(t, s.pullFile(context.Background(), newPipeSFTPClient(t), remote, pulled))
+
+	data, err = os.ReadFile(pulled)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+	assert.Contains(t, stagedFiles, stagingName(pulled))
+
+	info, err := os.Stat(pulled)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	entries, err = os.ReadDir(staging)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestMoveLocal(t *testing.T) {
+	dir := t.TempDir()
+	oldname := filepath.Join(dir, "staged")
+	newname := filepath.Join(dir, "final")
+	require.NoError(t, os.WriteFile(oldname, []byte("data"), 0600))
+	require.NoError(t, os.WriteFile(newname, []byte("old data"), 0644))
+
+	require.NoError(t, moveLocal(oldname, newname))
+
+	data, err := os.ReadFile(newname)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	assert.NoFileExists(t, oldname)
+}
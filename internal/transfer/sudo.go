@@ -0,0 +1,175 @@
+// Package transfer - Sudo-assisted pushes to privileged paths
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SudoPasswordFunc returns the sudo password for the remote user; it is
+// only called if sudo asks for one
+type SudoPasswordFunc func() (string, error)
+
+// InputRunner runs a shell command on the remote host with input on its
+// stdin, e.g. *ssh.Client
+type InputRunner interface {
+	CommandRunner
+	RunCommandInput(ctx context.Context, command string, input io.Reader) (string, error)
+}
+
+// SudoTransfer pushes files the remote user cannot write: they are
+// uploaded into a private staging directory and then copied into place as
+// root with sudo
+type SudoTransfer struct {
+	config           *TransferConfig
+	runner           InputRunner
+	progressCallback ProgressCallback
+}
+
+// NewSudoTransfer creates a new sudo-assisted push
+func NewSudoTransfer(cfg *TransferConfig) *SudoTransfer {
+	s := &SudoTransfer{config: cfg}
+	if cfg.SSHClient != nil {
+		s.runner = cfg.SSHClient
+	}
+	return s
+}
+
+// SetProgressCallback sets the progress callback
+func (s *SudoTransfer) SetProgressCallback(callback ProgressCallback) {
+	s.progressCallback = callback
+}
+
+// Execute uploads into the staging directory and installs the files
+func (s *SudoTransfer) Execute(ctx context.Context) error {
+	if s.runner == nil {
+		return fmt.Errorf("SSH client not connected")
+	}
+
+	final := toUnixPath(Destination(s.config))
+	if s.config.DryRun {
+		s.notifyProgress(ProgressInfo{
+			Operation: OperationTransfer,
+			Message:   fmt.Sprintf("Would install %s into %s with sudo", s.config.SourcePath, final),
+		})
+		return nil
+	}
+
+	// Authenticate before uploading so a wrong password fails fast
+	sudo, password, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	staging, err := s.makeStagingDir(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.runner.RunCommand(context.Background(), "rm -rf -- "+quoteRemoteShellArg(staging))
+
+	inner := *s.config
+	inner.Sudo = false
+	inner.SudoPassword = nil
+	inner.Chown = ""
+	inner.DestPath = staging
+	if !isDirectory(s.config.SourcePath) {
+		inner.DestPath = path.Join(staging, filepath.Base(s.config.SourcePath))
+	}
+
+	xfer, err := newMethodTransfer(&inner)
+	if err != nil {
+		return err
+	}
+	xfer.SetProgressCallback(s.progressCallback)
+	if err := xfer.Execute(ctx); err != nil {
+		return err
+	}
+
+	s.notifyProgress(ProgressInfo{
+		Operation: OperationTransfer,
+		Message:   fmt.Sprintf("Installing into %s with sudo", final),
+	})
+	install := installCommand(toUnixPath(Destination(&inner)), final, isDirectory(s.config.SourcePath))
+	if s.config.Chmod != "" {
+		// New files keep the staged modes exactly instead of losing bits
+		// to root's umask
+		install = "umask 000 && " + install
+	}
+	if chown := pushedChownCommand(s.config); s.config.Chown != "" && chown != "" {
+		install += " && " + chown
+	}
+	command := sudo + " sh -c " + quoteRemoteShellArg(install)
+	if output, err := s.runner.RunCommandInput(ctx, command, strings.NewReader(password)); err != nil {
+		return fmt.Errorf("failed to install into %s: %w%s", final, err, commandOutput(output))
+	}
+	return nil
+}
+
+// authenticate returns the sudo invocation to use and the input it reads
+// the password from, asking for the password only if sudo needs one
+func (s *SudoTransfer) authenticate(ctx context.Context) (string, string, error) {
+	if _, err := s.runner.RunCommand(ctx, "sudo -n true"); err == nil {
+		return "sudo -n", "", nil
+	}
+	if s.config.SudoPassword == nil {
+		return "", "", fmt.Errorf("sudo requires a password on the remote host")
+	}
+
+	password, err := s.config.SudoPassword()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read sudo password: %w", err)
+	}
+	password += "\n"
+
+	// -k ignores cached credentials so the password is always checked
+	if output, err := s.runner.RunCommandInput(ctx, "sudo -k -S -p '' true", strings.NewReader(password)); err != nil {
+		return "", "", fmt.Errorf("sudo authentication failed: %w%s", err, commandOutput(output))
+	}
+	return "sudo -S -p ''", password, nil
+}
+
+// makeStagingDir creates a directory only the remote user can read, under
+// the profile's staging directory or the remote temporary directory
+func (s *SudoTransfer) makeStagingDir(ctx context.Context) (string, error) {
+	base := `"${TMPDIR:-/tmp}"`
+	if s.config.StagingDir != "" {
+		base = quoteRemoteShellArg(toUnixPath(s.config.StagingDir))
+	}
+
+	output, err := s.runner.RunCommand(ctx, "mktemp -d "+base+"/klip-sudo.XXXXXX")
+	if err != nil {
+		return "", fmt.Errorf("failed to create remote staging directory: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// installCommand copies the staged file or directory to final. Files are
+// created by root: new files take their mode from the staged file minus
+// root's umask, and existing files keep their owner and mode.
+func installCommand(staged, final string, dir bool) string {
+	if dir {
+		return fmt.Sprintf("mkdir -p -- %s && cp -R -- %s %s",
+			quoteRemoteShellArg(final), quoteRemoteShellArg(staged+"/."), quoteRemoteShellArg(final+"/"))
+	}
+	return fmt.Sprintf("mkdir -p -- %s && cp -- %s %s",
+		quoteRemoteShellArg(path.Dir(final)), quoteRemoteShellArg(staged), quoteRemoteShellArg(final))
+}
+
+// commandOutput formats remote command output for an error message
+func commandOutput(output string) string {
+	if output = strings.TrimSpace(output); output == "" {
+		return ""
+	}
+	return ": " + output
+}
+
+func (s *SudoTransfer) notifyProgress(info ProgressInfo) {
+	if s.progressCallback != nil {
+		s.progressCallback(info)
+	}
+}
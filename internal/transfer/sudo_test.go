@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSudo puts a sudo on PATH that runs its command as the current user,
+// accepting "secret" as the password unless nopasswd is set
+func fakeSudo(t *testing.T, nopasswd bool) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-n) [ -n "$NOPASSWD" ] || exit 1; shift ;;
+	-k) shift ;;
+	-S) read -r password; [ "$password" = secret ] || { echo "Sorry, try again." >&2; exit 1; }; shift ;;
+	-p) shift 2 ;;
+	*) break ;;
+	esac
+done
+exec "$@"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sudo"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if nopasswd {
+		t.Setenv("NOPASSWD", "1")
+	} else {
+		t.Setenv("NOPASSWD", "")
+	}
+}
+
+func TestSudoAuthenticate(t *testing.T) {
+	ctx := context.Background()
+
+	fakeSudo(t, true)
+	s := &SudoTransfer{config: &TransferConfig{}, runner: &localRunner{}}
+	sudo, password, err := s.authenticate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "sudo -n", sudo)
+	assert.Empty(t, password)
+
+	fakeSudo(t, false)
+	_, _, err = s.authenticate(ctx)
+	assert.ErrorContains(t, err, "requires a password")
+
+	asked := 0
+	s.config.SudoPassword = func() (string, error) {
+		asked++
+		return "secret", nil
+	}
+	sudo, password, err = s.authenticate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, asked)
+	assert.Equal(t, "sudo -S -p ''", sudo)
+	assert.Equal(t, "secret\n", password)
+
+	s.config.SudoPassword = func() (string, error) { return "wrong", nil }
+	_, _, err = s.authenticate(ctx)
+	assert.ErrorContains(t, err, "Sorry, try again.")
+}
+
+func TestSudoInstall(t *testing.T) {
+	fakeSudo(t, false)
+	dir := t.TempDir()
+	runner := &localRunner{}
+	s := &SudoTransfer{config: &TransferConfig{StagingDir: dir}, runner: runner}
+
+	staging, err := s.makeStagingDir(context.Background())
+	require.NoError(t, err)
+	assert.DirExists(t, staging)
+	assert.Equal(t, dir, filepath.Dir(staging))
+
+	staged := filepath.Join(staging, "site")
+	require.NoError(t, os.MkdirAll(filepath.Join(staged, "css"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(staged, "css", "main.css"), []byte("body{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(staging, "app.conf"), []byte("key=value"), 0600))
+
+	final := filepath.Join(dir, "etc", "site")
+	command := "sudo -S -p '' sh -c " + quoteRemoteShellArg(installCommand(staged, final, true))
+	_, err = runner.RunCommandInput(context.Background(), command, strings.NewReader("secret\n"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(final, "css", "main.css"))
+	require.NoError(t, err)
+	assert.Equal(t, "body{}", string(data))
+
+	// A file copied onto an existing directory lands inside it
+	etc := filepath.Join(dir, "etc")
+	command = "sudo -S -p '' sh -c " + quoteRemoteShellArg(installCommand(filepath.Join(staging, "app.conf"), etc, false))
+	_, err = runner.RunCommandInput(context.Background(), command, strings.NewReader("secret\n"))
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(etc, "app.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "key=value", string(data))
+
+	// Files may be installed under a new name in a new directory
+	renamed := filepath.Join(dir, "usr", "local", "etc", "renamed.conf")
+	command = "sudo -S -p '' sh -c " + quoteRemoteShellArg(installCommand(filepath.Join(staging, "app.conf"), renamed, false))
+	_, err = runner.RunCommandInput(context.Background(), command, strings.NewReader("secret\n"))
+	require.NoError(t, err)
+	assert.FileExists(t, renamed)
+}
+
+func TestNewTransferSudo(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app.conf")
+	require.NoError(t, os.WriteFile(src, []byte("key=value"), 0644))
+
+	xfer, err := NewTransfer(&TransferConfig{SourcePath: src, DestPath: "/etc/app.conf", Method: "sftp", Sudo: true})
+	require.NoError(t, err)
+	assert.IsType(t, &SudoTransfer{}, xfer)
+
+	_, err = NewTransfer(&TransferConfig{SourcePath: src, DestPath: "/etc/app.conf", Method: "sftp", Sudo: true, DeleteAfterTransfer: true})
+	assert.ErrorContains(t, err, "delete_after_transfer")
+
+	_, err = NewTransfer(&TransferConfig{SourcePath: "/etc/app.conf", DestPath: filepath.Join(dir, "pulled"), Method: "sftp", Direction: DirectionPull, Sudo: true})
+	assert.ErrorContains(t, err, "only supported for pushes")
+}
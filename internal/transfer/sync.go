@@ -0,0 +1,752 @@
+// Package transfer - Bidirectional directory synchronization
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/orpheus497/klip/internal/config"
+	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/pkg/sftp"
+)
+
+// SyncConfig configures a bidirectional sync of a local and a remote
+// directory
+type SyncConfig struct {
+	// SSHClient is the connection to the remote host
+	SSHClient *ssh.Client
+
+	// LocalDir and RemoteDir are the synchronized directories; a leading
+	// ~/ in RemoteDir is the remote home directory
+	LocalDir  string
+	RemoteDir string
+
+	// ExcludePatterns and IncludePatterns select the synchronized files,
+	// as for transfers
+	ExcludePatterns []string
+	IncludePatterns []string
+
+	// Checksum compares the SHA-256 of files whose size or modification
+	// time changed with the last sync, so files that were only touched are
+	// not transferred
+	Checksum bool
+
+	// DryRun reports what would be done without changing either side
+	DryRun bool
+
+	// Resolver decides conflicts; without one they are skipped
+	Resolver ConflictResolver
+
+	// Chmod, Chown and BandwidthLimit apply to pushed files as for
+	// transfers
+	Chmod          string
+	Chown          string
+	BandwidthLimit int
+
+	// ApprovePush is asked with the local paths of the files a pass may
+	// push, such as to scan them or check them against the upload limits;
+	// false aborts the pass before anything is changed
+	ApprovePush func(ctx context.Context, files []string) bool
+
+	// ConfirmDeleteAll is asked before a pass deletes files on one side
+	// because the other side ("local" or "remote") is empty although files
+	// were synchronized before, as happens when a disk is not mounted.
+	// Without it such a pass fails.
+	ConfirmDeleteAll func(side string, files int) bool
+
+	// State is the directory pair as of the last sync, updated as files
+	// are synchronized
+	State *SyncState
+}
+
+// SyncResult lists what a sync did, by slash-separated relative path
+type SyncResult struct {
+	Pushed        []string `json:"pushed,omitempty"`
+	Pulled        []string `json:"pulled,omitempty"`
+	DeletedLocal  []string `json:"deleted_local,omitempty"`
+	DeletedRemote []string `json:"deleted_remote,omitempty"`
+
+	// Conflicts are the files changed on both sides, and Unresolved those
+	// of them left as they were
+	Conflicts  []string `json:"conflicts,omitempty"`
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// Changes returns the number of files transferred or deleted
+func (r *SyncResult) Changes() int {
+	return len(r.Pushed) + len(r.Pulled) + len(r.DeletedLocal) + len(r.DeletedRemote)
+}
+
+// Diverged returns the files that differ between the two sides, whether
+// the pass synchronized them or not (as in a dry run), in path order
+func (r *SyncResult) Diverged() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, list := range [][]string{r.Pushed, r.Pulled, r.DeletedLocal, r.DeletedRemote, r.Conflicts, r.Unresolved} {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				files = append(files, name)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Syncer synchronizes a local and a remote directory in both directions,
+// like unison: files changed on one side since the last sync are copied to
+// the other, files deleted on one side are deleted on the other, and files
+// changed on both sides are conflicts for the resolver
+type Syncer struct {
+	config           *SyncConfig
+	progressCallback ProgressCallback
+
+	// skipped holds the conflicts left unresolved, which are not brought
+	// up again in later passes until either side changes
+	skipped map[string]Conflict
+}
+
+// NewSyncer creates a new syncer
+func NewSyncer(cfg *SyncConfig) (*Syncer, error) {
+	if cfg.LocalDir == "" || cfg.RemoteDir == "" {
+		return nil, fmt.Errorf("local and remote directories are required")
+	}
+	if cfg.State == nil {
+		return nil, fmt.Errorf("sync state is required")
+	}
+	for _, pattern := range cfg.ExcludePatterns {
+		if err := ValidateExcludePattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range cfg.IncludePatterns {
+		if err := ValidateExcludePattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+	}
+	if cfg.Chown != "" {
+		if _, _, err := config.ParseOwner(cfg.Chown); err != nil {
+			return nil, fmt.Errorf("invalid chown: %w", err)
+		}
+	}
+	if cfg.Chmod != "" {
+		if _, err := config.ParseChmod(cfg.Chmod); err != nil {
+			return nil, fmt.Errorf("invalid chmod: %w", err)
+		}
+	}
+	return &Syncer{config: cfg, skipped: make(map[string]Conflict)}, nil
+}
+
+// SetProgressCallback sets the progress callback
+func (s *Syncer) SetProgressCallback(callback ProgressCallback) {
+	s.progressCallback = callback
+}
+
+// syncItem is a file present on either side or known from the last sync
+type syncItem struct {
+	path   string
+	local  *FileVersion
+	remote *FileVersion
+	base   *SyncEntry
+
+	localChanged  bool
+	remoteChanged bool
+
+	// localHash and remoteHash are set once computed
+	localHash  string
+	remoteHash string
+}
+
+// Sync runs one sync pass. The state is saved after the pass, and after
+// the files synchronized before a failure.
+func (s *Syncer) Sync(ctx context.Context) (*SyncResult, error) {
+	if s.config.SSHClient == nil || !s.config.SSHClient.IsConnected() {
+		return nil, fmt.Errorf("SSH client not connected")
+	}
+
+	client, err := sftp.NewClient(s.config.SSHClient.GetClient())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SFTP client: %w", err)
+	}
+	defer client.Close()
+
+	return s.sync(ctx, client)
+}
+
+// sync runs one sync pass over an SFTP session
+func (s *Syncer) sync(ctx context.Context, client *sftp.Client) (*SyncResult, error) {
+	localDir, remoteDir, err := s.prepareRoots(client)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := newPathFilter(s.config.ExcludePatterns, s.config.IncludePatterns)
+	local, err := scanLocalTree(ctx, localDir, filter)
+	if err != nil {
+		return nil, err
+	}
+	var remote map[string]*FileVersion
+	if remoteDir != "" {
+		if remote, err = scanRemoteTree(ctx, client, remoteDir, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	items := planSync(local, remote, s.config.State.Files)
+	if err := s.compareHashes(ctx, client, localDir, remoteDir, items); err != nil {
+		return nil, err
+	}
+	if !s.config.DryRun {
+		if err := s.checkDeletions(local, remote, items); err != nil {
+			return nil, err
+		}
+		if err := s.approvePush(ctx, localDir, items); err != nil {
+			return nil, err
+		}
+	}
+
+	xferConfig := &TransferConfig{
+		SSHClient:           s.config.SSHClient,
+		PreservePermissions: true,
+		Chmod:               s.config.Chmod,
+		Chown:               s.config.Chown,
+		BandwidthLimit:      s.config.BandwidthLimit,
+	}
+	syncer := &pairSyncer{
+		Syncer:    s,
+		client:    client,
+		xfer:      NewSFTPTransfer(xferConfig),
+		localDir:  localDir,
+		remoteDir: remoteDir,
+		result:    &SyncResult{},
+	}
+
+	for _, item := range items {
+		if err = syncer.apply(ctx, item); err != nil {
+			break
+		}
+	}
+
+	if !s.config.DryRun {
+		if saveErr := s.config.State.Save(); err == nil {
+			err = saveErr
+		}
+	}
+	return syncer.result, err
+}
+
+// checkDeletions refuses a pass that would delete files on one side only
+// because the other side is empty, unless ConfirmDeleteAll allows it. An
+// emptied directory is more likely missing, like an unmounted disk, than
+// deliberately cleared.
+func (s *Syncer) checkDeletions(local, remote map[string]*FileVersion, items []*syncItem) error {
+	if len(s.config.State.Files) == 0 {
+		return nil
+	}
+
+	for _, side := range []string{"local", "remote"} {
+		if (side == "local" && len(local) > 0) || (side == "remote" && len(remote) > 0) {
+			continue
+		}
+
+		deletions := 0
+		for _, item := range items {
+			if side == "local" && item.local == nil && item.localChanged && item.remote != nil && !item.remoteChanged {
+				deletions++
+			}
+			if side == "remote" && item.remote == nil && item.remoteChanged && item.local != nil && !item.localChanged {
+				deletions++
+			}
+		}
+		if deletions == 0 {
+			continue
+		}
+		if s.config.ConfirmDeleteAll == nil || !s.config.ConfirmDeleteAll(side, deletions) {
+			return fmt.Errorf("the %s directory is empty but %d files were synchronized before; refusing to delete them on the other side", side, deletions)
+		}
+	}
+	return nil
+}
+
+// approvePush asks ApprovePush about the files the pass may push:
+// those changed locally, including conflicts the resolver may settle
+// by pushing
+func (s *Syncer) approvePush(ctx context.Context, localDir string, items []*syncItem) error {
+	if s.config.ApprovePush == nil {
+		return nil
+	}
+
+	var files []string
+	for _, item := range items {
+		if item.local != nil && item.localChanged {
+			files = append(files, filepath.Join(localDir, filepath.FromSlash(item.path)))
+		}
+	}
+	if len(files) > 0 && !s.config.ApprovePush(ctx, files) {
+		return fmt.Errorf("upload of %d files was not approved", len(files))
+	}
+	return nil
+}
+
+// prepareRoots checks the local directory and creates the remote one if it
+// is missing. The remote directory is returned empty if it does not exist
+// during a dry run.
+func (s *Syncer) prepareRoots(client *sftp.Client) (string, string, error) {
+	localDir := filepath.Clean(s.config.LocalDir)
+	if info, err := os.Stat(localDir); err != nil {
+		return "", "", fmt.Errorf("local directory %s: %w", localDir, err)
+	} else if !info.IsDir() {
+		return "", "", fmt.Errorf("%s is not a directory", localDir)
+	}
+
+	remoteDir, err := ExpandRemoteHome(client, s.config.RemoteDir)
+	if err != nil {
+		return "", "", err
+	}
+	remoteDir = path.Clean(remoteDir)
+
+	info, err := client.Stat(remoteDir)
+	switch {
+	case err == nil && !info.IsDir():
+		return "", "", fmt.Errorf("remote path %s is not a directory", remoteDir)
+	case err == nil:
+	case !os.IsNotExist(err):
+		return "", "", fmt.Errorf("failed to stat remote directory %s: %w", remoteDir, err)
+	case s.config.DryRun:
+		return localDir, "", nil
+	default:
+		if err := client.MkdirAll(remoteDir); err != nil {
+			return "", "", fmt.Errorf("failed to create remote directory %s: %w", remoteDir, err)
+		}
+	}
+
+	return localDir, remoteDir, nil
+}
+
+// scanLocalTree returns the regular files below root by slash-separated
+// relative path, with modification times truncated to the second, as
+// SFTP reports them
+func scanLocalTree(ctx context.Context, root string, filter *pathFilter) (map[string]*FileVersion, error) {
+	files := make(map[string]*FileVersion)
+	err := walkTree(ctx, localFS, root, func(name string, info os.FileInfo) error {
+		if name == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if filter.skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(rel, AtomicSuffix) {
+			return nil
+		}
+		files[rel] = &FileVersion{Size: info.Size(), ModTime: info.ModTime().Truncate(time.Second)}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// scanRemoteTree returns the regular files below root on the remote host
+// by slash-separated relative path
+func scanRemoteTree(ctx context.Context, client *sftp.Client, root string, filter *pathFilter) (map[string]*FileVersion, error) {
+	files := make(map[string]*FileVersion)
+	err := walkTree(ctx, remoteFS(client), root, func(name string, info os.FileInfo) error {
+		if name == root {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(name, strings.TrimSuffix(root, "/")+"/")
+		if filter.skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || strings.HasSuffix(rel, AtomicSuffix) {
+			return nil
+		}
+		files[rel] = &FileVersion{Size: info.Size(), ModTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan remote %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// planSync pairs the files of both sides with the state of the last sync
+// and works out which sides changed each, in path order
+func planSync(local, remote map[string]*FileVersion, base map[string]SyncEntry) []*syncItem {
+	paths := make(map[string]bool)
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+	for p := range base {
+		paths[p] = true
+	}
+
+	items := make([]*syncItem, 0, len(paths))
+	for p := range paths {
+		item := &syncItem{path: p, local: local[p], remote: remote[p]}
+		if entry, ok := base[p]; ok {
+			item.base = &entry
+		}
+		item.localChanged = changedSince(item.local, item.base, false)
+		item.remoteChanged = changedSince(item.remote, item.base, true)
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].path < items[j].path })
+	return items
+}
+
+// changedSince reports whether one side's version of a file differs in
+// existence, size or modification time from the last sync
+func changedSince(v *FileVersion, base *SyncEntry, remote bool) bool {
+	if base == nil || v == nil {
+		return (base == nil) != (v == nil)
+	}
+
+	modTime := base.LocalModTime
+	if remote {
+		modTime = base.RemoteModTime
+	}
+	return v.Size != base.Size || !v.ModTime.Equal(modTime)
+}
+
+// conflicting reports whether both sides changed a file differently
+func (item *syncItem) conflicting() bool {
+	if !item.localChanged || !item.remoteChanged {
+		return false
+	}
+	if item.local == nil || item.remote == nil {
+		return item.local != item.remote
+	}
+	return item.local.Size != item.remote.Size || item.localHash == "" || item.localHash != item.remoteHash
+}
+
+// compareHashes hashes the files whose contents decide what to do: files
+// changed on both sides with equal sizes, which are in sync if their
+// contents match, and with Checksum, files whose size matches the last
+// sync but not their modification time, which are unchanged if their
+// contents match
+func (s *Syncer) compareHashes(ctx context.Context, client *sftp.Client, localDir, remoteDir string, items []*syncItem) error {
+	var localNames, remoteNames []string
+	for _, item := range items {
+		both := item.localChanged && item.remoteChanged && item.local != nil && item.remote != nil && item.local.Size == item.remote.Size
+		if both || s.touched(item.local, item.localChanged, item.base) {
+			localNames = append(localNames, item.path)
+		}
+		if both || s.touched(item.remote, item.remoteChanged, item.base) {
+			remoteNames = append(remoteNames, item.path)
+		}
+	}
+	if len(localNames) == 0 && len(remoteNames) == 0 {
+		return nil
+	}
+
+	localSums := make(map[string]string)
+	for _, name := range localNames {
+		sum, err := localFileSHA256(filepath.Join(localDir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", name, err)
+		}
+		localSums[name] = sum
+	}
+	remoteSums, err := s.remoteHashes(ctx, client, remoteDir, remoteNames)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		item.localHash, item.remoteHash = localSums[item.path], remoteSums[item.path]
+		if s.touched(item.local, item.localChanged, item.base) && item.localHash == item.base.Hash {
+			item.localChanged = false
+		}
+		if s.touched(item.remote, item.remoteChanged, item.base) && item.remoteHash == item.base.Hash {
+			item.remoteChanged = false
+		}
+	}
+	return nil
+}
+
+// touched reports whether, with Checksum, a changed file may only have
+// been touched: it still has the size and known hash of the last sync
+func (s *Syncer) touched(v *FileVersion, changed bool, base *SyncEntry) bool {
+	return s.config.Checksum && changed && v != nil && base != nil && base.Hash != "" && v.Size == base.Size
+}
+
+// remoteHashes hashes remote files on the remote host in batches, reading
+// back over SFTP the files it could not hash
+func (s *Syncer) remoteHashes(ctx context.Context, client *sftp.Client, remoteDir string, names []string) (map[string]string, error) {
+	pairs := make([]verifyPair, len(names))
+	for i, name := range names {
+		pairs[i] = verifyPair{remote: path.Join(remoteDir, name)}
+	}
+
+	byPath := make(map[string]string)
+	if s.config.SSHClient != nil {
+		for start := 0; start < len(pairs); start += verifyBatchSize {
+			for name, sum := range remoteSHA256(ctx, s.config.SSHClient, pairs[start:min(start+verifyBatchSize, len(pairs))]) {
+				byPath[name] = sum
+			}
+		}
+	}
+
+	sums := make(map[string]string, len(names))
+	for i, name := range names {
+		sum, ok := byPath[pairs[i].remote]
+		if !ok {
+			var err error
+			if sum, err = sftpFileSHA256(client, pairs[i].remote); err != nil {
+				return nil, fmt.Errorf("failed to hash remote %s: %w", name, err)
+			}
+		}
+		sums[name] = sum
+	}
+	return sums, nil
+}
+
+// pairSyncer applies a sync pass to both sides
+type pairSyncer struct {
+	*Syncer
+	client    *sftp.Client
+	xfer      *SFTPTransfer
+	localDir  string
+	remoteDir string
+	result    *SyncResult
+}
+
+// apply synchronizes one file and records it in the state
+func (p *pairSyncer) apply(ctx context.Context, item *syncItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case item.conflicting():
+		return p.resolve(ctx, item)
+	case item.local == nil && item.remote == nil:
+		p.forget(item.path)
+		return nil
+	case item.localChanged && item.remoteChanged:
+		// Changed the same way on both sides
+		p.record(item.path, item.local, item.remote, item.localHash)
+		return nil
+	case item.localChanged && item.local != nil:
+		return p.push(ctx, item.path, item.local)
+	case item.localChanged:
+		return p.deleteRemote(item.path)
+	case item.remoteChanged && item.remote != nil:
+		return p.pull(ctx, item.path, item.remote)
+	case item.remoteChanged:
+		return p.deleteLocal(item.path)
+	case item.local != nil && item.remote != nil:
+		// Unchanged, or only touched; remember the current times
+		hash := item.localHash
+		if hash == "" && item.base != nil {
+			hash = item.base.Hash
+		}
+		p.record(item.path, item.local, item.remote, hash)
+	}
+	return nil
+}
+
+// resolve asks the resolver how to settle a conflict and applies it.
+// Unresolved conflicts keep their previous state, so they come up again.
+func (p *pairSyncer) resolve(ctx context.Context, item *syncItem) error {
+	conflict := Conflict{Path: item.path, Local: item.local, Remote: item.remote}
+	if skipped, ok := p.skipped[item.path]; ok && sameVersion(skipped.Local, conflict.Local) && sameVersion(skipped.Remote, conflict.Remote) {
+		p.result.Unresolved = append(p.result.Unresolved, item.path)
+		return nil
+	}
+	delete(p.skipped, item.path)
+	p.result.Conflicts = append(p.result.Conflicts, item.path)
+
+	resolution := ResolutionSkip
+	if p.config.Resolver != nil && !p.config.DryRun {
+		var err error
+		if resolution, err = p.config.Resolver(conflict); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case resolution == ResolutionLocal && item.local != nil, resolution == ResolutionBoth && item.remote == nil:
+		return p.push(ctx, item.path, item.local)
+	case resolution == ResolutionLocal:
+		return p.deleteRemote(item.path)
+	case resolution == ResolutionRemote && item.remote != nil, resolution == ResolutionBoth && item.local == nil:
+		return p.pull(ctx, item.path, item.remote)
+	case resolution == ResolutionRemote:
+		return p.deleteLocal(item.path)
+	case resolution == ResolutionBoth:
+		// Move the remote version aside on the remote host, copy it here
+		// under the same name, then push the local version over the original
+		copyName := ConflictCopyName(item.path, "remote")
+		if err := RemoteRename(p.client, path.Join(p.remoteDir, item.path), path.Join(p.remoteDir, copyName)); err != nil {
+			return err
+		}
+		if err := p.pull(ctx, copyName, item.remote); err != nil {
+			return err
+		}
+		return p.push(ctx, item.path, item.local)
+	default:
+		if !p.config.DryRun {
+			p.skipped[item.path] = conflict
+		}
+		p.result.Unresolved = append(p.result.Unresolved, item.path)
+		p.notifyProgress(ProgressInfo{Message: fmt.Sprintf("Conflict left unresolved: %s", item.path)})
+		return nil
+	}
+}
+
+// sameVersion reports whether two versions of a file are the same
+func sameVersion(a, b *FileVersion) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+// push copies a local file to the remote side, giving it the local
+// modification time
+func (p *pairSyncer) push(ctx context.Context, rel string, v *FileVersion) error {
+	p.result.Pushed = append(p.result.Pushed, rel)
+	if p.config.DryRun {
+		p.notifyProgress(ProgressInfo{Operation: OperationTransfer, CurrentFile: rel, Message: fmt.Sprintf("Would push: %s", rel)})
+		return nil
+	}
+	p.notifyProgress(ProgressInfo{Operation: OperationTransfer, CurrentFile: rel, Message: fmt.Sprintf("Push: %s", rel)})
+
+	localPath := filepath.Join(p.localDir, filepath.FromSlash(rel))
+	remotePath := path.Join(p.remoteDir, rel)
+	if err := p.xfer.pushFile(ctx, p.client, localPath, remotePath); err != nil {
+		return fmt.Errorf("failed to push %s: %w", rel, err)
+	}
+	if err := p.client.Chtimes(remotePath, v.ModTime, v.ModTime); err != nil {
+		return fmt.Errorf("failed to set modification time of %s: %w", remotePath, err)
+	}
+	if spec := p.config.Chown; spec != "" {
+		if err := chownRemote(ctx, p.xfer.config.runner(), spec, remotePath, chownCommand(spec, false, remotePath)); err != nil {
+			return err
+		}
+	}
+
+	p.record(rel, v, v, p.hash(localPath))
+	return nil
+}
+
+// pull copies a remote file to the local side under a temporary name,
+// giving it the remote modification time
+func (p *pairSyncer) pull(ctx context.Context, rel string, v *FileVersion) error {
+	p.result.Pulled = append(p.result.Pulled, rel)
+	if p.config.DryRun {
+		p.notifyProgress(ProgressInfo{Operation: OperationTransfer, CurrentFile: rel, Message: fmt.Sprintf("Would pull: %s", rel)})
+		return nil
+	}
+	p.notifyProgress(ProgressInfo{Operation: OperationTransfer, CurrentFile: rel, Message: fmt.Sprintf("Pull: %s", rel)})
+
+	localPath := filepath.Join(p.localDir, filepath.FromSlash(rel))
+	tmpPath := localPath + AtomicSuffix
+	if err := p.xfer.pullFile(ctx, p.client, path.Join(p.remoteDir, rel), tmpPath); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", rel, err)
+	}
+	if err := os.Chtimes(tmpPath, v.ModTime, v.ModTime); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set modification time of %s: %w", localPath, err)
+	}
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move %s into place: %w", localPath, err)
+	}
+
+	p.record(rel, v, v, p.hash(localPath))
+	return nil
+}
+
+// deleteRemote removes a file deleted locally from the remote side
+func (p *pairSyncer) deleteRemote(rel string) error {
+	p.result.DeletedRemote = append(p.result.DeletedRemote, rel)
+	if p.config.DryRun {
+		p.notifyProgress(ProgressInfo{Operation: OperationDelete, CurrentFile: rel, Message: fmt.Sprintf("Would delete remote: %s", rel)})
+		return nil
+	}
+	p.notifyProgress(ProgressInfo{Operation: OperationDelete, CurrentFile: rel, Message: fmt.Sprintf("Remote %s", rel)})
+
+	if err := p.client.Remove(path.Join(p.remoteDir, rel)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete remote %s: %w", rel, err)
+	}
+	p.forget(rel)
+	return nil
+}
+
+// deleteLocal removes a file deleted remotely from the local side
+func (p *pairSyncer) deleteLocal(rel string) error {
+	p.result.DeletedLocal = append(p.result.DeletedLocal, rel)
+	if p.config.DryRun {
+		p.notifyProgress(ProgressInfo{Operation: OperationDelete, CurrentFile: rel, Message: fmt.Sprintf("Would delete local: %s", rel)})
+		return nil
+	}
+	p.notifyProgress(ProgressInfo{Operation: OperationDelete, CurrentFile: rel, Message: fmt.Sprintf("Local %s", rel)})
+
+	if err := os.Remove(filepath.Join(p.localDir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete local %s: %w", rel, err)
+	}
+	p.forget(rel)
+	return nil
+}
+
+// hash returns the SHA-256 of a synchronized local file for the state
+// when Checksum is set
+func (p *pairSyncer) hash(localPath string) string {
+	if !p.config.Checksum {
+		return ""
+	}
+	sum, _ := localFileSHA256(localPath)
+	return sum
+}
+
+// record remembers a file as in sync
+func (p *pairSyncer) record(rel string, local, remote *FileVersion, hash string) {
+	if p.config.DryRun {
+		return
+	}
+	p.config.State.Files[rel] = SyncEntry{Size: local.Size, LocalModTime: local.ModTime, RemoteModTime: remote.ModTime, Hash: hash}
+}
+
+// forget drops a file deleted on both sides from the state
+func (p *pairSyncer) forget(rel string) {
+	if p.config.DryRun {
+		return
+	}
+	delete(p.config.State.Files, rel)
+}
+
+// notifyProgress sends progress information to the callback
+func (s *Syncer) notifyProgress(info ProgressInfo) {
+	if s.progressCallback != nil {
+		s.progressCallback(info)
+	}
+}
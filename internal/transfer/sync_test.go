@@ -0,0 +1,301 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSyncFile writes a file with a modification time, so changes within
+// the same second are still noticed
+func writeSyncFile(t *testing.T, name, content string, modTime time.Time) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+	require.NoError(t, os.WriteFile(name, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+}
+
+func readSyncFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSyncerSync(t *testing.T) {
+	dir := t.TempDir()
+	localDir, remoteDir := filepath.Join(dir, "local"), filepath.Join(dir, "remote")
+	state, err := LoadSyncStateFile(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a1", t0)
+	writeSyncFile(t, filepath.Join(localDir, "sub", "b.txt"), "b1", t0)
+	writeSyncFile(t, filepath.Join(remoteDir, "c.txt"), "c1", t0)
+	writeSyncFile(t, filepath.Join(localDir, "same.txt"), "same", t0)
+	writeSyncFile(t, filepath.Join(remoteDir, "same.txt"), "same", t0.Add(time.Hour))
+
+	var conflicts []Conflict
+	resolution := ResolutionSkip
+	cfg := &SyncConfig{
+		LocalDir:  localDir,
+		RemoteDir: remoteDir,
+		State:     state,
+		Resolver: func(c Conflict) (Resolution, error) {
+			conflicts = append(conflicts, c)
+			return resolution, nil
+		},
+	}
+	s, err := NewSyncer(cfg)
+	require.NoError(t, err)
+	client := newPipeSFTPClient(t)
+
+	// First sync: files on one side are copied, identical files are left alone
+	result, err := s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "sub/b.txt"}, result.Pushed)
+	assert.Equal(t, []string{"c.txt"}, result.Pulled)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, "b1", readSyncFile(t, filepath.Join(remoteDir, "sub", "b.txt")))
+	assert.Equal(t, "c1", readSyncFile(t, filepath.Join(localDir, "c.txt")))
+	assert.Len(t, state.Files, 4)
+
+	// Nothing changed
+	result, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Zero(t, result.Changes())
+
+	// A local change is pushed and a remote deletion applied locally
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a2", t0.Add(time.Minute))
+	require.NoError(t, os.Remove(filepath.Join(remoteDir, "c.txt")))
+	result, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, result.Pushed)
+	assert.Equal(t, []string{"c.txt"}, result.DeletedLocal)
+	assert.Equal(t, "a2", readSyncFile(t, filepath.Join(remoteDir, "a.txt")))
+	assert.NoFileExists(t, filepath.Join(localDir, "c.txt"))
+
+	// Changes on both sides conflict; skipped conflicts stay unresolved
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a3-local", t0.Add(2*time.Minute))
+	writeSyncFile(t, filepath.Join(remoteDir, "a.txt"), "a3-remote", t0.Add(3*time.Minute))
+	result, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "a.txt", conflicts[0].Path)
+	assert.Equal(t, []string{"a.txt"}, result.Unresolved)
+	assert.Equal(t, "a3-remote", readSyncFile(t, filepath.Join(remoteDir, "a.txt")))
+
+	// A skipped conflict is not brought up again until either side changes
+	result, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Len(t, conflicts, 1)
+	assert.Empty(t, result.Conflicts)
+	assert.Equal(t, []string{"a.txt"}, result.Unresolved)
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a3-local", t0.Add(4*time.Minute))
+
+	// Keeping both puts the remote version beside the local one on both sides
+	resolution = ResolutionBoth
+	_, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, "a3-local", readSyncFile(t, filepath.Join(remoteDir, "a.txt")))
+	assert.Equal(t, "a3-remote", readSyncFile(t, filepath.Join(remoteDir, "a.conflict-remote.txt")))
+	assert.Equal(t, "a3-remote", readSyncFile(t, filepath.Join(localDir, "a.conflict-remote.txt")))
+
+	result, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Zero(t, result.Changes())
+	assert.Len(t, conflicts, 2)
+}
+
+func TestSyncerDryRun(t *testing.T) {
+	dir := t.TempDir()
+	localDir, remoteDir := filepath.Join(dir, "local"), filepath.Join(dir, "remote")
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a", time.Now())
+	state, err := LoadSyncStateFile(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+
+	s, err := NewSyncer(&SyncConfig{LocalDir: localDir, RemoteDir: remoteDir, State: state, DryRun: true})
+	require.NoError(t, err)
+	result, err := s.sync(context.Background(), newPipeSFTPClient(t))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, result.Pushed)
+	assert.NoDirExists(t, remoteDir)
+	assert.Empty(t, state.Files)
+	assert.NoFileExists(t, filepath.Join(dir, "state.json"))
+}
+
+func TestSyncerChecksum(t *testing.T) {
+	dir := t.TempDir()
+	localDir, remoteDir := filepath.Join(dir, "local"), filepath.Join(dir, "remote")
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a", t0)
+	state, err := LoadSyncStateFile(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+
+	s, err := NewSyncer(&SyncConfig{LocalDir: localDir, RemoteDir: remoteDir, State: state, Checksum: true})
+	require.NoError(t, err)
+	client := newPipeSFTPClient(t)
+	_, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	require.NotEmpty(t, state.Files["a.txt"].Hash)
+
+	// Touching a file does not transfer it
+	require.NoError(t, os.Chtimes(filepath.Join(localDir, "a.txt"), t0.Add(time.Hour), t0.Add(time.Hour)))
+	result, err := s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Zero(t, result.Changes())
+	assert.True(t, state.Files["a.txt"].LocalModTime.Equal(t0.Add(time.Hour)))
+}
+
+func TestSyncerEmptySide(t *testing.T) {
+	dir := t.TempDir()
+	localDir, remoteDir := filepath.Join(dir, "local"), filepath.Join(dir, "remote")
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a", t0)
+	writeSyncFile(t, filepath.Join(localDir, "b.txt"), "b", t0)
+	state, err := LoadSyncStateFile(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+
+	confirm := false
+	var asked []string
+	s, err := NewSyncer(&SyncConfig{
+		LocalDir:  localDir,
+		RemoteDir: remoteDir,
+		State:     state,
+		ConfirmDeleteAll: func(side string, files int) bool {
+			asked = append(asked, side)
+			assert.Equal(t, 2, files)
+			return confirm
+		},
+	})
+	require.NoError(t, err)
+	client := newPipeSFTPClient(t)
+	_, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Empty(t, asked)
+
+	// An emptied local directory does not empty the remote one unless
+	// confirmed
+	require.NoError(t, os.Remove(filepath.Join(localDir, "a.txt")))
+	require.NoError(t, os.Remove(filepath.Join(localDir, "b.txt")))
+	_, err = s.sync(context.Background(), client)
+	assert.ErrorContains(t, err, "local directory is empty")
+	assert.Equal(t, []string{"local"}, asked)
+	assert.FileExists(t, filepath.Join(remoteDir, "a.txt"))
+	assert.Len(t, state.Files, 2)
+
+	// A dry run only reports the deletions
+	s.config.DryRun = true
+	result, err := s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, result.DeletedRemote)
+	assert.FileExists(t, filepath.Join(remoteDir, "a.txt"))
+	s.config.DryRun = false
+
+	confirm = true
+	result, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, result.DeletedRemote)
+	assert.NoFileExists(t, filepath.Join(remoteDir, "a.txt"))
+	assert.Empty(t, state.Files)
+
+	// Without a confirmation callback the pass fails
+	writeSyncFile(t, filepath.Join(remoteDir, "c.txt"), "c", t0)
+	_, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(localDir, "c.txt")))
+	s.config.ConfirmDeleteAll = nil
+	_, err = s.sync(context.Background(), client)
+	assert.ErrorContains(t, err, "local directory is empty")
+	assert.FileExists(t, filepath.Join(remoteDir, "c.txt"))
+}
+
+func TestSyncerApprovePush(t *testing.T) {
+	dir := t.TempDir()
+	localDir, remoteDir := filepath.Join(dir, "local"), filepath.Join(dir, "remote")
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a", t0)
+	writeSyncFile(t, filepath.Join(remoteDir, "b.txt"), "b", t0)
+	state, err := LoadSyncStateFile(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+
+	approve := false
+	var approved [][]string
+	s, err := NewSyncer(&SyncConfig{
+		LocalDir:  localDir,
+		RemoteDir: remoteDir,
+		State:     state,
+		Chmod:     "F600",
+		ApprovePush: func(_ context.Context, files []string) bool {
+			approved = append(approved, files)
+			return approve
+		},
+	})
+	require.NoError(t, err)
+	client := newPipeSFTPClient(t)
+
+	// Only the files to push are approved, and a refusal changes nothing
+	_, err = s.sync(context.Background(), client)
+	assert.ErrorContains(t, err, "not approved")
+	assert.Equal(t, [][]string{{filepath.Join(localDir, "a.txt")}}, approved)
+	assert.NoFileExists(t, filepath.Join(remoteDir, "a.txt"))
+	assert.NoFileExists(t, filepath.Join(localDir, "b.txt"))
+
+	approve = true
+	result, err := s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, result.Pushed)
+	info, err := os.Stat(filepath.Join(remoteDir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Passes without anything to push do not ask
+	_, err = s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Len(t, approved, 2)
+
+	_, err = NewSyncer(&SyncConfig{LocalDir: localDir, RemoteDir: remoteDir, State: state, Chown: "a:b:c"})
+	assert.ErrorContains(t, err, "invalid chown")
+}
+
+func TestSyncResultDiverged(t *testing.T) {
+	result := &SyncResult{
+		Pushed:        []string{"b.txt"},
+		Pulled:        []string{"a.txt"},
+		DeletedRemote: []string{"d.txt"},
+		Conflicts:     []string{"c.txt"},
+		Unresolved:    []string{"c.txt"},
+	}
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt", "d.txt"}, result.Diverged())
+	assert.Empty(t, (&SyncResult{}).Diverged())
+}
+
+func TestSyncerMonitorPasses(t *testing.T) {
+	dir := t.TempDir()
+	localDir, remoteDir := filepath.Join(dir, "local"), filepath.Join(dir, "remote")
+	t0 := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	writeSyncFile(t, filepath.Join(localDir, "a.txt"), "a", t0)
+	writeSyncFile(t, filepath.Join(remoteDir, "a.txt"), "a", t0)
+	state, err := LoadSyncStateFile(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+
+	s, err := NewSyncer(&SyncConfig{LocalDir: localDir, RemoteDir: remoteDir, State: state, DryRun: true})
+	require.NoError(t, err)
+	client := newPipeSFTPClient(t)
+
+	result, err := s.sync(context.Background(), client)
+	require.NoError(t, err)
+	assert.Empty(t, result.Diverged())
+
+	// A divergence is reported on every pass until it is synchronized
+	writeSyncFile(t, filepath.Join(remoteDir, "b.txt"), "b", t0)
+	for i := 0; i < 2; i++ {
+		result, err = s.sync(context.Background(), client)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.txt"}, result.Diverged())
+	}
+	assert.NoFileExists(t, filepath.Join(localDir, "b.txt"))
+}
@@ -0,0 +1,102 @@
+// Package transfer - State of synchronized directory pairs
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// SyncStateDirName is the directory under the XDG state directory holding
+// the state of each synchronized directory pair
+const SyncStateDirName = "sync"
+
+// SyncEntry is a file as it was on both sides after the last sync
+type SyncEntry struct {
+	Size          int64     `json:"size"`
+	LocalModTime  time.Time `json:"local_mod_time"`
+	RemoteModTime time.Time `json:"remote_mod_time"`
+
+	// Hash is the file's SHA-256, if it was computed
+	Hash string `json:"hash,omitempty"`
+}
+
+// SyncState records the files of a local and remote directory pair as of
+// the last sync, so later syncs can tell which side changed a file and
+// which side deleted it
+type SyncState struct {
+	path  string
+	Files map[string]SyncEntry `json:"files"`
+}
+
+// SyncStatePath returns the XDG-compliant path to the state of a profile's
+// local and remote directory pair
+func SyncStatePath(profile, localDir, remoteDir string) (string, error) {
+	dir := filepath.Join(xdg.StateHome, "klip", SyncStateDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create sync state directory: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(localDir + "\x00" + remoteDir))
+	return filepath.Join(dir, profile+"-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// LoadSyncState loads the state of a profile's directory pair. Without a
+// state file, as before the first sync, no file is known.
+func LoadSyncState(profile, localDir, remoteDir string) (*SyncState, error) {
+	path, err := SyncStatePath(profile, localDir, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	return LoadSyncStateFile(path)
+}
+
+// LoadSyncStateFile loads the sync state stored at path
+func LoadSyncStateFile(path string) (*SyncState, error) {
+	s := &SyncState{path: path, Files: make(map[string]SyncEntry)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+
+	// Unlike a cache, a lost state would turn every deletion into a
+	// conflict-free copy back, so a corrupt file is an error
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse sync state %s: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]SyncEntry)
+	}
+
+	return s, nil
+}
+
+// Save writes the state to disk, replacing the previous file atomically
+func (s *SyncState) Save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync state: %w", err)
+	}
+
+	tmpPath := s.path + AtomicSuffix
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+
+	return nil
+}
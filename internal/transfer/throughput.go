@@ -0,0 +1,88 @@
+// Package transfer - Graph of recent transfer throughput
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// ThroughputSamples is how many samples the throughput graph shows
+	ThroughputSamples = 20
+
+	// ThroughputInterval is the time each sample of the graph covers
+	ThroughputInterval = time.Second
+
+	// minGraphSamples is how many samples must be collected before the
+	// graph is shown, so short transfers are not cluttered with it
+	minGraphSamples = 5
+)
+
+// sparkBlocks are the bar heights of the graph, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// ThroughputGraph keeps the transfer speed of the last ThroughputSamples
+// intervals and renders them as a unicode sparkline, so a path slowing
+// down mid-transfer shows as falling bars. It is safe for concurrent use.
+type ThroughputGraph struct {
+	mu      sync.Mutex
+	samples []int64
+	started time.Time
+	now     func() time.Time
+}
+
+// NewThroughputGraph creates an empty throughput graph
+func NewThroughputGraph() *ThroughputGraph {
+	return &ThroughputGraph{now: time.Now}
+}
+
+// Add records a speed sample in bytes/second. Samples within the same
+// interval replace each other, so the graph moves at a steady pace however
+// often progress is reported.
+func (g *ThroughputGraph) Add(speed int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	if len(g.samples) > 0 && now.Sub(g.started) < ThroughputInterval {
+		g.samples[len(g.samples)-1] = speed
+		return
+	}
+
+	g.started = now
+	g.samples = append(g.samples, speed)
+	if len(g.samples) > ThroughputSamples {
+		g.samples = g.samples[len(g.samples)-ThroughputSamples:]
+	}
+}
+
+// String renders the graph, scaled to the fastest sample shown, or an
+// empty string until enough samples were collected
+func (g *ThroughputGraph) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.samples) < minGraphSamples {
+		return ""
+	}
+	return sparkline(g.samples)
+}
+
+// sparkline renders values as bars scaled from zero to the largest value
+func sparkline(values []int64) string {
+	var peak int64
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+
+	graph := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if peak > 0 && v > 0 {
+			level = int(v * int64(len(sparkBlocks)-1) / peak)
+		}
+		graph[i] = sparkBlocks[level]
+	}
+	return string(graph)
+}
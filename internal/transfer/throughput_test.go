@@ -0,0 +1,36 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputGraph(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewThroughputGraph()
+	g.now = func() time.Time { return now }
+
+	for _, speed := range []int64{100, 800, 400, 0} {
+		g.Add(speed)
+		now = now.Add(ThroughputInterval)
+	}
+	assert.Empty(t, g.String(), "too few samples for a graph")
+
+	// Samples within one interval replace each other
+	g.Add(50)
+	g.Add(800)
+	assert.Equal(t, "▁█▄▁█", g.String())
+
+	for i := 0; i < ThroughputSamples; i++ {
+		now = now.Add(ThroughputInterval)
+		g.Add(100)
+	}
+	assert.Equal(t, ThroughputSamples, len([]rune(g.String())))
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁▁▁", sparkline([]int64{0, 0, 0}))
+	assert.Equal(t, "▁▂▃▄▅▆▇█", sparkline([]int64{0, 1, 2, 3, 4, 5, 6, 7}))
+}
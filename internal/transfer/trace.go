@@ -0,0 +1,33 @@
+// Package transfer - Tracing of transfers
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+
+	"github.com/orpheus497/klip/internal/tracing"
+)
+
+// tracedTransfer runs a transfer in a "transfer" span, the root of the
+// spans of its phases
+type tracedTransfer struct {
+	Transfer
+	config *TransferConfig
+}
+
+// Execute performs the transfer in its span
+func (t *tracedTransfer) Execute(ctx context.Context) (err error) {
+	direction := "push"
+	if t.config.Direction == DirectionPull {
+		direction = "pull"
+	}
+	ctx, span := tracing.Start(ctx, "transfer",
+		tracing.String("klip.direction", direction),
+		tracing.String("klip.method", t.config.Method),
+		tracing.String("klip.source", t.config.SourcePath),
+		tracing.String("klip.dest", t.config.DestPath),
+		tracing.Bool("klip.dry_run", t.config.DryRun))
+	defer func() { span.Finish(err) }()
+
+	return t.Transfer.Execute(ctx)
+}
@@ -5,12 +5,22 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"strings"
 
+	"github.com/orpheus497/klip/internal/cache"
 	"github.com/orpheus497/klip/internal/config"
 	"github.com/orpheus497/klip/internal/ssh"
+	"github.com/orpheus497/klip/internal/tracing"
+	"github.com/pkg/sftp"
 )
 
+// AtomicSuffix is appended to the names of files being uploaded; they are
+// renamed into place once complete
+const AtomicSuffix = ".klip-tmp"
+
 // TransferDirection indicates the direction of file transfer
 type TransferDirection int
 
@@ -22,6 +32,21 @@ const (
 	DirectionPull
 )
 
+// DirectoryMode controls where the contents of a source directory land
+type DirectoryMode int
+
+const (
+	// DirModeAuto follows rsync conventions: a trailing slash on the source
+	// copies its contents, otherwise the directory itself is copied
+	DirModeAuto DirectoryMode = iota
+
+	// DirModeContents copies the contents of the source directory into the destination
+	DirModeContents
+
+	// DirModeInto copies the source directory itself into the destination
+	DirModeInto
+)
+
 // Transfer represents a file transfer operation
 type Transfer interface {
 	// Execute performs the transfer
@@ -36,6 +61,10 @@ type TransferConfig struct {
 	// SSHClient is the SSH connection to use
 	SSHClient *ssh.Client
 
+	// MultipathClients are additional connections to the same host over
+	// other backends; single files are striped across all connections
+	MultipathClients []*ssh.Client
+
 	// Profile contains connection profile information
 	Profile *config.Profile
 
@@ -43,6 +72,22 @@ type TransferConfig struct {
 	// This should be set by the connection helper after backend resolution
 	ResolvedHost string
 
+	// ResolvedJumps are the resolved addresses of the profile's jump hosts
+	ResolvedJumps []string
+
+	// KnownHostsPath and KeyDir come from the profile's trust domain; the
+	// system ssh used by rsync is pointed at them (empty for the defaults)
+	KnownHostsPath string
+	KeyDir         string
+
+	// HostCAKeys are settings.host_ca_keys, whose host certificates
+	// rsync's ssh accepts like the Go client
+	HostCAKeys []string
+
+	// DefaultKeys are settings.default_keys, which rsync's ssh is limited
+	// to like the Go client when set
+	DefaultKeys []string
+
 	// SourcePath is the source file or directory path
 	SourcePath string
 
@@ -52,24 +97,104 @@ type TransferConfig struct {
 	// Direction indicates push or pull
 	Direction TransferDirection
 
-	// Method specifies transfer method (rsync, sftp)
+	// DirectoryMode controls directory placement (resolved by NewTransfer)
+	DirectoryMode DirectoryMode
+
+	// Method specifies transfer method (rsync, sftp, delta, scp)
 	Method string
 
 	// CompressionLevel for rsync (0-9)
 	CompressionLevel int
 
-	// ExcludePatterns for rsync
+	// ExcludePatterns are skipped by both methods (rsync --exclude syntax)
 	ExcludePatterns []string
 
+	// IncludePatterns, if set, limit the transfer to files matching one of
+	// them (rsync --include syntax); excludes take precedence
+	IncludePatterns []string
+
+	// RsyncPath is the program to run on the remote side (rsync --rsync-path)
+	RsyncPath string
+
+	// ExtraRsyncArgs are additional allowlisted rsync options
+	ExtraRsyncArgs []string
+
 	// BandwidthLimit in KB/s (0=unlimited)
 	BandwidthLimit int
 
 	// PreservePermissions maintains file permissions
 	PreservePermissions bool
 
+	// PreserveXattrs maintains extended attributes and ACLs
+	PreserveXattrs bool
+
+	// PreserveHardLinks recreates hard links within directory transfers
+	PreserveHardLinks bool
+
+	// Sparse leaves runs of zeros as holes at the destination
+	Sparse bool
+
+	// StagingDir holds partial files on the receiving side (remote for
+	// pushes, local for pulls) until they are complete and moved into place
+	StagingDir string
+
+	// Chown sets the owner and group of pushed files, e.g. "deploy:www-data"
+	Chown string
+
+	// Chmod overrides the permissions of transferred files, e.g. "D755,F644"
+	Chmod string
+
+	// Sudo installs pushed files as root: they are uploaded into a private
+	// remote staging directory and copied into place with sudo
+	Sudo bool
+
+	// SudoPassword supplies the sudo password if sudo asks for one
+	SudoPassword SudoPasswordFunc
+
 	// DeleteAfterTransfer removes source after successful transfer
 	DeleteAfterTransfer bool
 
+	// NoAtomic writes pushed files in place instead of uploading them under
+	// a temporary name and renaming them into place on success
+	NoAtomic bool
+
+	// NoResume restarts SFTP transfers of partial files from zero instead of
+	// continuing them, deletes partial files on failure and disables rsync
+	// --partial
+	NoResume bool
+
+	// VerifyResume compares the checksum of a partial file left under a
+	// temporary or staging name with the source before continuing it
+	VerifyResume bool
+
+	// Verify compares the SHA-256 of every transferred file on both sides
+	// after the transfer, failing it on a mismatch (see VerifyTransfer)
+	Verify bool
+
+	// Segments is the number of concurrent SFTP streams per connection that
+	// single files of at least SegmentMinSize are split across, like lftp's
+	// pget (0 or 1=one stream); see MultipathTransfer
+	Segments int
+
+	// ChunkCache, if set, lets pushes of single files of at least
+	// SegmentMinSize copy chunks already on the remote host there instead
+	// of sending them (see planReuse)
+	ChunkCache *cache.ChunkCache
+
+	// Concurrency is the number of files SFTP directory transfers copy at
+	// once (0=DefaultConcurrency, 1=one at a time)
+	Concurrency int
+
+	// LowMemory streams the files of SFTP directory transfers to the
+	// workers as the tree is walked instead of listing them first, and
+	// keeps only failed files of a verification (see VerifyTransfer)
+	LowMemory bool
+
+	// MaxFiles and MaxTotalSize are the file count and byte limits above
+	// which the transfer must be confirmed (0=unlimited); see CheckLimits
+	MaxFiles     int
+	MaxTotalSize int64
+
 	// DryRun performs a trial run without making changes
 	DryRun bool
 
@@ -77,8 +202,34 @@ type TransferConfig struct {
 	ShowProgress bool
 }
 
+// Operation is the kind of work a progress update reports
+type Operation string
+
+const (
+	// OperationTransfer is copying file contents
+	OperationTransfer Operation = "transfer"
+
+	// OperationDelete is removing a file, e.g. rsync --delete or --remove-source-files
+	OperationDelete Operation = "delete"
+
+	// OperationChmod is applying file permissions
+	OperationChmod Operation = "chmod"
+
+	// OperationMkdir is creating a directory
+	OperationMkdir Operation = "mkdir"
+
+	// OperationLink is recreating a hard link instead of copying the file again
+	OperationLink Operation = "link"
+
+	// OperationVerify is comparing the checksums of a transferred file
+	OperationVerify Operation = "verify"
+)
+
 // ProgressInfo contains transfer progress information
 type ProgressInfo struct {
+	// Operation is what is being done (empty for general status messages)
+	Operation Operation
+
 	// TotalBytes is the total size in bytes
 	TotalBytes int64
 
@@ -115,20 +266,234 @@ func NewTransfer(cfg *TransferConfig) (Transfer, error) {
 		return nil, fmt.Errorf("path validation failed: %w", err)
 	}
 
+	// Reject patterns rsync would skip so both methods copy the same files
+	for _, pattern := range cfg.ExcludePatterns {
+		if err := ValidateExcludePattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range cfg.IncludePatterns {
+		if err := ValidateExcludePattern(pattern); err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+	}
+
+	// Validate rsync overrides up front so a bad profile fails before connecting
+	if cfg.Method == "rsync" {
+		if err := ValidateRsyncPath(cfg.RsyncPath); err != nil {
+			return nil, fmt.Errorf("invalid rsync_path: %w", err)
+		}
+		for _, arg := range cfg.ExtraRsyncArgs {
+			if err := ValidateRsyncArg(arg); err != nil {
+				return nil, fmt.Errorf("invalid extra_rsync_args: %w", err)
+			}
+		}
+	}
+
+	if cfg.Chown != "" {
+		if _, _, err := config.ParseOwner(cfg.Chown); err != nil {
+			return nil, fmt.Errorf("invalid chown: %w", err)
+		}
+	}
+
+	if cfg.Chmod != "" {
+		if _, err := config.ParseChmod(cfg.Chmod); err != nil {
+			return nil, fmt.Errorf("invalid chmod: %w", err)
+		}
+	}
+
+	if cfg.Sudo {
+		if cfg.Direction != DirectionPush {
+			return nil, fmt.Errorf("sudo is only supported for pushes")
+		}
+		if cfg.DeleteAfterTransfer {
+			return nil, fmt.Errorf("sudo cannot be combined with delete_after_transfer")
+		}
+	}
+
+	if cfg.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency cannot be negative")
+	}
+	if cfg.Segments < 0 {
+		return nil, fmt.Errorf("segments cannot be negative")
+	}
+
+	if cfg.Method == "scp" {
+		if err := validateSCP(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// The source must still exist to be hashed after the transfer
+	if cfg.Verify && cfg.DeleteAfterTransfer {
+		return nil, fmt.Errorf("verify cannot be combined with delete_after_transfer")
+	}
+
+	// Resolve trailing-slash semantics before normalization strips the slash
+	if cfg.DirectoryMode == DirModeAuto {
+		cfg.DirectoryMode = DirModeInto
+		if strings.HasSuffix(cfg.SourcePath, "/") || strings.HasSuffix(cfg.SourcePath, string(filepath.Separator)) {
+			cfg.DirectoryMode = DirModeContents
+		}
+	}
+
 	// Normalize paths
 	cfg.SourcePath = normalizePath(cfg.SourcePath)
 	cfg.DestPath = normalizePath(cfg.DestPath)
 
+	var xfer Transfer = NewSudoTransfer(cfg)
+	if !cfg.Sudo {
+		var err error
+		if xfer, err = newMethodTransfer(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Verify && !cfg.DryRun {
+		xfer = NewVerifyTransfer(cfg, xfer)
+	}
+	if tracing.Enabled() {
+		xfer = &tracedTransfer{Transfer: xfer, config: cfg}
+	}
+	return xfer, nil
+}
+
+// newMethodTransfer creates the transfer for the configured method
+func newMethodTransfer(cfg *TransferConfig) (Transfer, error) {
+	// Directories are transferred over the primary connection only, and
+	// files below SegmentMinSize are not worth segmenting or deduplicating
+	dedup := cfg.ChunkCache != nil && cfg.Direction == DirectionPush
+	if cfg.Method != "scp" && (len(cfg.MultipathClients) > 0 || cfg.Segments > 1 || dedup) {
+		info := statSource(cfg)
+		striped := info != nil && !info.IsDir() && (len(cfg.MultipathClients) > 0 || info.Size() >= SegmentMinSize)
+		if striped {
+			return NewMultipathTransfer(cfg), nil
+		}
+	}
+
 	switch cfg.Method {
 	case "rsync":
 		return NewRsyncTransfer(cfg), nil
-	case "sftp":
+	case "sftp", "delta":
 		return NewSFTPTransfer(cfg), nil
+	case "scp":
+		return NewSCPTransfer(cfg), nil
 	default:
 		return nil, fmt.Errorf("unsupported transfer method: %s", cfg.Method)
 	}
 }
 
+// ResolveMethod returns the transfer method to use given what is installed
+// locally and on the remote host. When rsync is requested but unavailable on
+// either side, SFTP is returned instead along with a human-readable reason.
+// On a remote host without an SFTP subsystem, rsync, SFTP and delta
+// transfers fall back to SCP instead if scp is installed there. If strict
+// is set, or there is nothing to fall back to, the requested method is
+// returned unchanged. caps may be nil if detection failed.
+func ResolveMethod(method string, caps *ssh.RemoteCapabilities, strict bool) (string, string) {
+	if strict {
+		return method, ""
+	}
+	noSFTP := caps != nil && !caps.HasSFTP
+
+	var reason string
+	switch method {
+	case "rsync":
+		if _, err := exec.LookPath("rsync"); err != nil {
+			reason = "rsync is not installed locally"
+		} else if caps != nil && caps.POSIXShell && !caps.HasRsync {
+			reason = "rsync is not installed on the remote host"
+		}
+		if reason != "" && !noSFTP {
+			return "sftp", reason
+		}
+	case "sftp", "delta":
+		if noSFTP {
+			reason = "the remote host has no SFTP subsystem"
+		}
+	}
+
+	if reason == "" || !noSFTP || !caps.HasSCP {
+		return method, ""
+	}
+	return "scp", reason
+}
+
+// Destination describes where the transferred files will land, for preview
+// output. It must be called after NewTransfer has resolved the configuration.
+func Destination(cfg *TransferConfig) string {
+	if cfg.DirectoryMode != DirModeInto || !sourceIsDirectory(cfg) {
+		return cfg.DestPath
+	}
+
+	if cfg.Direction == DirectionPush {
+		return path.Join(toUnixPath(cfg.DestPath), filepath.Base(cfg.SourcePath))
+	}
+	return filepath.Join(cfg.DestPath, path.Base(toUnixPath(cfg.SourcePath)))
+}
+
+// DestructiveActions describes the data a transfer will delete, for
+// confirmation before it starts. Empty for non-destructive transfers.
+func DestructiveActions(cfg *TransferConfig) []string {
+	if cfg.DryRun || cfg.Method != "rsync" {
+		return nil
+	}
+
+	var actions []string
+
+	if cfg.DeleteAfterTransfer {
+		side := "local"
+		if cfg.Direction == DirectionPull {
+			side = "remote"
+		}
+		actions = append(actions, fmt.Sprintf("delete the %s source files in %s after transfer", side, cfg.SourcePath))
+	}
+
+	for _, arg := range cfg.ExtraRsyncArgs {
+		if strings.HasPrefix(arg, "--delete") {
+			actions = append(actions, fmt.Sprintf("delete files in %s that are not in the source (%s)", Destination(cfg), arg))
+			break
+		}
+	}
+
+	return actions
+}
+
+// sourceIsDirectory reports whether the transfer source is a directory,
+// checking the remote side over SFTP when pulling
+func sourceIsDirectory(cfg *TransferConfig) bool {
+	info := statSource(cfg)
+	return info != nil && info.IsDir()
+}
+
+// statSource returns the transfer source's file info, statting the remote
+// side over SFTP when pulling, or nil if it cannot be determined
+func statSource(cfg *TransferConfig) os.FileInfo {
+	if cfg.Direction == DirectionPush {
+		info, err := os.Stat(cfg.SourcePath)
+		if err != nil {
+			return nil
+		}
+		return info
+	}
+
+	if cfg.SSHClient == nil || !cfg.SSHClient.IsConnected() {
+		return nil
+	}
+
+	client, err := sftp.NewClient(cfg.SSHClient.GetClient())
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+
+	info, err := client.Stat(toUnixPath(cfg.SourcePath))
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
 // normalizePath normalizes a file path
 func normalizePath(path string) string {
 	// Expand ~ to home directory
@@ -0,0 +1,32 @@
+package transfer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestructiveActions(t *testing.T) {
+	cfg := &TransferConfig{
+		Method:     "rsync",
+		SourcePath: "/srv/www",
+		DestPath:   "/tmp/site",
+		Direction:  DirectionPull,
+	}
+	assert.Empty(t, DestructiveActions(cfg))
+
+	cfg.DeleteAfterTransfer = true
+	cfg.ExtraRsyncArgs = []string{"--delete-after"}
+	actions := DestructiveActions(cfg)
+	require.Len(t, actions, 2)
+	assert.Contains(t, actions[0], "remote source files in /srv/www")
+	assert.Contains(t, actions[1], "--delete-after")
+
+	cfg.DryRun = true
+	assert.Empty(t, DestructiveActions(cfg))
+
+	cfg.DryRun = false
+	cfg.Method = "sftp"
+	assert.Empty(t, DestructiveActions(cfg))
+}
@@ -5,9 +5,12 @@ package transfer
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/pkg/sftp"
 )
 
 // ValidatePath validates a file path for security issues
@@ -288,3 +291,127 @@ func ValidateExcludePattern(pattern string) error {
 
 	return nil
 }
+
+// allowedRsyncOptions lists the rsync options that may be passed through
+// extra_rsync_args. Options that execute programs (-e, --rsync-path), read
+// arbitrary local files (--files-from, --password-file) or redirect output
+// (--log-file, --write-batch) are deliberately excluded. So are --super
+// and --chown, which change ownership on the receiver unchecked:
+// transfer_options.chown does that for every transfer method, with the
+// owner validated when the profile loads and a remote chown where rsync
+// lacks --chown. The --delete options are allowed, as DestructiveActions
+// asks for confirmation before any of them runs.
+var allowedRsyncOptions = map[string]bool{
+	"-c": true, "--checksum": true,
+	"-u": true, "--update": true,
+	"-h": true, "--human-readable": true,
+	"-i": true, "--itemize-changes": true,
+	"-H": true, "--hard-links": true,
+	"-S": true, "--sparse": true,
+	"-W": true, "--whole-file": true, "--no-whole-file": true,
+	"--inplace": true, "--append-verify": true,
+	"--numeric-ids": true, "--size-only": true,
+	"--ignore-existing": true, "--existing": true,
+	"--delete": true, "--delete-after": true, "--delete-excluded": true,
+	"--stats": true, "--info": true,
+	"--timeout": true, "--contimeout": true,
+	"--chmod": true, "--omit-dir-times": true, "--no-perms": true, "--no-owner": true, "--no-group": true,
+	"--fake-super": true, "--modify-window": true, "--max-size": true, "--min-size": true,
+}
+
+// ValidateRsyncArg validates a single extra rsync argument against the allowlist
+// Options taking a value must use the --option=value form
+func ValidateRsyncArg(arg string) error {
+	if arg == "" {
+		return fmt.Errorf("argument cannot be empty")
+	}
+
+	name, value, hasValue := strings.Cut(arg, "=")
+	if !allowedRsyncOptions[name] {
+		return fmt.Errorf("rsync option %q is not allowed", name)
+	}
+
+	if hasValue {
+		validValue := regexp.MustCompile(`^[a-zA-Z0-9_.,:+=\-]+$`)
+		if !validValue.MatchString(value) {
+			return fmt.Errorf("value for rsync option %q contains disallowed characters", name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRsyncPath validates the remote rsync program override
+// The value is interpreted by the remote shell, so only plain words are allowed
+func ValidateRsyncPath(rsyncPath string) error {
+	if rsyncPath == "" {
+		return nil
+	}
+
+	validPath := regexp.MustCompile(`^[a-zA-Z0-9_./\- ]+$`)
+	if !validPath.MatchString(rsyncPath) {
+		return fmt.Errorf("rsync path contains disallowed characters (only alphanumeric, spaces and ._/- allowed)")
+	}
+
+	return nil
+}
+
+// CheckRemotePaths verifies the remote side of a transfer before it starts:
+// the remote source must exist when pulling, and when pushing the remote
+// destination must either exist or have an existing directory ancestor.
+// If the remote host has no SFTP subsystem the check is skipped.
+func CheckRemotePaths(cfg *TransferConfig) error {
+	if cfg.SSHClient == nil || !cfg.SSHClient.IsConnected() {
+		return nil
+	}
+
+	client, err := sftp.NewClient(cfg.SSHClient.GetClient())
+	if err != nil {
+		return nil
+	}
+	defer client.Close()
+
+	return checkRemotePaths(client, cfg)
+}
+
+// checkRemotePaths implements CheckRemotePaths using an open SFTP client
+func checkRemotePaths(client *sftp.Client, cfg *TransferConfig) error {
+	if cfg.Direction == DirectionPull {
+		remotePath := toUnixPath(cfg.SourcePath)
+		if _, err := client.Stat(remotePath); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("remote source does not exist: %s", remotePath)
+			}
+			return fmt.Errorf("cannot access remote source %s: %w", remotePath, err)
+		}
+		return nil
+	}
+
+	// Walk up from the destination to the nearest existing path, which must
+	// be a directory for the missing components to be creatable. Below a
+	// regular file stat fails with ENOTDIR, which SFTP reports only as a
+	// generic failure, so other errors are kept until an ancestor shows
+	// whether they came from one.
+	remotePath := toUnixPath(cfg.DestPath)
+	var accessErr error
+	for current := remotePath; ; current = path.Dir(current) {
+		info, err := client.Stat(current)
+		if err == nil {
+			if current != remotePath && !info.IsDir() {
+				return fmt.Errorf("remote destination parent is not a directory: %s", current)
+			}
+			return accessErr
+		}
+		if !os.IsNotExist(err) && accessErr == nil {
+			accessErr = fmt.Errorf("cannot access remote destination %s: %w", current, err)
+		}
+
+		parent := path.Dir(current)
+		if parent == current {
+			if accessErr != nil {
+				return accessErr
+			}
+			return fmt.Errorf("remote destination has no existing parent directory: %s", remotePath)
+		}
+	}
+}
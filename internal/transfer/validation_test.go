@@ -0,0 +1,48 @@
+package transfer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRsyncArg(t *testing.T) {
+	for _, arg := range []string{"--checksum", "-c", "--delete", "--delete-after", "--chmod=D755,F644", "--fake-super", "--max-size=10M"} {
+		assert.NoError(t, ValidateRsyncArg(arg), arg)
+	}
+
+	for _, arg := range []string{"", "--super", "--chown=root:root", "-e", "--rsync-path=sudo rsync", "--files-from=/etc/passwd"} {
+		assert.Error(t, ValidateRsyncArg(arg), arg)
+	}
+
+	assert.ErrorContains(t, ValidateRsyncArg("--chmod=755;id"), "disallowed characters")
+}
+
+func TestCheckRemotePaths(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	client := newPipeSFTPClient(t)
+
+	check := func(direction TransferDirection, remote string) error {
+		cfg := &TransferConfig{Direction: direction, SourcePath: remote, DestPath: remote}
+		return checkRemotePaths(client, cfg)
+	}
+
+	assert.NoError(t, check(DirectionPull, file))
+	assert.ErrorContains(t, check(DirectionPull, filepath.Join(dir, "missing")), "remote source does not exist")
+
+	// Missing components below the nearest existing directory are created
+	// by the transfer
+	assert.NoError(t, check(DirectionPush, file))
+	assert.NoError(t, check(DirectionPush, filepath.Join(dir, "new", "sub", "file")))
+	assert.ErrorContains(t, check(DirectionPush, filepath.Join(file, "sub", "file")), "remote destination parent is not a directory: "+file)
+
+	// Relative paths end at the server's working directory, here missing
+	client = newPipeSFTPClient(t, sftp.WithServerWorkingDirectory(filepath.Join(dir, "gone")))
+	assert.ErrorContains(t, check(DirectionPush, "new/file"), "remote destination has no existing parent directory: new/file")
+}
@@ -0,0 +1,352 @@
+// Package transfer - Checksum verification after transfer
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/orpheus497/klip/internal/tracing"
+	"github.com/pkg/sftp"
+)
+
+// verifyBatchSize is the number of files hashed per remote command
+const verifyBatchSize = 100
+
+// VerifyResult is the checksum comparison of one transferred file
+type VerifyResult struct {
+	// Path is the file at the destination
+	Path string `json:"path"`
+
+	// SourceSHA256 and DestSHA256 are the hex SHA-256 digests of the file
+	// on each side (empty if it could not be hashed)
+	SourceSHA256 string `json:"source_sha256"`
+	DestSHA256   string `json:"dest_sha256"`
+
+	// Error is why the file could not be hashed, if it could not
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether both sides were hashed and the digests match
+func (r VerifyResult) OK() bool {
+	return r.Error == "" && r.SourceSHA256 != "" && r.SourceSHA256 == r.DestSHA256
+}
+
+// VerifyTransfer runs a transfer and then compares the SHA-256 of every
+// transferred file on both sides. Remote files are hashed with sha256sum
+// or shasum over SSH for rsync transfers and by reading them back over
+// SFTP otherwise, or when the host has neither.
+type VerifyTransfer struct {
+	Transfer
+	config           *TransferConfig
+	progressCallback ProgressCallback
+	results          []VerifyResult
+}
+
+// NewVerifyTransfer wraps xfer with checksum verification
+func NewVerifyTransfer(cfg *TransferConfig, xfer Transfer) *VerifyTransfer {
+	return &VerifyTransfer{Transfer: xfer, config: cfg}
+}
+
+// SetProgressCallback sets the progress callback of the transfer and the
+// verification
+func (v *VerifyTransfer) SetProgressCallback(callback ProgressCallback) {
+	v.progressCallback = callback
+	v.Transfer.SetProgressCallback(callback)
+}
+
+// Execute performs the transfer and verifies it
+func (v *VerifyTransfer) Execute(ctx context.Context) (err error) {
+	copyCtx, span := tracing.Start(ctx, "transfer.copy")
+	err = v.Transfer.Execute(copyCtx)
+	span.Finish(err)
+	if err != nil {
+		return err
+	}
+
+	ctx, span = tracing.Start(ctx, "transfer.verify")
+	defer func() { span.Finish(err) }()
+
+	if v.config.SSHClient == nil || !v.config.SSHClient.IsConnected() {
+		return fmt.Errorf("cannot verify transfer: SSH client not connected")
+	}
+	client, err := sftp.NewClient(v.config.SSHClient.GetClient())
+	if err != nil {
+		return fmt.Errorf("cannot verify transfer: failed to create SFTP client: %w", err)
+	}
+	defer client.Close()
+
+	var runner CommandRunner
+	if v.config.Method == "rsync" || v.config.Method == "delta" {
+		runner = v.config.runner()
+	}
+	return v.verify(ctx, client, runner)
+}
+
+// Results returns the per-file results of the last verification
+func (v *VerifyTransfer) Results() []VerifyResult {
+	return v.results
+}
+
+// VerifyResults returns the per-file checksum results of a transfer
+// created with verification, or nil
+func VerifyResults(xfer Transfer) []VerifyResult {
+	if t, ok := xfer.(*tracedTransfer); ok {
+		xfer = t.Transfer
+	}
+	if v, ok := xfer.(*VerifyTransfer); ok {
+		return v.Results()
+	}
+	return nil
+}
+
+// verifyPair is a transferred file on the local and the remote host
+type verifyPair struct {
+	local  string
+	remote string
+}
+
+// verify hashes every transferred file, remotely with runner if set, and
+// fails if any file could not be hashed or differs. Files are hashed in
+// batches as they are listed; with LowMemory only failed files are kept in
+// the results.
+func (v *VerifyTransfer) verify(ctx context.Context, client *sftp.Client, runner CommandRunner) error {
+	v.results = nil
+	var batch []verifyPair
+	checked, failed := 0, 0
+
+	check := func() error {
+		remoteSums := make(map[string]string)
+		if runner != nil {
+			remoteSums = remoteSHA256(ctx, runner, batch)
+		}
+
+		for _, pair := range batch {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
+			result := v.check(client, pair, remoteSums)
+			checked++
+			if !result.OK() {
+				failed++
+			}
+			if !v.config.LowMemory || !result.OK() {
+				v.results = append(v.results, result)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := transferredFiles(ctx, v.config, client, func(pair verifyPair) error {
+		batch = append(batch, pair)
+		if len(batch) < verifyBatchSize {
+			return nil
+		}
+		return check()
+	})
+	if err == nil {
+		err = check()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("cannot verify transfer: %w", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("checksum verification failed for %d of %d files", failed, checked)
+	}
+	return nil
+}
+
+// check compares the checksums of one transferred file, using remoteSums
+// for the remote side where it has the file, and reports the result
+func (v *VerifyTransfer) check(client *sftp.Client, pair verifyPair, remoteSums map[string]string) VerifyResult {
+	localSum, localErr := localFileSHA256(pair.local)
+	remoteSum, ok := remoteSums[pair.remote]
+	var remoteErr error
+	if !ok {
+		remoteSum, remoteErr = sftpFileSHA256(client, pair.remote)
+	}
+
+	result := VerifyResult{Path: pair.remote, SourceSHA256: localSum, DestSHA256: remoteSum}
+	if v.config.Direction == DirectionPull {
+		result = VerifyResult{Path: pair.local, SourceSHA256: remoteSum, DestSHA256: localSum}
+	}
+	if localErr != nil {
+		result.Error = localErr.Error()
+	} else if remoteErr != nil {
+		result.Error = remoteErr.Error()
+	}
+
+	var message string
+	switch {
+	case result.Error != "":
+		message = fmt.Sprintf("FAILED %s: %s", result.Path, result.Error)
+	case !result.OK():
+		message = fmt.Sprintf("MISMATCH %s: source %s, destination %s", result.Path, result.SourceSHA256, result.DestSHA256)
+	default:
+		message = fmt.Sprintf("OK %s", result.Path)
+	}
+	v.notifyProgress(ProgressInfo{Operation: OperationVerify, CurrentFile: result.Path, Message: message})
+
+	return result
+}
+
+// transferredFiles calls visit with each regular file the transfer of cfg
+// copied, paired with where it landed, skipping excluded files like the
+// transfer did
+func transferredFiles(ctx context.Context, cfg *TransferConfig, client *sftp.Client, visit func(verifyPair) error) error {
+	dest := Destination(cfg)
+	filter := cfg.filter()
+
+	if cfg.Direction == DirectionPush {
+		info, err := os.Stat(cfg.SourcePath)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			remote := toUnixPath(dest)
+			if remoteInfo, err := client.Stat(remote); err == nil && remoteInfo.IsDir() {
+				remote = path.Join(remote, filepath.Base(cfg.SourcePath))
+			}
+			return visit(verifyPair{local: cfg.SourcePath, remote: remote})
+		}
+
+		return walkTree(ctx, localFS, cfg.SourcePath, func(name string, info os.FileInfo) error {
+			rel, err := filepath.Rel(cfg.SourcePath, name)
+			if err != nil {
+				return err
+			}
+			if rel != "." && filter.skip(filepath.ToSlash(rel), info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				return visit(verifyPair{local: name, remote: path.Join(toUnixPath(dest), filepath.ToSlash(rel))})
+			}
+			return nil
+		})
+	}
+
+	source := toUnixPath(cfg.SourcePath)
+	info, err := client.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		local := dest
+		if isDirectory(local) {
+			local = filepath.Join(local, path.Base(source))
+		}
+		return visit(verifyPair{local: local, remote: source})
+	}
+
+	return walkTree(ctx, remoteFS(client), source, func(name string, info os.FileInfo) error {
+		rel, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		if rel != "." && filter.skip(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			return visit(verifyPair{local: filepath.Join(dest, rel), remote: name})
+		}
+		return nil
+	})
+}
+
+// notifyProgress sends progress information to the callback
+func (v *VerifyTransfer) notifyProgress(info ProgressInfo) {
+	if v.progressCallback != nil {
+		v.progressCallback(info)
+	}
+}
+
+// remoteSHA256 hashes a batch of remote files with sha256sum or shasum and
+// returns the digests by path. Files that could not be hashed, or all of
+// them on hosts without either tool, are missing from the result.
+func remoteSHA256(ctx context.Context, runner CommandRunner, pairs []verifyPair) map[string]string {
+	args := make([]string, len(pairs))
+	for i, pair := range pairs {
+		args[i] = quoteRemoteShellArg(pair.remote)
+	}
+	files := strings.Join(args, " ")
+	command := fmt.Sprintf("{ if command -v sha256sum >/dev/null 2>&1; then sha256sum -- %[1]s; else shasum -a 256 -- %[1]s; fi; } 2>/dev/null; true", files)
+
+	output, err := runner.RunCommand(ctx, command)
+	if err != nil {
+		return nil
+	}
+	return parseSHA256Sums(output)
+}
+
+// parseSHA256Sums parses sha256sum output into digests by file name,
+// undoing the escaping of names with backslashes or newlines
+func parseSHA256Sums(output string) map[string]string {
+	sums := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		escaped := strings.HasPrefix(line, `\`)
+		line = strings.TrimPrefix(line, `\`)
+
+		// Text mode separates the name with two spaces, binary mode with " *"
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != sha256.Size*2 || len(name) < 2 {
+			continue
+		}
+		name = name[1:]
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums
+}
+
+// localFileSHA256 returns the hex SHA-256 digest of a local file
+func localFileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readerSHA256(f)
+}
+
+// sftpFileSHA256 returns the hex SHA-256 digest of a remote file, reading
+// it back over SFTP
+func sftpFileSHA256(client *sftp.Client, name string) (string, error) {
+	f, err := client.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readerSHA256(f)
+}
+
+// readerSHA256 returns the hex SHA-256 digest of everything read from r
+func readerSHA256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,105 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyTransfer(t *testing.T) {
+	src := t.TempDir()
+	for name, data := range map[string]string{"a.txt": "alpha", "sub/b.txt": "beta", "skip.log": "ignored"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(src, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(data), 0644))
+	}
+
+	dest := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "a.txt"), []byte("alpha"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "sub", "b.txt"), []byte("corrupted"), 0644))
+
+	for name, runner := range map[string]CommandRunner{"sftp": nil, "remote command": &localRunner{}} {
+		t.Run(name, func(t *testing.T) {
+			v := NewVerifyTransfer(&TransferConfig{
+				SourcePath:      src,
+				DestPath:        dest,
+				DirectoryMode:   DirModeContents,
+				ExcludePatterns: []string{"*.log"},
+			}, nil)
+
+			var ops []string
+			v.progressCallback = func(info ProgressInfo) { ops = append(ops, info.Message) }
+
+			err := v.verify(context.Background(), newPipeSFTPClient(t), runner)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "1 of 2 files")
+			assert.Len(t, ops, 2)
+
+			results := make(map[string]VerifyResult)
+			for _, result := range v.Results() {
+				results[result.Path] = result
+			}
+			assert.True(t, results[filepath.Join(dest, "a.txt")].OK())
+			mismatch := results[filepath.Join(dest, "sub", "b.txt")]
+			assert.False(t, mismatch.OK())
+			assert.Empty(t, mismatch.Error)
+			assert.NotEqual(t, mismatch.SourceSHA256, mismatch.DestSHA256)
+		})
+	}
+}
+
+func TestVerifyTransferLowMemory(t *testing.T) {
+	src := t.TempDir()
+	dest := t.TempDir()
+	for i := 0; i < verifyBatchSize+10; i++ {
+		name := fmt.Sprintf("file%03d", i)
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dest, name), []byte(name), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "file105"), []byte("corrupted"), 0644))
+
+	// Files are checked across batches, and only the failure is kept
+	v := NewVerifyTransfer(&TransferConfig{SourcePath: src, DestPath: dest, LowMemory: true}, nil)
+	err := v.verify(context.Background(), newPipeSFTPClient(t), &localRunner{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("1 of %d files", verifyBatchSize+10))
+	require.Len(t, v.Results(), 1)
+	assert.Equal(t, filepath.Join(dest, "file105"), v.Results()[0].Path)
+}
+
+func TestVerifyTransferPullFile(t *testing.T) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote.bin")
+	require.NoError(t, os.WriteFile(remote, []byte("payload"), 0644))
+
+	// A single file pulled into a directory lands inside it
+	local := filepath.Join(dir, "local")
+	require.NoError(t, os.MkdirAll(local, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(local, "remote.bin"), []byte("payload"), 0644))
+
+	v := NewVerifyTransfer(&TransferConfig{SourcePath: remote, DestPath: local, Direction: DirectionPull}, nil)
+	require.NoError(t, v.verify(context.Background(), newPipeSFTPClient(t), nil))
+	require.Len(t, v.Results(), 1)
+	assert.Equal(t, filepath.Join(local, "remote.bin"), v.Results()[0].Path)
+	assert.True(t, v.Results()[0].OK())
+}
+
+func TestParseSHA256Sums(t *testing.T) {
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	output := sum + "  /srv/app/hello.txt\n" +
+		sum + " */srv/app/binary mode\n" +
+		`\` + sum + `  /srv/app/new\nline` + "\n" +
+		"sha256sum: /srv/app/secret: Permission denied\n"
+
+	sums := parseSHA256Sums(output)
+	assert.Equal(t, map[string]string{
+		"/srv/app/hello.txt":   sum,
+		"/srv/app/binary mode": sum,
+		"/srv/app/new\nline":   sum,
+	}, sums)
+}
@@ -0,0 +1,151 @@
+// Package transfer - Concurrent directory tree walks
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+// WalkConcurrency is how many directories a tree walk reads at once. Over
+// SFTP each directory listing costs several round trips, which the walk
+// overlaps instead of waiting for one directory after another.
+const WalkConcurrency = 8
+
+// walkFS is the filesystem a tree walk lists, local or remote
+type walkFS struct {
+	lstat   func(name string) (os.FileInfo, error)
+	readDir func(dir string) ([]os.FileInfo, error)
+	join    func(elem ...string) string
+}
+
+// localFS walks the local filesystem
+var localFS = walkFS{lstat: os.Lstat, readDir: readLocalDir, join: filepath.Join}
+
+// remoteFS walks the remote filesystem over SFTP, whose directory listings
+// come back in batches of entries with their attributes
+func remoteFS(client *sftp.Client) walkFS {
+	return walkFS{lstat: client.Lstat, readDir: client.ReadDir, join: path.Join}
+}
+
+// readLocalDir lists a local directory with the attributes of its entries
+func readLocalDir(dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// dirListing is the result of reading one directory of a walk
+type dirListing struct {
+	dir     string
+	entries []os.FileInfo
+	err     error
+}
+
+// walkTree calls visit for root and every file and directory below it,
+// like filepath.Walk, without following symbolic links. Up to
+// WalkConcurrency directories are read at once, but visit is only called
+// from the calling goroutine: each directory before anything below it, and
+// the entries of a directory in name order, while the order of separate
+// directories is not defined. Returning filepath.SkipDir from visit for a
+// directory skips its contents; any other error, or one reading the tree,
+// stops the walk and is returned.
+func walkTree(ctx context.Context, fsys walkFS, root string, visit func(name string, info os.FileInfo) error) error {
+	info, err := fsys.lstat(root)
+	if err != nil {
+		return err
+	}
+	if err := visit(root, info); err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	jobs := make(chan string)
+	results := make(chan dirListing)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		close(jobs)
+		wg.Wait()
+	}()
+
+	for i := 0; i < WalkConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range jobs {
+				entries, err := fsys.readDir(dir)
+				select {
+				case results <- dirListing{dir: dir, entries: entries, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Directories waiting to be read are taken newest first, so the walk
+	// goes deep before wide and few of them wait at a time
+	pending := []string{root}
+	reading := 0
+	for len(pending) > 0 || reading > 0 {
+		var next chan string
+		if len(pending) > 0 {
+			next = jobs
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case next <- pendingTop(pending):
+			pending = pending[:len(pending)-1]
+			reading++
+		case listing := <-results:
+			reading--
+			if listing.err != nil {
+				return listing.err
+			}
+
+			sort.Slice(listing.entries, func(i, j int) bool {
+				return listing.entries[i].Name() < listing.entries[j].Name()
+			})
+			for _, entry := range listing.entries {
+				name := fsys.join(listing.dir, entry.Name())
+				err := visit(name, entry)
+				if entry.IsDir() && err == nil {
+					pending = append(pending, name)
+				} else if err != nil && !(entry.IsDir() && err == filepath.SkipDir) {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pendingTop returns the directory to read next, or "" if none is waiting
+func pendingTop(pending []string) string {
+	if len(pending) == 0 {
+		return ""
+	}
+	return pending[len(pending)-1]
+}
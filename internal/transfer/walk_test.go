@@ -0,0 +1,156 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTree creates dirs directories of files files each, nested in groups
+// of ten
+func makeTree(t testing.TB, root string, dirs, files int) {
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("group%d", d/10), fmt.Sprintf("dir%d", d))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		for f := 0; f < files; f++ {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", f)), []byte("data"), 0644))
+		}
+	}
+}
+
+func TestWalkTree(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 25, 4)
+
+	var want []string
+	require.NoError(t, filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		want = append(want, name)
+		return err
+	}))
+
+	for name, fsys := range map[string]walkFS{"local": localFS, "sftp": remoteFS(newPipeSFTPClient(t))} {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			seen := make(map[string]bool)
+			err := walkTree(context.Background(), fsys, root, func(name string, info os.FileInfo) error {
+				if name != root {
+					assert.True(t, seen[filepath.Dir(name)], "%s visited before its directory", name)
+				}
+				seen[name] = true
+				got = append(got, name)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, want, got)
+		})
+	}
+}
+
+func TestWalkTreeSkipDir(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 20, 2)
+
+	var got []string
+	err := walkTree(context.Background(), localFS, root, func(name string, info os.FileInfo) error {
+		if info.IsDir() && filepath.Base(name) == "group1" {
+			return filepath.SkipDir
+		}
+		got = append(got, name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, got, 1+1+10*3)
+	for _, name := range got {
+		assert.NotContains(t, name, "group1")
+	}
+
+	// Skipping the root walks nothing, and a file root is visited alone
+	err = walkTree(context.Background(), localFS, root, func(name string, info os.FileInfo) error {
+		return filepath.SkipDir
+	})
+	require.NoError(t, err)
+	file := filepath.Join(root, "group0", "dir0", "file0")
+	got = nil
+	require.NoError(t, walkTree(context.Background(), localFS, file, func(name string, info os.FileInfo) error {
+		got = append(got, name)
+		return nil
+	}))
+	assert.Equal(t, []string{file}, got)
+}
+
+func TestWalkTreeErrors(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 30, 5)
+
+	stop := errors.New("stop")
+	visited := 0
+	err := walkTree(context.Background(), localFS, root, func(name string, info os.FileInfo) error {
+		visited++
+		if visited == 50 {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 50, visited)
+
+	err = walkTree(context.Background(), localFS, filepath.Join(root, "missing"), func(string, os.FileInfo) error { return nil })
+	assert.True(t, os.IsNotExist(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = walkTree(ctx, localFS, root, func(string, os.FileInfo) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// benchmarkTree creates the tree walked by the benchmarks once
+func benchmarkTree(b *testing.B) string {
+	root := b.TempDir()
+	makeTree(b, root, 500, 20)
+	b.ResetTimer()
+	return root
+}
+
+func BenchmarkFilepathWalk(b *testing.B) {
+	root := benchmarkTree(b)
+	for i := 0; i < b.N; i++ {
+		err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error { return err })
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkWalkTree(b *testing.B) {
+	root := benchmarkTree(b)
+	for i := 0; i < b.N; i++ {
+		err := walkTree(context.Background(), localFS, root, func(string, os.FileInfo) error { return nil })
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkSFTPWalk(b *testing.B) {
+	root := benchmarkTree(b)
+	client := newPipeSFTPClient(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		walker := client.Walk(root)
+		for walker.Step() {
+			require.NoError(b, walker.Err())
+		}
+	}
+}
+
+func BenchmarkSFTPWalkTree(b *testing.B) {
+	root := benchmarkTree(b)
+	fsys := remoteFS(newPipeSFTPClient(b))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := walkTree(context.Background(), fsys, root, func(string, os.FileInfo) error { return nil })
+		require.NoError(b, err)
+	}
+}
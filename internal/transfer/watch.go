@@ -0,0 +1,249 @@
+// Package transfer - Watching a push source for changes
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchDebounce is how long a watched source must be quiet before
+// its changes are pushed
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// Watcher reports the files of a push source that were created or written,
+// in batches once the source has been quiet for the debounce delay, so a
+// burst of saves results in one push. Deletions are not reported.
+type Watcher struct {
+	root     string
+	dir      bool
+	debounce time.Duration
+	filter   *pathFilter
+	fs       *fsnotify.Watcher
+	pending  map[string]bool
+}
+
+// NewWatcher starts watching the source of a push, and every directory
+// below it that is not excluded
+func NewWatcher(cfg *TransferConfig, debounce time.Duration) (*Watcher, error) {
+	if debounce <= 0 {
+		return nil, fmt.Errorf("debounce delay must be positive")
+	}
+
+	root := filepath.Clean(cfg.SourcePath)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	w := &Watcher{
+		root:     root,
+		dir:      info.IsDir(),
+		debounce: debounce,
+		filter:   cfg.filter(),
+		fs:       fsw,
+		pending:  make(map[string]bool),
+	}
+
+	// A single file is watched through its directory, since editors often
+	// save by replacing the file, which ends a watch on the file itself
+	if w.dir {
+		err = w.addTree(root, false)
+	} else {
+		err = fsw.Add(filepath.Dir(root))
+	}
+	if err != nil {
+		fsw.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
+
+// Run calls onChange with the local paths of the files changed since the
+// last call, sorted, until ctx is done. onChange runs on the watching
+// goroutine; changes made meanwhile are reported by the next call.
+func (w *Watcher) Run(ctx context.Context, onChange func(changed []string)) error {
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			if w.handle(event) {
+				timer.Reset(w.debounce)
+			}
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			// Events were lost, so every file may have changed
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				return fmt.Errorf("watching %s failed: %w", w.root, err)
+			}
+			if w.dir {
+				_ = w.addTree(w.root, true)
+			} else {
+				w.pending[w.root] = true
+			}
+			timer.Reset(w.debounce)
+		case <-timer.C:
+			if changed := w.flush(); len(changed) > 0 {
+				onChange(changed)
+			}
+		}
+	}
+}
+
+// handle records a file changed by event and reports whether it may be a
+// change to push
+func (w *Watcher) handle(event fsnotify.Event) bool {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return false
+	}
+	if !w.dir {
+		if event.Name != w.root {
+			return false
+		}
+		w.pending[event.Name] = true
+		return true
+	}
+
+	// Files may be written into a new directory before it is watched, so
+	// all of them count as changed
+	if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+		if !w.skip(event.Name, true) {
+			_ = w.addTree(event.Name, true)
+		}
+		return true
+	}
+
+	w.pending[event.Name] = true
+	return true
+}
+
+// addTree watches dir and the directories below it that are not excluded,
+// marking the files found as changed if markFiles is set
+func (w *Watcher) addTree(dir string, markFiles bool) error {
+	return filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Removed while walking; a later event tells what remains
+			if name != dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if name != w.root && w.skip(name, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if err := w.fs.Add(name); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", name, err)
+			}
+		} else if markFiles {
+			w.pending[name] = true
+		}
+		return nil
+	})
+}
+
+// flush returns the pending files that still exist as regular files and
+// are not excluded, and forgets them
+func (w *Watcher) flush() []string {
+	var changed []string
+	for name := range w.pending {
+		info, err := os.Lstat(name)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if w.dir && w.skip(name, false) {
+			continue
+		}
+		changed = append(changed, name)
+	}
+	w.pending = make(map[string]bool)
+
+	sort.Strings(changed)
+	return changed
+}
+
+// skip reports whether a path below a watched directory is excluded
+func (w *Watcher) skip(name string, isDir bool) bool {
+	rel, err := filepath.Rel(w.root, name)
+	if err != nil {
+		return true
+	}
+	return w.filter.skip(filepath.ToSlash(rel), isDir)
+}
+
+// PushChanges pushes files of cfg's source reported by a Watcher. rsync
+// transfers run again over the whole source, which only sends what
+// changed; SFTP transfers push each changed file on its own. If approve is
+// not nil it is asked about the changed files first, like
+// SyncConfig.ApprovePush, and nothing is pushed unless it agrees.
+func PushChanges(ctx context.Context, cfg *TransferConfig, changed []string, approve func(ctx context.Context, files []string) bool, callback ProgressCallback) error {
+	if approve != nil && len(changed) > 0 && !approve(ctx, changed) {
+		return fmt.Errorf("upload of %d files was not approved", len(changed))
+	}
+
+	if cfg.Method == "rsync" || !sourceIsDirectory(cfg) {
+		return executeWithCallback(ctx, cfg, callback)
+	}
+
+	root := toUnixPath(Destination(cfg))
+	for _, name := range changed {
+		rel, err := filepath.Rel(filepath.Clean(cfg.SourcePath), name)
+		if err != nil {
+			return err
+		}
+
+		fileCfg := *cfg
+		fileCfg.SourcePath = name
+		fileCfg.DestPath = path.Join(root, filepath.ToSlash(rel))
+		fileCfg.DirectoryMode = DirModeAuto
+		if err := executeWithCallback(ctx, &fileCfg, callback); err != nil {
+			return fmt.Errorf("failed to push %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// executeWithCallback creates and runs a transfer
+func executeWithCallback(ctx context.Context, cfg *TransferConfig, callback ProgressCallback) error {
+	xfer, err := NewTransfer(cfg)
+	if err != nil {
+		return err
+	}
+	if callback != nil {
+		xfer.SetProgressCallback(callback)
+	}
+	return xfer.Execute(ctx)
+}
@@ -0,0 +1,172 @@
+// Package transfer - Extended attribute and ACL preservation
+// Copyright (c) 2025 orpheus497
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+)
+
+// getfattrArgs produce a dump of every extended attribute below a path,
+// including POSIX ACLs (system.posix_acl_*) and SELinux labels, in the
+// format setfattr --restore reads
+var getfattrArgs = []string{"--dump", "--match=-", "--encoding=hex", "--absolute-names", "--recursive"}
+
+// localRsyncVersion caches the output of 'rsync --version'
+var localRsyncVersion = sync.OnceValue(func() string {
+	output, _ := exec.Command("rsync", "--version").Output()
+	return string(output)
+})
+
+// rsyncXattrArgs returns the rsync options preserving extended attributes
+// (-X) and ACLs (-A) that the rsync described by its --version output
+// was built with
+func rsyncXattrArgs(version string) []string {
+	var args []string
+	for _, feature := range []struct{ name, arg string }{{"xattrs", "-X"}, {"ACLs", "-A"}} {
+		if strings.Contains(version, feature.name) && !strings.Contains(version, "no "+feature.name) {
+			args = append(args, feature.arg)
+		}
+	}
+	return args
+}
+
+// pushXattrs copies the extended attributes below localRoot to the same
+// files below remoteRoot: a getfattr dump is remapped to the remote paths,
+// uploaded to a temporary file and restored there with setfattr
+func pushXattrs(ctx context.Context, runner CommandRunner, client *sftp.Client, localRoot, remoteRoot string) error {
+	if _, err := exec.LookPath("getfattr"); err != nil {
+		return fmt.Errorf("preserve_xattrs needs getfattr (attr package) locally: %w", err)
+	}
+
+	localRoot = filepath.Clean(localRoot)
+	cmd := exec.CommandContext(ctx, "getfattr", append(append([]string{}, getfattrArgs...), "--", localRoot)...)
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return fmt.Errorf("failed to read extended attributes: %w", err)
+	}
+
+	dump := remapFattrDump(string(output), localRoot, path.Clean(toUnixPath(remoteRoot)))
+	if dump == "" {
+		return nil
+	}
+
+	tmp, err := runner.RunCommand(ctx, "mktemp")
+	if err != nil {
+		return fmt.Errorf("failed to create remote temporary file: %w", err)
+	}
+	tmp = strings.TrimSpace(tmp)
+
+	f, err := client.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to upload extended attributes: %w", err)
+	}
+	_, err = f.Write([]byte(dump))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return fmt.Errorf("failed to upload extended attributes: %w", err)
+	}
+
+	quoted := quoteRemoteShellArg(tmp)
+	command := fmt.Sprintf("setfattr --restore=%s; status=$?; rm -f %s; exit $status", quoted, quoted)
+	if output, err := runner.RunCommand(ctx, command); err != nil {
+		return fmt.Errorf("failed to restore extended attributes on the remote host (is the attr package installed?): %w %s", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// pullXattrs copies the extended attributes below remoteRoot to the same
+// files below localRoot
+func pullXattrs(ctx context.Context, runner CommandRunner, remoteRoot, localRoot string) error {
+	if _, err := exec.LookPath("setfattr"); err != nil {
+		return fmt.Errorf("preserve_xattrs needs setfattr (attr package) locally: %w", err)
+	}
+
+	// Files without permission to read attributes are skipped rather than
+	// failing the dump
+	remoteRoot = path.Clean(toUnixPath(remoteRoot))
+	command := fmt.Sprintf("command -v getfattr >/dev/null || exit 127; getfattr %s -- %s 2>/dev/null; exit 0",
+		strings.Join(getfattrArgs, " "), quoteRemoteShellArg(remoteRoot))
+	output, err := runner.RunCommand(ctx, command)
+	if err != nil {
+		return fmt.Errorf("failed to read extended attributes on the remote host (is the attr package installed?): %w", err)
+	}
+
+	dump := remapFattrDump(output, remoteRoot, filepath.Clean(localRoot))
+	if dump == "" {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "setfattr", "--restore=-")
+	cmd.Stdin = strings.NewReader(dump)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restore extended attributes: %w %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// remapFattrDump rewrites the "# file:" paths of a getfattr dump from below
+// oldRoot to below newRoot, dropping files outside oldRoot and any lines
+// that are not part of a file block
+func remapFattrDump(dump, oldRoot, newRoot string) string {
+	oldEsc, newEsc := escapeFattrPath(oldRoot), escapeFattrPath(newRoot)
+
+	var b strings.Builder
+	keep := false
+	for _, line := range strings.Split(dump, "\n") {
+		if name, ok := strings.CutPrefix(line, "# file: "); ok {
+			keep = true
+			switch {
+			case name == oldEsc:
+				name = newEsc
+			case strings.HasPrefix(name, oldEsc+"/"):
+				name = newEsc + name[len(oldEsc):]
+			default:
+				keep = false
+			}
+			if keep {
+				b.WriteString("# file: " + name + "\n")
+			}
+			continue
+		}
+
+		if line == "" {
+			if keep {
+				b.WriteString("\n")
+			}
+			keep = false
+			continue
+		}
+
+		if keep && strings.Contains(line, "=") {
+			b.WriteString(line + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+// escapeFattrPath escapes a path the way getfattr prints it: backslashes
+// and non-printable bytes become three-digit octal escapes
+func escapeFattrPath(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '\\' || c < 0x20 || c >= 0x7f {
+			fmt.Fprintf(&b, "\\%03o", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
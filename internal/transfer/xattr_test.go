@@ -0,0 +1,79 @@
+package transfer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRsyncXattrArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    []string
+	}{
+		{"both", "Capabilities:\n    hardlink-symlinks, IPv6, atimes, batchfiles, inplace, append, ACLs,\n    xattrs, optional secluded-args, iconv, prealloc", []string{"-X", "-A"}},
+		{"no acls", "    append, no ACLs, xattrs, iconv", []string{"-X"}},
+		{"neither", "    append, no ACLs, no xattrs", nil},
+		{"missing rsync", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rsyncXattrArgs(tt.version))
+		})
+	}
+}
+
+func TestRemapFattrDump(t *testing.T) {
+	dump := "# file: /home/me/site\nuser.origin=0x6c6f63616c\n\n" +
+		"# file: /home/me/site/index.html\nsecurity.selinux=0x73797374656d5f753a00\n" +
+		"system.posix_acl_access=0x0200000001000600\n\n" +
+		"getfattr: /home/me/site/secret: Permission denied\n" +
+		"# file: /home/me/site-old/x\nuser.a=0x01\n\n" +
+		"# file: /home/me/site/caf\\303\\251\nuser.b=0x02\n\n"
+
+	got := remapFattrDump(dump, "/home/me/site", "/srv/www/site")
+	assert.Equal(t, "# file: /srv/www/site\nuser.origin=0x6c6f63616c\n\n"+
+		"# file: /srv/www/site/index.html\nsecurity.selinux=0x73797374656d5f753a00\n"+
+		"system.posix_acl_access=0x0200000001000600\n\n"+
+		"# file: /srv/www/site/caf\\303\\251\nuser.b=0x02\n\n", got)
+
+	assert.Empty(t, remapFattrDump("", "/a", "/b"))
+}
+
+func TestEscapeFattrPath(t *testing.T) {
+	assert.Equal(t, "/srv/my file", escapeFattrPath("/srv/my file"))
+	assert.Equal(t, `/srv/caf\303\251`, escapeFattrPath("/srv/café"))
+	assert.Equal(t, `/srv/a\134b\012c`, escapeFattrPath("/srv/a\\b\nc"))
+}
+
+func TestPushXattrs(t *testing.T) {
+	for _, tool := range []string{"getfattr", "setfattr"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not installed", tool)
+		}
+	}
+
+	src := filepath.Join(t.TempDir(), "src")
+	dest := filepath.Join(t.TempDir(), "dest")
+	for _, dir := range []string{src, dest} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), []byte("x"), 0644))
+	}
+	if err := exec.Command("setfattr", "-n", "user.klip", "-v", "yes", filepath.Join(src, "file")).Run(); err != nil {
+		t.Skipf("filesystem does not support user xattrs: %v", err)
+	}
+
+	runner := &localRunner{}
+	require.NoError(t, pushXattrs(context.Background(), runner, newPipeSFTPClient(t), src, dest))
+
+	output, err := exec.Command("getfattr", "--only-values", "-n", "user.klip", filepath.Join(dest, "file")).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "yes", string(output))
+}
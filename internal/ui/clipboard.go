@@ -0,0 +1,51 @@
+// Package ui - System clipboard access
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands returns the clipboard tools to try, in order, for the
+// current platform
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip.exe"}}
+	}
+
+	var commands [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-copy"})
+	}
+	return append(commands,
+		[]string{"xclip", "-selection", "clipboard"},
+		[]string{"xsel", "--clipboard", "--input"},
+		// WSL
+		[]string{"clip.exe"},
+	)
+}
+
+// CopyToClipboard places text on the system clipboard
+func CopyToClipboard(text string) error {
+	for _, args := range clipboardCommands() {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to copy to clipboard with %s: %w", args[0], err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
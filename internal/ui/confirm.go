@@ -0,0 +1,85 @@
+// Package ui - Confirmation of destructive operations
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Severity classifies how destructive an action is
+type Severity int
+
+const (
+	// Destructive actions (e.g., removing a profile) are confirmed by --yes
+	Destructive Severity = iota
+
+	// Irreversible actions destroy data klip cannot restore (e.g., deleting
+	// transferred sources). --yes alone still prompts on a terminal, and
+	// non-interactive runs require --force.
+	Irreversible
+)
+
+// ErrConfirmationRequired is returned when a destructive action cannot be
+// confirmed because klip is not running interactively
+var ErrConfirmationRequired = errors.New("confirmation required: re-run with --yes (or --force for irreversible actions)")
+
+// ErrNonInteractive is returned by prompts for input that --yes cannot
+// answer when klip runs with --non-interactive
+var ErrNonInteractive = errors.New("input required but klip is running non-interactively (--non-interactive)")
+
+// ConfirmPolicy holds the command-line answers to confirmation prompts
+type ConfirmPolicy struct {
+	// Yes answers yes to confirmation prompts (--yes/-y)
+	Yes bool
+
+	// Force proceeds with every destructive action without prompting (--force)
+	Force bool
+
+	// NonInteractive never reads from stdin: confirmations take the answer
+	// given by Yes and Force, and other prompts fail with ErrNonInteractive
+	// (--non-interactive)
+	NonInteractive bool
+}
+
+var confirmPolicy ConfirmPolicy
+
+// SetConfirmPolicy sets the policy used by ConfirmDestructive
+func SetConfirmPolicy(policy ConfirmPolicy) {
+	confirmPolicy = policy
+}
+
+// IsInteractive reports whether klip can prompt the user
+func IsInteractive() bool {
+	return !confirmPolicy.NonInteractive && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// requireInteractive returns ErrNonInteractive if klip must not prompt
+func requireInteractive() error {
+	if confirmPolicy.NonInteractive {
+		return ErrNonInteractive
+	}
+	return nil
+}
+
+// ConfirmDestructive asks before a destructive action, honoring --yes and
+// --force. It returns false if the user declines, and
+// ErrConfirmationRequired if it cannot ask and was not told to proceed.
+func ConfirmDestructive(severity Severity, format string, args ...interface{}) (bool, error) {
+	if confirmPolicy.Force {
+		return true, nil
+	}
+
+	if confirmPolicy.Yes && severity == Destructive {
+		return true, nil
+	}
+
+	if !IsInteractive() {
+		return false, ErrConfirmationRequired
+	}
+
+	return ConfirmDefaultNo(fmt.Sprintf(T(format), args...)), nil
+}
@@ -0,0 +1,56 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmDestructive(t *testing.T) {
+	defer SetConfirmPolicy(ConfirmPolicy{})
+
+	// Test stdin is not a terminal, so prompting is never possible
+	tests := []struct {
+		name      string
+		policy    ConfirmPolicy
+		severity  Severity
+		confirmed bool
+		wantErr   bool
+	}{
+		{"force", ConfirmPolicy{Force: true}, Irreversible, true, false},
+		{"yes destructive", ConfirmPolicy{Yes: true}, Destructive, true, false},
+		{"yes irreversible", ConfirmPolicy{Yes: true}, Irreversible, false, true},
+		{"no flags", ConfirmPolicy{}, Destructive, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetConfirmPolicy(tt.policy)
+
+			confirmed, err := ConfirmDestructive(tt.severity, "Remove %s?", "thing")
+			assert.Equal(t, tt.confirmed, confirmed)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrConfirmationRequired)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	defer SetConfirmPolicy(ConfirmPolicy{})
+
+	SetConfirmPolicy(ConfirmPolicy{NonInteractive: true})
+	assert.False(t, IsInteractive())
+	assert.False(t, Confirm("Continue?"))
+
+	_, err := PromptString("Name", "default")
+	assert.ErrorIs(t, err, ErrNonInteractive)
+	_, err = PromptPassword("Password")
+	assert.ErrorIs(t, err, ErrNonInteractive)
+
+	SetConfirmPolicy(ConfirmPolicy{NonInteractive: true, Yes: true})
+	assert.True(t, Confirm("Continue?"))
+	assert.True(t, ConfirmDefaultNo("Continue?"))
+}
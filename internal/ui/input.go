@@ -0,0 +1,182 @@
+// Package ui - Reading answers to prompts
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned by prompts the user cancelled with Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrNoInput is returned by prompts when stdin ends before an answer
+var ErrNoInput = errors.New("no answer: stdin is closed")
+
+// escapeSequence matches CSI sequences (colors, cursor movement), OSC
+// sequences (window titles) and other two-character escapes
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|.)`)
+
+// sanitizeInput removes escape sequences and control characters from user
+// input, which prevents terminal injection, and trims surrounding space
+func sanitizeInput(s string) string {
+	s = escapeSequence.ReplaceAllString(s, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) || r == '\t' {
+			return r
+		}
+		return -1
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// inputResult is a line read from stdin
+type inputResult struct {
+	line string
+	err  error
+}
+
+// inputReader reads the answers to every prompt from stdin. Sharing one
+// buffered reader keeps piped answers buffered for one prompt from being
+// lost to the next, and a read abandoned by Ctrl-C is handed to the next
+// prompt instead of competing with it for the user's next line.
+type inputReader struct {
+	mu sync.Mutex
+
+	// file is stdin, used to read secrets without echo when it is a
+	// terminal; nil reads secrets like other answers
+	file   *os.File
+	reader *bufio.Reader
+
+	// pending receives the result of a read a prompt stopped waiting for
+	pending chan inputResult
+}
+
+func newInputReader(file *os.File, r io.Reader) *inputReader {
+	return &inputReader{file: file, reader: bufio.NewReader(r)}
+}
+
+var input = newInputReader(os.Stdin, os.Stdin)
+
+// promptOutput is where prompts and the choices they offer are written:
+// stderr, like ssh and sudo do, so stdout holds only a command's output
+// even when it is piped or JSON. Replaced in tests.
+var promptOutput = func() io.Writer { return os.Stderr }
+
+// watchInterrupt delivers Ctrl-C to prompts until the returned function is
+// called. Commands that handle Ctrl-C themselves are notified as well.
+var watchInterrupt = func() (<-chan os.Signal, func()) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	return interrupt, func() { signal.Stop(interrupt) }
+}
+
+// read waits for a line from stdin, started by start unless an abandoned
+// read is still pending
+func (r *inputReader) read(start func(chan<- inputResult), onInterrupt func()) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == nil {
+		r.pending = make(chan inputResult, 1)
+		go start(r.pending)
+	}
+
+	interrupt, stop := watchInterrupt()
+	defer stop()
+
+	select {
+	case result := <-r.pending:
+		r.pending = nil
+		if result.err == io.EOF && result.line != "" {
+			// The last line of piped input has no newline
+			result.err = nil
+		}
+		switch {
+		case result.err == io.EOF:
+			return "", ErrNoInput
+		case result.err != nil:
+			return "", fmt.Errorf("failed to read input: %w", result.err)
+		}
+		return strings.TrimRight(result.line, "\r\n"), nil
+	case <-interrupt:
+		if onInterrupt != nil {
+			onInterrupt()
+		}
+		fmt.Fprintln(promptOutput())
+		return "", ErrInterrupted
+	}
+}
+
+// readLine reads a line as typed
+func (r *inputReader) readLine() (string, error) {
+	return r.read(func(result chan<- inputResult) {
+		line, err := r.reader.ReadString('\n')
+		result <- inputResult{line, err}
+	}, nil)
+}
+
+// readSecret reads a line without echo from a terminal, and like other
+// answers from anything else
+func (r *inputReader) readSecret() (string, error) {
+	if r.file == nil || !term.IsTerminal(int(r.file.Fd())) {
+		return r.readLine()
+	}
+
+	fd := int(r.file.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	secret, err := r.read(func(result chan<- inputResult) {
+		line, err := term.ReadPassword(fd)
+		if err == nil {
+			line = append(line, '\n')
+		}
+		result <- inputResult{string(line), err}
+	}, func() {
+		// Echo stays off until the abandoned read returns otherwise
+		term.Restore(fd, state)
+	})
+	if err == nil {
+		fmt.Fprintln(promptOutput())
+	}
+	return secret, err
+}
+
+// ReadLine prints prompt on stderr and reads a line of input, without escape
+// sequences, control characters and surrounding space. It returns
+// ErrNonInteractive with --non-interactive, ErrInterrupted on Ctrl-C and
+// ErrNoInput when stdin is closed.
+func ReadLine(prompt string) (string, error) {
+	if err := requireInteractive(); err != nil {
+		return "", err
+	}
+	fmt.Fprint(promptOutput(), prompt)
+	line, err := input.readLine()
+	if err != nil {
+		return "", err
+	}
+	return sanitizeInput(line), nil
+}
+
+// ReadSecret prints prompt on stderr and reads a line without echoing it to the
+// terminal. The answer is returned exactly as typed; errors are those of
+// ReadLine.
+func ReadSecret(prompt string) (string, error) {
+	if err := requireInteractive(); err != nil {
+		return "", err
+	}
+	fmt.Fprint(promptOutput(), prompt)
+	return input.readSecret()
+}
@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withInput answers prompts from r and delivers Ctrl-C from interrupt
+func withInput(t *testing.T, r io.Reader) chan os.Signal {
+	interrupt := make(chan os.Signal, 1)
+	oldInput, oldWatch := input, watchInterrupt
+	input = newInputReader(nil, r)
+	watchInterrupt = func() (<-chan os.Signal, func()) { return interrupt, func() {} }
+	t.Cleanup(func() {
+		input, watchInterrupt = oldInput, oldWatch
+		SetConfirmPolicy(ConfirmPolicy{})
+	})
+	return interrupt
+}
+
+func TestSanitizeInput(t *testing.T) {
+	tests := map[string]string{
+		"  web \r\n":                  "web",
+		"\x1b[31mred\x1b[0m":          "red",
+		"\x1b]0;title\x07name":        "name",
+		"a\x00b\x07c\x7f":             "abc",
+		"x\x1b[2Ky":                   "xy",
+		"héllo wörld":                 "héllo wörld",
+		"tab\there":                   "tab\there",
+		"\x1bcreset":                  "reset",
+		"\x1b]8;;http://x\x1b\\link ": "link",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, sanitizeInput(in), "%q", in)
+	}
+}
+
+func TestPromptsSharePipedInput(t *testing.T) {
+	// Every prompt reads its own line, though the first read buffers all
+	withInput(t, strings.NewReader("web\n\ny\n2\nlast"))
+
+	name, err := PromptString("Name", "")
+	require.NoError(t, err)
+	assert.Equal(t, "web", name)
+
+	host, err := PromptString("Host", "localhost")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", host)
+
+	assert.True(t, Confirm("Continue?"))
+
+	choice, err := PromptChoice("Pick", []string{"a", "b"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, choice)
+
+	// The last line needs no newline
+	last, err := PromptString("Last", "")
+	require.NoError(t, err)
+	assert.Equal(t, "last", last)
+
+	_, err = PromptString("More", "default")
+	assert.ErrorIs(t, err, ErrNoInput)
+}
+
+func TestConfirmClosedInput(t *testing.T) {
+	// A closed stdin answers no, even where the default is yes
+	withInput(t, strings.NewReader(""))
+	assert.False(t, Confirm("Continue?"))
+	assert.False(t, ConfirmDefaultNo("Continue?"))
+}
+
+func TestReadSecretWithoutTerminal(t *testing.T) {
+	// Secrets are read like other answers, but exactly as typed
+	withInput(t, strings.NewReader("  s3cret\x1b \n"))
+	secret, err := ReadSecret("Password: ")
+	require.NoError(t, err)
+	assert.Equal(t, "  s3cret\x1b ", secret)
+}
+
+func TestPromptNonInteractive(t *testing.T) {
+	withInput(t, strings.NewReader("ignored\n"))
+	SetConfirmPolicy(ConfirmPolicy{NonInteractive: true, Yes: true})
+
+	_, err := PromptString("Name", "default")
+	assert.ErrorIs(t, err, ErrNonInteractive)
+	_, err = ReadSecret("Password: ")
+	assert.ErrorIs(t, err, ErrNonInteractive)
+	assert.True(t, Confirm("Continue?"))
+}
+
+func TestPromptInterrupted(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	interrupt := withInput(t, r)
+
+	interrupt <- os.Interrupt
+	_, err := PromptString("Name", "")
+	assert.ErrorIs(t, err, ErrInterrupted)
+
+	// The abandoned read delivers the next line to the next prompt
+	go io.WriteString(w, "web\n")
+	name, err := PromptString("Name", "")
+	require.NoError(t, err)
+	assert.Equal(t, "web", name)
+}
+
+func TestPromptsWriteToStderr(t *testing.T) {
+	withInput(t, strings.NewReader("web\ns3cret\n2\n"))
+	var prompts strings.Builder
+	oldOutput := promptOutput
+	promptOutput = func() io.Writer { return &prompts }
+	t.Cleanup(func() { promptOutput = oldOutput })
+
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.NoError(t, err)
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = oldStdout }()
+
+	_, err = ReadLine("Name: ")
+	require.NoError(t, err)
+	_, err = ReadSecret("Password: ")
+	require.NoError(t, err)
+	_, err = PromptMultiChoice("Pick", []string{"a", "b"})
+	require.NoError(t, err)
+
+	assert.Contains(t, prompts.String(), "Name: ")
+	assert.Contains(t, prompts.String(), "Password: ")
+	assert.Contains(t, prompts.String(), "  2. b\n")
+	written, err := os.ReadFile(stdout.Name())
+	require.NoError(t, err)
+	assert.NotContains(t, string(written), "Name: ")
+	assert.NotContains(t, string(written), "Password: ")
+	assert.NotContains(t, string(written), "2. b")
+}
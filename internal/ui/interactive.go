@@ -1,11 +1,8 @@
 package ui
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"strconv"
-	"strings"
 
 	"github.com/orpheus497/klip/internal/config"
 )
@@ -37,6 +34,10 @@ func (ps *ProfileSelector) SelectProfile() (*config.Profile, string, error) {
 		return profile, profileName, err
 	}
 
+	if err := requireInteractive(); err != nil {
+		return nil, "", fmt.Errorf("no profile given: %w", err)
+	}
+
 	PrintHeader("Select Connection Profile")
 	PrintEmptyLine()
 
@@ -50,29 +51,24 @@ func (ps *ProfileSelector) SelectProfile() (*config.Profile, string, error) {
 		isCurrent := (name == ps.config.CurrentProfile)
 		marker := " "
 		if isCurrent {
-			marker = Success("●")
+			marker = Highlight("●")
 		}
 
-		fmt.Printf("  %s %d. %s\n", marker, i+1, Bold(name))
-		fmt.Printf("      %s@%s (%s)\n", profile.RemoteUser, profile.RemoteHost, profile.Backend)
+		fmt.Fprintf(promptOutput(), "  %s %d. %s\n", marker, i+1, Bold(name))
+		fmt.Fprintf(promptOutput(), "      %s@%s (%s)\n", profile.RemoteUser, profile.RemoteHost, profile.Backend)
 
 		if profile.Description != "" {
-			fmt.Printf("      %s\n", Dim(profile.Description))
+			fmt.Fprintf(promptOutput(), "      %s\n", Dim(profile.Description))
 		}
 		PrintEmptyLine()
 	}
 
 	// Prompt for selection
-	fmt.Print(Info("Select profile number (or press Enter for current): "))
-
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := ReadLine(Info(T("Select profile number (or press Enter for current): ")))
 	if err != nil {
 		return nil, "", err
 	}
 
-	input = strings.TrimSpace(input)
-
 	// If empty, use current profile
 	if input == "" {
 		if ps.config.CurrentProfile == "" {
@@ -99,42 +95,38 @@ func (ps *ProfileSelector) SelectProfile() (*config.Profile, string, error) {
 
 // CreateProfileInteractive creates a profile interactively
 func CreateProfileInteractive() (*config.Profile, string, error) {
+	if err := requireInteractive(); err != nil {
+		return nil, "", err
+	}
+
 	PrintHeader("Create New Profile")
 	PrintEmptyLine()
 
-	reader := bufio.NewReader(os.Stdin)
-
 	// Profile name
-	fmt.Print(Bold("Profile name: "))
-	name, err := reader.ReadString('\n')
+	name, err := ReadLine(Bold(T("Profile name: ")))
 	if err != nil {
 		return nil, "", err
 	}
-	name = strings.TrimSpace(name)
 
 	if name == "" {
 		return nil, "", fmt.Errorf("profile name cannot be empty")
 	}
 
 	// Remote user
-	fmt.Print(Bold("Remote username: "))
-	user, err := reader.ReadString('\n')
+	user, err := ReadLine(Bold(T("Remote username: ")))
 	if err != nil {
 		return nil, "", err
 	}
-	user = strings.TrimSpace(user)
 
 	if user == "" {
 		return nil, "", fmt.Errorf("username cannot be empty")
 	}
 
 	// Remote host
-	fmt.Print(Bold("Remote hostname or IP: "))
-	host, err := reader.ReadString('\n')
+	host, err := ReadLine(Bold(T("Remote hostname or IP: ")))
 	if err != nil {
 		return nil, "", err
 	}
-	host = strings.TrimSpace(host)
 
 	if host == "" {
 		return nil, "", fmt.Errorf("hostname cannot be empty")
@@ -146,12 +138,13 @@ func CreateProfileInteractive() (*config.Profile, string, error) {
 	// Backend selection
 	PrintEmptyLine()
 	PrintInfo("Select VPN backend:")
-	backends := []string{"auto", "lan", "tailscale", "headscale", "netbird"}
+	backends := []string{"auto", "lan", "tailscale", "headscale", "netbird", "zerotier", "wireguard"}
 	PrintNumberedList(backends)
 
-	fmt.Print(Bold("Backend [1-5] (default: 1): "))
-	backendInput, _ := reader.ReadString('\n')
-	backendInput = strings.TrimSpace(backendInput)
+	backendInput, err := ReadLine(Bold(T("Backend [1-7] (default: 1): ")))
+	if err != nil {
+		return nil, "", err
+	}
 
 	if backendInput == "" {
 		backendInput = "1"
@@ -167,9 +160,10 @@ func CreateProfileInteractive() (*config.Profile, string, error) {
 
 	// SSH port (optional)
 	PrintEmptyLine()
-	fmt.Print(Bold("SSH port (default: 22): "))
-	portInput, _ := reader.ReadString('\n')
-	portInput = strings.TrimSpace(portInput)
+	portInput, err := ReadLine(Bold(T("SSH port (default: 22): ")))
+	if err != nil {
+		return nil, "", err
+	}
 
 	if portInput != "" {
 		port, err := strconv.Atoi(portInput)
@@ -182,9 +176,10 @@ func CreateProfileInteractive() (*config.Profile, string, error) {
 
 	// SSH key path (optional)
 	PrintEmptyLine()
-	fmt.Print(Bold("SSH key path (optional, press Enter to skip): "))
-	keyPath, _ := reader.ReadString('\n')
-	keyPath = strings.TrimSpace(keyPath)
+	keyPath, err := ReadLine(Bold(T("SSH key path (optional, press Enter to skip): ")))
+	if err != nil {
+		return nil, "", err
+	}
 
 	if keyPath != "" {
 		profile.SSHKeyPath = keyPath
@@ -192,9 +187,10 @@ func CreateProfileInteractive() (*config.Profile, string, error) {
 
 	// Description (optional)
 	PrintEmptyLine()
-	fmt.Print(Bold("Description (optional): "))
-	desc, _ := reader.ReadString('\n')
-	desc = strings.TrimSpace(desc)
+	desc, err := ReadLine(Bold(T("Description (optional): ")))
+	if err != nil {
+		return nil, "", err
+	}
 
 	if desc != "" {
 		profile.Description = desc
@@ -205,36 +201,42 @@ func CreateProfileInteractive() (*config.Profile, string, error) {
 
 // EditProfileInteractive edits a profile interactively
 func EditProfileInteractive(profile *config.Profile) error {
-	PrintHeader(fmt.Sprintf("Edit Profile: %s", profile.Name))
-	PrintEmptyLine()
+	if err := requireInteractive(); err != nil {
+		return err
+	}
 
-	reader := bufio.NewReader(os.Stdin)
+	PrintHeader(fmt.Sprintf(T("Edit Profile: %s"), profile.Name))
+	PrintEmptyLine()
 
 	// Show current values and allow editing
-	fmt.Printf("Remote user [%s]: ", profile.RemoteUser)
-	user, _ := reader.ReadString('\n')
-	user = strings.TrimSpace(user)
+	user, err := ReadLine(fmt.Sprintf(T("Remote user [%s]: "), profile.RemoteUser))
+	if err != nil {
+		return err
+	}
 	if user != "" {
 		profile.RemoteUser = user
 	}
 
-	fmt.Printf("Remote host [%s]: ", profile.RemoteHost)
-	host, _ := reader.ReadString('\n')
-	host = strings.TrimSpace(host)
+	host, err := ReadLine(fmt.Sprintf(T("Remote host [%s]: "), profile.RemoteHost))
+	if err != nil {
+		return err
+	}
 	if host != "" {
 		profile.RemoteHost = host
 	}
 
-	fmt.Printf("Backend [%s]: ", profile.Backend)
-	backend, _ := reader.ReadString('\n')
-	backend = strings.TrimSpace(backend)
+	backend, err := ReadLine(fmt.Sprintf(T("Backend [%s]: "), profile.Backend))
+	if err != nil {
+		return err
+	}
 	if backend != "" {
 		profile.Backend = config.BackendType(backend)
 	}
 
-	fmt.Printf("SSH port [%d]: ", profile.SSHPort)
-	portInput, _ := reader.ReadString('\n')
-	portInput = strings.TrimSpace(portInput)
+	portInput, err := ReadLine(fmt.Sprintf(T("SSH port [%d]: "), profile.SSHPort))
+	if err != nil {
+		return err
+	}
 	if portInput != "" {
 		port, err := strconv.Atoi(portInput)
 		if err == nil && port > 0 && port <= 65535 {
@@ -242,16 +244,18 @@ func EditProfileInteractive(profile *config.Profile) error {
 		}
 	}
 
-	fmt.Printf("SSH key path [%s]: ", profile.SSHKeyPath)
-	keyPath, _ := reader.ReadString('\n')
-	keyPath = strings.TrimSpace(keyPath)
+	keyPath, err := ReadLine(fmt.Sprintf(T("SSH key path [%s]: "), profile.SSHKeyPath))
+	if err != nil {
+		return err
+	}
 	if keyPath != "" {
 		profile.SSHKeyPath = keyPath
 	}
 
-	fmt.Printf("Description [%s]: ", profile.Description)
-	desc, _ := reader.ReadString('\n')
-	desc = strings.TrimSpace(desc)
+	desc, err := ReadLine(fmt.Sprintf(T("Description [%s]: "), profile.Description))
+	if err != nil {
+		return err
+	}
 	if desc != "" {
 		profile.Description = desc
 	}
@@ -261,20 +265,19 @@ func EditProfileInteractive(profile *config.Profile) error {
 
 // SelectBackend interactively selects a backend
 func SelectBackend() (string, error) {
+	if err := requireInteractive(); err != nil {
+		return "", err
+	}
+
 	PrintInfo("Select VPN backend:")
 
-	backends := []string{"auto", "lan", "tailscale", "headscale", "netbird"}
+	backends := []string{"auto", "lan", "tailscale", "headscale", "netbird", "zerotier", "wireguard"}
 	PrintNumberedList(backends)
 
-	fmt.Print(Bold("Backend [1-5]: "))
-
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := ReadLine(Bold(T("Backend [1-7]: ")))
 	if err != nil {
 		return "", err
 	}
-
-	input = strings.TrimSpace(input)
 	selection, err := strconv.Atoi(input)
 	if err != nil || selection < 1 || selection > len(backends) {
 		return "", fmt.Errorf("invalid selection")
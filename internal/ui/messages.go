@@ -0,0 +1,129 @@
+// Package ui - Message catalog and locale selection
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/orpheus497/klip/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLocale is the locale of the built-in (source) messages
+const DefaultLocale = "en"
+
+// Message catalogs map the English source string of a message to its
+// translation. English is built in; other locales, and overrides of the
+// English text for branded deployments, are loaded from
+// <config dir>/messages/<locale>.yaml. Messages missing from a catalog fall
+// back to the English source.
+var (
+	catalogMu     sync.RWMutex
+	catalog       map[string]string
+	currentLocale = DefaultLocale
+)
+
+// T returns the message for the current locale
+// Format verbs in the source string must be kept in the translation
+func T(message string) string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	if translated, ok := catalog[message]; ok && translated != "" {
+		return translated
+	}
+	return message
+}
+
+// Locale returns the active locale
+func Locale() string {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	return currentLocale
+}
+
+// SetLocale activates the catalog for a locale from the messages directory
+// A locale without a catalog file uses the English source messages
+func SetLocale(locale string) error {
+	return loadCatalog(config.MessagesDir(), locale)
+}
+
+// DetectLocale picks the locale from the configured setting, falling back to
+// KLIP_LOCALE, LC_ALL, LC_MESSAGES and LANG
+func DetectLocale(configured string) string {
+	candidates := []string{
+		configured,
+		os.Getenv("KLIP_LOCALE"),
+		os.Getenv("LC_ALL"),
+		os.Getenv("LC_MESSAGES"),
+		os.Getenv("LANG"),
+	}
+
+	for _, candidate := range candidates {
+		if locale := normalizeLocale(candidate); locale != "" {
+			return locale
+		}
+	}
+
+	return DefaultLocale
+}
+
+// normalizeLocale turns values like "de_DE.UTF-8" into "de_DE"
+// The C and POSIX locales map to the default locale
+func normalizeLocale(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexAny(value, ".@"); i >= 0 {
+		value = value[:i]
+	}
+
+	switch value {
+	case "":
+		return ""
+	case "C", "POSIX":
+		return DefaultLocale
+	}
+
+	return strings.ReplaceAll(value, "-", "_")
+}
+
+// loadCatalog reads <dir>/<locale>.yaml, trying the language without its
+// region (de_DE -> de) when no exact catalog exists
+func loadCatalog(dir, locale string) error {
+	messages := make(map[string]string)
+
+	names := []string{locale}
+	if lang, _, found := strings.Cut(locale, "_"); found {
+		names = append(names, lang)
+	}
+
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name+".yaml"))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to read message catalog: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("failed to parse message catalog %s: %w", name, err)
+		}
+		break
+	}
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	catalog = messages
+	currentLocale = locale
+
+	return nil
+}
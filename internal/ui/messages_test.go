@@ -0,0 +1,53 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLocale(t *testing.T) {
+	t.Setenv("KLIP_LOCALE", "")
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "de_DE.UTF-8")
+
+	assert.Equal(t, "fr", DetectLocale("fr"))
+	assert.Equal(t, "de_DE", DetectLocale(""))
+
+	t.Setenv("LC_ALL", "C")
+	assert.Equal(t, DefaultLocale, DetectLocale(""))
+
+	t.Setenv("KLIP_LOCALE", "pt-BR")
+	assert.Equal(t, "pt_BR", DetectLocale(""))
+}
+
+func TestLoadCatalog(t *testing.T) {
+	defer loadCatalog(t.TempDir(), DefaultLocale)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de.yaml"),
+		[]byte("\"Connected to %s@%s\": \"Verbunden mit %s@%s\"\n"), 0600))
+
+	// Region-specific locale falls back to the language catalog
+	require.NoError(t, loadCatalog(dir, "de_DE"))
+	assert.Equal(t, "de_DE", Locale())
+	assert.Equal(t, "Verbunden mit %s@%s", T("Connected to %s@%s"))
+	assert.Equal(t, "Cancelled", T("Cancelled"))
+
+	// A locale without a catalog uses the source messages
+	require.NoError(t, loadCatalog(dir, "ja"))
+	assert.Equal(t, "Connected to %s@%s", T("Connected to %s@%s"))
+}
+
+func TestLoadCatalogInvalid(t *testing.T) {
+	defer loadCatalog(t.TempDir(), DefaultLocale)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "en.yaml"), []byte("- not a map\n"), 0600))
+
+	assert.Error(t, loadCatalog(dir, "en"))
+}
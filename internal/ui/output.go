@@ -5,75 +5,94 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-runewidth"
 )
 
 var (
 	// Color functions for different message types
-	Success = color.New(color.FgGreen).SprintFunc()
-	Error   = color.New(color.FgRed).SprintFunc()
-	Warning = color.New(color.FgYellow).SprintFunc()
-	Info    = color.New(color.FgCyan).SprintFunc()
-	Bold    = color.New(color.Bold).SprintFunc()
-	Dim     = color.New(color.Faint).SprintFunc()
+	// Replaced by ApplyTheme when settings.theme is set
+	Success   = color.New(color.FgGreen).SprintFunc()
+	Error     = color.New(color.FgRed).SprintFunc()
+	Warning   = color.New(color.FgYellow).SprintFunc()
+	Info      = color.New(color.FgCyan).SprintFunc()
+	Bold      = color.New(color.Bold).SprintFunc()
+	Dim       = color.New(color.Faint).SprintFunc()
+	Highlight = color.New(color.FgGreen).SprintFunc()
+
+	// ansiSequence matches ANSI color/control sequences for width measurement
+	ansiSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
 )
 
 // PrintSuccess prints a success message
 func PrintSuccess(format string, args ...interface{}) {
-	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%s %s\n", Success("✓"), message)
+	message := fmt.Sprintf(T(format), args...)
+	fmt.Fprintf(StatusOutput(), "%s %s\n", Success("✓"), message)
 }
 
 // PrintError prints an error message
 func PrintError(format string, args ...interface{}) {
-	message := fmt.Sprintf(format, args...)
+	message := fmt.Sprintf(T(format), args...)
 	fmt.Fprintf(os.Stderr, "%s %s\n", Error("✗"), message)
 }
 
 // PrintWarning prints a warning message
 func PrintWarning(format string, args ...interface{}) {
-	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%s %s\n", Warning("!"), message)
+	message := fmt.Sprintf(T(format), args...)
+	fmt.Fprintf(StatusOutput(), "%s %s\n", Warning("!"), message)
 }
 
 // PrintInfo prints an informational message
 func PrintInfo(format string, args ...interface{}) {
-	message := fmt.Sprintf(format, args...)
-	fmt.Printf("%s %s\n", Info("ℹ"), message)
+	message := fmt.Sprintf(T(format), args...)
+	fmt.Fprintf(StatusOutput(), "%s %s\n", Info("ℹ"), message)
 }
 
 // PrintHeader prints a section header
 func PrintHeader(text string) {
-	fmt.Println()
-	fmt.Println(Bold(text))
-	fmt.Println(strings.Repeat("=", len(text)))
+	out := StatusOutput()
+	text = T(text)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, Bold(text))
+	fmt.Fprintln(out, strings.Repeat("=", DisplayWidth(text)))
 }
 
 // PrintSubHeader prints a subsection header
 func PrintSubHeader(text string) {
-	fmt.Println()
-	fmt.Println(Bold(text))
-	fmt.Println(strings.Repeat("-", len(text)))
+	out := StatusOutput()
+	text = T(text)
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, Bold(text))
+	fmt.Fprintln(out, strings.Repeat("-", DisplayWidth(text)))
 }
 
 // PrintTable prints data in a table format
 func PrintTable(headers []string, rows [][]string) {
+	out := StatusOutput()
 	if len(headers) == 0 || len(rows) == 0 {
 		return
 	}
 
-	// Calculate column widths
+	translated := make([]string, len(headers))
+	for i, header := range headers {
+		translated[i] = T(header)
+	}
+	headers = translated
+
+	// Calculate column widths by terminal cells, not bytes, so wide
+	// characters and color codes don't break alignment
 	widths := make([]int, len(headers))
 	for i, header := range headers {
-		widths[i] = len(header)
+		widths[i] = DisplayWidth(header)
 	}
 
 	for _, row := range rows {
 		for i, cell := range row {
-			if i < len(widths) && len(cell) > widths[i] {
-				widths[i] = len(cell)
+			if i < len(widths) && DisplayWidth(cell) > widths[i] {
+				widths[i] = DisplayWidth(cell)
 			}
 		}
 	}
@@ -86,7 +105,7 @@ func PrintTable(headers []string, rows [][]string) {
 		}
 		headerRow += Bold(padRight(header, widths[i]))
 	}
-	fmt.Println(headerRow)
+	fmt.Fprintln(out, headerRow)
 
 	// Print separator
 	separator := ""
@@ -96,7 +115,7 @@ func PrintTable(headers []string, rows [][]string) {
 		}
 		separator += strings.Repeat("─", width)
 	}
-	fmt.Println(separator)
+	fmt.Fprintln(out, separator)
 
 	// Print rows
 	for _, row := range rows {
@@ -111,75 +130,92 @@ func PrintTable(headers []string, rows [][]string) {
 			}
 			rowStr += padRight(cell, widths[i])
 		}
-		fmt.Println(rowStr)
+		fmt.Fprintln(out, rowStr)
 	}
 }
 
 // PrintKeyValue prints key-value pairs
 func PrintKeyValue(key, value string) {
-	fmt.Printf("%s: %s\n", Bold(key), value)
+	fmt.Fprintf(StatusOutput(), "%s: %s\n", Bold(T(key)), value)
 }
 
 // PrintList prints a bulleted list
 func PrintList(items []string) {
+	out := StatusOutput()
 	for _, item := range items {
-		fmt.Printf("  • %s\n", item)
+		fmt.Fprintf(out, "  • %s\n", item)
 	}
 }
 
 // PrintNumberedList prints a numbered list
 func PrintNumberedList(items []string) {
+	out := StatusOutput()
 	for i, item := range items {
-		fmt.Printf("  %d. %s\n", i+1, item)
+		fmt.Fprintf(out, "  %d. %s\n", i+1, item)
 	}
 }
 
 // PrintSeparator prints a separator line
 func PrintSeparator() {
-	fmt.Println(strings.Repeat("─", 80))
+	fmt.Fprintln(StatusOutput(), strings.Repeat("─", 80))
 }
 
 // PrintEmptyLine prints an empty line
 func PrintEmptyLine() {
-	fmt.Println()
+	fmt.Fprintln(StatusOutput())
+}
+
+// StripANSI removes ANSI escape sequences from a string
+func StripANSI(s string) string {
+	return ansiSequence.ReplaceAllString(s, "")
+}
+
+// DisplayWidth returns the number of terminal cells a string occupies,
+// accounting for wide (CJK, emoji) characters and ignoring ANSI sequences
+func DisplayWidth(s string) int {
+	return runewidth.StringWidth(StripANSI(s))
 }
 
 // padRight pads a string with spaces on the right
 func padRight(s string, width int) string {
-	if len(s) >= width {
+	w := DisplayWidth(s)
+	if w >= width {
 		return s
 	}
-	return s + strings.Repeat(" ", width-len(s))
+	return s + strings.Repeat(" ", width-w)
 }
 
 // padLeft pads a string with spaces on the left
 func padLeft(s string, width int) string {
-	if len(s) >= width {
+	w := DisplayWidth(s)
+	if w >= width {
 		return s
 	}
-	return strings.Repeat(" ", width-len(s)) + s
+	return strings.Repeat(" ", width-w) + s
 }
 
-// Confirm prompts the user for confirmation (Y/n)
+// Confirm prompts the user for confirmation (Y/n). With --non-interactive
+// the answer is yes only if --yes or --force was given. Ctrl-C and a
+// closed stdin answer no.
 func Confirm(prompt string) bool {
-	fmt.Printf("%s [Y/n]: ", prompt)
-
-	var response string
-	fmt.Scanln(&response)
+	if confirmPolicy.NonInteractive {
+		return confirmPolicy.Yes || confirmPolicy.Force
+	}
 
-	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "" || response == "y" || response == "yes"
+	confirmed, err := PromptBool(prompt, true)
+	return confirmed && err == nil
 }
 
-// ConfirmDefaultNo prompts the user for confirmation (y/N)
+// ConfirmDefaultNo prompts the user for confirmation (y/N). With
+// --non-interactive the answer is yes only if --yes or --force was given.
+// Ctrl-C and a closed stdin answer no.
 func ConfirmDefaultNo(prompt string) bool {
-	fmt.Printf("%s [y/N]: ", prompt)
-
-	var response string
-	fmt.Scanln(&response)
+	if confirmPolicy.NonInteractive {
+		return confirmPolicy.Yes || confirmPolicy.Force
+	}
 
-	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "y" || response == "yes"
+	confirmed, err := PromptBool(prompt, false)
+	return confirmed && err == nil
 }
 
 // PrintJSON prints data as formatted JSON
@@ -194,10 +230,10 @@ func PrintJSON(data interface{}) error {
 
 // ClearLine clears the current line
 func ClearLine() {
-	fmt.Print("\r\033[K")
+	fmt.Fprint(StatusOutput(), "\r\033[K")
 }
 
 // PrintInline prints without a newline
 func PrintInline(format string, args ...interface{}) {
-	fmt.Printf(format, args...)
+	fmt.Fprintf(StatusOutput(), T(format), args...)
 }
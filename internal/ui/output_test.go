@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+	}{
+		{"ascii", "hello", 5},
+		{"cjk", "日本語", 6},
+		{"emoji", "🚀", 2},
+		{"symbol", "✓ Connected", 11},
+		{"ansi", Success("✓ Connected"), 11},
+		{"empty", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DisplayWidth(tt.input))
+		})
+	}
+}
+
+func TestPadRightUsesDisplayWidth(t *testing.T) {
+	assert.Equal(t, "日本  ", padRight("日本", 6))
+	assert.Equal(t, "  日本", padLeft("日本", 6))
+	assert.Equal(t, "\x1b[32mok\x1b[0m  ", padRight("\x1b[32mok\x1b[0m", 4))
+	assert.Equal(t, "toolong", padRight("toolong", 3))
+}
@@ -0,0 +1,109 @@
+// Package ui - Pager integration for long output
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// defaultPager is used when $PAGER is unset; -R passes colors through
+const defaultPager = "less -R"
+
+// Pager captures stdout and, once closed, sends it through $PAGER when it
+// would not fit on the terminal. Output that fits is written directly.
+type Pager struct {
+	stdout *os.File
+	reader *os.File
+	writer *os.File
+	buf    bytes.Buffer
+	done   chan struct{}
+}
+
+// StartPager begins capturing stdout for paging
+// Returns a pass-through pager when disabled or stdout is not a terminal
+func StartPager(disabled bool) *Pager {
+	p := &Pager{stdout: os.Stdout}
+
+	if disabled || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return p
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return p
+	}
+
+	p.reader = r
+	p.writer = w
+	p.done = make(chan struct{})
+	os.Stdout = w
+
+	go func() {
+		io.Copy(&p.buf, r)
+		close(p.done)
+	}()
+
+	return p
+}
+
+// Close restores stdout and displays the captured output
+func (p *Pager) Close() error {
+	if p.writer == nil {
+		return nil
+	}
+
+	os.Stdout = p.stdout
+	p.writer.Close()
+	<-p.done
+	p.reader.Close()
+	p.writer = nil
+
+	_, height, err := term.GetSize(int(p.stdout.Fd()))
+	if err != nil || bytes.Count(p.buf.Bytes(), []byte("\n")) < height {
+		_, err := p.stdout.Write(p.buf.Bytes())
+		return err
+	}
+
+	args := pagerCommand()
+	if len(args) == 0 {
+		_, err := p.stdout.Write(p.buf.Bytes())
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(p.buf.Bytes())
+	cmd.Stdout = p.stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		// Fall back to plain output if the pager is missing or broken
+		if _, ok := err.(*exec.ExitError); !ok {
+			_, err := p.stdout.Write(p.buf.Bytes())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pagerCommand returns the pager to run, honoring $PAGER
+// An empty result (PAGER set to "" or "cat") disables paging
+func pagerCommand() []string {
+	pager, set := os.LookupEnv("PAGER")
+	if !set {
+		pager = defaultPager
+	}
+
+	args := strings.Fields(pager)
+	if len(args) == 0 || args[0] == "cat" {
+		return nil
+	}
+
+	return args
+}
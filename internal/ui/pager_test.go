@@ -0,0 +1,24 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagerCommand(t *testing.T) {
+	t.Setenv("PAGER", "more -s")
+	assert.Equal(t, []string{"more", "-s"}, pagerCommand())
+
+	t.Setenv("PAGER", "cat")
+	assert.Nil(t, pagerCommand())
+
+	t.Setenv("PAGER", "")
+	assert.Nil(t, pagerCommand())
+}
+
+func TestStartPagerPassThroughWhenNotTerminal(t *testing.T) {
+	p := StartPager(false)
+	assert.Nil(t, p.writer)
+	assert.NoError(t, p.Close())
+}
@@ -1,63 +1,30 @@
 package ui
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
-	"unicode"
-
-	"golang.org/x/term"
 )
 
-// sanitizeInput removes control characters and ANSI escape sequences from user input
-// This prevents terminal injection attacks and ensures clean input
-func sanitizeInput(s string) string {
-	// Remove control characters (0x00-0x1F, 0x7F) except tab and newline
-	var result strings.Builder
-	for _, r := range s {
-		// Keep printable characters and safe whitespace (space, tab, newline)
-		if unicode.IsPrint(r) || r == '\t' || r == '\n' || r == ' ' {
-			result.WriteRune(r)
-		}
-	}
-
-	s = result.String()
-
-	// Remove ANSI escape sequences (e.g., \x1b[31m for colors)
-	ansiEscape := regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
-	s = ansiEscape.ReplaceAllString(s, "")
-
-	// Remove CSI sequences (e.g., \x1b]0;title\x07)
-	csiSequence := regexp.MustCompile(`\x1b\][^\x07]*\x07`)
-	s = csiSequence.ReplaceAllString(s, "")
-
-	// Remove other escape sequences
-	otherEscape := regexp.MustCompile(`\x1b[^\[]*`)
-	s = otherEscape.ReplaceAllString(s, "")
-
-	return strings.TrimSpace(s)
-}
-
 // PromptString prompts for a string input
 func PromptString(prompt string, defaultValue string) (string, error) {
+	if err := requireInteractive(); err != nil {
+		return "", err
+	}
+
+	prompt = T(prompt)
 	if defaultValue != "" {
-		fmt.Printf("%s [%s]: ", prompt, defaultValue)
+		prompt = fmt.Sprintf("%s [%s]: ", prompt, defaultValue)
 	} else {
-		fmt.Printf("%s: ", prompt)
+		prompt += ": "
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := ReadLine(prompt)
 	if err != nil {
 		return "", err
 	}
 
-	// Sanitize input to remove control characters and escape sequences
-	input = sanitizeInput(input)
-
 	if input == "" && defaultValue != "" {
 		return defaultValue, nil
 	}
@@ -96,16 +63,11 @@ func PromptBool(prompt string, defaultValue bool) (bool, error) {
 		suffix = " [Y/n]"
 	}
 
-	fmt.Printf("%s%s: ", prompt, suffix)
-
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := ReadLine(T(prompt) + suffix + ": ")
 	if err != nil {
 		return false, err
 	}
-
-	// Sanitize and normalize input
-	input = strings.ToLower(sanitizeInput(input))
+	input = strings.ToLower(input)
 
 	if input == "" {
 		return defaultValue, nil
@@ -117,37 +79,30 @@ func PromptBool(prompt string, defaultValue bool) (bool, error) {
 	case "n", "no", "false", "0":
 		return false, nil
 	default:
-		return false, fmt.Errorf("invalid boolean value: %s", input)
+		return false, fmt.Errorf(T("invalid boolean value: %s"), input)
 	}
 }
 
-// PromptPassword prompts for a password input (hidden)
+// PromptPassword prompts for a password input (hidden), returned exactly
+// as typed
 func PromptPassword(prompt string) (string, error) {
-	fmt.Printf("%s: ", prompt)
-
-	passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-	if err != nil {
-		return "", err
-	}
-
-	fmt.Println() // Print newline after password input
-
-	// Sanitize password input (though it won't be displayed)
-	password := sanitizeInput(string(passwordBytes))
-
-	return password, nil
+	return ReadSecret(T(prompt) + ": ")
 }
 
 // PromptChoice prompts for a choice from a list
 func PromptChoice(prompt string, choices []string, defaultIndex int) (int, error) {
+	if err := requireInteractive(); err != nil {
+		return 0, err
+	}
+
 	PrintInfo(prompt)
 
 	for i, choice := range choices {
 		marker := " "
 		if i == defaultIndex {
-			marker = Success("●")
+			marker = Highlight("●")
 		}
-		fmt.Printf("  %s %d. %s\n", marker, i+1, choice)
+		fmt.Fprintf(promptOutput(), "  %s %d. %s\n", marker, i+1, choice)
 	}
 
 	defaultStr := ""
@@ -178,23 +133,22 @@ func PromptChoice(prompt string, choices []string, defaultIndex int) (int, error
 
 // PromptMultiChoice prompts for multiple choices from a list
 func PromptMultiChoice(prompt string, choices []string) ([]int, error) {
+	if err := requireInteractive(); err != nil {
+		return nil, err
+	}
+
 	PrintInfo(prompt)
 
 	for i, choice := range choices {
-		fmt.Printf("  %d. %s\n", i+1, choice)
+		fmt.Fprintf(promptOutput(), "  %d. %s\n", i+1, choice)
 	}
 
-	fmt.Println()
-	fmt.Printf("Enter selections (comma-separated, e.g., 1,3,5): ")
-
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	fmt.Fprintln(promptOutput())
+	input, err := ReadLine(T("Enter selections (comma-separated, e.g., 1,3,5): "))
 	if err != nil {
 		return nil, err
 	}
 
-	input = strings.TrimSpace(input)
-
 	if input == "" {
 		return []int{}, nil
 	}
@@ -272,26 +226,26 @@ func PromptValidated(prompt string, validator func(string) error) (string, error
 
 // PromptMenu displays a menu and returns the selected option
 func PromptMenu(title string, options []MenuOption) (string, error) {
+	if err := requireInteractive(); err != nil {
+		return "", err
+	}
+
 	PrintHeader(title)
 	PrintEmptyLine()
 
 	for i, option := range options {
-		fmt.Printf("  %d. %s\n", i+1, Bold(option.Label))
+		fmt.Fprintf(promptOutput(), "  %d. %s\n", i+1, Bold(T(option.Label)))
 		if option.Description != "" {
-			fmt.Printf("     %s\n", Dim(option.Description))
+			fmt.Fprintf(promptOutput(), "     %s\n", Dim(T(option.Description)))
 		}
 	}
 
 	PrintEmptyLine()
-	fmt.Print(Info("Select an option: "))
-
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := ReadLine(Info(T("Select an option: ")))
 	if err != nil {
 		return "", err
 	}
 
-	input = strings.TrimSpace(input)
 	selection, err := strconv.Atoi(input)
 	if err != nil || selection < 1 || selection > len(options) {
 		return "", fmt.Errorf("invalid selection")
@@ -309,6 +263,10 @@ type MenuOption struct {
 
 // WaitForEnter waits for the user to press Enter
 func WaitForEnter() {
-	fmt.Print("\nPress Enter to continue...")
-	bufio.NewReader(os.Stdin).ReadBytes('\n')
+	if requireInteractive() != nil {
+		return
+	}
+
+	fmt.Fprintln(promptOutput())
+	ReadLine(T("Press Enter to continue..."))
 }
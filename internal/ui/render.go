@@ -0,0 +1,67 @@
+// Package ui - Structured output
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// OutputFormat selects how commands render their results
+type OutputFormat string
+
+const (
+	// OutputText renders results as tables and text for people
+	OutputText OutputFormat = "text"
+
+	// OutputJSON renders results as one JSON document on stdout
+	OutputJSON OutputFormat = "json"
+)
+
+// outputFormat is the format selected with --output
+var outputFormat = OutputText
+
+// ParseOutputFormat parses an --output value
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	switch format := OutputFormat(value); format {
+	case OutputText, OutputJSON:
+		return format, nil
+	case "":
+		return OutputText, nil
+	default:
+		return "", fmt.Errorf(T("invalid output format '%s', must be text or json"), value)
+	}
+}
+
+// SetOutputFormat sets the format used by Render. In JSON mode status
+// messages and step progress go to stderr, so stdout holds nothing but the
+// JSON document.
+func SetOutputFormat(format OutputFormat) {
+	outputFormat = format
+}
+
+// JSONOutput reports whether results are rendered as JSON
+func JSONOutput() bool {
+	return outputFormat == OutputJSON
+}
+
+// Render outputs a command's result: data encoded as JSON in JSON mode,
+// otherwise whatever text prints for people. data should use JSON field
+// tags and plain values, not colored or translated strings.
+func Render(data interface{}, text func()) error {
+	if JSONOutput() {
+		return PrintJSON(data)
+	}
+	text()
+	return nil
+}
+
+// StatusOutput is where status messages, headers, lists and progress are
+// written: stdout, or stderr in JSON mode
+func StatusOutput() io.Writer {
+	if JSONOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
@@ -0,0 +1,34 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	format, err := ParseOutputFormat("json")
+	require.NoError(t, err)
+	assert.Equal(t, OutputJSON, format)
+
+	format, err = ParseOutputFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, OutputText, format)
+
+	_, err = ParseOutputFormat("yaml")
+	assert.Error(t, err)
+}
+
+func TestRenderText(t *testing.T) {
+	defer SetOutputFormat(OutputText)
+
+	called := false
+	require.NoError(t, Render(nil, func() { called = true }))
+	assert.True(t, called)
+
+	SetOutputFormat(OutputJSON)
+	called = false
+	require.NoError(t, Render(map[string]int{"files": 1}, func() { called = true }))
+	assert.False(t, called)
+}
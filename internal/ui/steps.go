@@ -0,0 +1,128 @@
+// Package ui - Spinner and step indicator
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// spinnerFrames are the animation frames of the spinner
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is the delay between spinner frames
+const spinnerInterval = 100 * time.Millisecond
+
+// Spinner shows an animated indicator while a long operation runs
+// On non-terminal output it prints nothing
+type Spinner struct {
+	message string
+	stop    chan struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+// NewSpinner creates a spinner with the given message
+func NewSpinner(message string) *Spinner {
+	return &Spinner{message: message}
+}
+
+// Start begins animating the spinner
+func (s *Spinner) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil || JSONOutput() || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+
+		for frame := 0; ; frame++ {
+			fmt.Printf("\r\033[K%s %s", Info(spinnerFrames[frame%len(spinnerFrames)]), s.message)
+
+			select {
+			case <-stop:
+				ClearLine()
+				return
+			case <-ticker.C:
+			}
+		}
+	}(s.stop, s.done)
+}
+
+// Stop halts the animation and clears the spinner line
+func (s *Spinner) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+// StepRunner runs a fixed sequence of steps, reporting each one as
+// "[1/4] Detecting backend… done (0.3s)"
+type StepRunner struct {
+	total   int
+	current int
+}
+
+// NewStepRunner creates a runner for the given number of steps
+func NewStepRunner(total int) *StepRunner {
+	return &StepRunner{total: total}
+}
+
+// Run executes the next step, showing a spinner while it runs
+func (r *StepRunner) Run(title string, fn func() error) error {
+	return r.run(title, fn, true)
+}
+
+// RunInteractive executes the next step without a spinner, for steps that
+// may prompt the user (e.g., for a password or host key confirmation)
+func (r *StepRunner) RunInteractive(title string, fn func() error) error {
+	return r.run(title, fn, false)
+}
+
+// run executes a step and prints its outcome
+func (r *StepRunner) run(title string, fn func() error, animate bool) error {
+	r.current++
+	label := fmt.Sprintf("%s %s…", Dim(fmt.Sprintf("[%d/%d]", r.current, r.total)), T(title))
+
+	var spinner *Spinner
+	if animate {
+		spinner = NewSpinner(label)
+		spinner.Start()
+	}
+
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start).Seconds()
+
+	if spinner != nil {
+		spinner.Stop()
+	}
+
+	if err != nil {
+		fmt.Fprintf(StatusOutput(), "%s %s (%.1fs)\n", label, Error(T("failed")), elapsed)
+		return err
+	}
+
+	fmt.Fprintf(StatusOutput(), "%s %s (%.1fs)\n", label, Success(T("done")), elapsed)
+	return nil
+}
@@ -0,0 +1,37 @@
+package ui
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepRunner(t *testing.T) {
+	steps := NewStepRunner(2)
+
+	calls := 0
+	err := steps.Run("First", func() error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, err)
+
+	failure := errors.New("boom")
+	err = steps.RunInteractive("Second", func() error {
+		calls++
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, steps.current)
+}
+
+func TestSpinnerNotTerminal(t *testing.T) {
+	// Test output is not a terminal, so the spinner must stay inert
+	s := NewSpinner("working")
+	s.Start()
+	assert.Nil(t, s.stop)
+	s.Stop()
+}
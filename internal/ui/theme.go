@@ -0,0 +1,89 @@
+// Package ui - Color themes
+// Copyright (c) 2025 orpheus497
+package ui
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fatih/color"
+)
+
+// DefaultTheme is the theme used when settings.theme is empty
+const DefaultTheme = "default"
+
+// Theme defines the colors used for each kind of output
+type Theme struct {
+	Success   *color.Color
+	Error     *color.Color
+	Warning   *color.Color
+	Info      *color.Color
+	Bold      *color.Color
+	Dim       *color.Color
+	Highlight *color.Color
+}
+
+// themes contains the built-in themes by name
+var themes = map[string]Theme{
+	DefaultTheme: {
+		Success:   color.New(color.FgGreen),
+		Error:     color.New(color.FgRed),
+		Warning:   color.New(color.FgYellow),
+		Info:      color.New(color.FgCyan),
+		Bold:      color.New(color.Bold),
+		Dim:       color.New(color.Faint),
+		Highlight: color.New(color.FgGreen),
+	},
+	"high-contrast": {
+		Success:   color.New(color.FgHiGreen, color.Bold),
+		Error:     color.New(color.FgHiRed, color.Bold),
+		Warning:   color.New(color.FgHiYellow, color.Bold),
+		Info:      color.New(color.FgHiCyan, color.Bold),
+		Bold:      color.New(color.FgHiWhite, color.Bold),
+		Dim:       color.New(color.FgWhite),
+		Highlight: color.New(color.FgBlack, color.BgHiYellow, color.Bold),
+	},
+	// monochrome relies on weight and underline only, for terminals or
+	// users that cannot distinguish colors
+	"monochrome": {
+		Success:   color.New(color.Bold),
+		Error:     color.New(color.Bold, color.Underline),
+		Warning:   color.New(color.Bold),
+		Info:      color.New(color.Reset),
+		Bold:      color.New(color.Bold),
+		Dim:       color.New(color.Faint),
+		Highlight: color.New(color.ReverseVideo),
+	},
+}
+
+// ThemeNames returns the names of the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyTheme replaces the color functions with those of the named theme
+func ApplyTheme(name string) error {
+	if name == "" {
+		name = DefaultTheme
+	}
+
+	theme, exists := themes[name]
+	if !exists {
+		return fmt.Errorf("unknown theme: %s (available: %v)", name, ThemeNames())
+	}
+
+	Success = theme.Success.SprintFunc()
+	Error = theme.Error.SprintFunc()
+	Warning = theme.Warning.SprintFunc()
+	Info = theme.Info.SprintFunc()
+	Bold = theme.Bold.SprintFunc()
+	Dim = theme.Dim.SprintFunc()
+	Highlight = theme.Highlight.SprintFunc()
+
+	return nil
+}
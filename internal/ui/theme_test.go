@@ -0,0 +1,33 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTheme(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() {
+		color.NoColor = noColor
+		ApplyTheme(DefaultTheme)
+	}()
+
+	require.NoError(t, ApplyTheme("monochrome"))
+	assert.Equal(t, "\x1b[1mok\x1b[22m", Success("ok"))
+	assert.Equal(t, "\x1b[7m●\x1b[27m", Highlight("●"))
+
+	require.NoError(t, ApplyTheme(""))
+	assert.Equal(t, "\x1b[32mok\x1b[0m", Success("ok"))
+}
+
+func TestApplyThemeUnknown(t *testing.T) {
+	assert.Error(t, ApplyTheme("neon"))
+}
+
+func TestThemeNames(t *testing.T) {
+	assert.Equal(t, []string{"default", "high-contrast", "monochrome"}, ThemeNames())
+}
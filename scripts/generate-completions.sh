@@ -19,37 +19,44 @@ fi
 
 echo "Generating shell completions..."
 
-# Generate Bash completion
-echo "  - Generating Bash completion..."
-"$BUILD_DIR/klip" completion bash > "$COMPLETION_DIR/klip.bash"
+for cmd in klip klipc klipr; do
+    if [ ! -f "$BUILD_DIR/$cmd" ]; then
+        echo "  - Skipping $cmd (not built)"
+        continue
+    fi
 
-# Generate Zsh completion
-echo "  - Generating Zsh completion..."
-"$BUILD_DIR/klip" completion zsh > "$COMPLETION_DIR/_klip"
+    # Generate Bash completion
+    echo "  - Generating Bash completion for $cmd..."
+    "$BUILD_DIR/$cmd" completion bash > "$COMPLETION_DIR/$cmd.bash"
 
-# Generate Fish completion
-echo "  - Generating Fish completion..."
-"$BUILD_DIR/klip" completion fish > "$COMPLETION_DIR/klip.fish"
+    # Generate Zsh completion
+    echo "  - Generating Zsh completion for $cmd..."
+    "$BUILD_DIR/$cmd" completion zsh > "$COMPLETION_DIR/_$cmd"
 
-# Generate PowerShell completion
-echo "  - Generating PowerShell completion..."
-"$BUILD_DIR/klip" completion powershell > "$COMPLETION_DIR/klip.ps1"
+    # Generate Fish completion
+    echo "  - Generating Fish completion for $cmd..."
+    "$BUILD_DIR/$cmd" completion fish > "$COMPLETION_DIR/$cmd.fish"
+
+    # Generate PowerShell completion
+    echo "  - Generating PowerShell completion for $cmd..."
+    "$BUILD_DIR/$cmd" completion powershell > "$COMPLETION_DIR/$cmd.ps1"
+done
 
 echo "Completions generated successfully!"
 echo ""
 echo "To install completions:"
 echo ""
 echo "Bash:"
-echo "  sudo cp $COMPLETION_DIR/klip.bash /etc/bash_completion.d/klip"
+echo "  sudo cp $COMPLETION_DIR/klip.bash /etc/bash_completion.d/klip (likewise klipc, klipr)"
 echo "  or source $COMPLETION_DIR/klip.bash in your ~/.bashrc"
 echo ""
 echo "Zsh:"
-echo "  cp $COMPLETION_DIR/_klip to a directory in your \$fpath"
+echo "  cp $COMPLETION_DIR/_klip* to a directory in your \$fpath"
 echo "  or add this to your ~/.zshrc:"
 echo "    source $COMPLETION_DIR/_klip"
 echo ""
 echo "Fish:"
-echo "  cp $COMPLETION_DIR/klip.fish ~/.config/fish/completions/"
+echo "  cp $COMPLETION_DIR/*.fish ~/.config/fish/completions/"
 echo ""
 echo "PowerShell:"
 echo "  Add this to your PowerShell profile:"
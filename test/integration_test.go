@@ -2,11 +2,14 @@ package test
 
 import (
 	"context"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/orpheus497/klip/internal/backend"
+	"github.com/orpheus497/klip/internal/cli"
 	"github.com/orpheus497/klip/internal/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -83,6 +86,8 @@ func TestBackendRegistry(t *testing.T) {
 	assert.True(t, backendNames["tailscale"])
 	assert.True(t, backendNames["headscale"])
 	assert.True(t, backendNames["netbird"])
+	assert.True(t, backendNames["zerotier"])
+	assert.True(t, backendNames["wireguard"])
 
 	// Test backend retrieval
 	lanBackend, err := registry.Get("lan")
@@ -230,3 +235,40 @@ TS_REMOTE_HOST="tshost"
 	assert.Equal(t, "tsuser", tsProfile.RemoteUser)
 	assert.Equal(t, "tshost", tsProfile.RemoteHost)
 }
+
+// TestWaitForHost tests polling a host until its SSH server answers
+func TestWaitForHost(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-test\r\n"))
+			conn.Close()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	lan := &backend.LANBackend{}
+
+	addr, err := cli.WaitForHost(context.Background(), lan, "127.0.0.1", port, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", addr)
+
+	// A host that stays up never goes down
+	err = cli.WaitForHostDown(context.Background(), lan, "127.0.0.1", port, 200*time.Millisecond)
+	assert.Error(t, err)
+
+	// A closed port never comes up
+	listener.Close()
+	_, err = cli.WaitForHost(context.Background(), lan, "127.0.0.1", port, 200*time.Millisecond)
+	assert.Error(t, err)
+
+	err = cli.WaitForHostDown(context.Background(), lan, "127.0.0.1", port, 5*time.Second)
+	assert.NoError(t, err)
+}